@@ -0,0 +1,171 @@
+// Command gotsconform checks another implementation of the gots protocol
+// and reports which features conform. With --port it listens like gotsl
+// and checks the first client that connects; with --target it connects to
+// a listener like gotsr and checks that.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/conformance"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// Exit codes: every check passed or was skipped, a check failed, or the
+// checks could not run.
+const (
+	exitPass  = 0
+	exitFail  = 1
+	exitError = 2
+)
+
+func main() {
+	var port string
+	var networkInterface string
+	var target string
+	var sharedSecret string
+	var certFingerprint string
+	var remoteDir string
+	var echoIP string
+	var wait time.Duration
+	var timeout time.Duration
+	var jsonOutput bool
+
+	flag.StringVar(&port, "port", "", "Listen on this port and check the first client that connects")
+	flag.StringVar(&networkInterface, "interface", "0.0.0.0", "Interface to listen on with --port")
+	flag.StringVar(&target, "target", "", "Connect to the listener at host:port and check it")
+	flag.StringVar(&sharedSecret, "s", "", "Shared secret to require from the client, or to send to the listener")
+	flag.StringVar(&sharedSecret, "shared-secret", "", "Shared secret to require from the client, or to send to the listener")
+	flag.StringVar(&certFingerprint, "cert-fingerprint", "", "SHA256 fingerprint the listener's certificate must have with --target")
+	flag.StringVar(&remoteDir, "remote-dir", "", "Writable directory on the client for the transfer checks (default /tmp, or C:\\Windows\\Temp)")
+	flag.StringVar(&echoIP, "echo-ip", "", "Address the client can reach for the tunnel checks (default the address it connected to)")
+	flag.DurationVar(&wait, "wait", 5*time.Minute, "How long to wait for a client with --port")
+	flag.DurationVar(&timeout, "timeout", conformance.DefaultTimeout, "Timeout of each request")
+	flag.BoolVar(&jsonOutput, "json", false, "Print the results as JSON instead of a table")
+	flag.Parse()
+
+	var results []conformance.Result
+	var err error
+	switch {
+	case (port == "") == (target == ""):
+		fmt.Fprintln(os.Stderr, "Error: give either --port to check a client or --target to check a listener")
+		flag.Usage()
+		os.Exit(exitError)
+	case port != "":
+		results, err = checkClient(port, networkInterface, wait, conformance.ClientOptions{
+			SharedSecret: sharedSecret,
+			RemoteDir:    remoteDir,
+			EchoIP:       echoIP,
+			Timeout:      timeout,
+		})
+	default:
+		results = conformance.CheckListener(tlsDialer(target, certFingerprint, timeout), conformance.ListenerOptions{
+			SharedSecret: sharedSecret,
+			Timeout:      timeout,
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		err = conformance.WriteTable(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
+	if !conformance.Passed(results) {
+		os.Exit(exitFail)
+	}
+	os.Exit(exitPass)
+}
+
+// checkClient listens with a new self-signed certificate, waits for a client
+// to identify itself and checks it.
+func checkClient(port, networkInterface string, wait time.Duration, opts conformance.ClientOptions) ([]conformance.Result, error) {
+	cert, fingerprint, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	listener := server.NewListener(port, networkInterface, tlsConfig, opts.SharedSecret)
+	ln, err := listener.Start()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		listener.Shutdown(ctx)
+	}()
+	log.Printf("Certificate fingerprint (SHA256): %s", fingerprint)
+	log.Printf("Waiting up to %s for a client on %s", wait, ln.Addr())
+
+	clientAddr, err := waitForClient(listener, wait)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Checking %s (%s)", clientAddr, listener.GetClientIdentifier(clientAddr))
+	return conformance.CheckClient(listener, clientAddr, opts), nil
+}
+
+// waitForClient returns the first client that has sent its IDENT.
+func waitForClient(listener *server.Listener, wait time.Duration) (string, error) {
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		for _, addr := range listener.GetClients() {
+			if listener.GetClientIdentifier(addr) != "" {
+				return addr, nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return "", fmt.Errorf("no client identified itself within %s", wait)
+}
+
+// tlsDialer returns a function that connects to target over TLS. Without a
+// fingerprint any certificate is accepted, since listeners usually have a
+// self-signed one.
+func tlsDialer(target, fingerprint string, timeout time.Duration) func() (net.Conn, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true, // Checked by VerifyPeerCertificate
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no certificates provided by server")
+			}
+			if fingerprint == "" {
+				return nil
+			}
+			if hash := sha256.Sum256(rawCerts[0]); hex.EncodeToString(hash[:]) != fingerprint {
+				return fmt.Errorf("certificate fingerprint mismatch: expected %s, got %s", fingerprint, hex.EncodeToString(hash[:]))
+			}
+			return nil
+		},
+	}
+	if fingerprint == "" {
+		log.Printf("Warning: no --cert-fingerprint given, accepting any certificate from %s", target)
+	}
+	return func() (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", target, config)
+	}
+}
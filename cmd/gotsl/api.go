@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/frjcomp/gots/pkg/api"
+	"github.com/frjcomp/gots/pkg/audit"
+	"github.com/frjcomp/gots/pkg/auth"
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// startControlAPI starts the control API if configured. It returns a nil
+// net.Listener when the API is disabled.
+func startControlAPI(cfg config.ControlAPIConfig, listener *server.Listener, tlsConfig *tls.Config, auditLog *audit.Logger) (net.Listener, error) {
+	if cfg.Listen == "" {
+		return nil, nil
+	}
+	authenticator, err := buildAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := buildPolicies(cfg.Policies)
+	if err != nil {
+		return nil, err
+	}
+	srv := api.NewServer(listener, authenticator)
+	srv.SetPolicies(policies)
+	srv.SetTunnelClient(tunnelClient)
+	srv.SetAuditLogger(auditLog)
+	ln, err := srv.Start(cfg.Listen, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Control API listening on https://%s (%d auth backend(s))", ln.Addr(), len(authenticator))
+	return ln, nil
+}
+
+// buildAuthenticator assembles the configured operator auth backends.
+func buildAuthenticator(cfg config.ControlAPIConfig) (auth.Chain, error) {
+	roles := auth.RoleMap{Roles: make(map[string]auth.Role), Default: auth.RoleReadOnly}
+	for name, r := range cfg.Roles {
+		role, err := auth.ParseRole(r)
+		if err != nil {
+			return nil, err
+		}
+		roles.Roles[name] = role
+	}
+	if cfg.DefaultRole != "" {
+		role, err := auth.ParseRole(cfg.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		roles.Default = role
+	}
+
+	var chain auth.Chain
+	if cfg.Token != "" {
+		chain = append(chain, auth.StaticToken{Token: cfg.Token, Role: auth.RoleAdmin})
+	}
+	if cfg.HtpasswdFile != "" {
+		htpasswd, err := auth.LoadHtpasswd(cfg.HtpasswdFile, roles)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, htpasswd)
+	}
+	if cfg.OIDC.Issuer != "" {
+		chain = append(chain, auth.NewOIDC(auth.OIDCConfig{
+			Issuer:      cfg.OIDC.Issuer,
+			Audience:    cfg.OIDC.Audience,
+			RoleClaim:   cfg.OIDC.RoleClaim,
+			AdminValues: cfg.OIDC.AdminValues,
+			Roles:       roles,
+		}))
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("control API requires at least one auth backend")
+	}
+	return chain, nil
+}
+
+// buildPolicies converts configured operator policies.
+func buildPolicies(cfg map[string]config.PolicyConfig) (auth.Policies, error) {
+	policies := make(auth.Policies, len(cfg))
+	for name, p := range cfg {
+		policy := auth.Policy{ClientTags: p.ClientTags}
+		for _, c := range p.Deny {
+			capability, err := auth.ParseCapability(c)
+			if err != nil {
+				return nil, err
+			}
+			policy.Deny = append(policy.Deny, capability)
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// approver is implemented by *server.Listener.
+type approver interface {
+	PendingApproval(clientAddr string) bool
+	Approve(clientAddr string) error
+}
+
+// pendingApproval reports whether a client waits for an operator to
+// approve it.
+func pendingApproval(l server.ListenerInterface, clientAddr string) bool {
+	if a, ok := l.(approver); ok {
+		return a.PendingApproval(clientAddr)
+	}
+	return false
+}
+
+// requireApproved prints an error and returns false if the client waits
+// for approval. Commands are refused by the listener anyway; tunnels check
+// first so they do not open a local port that leads nowhere.
+func requireApproved(l server.ListenerInterface, clientAddr string) bool {
+	if !pendingApproval(l, clientAddr) {
+		return true
+	}
+	fmt.Printf("Error: client %s is pending approval; use 'sysinfo' to look at it and 'approve' to use it\n", clientAddr)
+	return false
+}
+
+// handleApprove lets a pending client accept commands, transfers and tunnels.
+func handleApprove(l server.ListenerInterface, args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: approve <client_id>")
+		return
+	}
+	a, ok := l.(approver)
+	if !ok {
+		fmt.Println("Error: listener does not support approving clients")
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" {
+		return
+	}
+	if !a.PendingApproval(clientAddr) {
+		fmt.Printf("Client %s is not pending approval\n", clientAddr)
+		return
+	}
+	if err := a.Approve(clientAddr); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Approved %s\n", clientLabel(l, clientAddr))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// assetLister is implemented by *server.Listener.
+type assetLister interface {
+	Assets() []server.Asset
+	GetAsset(machineID string) (server.Asset, bool)
+}
+
+func handleAssets(l server.ListenerInterface, args []string) {
+	lister, ok := l.(assetLister)
+	if !ok {
+		fmt.Println("Error: listener does not track assets")
+		return
+	}
+	switch len(args) {
+	case 0:
+		printAssets(lister.Assets())
+	case 1:
+		asset, ok := findAsset(lister.Assets(), args[0])
+		if !ok {
+			fmt.Printf("No asset matching %s\n", args[0])
+			return
+		}
+		printAssetHistory(asset)
+	default:
+		fmt.Println("Usage: assets [machine_id]")
+	}
+}
+
+// findAsset matches a full machine ID or a unique prefix of one.
+func findAsset(assets []server.Asset, id string) (server.Asset, bool) {
+	var found []server.Asset
+	for _, a := range assets {
+		if a.MachineID == id {
+			return a, true
+		}
+		if strings.HasPrefix(a.MachineID, id) {
+			found = append(found, a)
+		}
+	}
+	if len(found) != 1 {
+		return server.Asset{}, false
+	}
+	return found[0], true
+}
+
+func printAssets(assets []server.Asset) {
+	if len(assets) == 0 {
+		fmt.Println("No assets seen")
+		return
+	}
+	fmt.Println("\nAssets:")
+	for _, a := range assets {
+		state := "offline"
+		if a.Online() {
+			state = "online"
+		}
+		fmt.Printf("  %s  %-20s %-8s %-7s sessions=%d last=%s\n",
+			a.MachineID, a.Hostname, a.OS, state, len(a.Sessions), a.LastSeen.Format(time.DateTime))
+	}
+	fmt.Println()
+}
+
+func printAssetHistory(a server.Asset) {
+	fmt.Printf("\nAsset %s (host=%s, os=%s)\n", a.MachineID, a.Hostname, a.OS)
+	fmt.Printf("  first seen: %s\n", a.FirstSeen.Format(time.DateTime))
+	for _, s := range a.Sessions {
+		until := "connected"
+		if !s.Disconnected.IsZero() {
+			until = s.Disconnected.Format(time.DateTime)
+		}
+		fmt.Printf("  %s - %-19s  %s [%s] ip=%s\n", s.Connected.Format(time.DateTime), until, s.Address, s.Identifier, s.IP)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/loot"
+	"github.com/frjcomp/gots/pkg/version"
+)
+
+// backupPassphraseEnv names the variable holding the passphrase a backup is
+// encrypted with when no age recipient is given.
+const backupPassphraseEnv = "GOTS_BACKUP_PASSPHRASE"
+
+// backupManifestName is the first entry of every backup archive.
+const backupManifestName = "manifest.json"
+
+// backupItem is a file or directory of the listener in a backup.
+type backupItem struct {
+	Kind    string `json:"kind"`    // config, cert, key, htpasswd, audit, loot, recordings or scrollback
+	Path    string `json:"path"`    // Where it was, as configured
+	Archive string `json:"archive"` // Its name in the archive, the prefix of a directory's entries
+	Dir     bool   `json:"dir,omitempty"`
+}
+
+// backupManifest lists what a backup holds and where it came from.
+type backupManifest struct {
+	Created time.Time    `json:"created"`
+	Version string       `json:"version"`
+	Items   []backupItem `json:"items"`
+}
+
+// backupItems lists the files and directories a listener with cfg keeps
+// its state in. Paths that do not exist yet are left out.
+func backupItems(configPath string, cfg *config.ServerConfig) []backupItem {
+	var items []backupItem
+	add := func(kind, p string) {
+		if p == "" {
+			return
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return
+		}
+		item := backupItem{Kind: kind, Path: p, Dir: info.IsDir()}
+		if item.Dir {
+			item.Archive = fmt.Sprintf("%02d-%s", len(items), kind)
+		} else {
+			item.Archive = fmt.Sprintf("%02d-%s-%s", len(items), kind, filepath.Base(p))
+		}
+		items = append(items, item)
+	}
+	add("config", configPath)
+	add("cert", cfg.CertFile)
+	add("key", cfg.KeyFile)
+	for _, p := range cfg.Profiles {
+		add("cert", p.CertFile)
+		add("key", p.KeyFile)
+	}
+	add("htpasswd", cfg.ControlAPI.HtpasswdFile)
+	add("hashes", cfg.ClientHashesFile)
+	add("audit", cfg.AuditLog)
+	add("loot", cfg.LootDir)
+	add("recordings", cfg.RecordDir)
+	add("scrollback", cfg.ScrollbackDir)
+	return items
+}
+
+// runBackupCommand runs "gotsl backup": it archives the listener's config,
+// certificates, htpasswd file, audit log, loot, recordings and PTY
+// scrollback into an age-encrypted tar file.
+func runBackupCommand(configPath string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.SetOutput(out)
+	outPath := flags.String("out", "", "Backup file to write, e.g. backup.tar.age")
+	recipient := flags.String("recipient", "", "age public key to encrypt to (default: passphrase from "+backupPassphraseEnv+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *outPath == "" || flags.NArg() > 0 {
+		return errors.New("usage: gotsl [--config <file>] backup --out <file.tar.age> [--recipient <age1...>]")
+	}
+	var r age.Recipient
+	var err error
+	if *recipient != "" {
+		r, err = age.ParseX25519Recipient(*recipient)
+	} else {
+		r, err = backupPassphrase(age.NewScryptRecipient)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadServerConfigFromFile(configPath, "", "", false)
+	if err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	manifest := backupManifest{Created: time.Now().UTC(), Version: version.Version, Items: backupItems(configPath, cfg)}
+
+	f, err := os.OpenFile(*outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeBackup(f, r, manifest)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*outPath)
+		return err
+	}
+	for _, item := range manifest.Items {
+		fmt.Fprintf(out, "  %-10s %s\n", item.Kind, item.Path)
+	}
+	fmt.Fprintf(out, "Wrote %s\n", *outPath)
+	return nil
+}
+
+// backupPassphrase reads the backup passphrase and makes an age recipient
+// or identity from it.
+func backupPassphrase[T any](fn func(string) (T, error)) (T, error) {
+	passphrase := os.Getenv(backupPassphraseEnv)
+	if passphrase == "" {
+		var zero T
+		return zero, fmt.Errorf("set %s or pass an age key", backupPassphraseEnv)
+	}
+	return fn(passphrase)
+}
+
+// writeBackup writes the manifest and then every item to an encrypted tar
+// stream.
+func writeBackup(w io.Writer, r age.Recipient, manifest backupManifest) error {
+	enc, err := age.Encrypt(w, r)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(enc)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: backupManifestName, Mode: 0600, Size: int64(len(data)), ModTime: manifest.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, item := range manifest.Items {
+		if err := archiveItem(tw, item); err != nil {
+			return fmt.Errorf("%s %s: %w", item.Kind, item.Path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// archiveItem adds a file, or a directory tree, to the archive.
+func archiveItem(tw *tar.Writer, item backupItem) error {
+	if !item.Dir {
+		info, err := os.Stat(item.Path)
+		if err != nil {
+			return err
+		}
+		return archiveFile(tw, item.Path, item.Archive, info)
+	}
+	return filepath.WalkDir(item.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(item.Path, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := item.Archive + "/" + filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()})
+		case info.Mode().IsRegular():
+			return archiveFile(tw, p, name, info)
+		}
+		return nil // Sockets, links and the like are not listener state
+	})
+}
+
+// archiveFile adds a regular file as it was when info was taken. A file
+// that grows meanwhile, such as the audit log of a running listener, is
+// cut at that size, so its entry stays consistent.
+func archiveFile(tw *tar.Writer, p, name string, info fs.FileInfo) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hdr := &tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, f, info.Size()); err != nil {
+		return fmt.Errorf("%s changed while it was read: %w", p, err)
+	}
+	return nil
+}
+
+// runRestoreCommand runs "gotsl restore": it puts the files of a backup
+// back where they were, or under --dir. Existing files are kept unless
+// --force is given.
+func runRestoreCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.SetOutput(out)
+	inPath := flags.String("in", "", "Backup file to read")
+	dir := flags.String("dir", "", "Restore under this directory instead of the original paths")
+	identity := flags.String("identity", "", "age identity file to decrypt with (default: passphrase from "+backupPassphraseEnv+")")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *inPath == "" || flags.NArg() > 0 {
+		return errors.New("usage: gotsl restore --in <file.tar.age> [--dir <dir>] [--identity <file>] [--force]")
+	}
+	var identities []age.Identity
+	if *identity != "" {
+		f, err := os.Open(*identity)
+		if err != nil {
+			return err
+		}
+		identities, err = age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("invalid identity file: %w", err)
+		}
+	} else {
+		id, err := backupPassphrase(age.NewScryptIdentity)
+		if err != nil {
+			return err
+		}
+		identities = []age.Identity{id}
+	}
+
+	f, err := os.Open(*inPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return restoreBackup(f, identities, *dir, *force, out)
+}
+
+// restoreBackup decrypts a backup and writes its files.
+func restoreBackup(r io.Reader, identities []age.Identity, dir string, force bool, out io.Writer) error {
+	dec, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt backup: %w", err)
+	}
+	tr := tar.NewReader(dec)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return errors.New("not a gotsl backup: manifest missing")
+	}
+	var manifest backupManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	fmt.Fprintf(out, "Backup of %s taken with gotsl %s\n", manifest.Created.Format(time.RFC3339), manifest.Version)
+
+	restored, kept := 0, 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target, err := restoreTarget(manifest, hdr.Name, dir)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("unexpected entry %s in backup", hdr.Name)
+		}
+		if _, err := os.Lstat(target); err == nil && !force {
+			fmt.Fprintf(out, "  kept existing %s\n", target)
+			kept++
+			continue
+		}
+		if err := restoreFile(tr, target, fs.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		restored++
+	}
+	fmt.Fprintf(out, "Restored %d files", restored)
+	if kept > 0 {
+		fmt.Fprintf(out, ", kept %d existing ones (use --force to overwrite them)", kept)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// restoreTarget returns where an archive entry goes: under dir if set,
+// otherwise back to the path of the item it belongs to. Entries never
+// leave their item's directory.
+func restoreTarget(manifest backupManifest, name, dir string) (string, error) {
+	name = strings.TrimSuffix(name, "/")
+	if dir != "" {
+		return loot.Confine(dir, filepath.FromSlash(path.Clean(name)))
+	}
+	for _, item := range manifest.Items {
+		if !item.Dir && name == item.Archive {
+			return item.Path, nil
+		}
+		if rel, ok := strings.CutPrefix(name, item.Archive+"/"); ok && item.Dir {
+			return loot.Confine(item.Path, filepath.FromSlash(rel))
+		}
+	}
+	return "", fmt.Errorf("entry %s is not listed in the backup manifest", name)
+}
+
+// restoreFile writes one file, creating its directory.
+func restoreFile(r io.Reader, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	lootDir := filepath.Join(dir, "loot")
+	auditLog := filepath.Join(dir, "audit.jsonl")
+	configPath := filepath.Join(dir, "gotsl.json")
+	files := map[string]string{
+		configPath: `{"loot_dir": "` + lootDir + `", "audit_log": "` + auditLog + `"}`,
+		auditLog:   `{"action":"exec"}` + "\n",
+		filepath.Join(lootDir, "10.0.0.1", "etc", "passwd"): "root:x:0:0\n",
+	}
+	for p, content := range files {
+		os.MkdirAll(filepath.Dir(p), 0700)
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv(backupPassphraseEnv, "correct horse")
+
+	backup := filepath.Join(dir, "backup.tar.age")
+	var out bytes.Buffer
+	if err := runBackupCommand(configPath, []string{"--out", backup}, &out); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	for _, kind := range []string{"config", "audit", "loot"} {
+		if !strings.Contains(out.String(), kind) {
+			t.Errorf("expected %s in the backup, got:\n%s", kind, out.String())
+		}
+	}
+	if err := runBackupCommand(configPath, []string{"--out", backup}, &out); err == nil {
+		t.Error("expected an existing backup file not to be overwritten")
+	}
+
+	// Restore in place: missing files come back, existing ones are kept
+	os.RemoveAll(lootDir)
+	os.WriteFile(auditLog, []byte("newer\n"), 0600)
+	out.Reset()
+	if err := runRestoreCommand([]string{"--in", backup}, &out); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(lootDir, "10.0.0.1", "etc", "passwd")); string(got) != "root:x:0:0\n" {
+		t.Errorf("loot not restored, got %q", got)
+	}
+	if got, _ := os.ReadFile(auditLog); string(got) != "newer\n" {
+		t.Errorf("existing audit log overwritten without --force, got %q", got)
+	}
+	if !strings.Contains(out.String(), "kept 2 existing") {
+		t.Errorf("expected the kept files to be reported, got:\n%s", out.String())
+	}
+	if err := runRestoreCommand([]string{"--in", backup, "--force"}, &out); err != nil {
+		t.Fatalf("restore --force failed: %v", err)
+	}
+	if got, _ := os.ReadFile(auditLog); string(got) != files[auditLog] {
+		t.Errorf("expected --force to restore the audit log, got %q", got)
+	}
+
+	// Restore elsewhere, e.g. to inspect a backup
+	target := filepath.Join(dir, "inspect")
+	if err := runRestoreCommand([]string{"--in", backup, "--dir", target}, &out); err != nil {
+		t.Fatalf("restore --dir failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "02-loot", "10.0.0.1", "etc", "passwd")); err != nil {
+		t.Errorf("expected loot under --dir: %v", err)
+	}
+
+	t.Setenv(backupPassphraseEnv, "wrong")
+	if err := runRestoreCommand([]string{"--in", backup, "--dir", target}, &out); err == nil {
+		t.Error("expected a wrong passphrase to fail")
+	}
+}
+
+func TestRestoreTargetConfined(t *testing.T) {
+	manifest := backupManifest{Items: []backupItem{
+		{Kind: "config", Path: "/etc/gots/gotsl.json", Archive: "00-config-gotsl.json"},
+		{Kind: "loot", Path: "/srv/loot", Archive: "01-loot", Dir: true},
+	}}
+	if got, err := restoreTarget(manifest, "00-config-gotsl.json", ""); err != nil || got != "/etc/gots/gotsl.json" {
+		t.Errorf("config restored to %q, %v", got, err)
+	}
+	if got, err := restoreTarget(manifest, "01-loot/host/a", ""); err != nil || got != filepath.FromSlash("/srv/loot/host/a") {
+		t.Errorf("loot restored to %q, %v", got, err)
+	}
+	for _, name := range []string{"01-loot/../../etc/passwd", "02-other", "00-config-gotsl.json/x"} {
+		if got, err := restoreTarget(manifest, name, ""); err == nil {
+			t.Errorf("expected %s to be refused, got %q", name, got)
+		}
+	}
+	if got, err := restoreTarget(manifest, "../escape", t.TempDir()); err == nil {
+		t.Errorf("expected an entry outside --dir to be refused, got %q", got)
+	}
+}
+
+func TestBackupNeedsKey(t *testing.T) {
+	t.Setenv(backupPassphraseEnv, "")
+	err := runBackupCommand("", []string{"--out", filepath.Join(t.TempDir(), "b.tar.age")}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), backupPassphraseEnv) {
+		t.Errorf("expected an error naming %s, got %v", backupPassphraseEnv, err)
+	}
+}
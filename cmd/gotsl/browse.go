@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// listingArchiver is implemented by *server.Listener.
+type listingArchiver interface {
+	ListingArchives() []server.ListingArchive
+}
+
+// handleBrowse shows the directory listings collected from a host. It
+// never talks to the client, so hosts can be browsed after they have
+// disconnected and after the engagement is over.
+func handleBrowse(l server.ListenerInterface, args []string) {
+	archiver, ok := l.(listingArchiver)
+	if !ok {
+		fmt.Println("Error: listener does not keep directory listings")
+		return
+	}
+	archives := archiver.ListingArchives()
+	online := onlineListingKeys(l)
+	switch len(args) {
+	case 0:
+		printListingArchives(archives, online)
+		return
+	case 1, 2:
+	default:
+		fmt.Println("Usage: browse [<client_id> [dir]]")
+		return
+	}
+	archive, ok := findListingArchive(l, archives, args[0])
+	if !ok {
+		fmt.Printf("No collected listings for %s\n", args[0])
+		return
+	}
+	if len(args) == 1 {
+		printRecordedDirs(archive, online[archive.Key])
+		return
+	}
+	rl, ok := archive.Listing(args[1])
+	if !ok {
+		fmt.Printf("%s was not listed on %s\n", args[1], listingHost(archive))
+		printRecordedDirs(archive, online[archive.Key])
+		return
+	}
+	printRecordedListing(archive, rl, online[archive.Key], time.Now())
+}
+
+// listingKey returns the key a connected client's listings are archived
+// under.
+func listingKey(l server.ListenerInterface, addr string) string {
+	if meta, ok := l.GetClientMetadata(addr); ok && meta.MachineID != "" {
+		return meta.MachineID
+	}
+	return addr
+}
+
+func onlineListingKeys(l server.ListenerInterface) map[string]bool {
+	online := make(map[string]bool)
+	for _, addr := range l.GetClients() {
+		online[listingKey(l, addr)] = true
+	}
+	return online
+}
+
+// findListingArchive finds a host's listings by a connected client's ID,
+// or for hosts that left by key prefix, hostname, session identifier or
+// client address.
+func findListingArchive(l server.ListenerInterface, archives []server.ListingArchive, ref string) (server.ListingArchive, bool) {
+	if addr, err := resolveClientID(l, ref); err == nil {
+		key := listingKey(l, addr)
+		for _, a := range archives {
+			if a.Key == key {
+				return a, true
+			}
+		}
+	}
+	var found []server.ListingArchive
+	for _, a := range archives {
+		if a.Key == ref || a.Client == ref {
+			return a, true
+		}
+		if strings.HasPrefix(a.Key, ref) || a.Hostname == ref || listedBySession(a, ref) {
+			found = append(found, a)
+		}
+	}
+	if len(found) != 1 {
+		return server.ListingArchive{}, false
+	}
+	return found[0], true
+}
+
+func listedBySession(a server.ListingArchive, session string) bool {
+	for _, rl := range a.Listings {
+		if rl.Session != "" && rl.Session == session {
+			return true
+		}
+	}
+	return false
+}
+
+func listingHost(a server.ListingArchive) string {
+	if a.Hostname != "" {
+		return a.Hostname
+	}
+	return a.Key
+}
+
+func listingState(online bool) string {
+	if online {
+		return "online"
+	}
+	return "offline"
+}
+
+func printListingArchives(archives []server.ListingArchive, online map[string]bool) {
+	if len(archives) == 0 {
+		fmt.Println("No directory listings collected")
+		return
+	}
+	fmt.Println("\nCollected directory listings:")
+	for _, a := range archives {
+		fmt.Printf("  %s  %-20s %-7s dirs=%d updated=%s\n",
+			a.Key, a.Hostname, listingState(online[a.Key]), len(a.Listings), a.Updated.Format(time.DateTime))
+	}
+	fmt.Println()
+}
+
+func printRecordedDirs(a server.ListingArchive, online bool) {
+	fmt.Printf("\nDirectories listed on %s (%s, cached):\n", listingHost(a), listingState(online))
+	for _, rl := range a.Listings {
+		fmt.Printf("  %s  %s\n", rl.Listed.Format(time.DateTime), rl.Dir)
+	}
+	fmt.Println()
+}
+
+func printRecordedListing(a server.ListingArchive, rl server.RecordedListing, online bool, now time.Time) {
+	fmt.Printf("\nCached listing of %s on %s, listed %s (%s ago)", rl.Dir, listingHost(a),
+		rl.Listed.Format(time.DateTime), now.Sub(rl.Listed).Round(time.Second))
+	if rl.Session != "" {
+		fmt.Printf(" by session %s", rl.Session)
+	}
+	fmt.Println()
+	if !online {
+		fmt.Println("The host is offline; this is a read-only view and may be outdated.")
+	}
+	for _, e := range rl.Entries {
+		if e.IsDir {
+			fmt.Printf("  %s/\n", e.Name)
+		} else {
+			fmt.Printf("  %s\n", e.Name)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestBrowseOfflineHost(t *testing.T) {
+	l := server.NewListener("0", "127.0.0.1", &tls.Config{}, "")
+	addr := "10.0.0.7:4000"
+	l.CacheListing(addr, "/etc", []server.DirEntry{{Name: "ssh", IsDir: true}, {Name: "passwd"}})
+
+	out := captureStdout(t, func() { handleBrowse(l, nil) })
+	if !strings.Contains(out, addr) || !strings.Contains(out, "offline") || !strings.Contains(out, "dirs=1") {
+		t.Errorf("expected the archive to be listed as offline, got %q", out)
+	}
+
+	out = captureStdout(t, func() { handleBrowse(l, []string{addr, "/etc/"}) })
+	for _, want := range []string{"Cached listing of /etc", "ago", "read-only", "  ssh/\n", "  passwd\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+
+	out = captureStdout(t, func() { handleBrowse(l, []string{addr, "/root"}) })
+	if !strings.Contains(out, "/root was not listed") || !strings.Contains(out, "/etc") {
+		t.Errorf("expected the recorded directories, got %q", out)
+	}
+
+	out = captureStdout(t, func() { handleBrowse(l, []string{"10.0.0.8:1"}) })
+	if !strings.Contains(out, "No collected listings") {
+		t.Errorf("expected no match, got %q", out)
+	}
+}
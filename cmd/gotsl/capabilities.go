@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// optionalCapabilities are the features a client may be built without.
+var optionalCapabilities = []string{protocol.CapPTY, protocol.CapForward, protocol.CapSocks}
+
+// missingCapabilities lists the optional features a client lacks, e.g. a
+// gotsr built with -tags minimal.
+func missingCapabilities(meta server.ClientMetadata) []string {
+	var missing []string
+	for _, c := range optionalCapabilities {
+		if !meta.Supports(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// requireCapability prints an error and returns false if the client was
+// built without capability.
+func requireCapability(l server.ListenerInterface, clientAddr, capability string) bool {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	if meta.Supports(capability) {
+		return true
+	}
+	fmt.Printf("Error: client %s does not support %s (built with: %s)\n", clientAddr, capability, strings.Join(meta.Capabilities, ","))
+	return false
+}
+
+// capabilityInfo lists every capability for caps, with the commands that
+// need it, in display order.
+var capabilityInfo = []struct {
+	name, commands string
+}{
+	{protocol.CapExec, "commands, elevate"},
+	{protocol.CapTransfer, "upload, download"},
+	{protocol.CapPeek, "file, head, hexdump"},
+	{protocol.CapPTY, "shell"},
+	{protocol.CapForward, "forward"},
+	{protocol.CapSocks, "socks"},
+	{protocol.CapSysinfo, "sysinfo"},
+	{protocol.CapDelta, "upload (changed blocks only)"},
+	{protocol.CapSync, "sync"},
+	{protocol.CapWatch, "watch"},
+	{protocol.CapPipe, "forward pipe:<name>, pipe"},
+	{protocol.CapProbe, "sandbox checks on connect"},
+	{protocol.CapList, "path completion (without ls/dir parsing)"},
+	{protocol.CapScript, "py, ps1"},
+	{protocol.CapRunAs, "runas"},
+	{protocol.CapPatch, "patch"},
+	{protocol.CapRekey, "rekey_interval (new session keys)"},
+	{protocol.CapEnvFile, "setenv-file"},
+	{protocol.CapPrompt, "elevate --uac, exec with prompt over the control API"},
+}
+
+// handleCaps prints what a client supports, as announced in its IDENT.
+func handleCaps(l server.ListenerInterface, clientAddr string) {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	fmt.Printf("Capabilities of %s (%s):\n", clientLabel(l, clientAddr), clientAddr)
+	if meta.Capabilities == nil {
+		fmt.Println("  (not announced: the client predates capability negotiation, so all are assumed)")
+	}
+	known := make(map[string]bool, len(capabilityInfo))
+	for _, c := range capabilityInfo {
+		known[c.name] = true
+		status := "no"
+		if meta.Supports(c.name) {
+			status = "yes"
+		}
+		fmt.Printf("  %-9s %-4s %s\n", c.name, status, c.commands)
+	}
+	var other []string
+	for _, c := range meta.Capabilities {
+		if !known[c] {
+			other = append(other, c)
+		}
+	}
+	if len(other) > 0 {
+		fmt.Printf("  Also announced (unknown to this listener): %s\n", strings.Join(other, ", "))
+	}
+	fmt.Printf("Transport: %s\n", describeTransport(clientAddr, meta))
+	if meta.OS != "" {
+		fmt.Printf("OS: %s\n", meta.OS)
+	}
+}
+
+// describeTransport says how a client is connected.
+func describeTransport(clientAddr string, meta server.ClientMetadata) string {
+	parts := []string{"TLS over TCP"}
+	if strings.HasPrefix(clientAddr, "unix#") {
+		parts[0] = "TLS over a Unix socket"
+	}
+	if meta.ServerName != "" {
+		parts = append(parts, "SNI "+meta.ServerName)
+	}
+	if meta.Profile != "" {
+		parts = append(parts, "profile "+meta.Profile)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestMissingCapabilities(t *testing.T) {
+	if got := missingCapabilities(server.ClientMetadata{}); len(got) != 0 {
+		t.Errorf("expected nothing missing for a client without caps, got %v", got)
+	}
+	minimal := server.ClientMetadata{Capabilities: []string{"exec", "transfer"}}
+	got := missingCapabilities(minimal)
+	if len(got) != 3 || got[0] != "pty" || got[1] != "forward" || got[2] != "socks" {
+		t.Errorf("expected pty, forward and socks missing, got %v", got)
+	}
+}
+
+func TestHandleCaps(t *testing.T) {
+	ml := &mockListener{
+		clients:     []string{"10.0.0.1:1000"},
+		identifiers: map[string]string{"10.0.0.1:1000": "a1b2c3d4"},
+		metadata: map[string]server.ClientMetadata{
+			"10.0.0.1:1000": {Hostname: "web1", OS: "linux", ServerName: "cdn.example.com", Capabilities: []string{"exec", "transfer", "pty", "udp"}},
+		},
+	}
+	out := captureStdout(t, func() { dispatchCommand(ml, []string{"caps", "1"}) })
+	for _, want := range []string{
+		"Capabilities of a1b2c3d4@web1 (10.0.0.1:1000)",
+		"pty       yes  shell",
+		"peek      no   file, head, hexdump",
+		"socks     no   socks",
+		"unknown to this listener): udp",
+		"Transport: TLS over TCP, SNI cdn.example.com",
+		"OS: linux",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("caps output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Clients predating negotiation support everything
+	ml.metadata["10.0.0.1:1000"] = server.ClientMetadata{}
+	out = captureStdout(t, func() { handleCaps(ml, "10.0.0.1:1000") })
+	if !strings.Contains(out, "not announced") || strings.Contains(out, " no ") {
+		t.Errorf("expected all capabilities assumed, got:\n%s", out)
+	}
+}
+
+func TestPeekRequiresCapability(t *testing.T) {
+	ml := &mockListener{
+		clients:  []string{"10.0.0.1:1000"},
+		metadata: map[string]server.ClientMetadata{"10.0.0.1:1000": {Capabilities: []string{"exec", "transfer"}}},
+	}
+	out := captureStdout(t, func() { handleHead(ml, []string{"1", "/etc/passwd"}, false) })
+	if !strings.Contains(out, "does not support peek") || len(ml.sentCommands) != 0 {
+		t.Errorf("expected head to be refused, got %q (sent %q)", out, ml.sentCommands)
+	}
+}
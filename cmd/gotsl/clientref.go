@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// selectedClient is the client chosen with `use`, by address.
+var selectedClient string
+
+// rekeyedClients maps the old address of a session that reconnected for
+// new keys to its new one, so the selection follows it.
+var rekeyedClients = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// matchClientRef returns the ls numbers and addresses of clients whose
+// session identifier, hostname or one of whose tags equals ref.
+func matchClientRef(l server.ListenerInterface, ref string) (numbers []int, addrs []string) {
+	for i, addr := range l.GetClients() {
+		meta, _ := l.GetClientMetadata(addr)
+		if clientRefNames(l, addr, meta)[ref] {
+			numbers = append(numbers, i+1)
+			addrs = append(addrs, addr)
+		}
+	}
+	return numbers, addrs
+}
+
+// clientRefNames returns the names a client can be referred to by besides
+// its ls number.
+func clientRefNames(l server.ListenerInterface, addr string, meta server.ClientMetadata) map[string]bool {
+	names := make(map[string]bool)
+	if id := l.GetClientIdentifier(addr); id != "" {
+		names[id] = true
+	}
+	if meta.Hostname != "" {
+		names[meta.Hostname] = true
+	}
+	for _, tag := range meta.Tags {
+		names[tag] = true
+	}
+	return names
+}
+
+// clientRefCompletions returns the client references starting with prefix:
+// ls numbers, identifiers, hostnames and tags.
+func clientRefCompletions(l server.ListenerInterface, prefix string) []string {
+	seen := make(map[string]bool)
+	for i, addr := range l.GetClients() {
+		seen[strconv.Itoa(i+1)] = true
+		meta, _ := l.GetClientMetadata(addr)
+		for name := range clientRefNames(l, addr, meta) {
+			seen[name] = true
+		}
+	}
+	var refs []string
+	for ref := range seen {
+		if strings.HasPrefix(ref, prefix) {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// currentClient returns the client selected with `use`, or "" if none is
+// selected or it has disconnected.
+func currentClient(l server.ListenerInterface) string {
+	if selectedClient == "" {
+		return ""
+	}
+	for _, addr := range l.GetClients() {
+		if addr == selectedClient {
+			return addr
+		}
+	}
+	rekeyedClients.Lock()
+	to, ok := rekeyedClients.m[selectedClient]
+	delete(rekeyedClients.m, selectedClient)
+	rekeyedClients.Unlock()
+	if ok {
+		selectedClient = to
+		return currentClient(l)
+	}
+	return ""
+}
+
+// handleUse selects the client that commands default to.
+func handleUse(l server.ListenerInterface, args []string) {
+	switch {
+	case len(args) > 1:
+		fmt.Println("Usage: use [<client> | none]")
+	case len(args) == 0:
+		if addr := currentClient(l); addr != "" {
+			fmt.Printf("Using %s\n", clientLabel(l, addr))
+		} else {
+			fmt.Println("No client selected")
+		}
+	case args[0] == "none":
+		selectedClient = ""
+	default:
+		if addr := getClientByID(l, args[0]); addr != "" {
+			selectedClient = addr
+			learnPrivileges(l, addr)
+			fmt.Printf("Using %s\n", clientLabel(l, addr))
+		}
+	}
+}
+
+// clientLabel names a client for messages and the prompt.
+func clientLabel(l server.ListenerInterface, addr string) string {
+	meta, _ := l.GetClientMetadata(addr)
+	label := l.GetClientIdentifier(addr)
+	if label == "" {
+		label = addr
+	}
+	if meta.Hostname != "" {
+		label += "@" + meta.Hostname
+	}
+	return label
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func newRefListener() *mockListener {
+	return &mockListener{
+		clients:     []string{"10.0.0.1:1000", "10.0.0.2:2000", "10.0.0.3:3000"},
+		identifiers: map[string]string{"10.0.0.1:1000": "a1b2c3d4", "10.0.0.2:2000": "e5f6a7b8", "10.0.0.3:3000": "12345678"},
+		metadata: map[string]server.ClientMetadata{
+			"10.0.0.1:1000": {Hostname: "web1", Tags: []string{"web", "prod"}},
+			"10.0.0.2:2000": {Hostname: "web2", Tags: []string{"web"}},
+			"10.0.0.3:3000": {Hostname: "db1", Tags: []string{"prod"}},
+		},
+	}
+}
+
+func TestResolveClientIDByReference(t *testing.T) {
+	ml := newRefListener()
+	tests := map[string]string{
+		"2":        "10.0.0.2:2000",
+		"a1b2c3d4": "10.0.0.1:1000",
+		"web2":     "10.0.0.2:2000",
+		"db1":      "10.0.0.3:3000",
+		"12345678": "10.0.0.3:3000", // Numeric identifier beyond the ls numbers
+	}
+	for ref, want := range tests {
+		got, err := resolveClientID(ml, ref)
+		if err != nil || got != want {
+			t.Errorf("resolveClientID(%q) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+
+	if _, err := resolveClientID(ml, "web"); err == nil || !strings.Contains(err.Error(), "#1, #2") {
+		t.Errorf("expected ambiguous tag to list matches, got %v", err)
+	}
+	if _, err := resolveClientID(ml, "mail"); err == nil {
+		t.Error("expected unknown reference to fail")
+	}
+	if _, err := resolveClientID(ml, "9"); err == nil {
+		t.Error("expected out of range number to fail")
+	}
+}
+
+func TestClientRefCompletions(t *testing.T) {
+	ml := newRefListener()
+	if got, want := clientRefCompletions(ml, "web"), []string{"web", "web1", "web2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("completions for web = %v, want %v", got, want)
+	}
+	if got, want := clientRefCompletions(ml, "1"), []string{"1", "12345678"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("completions for 1 = %v, want %v", got, want)
+	}
+
+	c := &shellCompleter{listener: ml}
+	suggestions, length := c.Do([]rune("use we"), 6)
+	if length != 2 || len(suggestions) != 3 || string(suggestions[1]) != "b1" {
+		t.Errorf("unexpected completion of 'use we': %q (length %d)", suggestions, length)
+	}
+}
+
+func TestHandleUse(t *testing.T) {
+	ml := newRefListener()
+	defer func() { selectedClient = "" }()
+
+	handleUse(ml, []string{"web2"})
+	if currentClient(ml) != "10.0.0.2:2000" {
+		t.Fatalf("expected web2 to be selected, got %q", selectedClient)
+	}
+	if got := replPrompt(ml); got != "gotsl(e5f6a7b8 web2)> " {
+		t.Errorf("unexpected prompt %q", got)
+	}
+
+	// A disconnected client is no longer current
+	ml.clients = ml.clients[:1]
+	if currentClient(ml) != "" || replPrompt(ml) != "gotsl> " {
+		t.Error("expected no current client after it disconnected")
+	}
+
+	handleUse(ml, []string{"1"})
+	handleUse(ml, []string{"none"})
+	if currentClient(ml) != "" {
+		t.Error("expected 'use none' to clear the selection")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const cmdtplUsage = "Usage: cmdtpl [<name> = <command> | <name> <client_id> [param=value ...]]"
+
+// commandTemplater is implemented by *server.Listener.
+type commandTemplater interface {
+	CommandTemplate(clientAddr, name string) (string, bool)
+	DefineCommandTemplate(name, tpl string)
+	CommandTemplateNames() []string
+	RenderCommand(clientAddr, name string, params map[string]string) (string, error)
+}
+
+// templateName matches names accepted for new templates.
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// promptParam asks the operator for a missing template parameter. Tests
+// replace it.
+var promptParam = func(name string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("missing parameter %s; pass %s=<value>", name, name)
+	}
+	fmt.Printf("%s: ", name)
+	buf := make([]byte, 4096)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf[:n]), "\r\n"), nil
+}
+
+// handleCmdtpl lists, defines or runs command templates. Running one asks
+// for the parameters not given as name=value and quotes them for the
+// client's shell.
+func handleCmdtpl(l server.ListenerInterface, args []string) {
+	ct, ok := l.(commandTemplater)
+	if !ok {
+		fmt.Println("Error: listener does not support command templates")
+		return
+	}
+	switch {
+	case len(args) == 0:
+		listCommandTemplates(ct)
+	case len(args) >= 3 && args[1] == "=":
+		if !templateName.MatchString(args[0]) {
+			fmt.Println("Error: template names may only contain letters, digits, - and _")
+			return
+		}
+		tpl := strings.Join(args[2:], " ")
+		ct.DefineCommandTemplate(args[0], tpl)
+		fmt.Printf("Defined %s for this session: %s\n", args[0], tpl)
+	case len(args) >= 2:
+		runCommandTemplate(l, ct, args[0], args[1], args[2:])
+	default:
+		fmt.Println(cmdtplUsage)
+	}
+}
+
+// listCommandTemplates prints the default template of every name.
+func listCommandTemplates(ct commandTemplater) {
+	fmt.Println("Command templates (OS-specific versions may differ):")
+	for _, name := range ct.CommandTemplateNames() {
+		tpl, ok := ct.CommandTemplate("", name)
+		if !ok {
+			tpl = "(OS-specific only)"
+		}
+		fmt.Printf("  %-12s %s\n", name, tpl)
+	}
+}
+
+// runCommandTemplate renders a template for a client and runs it.
+func runCommandTemplate(l server.ListenerInterface, ct commandTemplater, name, clientID string, args []string) {
+	clientAddr := getClientByID(l, clientID)
+	if clientAddr == "" {
+		return
+	}
+	tpl, ok := ct.CommandTemplate(clientAddr, name)
+	if !ok {
+		fmt.Printf("Error: no command template %q; see 'cmdtpl'\n", name)
+		return
+	}
+	params := make(map[string]string)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fmt.Printf("Error: expected param=value, got %q\n", arg)
+			return
+		}
+		params[key] = value
+	}
+	for _, param := range server.TemplateParams(tpl) {
+		if _, ok := params[param]; ok {
+			continue
+		}
+		value, err := promptParam(param)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		params[param] = value
+	}
+	for key, value := range params {
+		if err := checkParamValue(value); err != nil {
+			fmt.Printf("Error: parameter %s %v\n", key, err)
+			return
+		}
+	}
+
+	cmd, err := ct.RenderCommand(clientAddr, name, params)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Running on %s: %s\n", clientLabel(l, clientAddr), cmd)
+	out, err := runRemoteCommand(l, clientAddr, cmd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Print(out)
+}
+
+// checkParamValue rejects values that cannot be passed safely: empty ones
+// and ones with control characters, which would end or corrupt the command
+// frame. Shell metacharacters are fine, since values are quoted.
+func checkParamValue(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("must not be empty")
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return errors.New("must not contain control characters")
+	}
+	return nil
+}
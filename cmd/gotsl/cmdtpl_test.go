@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// templateListener adds command templates to a mockListener.
+type templateListener struct {
+	*mockListener
+	templates map[string]string
+}
+
+func (t *templateListener) CommandTemplate(_, name string) (string, bool) {
+	tpl, ok := t.templates[name]
+	return tpl, ok
+}
+
+func (t *templateListener) DefineCommandTemplate(name, tpl string) { t.templates[name] = tpl }
+
+func (t *templateListener) CommandTemplateNames() []string {
+	var names []string
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *templateListener) RenderCommand(_, name string, params map[string]string) (string, error) {
+	tpl := t.templates[name]
+	for key, value := range params {
+		tpl = strings.ReplaceAll(tpl, "{"+key+"}", "'"+value+"'")
+	}
+	return tpl, nil
+}
+
+func TestHandleCmdtpl(t *testing.T) {
+	l := &templateListener{mockListener: newRefListener(), templates: map[string]string{"whoami": "id"}}
+	l.responses = []string{"done\n<<<END_OF_OUTPUT>>>\n"}
+
+	out := captureStdout(t, func() { handleCmdtpl(l, strings.Fields("dumpdb = pg_dump -U {user} {db}")) })
+	if l.templates["dumpdb"] != "pg_dump -U {user} {db}" || !strings.Contains(out, "Defined dumpdb") {
+		t.Fatalf("template not defined: %q, %q", l.templates, out)
+	}
+
+	orig := promptParam
+	defer func() { promptParam = orig }()
+	var asked []string
+	promptParam = func(name string) (string, error) {
+		asked = append(asked, name)
+		return "app db", nil
+	}
+	out = captureStdout(t, func() { handleCmdtpl(l, []string{"dumpdb", "1", "user=postgres"}) })
+	if len(asked) != 1 || asked[0] != "db" {
+		t.Errorf("expected to be asked for db only, asked for %q", asked)
+	}
+	if len(l.sentCommands) != 1 || l.sentCommands[0] != "pg_dump -U 'postgres' 'app db'" {
+		t.Errorf("unexpected commands %q", l.sentCommands)
+	}
+	if !strings.Contains(out, "done") {
+		t.Errorf("expected the command output, got %q", out)
+	}
+
+	out = captureStdout(t, func() { handleCmdtpl(l, []string{"dumpdb", "1", "user=", "db=x"}) })
+	if len(l.sentCommands) != 1 || !strings.Contains(out, "user must not be empty") {
+		t.Errorf("expected an empty parameter to be refused, got %q", out)
+	}
+	out = captureStdout(t, func() { handleCmdtpl(l, nil) })
+	if !strings.Contains(out, "dumpdb") || !strings.Contains(out, "whoami") {
+		t.Errorf("expected both templates to be listed, got %q", out)
+	}
+}
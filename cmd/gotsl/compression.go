@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// poorRatio is the compressed-to-raw ratio above which compression gains
+// too little to be worth its time, as with archives or images.
+const poorRatio = 0.9
+
+// compressionRecorder is implemented by listeners that keep compression
+// statistics per client.
+type compressionRecorder interface {
+	RecordCompression(clientAddr string, sent bool, s server.CompressionStats)
+	CompressionStats() map[string]server.SessionCompression
+	ResetCompressionStats()
+}
+
+// compressFor compresses data to send to a client, recording it in the
+// client's statistics. Data that is compressed already is mostly sent as is.
+func compressFor(l server.ListenerInterface, clientAddr string, data []byte) (string, error) {
+	return encodeFor(l, clientAddr, compression.CodecGzip, data)
+}
+
+// encodeFor is compressFor with the given transfer codec.
+func encodeFor(l server.ListenerInterface, clientAddr, codec string, data []byte) (string, error) {
+	start := time.Now()
+	encoded, stored, err := compression.EncodeTransfer(codec, data)
+	if stored {
+		logging.Debugf("Data for %s barely compresses; sending all but the first %d bytes uncompressed", clientAddr, compression.SampleSize)
+	}
+	if rec, ok := l.(compressionRecorder); ok && err == nil {
+		rec.RecordCompression(clientAddr, true, server.CompressionStats{
+			Payloads: 1, Raw: int64(len(data)), Compressed: compression.CompressedLen(codec, int64(len(encoded))), Elapsed: time.Since(start),
+		})
+	}
+	return encoded, err
+}
+
+// decompressFrom decompresses a payload received from a client, recording
+// it in the client's statistics.
+func decompressFrom(l server.ListenerInterface, clientAddr, payload string) ([]byte, error) {
+	return decodeFrom(l, clientAddr, compression.CodecGzip, payload)
+}
+
+// decodeFrom is decompressFrom with the given transfer codec.
+func decodeFrom(l server.ListenerInterface, clientAddr, codec, payload string) ([]byte, error) {
+	start := time.Now()
+	data, err := compression.Decode(codec, payload)
+	if rec, ok := l.(compressionRecorder); ok && err == nil {
+		rec.RecordCompression(clientAddr, false, server.CompressionStats{
+			Payloads: 1, Raw: int64(len(data)), Compressed: compression.CompressedLen(codec, int64(len(payload))), Elapsed: time.Since(start),
+		})
+	}
+	return data, err
+}
+
+// handleDebugCompression prints the compression statistics of each session,
+// or clears them.
+func handleDebugCompression(l server.ListenerInterface, args []string) {
+	rec, ok := l.(compressionRecorder)
+	if !ok {
+		fmt.Println("Error: this listener does not keep compression statistics")
+		return
+	}
+	if len(args) == 1 && args[0] == "reset" {
+		rec.ResetCompressionStats()
+		fmt.Println("✓ Compression statistics cleared")
+		return
+	}
+	if len(args) != 0 {
+		fmt.Println("Usage: debug compression [reset]")
+		return
+	}
+
+	stats := rec.CompressionStats()
+	if len(stats) == 0 {
+		fmt.Println("No compressed traffic yet")
+		return
+	}
+	addrs := make([]string, 0, len(stats))
+	for addr := range stats {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var total server.SessionCompression
+	fmt.Printf("\n%-28s %-8s %8s %12s %12s %6s %10s\n", "SESSION", "DIR", "PAYLOADS", "RAW", "COMPRESSED", "RATIO", "TIME")
+	for _, addr := range addrs {
+		s := stats[addr]
+		printCompressionRow(clientLabel(l, addr), "sent", s.Sent)
+		printCompressionRow("", "received", s.Received)
+		addCompressionStats(&total.Sent, s.Sent)
+		addCompressionStats(&total.Received, s.Received)
+	}
+	if len(addrs) > 1 {
+		printCompressionRow("total", "sent", total.Sent)
+		printCompressionRow("", "received", total.Received)
+	}
+	fmt.Println()
+	for _, s := range []server.CompressionStats{total.Sent, total.Received} {
+		if s.Raw >= 1<<20 && s.Ratio() > poorRatio {
+			fmt.Println("Note: some traffic barely compresses; it is likely already compressed (archives, images)")
+			break
+		}
+	}
+}
+
+func printCompressionRow(session, dir string, s server.CompressionStats) {
+	ratio := "-"
+	if s.Raw > 0 {
+		ratio = fmt.Sprintf("%.2f", s.Ratio())
+	}
+	fmt.Printf("%-28s %-8s %8d %12s %12s %6s %10s\n", session, dir, s.Payloads, formatBytes(strconv.FormatInt(s.Raw, 10)), formatBytes(strconv.FormatInt(s.Compressed, 10)), ratio, s.Elapsed.Round(time.Microsecond))
+}
+
+func addCompressionStats(total *server.CompressionStats, s server.CompressionStats) {
+	total.Payloads += s.Payloads
+	total.Raw += s.Raw
+	total.Compressed += s.Compressed
+	total.Elapsed += s.Elapsed
+}
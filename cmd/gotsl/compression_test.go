@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// recordingListener keeps compression statistics like server.Listener.
+type recordingListener struct {
+	*mockListener
+	stats map[string]server.SessionCompression
+}
+
+func (r *recordingListener) RecordCompression(clientAddr string, sent bool, s server.CompressionStats) {
+	session := r.stats[clientAddr]
+	if sent {
+		addCompressionStats(&session.Sent, s)
+	} else {
+		addCompressionStats(&session.Received, s)
+	}
+	r.stats[clientAddr] = session
+}
+
+func (r *recordingListener) CompressionStats() map[string]server.SessionCompression { return r.stats }
+func (r *recordingListener) ResetCompressionStats()                                 { r.stats = nil }
+
+func TestDebugCompression(t *testing.T) {
+	l := &recordingListener{mockListener: newRefListener(), stats: make(map[string]server.SessionCompression)}
+	data := bytes.Repeat([]byte("compressible "), 1000)
+	encoded, err := compressFor(l, "10.0.0.1:1000", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompressFrom(l, "10.0.0.1:1000", encoded); err != nil {
+		t.Fatal(err)
+	}
+	s := l.stats["10.0.0.1:1000"]
+	if s.Sent.Payloads != 1 || s.Sent.Raw != int64(len(data)) || s.Sent.Compressed != int64(len(encoded)/2) || s.Received.Raw != s.Sent.Raw {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	out := captureStdout(t, func() { dispatchCommand(l, []string{"debug", "compression"}) })
+	if !strings.Contains(out, "web1") || !strings.Contains(out, "received") || !strings.Contains(out, "12.7 KiB") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	out = captureStdout(t, func() { handleDebugCompression(l, []string{"reset"}) })
+	if !strings.Contains(out, "cleared") || len(l.CompressionStats()) != 0 {
+		t.Errorf("expected stats to be cleared, got %q", out)
+	}
+	out = captureStdout(t, func() { handleDebugCompression(l, nil) })
+	if !strings.Contains(out, "No compressed traffic yet") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
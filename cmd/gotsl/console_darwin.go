@@ -0,0 +1,32 @@
+//go:build darwin
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readConsole reads operator input, returning os.ErrDeadlineExceeded when
+// nothing arrives within timeout so callers can check whether to stop.
+//
+// kqueue does not report readiness for terminals on macOS, so the runtime
+// poller cannot honour read deadlines on a tty stdin and a plain Read would
+// block until the next key press. select(2) does work on ttys, so wait with
+// it and only read once input is pending.
+func readConsole(buf []byte, timeout time.Duration) (int, error) {
+	fd := int(os.Stdin.Fd())
+	var set unix.FdSet
+	set.Set(fd)
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	n, err := unix.Select(fd+1, &set, nil, nil, &tv)
+	if err == unix.EINTR || (err == nil && n == 0) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return 0, err
+	}
+	return os.Stdin.Read(buf)
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// readConsole reads operator input, returning os.ErrDeadlineExceeded when
+// nothing arrives within timeout so callers can check whether to stop.
+func readConsole(buf []byte, timeout time.Duration) (int, error) {
+	os.Stdin.SetReadDeadline(time.Now().Add(timeout))
+	return os.Stdin.Read(buf)
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// makeRawConsole puts the operator's terminal into raw mode for a PTY shell
+// and returns a function that restores it. x/term picks the right termios
+// ioctls per platform (TCGETS on Linux, TIOCGETA on macOS and the BSDs).
+func makeRawConsole() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() { term.Restore(fd, oldState) }, nil
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConsoleTimeout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+
+	buf := make([]byte, 16)
+	if _, err := readConsole(buf, 20*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	w.Write([]byte("ls\r"))
+	n, err := readConsole(buf, time.Second)
+	if err != nil || string(buf[:n]) != "ls\r" {
+		t.Errorf("readConsole = %q, %v", buf[:n], err)
+	}
+}
+
+func TestConfirmPaste(t *testing.T) {
+	defer func(n int) { pasteConfirmSize = n }(pasteConfirmSize)
+	pasteConfirmSize = 4
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+
+	for _, tc := range []struct {
+		key  string
+		want bool
+	}{{"y", true}, {"n", false}, {"\r", false}} {
+		w.Write([]byte(tc.key))
+		var ok bool
+		out := captureStdout(t, func() { ok = confirmPaste([]byte("a\r\nb\r\nc\r\n"), nil) })
+		if ok != tc.want {
+			t.Errorf("answer %q: confirmPaste = %v", tc.key, ok)
+		}
+		if !strings.Contains(out, "Send paste of 3 lines (9 bytes)?") {
+			t.Errorf("unexpected prompt %q", out)
+		}
+	}
+}
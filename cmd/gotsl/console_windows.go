@@ -0,0 +1,65 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// makeRawConsole switches the Windows console to raw virtual terminal mode:
+// keys arrive as VT sequences without echo or line editing, Ctrl-C is passed
+// through as input, and output escape sequences from the remote PTY are
+// interpreted. It returns a function that restores both modes.
+func makeRawConsole() (func(), error) {
+	in := windows.Handle(os.Stdin.Fd())
+	out := windows.Handle(os.Stdout.Fd())
+
+	var inMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, fmt.Errorf("stdin is not a console: %w", err)
+	}
+	raw := inMode&^(windows.ENABLE_ECHO_INPUT|windows.ENABLE_LINE_INPUT|windows.ENABLE_PROCESSED_INPUT) |
+		windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(in, raw); err != nil {
+		return nil, fmt.Errorf("cannot enable virtual terminal input: %w", err)
+	}
+
+	restoreOut := func() {}
+	var outMode uint32
+	if err := windows.GetConsoleMode(out, &outMode); err == nil {
+		// The remote PTY sends CRLF, so LF must not return the cursor too
+		vt := outMode | windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING | windows.DISABLE_NEWLINE_AUTO_RETURN
+		if err := windows.SetConsoleMode(out, vt); err != nil {
+			windows.SetConsoleMode(in, inMode)
+			return nil, fmt.Errorf("console does not support virtual terminal sequences (Windows 10 or later is needed): %w", err)
+		}
+		restoreOut = func() { windows.SetConsoleMode(out, outMode) }
+	}
+
+	return func() {
+		windows.SetConsoleMode(in, inMode)
+		restoreOut()
+	}, nil
+}
+
+// readConsole reads operator input, returning os.ErrDeadlineExceeded when
+// nothing arrives within timeout. Console handles do not support read
+// deadlines, so it waits for the handle to be signalled first.
+func readConsole(buf []byte, timeout time.Duration) (int, error) {
+	in := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(in, &mode) == nil {
+		event, err := windows.WaitForSingleObject(in, uint32(timeout.Milliseconds()))
+		if err != nil {
+			return 0, err
+		}
+		if event == uint32(windows.WAIT_TIMEOUT) {
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	return os.Stdin.Read(buf)
+}
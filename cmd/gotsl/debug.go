@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// Leak checks flag a subsystem whose goroutine count grew on this many
+// consecutive samples.
+const leakGrowthSamples = 3
+
+// debugState holds the diagnostics started from the REPL.
+type debugState struct {
+	mu        sync.Mutex
+	pprofLn   net.Listener
+	leakStop  chan struct{}
+	leakCheck *leakDetector
+}
+
+var debugger = &debugState{}
+
+func handleDebug(l server.ListenerInterface, args []string) {
+	usage := func() {
+		fmt.Println("Usage: debug goroutines | debug compression [reset] | debug pprof on [addr] | debug pprof off | debug leakcheck on [interval] | debug leakcheck off")
+	}
+	if len(args) == 0 {
+		usage()
+		return
+	}
+	switch args[0] {
+	case "goroutines":
+		printGoroutines()
+	case "compression":
+		handleDebugCompression(l, args[1:])
+	case "pprof":
+		if len(args) < 2 {
+			usage()
+			return
+		}
+		switch args[1] {
+		case "on":
+			addr := "127.0.0.1:6060"
+			if len(args) > 2 {
+				addr = args[2]
+			}
+			if err := debugger.startPprof(addr); err != nil {
+				fmt.Printf("Failed to start pprof: %v\n", err)
+			}
+		case "off":
+			debugger.stopPprof()
+		default:
+			usage()
+		}
+	case "leakcheck":
+		if len(args) < 2 {
+			usage()
+			return
+		}
+		switch args[1] {
+		case "on":
+			interval := time.Minute
+			if len(args) > 2 {
+				d, err := time.ParseDuration(args[2])
+				if err != nil || d <= 0 {
+					fmt.Println("Error: interval must be a positive duration (e.g. 30s)")
+					return
+				}
+				interval = d
+			}
+			debugger.startLeakCheck(interval)
+		case "off":
+			debugger.stopLeakCheck()
+		default:
+			usage()
+		}
+	default:
+		usage()
+	}
+}
+
+func printGoroutines() {
+	counts := goroutineCounts()
+	total := 0
+	names := make([]string, 0, len(counts))
+	for name, n := range counts {
+		names = append(names, name)
+		total += n
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Printf("\nGoroutines: %d\n", total)
+	for _, name := range names {
+		fmt.Printf("  %5d  %s\n", counts[name], name)
+	}
+	fmt.Println()
+}
+
+// startPprof serves the net/http/pprof handlers on addr.
+func (d *debugState) startPprof(addr string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pprofLn != nil {
+		return fmt.Errorf("already serving on %s", d.pprofLn.Addr())
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		fmt.Println("⚠️  WARNING: pprof is unauthenticated; prefer a loopback address")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("pprof server stopped: %v", err)
+		}
+	}()
+	d.pprofLn = ln
+	fmt.Printf("✓ pprof available at http://%s/debug/pprof/\n", ln.Addr())
+	return nil
+}
+
+func (d *debugState) stopPprof() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pprofLn == nil {
+		fmt.Println("pprof is not running")
+		return
+	}
+	_ = d.pprofLn.Close()
+	d.pprofLn = nil
+	fmt.Println("✓ pprof stopped")
+}
+
+// startLeakCheck samples goroutine counts every interval and logs subsystems
+// that keep growing.
+func (d *debugState) startLeakCheck(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.leakStop != nil {
+		close(d.leakStop)
+	}
+	stop := make(chan struct{})
+	d.leakStop = stop
+	d.leakCheck = newLeakDetector(leakGrowthSamples)
+	detector := d.leakCheck
+	detector.sample(goroutineCounts())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, warning := range detector.sample(goroutineCounts()) {
+					log.Printf("⚠️  Possible goroutine leak: %s", warning)
+				}
+			}
+		}
+	}()
+	fmt.Printf("✓ Goroutine leak check every %v\n", interval)
+}
+
+func (d *debugState) stopLeakCheck() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.leakStop == nil {
+		fmt.Println("Leak check is not running")
+		return
+	}
+	close(d.leakStop)
+	d.leakStop = nil
+	d.leakCheck = nil
+	fmt.Println("✓ Leak check stopped")
+}
+
+// goroutineCounts groups live goroutines by the function that started them,
+// which maps well onto subsystems (PTY relays, forwards, SOCKS, clients).
+func goroutineCounts() map[string]int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return parseGoroutineCounts(string(buf[:n]))
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// parseGoroutineCounts parses a runtime.Stack(all=true) dump.
+func parseGoroutineCounts(dump string) map[string]int {
+	counts := make(map[string]int)
+	for _, g := range strings.Split(dump, "\n\n") {
+		if strings.TrimSpace(g) == "" {
+			continue
+		}
+		counts[goroutineOrigin(g)]++
+	}
+	return counts
+}
+
+func goroutineOrigin(stack string) string {
+	lines := strings.Split(stack, "\n")
+	for _, line := range lines {
+		if creator, ok := strings.CutPrefix(line, "created by "); ok {
+			// Drop the " in goroutine N" suffix
+			if i := strings.Index(creator, " in goroutine"); i >= 0 {
+				creator = creator[:i]
+			}
+			return trimModulePath(creator)
+		}
+	}
+	// No creator: the main goroutine or a runtime-started one; use its
+	// outermost frame.
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		if j := strings.LastIndex(line, "("); j > 0 && strings.HasSuffix(line, ")") {
+			line = line[:j]
+		}
+		return trimModulePath(line)
+	}
+	return "unknown"
+}
+
+// trimModulePath shortens "github.com/frjcomp/gots/pkg/server.(*Listener).x"
+// to "server.(*Listener).x".
+func trimModulePath(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
+}
+
+// leakDetector tracks per-subsystem goroutine counts across samples.
+type leakDetector struct {
+	threshold int
+	last      map[string]int
+	growth    map[string]int
+}
+
+func newLeakDetector(threshold int) *leakDetector {
+	return &leakDetector{threshold: threshold, growth: make(map[string]int)}
+}
+
+// sample records counts and returns a warning for every subsystem that grew
+// on threshold consecutive samples.
+func (d *leakDetector) sample(counts map[string]int) []string {
+	var warnings []string
+	if d.last != nil {
+		for name, n := range counts {
+			if n > d.last[name] {
+				d.growth[name]++
+			} else {
+				d.growth[name] = 0
+			}
+			if d.growth[name] >= d.threshold {
+				warnings = append(warnings, fmt.Sprintf("%s grew to %d goroutines over %d samples", name, n, d.growth[name]))
+			}
+		}
+		for name := range d.growth {
+			if _, ok := counts[name]; !ok {
+				delete(d.growth, name)
+			}
+		}
+	}
+	d.last = counts
+	sort.Strings(warnings)
+	return warnings
+}
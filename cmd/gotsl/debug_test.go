@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleStack = `goroutine 1 [running]:
+main.main()
+	/src/cmd/gotsl/main.go:10 +0x1
+
+goroutine 7 [IO wait]:
+internal/poll.runtime_pollWait(0x0, 0x72)
+	/go/src/runtime/netpoll.go:351 +0x85
+github.com/frjcomp/gots/pkg/server.(*Listener).handleClient(0xc000)
+	/src/pkg/server/listener.go:200 +0x1
+created by github.com/frjcomp/gots/pkg/server.(*Listener).acceptConnections in goroutine 6
+	/src/pkg/server/listener.go:110 +0x1
+
+goroutine 8 [IO wait]:
+github.com/frjcomp/gots/pkg/server.(*Listener).handleClient(0xc000)
+	/src/pkg/server/listener.go:200 +0x1
+created by github.com/frjcomp/gots/pkg/server.(*Listener).acceptConnections in goroutine 6
+	/src/pkg/server/listener.go:110 +0x1
+`
+
+func TestParseGoroutineCounts(t *testing.T) {
+	counts := parseGoroutineCounts(sampleStack)
+	if counts["server.(*Listener).acceptConnections"] != 2 {
+		t.Errorf("expected 2 goroutines from acceptConnections, got %v", counts)
+	}
+	if counts["main.main"] != 1 {
+		t.Errorf("expected main goroutine, got %v", counts)
+	}
+}
+
+func TestGoroutineCountsLive(t *testing.T) {
+	counts := goroutineCounts()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		t.Fatal("expected at least one goroutine")
+	}
+}
+
+func TestLeakDetector(t *testing.T) {
+	d := newLeakDetector(3)
+	for i, n := range []int{1, 2, 3, 4} {
+		warnings := d.sample(map[string]int{"relay": n, "steady": 5})
+		if i < 3 && len(warnings) != 0 {
+			t.Fatalf("sample %d: unexpected warnings %v", i, warnings)
+		}
+		if i == 3 && (len(warnings) != 1 || !strings.HasPrefix(warnings[0], "relay")) {
+			t.Fatalf("expected relay leak warning, got %v", warnings)
+		}
+	}
+
+	// A drop resets the growth streak
+	if warnings := d.sample(map[string]int{"relay": 2, "steady": 5}); len(warnings) != 0 {
+		t.Errorf("expected no warnings after drop, got %v", warnings)
+	}
+}
+
+func TestDispatchCommandExit(t *testing.T) {
+	if dispatchCommand(&mockListener{}, []string{"exit"}) {
+		t.Error("expected exit to stop the shell")
+	}
+	if !dispatchCommand(&mockListener{}, []string{"debug"}) {
+		t.Error("expected debug to keep the shell running")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/delta"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// deltaMinSize is the smallest file uploaded as a delta; below it the
+// SIGNATURE round trip costs more than sending the whole file.
+const deltaMinSize = 64 << 10
+
+// uploadDelta asks the client for the block checksums of remotePath and
+// returns a delta that turns it into data, with the block size to announce
+// in START_UPLOAD. It returns nil when a full upload is the better choice:
+// the client lacks delta support, the remote file is missing, or too little
+// of it can be reused.
+func uploadDelta(l server.ListenerInterface, clientAddr, remotePath string, data []byte) ([]byte, int) {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	// Older clients announce no capabilities and would not understand SIGNATURE
+	if len(data) < deltaMinSize || meta.Capabilities == nil || !meta.Supports(protocol.CapDelta) {
+		return nil, 0
+	}
+	blockSize := delta.BlockSize(int64(len(data)))
+	if err := l.SendCommand(clientAddr, fmt.Sprintf("%s %d %s", protocol.CmdSignature, blockSize, remotePath)); err != nil {
+		return nil, 0
+	}
+	resp, err := l.GetResponse(clientAddr, 30*time.Second)
+	if err != nil {
+		return nil, 0
+	}
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), "\n")
+	if len(lines) != 2 || lines[0] != "OK" {
+		return nil, 0
+	}
+	wire, err := hex.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, 0
+	}
+	var sig delta.Signature
+	if err := sig.UnmarshalBinary(wire); err != nil || sig.BlockSize != blockSize {
+		return nil, 0
+	}
+	d, literal := delta.Diff(&sig, data)
+	if len(d) > len(data)*3/4 {
+		return nil, 0
+	}
+	fmt.Printf("Delta upload: %d of %d bytes changed, reusing the rest of %s\n", literal, len(data), remotePath)
+	return d, blockSize
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/delta"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func deltaListener(remote []byte, blockSize int) *mockListener {
+	ml := newRefListener()
+	meta := ml.metadata["10.0.0.1:1000"]
+	meta.Capabilities = []string{protocol.CapDelta}
+	ml.metadata["10.0.0.1:1000"] = meta
+	sig, _ := delta.NewSignature(bytes.NewReader(remote), blockSize)
+	wire, _ := sig.MarshalBinary()
+	ml.responses = []string{"OK\n" + hex.EncodeToString(wire) + "\n" + protocol.EndOfOutputMarker, "OK", "OK", "OK\n"}
+	return ml
+}
+
+func TestHandleUploadGlobalDelta(t *testing.T) {
+	remote := make([]byte, 200_000)
+	rand.New(rand.NewSource(1)).Read(remote)
+	local := append([]byte(nil), remote...)
+	copy(local[100_000:], "edited")
+	path := t.TempDir() + "/app.conf"
+	os.WriteFile(path, local, 0644)
+
+	blockSize := delta.BlockSize(int64(len(local)))
+	ml := deltaListener(remote, blockSize)
+	out := captureStdout(t, func() {
+		if !handleUploadGlobal(ml, "10.0.0.1:1000", path, "/etc/app.conf", protocol.OverwriteAlways, false) {
+			t.Error("expected upload to succeed")
+		}
+	})
+	if !strings.Contains(out, "Delta upload:") {
+		t.Errorf("expected a delta upload, got %q", out)
+	}
+	if ml.sentCommands[0] != "SIGNATURE 512 /etc/app.conf" {
+		t.Errorf("unexpected SIGNATURE frame %q", ml.sentCommands[0])
+	}
+	if fields := strings.Fields(ml.sentCommands[1]); len(fields) != 6 || fields[3] != "delta=512" {
+		t.Fatalf("unexpected START_UPLOAD frame %q", ml.sentCommands[1])
+	}
+
+	// The chunks patch the remote file into the local one
+	payload := strings.Fields(ml.sentCommands[2])[2]
+	d, err := compression.DecompressHex(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) > 2*blockSize+100 {
+		t.Errorf("expected only the edited block to be sent, delta is %d bytes", len(d))
+	}
+	var patched bytes.Buffer
+	if _, err := delta.Patch(bytes.NewReader(remote), int64(len(remote)), blockSize, bytes.NewReader(d), &patched); err != nil || !bytes.Equal(patched.Bytes(), local) {
+		t.Errorf("delta does not reproduce the local file: %v", err)
+	}
+}
+
+func TestHandleUploadGlobalDeltaFallsBack(t *testing.T) {
+	small := t.TempDir() + "/small.conf"
+	os.WriteFile(small, []byte("a=1\n"), 0644)
+	ml := deltaListener(nil, delta.MinBlockSize)
+	ml.responses = []string{"OK", "OK", "OK\n"}
+	captureStdout(t, func() {
+		handleUploadGlobal(ml, "10.0.0.1:1000", small, "/etc/small.conf", protocol.OverwriteAlways, false)
+	})
+	if strings.HasPrefix(ml.sentCommands[0], protocol.CmdSignature) {
+		t.Error("small files should not be sent as a delta")
+	}
+
+	// A missing remote file gets a full upload
+	big := t.TempDir() + "/big.bin"
+	os.WriteFile(big, make([]byte, deltaMinSize), 0644)
+	ml = deltaListener(nil, delta.MinBlockSize)
+	ml.responses = []string{"Error reading file: no such file\n" + protocol.EndOfOutputMarker, "OK", "OK", "OK\n"}
+	captureStdout(t, func() { handleUploadGlobal(ml, "10.0.0.1:1000", big, "/tmp/big.bin", protocol.OverwriteAlways, false) })
+	if len(ml.sentCommands) < 2 || strings.Contains(ml.sentCommands[1], "delta=") {
+		t.Errorf("expected a full upload after the failed SIGNATURE, sent %q", ml.sentCommands)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	diffContext = 3 // Unchanged lines shown around each change
+	// maxDiffCells bounds the line-by-line comparison table, so diffing two
+	// large files cannot exhaust memory.
+	maxDiffCells = 1 << 22
+)
+
+// overwriteAnswer asks the operator whether to replace a local file. It
+// returns 'o' without asking when stdin is not a terminal, so scripted
+// sessions keep overwriting as before. Tests replace it.
+var overwriteAnswer = func(prompt string) byte {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return 'o'
+	}
+	fmt.Print(prompt)
+	buf := make([]byte, 64)
+	n, err := os.Stdin.Read(buf)
+	if err != nil || n == 0 {
+		return 'k'
+	}
+	answer := strings.ToLower(strings.TrimSpace(string(buf[:n])))
+	if answer == "" {
+		return 'k'
+	}
+	return answer[0]
+}
+
+// confirmOverwrite asks before a download replaces a local text file whose
+// content differs, offering a unified diff of the two first. Binary files
+// and unchanged content are replaced without asking.
+func confirmOverwrite(localPath string, data []byte) bool {
+	old, err := os.ReadFile(localPath)
+	if err != nil || bytes.Equal(old, data) || !isText(old) || !isText(data) {
+		return true
+	}
+	for {
+		switch overwriteAnswer(fmt.Sprintf("%s exists and differs from the download. [o]verwrite, [d]iff, [k]eep? ", localPath)) {
+		case 'o':
+			return true
+		case 'd':
+			color := term.IsTerminal(int(os.Stdout.Fd()))
+			fmt.Print(unifiedDiff(localPath, "downloaded", old, data, color))
+		default:
+			return false
+		}
+	}
+}
+
+// diffOp is one line of a diff: ' ' kept, '-' only in a, '+' only in b.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines compares two texts line by line using their longest common
+// subsequence. ok is false when the texts are too large to compare.
+func diffLines(a, b []string) (ops []diffOp, ok bool) {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return nil, false
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops, true
+}
+
+// splitLines splits text into lines without their line endings.
+func splitLines(text []byte) []string {
+	s := strings.TrimSuffix(strings.ReplaceAll(string(text), "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// unifiedDiff renders the changes from a to b as a unified diff with
+// diffContext lines of context, optionally colored for a terminal.
+func unifiedDiff(nameA, nameB string, a, b []byte, color bool) string {
+	ops, ok := diffLines(splitLines(a), splitLines(b))
+	if !ok {
+		return "Files are too large to diff\n"
+	}
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return "\033[" + code + "m" + s + "\033[0m"
+	}
+
+	var out strings.Builder
+	out.WriteString(paint("1", "--- "+nameA) + "\n")
+	out.WriteString(paint("1", "+++ "+nameB) + "\n")
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk: changes less than
+		// two contexts apart share a hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			} else if k-last > 2*diffContext {
+				break
+			}
+		}
+		from, to := max(first-diffContext, start), min(last+diffContext+1, len(ops))
+
+		lineA, lineB := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				lineA++
+			}
+			if op.kind != '-' {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		// An empty range starts at the line before it
+		if countA == 0 {
+			lineA--
+		}
+		if countB == 0 {
+			lineB--
+		}
+		out.WriteString(paint("36", fmt.Sprintf("@@ -%d,%d +%d,%d @@", lineA, countA, lineB, countB)) + "\n")
+		for _, op := range ops[from:to] {
+			line := string(op.kind) + op.line
+			switch op.kind {
+			case '-':
+				line = paint("31", line)
+			case '+':
+				line = paint("32", line)
+			}
+			out.WriteString(line + "\n")
+		}
+		start = to
+	}
+	return out.String()
+}
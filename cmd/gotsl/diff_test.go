@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	cur := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	got := unifiedDiff("old", "new", []byte(old), []byte(cur), false)
+	want := "--- old\n+++ new\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -9,3 +9,4 @@\n i\n j\n k\n+l\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got = unifiedDiff("old", "new", nil, []byte("x\n"), false)
+	if !strings.Contains(got, "@@ -0,0 +1,1 @@\n+x\n") {
+		t.Errorf("unexpected diff against an empty file:\n%s", got)
+	}
+	if got := unifiedDiff("old", "new", []byte("x\r\n"), []byte("x\n"), false); got != "--- old\n+++ new\n" {
+		t.Errorf("expected line endings to be ignored, got\n%s", got)
+	}
+}
+
+func TestHandleDownloadGlobalAsksBeforeOverwriting(t *testing.T) {
+	local := t.TempDir() + "/app.conf"
+	os.WriteFile(local, []byte("port=80\n"), 0644)
+	compressed, _ := compression.CompressToHex([]byte("port=8080\n"))
+
+	orig := overwriteAnswer
+	defer func() { overwriteAnswer = orig }()
+	var answers []byte
+	overwriteAnswer = func(string) byte {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer
+	}
+
+	answers = []byte{'d', 'k'}
+	ml := newRefListener()
+	ml.responses = []string{protocol.DataPrefix + compressed + protocol.EndOfOutputMarker}
+	out := captureStdout(t, func() { handleDownloadGlobal(ml, "10.0.0.1:1000", "/etc/app.conf", local, 0, false, true) })
+	if !strings.Contains(out, "-port=80\n+port=8080\n") || !strings.Contains(out, "Kept "+local) {
+		t.Errorf("expected a diff and the local file to be kept, got %q", out)
+	}
+	if got, _ := os.ReadFile(local); string(got) != "port=80\n" {
+		t.Errorf("local file changed to %q", got)
+	}
+
+	answers = []byte{'o'}
+	ml.responses = append(ml.responses, protocol.DataPrefix+compressed+protocol.EndOfOutputMarker)
+	captureStdout(t, func() { handleDownloadGlobal(ml, "10.0.0.1:1000", "/etc/app.conf", local, 0, false, true) })
+	if got, _ := os.ReadFile(local); string(got) != "port=8080\n" {
+		t.Errorf("local file not overwritten: %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const killUsage = "Usage: kill <client_id> | kill --duplicates"
+
+// duplicateTracker is implemented by *server.Listener.
+type duplicateTracker interface {
+	DuplicateSessions() map[string][]string
+	Terminate(clientAddr string) error
+}
+
+// duplicateGroup is one host with several live sessions, as ls numbers them.
+type duplicateGroup struct {
+	machineID string
+	hostname  string
+	numbers   []int    // ls numbers, oldest session first
+	addrs     []string // Matching addresses
+}
+
+// duplicateGroups maps the listener's duplicate sessions onto the ls
+// numbering of clients.
+func duplicateGroups(l server.ListenerInterface, clients []string) []duplicateGroup {
+	tracker, ok := l.(duplicateTracker)
+	if !ok {
+		return nil
+	}
+	index := make(map[string]int, len(clients))
+	for i, addr := range clients {
+		index[addr] = i + 1
+	}
+	var groups []duplicateGroup
+	for id, addrs := range tracker.DuplicateSessions() {
+		g := duplicateGroup{machineID: id}
+		for _, addr := range addrs {
+			n, ok := index[addr]
+			if !ok {
+				continue
+			}
+			g.numbers = append(g.numbers, n)
+			g.addrs = append(g.addrs, addr)
+		}
+		if len(g.numbers) < 2 {
+			continue
+		}
+		meta, _ := l.GetClientMetadata(g.addrs[0])
+		g.hostname = meta.Hostname
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].numbers[0] < groups[j].numbers[0] })
+	return groups
+}
+
+// duplicateNotes returns the ls annotation for each newer duplicate session.
+func duplicateNotes(groups []duplicateGroup) map[string]string {
+	notes := make(map[string]string)
+	for _, g := range groups {
+		for _, addr := range g.addrs[1:] {
+			notes[addr] = fmt.Sprintf(" ⚠ duplicate of #%d", g.numbers[0])
+		}
+	}
+	return notes
+}
+
+func printDuplicateGroups(groups []duplicateGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Println("Duplicate sessions (same machine ID):")
+	for _, g := range groups {
+		nums := make([]string, len(g.numbers))
+		for i, n := range g.numbers {
+			nums[i] = fmt.Sprintf("#%d", n)
+		}
+		host := g.hostname
+		if host == "" {
+			host = "unknown host"
+		}
+		fmt.Printf("  %s (mid=%s): %s\n", host, g.machineID, strings.Join(nums, ", "))
+	}
+	fmt.Println("Use 'kill <id>' to stop one, or 'kill --duplicates' to keep only the oldest per host.")
+	fmt.Println()
+}
+
+// handleKill terminates a client so it does not reconnect. With --duplicates
+// it terminates every session but the oldest of each duplicated host.
+func handleKill(l server.ListenerInterface, args []string) {
+	if len(args) != 1 {
+		fmt.Println(killUsage)
+		return
+	}
+	tracker, ok := l.(duplicateTracker)
+	if !ok {
+		fmt.Println("Error: listener does not support terminating clients")
+		return
+	}
+
+	var targets []string
+	if args[0] == "--duplicates" {
+		for _, g := range duplicateGroups(l, l.GetClients()) {
+			targets = append(targets, g.addrs[1:]...)
+		}
+		if len(targets) == 0 {
+			fmt.Println("No duplicate sessions")
+			return
+		}
+	} else {
+		clientAddr := getClientByID(l, args[0])
+		if clientAddr == "" {
+			return
+		}
+		targets = []string{clientAddr}
+	}
+
+	for _, addr := range targets {
+		if err := tracker.Terminate(addr); err != nil {
+			fmt.Printf("Error terminating %s: %v\n", addr, err)
+			continue
+		}
+		fmt.Printf("Terminated %s\n", addr)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestDuplicateNotesMarkNewerSessions(t *testing.T) {
+	groups := []duplicateGroup{{
+		machineID: "0123456789abcdef",
+		numbers:   []int{2, 5},
+		addrs:     []string{"10.0.0.5:1", "10.0.0.5:2"},
+	}}
+	notes := duplicateNotes(groups)
+	if _, ok := notes["10.0.0.5:1"]; ok {
+		t.Error("oldest session should not be marked")
+	}
+	if got := notes["10.0.0.5:2"]; got != " ⚠ duplicate of #2" {
+		t.Errorf("unexpected note %q", got)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+	"golang.org/x/term"
+)
+
+const elevateUsage = "Usage: elevate <client_id> [--sudo [--prompt] | --uac --user <user>]"
+
+// Windows mandatory integrity level SIDs, from highest to lowest.
+var integrityLevels = []struct {
+	sid   string
+	level string
+}{
+	{"S-1-16-16384", "system"},
+	{"S-1-16-12288", "high"},
+	{"S-1-16-8192", "medium"},
+	{"S-1-16-4096", "low"},
+}
+
+// privilegeReport describes the privileges a command ran with on a client.
+type privilegeReport struct {
+	User     string
+	ID       string // Unix uid; empty on Windows
+	Level    string // root, sudoer, user, or a Windows integrity level
+	Admin    bool   // Member of an administrative group
+	Elevated bool   // Running with full administrative rights
+	Method   string // How the privileges were obtained
+}
+
+func (r privilegeReport) print(clientAddr string) {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	fmt.Printf("\nPrivileges on %s:\n", clientAddr)
+	fmt.Printf("  user:     %s\n", r.User)
+	if r.ID != "" {
+		fmt.Printf("  id:       %s\n", r.ID)
+	}
+	fmt.Printf("  level:    %s\n", r.Level)
+	fmt.Printf("  admin:    %s\n", yesNo(r.Admin))
+	fmt.Printf("  elevated: %s\n", yesNo(r.Elevated))
+	fmt.Printf("  via:      %s\n\n", r.Method)
+}
+
+// commandRenderer is implemented by *server.Listener.
+type commandRenderer interface {
+	RenderCommand(clientAddr, name string, params map[string]string) (string, error)
+}
+
+func handleElevate(l server.ListenerInterface, clientAddr string, args []string) {
+	var sudo, uac, prompt bool
+	var user string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--sudo":
+			sudo = true
+		case "--uac":
+			uac = true
+		case "--prompt":
+			prompt = true
+		case "--user":
+			if i+1 >= len(args) {
+				fmt.Println(elevateUsage)
+				return
+			}
+			user = args[i+1]
+			i++
+		default:
+			fmt.Println(elevateUsage)
+			return
+		}
+	}
+	if sudo && uac || prompt && !sudo || user != "" && !uac {
+		fmt.Println(elevateUsage)
+		return
+	}
+	if l.IsInPtyMode(clientAddr) {
+		fmt.Println("Error: client is in PTY mode")
+		return
+	}
+
+	meta, _ := l.GetClientMetadata(clientAddr)
+	switch {
+	case sudo:
+		elevateSudo(l, clientAddr, meta.OS, prompt)
+	case uac:
+		if meta.OS != "" && meta.OS != "windows" {
+			fmt.Printf("Error: --uac requires a Windows client (client reports %s)\n", meta.OS)
+			return
+		}
+		if user == "" {
+			fmt.Println(elevateUsage)
+			return
+		}
+		elevateRunAs(l, clientAddr, user)
+	default:
+		out, err := runTemplate(l, clientAddr, config.TemplateWhoAmI)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		report := parsePrivileges(meta.OS, out)
+		report.Method = "current session"
+		report.print(clientAddr)
+		setSessionPrivileges(clientAddr, report)
+	}
+}
+
+// elevateSudo checks for sudo rights usable without a password and, if a
+// password is needed and prompt is set, opens a PTY running sudo so the
+// operator can type it.
+func elevateSudo(l server.ListenerInterface, clientAddr, osName string, prompt bool) {
+	if osName == "windows" {
+		fmt.Println("Error: --sudo is not available on Windows clients; use --uac")
+		return
+	}
+	out, err := runTemplate(l, clientAddr, config.TemplateSudo)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if strings.Contains(out, "uid=") {
+		report := parsePrivileges(osName, out)
+		report.Method = "sudo (cached credentials or NOPASSWD)"
+		report.print(clientAddr)
+		return
+	}
+
+	fmt.Printf("sudo without a password failed: %s\n", strings.TrimSpace(out))
+	if !prompt {
+		fmt.Println("Use --prompt to enter the password through a PTY shell")
+		return
+	}
+	// sudo caches credentials per terminal, so the root shell is the result
+	// rather than a later non-interactive check.
+	enterPtyShellWithInput(l, clientAddr, "sudo -i\n")
+}
+
+// elevateRunAs runs the whoami check as another Windows user through
+// PowerShell's Start-Process -Credential, the scriptable form of runas. The
+// script prompts for the password, which the client relays to the operator
+// and which comes back in a SECRET frame, so it is neither part of the
+// command nor of session recordings.
+func elevateRunAs(l server.ListenerInterface, clientAddr, user string) {
+	if meta, _ := l.GetClientMetadata(clientAddr); !meta.Announces(protocol.CapPrompt) {
+		fmt.Printf("Error: client %s does not relay password prompts (update the client)\n", clientAddr)
+		return
+	}
+	out, err := runPromptedCommand(l, clientAddr, runAsCommand(user))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if !strings.Contains(out, "S-1-") {
+		fmt.Printf("runas as %s failed: %s\n", user, strings.TrimSpace(out))
+		return
+	}
+	report := parsePrivileges("windows", out)
+	report.Method = "runas " + user
+	report.print(clientAddr)
+	if report.Admin && !report.Elevated {
+		fmt.Println("Note: the account is an administrator but UAC filtered the token; an interactive consent is needed for a high integrity level")
+	}
+}
+
+// runAsCommand builds a powershell -EncodedCommand line, which avoids
+// quoting the user name for cmd.exe. The password is read from stdin after
+// a "Password for <user>:" prompt.
+func runAsCommand(user string) string {
+	psQuote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	script := strings.Join([]string{
+		"$ErrorActionPreference='Stop'",
+		"[Console]::Out.Write(" + psQuote("Password for "+user+": ") + ")",
+		"$p=ConvertTo-SecureString ([Console]::In.ReadLine()) -AsPlainText -Force",
+		"$c=New-Object System.Management.Automation.PSCredential(" + psQuote(user) + ",$p)",
+		"$o=[IO.Path]::GetTempFileName()",
+		"Start-Process cmd.exe -ArgumentList '/c whoami & whoami /groups' -Credential $c -Wait -WindowStyle Hidden -WorkingDirectory $env:SystemRoot -RedirectStandardOutput $o",
+		"Get-Content $o",
+		"Remove-Item $o",
+	}, "; ")
+
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(buf[2*i:], u)
+	}
+	return "powershell -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(buf)
+}
+
+// parsePrivileges interprets the output of the whoami template: `id` on
+// Unix, `whoami & whoami /groups` on Windows.
+func parsePrivileges(osName, out string) privilegeReport {
+	if osName == "windows" || strings.Contains(out, "S-1-16-") {
+		return parseWindowsPrivileges(out)
+	}
+	return parseUnixPrivileges(out)
+}
+
+func parseUnixPrivileges(out string) privilegeReport {
+	r := privilegeReport{Level: "user"}
+	for _, field := range strings.Fields(out) {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "uid":
+			id, name, _ := strings.Cut(val, "(")
+			r.ID = id
+			r.User = strings.TrimSuffix(name, ")")
+		case "groups":
+			for _, g := range strings.Split(val, ",") {
+				_, name, _ := strings.Cut(g, "(")
+				switch strings.TrimSuffix(name, ")") {
+				case "sudo", "wheel", "admin":
+					r.Admin = true
+				}
+			}
+		}
+	}
+	if r.User == "" {
+		r.User = r.ID
+	}
+	if uid, err := strconv.Atoi(r.ID); err == nil && uid == 0 {
+		r.Level = "root"
+		r.Admin = true
+		r.Elevated = true
+	} else if r.Admin {
+		r.Level = "sudoer"
+	}
+	return r
+}
+
+func parseWindowsPrivileges(out string) privilegeReport {
+	r := privilegeReport{Level: "unknown"}
+	// whoami prints the account name first
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			r.User = line
+			break
+		}
+	}
+	for _, lvl := range integrityLevels {
+		if strings.Contains(out, lvl.sid) {
+			r.Level = lvl.level
+			break
+		}
+	}
+	// BUILTIN\Administrators; listed even when UAC filters the token
+	r.Admin = strings.Contains(out, "S-1-5-32-544")
+	r.Elevated = r.Level == "high" || r.Level == "system"
+	return r
+}
+
+// runTemplate renders a command template for the client and runs it.
+func runTemplate(l server.ListenerInterface, clientAddr, name string) (string, error) {
+	renderer, ok := l.(commandRenderer)
+	if !ok {
+		return "", fmt.Errorf("listener does not support command templates")
+	}
+	cmd, err := renderer.RenderCommand(clientAddr, name, nil)
+	if err != nil {
+		return "", err
+	}
+	return runRemoteCommand(l, clientAddr, cmd)
+}
+
+// runRemoteCommand runs cmd on the client and returns its output without the
+// end-of-output marker.
+func runRemoteCommand(l server.ListenerInterface, clientAddr, cmd string) (string, error) {
+	var resp string
+	var err error
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err = l.SendCommand(clientAddr, cmd); err != nil {
+			return
+		}
+		resp, err = l.GetResponse(clientAddr, protocol.CommandTimeout*time.Second)
+	})
+	return strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""), err
+}
+
+// runPromptedCommand runs a shell command whose password prompts the client
+// relays, allowing for the time the operator takes to answer them.
+func runPromptedCommand(l server.ListenerInterface, clientAddr, cmd string) (string, error) {
+	var resp string
+	var err error
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err = l.SendCommand(clientAddr, protocol.CmdPrompted+" "+cmd); err != nil {
+			return
+		}
+		resp, err = l.GetResponse(clientAddr, (protocol.CommandTimeout+protocol.PromptTimeout)*time.Second)
+	})
+	return strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""), err
+}
+
+// readPassword reads a secret with masked input. Tests replace it.
+var readPassword = func(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("stdin is not a terminal")
+	}
+	fmt.Print(prompt)
+	pw, err := term.ReadPassword(fd)
+	fmt.Println()
+	return string(pw), err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestParseUnixPrivileges(t *testing.T) {
+	r := parsePrivileges("linux", "uid=0(root) gid=0(root) groups=0(root)\n")
+	if r.User != "root" || r.ID != "0" || r.Level != "root" || !r.Elevated {
+		t.Errorf("unexpected root report: %+v", r)
+	}
+
+	r = parsePrivileges("linux", "uid=1000(alice) gid=1000(alice) groups=1000(alice),27(sudo)\n")
+	if r.User != "alice" || r.Level != "sudoer" || !r.Admin || r.Elevated {
+		t.Errorf("unexpected sudoer report: %+v", r)
+	}
+
+	r = parsePrivileges("darwin", "uid=501(bob) gid=20(staff) groups=20(staff)\n")
+	if r.Level != "user" || r.Admin || r.Elevated {
+		t.Errorf("unexpected user report: %+v", r)
+	}
+}
+
+func TestParseWindowsPrivileges(t *testing.T) {
+	out := "desktop-1\\alice\r\n\r\nGROUP INFORMATION\r\n" +
+		"BUILTIN\\Administrators Alias S-1-5-32-544 Group used for deny only\r\n" +
+		"Mandatory Label\\Medium Mandatory Level Label S-1-16-8192\r\n"
+	r := parsePrivileges("windows", out)
+	if r.User != "desktop-1\\alice" || r.Level != "medium" || !r.Admin || r.Elevated {
+		t.Errorf("unexpected filtered admin report: %+v", r)
+	}
+
+	out = "nt authority\\system\r\nMandatory Label\\System Mandatory Level Label S-1-16-16384\r\n"
+	r = parsePrivileges("windows", out)
+	if r.User != "nt authority\\system" || r.Level != "system" || !r.Elevated {
+		t.Errorf("unexpected system report: %+v", r)
+	}
+}
+
+func TestRunAsCommandReadsPasswordFromStdin(t *testing.T) {
+	cmd := runAsCommand("corp\\o'neil")
+	encoded, ok := strings.CutPrefix(cmd, "powershell -NoProfile -NonInteractive -EncodedCommand ")
+	if !ok {
+		t.Fatalf("unexpected command: %s", cmd)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("invalid base64: %v", err)
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+	}
+	script := string(utf16.Decode(units))
+	if !strings.Contains(script, "'corp\\o''neil'") {
+		t.Errorf("user not quoted in script: %s", script)
+	}
+	// The client relays the prompt, so it must look like a password prompt
+	if !strings.Contains(script, "'Password for corp\\o''neil: '") || !strings.Contains(script, "[Console]::In.ReadLine()") {
+		t.Errorf("script does not prompt for the password: %s", script)
+	}
+}
+
+func TestElevateRejectsPasswordFlag(t *testing.T) {
+	ml := newRefListener()
+	out := captureStdout(t, func() {
+		handleElevate(ml, "10.0.0.2:2000", []string{"--uac", "--user", "admin", "--password", "hunter2"})
+	})
+	if !strings.Contains(out, elevateUsage) {
+		t.Errorf("expected usage for --password, got %q", out)
+	}
+}
+
+func TestElevateUACNeedsPromptRelay(t *testing.T) {
+	ml := newRefListener()
+	ml.metadata["10.0.0.2:2000"] = server.ClientMetadata{Hostname: "win1", OS: "windows", Capabilities: []string{protocol.CapExec}}
+	out := captureStdout(t, func() {
+		handleElevate(ml, "10.0.0.2:2000", []string{"--uac", "--user", "admin"})
+	})
+	if !strings.Contains(out, "does not relay password prompts") || len(ml.sentCommands) != 0 {
+		t.Errorf("expected elevate --uac to refuse the client, got %q (sent %q)", out, ml.sentCommands)
+	}
+
+	ml.metadata["10.0.0.2:2000"] = server.ClientMetadata{Hostname: "win1", OS: "windows", Capabilities: []string{protocol.CapExec, protocol.CapPrompt}}
+	ml.responses = []string{"corp\\admin\r\nMandatory Label\\Medium Mandatory Level Label S-1-16-8192\r\n" + protocol.EndOfOutputMarker + "\n"}
+	captureStdout(t, func() {
+		handleElevate(ml, "10.0.0.2:2000", []string{"--uac", "--user", "admin"})
+	})
+	if len(ml.sentCommands) != 1 || !strings.HasPrefix(ml.sentCommands[0], protocol.CmdPrompted+" powershell ") {
+		t.Errorf("expected the check to be sent as PROMPTED, sent %q", ml.sentCommands)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// engagementClock is implemented by *server.Listener.
+type engagementClock interface {
+	EngagementEnd() time.Time
+	EngagementOver() bool
+}
+
+// readOnlyCommands are the REPL commands left once the engagement is over:
+// they list or export what the listener knows without touching clients.
+var readOnlyCommands = map[string]bool{
+	"ls": true, "dir": true, "help": true, "assets": true, "browse": true, "forwards": true,
+	"jobs": true, "debug": true, "exit": true,
+}
+
+// allowedAfterEngagement reports whether a REPL command may run, printing
+// why not when the engagement is over.
+func allowedAfterEngagement(l server.ListenerInterface, parts []string) bool {
+	clock, ok := l.(engagementClock)
+	if !ok || !clock.EngagementOver() || readOnlyCommands[parts[0]] {
+		return true
+	}
+	fmt.Printf("Error: the engagement ended at %s; only ls, assets, browse, forwards, jobs, debug, help and exit are available\n", clock.EngagementEnd().Format(time.RFC3339))
+	return false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const setenvFileUsage = "Usage: setenv-file <client_id> [<remote_path> | --clear]"
+
+// clearFlag stops sourcing the environment file.
+const clearFlag = "--clear"
+
+// envFileSetter is implemented by *server.Listener.
+type envFileSetter interface {
+	SetEnvFile(clientAddr, path string) error
+	EnvFile(clientAddr string) string
+}
+
+// handleSetenvFile makes a client source a remote environment file before
+// every non-PTY command, shows the file it sources, or stops it.
+func handleSetenvFile(l server.ListenerInterface, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println(setenvFileUsage)
+		fmt.Println("Example: setenv-file 1 /tmp/.env")
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" {
+		return
+	}
+	setter, ok := l.(envFileSetter)
+	if !ok {
+		fmt.Println("Error: this listener does not support environment files")
+		return
+	}
+	label := clientLabel(l, clientAddr)
+	if len(args) == 1 {
+		if path := setter.EnvFile(clientAddr); path != "" {
+			fmt.Printf("%s sources %s before every command\n", label, path)
+		} else {
+			fmt.Printf("%s sources no environment file\n", label)
+		}
+		return
+	}
+	if !requireApproved(l, clientAddr) {
+		return
+	}
+
+	path := args[1]
+	if path == clearFlag {
+		path = ""
+	}
+	if err := setter.SetEnvFile(clientAddr, path); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if path == "" {
+		fmt.Printf("✓ %s no longer sources an environment file\n", label)
+		return
+	}
+	fmt.Printf("✓ %s sources %s before every command, also after reconnecting\n", label, path)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// envFileListener remembers environment files like server.Listener.
+type envFileListener struct {
+	*mockListener
+	files map[string]string
+}
+
+func (e *envFileListener) SetEnvFile(clientAddr, path string) error {
+	e.files[clientAddr] = path
+	return nil
+}
+
+func (e *envFileListener) EnvFile(clientAddr string) string { return e.files[clientAddr] }
+
+func TestSetenvFile(t *testing.T) {
+	l := &envFileListener{mockListener: newRefListener(), files: make(map[string]string)}
+
+	out := captureStdout(t, func() { dispatchCommand(l, []string{"setenv-file", "web1", "/tmp/.env"}) })
+	if l.files["10.0.0.1:1000"] != "/tmp/.env" || !strings.Contains(out, "sources /tmp/.env") {
+		t.Fatalf("expected the file to be set, got %q", out)
+	}
+	out = captureStdout(t, func() { handleSetenvFile(l, []string{"1"}) })
+	if !strings.Contains(out, "a1b2c3d4@web1 sources /tmp/.env") {
+		t.Errorf("unexpected output %q", out)
+	}
+	captureStdout(t, func() { handleSetenvFile(l, []string{"1", "--clear"}) })
+	if l.files["10.0.0.1:1000"] != "" {
+		t.Errorf("expected the file to be cleared, got %q", l.files["10.0.0.1:1000"])
+	}
+	out = captureStdout(t, func() { handleSetenvFile(l, nil) })
+	if !strings.Contains(out, "Usage: setenv-file") {
+		t.Errorf("expected usage, got %q", out)
+	}
+}
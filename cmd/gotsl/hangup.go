@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+// hangupSignals are the signals sent when the operator's terminal goes away:
+// SIGHUP when a terminal window or SSH session closes, and SIGTERM on Windows
+// when the console window is closed.
+func hangupSignals() []os.Signal {
+	if runtime.GOOS == "windows" {
+		return []os.Signal{syscall.SIGTERM}
+	}
+	return []os.Signal{syscall.SIGHUP}
+}
+
+// watchHangup returns a channel that is closed when the operator's terminal
+// hangs up, and a function to stop watching. While watching, the hangup no
+// longer kills gotsl, so a PTY shell or the TUI can end its remote sessions
+// first; the REPL then stops on the dead terminal as usual.
+func watchHangup() (<-chan struct{}, func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, hangupSignals()...)
+	hangup := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+			close(hangup)
+		case <-stop:
+		}
+	}()
+	return hangup, func() {
+		signal.Stop(sigs)
+		close(stop)
+	}
+}
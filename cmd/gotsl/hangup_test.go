@@ -0,0 +1,70 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// ptyListener hands out a PTY data channel and closes it on exit, like the
+// real listener does.
+type ptyListener struct {
+	*mockListener
+	data chan []byte
+}
+
+func (m *ptyListener) EnterPtyMode(clientAddr string) (chan []byte, error) {
+	m.data = make(chan []byte)
+	return m.data, nil
+}
+
+func (m *ptyListener) ExitPtyMode(clientAddr string) error {
+	close(m.data)
+	return nil
+}
+
+func TestPtyShellEndsOnTerminalEOF(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+	w.Close()
+
+	ml := &ptyListener{mockListener: &mockListener{
+		clients:   []string{"10.0.0.1:1000"},
+		responses: []string{"OK" + protocol.EndOfOutputMarker},
+	}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		captureStdout(t, func() { enterPtyShell(ml, "10.0.0.1:1000") })
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PTY shell did not end after the terminal closed")
+	}
+	if n := len(ml.sentCommands); n == 0 || ml.sentCommands[n-1] != protocol.CmdPtyExit {
+		t.Errorf("expected PTY_EXIT to be sent, got %q", ml.sentCommands)
+	}
+}
+
+func TestWatchHangup(t *testing.T) {
+	hangup, stop := watchHangup()
+	defer stop()
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	select {
+	case <-hangup:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP was not reported")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// Flags deferring an upload or download.
+const (
+	atFlag     = "--at"
+	windowFlag = "--window"
+)
+
+// transferWindows are the low-usage periods --window waits for; set from the
+// listener config.
+var transferWindows []config.TransferWindow
+
+var errTransferFailed = errors.New("transfer failed")
+
+// jobScheduler is implemented by *server.Listener.
+type jobScheduler interface {
+	Scheduler() *server.Scheduler
+}
+
+// transferStart returns when a transfer given --at and --window should run,
+// or the zero time to run it now. at is a time of day; a time already past
+// today means tomorrow.
+func transferStart(at string, window bool, now time.Time) (time.Time, error) {
+	switch {
+	case at != "" && window:
+		return time.Time{}, fmt.Errorf("%s and %s cannot be combined", atFlag, windowFlag)
+	case at != "":
+		clock, err := config.ParseClock(at)
+		if err != nil {
+			return time.Time{}, err
+		}
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		start := midnight.Add(clock)
+		if !start.After(now) {
+			start = midnight.AddDate(0, 0, 1).Add(clock)
+		}
+		return start, nil
+	case window:
+		if len(transferWindows) == 0 {
+			return time.Time{}, fmt.Errorf("no transfer_windows configured")
+		}
+		if start := server.NextTransferWindow(transferWindows, now); start.After(now) {
+			return start, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// scheduleTransfer queues a transfer to run at the given time. When it runs
+// it takes the console's lock on the client like an immediate transfer; fn
+// is passed the client, which a migration may have changed, and reports
+// whether the transfer succeeded.
+func scheduleTransfer(l server.ListenerInterface, clientAddr string, at time.Time, reason, description string, keys []string, override bool, fn func(clientAddr string) bool) {
+	js, ok := l.(jobScheduler)
+	if !ok {
+		fmt.Println("Error: this listener cannot schedule transfers")
+		return
+	}
+	job, err := js.Scheduler().ScheduleAt(at, clientAddr, description, keys, func(clientAddr string) error {
+		if !slices.Contains(l.GetClients(), clientAddr) {
+			return fmt.Errorf("client %s is no longer connected", clientAddr)
+		}
+		release, err := lockSession(l, clientAddr, reason, override)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if !fn(clientAddr) {
+			return errTransferFailed
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Scheduled job %d for %s: %s\n", job.ID, at.Format("2006-01-02 15:04"), description)
+}
+
+// reportJob announces a deferred transfer that has run.
+func reportJob(job server.Job, err error) {
+	if err != nil {
+		log.Printf("[-] Scheduled job %d failed (%s): %v", job.ID, job.Description, err)
+		return
+	}
+	log.Printf("[+] Scheduled job %d finished: %s", job.ID, job.Description)
+}
+
+// handleJobs lists deferred transfers, or cancels one.
+func handleJobs(l server.ListenerInterface, args []string) {
+	js, ok := l.(jobScheduler)
+	if !ok {
+		fmt.Println("Error: this listener cannot schedule transfers")
+		return
+	}
+	scheduler := js.Scheduler()
+	switch {
+	case len(args) == 0:
+		jobs := scheduler.Jobs()
+		if len(jobs) == 0 {
+			fmt.Println("No scheduled jobs")
+			return
+		}
+		fmt.Println("\nScheduled jobs:")
+		for _, job := range jobs {
+			fmt.Printf("  %d. %s  %s  %s\n", job.ID, job.At.Format("2006-01-02 15:04"), clientLabel(l, job.ClientAddr), job.Description)
+		}
+		fmt.Println()
+	case len(args) == 2 && args[0] == "cancel":
+		id, err := strconv.Atoi(args[1])
+		if err != nil || !scheduler.Cancel(id) {
+			fmt.Printf("No scheduled job %s\n", args[1])
+			return
+		}
+		fmt.Printf("Cancelled job %d\n", id)
+	default:
+		fmt.Println("Usage: jobs [cancel <job_id>]")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestTransferStart(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	if start, err := transferStart("", false, now); err != nil || !start.IsZero() {
+		t.Errorf("expected an immediate transfer, got %s (%v)", start, err)
+	}
+	if start, err := transferStart("14:30", false, now); err != nil || !start.Equal(time.Date(2024, 3, 10, 14, 30, 0, 0, time.Local)) {
+		t.Errorf("expected today 14:30, got %s (%v)", start, err)
+	}
+	if start, err := transferStart("02:00", false, now); err != nil || !start.Equal(time.Date(2024, 3, 11, 2, 0, 0, 0, time.Local)) {
+		t.Errorf("expected tomorrow 02:00, got %s (%v)", start, err)
+	}
+	if _, err := transferStart("2am", false, now); err == nil {
+		t.Error("expected an error for a bad time")
+	}
+	if _, err := transferStart("02:00", true, now); err == nil {
+		t.Error("expected --at and --window to conflict")
+	}
+
+	defer func() { transferWindows = nil }()
+	transferWindows = nil
+	if _, err := transferStart("", true, now); err == nil {
+		t.Error("expected an error without configured windows")
+	}
+	night, _ := config.ParseTransferWindow("01:00-05:00")
+	noon, _ := config.ParseTransferWindow("11:00-13:00")
+	transferWindows = []config.TransferWindow{night}
+	if start, err := transferStart("", true, now); err != nil || !start.Equal(time.Date(2024, 3, 11, 1, 0, 0, 0, time.Local)) {
+		t.Errorf("expected the next window, got %s (%v)", start, err)
+	}
+	transferWindows = append(transferWindows, noon)
+	if start, err := transferStart("", true, now); err != nil || !start.IsZero() {
+		t.Errorf("expected an open window to start now, got %s (%v)", start, err)
+	}
+}
+
+// schedulingListener adds a scheduler to the mock listener.
+type schedulingListener struct {
+	*mockListener
+	scheduler *server.Scheduler
+}
+
+func (s *schedulingListener) Scheduler() *server.Scheduler { return s.scheduler }
+
+func TestScheduledUpload(t *testing.T) {
+	ml := newRefListener()
+	ml.responses = []string{"OK", "OK", "OK\n4\n"}
+	sl := &schedulingListener{mockListener: ml, scheduler: server.NewScheduler(1)}
+	done := make(chan error, 1)
+	sl.scheduler.SetJobDone(func(job server.Job, err error) { done <- err })
+
+	local := t.TempDir() + "/test.txt"
+	os.WriteFile(local, []byte("test"), 0644)
+	out := captureStdout(t, func() {
+		scheduleTransfer(sl, "10.0.0.1:1000", time.Now().Add(10*time.Millisecond), "upload", "upload test.txt -> /tmp/test.txt",
+			[]string{server.ResponseKey}, false, func(clientAddr string) bool {
+				return handleUploadGlobal(sl, clientAddr, local, "/tmp/test.txt", "", false)
+			})
+		handleJobs(sl, nil)
+		// The job prints too, so it must finish before stdout is restored
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("scheduled upload failed: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("scheduled upload did not run")
+		}
+	})
+	if !strings.Contains(out, "Scheduled job 1 for") || !strings.Contains(out, "a1b2c3d4@web1  upload test.txt -> /tmp/test.txt") {
+		t.Errorf("unexpected output %q", out)
+	}
+	if len(ml.sentCommands) == 0 || !strings.HasPrefix(ml.sentCommands[0], "START_UPLOAD") {
+		t.Errorf("expected the upload to be sent, got %q", ml.sentCommands)
+	}
+}
+
+func TestHandleJobsCancel(t *testing.T) {
+	sl := &schedulingListener{mockListener: newRefListener(), scheduler: server.NewScheduler(1)}
+	job, _ := sl.scheduler.ScheduleAt(time.Now().Add(time.Hour), "10.0.0.2:2000", "download /etc/passwd -> loot/passwd", nil, func(string) error { return nil })
+
+	out := captureStdout(t, func() {
+		handleJobs(sl, []string{"cancel", "1"})
+		handleJobs(sl, []string{"cancel", "1"})
+		handleJobs(sl, nil)
+	})
+	if job.ID != 1 || !strings.Contains(out, "Cancelled job 1") || !strings.Contains(out, "No scheduled job 1") || !strings.Contains(out, "No scheduled jobs") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+// keyPassphraseEnv names the variable holding the passphrase of encrypted
+// key files. It is unset once read.
+const keyPassphraseEnv = "GOTS_KEY_PASSPHRASE"
+
+// ageHeader starts every binary age file.
+const ageHeader = "age-encryption.org/v1\n"
+
+// isEncryptedKey reports whether a key file's contents are age-encrypted,
+// binary or armored, rather than a plain PEM key.
+func isEncryptedKey(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader)) || bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// loadKeyPair loads a PEM certificate and private key like
+// tls.LoadX509KeyPair. The key file may be encrypted with an age passphrase
+// (age -p), so a copy of the listener's disk does not give the key away;
+// passphrase is then called for it.
+func loadKeyPair(certFile, keyFile string, passphrase func() (string, error)) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if isEncryptedKey(keyPEM) {
+		pass, err := passphrase()
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if keyPEM, err = decryptKey(keyPEM, pass); err != nil {
+			return tls.Certificate{}, fmt.Errorf("%s: %w", keyFile, err)
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// decryptKey decrypts an age-encrypted key file with passphrase.
+func decryptKey(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageHeader)) {
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	dec, err := age.Decrypt(r, identity)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, errors.New("wrong passphrase, or the key is not encrypted with one")
+		}
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	return io.ReadAll(dec)
+}
+
+// keyPassphrase returns the source of the passphrase for encrypted key
+// files. It takes keyPassphraseEnv, or asks on the terminal, at most once,
+// and only when an encrypted key is actually loaded.
+func keyPassphrase() func() (string, error) {
+	var once sync.Once
+	var pass string
+	var err error
+	return func() (string, error) {
+		once.Do(func() {
+			if pass = os.Getenv(keyPassphraseEnv); pass != "" {
+				_ = os.Unsetenv(keyPassphraseEnv)
+				return
+			}
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				err = fmt.Errorf("the key file is encrypted: set %s or start gotsl on a terminal", keyPassphraseEnv)
+				return
+			}
+			pass, err = readPassword("Key passphrase: ")
+		})
+		return pass, err
+	}
+}
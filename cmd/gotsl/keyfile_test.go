@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/frjcomp/gots/pkg/certs"
+)
+
+func TestLoadKeyPairEncrypted(t *testing.T) {
+	cert, fingerprint, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(cert.PrivateKey.(*rsa.PrivateKey))})
+	os.WriteFile(certFile, certPEM, 0o600)
+
+	encrypt := func(armored bool) []byte {
+		r, err := age.NewScryptRecipient("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetWorkFactor(10)
+		var buf bytes.Buffer
+		if !armored {
+			w, _ := age.Encrypt(&buf, r)
+			w.Write(keyPEM)
+			w.Close()
+			return buf.Bytes()
+		}
+		a := armor.NewWriter(&buf)
+		w, _ := age.Encrypt(a, r)
+		w.Write(keyPEM)
+		w.Close()
+		a.Close()
+		return buf.Bytes()
+	}
+
+	noPassphrase := func() (string, error) { return "", errors.New("not encrypted") }
+	tests := []struct {
+		name       string
+		key        []byte
+		passphrase func() (string, error)
+		wantErr    bool
+	}{
+		{"plain", keyPEM, noPassphrase, false},
+		{"binary", encrypt(false), func() (string, error) { return "correct horse", nil }, false},
+		{"armored", encrypt(true), func() (string, error) { return "correct horse", nil }, false},
+		{"wrong passphrase", encrypt(true), func() (string, error) { return "battery staple", nil }, true},
+		{"no passphrase", encrypt(false), noPassphrase, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile := filepath.Join(dir, "key.pem")
+			os.WriteFile(keyFile, tt.key, 0o600)
+			got, err := loadKeyPair(certFile, keyFile, tt.passphrase)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadKeyPair failed: %v", err)
+			}
+			if fp, _ := certs.GetCertificateFingerprint(got); fp != fingerprint {
+				t.Errorf("expected fingerprint %s, got %s", fingerprint, fp)
+			}
+		})
+	}
+}
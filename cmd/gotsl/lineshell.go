@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// legacyPtyFailure starts the answer of clients that predate
+// PTY_UNAVAILABLE when they cannot start a PTY.
+const legacyPtyFailure = "Failed to start PTY: "
+
+// ptyUnavailableError is a client's answer to PTY_MODE when it cannot start
+// a PTY, either because it was built without PTY support or because the
+// host has none to offer.
+type ptyUnavailableError struct {
+	reason  string // protocol.PtyUnsupported or protocol.PtyFailed
+	message string
+}
+
+func (e *ptyUnavailableError) Error() string {
+	return fmt.Sprintf("Failed to enter PTY mode (%s): %s", e.reason, e.message)
+}
+
+// parsePtyUnavailable reads a PTY_UNAVAILABLE answer, or the plain failure
+// message of an older client.
+func parsePtyUnavailable(resp string) (*ptyUnavailableError, bool) {
+	resp = strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""))
+	if message, ok := strings.CutPrefix(resp, legacyPtyFailure); ok {
+		return &ptyUnavailableError{reason: protocol.PtyFailed, message: message}, true
+	}
+	rest, ok := strings.CutPrefix(resp, protocol.CmdPtyUnavailable+" ")
+	if !ok {
+		return nil, false
+	}
+	reason, message, _ := strings.Cut(rest, " ")
+	return &ptyUnavailableError{reason: reason, message: message}, true
+}
+
+// lineShellOffer asks whether to use the line-buffered shell instead of a
+// PTY. Without a terminal it declines, so scripted sessions do not have
+// their next commands read as shell input. Tests replace it.
+var lineShellOffer = func(prompt string) bool {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	fmt.Print(prompt)
+	buf := make([]byte, 64)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(string(buf[:n])))
+	return answer == "" || answer[0] == 'y'
+}
+
+// offerLineShell runs the line-buffered shell with a client that cannot
+// start a PTY, if the operator agrees.
+func offerLineShell(l server.ListenerInterface, clientAddr string) {
+	if !lineShellOffer("Open a line-buffered shell instead? [Y/n] ") {
+		return
+	}
+	runLineShell(l, clientAddr, os.Stdin)
+}
+
+// runLineShell runs each line read from in as a command on the client and
+// prints its output. There is no terminal, so programs that need one do
+// not work, but the working directory set with cd is kept between lines.
+func runLineShell(l server.ListenerInterface, clientAddr string, in io.Reader) {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	label := clientLabel(l, clientAddr)
+	fmt.Printf("Line-buffered shell with %s. Each line runs as its own command without a terminal:\n", label)
+	fmt.Println("editors, pagers and password prompts of su or ssh do not work. Type exit or press Ctrl-D to return.")
+
+	reader := bufio.NewReader(in)
+	workDir := ""
+	for {
+		fmt.Printf("%s:%s$ ", label, workDir)
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "exit" || line == "" && err != nil {
+			fmt.Println()
+			return
+		}
+		if line == "" {
+			continue
+		}
+
+		cmd := line
+		target, isCd := cdTarget(meta.OS, line)
+		if isCd {
+			cmd = changeDirCommand(meta.OS, target)
+		}
+		out, err := runRemoteCommand(l, clientAddr, inWorkDir(meta.OS, workDir, cmd))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			if !slices.Contains(l.GetClients(), clientAddr) {
+				return
+			}
+			continue
+		}
+		if isCd {
+			if dir, ok := absoluteDir(meta.OS, out); ok {
+				workDir = dir
+				continue
+			}
+		}
+		fmt.Print(out)
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+// cdTarget reports whether line only changes the directory, and to where.
+// A bare cd goes to the home directory except on Windows, where it prints
+// the current one like any other command.
+func cdTarget(osName, line string) (string, bool) {
+	if line == "cd" {
+		return "", osName != "windows"
+	}
+	target, ok := strings.CutPrefix(line, "cd ")
+	if !ok || strings.ContainsAny(target, "&|;<>") {
+		return "", false
+	}
+	return strings.TrimSpace(target), true
+}
+
+// changeDirCommand changes to target and prints the resulting directory.
+// The target is passed as typed so the shell expands ~ and variables.
+func changeDirCommand(osName, target string) string {
+	if osName == "windows" {
+		return "cd /d " + target + " && cd"
+	}
+	return "cd " + target + " && pwd"
+}
+
+// inWorkDir prefixes cmd with a change to the shell's working directory.
+func inWorkDir(osName, workDir, cmd string) string {
+	if workDir == "" {
+		return cmd
+	}
+	if osName == "windows" {
+		return "cd /d " + server.QuoteShellArg(osName, workDir) + " && " + cmd
+	}
+	return "cd " + server.QuoteShellArg(osName, workDir) + " && " + cmd
+}
+
+// absoluteDir returns the directory printed by a successful change of
+// directory: a single absolute path.
+func absoluteDir(osName, out string) (string, bool) {
+	dir := strings.TrimSpace(out)
+	if dir == "" || strings.Contains(dir, "\n") {
+		return "", false
+	}
+	if osName == "windows" {
+		return dir, len(dir) >= 3 && dir[1] == ':' && dir[2] == '\\' || strings.HasPrefix(dir, `\\`)
+	}
+	return dir, strings.HasPrefix(dir, "/")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestParsePtyUnavailable(t *testing.T) {
+	e, ok := parsePtyUnavailable("PTY_UNAVAILABLE unsupported PTY support not included in this build (minimal)\n" + protocol.EndOfOutputMarker)
+	if !ok || e.reason != protocol.PtyUnsupported || e.message != "PTY support not included in this build (minimal)" {
+		t.Errorf("unexpected result %+v, %v", e, ok)
+	}
+	e, ok = parsePtyUnavailable("Failed to start PTY: open /dev/ptmx: no such file or directory\n" + protocol.EndOfOutputMarker)
+	if !ok || e.reason != protocol.PtyFailed || !strings.Contains(e.message, "/dev/ptmx") {
+		t.Errorf("expected the message of older clients to be recognized, got %+v, %v", e, ok)
+	}
+	if _, ok := parsePtyUnavailable("OK\n" + protocol.EndOfOutputMarker); ok {
+		t.Error("OK must not be taken for a failure")
+	}
+}
+
+func TestShellOffersLineShellWithoutPty(t *testing.T) {
+	orig := lineShellOffer
+	defer func() { lineShellOffer = orig }()
+	offered := 0
+	lineShellOffer = func(string) bool { offered++; return false }
+
+	ml := &mockListener{
+		clients:   []string{"10.0.0.1:1000"},
+		responses: []string{"PTY_UNAVAILABLE failed open /dev/ptmx: no such device\n" + protocol.EndOfOutputMarker},
+	}
+	out := captureStdout(t, func() { enterPtyShell(ml, "10.0.0.1:1000") })
+	if offered != 1 || !strings.Contains(out, "Failed to enter PTY mode (failed): open /dev/ptmx") {
+		t.Errorf("expected the failure and an offer, got %d offers and %q", offered, out)
+	}
+
+	ml = &mockListener{
+		clients:  []string{"10.0.0.1:1000"},
+		metadata: map[string]server.ClientMetadata{"10.0.0.1:1000": {Capabilities: []string{"exec", "transfer"}}},
+	}
+	captureStdout(t, func() { enterPtyShell(ml, "10.0.0.1:1000") })
+	if offered != 2 || len(ml.sentCommands) != 0 {
+		t.Errorf("expected an offer without PTY_MODE for a minimal client, got %d offers and %q", offered, ml.sentCommands)
+	}
+
+	captureStdout(t, func() { enterPtyShellWithInput(ml, "10.0.0.1:1000", "sudo -i\n") })
+	if offered != 2 {
+		t.Error("input meant for a terminal must not be offered a line-buffered shell")
+	}
+}
+
+func TestRunLineShellKeepsWorkDir(t *testing.T) {
+	ml := &mockListener{
+		clients:  []string{"10.0.0.1:1000"},
+		metadata: map[string]server.ClientMetadata{"10.0.0.1:1000": {OS: "linux"}},
+		responses: []string{
+			"/srv/it's\n" + protocol.EndOfOutputMarker,
+			"notes.txt\n" + protocol.EndOfOutputMarker,
+			"bash: line 1: cd: nope: No such file or directory\n" + protocol.EndOfOutputMarker,
+		},
+	}
+	out := captureStdout(t, func() {
+		runLineShell(ml, "10.0.0.1:1000", strings.NewReader("cd \"/srv/it's\"\n\nls\ncd nope\nexit\nls\n"))
+	})
+	want := []string{`cd "/srv/it's" && pwd`, `cd '/srv/it'\''s' && ls`, `cd '/srv/it'\''s' && cd nope && pwd`}
+	if strings.Join(ml.sentCommands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q, want %q", ml.sentCommands, want)
+	}
+	if !strings.Contains(out, "notes.txt") || !strings.Contains(out, "No such file") || !strings.Contains(out, "/srv/it's$ ") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestLineShellWindowsWorkDir(t *testing.T) {
+	if got := changeDirCommand("windows", `C:\Users`); got != `cd /d C:\Users && cd` {
+		t.Errorf("changeDirCommand = %q", got)
+	}
+	if got := inWorkDir("windows", `C:\Program Files`, "dir"); got != `cd /d "C:\Program Files" && dir` {
+		t.Errorf("inWorkDir = %q", got)
+	}
+	if dir, ok := absoluteDir("windows", "C:\\Users\r\n"); !ok || dir != `C:\Users` {
+		t.Errorf("absoluteDir = %q, %v", dir, ok)
+	}
+	if _, ok := cdTarget("windows", "cd"); ok {
+		t.Error("a bare cd prints the directory on Windows")
+	}
+	if _, ok := cdTarget("linux", "cd /tmp && ls"); ok {
+		t.Error("a compound command is not a change of directory")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// linkMonitor is implemented by *server.Listener.
+type linkMonitor interface {
+	LinkQuality(clientAddr string) (server.LinkQuality, bool)
+}
+
+// linkQuality returns what the listener observed of a client's connection.
+func linkQuality(l server.ListenerInterface, clientAddr string) (server.LinkQuality, bool) {
+	if m, ok := l.(linkMonitor); ok {
+		return m.LinkQuality(clientAddr)
+	}
+	return server.LinkQuality{}, false
+}
+
+// warnDegradedLink tells the operator before a transfer when the client's
+// link is degraded, since a large transfer may not survive it.
+func warnDegradedLink(l server.ListenerInterface, clientAddr string) {
+	if q, ok := linkQuality(l, clientAddr); ok && q.Degraded {
+		fmt.Printf("Warning: the link to %s is degraded (%s); the transfer may stall or fail\n", clientLabel(l, clientAddr), strings.Join(q.Reasons, "; "))
+	}
+}
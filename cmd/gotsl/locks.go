@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// consoleOperator names the local REPL or TUI operator in session locks.
+const consoleOperator = "console"
+
+// overrideFlag lets the console proceed despite another operator's lock.
+const overrideFlag = "--override"
+
+// sessionLocker is implemented by *server.Listener.
+type sessionLocker interface {
+	LockSession(clientAddr, operator, reason string, override bool) (func(), error)
+	SessionLocks(clientAddr string) []server.SessionLock
+}
+
+// lockSession takes the console's soft lock on a client for reason. When
+// another operator holds the client it returns an error naming them, unless
+// override is set. Listeners without locking always succeed.
+func lockSession(l server.ListenerInterface, clientAddr, reason string, override bool) (func(), error) {
+	locker, ok := l.(sessionLocker)
+	if !ok {
+		return func() {}, nil
+	}
+	release, err := locker.LockSession(clientAddr, consoleOperator, reason, override)
+	var locked *server.LockedError
+	if errors.As(err, &locked) {
+		return nil, fmt.Errorf("%w; use %s to proceed anyway", err, overrideFlag)
+	}
+	return release, err
+}
+
+// runLocked runs fn while holding the console's lock on a client, printing
+// an error instead if the lock cannot be taken.
+func runLocked(l server.ListenerInterface, clientAddr, reason string, override bool, fn func()) {
+	release, err := lockSession(l, clientAddr, reason, override)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer release()
+	fn()
+}
+
+// lockSummary describes who holds locks on a client for ls, e.g.
+// "alice:pty,console:upload", or "" when it is not locked.
+func lockSummary(l server.ListenerInterface, clientAddr string) string {
+	locker, ok := l.(sessionLocker)
+	if !ok {
+		return ""
+	}
+	locks := locker.SessionLocks(clientAddr)
+	parts := make([]string, len(locks))
+	for i, lock := range locks {
+		parts[i] = lock.Operator + ":" + lock.Reason
+	}
+	return strings.Join(parts, ",")
+}
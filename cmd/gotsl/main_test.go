@@ -120,12 +120,12 @@ func TestRunListenerArgValidation(t *testing.T) {
 
 func TestListClientsEmpty(t *testing.T) {
 	ml := &mockListener{clients: []string{}}
-	listClients(ml)
+	listClients(ml, false)
 }
 
 func TestListClientsMultiple(t *testing.T) {
 	ml := &mockListener{clients: []string{"192.168.1.2:1234", "10.0.0.5:5678"}}
-	listClients(ml)
+	listClients(ml, false)
 }
 
 func TestGetClientByIDValid(t *testing.T) {
@@ -247,7 +247,7 @@ func TestListClientsIncludesIdentifiers(t *testing.T) {
 			"1.2.3.4:1111": {Identifier: "abc12345", OS: "linux", Hostname: "host1", IP: "10.0.0.2"},
 		},
 	}
-	listClients(ml)
+	listClients(ml, false)
 
 	// Restore stdout
 	w.Close()
@@ -276,7 +276,7 @@ func TestPrintHeader(t *testing.T) {
 
 func TestHandleUploadGlobalBadFile(t *testing.T) {
 	ml := &mockListener{}
-	result := handleUploadGlobal(ml, "192.168.1.2:1234", "/nonexistent/file.txt", "/remote/path.txt")
+	result := handleUploadGlobal(ml, "192.168.1.2:1234", "/nonexistent/file.txt", "/remote/path.txt", "", false)
 	// The function returns true (continue) on local errors, false (disconnect) on network errors
 	if !result {
 		t.Fatal("expected true for nonexistent file (continue connection)")
@@ -286,7 +286,7 @@ func TestHandleUploadGlobalBadFile(t *testing.T) {
 func TestHandleDownloadGlobalGetResponseError(t *testing.T) {
 	ml := &mockListener{getErr: bytes.ErrTooLarge}
 	tmpfile := t.TempDir() + "/out.txt"
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile)
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile, 0, false, false)
 	if result {
 		t.Fatal("expected false when get response fails")
 	}
@@ -307,7 +307,7 @@ func TestHandleUploadGlobalEmptyRemotePath(t *testing.T) {
 	}
 
 	// Test with empty remote path - should fail due to empty response
-	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "")
+	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "", "", false)
 	// Should fail (return false) because mock doesn't provide proper OK response
 	if result {
 		t.Error("expected false for upload without OK response")
@@ -326,7 +326,7 @@ func TestHandleUploadGlobalSendCommandError(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt")
+	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt", "", false)
 	if result {
 		t.Error("expected false when send command fails")
 	}
@@ -345,18 +345,45 @@ func TestHandleUploadGlobalMultipleErrors(t *testing.T) {
 		t.Fatalf("Failed to create test file: %v", err)
 	}
 
-	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt")
+	result := handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt", "", false)
 	if result {
 		t.Error("expected false when END_UPLOAD command fails")
 	}
 }
 
+func TestHandleUploadGlobalTransferID(t *testing.T) {
+	ml := &mockListener{
+		clients:   []string{"192.168.1.2:1234"},
+		responses: []string{"OK", "OK", "OK\n4\n"},
+	}
+	tmpfile := t.TempDir() + "/test.txt"
+	if err := os.WriteFile(tmpfile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if !handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt", "", false) {
+		t.Fatal("expected upload to succeed")
+	}
+	if len(ml.sentCommands) != 3 {
+		t.Fatalf("expected 3 frames, got %d: %v", len(ml.sentCommands), ml.sentCommands)
+	}
+	id := strings.Fields(ml.sentCommands[0])[1]
+	if !protocol.IsTransferID(id) {
+		t.Fatalf("START_UPLOAD carries no transfer ID: %q", ml.sentCommands[0])
+	}
+	for _, cmd := range ml.sentCommands {
+		if fields := strings.Fields(cmd); len(fields) < 3 || fields[1] != id {
+			t.Errorf("frame %q does not carry transfer ID %s", cmd, id)
+		}
+	}
+}
+
 func TestHandleDownloadGlobalInvalidRemotePath(t *testing.T) {
 	ml := &mockListener{clients: []string{"192.168.1.2:1234"}}
 	tmpfile := t.TempDir() + "/out.txt"
 
 	// Test with empty remote path
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "", tmpfile)
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "", tmpfile, 0, false, false)
 	// Should continue (true) as path validation doesn't fail the operation
 	if !result {
 		t.Error("expected true for download with empty remote path")
@@ -376,7 +403,7 @@ func TestHandleDownloadGlobalSuccessfulDownload(t *testing.T) {
 	}
 	tmpfile := t.TempDir() + "/downloaded.txt"
 
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile)
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile, 0, false, false)
 	if !result {
 		t.Error("expected true for successful download")
 	}
@@ -399,7 +426,7 @@ func TestHandleDownloadGlobalInvalidCompressedData(t *testing.T) {
 	}
 	tmpfile := t.TempDir() + "/out.txt"
 
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile)
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile, 0, false, false)
 	// Should continue (true) on decompression error
 	if !result {
 		t.Error("expected true even with invalid compressed data")
@@ -413,7 +440,7 @@ func TestHandleDownloadGlobalSendCommandFails(t *testing.T) {
 	}
 	tmpfile := t.TempDir() + "/out.txt"
 
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile)
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", tmpfile, 0, false, false)
 	if result {
 		t.Error("expected false when send command fails")
 	}
@@ -432,7 +459,7 @@ func TestHandleDownloadGlobalFileWriteError(t *testing.T) {
 	}
 
 	// Try to write to invalid path (directory that doesn't exist and can't be created)
-	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", "/nonexistent/dir/file.txt")
+	result := handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/file.txt", "/nonexistent/dir/file.txt", 0, false, false)
 	// Should continue (true) even if write fails
 	if !result {
 		t.Error("expected true even when file write fails")
@@ -441,7 +468,7 @@ func TestHandleDownloadGlobalFileWriteError(t *testing.T) {
 
 func TestListClientsEmptyList(t *testing.T) {
 	ml := &mockListener{clients: []string{}}
-	listClients(ml)
+	listClients(ml, false)
 	// Just verify it doesn't panic
 }
 
@@ -487,7 +514,7 @@ func TestListSocksEmpty(t *testing.T) {
 func TestListSocksWithOneProxy(t *testing.T) {
 	l := server.NewListener("0", "127.0.0.1", &tls.Config{}, "")
 	// Start a socks proxy on an ephemeral port
-	err := l.GetSocksManager().StartSocks("test-socks", "0", func(string) {})
+	err := l.GetSocksManager().StartSocks("test-socks", "0", false, func(string) {})
 	if err != nil {
 		t.Fatalf("failed to start socks proxy: %v", err)
 	}
@@ -566,3 +593,122 @@ func TestDrainPendingInputStopsAfterDraining(t *testing.T) {
 		t.Fatalf("expected SetReadDeadline to be called at least twice, got %d", m.setCalls)
 	}
 }
+
+// quarantineListener quarantines one client.
+type quarantineListener struct {
+	*mockListener
+	addr string
+}
+
+func (q *quarantineListener) Quarantined(clientAddr string) (string, bool) {
+	if clientAddr == q.addr {
+		return "21 malformed frames within 1m0s", true
+	}
+	return "", false
+}
+
+func TestListClientsShowsQuarantine(t *testing.T) {
+	l := &quarantineListener{mockListener: &mockListener{clients: []string{"1.2.3.4:1111", "5.6.7.8:2222"}}, addr: "5.6.7.8:2222"}
+	out := captureStdout(t, func() { listClients(l, false) })
+	if !strings.Contains(out, "5.6.7.8:2222 [no-id] ⚠ quarantined: 21 malformed frames") {
+		t.Errorf("expected quarantine note, got:\n%s", out)
+	}
+	if strings.Count(out, "quarantined") != 1 {
+		t.Errorf("expected only one client to be quarantined, got:\n%s", out)
+	}
+}
+
+// approvalListener holds one client pending approval.
+type approvalListener struct {
+	*mockListener
+	pending map[string]bool
+}
+
+func (a *approvalListener) PendingApproval(clientAddr string) bool { return a.pending[clientAddr] }
+
+func (a *approvalListener) Approve(clientAddr string) error {
+	delete(a.pending, clientAddr)
+	return nil
+}
+
+func TestApproveClient(t *testing.T) {
+	l := &approvalListener{
+		mockListener: &mockListener{clients: []string{"1.2.3.4:1111", "5.6.7.8:2222"}},
+		pending:      map[string]bool{"5.6.7.8:2222": true},
+	}
+	out := captureStdout(t, func() { listClients(l, false) })
+	if !strings.Contains(out, "5.6.7.8:2222 [no-id] ⏸ pending approval") || strings.Count(out, "pending approval") != 1 {
+		t.Errorf("expected one pending client, got:\n%s", out)
+	}
+	if requireApproved(l, "5.6.7.8:2222") {
+		t.Error("expected tunnels to be refused before approval")
+	}
+
+	out = captureStdout(t, func() { handleApprove(l, []string{"2"}) })
+	if !strings.Contains(out, "Approved 5.6.7.8:2222") || l.pending["5.6.7.8:2222"] {
+		t.Errorf("expected the client to be approved, got:\n%s", out)
+	}
+	out = captureStdout(t, func() { handleApprove(l, []string{"2"}) })
+	if !strings.Contains(out, "not pending approval") {
+		t.Errorf("expected a note for an approved client, got:\n%s", out)
+	}
+}
+
+// sandboxListener flags one client as a likely sandbox.
+type sandboxListener struct {
+	*mockListener
+	addr string
+}
+
+func (s *sandboxListener) SandboxFlags(clientAddr string) []string {
+	if clientAddr == s.addr {
+		return []string{"single CPU", "artifacts vbox-guest"}
+	}
+	return nil
+}
+
+func TestListClientsShowsSandboxFlags(t *testing.T) {
+	l := &sandboxListener{mockListener: &mockListener{clients: []string{"1.2.3.4:1111", "5.6.7.8:2222"}}, addr: "1.2.3.4:1111"}
+	out := captureStdout(t, func() { listClients(l, false) })
+	if !strings.Contains(out, "1.2.3.4:1111 [no-id] ⚠ likely sandbox: single CPU; artifacts vbox-guest") || strings.Count(out, "likely sandbox") != 1 {
+		t.Errorf("expected one flagged client, got:\n%s", out)
+	}
+}
+
+// endedListener is past its engagement end.
+type endedListener struct {
+	*mockListener
+}
+
+func (endedListener) EngagementEnd() time.Time { return time.Date(2025, 10, 31, 18, 0, 0, 0, time.UTC) }
+func (endedListener) EngagementOver() bool     { return true }
+
+func TestReplReadOnlyAfterEngagement(t *testing.T) {
+	l := endedListener{&mockListener{clients: []string{"1.2.3.4:1111"}}}
+	out := captureStdout(t, func() { dispatchCommand(l, []string{"shell", "1"}) })
+	if !strings.Contains(out, "engagement ended at 2025-10-31T18:00:00Z") {
+		t.Errorf("expected shell to be refused, got:\n%s", out)
+	}
+	out = captureStdout(t, func() { dispatchCommand(l, []string{"ls"}) })
+	if strings.Contains(out, "engagement ended") || !strings.Contains(out, "1.2.3.4:1111") {
+		t.Errorf("expected ls to work, got:\n%s", out)
+	}
+}
+
+func TestSplitRemotePath(t *testing.T) {
+	tests := []struct {
+		in, dir, base string
+	}{
+		{"", "", ""},
+		{"fo", "", "fo"},
+		{"/etc/pa", "/etc/", "pa"},
+		{"/etc/", "/etc/", ""},
+		{`C:\Users\Pu`, `C:\Users\`, "Pu"},
+	}
+	for _, tt := range tests {
+		dir, base := splitRemotePath(tt.in)
+		if dir != tt.dir || base != tt.base {
+			t.Errorf("splitRemotePath(%q) = (%q, %q), want (%q, %q)", tt.in, dir, base, tt.dir, tt.base)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// sessionMigrator is implemented by *server.Listener.
+type sessionMigrator interface {
+	MigrateSession(from, to string) (server.Migration, error)
+	Terminate(clientAddr string) error
+}
+
+// tunnelClients records which client each forward, pipe and SOCKS proxy
+// started from the console runs through, by ID, so migrate can move them.
+var tunnelClients = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+func setTunnelClient(id, clientAddr string) {
+	tunnelClients.Lock()
+	defer tunnelClients.Unlock()
+	tunnelClients.m[id] = clientAddr
+}
+
+func tunnelClient(id string) string {
+	tunnelClients.Lock()
+	defer tunnelClients.Unlock()
+	return tunnelClients.m[id]
+}
+
+func dropTunnelClient(id string) {
+	tunnelClients.Lock()
+	defer tunnelClients.Unlock()
+	delete(tunnelClients.m, id)
+}
+
+// handleMigrate moves a session's tags, scheduled jobs and tunnels to a
+// newer session on the same host, e.g. a gotsr instance started as another
+// user, and then retires the old session.
+func handleMigrate(l server.ListenerInterface, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: migrate <old_client_id> <new_client_id>")
+		return
+	}
+	migrator, ok := l.(sessionMigrator)
+	if !ok {
+		fmt.Println("Error: listener does not support migrating sessions")
+		return
+	}
+	from := getClientByID(l, args[0])
+	if from == "" {
+		return
+	}
+	to := getClientByID(l, args[1])
+	if to == "" {
+		return
+	}
+	if !requireApproved(l, to) {
+		return
+	}
+	m, err := migrator.MigrateSession(from, to)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	oldLabel, newLabel := clientLabel(l, from), clientLabel(l, to)
+	fmt.Printf("Migrating %s to %s:\n", oldLabel, newLabel)
+	if len(m.Tags) > 0 {
+		fmt.Printf("  tags: %s\n", strings.Join(m.Tags, ","))
+	}
+	for _, job := range m.Jobs {
+		fmt.Printf("  job %d: %s\n", job.ID, job.Description)
+	}
+	if listener, ok := l.(*server.Listener); ok {
+		migrateTunnels(l, listener, from, to)
+	}
+
+	if err := migrator.Terminate(from); err != nil {
+		fmt.Printf("Error retiring %s: %v\n", oldLabel, err)
+		return
+	}
+	if selectedClient == from {
+		selectedClient = to
+	}
+	fmt.Printf("✓ Retired %s\n", oldLabel)
+}
+
+// migrateTunnels restarts the forwards, pipes and SOCKS proxies running
+// through from on the same ports through to. Connections open through the
+// old session are closed; the old client holds their remote ends.
+func migrateTunnels(l server.ListenerInterface, listener *server.Listener, from, to string) {
+	meta, _ := l.GetClientMetadata(to)
+	fm := listener.GetForwardManager()
+	for _, fwd := range fm.ListForwards() {
+		if tunnelClient(fwd.ID) != from {
+			continue
+		}
+		if fwd.Reverse {
+			pipeName := strings.TrimPrefix(fwd.RemoteAddr, protocol.PipePrefix)
+			if !meta.Supports(protocol.CapPipe) {
+				fmt.Printf("  pipe %s: not supported by %s, left on the old session\n", fwd.ID, clientLabel(l, to))
+				continue
+			}
+			fm.StopForward(fwd.ID)
+			setTunnelClient(fwd.ID, to)
+			err := fm.StartReverseForward(fwd.ID, pipeName, fwd.LocalAddr, tunnelSender(l, fwd.ID))
+			if err == nil {
+				err = sendExpectOK(l, to, fmt.Sprintf("%s %s %s", protocol.CmdPipeListen, fwd.ID, pipeName))
+			}
+			reportTunnelMove("pipe", fwd.ID, fwd.RemoteAddr+" -> "+fwd.LocalAddr, err)
+			if err != nil {
+				fm.StopForward(fwd.ID)
+				dropTunnelClient(fwd.ID)
+			}
+			continue
+		}
+		if !meta.Supports(protocol.CapForward) {
+			fmt.Printf("  forward %s: not supported by %s, left on the old session\n", fwd.ID, clientLabel(l, to))
+			continue
+		}
+		_, port, _ := net.SplitHostPort(fwd.LocalAddr)
+		fm.StopForward(fwd.ID)
+		setTunnelClient(fwd.ID, to)
+		err := fm.StartForward(fwd.ID, port, fwd.RemoteAddr, tunnelSender(l, fwd.ID))
+		reportTunnelMove("forward", fwd.ID, fwd.LocalAddr+" -> "+fwd.RemoteAddr, err)
+		if err != nil {
+			dropTunnelClient(fwd.ID)
+		}
+	}
+
+	sm := listener.GetSocksManager()
+	for _, proxy := range sm.ListSocks() {
+		if tunnelClient(proxy.ID) != from {
+			continue
+		}
+		if !meta.Supports(protocol.CapSocks) {
+			fmt.Printf("  socks %s: not supported by %s, left on the old session\n", proxy.ID, clientLabel(l, to))
+			continue
+		}
+		_, port, _ := net.SplitHostPort(proxy.LocalAddr)
+		sm.StopSocks(proxy.ID)
+		setTunnelClient(proxy.ID, to)
+		err := sm.StartSocks(proxy.ID, port, meta.Announces(protocol.CapSocksErr), tunnelSender(l, proxy.ID))
+		reportTunnelMove("socks", proxy.ID, proxy.LocalAddr, err)
+		if err != nil {
+			dropTunnelClient(proxy.ID)
+		}
+	}
+}
+
+// tunnelSender returns the send function of a tunnel, which writes to the
+// client the tunnel currently runs through.
+func tunnelSender(l server.ListenerInterface, id string) func(string) {
+	return func(msg string) {
+		_ = l.SendCommand(tunnelClient(id), msg)
+	}
+}
+
+func reportTunnelMove(kind, id, desc string, err error) {
+	if err != nil {
+		fmt.Printf("  %s %s (%s): failed to restart: %v\n", kind, id, desc, err)
+		return
+	}
+	fmt.Printf("  %s %s: %s\n", kind, id, desc)
+}
+
+// handleRekeyed is told by the listener when a session came back on a new
+// address after reconnecting for new keys. The listener has moved its tags,
+// jobs and approval; this moves the tunnels and the `use` selection.
+func handleRekeyed(listener *server.Listener) func(from, to string) {
+	return func(from, to string) {
+		rekeyedClients.Lock()
+		rekeyedClients.m[from] = to
+		rekeyedClients.Unlock()
+		if !hasTunnels(from) {
+			return
+		}
+		fmt.Printf("Moving tunnels of %s to %s after a rekey:\n", from, clientLabel(listener, to))
+		migrateTunnels(listener, listener, from, to)
+	}
+}
+
+// hasTunnels reports whether any tunnel runs through clientAddr.
+func hasTunnels(clientAddr string) bool {
+	tunnelClients.Lock()
+	defer tunnelClients.Unlock()
+	for _, addr := range tunnelClients.m {
+		if addr == clientAddr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+type migratingListener struct {
+	*mockListener
+	migration  server.Migration
+	err        error
+	migrated   [2]string
+	terminated []string
+}
+
+func (m *migratingListener) MigrateSession(from, to string) (server.Migration, error) {
+	m.migrated = [2]string{from, to}
+	return m.migration, m.err
+}
+
+func (m *migratingListener) Terminate(clientAddr string) error {
+	m.terminated = append(m.terminated, clientAddr)
+	return nil
+}
+
+func TestHandleMigrate(t *testing.T) {
+	ml := &migratingListener{
+		mockListener: newRefListener(),
+		migration: server.Migration{
+			Tags: []string{"prod"},
+			Jobs: []server.Job{{ID: 3, Description: "download /etc/passwd -> loot/passwd"}},
+		},
+	}
+	selectedClient = "10.0.0.1:1000"
+	defer func() { selectedClient = "" }()
+
+	out := captureStdout(t, func() { handleMigrate(ml, []string{"1", "web2"}) })
+	if ml.migrated != [2]string{"10.0.0.1:1000", "10.0.0.2:2000"} {
+		t.Errorf("unexpected migration %v", ml.migrated)
+	}
+	for _, want := range []string{"tags: prod", "job 3: download /etc/passwd", "Retired"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output %q", want, out)
+		}
+	}
+	if len(ml.terminated) != 1 || ml.terminated[0] != "10.0.0.1:1000" {
+		t.Errorf("expected the old session to be retired, got %v", ml.terminated)
+	}
+	if selectedClient != "10.0.0.2:2000" {
+		t.Errorf("expected the selection to follow the migration, got %q", selectedClient)
+	}
+}
+
+func TestHandleMigrateRefused(t *testing.T) {
+	ml := &migratingListener{mockListener: newRefListener(), err: server.ErrDifferentHost}
+	out := captureStdout(t, func() { handleMigrate(ml, []string{"1", "3"}) })
+	if !strings.Contains(out, server.ErrDifferentHost.Error()) || len(ml.terminated) != 0 {
+		t.Errorf("expected the migration to be refused, got %q, terminated %v", out, ml.terminated)
+	}
+
+	out = captureStdout(t, func() { handleMigrate(ml, []string{"1"}) })
+	if !strings.Contains(out, "Usage: migrate") {
+		t.Errorf("expected usage, got %q", out)
+	}
+}
+
+type recordingSender struct {
+	*mockListener
+	sentTo []string
+}
+
+func (r *recordingSender) SendCommand(client, cmd string) error {
+	r.sentTo = append(r.sentTo, client)
+	return errors.New("not connected")
+}
+
+func TestTunnelSenderFollowsMigration(t *testing.T) {
+	rl := &recordingSender{mockListener: newRefListener()}
+	setTunnelClient("fwd-1", "10.0.0.1:1000")
+	defer dropTunnelClient("fwd-1")
+	send := tunnelSender(rl, "fwd-1")
+	send("FORWARD_START fwd-1 1 127.0.0.1:80\n")
+	setTunnelClient("fwd-1", "10.0.0.2:2000")
+	send("FORWARD_START fwd-1 2 127.0.0.1:80\n")
+	if len(rl.sentTo) != 2 || rl.sentTo[0] != "10.0.0.1:1000" || rl.sentTo[1] != "10.0.0.2:2000" {
+		t.Errorf("expected sends to follow the tunnel's client, got %v", rl.sentTo)
+	}
+}
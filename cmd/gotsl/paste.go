@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Bracketed paste: while a PTY shell is open the local terminal wraps pasted
+// text in pasteStart/pasteEnd, so a paste can be sent as one block instead of
+// line by line as keystrokes.
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteStart        = "\x1b[200~"
+	pasteEnd          = "\x1b[201~"
+	maxPasteSize      = 1 << 20 // Flushed early if the end marker never comes
+)
+
+// pasteConfirmSize is the paste size from which a PTY shell asks before
+// sending it; zero never asks.
+var pasteConfirmSize int
+
+// inputChunk is either keys the operator typed or one complete paste.
+type inputChunk struct {
+	data  []byte
+	paste bool
+}
+
+// pasteInput splits operator input into typed keys and pastes. A paste may
+// span several reads; it is returned once its end marker arrives.
+type pasteInput struct {
+	pasting bool
+	buf     []byte
+}
+
+func (p *pasteInput) feed(data []byte) []inputChunk {
+	var chunks []inputChunk
+	for len(data) > 0 {
+		if !p.pasting {
+			i := bytes.Index(data, []byte(pasteStart))
+			if i < 0 {
+				return append(chunks, inputChunk{data: data})
+			}
+			if i > 0 {
+				chunks = append(chunks, inputChunk{data: data[:i]})
+			}
+			p.pasting = true
+			data = data[i+len(pasteStart):]
+			continue
+		}
+
+		// The end marker may have been split across reads
+		from := max(len(p.buf)-len(pasteEnd)+1, 0)
+		p.buf = append(p.buf, data...)
+		data = nil
+		if i := bytes.Index(p.buf[from:], []byte(pasteEnd)); i >= 0 {
+			i += from
+			if i > 0 {
+				chunks = append(chunks, inputChunk{data: p.buf[:i], paste: true})
+			}
+			data = p.buf[i+len(pasteEnd):]
+			p.buf = nil
+			p.pasting = false
+		} else if len(p.buf) >= maxPasteSize {
+			chunks = append(chunks, inputChunk{data: p.buf, paste: true})
+			p.buf = nil
+		}
+	}
+	return chunks
+}
+
+// pasteOutput removes bracketed paste switches from remote output, so the
+// local terminal keeps marking pastes whatever the remote program does, and
+// remembers whether the remote program asked for pastes to be marked.
+type pasteOutput struct {
+	remote atomic.Bool
+	tail   []byte // A switch cut off at the end of the last chunk
+}
+
+func (p *pasteOutput) filter(data []byte) []byte {
+	if len(p.tail) > 0 {
+		data = append(p.tail, data...)
+		p.tail = nil
+	}
+	on, off := []byte(bracketedPasteOn), []byte(bracketedPasteOff)
+	if lastOn, lastOff := bytes.LastIndex(data, on), bytes.LastIndex(data, off); lastOn >= 0 || lastOff >= 0 {
+		p.remote.Store(lastOn > lastOff)
+		data = bytes.ReplaceAll(data, on, nil)
+		data = bytes.ReplaceAll(data, off, nil)
+	}
+	// Both switches share everything but the last byte
+	prefix := on[:len(on)-1]
+	for n := min(len(prefix), len(data)); n > 0; n-- {
+		if bytes.HasSuffix(data, prefix[:n]) {
+			p.tail = append([]byte(nil), data[len(data)-n:]...)
+			return data[:len(data)-n]
+		}
+	}
+	return data
+}
+
+// wrap prepares a paste for the remote PTY: programs that enabled bracketed
+// paste get the markers back, others get the plain text.
+func (p *pasteOutput) wrap(paste []byte) []byte {
+	if !p.remote.Load() {
+		return paste
+	}
+	return []byte(pasteStart + string(paste) + pasteEnd)
+}
+
+// confirmPaste asks the operator before sending a paste of pasteConfirmSize
+// bytes or more. The answer is read from the console directly, since the PTY
+// shell owns stdin; closing stop gives up and discards the paste.
+func confirmPaste(paste []byte, stop <-chan struct{}) bool {
+	if pasteConfirmSize <= 0 || len(paste) < pasteConfirmSize {
+		return true
+	}
+	text := bytes.TrimRight(paste, "\r\n")
+	lines := 1 + bytes.Count(text, []byte("\n")) + bytes.Count(text, []byte("\r")) - bytes.Count(text, []byte("\r\n"))
+	fmt.Printf("\r\n[gotsl] Send paste of %d lines (%d bytes)? [y/N] ", lines, len(paste))
+
+	buf := make([]byte, 16)
+	for {
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		n, err := readConsole(buf, 100*time.Millisecond)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil || n == 0 {
+			return false
+		}
+		if buf[0] == 'y' || buf[0] == 'Y' {
+			fmt.Print("y\r\n")
+			return true
+		}
+		fmt.Print("n\r\n[gotsl] Paste discarded\r\n")
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPasteInput(t *testing.T) {
+	var p pasteInput
+	var got []string
+	feed := func(s string) {
+		for _, c := range p.feed([]byte(s)) {
+			kind := "keys:"
+			if c.paste {
+				kind = "paste:"
+			}
+			got = append(got, kind+string(c.data))
+		}
+	}
+
+	feed("ls\r")
+	feed("x\x1b[200~echo one\rech")
+	feed("o two\r\x1b[20")
+	feed("1~y\x1b[A")
+	feed("\x1b[200~\x1b[201~\x1b[200~\x04\x1b[201~")
+
+	want := []string{"keys:ls\r", "keys:x", "paste:echo one\recho two\r", "keys:y\x1b[A", "paste:\x04"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks = %q, want %q", got, want)
+	}
+	if p.pasting {
+		t.Error("expected the paste to be complete")
+	}
+}
+
+func TestPasteOutput(t *testing.T) {
+	var p pasteOutput
+	if got := string(p.filter([]byte("$ \x1b[?2004h"))); got != "$ " {
+		t.Errorf("filter = %q", got)
+	}
+	if !p.remote.Load() {
+		t.Fatal("expected the remote program to want bracketed paste")
+	}
+	if got := string(p.wrap([]byte("ls\r"))); got != "\x1b[200~ls\r\x1b[201~" {
+		t.Errorf("wrap = %q", got)
+	}
+
+	// A switch split across chunks is still removed; other escapes pass
+	if got := string(p.filter([]byte("out\x1b[?20"))); got != "out" {
+		t.Errorf("filter = %q", got)
+	}
+	if got := string(p.filter([]byte("04l\x1b[0m"))); got != "\x1b[0m" {
+		t.Errorf("filter = %q", got)
+	}
+	if p.remote.Load() {
+		t.Error("expected bracketed paste to be off again")
+	}
+	if got := string(p.wrap([]byte("ls\r"))); got != "ls\r" {
+		t.Errorf("wrap = %q", got)
+	}
+}
+
+func TestConfirmPasteBelowThreshold(t *testing.T) {
+	defer func(n int) { pasteConfirmSize = n }(pasteConfirmSize)
+	pasteConfirmSize = 0
+	if !confirmPaste(make([]byte, 1<<16), nil) {
+		t.Error("expected pastes to go out when confirmation is off")
+	}
+	pasteConfirmSize = 100
+	if !confirmPaste([]byte("ls\r"), nil) {
+		t.Error("expected a small paste to go out without asking")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const patchUsage = "Usage: patch <client_id> <remote_path> --offset <n|0xN> --bytes <hex> [--expect <hex>]"
+
+// patchArgs are the parsed arguments of patch.
+type patchArgs struct {
+	offset   int64
+	bytes    []byte
+	expected []byte // Nil to patch whatever is there
+}
+
+// parsePatchArgs parses the flags of patch, which may come in any order.
+func parsePatchArgs(flags []string) (patchArgs, error) {
+	var p patchArgs
+	var haveOffset bool
+	for i := 0; i < len(flags); i += 2 {
+		if i+1 >= len(flags) {
+			return p, errors.New(patchUsage)
+		}
+		val := flags[i+1]
+		var err error
+		switch flags[i] {
+		case "--offset":
+			p.offset, err = strconv.ParseInt(val, 0, 64)
+			if err != nil || p.offset < 0 {
+				return p, fmt.Errorf("invalid offset %q", val)
+			}
+			haveOffset = true
+		case "--bytes":
+			if p.bytes, err = parseHexBytes(val); err != nil || len(p.bytes) == 0 {
+				return p, fmt.Errorf("invalid bytes %q", val)
+			}
+		case "--expect":
+			if p.expected, err = parseHexBytes(val); err != nil || len(p.expected) == 0 {
+				return p, fmt.Errorf("invalid expected bytes %q", val)
+			}
+		default:
+			return p, errors.New(patchUsage)
+		}
+	}
+	if !haveOffset || p.bytes == nil {
+		return p, errors.New(patchUsage)
+	}
+	if p.expected != nil && len(p.expected) != len(p.bytes) {
+		return p, fmt.Errorf("--expect has %d bytes, --bytes %d", len(p.expected), len(p.bytes))
+	}
+	return p, nil
+}
+
+// parseHexBytes reads hex digits, with an optional 0x prefix and colons
+// between bytes, e.g. 9090, 0x9090 or 90:90.
+func parseHexBytes(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+}
+
+// handlePatch overwrites a few bytes of a remote file in place. The client
+// checks the expected bytes, if given, and keeps a backup of the file next
+// to it, so small binary edits need no download and upload.
+func handlePatch(l server.ListenerInterface, args []string) {
+	if len(args) < 2 {
+		fmt.Println(patchUsage)
+		return
+	}
+	p, err := parsePatchArgs(args[2:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" {
+		return
+	}
+	if meta, _ := l.GetClientMetadata(clientAddr); !meta.Announces(protocol.CapPatch) {
+		fmt.Printf("Error: client %s does not support patch (update the client)\n", clientAddr)
+		return
+	}
+	path := args[1]
+	expected := "-"
+	if p.expected != nil {
+		expected = hex.EncodeToString(p.expected)
+	}
+	cmd := fmt.Sprintf("%s %d %s %s %s", protocol.CmdPatch, p.offset, hex.EncodeToString(p.bytes), expected, path)
+
+	runScheduled(l, clientAddr, []string{server.ResponseKey, server.PathKey(path)}, func() {
+		resp, err := queryClient(l, clientAddr, cmd, 30*time.Second)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), "\n")
+		if len(lines) != 3 || lines[0] != "OK" {
+			fmt.Println(strings.Join(lines, "\n"))
+			return
+		}
+		original, _ := hex.DecodeString(lines[2])
+		fmt.Printf("✓ Patched %d bytes at %#x in %s (backup: %s)\n", len(p.bytes), p.offset, path, lines[1])
+		fmt.Printf("  before: % x\n", original)
+		fmt.Printf("  after:  % x\n", p.bytes)
+	})
+}
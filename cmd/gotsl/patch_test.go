@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestParsePatchArgs(t *testing.T) {
+	p, err := parsePatchArgs([]string{"--bytes", "90:90", "--offset", "0x1A4", "--expect", "0x740e"})
+	if err != nil || p.offset != 0x1a4 || string(p.bytes) != "\x90\x90" || string(p.expected) != "\x74\x0e" {
+		t.Fatalf("unexpected %+v, %v", p, err)
+	}
+	for _, flags := range [][]string{
+		{"--offset", "4"},
+		{"--bytes", "90"},
+		{"--offset", "-1", "--bytes", "90"},
+		{"--offset", "4", "--bytes", "9"},
+		{"--offset", "4", "--bytes", "90", "--expect", "7400"},
+		{"--offset", "4", "--bytes"},
+		{"--offset", "4", "--bytes", "90", "--force", "x"},
+	} {
+		if _, err := parsePatchArgs(flags); err == nil {
+			t.Errorf("expected %q to be refused", flags)
+		}
+	}
+}
+
+func TestHandlePatch(t *testing.T) {
+	ml := newRefListener()
+	ml.metadata["10.0.0.1:1000"] = server.ClientMetadata{Hostname: "web1", Capabilities: []string{protocol.CapPeek, protocol.CapPatch}}
+	ml.responses = []string{
+		"OK\n/opt/app/bin.bak\n740e\n" + protocol.EndOfOutputMarker + "\n",
+		"Error: expected 740e at offset 0x1a4, found 9090; nothing changed\n" + protocol.EndOfOutputMarker + "\n",
+	}
+
+	out := captureStdout(t, func() {
+		handlePatch(ml, []string{"1", "/opt/app/bin", "--offset", "0x1a4", "--bytes", "9090"})
+	})
+	if len(ml.sentCommands) != 1 || ml.sentCommands[0] != protocol.CmdPatch+" 420 9090 - /opt/app/bin" {
+		t.Fatalf("unexpected commands %q", ml.sentCommands)
+	}
+	for _, want := range []string{"Patched 2 bytes at 0x1a4 in /opt/app/bin (backup: /opt/app/bin.bak)", "before: 74 0e", "after:  90 90"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+
+	out = captureStdout(t, func() {
+		handlePatch(ml, []string{"1", "/opt/app/bin", "--offset", "420", "--bytes", "9090", "--expect", "740e"})
+	})
+	if ml.sentCommands[1] != protocol.CmdPatch+" 420 9090 740e /opt/app/bin" || !strings.Contains(out, "nothing changed") {
+		t.Errorf("unexpected command %q, output %q", ml.sentCommands[1], out)
+	}
+
+	out = captureStdout(t, func() { handlePatch(ml, []string{"2", "/x", "--offset", "0", "--bytes", "00"}) })
+	if len(ml.sentCommands) != 2 || !strings.Contains(out, "does not support patch") {
+		t.Errorf("expected a client without PATCH to be refused, got %q", out)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// handlePipe serves a named pipe on a Windows client and relays each
+// program that opens it to targetAddr, dialed from the listener. It is the
+// reverse of forward with a pipe: target.
+func handlePipe(l server.ListenerInterface, clientAddr, pipeName, targetAddr string) {
+	listener, ok := l.(*server.Listener)
+	if !ok {
+		fmt.Println("Error: could not access forward manager")
+		return
+	}
+	if !requireCapability(l, clientAddr, protocol.CapPipe) || !requireApproved(l, clientAddr) {
+		return
+	}
+	fwdID := fmt.Sprintf("pipe-%d", time.Now().UnixNano())
+	setTunnelClient(fwdID, clientAddr)
+	fm := listener.GetForwardManager()
+	if err := fm.StartReverseForward(fwdID, pipeName, targetAddr, tunnelSender(l, fwdID)); err != nil {
+		dropTunnelClient(fwdID)
+		fmt.Printf("Failed to start pipe: %v\n", err)
+		return
+	}
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err := sendExpectOK(l, clientAddr, fmt.Sprintf("%s %s %s", protocol.CmdPipeListen, fwdID, pipeName)); err != nil {
+			fm.StopForward(fwdID)
+			dropTunnelClient(fwdID)
+			fmt.Printf("Failed to start pipe: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ Pipe started: %s on %s -> %s\n", pipeName, clientLabel(l, clientAddr), targetAddr)
+		fmt.Printf("  Forward ID: %s\n", fwdID)
+	})
+}
+
+// isPipeTarget reports whether a forward target names a named pipe.
+func isPipeTarget(target string) bool {
+	return strings.HasPrefix(target, protocol.PipePrefix)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestPipeTargetsRequireCapability(t *testing.T) {
+	ml := &mockListener{
+		clients:  []string{"10.0.0.1:1000"},
+		metadata: map[string]server.ClientMetadata{"10.0.0.1:1000": {Capabilities: []string{"exec", "forward"}}},
+	}
+	out := captureStdout(t, func() { dispatchCommand(ml, []string{"forward", "1", "4455", "pipe:spoolss"}) })
+	if !strings.Contains(out, "does not support pipe") {
+		t.Errorf("expected forward to a pipe to be refused, got %q", out)
+	}
+
+	out = captureStdout(t, func() { dispatchCommand(ml, []string{"pipe", "1", "spoolss"}) })
+	if !strings.Contains(out, "Usage: pipe") {
+		t.Errorf("expected usage, got %q", out)
+	}
+}
+
+func TestListForwardsShowsPipes(t *testing.T) {
+	l := server.NewListener("0", "127.0.0.1", &tls.Config{}, "")
+	fm := l.GetForwardManager()
+	if err := fm.StartReverseForward("pipe-1", "spoolss", "127.0.0.1:4455", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	defer fm.StopAll()
+
+	out := captureStdout(t, func() { listForwards(l) })
+	if !strings.Contains(out, "pipe:spoolss on client -> 127.0.0.1:4455 (ID: pipe-1)") {
+		t.Errorf("unexpected listing %q", out)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const (
+	fileSniffBytes     = 512 // Enough for http.DetectContentType and tar headers
+	defaultHeadBytes   = 1024
+	defaultHexdumpSize = 256
+)
+
+// peekRemote returns the size and up to n leading bytes of a remote file.
+func peekRemote(l server.ListenerInterface, clientAddr, path string, n int) (int64, []byte, error) {
+	resp, err := queryClient(l, clientAddr, fmt.Sprintf("%s %d %s", protocol.CmdPeek, n, path), 30*time.Second)
+	if err != nil {
+		return 0, nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), "\n")
+	if len(lines) < 2 || lines[0] != "OK" {
+		return 0, nil, errors.New(strings.Join(lines, " "))
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected peek response: %q", lines[1])
+	}
+	var data []byte
+	if len(lines) > 2 {
+		if data, err = hex.DecodeString(strings.TrimSpace(lines[2])); err != nil {
+			return 0, nil, fmt.Errorf("unexpected peek response: %w", err)
+		}
+	}
+	return size, data, nil
+}
+
+// fileSignature is a magic number that http.DetectContentType does not know
+// or describes too vaguely for an operator.
+type fileSignature struct {
+	offset int
+	magic  string
+	desc   string
+	mime   string
+}
+
+var fileSignatures = []fileSignature{
+	{0, "\x7fELF", "ELF executable", "application/x-executable"},
+	{0, "MZ", "PE/DOS executable", "application/vnd.microsoft.portable-executable"},
+	{0, "\xfe\xed\xfa\xce", "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xfe\xed\xfa\xcf", "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xcf\xfa\xed\xfe", "Mach-O executable", "application/x-mach-binary"},
+	{0, "\xca\xfe\xba\xbe", "Mach-O universal binary or Java class", "application/octet-stream"},
+	{0, "SQLite format 3\x00", "SQLite database", "application/vnd.sqlite3"},
+	{0, "\x03\xd9\xa2\x9a", "KeePass database", "application/octet-stream"},
+	{0, "regf", "Windows registry hive", "application/octet-stream"},
+	{0, "BZh", "bzip2 archive", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", "xz archive", "application/x-xz"},
+	{0, "7z\xbc\xaf\x27\x1c", "7-Zip archive", "application/x-7z-compressed"},
+	{0, "\x1f\x8b", "gzip archive", "application/gzip"},
+	{0, "PK\x03\x04", "ZIP archive (or JAR/Office document)", "application/zip"},
+	{257, "ustar", "tar archive", "application/x-tar"},
+}
+
+// detectFileType describes a file from its first bytes, returning a human
+// readable description and a MIME type.
+func detectFileType(data []byte) (desc, mime string) {
+	if len(data) == 0 {
+		return "empty", "inode/x-empty"
+	}
+	for _, sig := range fileSignatures {
+		if len(data) >= sig.offset+len(sig.magic) && string(data[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			return sig.desc, sig.mime
+		}
+	}
+	mime = http.DetectContentType(data)
+	if bytes.HasPrefix(data, []byte("#!")) {
+		line, _, _ := bytes.Cut(data, []byte("\n"))
+		return "script, " + strings.TrimSpace(string(line)), mime
+	}
+	if rest, ok := bytes.CutPrefix(data, []byte("-----BEGIN ")); ok {
+		if kind, _, ok := bytes.Cut(rest, []byte("-----")); ok {
+			return "PEM " + string(kind), "application/x-pem-file"
+		}
+	}
+	switch {
+	case strings.HasPrefix(mime, "text/plain"):
+		desc = "text"
+	case mime == "application/octet-stream":
+		desc = "data"
+	default:
+		desc, _, _ = strings.Cut(mime, ";")
+	}
+	return desc, mime
+}
+
+// isText reports whether data looks printable, allowing a multi-byte
+// character cut off at the end.
+func isText(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 {
+			return len(data) < utf8.UTFMax && !utf8.FullRune(data)
+		}
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != '\f' {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+// peekArgs parses "<client_id> <path> [n]" for head and hexdump.
+func peekArgs(l server.ListenerInterface, args []string, usage string, defaultN int) (string, string, int, bool) {
+	if len(args) != 2 && len(args) != 3 {
+		fmt.Println(usage)
+		return "", "", 0, false
+	}
+	n := defaultN
+	if len(args) == 3 {
+		v, err := strconv.Atoi(args[2])
+		if err != nil || v <= 0 {
+			fmt.Println(usage)
+			return "", "", 0, false
+		}
+		n = v
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" || !requireCapability(l, clientAddr, protocol.CapPeek) {
+		return "", "", 0, false
+	}
+	return clientAddr, args[1], n, true
+}
+
+// handleFile prints the type and size of a remote file.
+func handleFile(l server.ListenerInterface, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: file <client_id> <remote_path>")
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" || !requireCapability(l, clientAddr, protocol.CapPeek) {
+		return
+	}
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		size, data, err := peekRemote(l, clientAddr, args[1], fileSniffBytes)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		desc, mime := detectFileType(data)
+		fmt.Printf("%s: %s (%s), %d bytes\n", args[1], desc, mime, size)
+	})
+}
+
+// handleHead prints the first bytes of a remote file, as text if they look
+// printable and as a hex dump otherwise.
+func handleHead(l server.ListenerInterface, args []string, forceHex bool) {
+	usage, defaultN := "Usage: head <client_id> <remote_path> [bytes]", defaultHeadBytes
+	if forceHex {
+		usage, defaultN = "Usage: hexdump <client_id> <remote_path> [bytes]", defaultHexdumpSize
+	}
+	clientAddr, path, n, ok := peekArgs(l, args, usage, defaultN)
+	if !ok {
+		return
+	}
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		size, data, err := peekRemote(l, clientAddr, path, n)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if forceHex || !isText(data) {
+			fmt.Print(hex.Dump(data))
+		} else {
+			fmt.Print(string(data))
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				fmt.Println()
+			}
+		}
+		if int64(len(data)) < size {
+			fmt.Printf("-- %d of %d bytes shown --\n", len(data), size)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// replBusy is set while a REPL command runs. Readline is not reading stdin
+// then, so a password prompt can be answered inline.
+var replBusy atomic.Bool
+
+// secretSender is implemented by *server.Listener.
+type secretSender interface {
+	PendingPrompt(clientAddr string) (string, bool)
+	SendSecret(clientAddr, secret string) error
+	CancelPrompt(clientAddr string) error
+}
+
+// newPromptHandler returns the listener prompt handler. Prompts raised by a
+// REPL command are answered right away with masked input; others, e.g. from
+// control API requests, are announced so the operator can use `secret`.
+func newPromptHandler(l *server.Listener, out io.Writer) func(clientAddr, prompt string) {
+	return func(clientAddr, prompt string) {
+		if !replBusy.Load() {
+			fmt.Fprintf(out, "🔑 [%s] waiting for a password: %q (answer with: secret <client_id>, or secret <client_id> --cancel)\n", clientAddr, prompt)
+			return
+		}
+		secret, err := readPassword(fmt.Sprintf("🔑 [%s] %s ", clientAddr, prompt))
+		if err != nil || secret == "" {
+			_ = l.CancelPrompt(clientAddr)
+			return
+		}
+		if err := l.SendSecret(clientAddr, secret); err != nil {
+			fmt.Fprintf(out, "Error sending password: %v\n", err)
+		}
+	}
+}
+
+func handleSecret(l server.ListenerInterface, clientAddr string, args []string) {
+	sender, ok := l.(secretSender)
+	if !ok {
+		fmt.Println("Error: listener does not support password prompts")
+		return
+	}
+	if len(args) == 1 && args[0] == "--cancel" {
+		if err := sender.CancelPrompt(clientAddr); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+	if len(args) != 0 {
+		fmt.Println("Usage: secret <client_id> [--cancel]")
+		return
+	}
+
+	prompt, waiting := sender.PendingPrompt(clientAddr)
+	if !waiting {
+		fmt.Printf("Error: client %s is not waiting for a password\n", clientAddr)
+		return
+	}
+	secret, err := readPassword(prompt + " ")
+	if err != nil {
+		fmt.Printf("Error reading password: %v\n", err)
+		return
+	}
+	if err := sender.SendSecret(clientAddr, secret); err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/version"
+)
+
+const protocolUsage = "usage: gotsl protocol dump"
+
+// runProtocolCommand runs "gotsl protocol <subcommand>". dump prints the
+// protocol description as JSON, for external implementations and the web
+// UI to check themselves against.
+func runProtocolCommand(args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "dump" {
+		return errors.New(protocolUsage)
+	}
+	spec := protocol.Describe()
+	spec.Version = version.Version
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
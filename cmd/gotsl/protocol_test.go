@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestRunProtocolCommandDump(t *testing.T) {
+	var out bytes.Buffer
+	if err := runProtocolCommand([]string{"dump"}, &out); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	var spec protocol.Spec
+	if err := json.Unmarshal(out.Bytes(), &spec); err != nil {
+		t.Fatalf("dump is not JSON: %v\n%s", err, out.String())
+	}
+	if spec.Version == "" || len(spec.Commands) == 0 || len(spec.Capabilities) == 0 {
+		t.Fatalf("incomplete description: %+v", spec)
+	}
+	found := false
+	for _, e := range spec.Commands {
+		found = found || e.Name == "CmdIdent" && e.Value == protocol.CmdIdent
+	}
+	if !found {
+		t.Error("CmdIdent missing from the dump")
+	}
+}
+
+func TestRunProtocolCommandUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"load"}, {"dump", "x"}} {
+		if err := runProtocolCommand(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("expected a usage error for %v", args)
+		}
+	}
+}
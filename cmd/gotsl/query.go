@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// querier is implemented by *server.Listener.
+type querier interface {
+	Query(clientAddr, cmd string, timeout time.Duration) (string, bool, error)
+}
+
+// queryClient sends a built-in command and waits for its response, letting
+// the listener retry it once after a timeout if it is idempotent. A retry
+// is noted so the operator knows the first attempt went unanswered.
+func queryClient(l server.ListenerInterface, clientAddr, cmd string, timeout time.Duration) (string, error) {
+	q, ok := l.(querier)
+	if !ok {
+		if err := l.SendCommand(clientAddr, cmd); err != nil {
+			return "", err
+		}
+		return l.GetResponse(clientAddr, timeout)
+	}
+	resp, retried, err := q.Query(clientAddr, cmd, timeout)
+	if retried {
+		fmt.Printf("Note: %s got no response within %s and was retried once\n", strings.Fields(cmd)[0], timeout)
+	}
+	return resp, err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/replay"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// replaySession plays what the client sent in a recorded session through
+// the listener's parser and writes what the listener makes of it to out:
+// each response, prompts and warnings, and the client's identity.
+func replaySession(path string, out io.Writer) error {
+	frames, err := replay.Load(path)
+	if err != nil {
+		return err
+	}
+	secret := ""
+	if replay.Authenticated(frames) {
+		secret = replay.RedactedSecret
+	}
+	l := server.NewListener("0", "", nil, secret)
+	l.SetWarningHandler(func(_, msg string) {
+		fmt.Fprintf(out, "[warning] %s\n", msg)
+	})
+	l.SetPromptHandler(func(_, prompt string) {
+		fmt.Fprintf(out, "[prompt] %q\n", prompt)
+	})
+	player := replay.NewPlayer(frames, replay.FromClient, nil)
+	ln := replay.Listen(player)
+	go l.Serve(ln)
+	defer func() {
+		player.Close()
+		ln.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		l.Shutdown(ctx)
+	}()
+
+	clientAddr := player.RemoteAddr().String()
+	n := 0
+	printResponses := func(timeout time.Duration) bool {
+		resp, err := l.GetResponse(clientAddr, timeout)
+		if err != nil {
+			return false
+		}
+		n++
+		fmt.Fprintf(out, "[response %d]\n%s\n", n, strings.TrimRight(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""), "\n"))
+		return true
+	}
+	for {
+		select {
+		case <-player.Done():
+			// Everything was parsed; collect what is still queued
+			for printResponses(100 * time.Millisecond) {
+			}
+			meta, ok := l.GetClientMetadata(clientAddr)
+			if !ok || meta.Identifier == "" {
+				fmt.Fprintln(out, "[client] no IDENT in the recording")
+			} else {
+				fmt.Fprintf(out, "[client] %s host=%s os=%s caps=%s\n", meta.Identifier, meta.Hostname, meta.OS, strings.Join(meta.Capabilities, ","))
+			}
+			fmt.Fprintf(out, "Replayed %d frames, %d responses\n", len(frames), n)
+			return nil
+		default:
+			if !printResponses(50 * time.Millisecond) {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+}
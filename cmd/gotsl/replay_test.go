@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/replay"
+)
+
+func writeRecording(t *testing.T, frames []replay.Frame) string {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, f := range frames {
+		enc.Encode(f)
+	}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplaySessionParsesClientFrames(t *testing.T) {
+	path := writeRecording(t, []replay.Frame{
+		{From: replay.FromClient, Data: []byte("AUTH " + replay.RedactedSecret + "\n")},
+		{From: replay.FromListener, Data: []byte("AUTH_OK\n")},
+		{From: replay.FromClient, Data: []byte("IDENT abcd1234 os=linux host=demo\n")},
+		{From: replay.FromListener, Data: []byte("whoami\n")},
+		{From: replay.FromClient, Data: []byte("root\n" + protocol.EndOfOutputMarker + "\n")},
+	})
+	var out bytes.Buffer
+	if err := replaySession(path, &out); err != nil {
+		t.Fatalf("replaySession: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"[response 1]\nroot\n", "[client] abcd1234 host=demo os=linux", "Replayed 5 frames, 1 responses"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestReplaySessionMissingFile(t *testing.T) {
+	if err := replaySession(filepath.Join(t.TempDir(), "none.jsonl"), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for a missing recording")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// promptTemplate is the REPL prompt; set from the listener config.
+var promptTemplate = config.DefaultPromptTemplate
+
+// sessionPrivileges remembers what `elevate` reported for each session so
+// the prompt can show the user and a privilege badge.
+var sessionPrivileges = struct {
+	sync.Mutex
+	m map[string]privilegeReport
+}{m: make(map[string]privilegeReport)}
+
+func setSessionPrivileges(clientAddr string, report privilegeReport) {
+	sessionPrivileges.Lock()
+	defer sessionPrivileges.Unlock()
+	sessionPrivileges.m[clientAddr] = report
+}
+
+func sessionPrivilegesOf(clientAddr string) (privilegeReport, bool) {
+	sessionPrivileges.Lock()
+	defer sessionPrivileges.Unlock()
+	report, ok := sessionPrivileges.m[clientAddr]
+	return report, ok
+}
+
+func dropSessionPrivileges(clientAddr string) {
+	sessionPrivileges.Lock()
+	defer sessionPrivileges.Unlock()
+	delete(sessionPrivileges.m, clientAddr)
+}
+
+// promptFields returns the values of the prompt placeholders.
+func promptFields(l server.ListenerInterface) map[string]string {
+	fields := map[string]string{"clients": strconv.Itoa(len(l.GetClients()))}
+	if n := tunnelCount(l); n > 0 {
+		fields["tunnels"] = strconv.Itoa(n)
+	}
+	addr := currentClient(l)
+	if addr == "" {
+		return fields
+	}
+	meta, _ := l.GetClientMetadata(addr)
+	fields["id"] = l.GetClientIdentifier(addr)
+	if fields["id"] == "" {
+		fields["id"] = addr
+	}
+	fields["host"] = meta.Hostname
+	fields["userhost"] = meta.Hostname
+	if report, ok := sessionPrivilegesOf(addr); ok {
+		fields["user"] = report.User
+		fields["userhost"] = report.User + "@" + meta.Hostname
+		fields["priv"] = "$"
+		if report.Elevated {
+			fields["priv"] = "#"
+		}
+	}
+	return fields
+}
+
+// tunnelCount returns the number of active port forwards and SOCKS proxies.
+func tunnelCount(l server.ListenerInterface) int {
+	listener, ok := l.(*server.Listener)
+	if !ok {
+		return 0
+	}
+	return len(listener.GetForwardManager().ListForwards()) + len(listener.GetSocksManager().ListSocks())
+}
+
+// renderPrompt fills in a prompt template. A [segment] is dropped when it
+// contains placeholders and all of them are empty; unknown placeholders are
+// left as they are.
+func renderPrompt(tpl string, fields map[string]string) string {
+	var out strings.Builder
+	for tpl != "" {
+		open := strings.IndexByte(tpl, '[')
+		if open < 0 {
+			out.WriteString(expandPlaceholders(tpl, fields, new(bool), new(bool)))
+			break
+		}
+		end := strings.IndexByte(tpl[open:], ']')
+		if end < 0 {
+			out.WriteString(expandPlaceholders(tpl, fields, new(bool), new(bool)))
+			break
+		}
+		out.WriteString(expandPlaceholders(tpl[:open], fields, new(bool), new(bool)))
+		var any, set bool
+		segment := expandPlaceholders(tpl[open+1:open+end], fields, &any, &set)
+		if !any || set {
+			out.WriteString(segment)
+		}
+		tpl = tpl[open+end+1:]
+	}
+	return out.String()
+}
+
+// expandPlaceholders replaces {name} placeholders, recording whether any
+// known placeholder was seen and whether any had a value.
+func expandPlaceholders(s string, fields map[string]string, any, set *bool) string {
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			break
+		}
+		name := s[open+1 : open+end]
+		out.WriteString(s[:open])
+		if val, ok := fields[name]; ok || isPromptField(name) {
+			*any = true
+			*set = *set || val != ""
+			out.WriteString(val)
+		} else {
+			out.WriteString(s[open : open+end+1])
+		}
+		s = s[open+end+1:]
+	}
+	out.WriteString(s)
+	return out.String()
+}
+
+func isPromptField(name string) bool {
+	switch name {
+	case "id", "host", "user", "userhost", "priv", "tunnels", "clients":
+		return true
+	}
+	return false
+}
+
+// replPrompt is the REPL prompt for the current state.
+func replPrompt(l server.ListenerInterface) string {
+	return renderPrompt(promptTemplate, promptFields(l))
+}
+
+// coloredPrompt is replPrompt in green for readline; trailing spaces are
+// kept outside the color codes.
+func coloredPrompt(l server.ListenerInterface) string {
+	prompt := replPrompt(l)
+	text := strings.TrimRight(prompt, " ")
+	return "\033[32m" + text + "\033[0m" + prompt[len(text):]
+}
+
+// promptWantsPrivileges reports whether the prompt shows anything learned
+// from the whoami template.
+func promptWantsPrivileges() bool {
+	for _, name := range []string{"{user}", "{userhost}", "{priv}"} {
+		if strings.Contains(promptTemplate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// learnPrivileges runs the whoami template for a newly selected client if
+// the prompt needs it and nothing is known yet. Failures are ignored; the
+// prompt then shows the hostname only.
+func learnPrivileges(l server.ListenerInterface, clientAddr string) {
+	if _, ok := sessionPrivilegesOf(clientAddr); ok || !promptWantsPrivileges() {
+		return
+	}
+	out, err := runTemplate(l, clientAddr, config.TemplateWhoAmI)
+	if err != nil || strings.TrimSpace(out) == "" {
+		return
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+	report := parsePrivileges(meta.OS, out)
+	report.Method = "current session"
+	setSessionPrivileges(clientAddr, report)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	fields := map[string]string{"id": "e5f6a7b8", "host": "web2", "userhost": "www-data@web2", "priv": "$"}
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{config.DefaultPromptTemplate, "gotsl(e5f6a7b8 www-data@web2$)> "},
+		{"{userhost}{priv} ", "www-data@web2$ "},
+		{"gotsl[ tunnels:{tunnels}]> ", "gotsl> "},
+		{"[{user}@]{host}> ", "web2> "},
+		{"[literal] {unknown}> ", "literal {unknown}> "},
+		{"unclosed[{id}", "unclosed[e5f6a7b8"},
+	}
+	for _, tt := range tests {
+		if got := renderPrompt(tt.tpl, fields); got != tt.want {
+			t.Errorf("renderPrompt(%q) = %q, want %q", tt.tpl, got, tt.want)
+		}
+	}
+
+	fields["tunnels"] = "2"
+	if got := renderPrompt(config.DefaultPromptTemplate, fields); got != "gotsl(e5f6a7b8 www-data@web2$) tunnels:2> " {
+		t.Errorf("unexpected prompt with tunnels: %q", got)
+	}
+	if got := renderPrompt(config.DefaultPromptTemplate, map[string]string{}); got != "gotsl> " {
+		t.Errorf("unexpected prompt without a client: %q", got)
+	}
+}
+
+func TestReplPromptPrivilegeBadge(t *testing.T) {
+	ml := newRefListener()
+	defer func() { selectedClient = "" }()
+	selectedClient = "10.0.0.2:2000"
+	setSessionPrivileges(selectedClient, privilegeReport{User: "root", Level: "root", Elevated: true})
+	defer dropSessionPrivileges(selectedClient)
+
+	if got := replPrompt(ml); got != "gotsl(e5f6a7b8 root@web2#)> " {
+		t.Errorf("unexpected prompt %q", got)
+	}
+	setSessionPrivileges(selectedClient, privilegeReport{User: "alice", Level: "sudoer"})
+	if got := replPrompt(ml); got != "gotsl(e5f6a7b8 alice@web2$)> " {
+		t.Errorf("unexpected prompt %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const runAsUsage = "Usage: runas <client_id> <user> -- <command>"
+
+// handleRunAs runs a shell command on a client as another local user. The
+// client must run as root on Unix; Windows clients log the user on with its
+// password, always read with masked input so it stays out of the REPL
+// history, and need to run as SYSTEM. The account
+// the command ran as heads the output, and so the session recording.
+func handleRunAs(l server.ListenerInterface, args []string) {
+	sep := -1
+	for i, arg := range args {
+		if arg == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep != 2 || sep == len(args)-1 {
+		fmt.Println(runAsUsage)
+		return
+	}
+	user, password := args[1], ""
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" {
+		return
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+	if !meta.Announces(protocol.CapRunAs) {
+		fmt.Printf("Error: client %s does not support runas (update the client)\n", clientAddr)
+		return
+	}
+	if l.IsInPtyMode(clientAddr) {
+		fmt.Println("Error: client is in PTY mode")
+		return
+	}
+	if meta.OS == "windows" {
+		var err error
+		if password, err = readPassword(fmt.Sprintf("Password for %s: ", user)); err != nil {
+			fmt.Printf("Error reading password: %v\n", err)
+			return
+		}
+	}
+
+	out, err := runAsRemote(l, clientAddr, user, password, strings.Join(args[sep+1:], " "))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Print(out)
+}
+
+// runAsRemote sends RUNAS and returns the output headed by the account the
+// command ran as.
+func runAsRemote(l server.ListenerInterface, clientAddr, user, password, command string) (string, error) {
+	pw := "-"
+	if password != "" {
+		pw = hex.EncodeToString([]byte(password))
+	}
+	cmd := fmt.Sprintf("%s %s %s %s", protocol.CmdRunAs, hex.EncodeToString([]byte(user)), pw, hex.EncodeToString([]byte(command)))
+	var resp string
+	var err error
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err = l.SendCommand(clientAddr, cmd); err != nil {
+			return
+		}
+		resp, err = l.GetResponse(clientAddr, protocol.CommandTimeout*time.Second)
+	})
+	if err != nil {
+		return "", err
+	}
+	resp = strings.TrimSuffix(strings.TrimSuffix(resp, "\n"), protocol.EndOfOutputMarker)
+	status, output, _ := strings.Cut(resp, "\n")
+	account, ok := strings.CutPrefix(status, "OK ")
+	if !ok {
+		return "", errors.New(strings.TrimPrefix(strings.TrimSpace(resp), "Error: "))
+	}
+	return fmt.Sprintf("[runas %s]\n%s", account, output), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestHandleRunAs(t *testing.T) {
+	ml := newRefListener()
+	ml.metadata["10.0.0.1:1000"] = server.ClientMetadata{Hostname: "web1", OS: "linux", Capabilities: []string{protocol.CapExec, protocol.CapRunAs}}
+	ml.responses = []string{
+		"OK alice uid=1001 gid=1001\n1001\n" + protocol.EndOfOutputMarker + "\n",
+		"Error: runas bob: unknown user bob\n" + protocol.EndOfOutputMarker + "\n",
+	}
+
+	out := captureStdout(t, func() { handleRunAs(ml, []string{"1", "alice", "--", "id", "-u"}) })
+	want := protocol.CmdRunAs + " " + hex.EncodeToString([]byte("alice")) + " - " + hex.EncodeToString([]byte("id -u"))
+	if len(ml.sentCommands) != 1 || ml.sentCommands[0] != want {
+		t.Fatalf("sent %q, want %q", ml.sentCommands, want)
+	}
+	if out != "[runas alice uid=1001 gid=1001]\n1001\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	ml.metadata["10.0.0.1:1000"] = server.ClientMetadata{Hostname: "web1", OS: "windows", Capabilities: []string{protocol.CapExec, protocol.CapRunAs}}
+	defer func(orig func(string) (string, error)) { readPassword = orig }(readPassword)
+	var asked string
+	readPassword = func(prompt string) (string, error) {
+		asked = prompt
+		return "s3cret", nil
+	}
+	out = captureStdout(t, func() { handleRunAs(ml, []string{"1", "bob", "--", "whoami"}) })
+	if asked != "Password for bob: " {
+		t.Errorf("expected the password to be asked for, got prompt %q", asked)
+	}
+	if !strings.Contains(ml.sentCommands[1], " "+hex.EncodeToString([]byte("s3cret"))+" ") {
+		t.Errorf("expected the password to be sent, sent %q", ml.sentCommands[1])
+	}
+	if out != "Error: runas bob: unknown user bob\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	for _, args := range [][]string{{"1", "alice", "id"}, {"1", "--", "id"}, {"1", "alice", "--"}, {"1", "alice", "-p", "x", "--", "id"}, {"1", "alice", "--password", "x", "--", "id"}} {
+		if out := captureStdout(t, func() { handleRunAs(ml, args) }); !strings.HasPrefix(out, "Usage: runas") {
+			t.Errorf("expected usage for %q, got %q", args, out)
+		}
+	}
+	out = captureStdout(t, func() { handleRunAs(ml, []string{"2", "alice", "--", "id"}) })
+	if len(ml.sentCommands) != 2 || !strings.Contains(out, "does not support runas") {
+		t.Errorf("expected a client without RUNAS to be refused, got %q", out)
+	}
+}
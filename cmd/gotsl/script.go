@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// scriptCommands maps the REPL commands to SCRIPT languages.
+var scriptCommands = map[string]string{
+	"py":  "python",
+	"ps1": "powershell",
+}
+
+// handleScript runs a Python or PowerShell snippet on a client. The client
+// finds an interpreter and feeds it the snippet on stdin, so the code is not
+// quoted through the client's shell. "@file" sends a local script instead,
+// which keeps its line breaks and indentation.
+func handleScript(l server.ListenerInterface, command string, args []string) {
+	if len(args) < 2 {
+		fmt.Printf("Usage: %s <client_id> <code> | @<local_script>\n", command)
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" {
+		return
+	}
+	if meta, _ := l.GetClientMetadata(clientAddr); !meta.Announces(protocol.CapScript) {
+		fmt.Printf("Error: client %s does not support %s (update the client)\n", clientAddr, command)
+		return
+	}
+
+	var script []byte
+	if len(args) == 2 && strings.HasPrefix(args[1], "@") {
+		data, err := os.ReadFile(args[1][1:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		script = data
+	} else {
+		script = []byte(unquoteSnippet(strings.Join(args[1:], " ")) + "\n")
+	}
+
+	cmd := fmt.Sprintf("%s %s %s", protocol.CmdScript, scriptCommands[command], hex.EncodeToString(script))
+	var resp string
+	var err error
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err = l.SendCommand(clientAddr, cmd); err != nil {
+			return
+		}
+		resp, err = l.GetResponse(clientAddr, protocol.CommandTimeout*time.Second)
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	resp = strings.TrimSuffix(strings.TrimSuffix(resp, "\n"), protocol.EndOfOutputMarker)
+	status, output, _ := strings.Cut(resp, "\n")
+	interpreter, ok := strings.CutPrefix(status, "OK ")
+	if !ok {
+		fmt.Println(strings.TrimSpace(resp))
+		return
+	}
+	fmt.Printf("[%s]\n%s", interpreter, output)
+}
+
+// unquoteSnippet removes one pair of quotes around a snippet typed in the
+// REPL, e.g. py 1 'print(1+1)'.
+func unquoteSnippet(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
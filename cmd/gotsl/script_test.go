@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestHandleScript(t *testing.T) {
+	ml := newRefListener()
+	ml.metadata["10.0.0.1:1000"] = server.ClientMetadata{Hostname: "web1", Capabilities: []string{protocol.CapExec, protocol.CapScript}}
+	ml.responses = []string{"OK /usr/bin/python3\n2\n" + protocol.EndOfOutputMarker + "\n"}
+
+	out := captureStdout(t, func() { handleScript(ml, "py", []string{"1", "'print(1", "+", "1)'"}) })
+	want := protocol.CmdScript + " python " + hex.EncodeToString([]byte("print(1 + 1)\n"))
+	if len(ml.sentCommands) != 1 || ml.sentCommands[0] != want {
+		t.Fatalf("sent %q, want %q", ml.sentCommands, want)
+	}
+	if out != "[/usr/bin/python3]\n2\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	local := t.TempDir() + "/enum.ps1"
+	os.WriteFile(local, []byte("if ($true) {\n    Get-Date\n}\n"), 0644)
+	ml.responses = append(ml.responses, "Error: no powershell interpreter found (tried pwsh, powershell)\n"+protocol.EndOfOutputMarker+"\n")
+	out = captureStdout(t, func() { handleScript(ml, "ps1", []string{"1", "@" + local}) })
+	if !strings.HasSuffix(ml.sentCommands[1], hex.EncodeToString([]byte("if ($true) {\n    Get-Date\n}\n"))) {
+		t.Errorf("expected the local script to be sent unchanged, sent %q", ml.sentCommands[1])
+	}
+	if !strings.Contains(out, "no powershell interpreter found") {
+		t.Errorf("expected the client's error, got %q", out)
+	}
+
+	out = captureStdout(t, func() { handleScript(ml, "py", []string{"2", "print(1)"}) })
+	if len(ml.sentCommands) != 2 || !strings.Contains(out, "does not support py") {
+		t.Errorf("expected a client without SCRIPT to be refused, got %q", out)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// scrollbackKeeper is implemented by listeners that keep the recent PTY
+// output of each host.
+type scrollbackKeeper interface {
+	PtyScrollback(clientAddr string) (server.PtyScrollback, bool)
+}
+
+// scrollbackReplay returns the output kept from earlier shells on a client's
+// host, framed to be shown before a new shell starts, or nil if there is
+// none. It must be taken before the new shell starts writing.
+func scrollbackReplay(l server.ListenerInterface, clientAddr string) []byte {
+	keeper, ok := l.(scrollbackKeeper)
+	if !ok {
+		return nil
+	}
+	sb, ok := keeper.PtyScrollback(clientAddr)
+	if !ok {
+		return nil
+	}
+	var b bytes.Buffer
+	from := "this session"
+	if sb.Client != clientAddr {
+		from = "session " + sb.Client
+	}
+	fmt.Fprintf(&b, "--- Last output of the previous shell (%s, %s ago) ---\r\n", from, time.Since(sb.Updated).Round(time.Second))
+	b.Write(sb.Data)
+	// Undo colors and an alternate screen the old output may have left on
+	b.WriteString("\x1b[0m\x1b[?1049l\r\n--- New shell ---\r\n")
+	return b.Bytes()
+}
+
+// ptyEndedMessage tells the operator why a PTY shell's output stopped.
+func ptyEndedMessage(l server.ListenerInterface, clientAddr string) string {
+	if slices.Contains(l.GetClients(), clientAddr) {
+		return "[Remote shell exited]"
+	}
+	if _, ok := l.(scrollbackKeeper); ok {
+		return "[Connection to the client lost; its last output is shown when you open a shell on the host again]"
+	}
+	return "[Connection to the client lost]"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// scrollbackListener keeps PTY output like server.Listener.
+type scrollbackListener struct {
+	*mockListener
+	scrollback map[string]server.PtyScrollback
+}
+
+func (s *scrollbackListener) PtyScrollback(clientAddr string) (server.PtyScrollback, bool) {
+	sb, ok := s.scrollback[clientAddr]
+	return sb, ok
+}
+
+func TestScrollbackReplay(t *testing.T) {
+	l := &scrollbackListener{mockListener: newRefListener(), scrollback: map[string]server.PtyScrollback{
+		"10.0.0.1:1000": {Data: []byte("$ id\r\nuid=0\r\n"), Client: "10.0.0.9:9000", Updated: time.Now().Add(-time.Minute)},
+	}}
+
+	replay := string(scrollbackReplay(l, "10.0.0.1:1000"))
+	for _, want := range []string{"session 10.0.0.9:9000, 1m0s ago", "uid=0\r\n", "--- New shell ---"} {
+		if !strings.Contains(replay, want) {
+			t.Errorf("expected %q in %q", want, replay)
+		}
+	}
+	if scrollbackReplay(l, "10.0.0.2:2000") != nil {
+		t.Error("expected nothing to replay for a host without output")
+	}
+	if scrollbackReplay(newRefListener(), "10.0.0.1:1000") != nil {
+		t.Error("expected nothing to replay from a listener without scrollback")
+	}
+
+	if msg := ptyEndedMessage(l, "10.0.0.1:1000"); msg != "[Remote shell exited]" {
+		t.Errorf("unexpected message for a connected client: %s", msg)
+	}
+	if msg := ptyEndedMessage(l, "10.0.0.9:9000"); !strings.Contains(msg, "lost") {
+		t.Errorf("unexpected message for a lost client: %s", msg)
+	}
+}
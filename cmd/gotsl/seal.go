@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+// sealPassphraseEnv names the variable holding the passphrase for
+// --seal-client-config, which keeps it out of the shell history.
+const sealPassphraseEnv = "GOTS_SEAL_PASSPHRASE"
+
+// sealClientConfigFile reads a JSON client config and returns it sealed for
+// embedding in gotsr.
+func sealClientConfigFile(path, passphrase string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client config: %w", err)
+	}
+	cfg := config.DefaultClientConfig()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return "", fmt.Errorf("failed to parse client config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", fmt.Errorf("client config %s: %w", path, err)
+	}
+	return config.SealClientConfig(cfg, passphrase)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const (
+	// deleteFlag makes sync remove files missing from the source.
+	deleteFlag = "--delete"
+	// pullFlag makes sync mirror the remote directory locally.
+	pullFlag = "--pull"
+)
+
+// syncEntry is a file or directory in a tree being synced, keyed by its
+// slash-separated path relative to the tree's root.
+type syncEntry struct {
+	dir  bool
+	size int64
+	sum  string // Hex SHA-256 of a file
+}
+
+// syncSummary counts what a sync did.
+type syncSummary struct {
+	created, updated, removed, unchanged, skipped int
+}
+
+func (s syncSummary) String() string {
+	out := fmt.Sprintf("%d created, %d updated, %d removed, %d unchanged", s.created, s.updated, s.removed, s.unchanged)
+	if s.skipped > 0 {
+		out += fmt.Sprintf(", %d skipped", s.skipped)
+	}
+	return out
+}
+
+// parseWalk reads a WALK reply. Paths that could escape the tree, which
+// only a misbehaving client sends, are rejected.
+func parseWalk(resp string) (map[string]syncEntry, error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "OK" {
+		return nil, errors.New(strings.TrimSpace(strings.Join(lines, " ")))
+	}
+	tree := make(map[string]syncEntry, len(lines)-1)
+	for _, line := range lines[1:] {
+		var rel string
+		var entry syncEntry
+		switch {
+		case strings.HasPrefix(line, "d "):
+			rel, entry.dir = line[2:], true
+		case strings.HasPrefix(line, "f "):
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("malformed listing entry %q", line)
+			}
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("malformed listing entry %q", line)
+			}
+			rel, entry.size, entry.sum = fields[3], size, fields[2]
+		default:
+			return nil, fmt.Errorf("malformed listing entry %q", line)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(rel)) || strings.Contains(rel, `\`) {
+			return nil, fmt.Errorf("unsafe path %q in listing", rel)
+		}
+		tree[rel] = entry
+	}
+	return tree, nil
+}
+
+// walkRemote lists the tree under a client's directory.
+func walkRemote(l server.ListenerInterface, clientAddr, dir string) (map[string]syncEntry, error) {
+	if err := l.SendCommand(clientAddr, protocol.CmdWalk+" "+dir); err != nil {
+		return nil, err
+	}
+	resp, err := l.GetResponse(clientAddr, time.Duration(protocol.CommandTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return parseWalk(resp)
+}
+
+// walkLocal lists the tree under a local directory the way WALK does. A
+// missing directory is an empty tree.
+func walkLocal(dir string) (map[string]syncEntry, error) {
+	tree := make(map[string]syncEntry)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if path == dir {
+			if !d.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			tree[rel] = syncEntry{dir: true}
+		case d.Type().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			n, err := io.Copy(h, f)
+			if err != nil {
+				return err
+			}
+			tree[rel] = syncEntry{size: n, sum: hex.EncodeToString(h.Sum(nil))}
+		}
+		return nil
+	})
+	return tree, err
+}
+
+// remoteJoin appends a slash-separated relative path to a remote directory.
+// Clients on Windows accept forward slashes too.
+func remoteJoin(dir, rel string) string {
+	return strings.TrimRight(dir, `/\`) + "/" + rel
+}
+
+// sortedPaths returns the paths of a tree so that directories come before
+// their contents, or after them when reversed for removal.
+func sortedPaths(tree map[string]syncEntry, reverse bool) []string {
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	} else {
+		sort.Strings(paths)
+	}
+	return paths
+}
+
+// sendExpectOK sends a command that the client answers with a bare OK, such
+// as MKDIR or REMOVE, and returns the client's error otherwise.
+func sendExpectOK(l server.ListenerInterface, clientAddr, command string) error {
+	if err := l.SendCommand(clientAddr, command); err != nil {
+		return err
+	}
+	resp, err := l.GetResponse(clientAddr, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	if clean := strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")); clean != "OK" {
+		return errors.New(strings.TrimPrefix(clean, "Error: "))
+	}
+	return nil
+}
+
+// syncPush mirrors localDir to remoteDir on the client. Changed files are
+// uploaded as deltas where that pays off. It returns false if the
+// connection failed.
+func syncPush(l server.ListenerInterface, clientAddr, localDir, remoteDir string, del bool) (syncSummary, bool) {
+	var result syncSummary
+	local, err := walkLocal(localDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return result, true
+	}
+	if err := sendExpectOK(l, clientAddr, protocol.CmdMkdir+" "+remoteDir); err != nil {
+		fmt.Printf("Error creating %s: %v\n", remoteDir, err)
+		return result, true
+	}
+	remote, err := walkRemote(l, clientAddr, remoteDir)
+	if err != nil {
+		fmt.Printf("Error listing %s: %v\n", remoteDir, err)
+		return result, true
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+
+	for _, rel := range sortedPaths(local, false) {
+		src, dst := local[rel], remote[rel]
+		_, exists := remote[rel]
+		target := remoteJoin(remoteDir, rel)
+		switch {
+		case exists && src.dir != dst.dir:
+			fmt.Printf("  ! %s: a %s on one side and a %s on the other, skipped\n", rel, kindName(src.dir), kindName(dst.dir))
+			result.skipped++
+		case src.dir && exists, !src.dir && exists && src.sum == dst.sum:
+			if !src.dir {
+				result.unchanged++
+			}
+		case src.dir:
+			fmt.Printf("  + %s/\n", rel)
+			if err := sendExpectOK(l, clientAddr, protocol.CmdMkdir+" "+target); err != nil {
+				fmt.Printf("Error creating %s: %v\n", target, err)
+				result.skipped++
+				continue
+			}
+			result.created++
+		case meta.CheckTransfer(src.size) != nil:
+			fmt.Printf("  ! %s: %d bytes exceeds the client's transfer limit, skipped\n", rel, src.size)
+			result.skipped++
+		default:
+			if exists {
+				fmt.Printf("  ~ %s\n", rel)
+				result.updated++
+			} else {
+				fmt.Printf("  + %s\n", rel)
+				result.created++
+			}
+			if !handleUploadGlobal(l, clientAddr, filepath.Join(localDir, filepath.FromSlash(rel)), target, protocol.OverwriteAlways, false) {
+				return result, false
+			}
+		}
+	}
+
+	if del {
+		for _, rel := range sortedPaths(remote, true) {
+			if _, ok := local[rel]; ok {
+				continue
+			}
+			fmt.Printf("  - %s\n", rel)
+			if err := sendExpectOK(l, clientAddr, protocol.CmdRemove+" "+remoteJoin(remoteDir, rel)); err != nil {
+				fmt.Printf("Error removing %s: %v\n", rel, err)
+				result.skipped++
+				continue
+			}
+			result.removed++
+		}
+	}
+	return result, true
+}
+
+// syncPull mirrors remoteDir on the client to localDir. Files over the
+// download size limit are skipped. It returns false if the connection
+// failed.
+func syncPull(l server.ListenerInterface, clientAddr, remoteDir, localDir string, del bool) (syncSummary, bool) {
+	var result syncSummary
+	remote, err := walkRemote(l, clientAddr, remoteDir)
+	if err != nil {
+		fmt.Printf("Error listing %s: %v\n", remoteDir, err)
+		return result, true
+	}
+	local, err := walkLocal(localDir)
+	if err == nil {
+		err = os.MkdirAll(localDir, 0o755)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return result, true
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+
+	for _, rel := range sortedPaths(remote, false) {
+		src, dst := remote[rel], local[rel]
+		_, exists := local[rel]
+		target := filepath.Join(localDir, filepath.FromSlash(rel))
+		switch {
+		case exists && src.dir != dst.dir:
+			fmt.Printf("  ! %s: a %s on one side and a %s on the other, skipped\n", rel, kindName(src.dir), kindName(dst.dir))
+			result.skipped++
+		case src.dir && exists, !src.dir && exists && src.sum == dst.sum:
+			if !src.dir {
+				result.unchanged++
+			}
+		case src.dir:
+			fmt.Printf("  + %s/\n", rel)
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				result.skipped++
+				continue
+			}
+			result.created++
+		case maxDownloadSize > 0 && src.size > maxDownloadSize:
+			fmt.Printf("  ! %s: %d bytes exceeds the download limit, skipped\n", rel, src.size)
+			result.skipped++
+		case meta.CheckTransfer(src.size) != nil:
+			fmt.Printf("  ! %s: %d bytes exceeds the client's transfer limit, skipped\n", rel, src.size)
+			result.skipped++
+		default:
+			if exists {
+				fmt.Printf("  ~ %s\n", rel)
+				result.updated++
+			} else {
+				fmt.Printf("  + %s\n", rel)
+				result.created++
+			}
+			if !handleDownloadGlobal(l, clientAddr, remoteJoin(remoteDir, rel), target, 0, false, false) {
+				return result, false
+			}
+		}
+	}
+
+	if del {
+		for _, rel := range sortedPaths(local, true) {
+			if _, ok := remote[rel]; ok {
+				continue
+			}
+			fmt.Printf("  - %s\n", rel)
+			if err := os.Remove(filepath.Join(localDir, filepath.FromSlash(rel))); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				result.skipped++
+				continue
+			}
+			result.removed++
+		}
+	}
+	return result, true
+}
+
+func kindName(dir bool) string {
+	if dir {
+		return "directory"
+	}
+	return "file"
+}
+
+// handleSync mirrors a directory tree between the listener and a client and
+// prints what changed.
+func handleSync(l server.ListenerInterface, clientAddr, localDir, remoteDir string, pull, del bool) bool {
+	if !requireCapability(l, clientAddr, protocol.CapSync) {
+		return true
+	}
+	var result syncSummary
+	var ok bool
+	if pull {
+		fmt.Printf("Syncing %s:%s -> %s\n", clientLabel(l, clientAddr), remoteDir, localDir)
+		result, ok = syncPull(l, clientAddr, remoteDir, localDir, del)
+	} else {
+		fmt.Printf("Syncing %s -> %s:%s\n", localDir, clientLabel(l, clientAddr), remoteDir)
+		result, ok = syncPush(l, clientAddr, localDir, remoteDir, del)
+	}
+	fmt.Printf("Sync finished: %s\n", result)
+	return ok
+}
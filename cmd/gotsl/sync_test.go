@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseWalkRejectsUnsafePaths(t *testing.T) {
+	tree, err := parseWalk("OK\nd etc\nf 3 " + sha256Hex("abc") + " etc/app conf\n" + protocol.EndOfOutputMarker)
+	if err != nil || len(tree) != 2 || tree["etc/app conf"].size != 3 || !tree["etc"].dir {
+		t.Fatalf("unexpected tree %v: %v", tree, err)
+	}
+	for _, bad := range []string{"d ../up", "f 1 00 /etc/passwd", `d a\..\..\b`, "x what"} {
+		if _, err := parseWalk("OK\n" + bad + "\n"); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := parseWalk("Error walking directory: no such file\n"); err == nil {
+		t.Error("expected an error reply to be returned")
+	}
+}
+
+func TestSyncPush(t *testing.T) {
+	local := t.TempDir()
+	os.WriteFile(filepath.Join(local, "a.txt"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(local, "b.txt"), []byte("new"), 0644)
+	os.Mkdir(filepath.Join(local, "sub"), 0755)
+
+	ml := newRefListener()
+	walk := "OK\nf 4 " + sha256Hex("same") + " a.txt\nf 3 " + sha256Hex("old") + " c.txt\n"
+	ml.responses = []string{"OK", walk, "OK", "OK", "OK\n", "OK", "OK"}
+	out := captureStdout(t, func() {
+		if !handleSync(ml, "10.0.0.1:1000", local, "/srv/app/", false, true) {
+			t.Error("expected sync to succeed")
+		}
+	})
+
+	want := []string{"MKDIR /srv/app/", "WALK /srv/app/", "START_UPLOAD", "UPLOAD_CHUNK", "END_UPLOAD", "MKDIR /srv/app/sub", "REMOVE /srv/app/c.txt"}
+	if len(ml.sentCommands) != len(want) {
+		t.Fatalf("unexpected commands %q", ml.sentCommands)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(ml.sentCommands[i], w) {
+			t.Errorf("command %d = %q, want %q", i, ml.sentCommands[i], w)
+		}
+	}
+	if !strings.Contains(ml.sentCommands[2], " /srv/app/b.txt ") {
+		t.Errorf("unexpected upload %q", ml.sentCommands[2])
+	}
+	if !strings.Contains(out, "Sync finished: 2 created, 0 updated, 1 removed, 1 unchanged") {
+		t.Errorf("unexpected summary in %q", out)
+	}
+}
+
+func TestSyncPull(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "mirror")
+	os.MkdirAll(local, 0755)
+	os.WriteFile(filepath.Join(local, "stale.txt"), []byte("x"), 0644)
+	compressed, _ := compression.CompressToHex([]byte("remote"))
+
+	ml := newRefListener()
+	walk := "OK\nd conf\nf 6 " + sha256Hex("remote") + " conf/app.ini\n"
+	ml.responses = []string{walk, protocol.DataPrefix + compressed + "\n" + protocol.EndOfOutputMarker}
+	out := captureStdout(t, func() { handleSync(ml, "10.0.0.1:1000", local, `C:\app`, true, true) })
+
+	if ml.sentCommands[1] != protocol.CmdDownload+" C:\\app/conf/app.ini" {
+		t.Errorf("unexpected download %q", ml.sentCommands[1])
+	}
+	if data, _ := os.ReadFile(filepath.Join(local, "conf", "app.ini")); string(data) != "remote" {
+		t.Errorf("expected the remote file locally, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(local, "stale.txt")); !os.IsNotExist(err) {
+		t.Error("expected --delete to remove the stale local file")
+	}
+	if !strings.Contains(out, "Sync finished: 2 created, 0 updated, 1 removed, 0 unchanged") {
+		t.Errorf("unexpected summary in %q", out)
+	}
+}
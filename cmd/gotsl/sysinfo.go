@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// fetchSysinfo asks a client for its resource usage and returns the
+// key=value pairs of the reply.
+func fetchSysinfo(l server.ListenerInterface, clientAddr string) (map[string]string, error) {
+	resp, err := queryClient(l, clientAddr, protocol.CmdSysinfo, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return server.ParseSysinfo(resp)
+}
+
+// formatBytes renders a byte count from SYSINFO in binary units.
+func formatBytes(v string) string {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return v
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatLimit renders a SYSINFO limit, where zero means none.
+func formatLimit(v, suffix string) string {
+	if v == "" || v == "0" {
+		return "none"
+	}
+	return formatBytes(v) + suffix
+}
+
+// handleSysinfo prints a client's resource usage next to its limits.
+func handleSysinfo(l server.ListenerInterface, clientAddr string) {
+	if !requireCapability(l, clientAddr, protocol.CapSysinfo) {
+		return
+	}
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		info, err := fetchSysinfo(l, clientAddr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Resource usage of %s (pid %s, %s):\n", clientLabel(l, clientAddr), info["pid"], info["platform"])
+		if info["cpu_user"] != "" {
+			fmt.Printf("  CPU:        %s user, %s system\n", info["cpu_user"], info["cpu_system"])
+		}
+		nice := info["nice"]
+		if nice == "" || nice == "0" {
+			nice = "normal"
+		}
+		fmt.Printf("  Priority:   %s\n", nice)
+		fmt.Printf("  Memory:     %s (limit %s)\n", formatBytes(info["memory"]), formatLimit(info["memory_limit"], ""))
+		fmt.Printf("  Network:    %s sent, %s received (limit %s)\n", formatBytes(info["net_sent"]), formatBytes(info["net_received"]), formatLimit(info["bandwidth_limit"], "/s"))
+		fmt.Printf("  Goroutines: %s, uploads in progress: %s\n", info["goroutines"], info["uploads"])
+		if info["cpus"] != "" {
+			host := info["cpus"] + " CPUs"
+			if secs, err := strconv.ParseInt(info["uptime"], 10, 64); err == nil {
+				host += fmt.Sprintf(", up %s", time.Duration(secs)*time.Second)
+			}
+			fmt.Printf("  Host:       %s\n", host)
+		}
+		if info["artifacts"] != "" {
+			fmt.Printf("  Sandbox:    %s\n", info["artifacts"])
+		}
+		if info["sha256"] != "" {
+			fmt.Printf("  Binary:     sha256 %s\n", info["sha256"])
+		}
+		if info["scrubbed"] == "false" {
+			fmt.Println("  Arguments:  visible to other processes (command line not scrubbed)")
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHandleSysinfo(t *testing.T) {
+	ml := newRefListener()
+	ml.responses = []string{"OK\npid=42\nplatform=linux/amd64\ngoroutines=9\nnice=19\nmemory=8912896\nmemory_limit=67108864\n" +
+		"net_sent=1536\nnet_received=0\nbandwidth_limit=0\nuploads=0\ncpu_user=1.5s\ncpu_system=250ms\n<<<END_OF_OUTPUT>>>\n"}
+	out := captureStdout(t, func() { handleSysinfo(ml, "10.0.0.1:1000") })
+	if len(ml.sentCommands) != 1 || ml.sentCommands[0] != "SYSINFO" {
+		t.Fatalf("unexpected commands %q", ml.sentCommands)
+	}
+	for _, want := range []string{"a1b2c3d4@web1 (pid 42, linux/amd64)", "1.5s user, 250ms system", "Priority:   19",
+		"8.5 MiB (limit 64.0 MiB)", "1.5 KiB sent, 0 B received (limit none)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for in, want := range map[string]string{"0": "0 B", "1023": "1023 B", "1024": "1.0 KiB", "1073741824": "1.0 GiB", "x": "x"} {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%s) = %q, want %q", in, got, want)
+		}
+	}
+}
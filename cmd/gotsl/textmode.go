@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// textFlag makes upload and download convert line endings for the
+// receiving side.
+const textFlag = "--text"
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// usesCRLF reports whether text files on an OS, as reported in IDENT or by
+// runtime.GOOS, end lines with CRLF.
+func usesCRLF(osName string) bool {
+	return osName == "windows"
+}
+
+// lineEndingName names the line ending a conversion produces.
+func lineEndingName(crlf bool) string {
+	if crlf {
+		return "CRLF"
+	}
+	return "LF"
+}
+
+// convertText rewrites the line endings of a text file to CRLF or LF,
+// keeping any byte order mark. UTF-8 and, with a BOM, UTF-16 are handled;
+// anything else containing NUL bytes is refused as binary. It returns the
+// number of line endings changed. Lone CRs are left alone.
+func convertText(data []byte, crlf bool) ([]byte, int, error) {
+	var order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	switch {
+	case bytes.HasPrefix(data, bomUTF16LE):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, bomUTF16BE):
+		order = binary.BigEndian
+	default:
+		if bytes.IndexByte(data, 0) >= 0 {
+			return nil, 0, errors.New("not a text file (contains NUL bytes); transfer it without " + textFlag)
+		}
+		body, bom := data, []byte(nil)
+		if bytes.HasPrefix(data, bomUTF8) {
+			body, bom = data[len(bomUTF8):], bomUTF8
+		}
+		converted, changed := convertLineEndings(body, crlf)
+		return append(append([]byte(nil), bom...), converted...), changed, nil
+	}
+
+	if len(data)%2 != 0 {
+		return nil, 0, errors.New("malformed UTF-16 text: odd length")
+	}
+	units := make([]uint16, (len(data)-2)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2+2*i:])
+	}
+	converted, changed := convertLineEndings(units, crlf)
+	out := make([]byte, 2, 2+2*len(converted))
+	copy(out, data[:2])
+	for _, u := range converted {
+		out = order.AppendUint16(out, u)
+	}
+	return out, changed, nil
+}
+
+// convertLineEndings works on bytes of UTF-8 text or code units of UTF-16
+// text; CR and LF never occur inside a multi-unit character in either.
+func convertLineEndings[T byte | uint16](text []T, crlf bool) ([]T, int) {
+	out := make([]T, 0, len(text)+len(text)/32)
+	changed := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\r' && i+1 < len(text) && text[i+1] == '\n':
+			i++
+			if crlf {
+				out = append(out, '\r', '\n')
+			} else {
+				out = append(out, '\n')
+				changed++
+			}
+		case c == '\n' && crlf:
+			out = append(out, '\r', '\n')
+			changed++
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, changed
+}
+
+// textModeNote describes a conversion for the operator.
+func textModeNote(changed int, crlf bool) string {
+	return fmt.Sprintf("Text mode: %d line endings converted to %s", changed, lineEndingName(crlf))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestConvertText(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		crlf    bool
+		want    string
+		changed int
+	}{
+		{"to CRLF", "a\nb\r\nc\n", true, "a\r\nb\r\nc\r\n", 2},
+		{"to LF", "a\r\nb\nc\r\n", false, "a\nb\nc\n", 2},
+		{"lone CR kept", "a\rb\n", false, "a\rb\n", 0},
+		{"UTF-8 BOM kept", "\xef\xbb\xbfkey=värde\n", true, "\xef\xbb\xbfkey=värde\r\n", 1},
+		{"no final newline", "x\r\ny", false, "x\ny", 1},
+	}
+	for _, tt := range tests {
+		got, changed, err := convertText([]byte(tt.in), tt.crlf)
+		if err != nil || string(got) != tt.want || changed != tt.changed {
+			t.Errorf("%s: got %q, %d changed (%v), want %q, %d", tt.name, got, changed, err, tt.want, tt.changed)
+		}
+	}
+}
+
+func TestConvertTextUTF16(t *testing.T) {
+	le := []byte{0xff, 0xfe, 'a', 0, '\n', 0, 'b', 0}
+	got, changed, err := convertText(le, true)
+	if want := []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0, 'b', 0}; err != nil || !bytes.Equal(got, want) || changed != 1 {
+		t.Errorf("UTF-16LE: got %x, %d (%v), want %x", got, changed, err, want)
+	}
+	be := []byte{0xfe, 0xff, 0, 'a', 0, '\r', 0, '\n'}
+	got, _, err = convertText(be, false)
+	if want := []byte{0xfe, 0xff, 0, 'a', 0, '\n'}; err != nil || !bytes.Equal(got, want) {
+		t.Errorf("UTF-16BE: got %x (%v), want %x", got, err, want)
+	}
+	if _, _, err := convertText([]byte{0xff, 0xfe, 'a'}, true); err == nil {
+		t.Error("expected an error for truncated UTF-16")
+	}
+}
+
+func TestConvertTextRefusesBinary(t *testing.T) {
+	if _, _, err := convertText([]byte("\x7fELF\x02\x01\x00\n"), true); err == nil {
+		t.Error("expected binary data to be refused")
+	}
+}
+
+func TestHandleUploadGlobalTextMode(t *testing.T) {
+	ml := newRefListener()
+	meta := ml.metadata["10.0.0.1:1000"]
+	meta.OS = "windows"
+	ml.metadata["10.0.0.1:1000"] = meta
+	ml.responses = []string{"OK", "OK", "OK\n12\n"}
+	local := t.TempDir() + "/hosts"
+	os.WriteFile(local, []byte("a=1\nb=2\n"), 0644)
+
+	out := captureStdout(t, func() {
+		if !handleUploadGlobal(ml, "10.0.0.1:1000", local, `C:\hosts`, "", true) {
+			t.Error("expected upload to succeed")
+		}
+	})
+	if !bytes.Contains([]byte(out), []byte("Text mode: 2 line endings converted to CRLF")) {
+		t.Errorf("unexpected output %q", out)
+	}
+	if !bytes.Contains([]byte(out), []byte("Total uploaded: 10 bytes")) {
+		t.Errorf("expected the converted size to be uploaded, got %q", out)
+	}
+}
+
+func TestHandleUploadGlobalTextModeUnknownOS(t *testing.T) {
+	ml := newRefListener()
+	local := t.TempDir() + "/hosts"
+	os.WriteFile(local, []byte("a=1\n"), 0644)
+	out := captureStdout(t, func() { handleUploadGlobal(ml, "10.0.0.1:1000", local, "/etc/hosts", "", true) })
+	if len(ml.sentCommands) != 0 || !bytes.Contains([]byte(out), []byte("did not report its OS")) {
+		t.Errorf("expected the upload to be refused, sent %q, output %q", ml.sentCommands, out)
+	}
+}
+
+func TestHandleDownloadGlobalTextMode(t *testing.T) {
+	compressed, _ := compression.CompressToHex([]byte("a=1\r\nb=2\n"))
+	ml := newRefListener()
+	ml.responses = []string{protocol.DataPrefix + compressed + protocol.EndOfOutputMarker}
+	local := t.TempDir() + "/win.ini"
+
+	captureStdout(t, func() { handleDownloadGlobal(ml, "10.0.0.1:1000", `C:\win.ini`, local, 0, true, false) })
+	want := "a=1\nb=2\n"
+	if runtime.GOOS == "windows" {
+		want = "a=1\r\nb=2\r\n"
+	}
+	if got, _ := os.ReadFile(local); string(got) != want {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+}
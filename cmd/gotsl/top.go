@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+const (
+	topInterval = time.Second // How often top refreshes
+	topRows     = 20          // Sessions and tunnels shown, busiest first
+)
+
+// trafficSampler is implemented by listeners that count the traffic of
+// sessions and tunnels.
+type trafficSampler interface {
+	Traffic() []server.TrafficSample
+}
+
+// topRow is a session or tunnel with its rates since the previous sample.
+type topRow struct {
+	server.TrafficSample
+	Client   string  // Session a tunnel goes through, if known
+	SentRate float64 // Bytes per second to the client
+	RecvRate float64 // Bytes per second from the client
+}
+
+// topRates computes the rates between two samplings and orders the rows
+// busiest first: by bandwidth, then by active connections. A session counts
+// the active connections of its tunnels.
+func topRates(prev, cur []server.TrafficSample) []topRow {
+	before := make(map[string]server.TrafficSample, len(prev))
+	for _, s := range prev {
+		before[s.Kind+" "+s.ID] = s
+	}
+	active := make(map[string]int64)
+	rows := make([]topRow, 0, len(cur))
+	for _, s := range cur {
+		row := topRow{TrafficSample: s}
+		if p, ok := before[s.Kind+" "+s.ID]; ok {
+			if secs := s.Time.Sub(p.Time).Seconds(); secs > 0 {
+				row.SentRate = float64(s.Sent-p.Sent) / secs
+				row.RecvRate = float64(s.Received-p.Received) / secs
+			}
+		}
+		if s.Kind != server.TrafficSession {
+			row.Client = tunnelClient(s.ID)
+			active[row.Client] += s.Active
+		}
+		rows = append(rows, row)
+	}
+	for i := range rows {
+		if rows[i].Kind == server.TrafficSession {
+			rows[i].Active = active[rows[i].ID]
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b topRow) int {
+		if c := cmp.Compare(b.SentRate+b.RecvRate, a.SentRate+a.RecvRate); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Active, a.Active)
+	})
+	return rows
+}
+
+// renderTop writes one screen of top.
+func renderTop(w io.Writer, l server.ListenerInterface, rows []topRow) {
+	sessions := 0
+	for _, r := range rows {
+		if r.Kind == server.TrafficSession {
+			sessions++
+		}
+	}
+	fmt.Fprintf(w, "%d sessions, %d tunnels, refreshed every %s\n\n", sessions, len(rows)-sessions, topInterval)
+	fmt.Fprintf(w, "%-8s %-30s %-30s %12s %12s %6s %7s\n", "KIND", "NAME", "CLIENT", "TO CLIENT", "FROM CLIENT", "ACTIVE", "CONNS")
+	for i, r := range rows {
+		if i == topRows {
+			fmt.Fprintf(w, "... %d more\n", len(rows)-topRows)
+			break
+		}
+		name, client, conns := r.ID, "", strconv.FormatInt(r.Connections, 10)
+		if r.Kind == server.TrafficSession {
+			name, conns = clientLabel(l, r.ID), "-"
+		} else if r.Client != "" {
+			client = clientLabel(l, r.Client)
+		}
+		fmt.Fprintf(w, "%-8s %-30s %-30s %12s %12s %6d %7s\n", r.Kind, name, client, formatRate(r.SentRate), formatRate(r.RecvRate), r.Active, conns)
+	}
+}
+
+// formatRate renders bytes per second like formatBytes.
+func formatRate(bps float64) string {
+	return formatBytes(strconv.FormatInt(int64(bps), 10)) + "/s"
+}
+
+// handleTop shows the busiest sessions and tunnels, refreshed every
+// topInterval until a key is pressed. Without a terminal it prints a single
+// screen, after one interval.
+func handleTop(l server.ListenerInterface, args []string) {
+	if len(args) != 0 {
+		fmt.Println("Usage: top")
+		return
+	}
+	sampler, ok := l.(trafficSampler)
+	if !ok {
+		fmt.Println("Error: this listener does not count traffic")
+		return
+	}
+	prev := sampler.Traffic()
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		time.Sleep(topInterval)
+		renderTop(os.Stdout, l, topRates(prev, sampler.Traffic()))
+		return
+	}
+
+	restoreConsole, err := makeRawConsole()
+	if err != nil {
+		fmt.Printf("Error: cannot set raw mode: %v\n", err)
+		return
+	}
+	// Alternate screen, so top leaves the REPL's scrollback alone
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		restoreConsole()
+	}()
+	defer os.Stdin.SetReadDeadline(time.Time{})
+
+	var screen bytes.Buffer
+	buf := make([]byte, 64)
+	next := time.Now()
+	for {
+		if !time.Now().Before(next) {
+			cur := sampler.Traffic()
+			screen.Reset()
+			renderTop(&screen, l, topRates(prev, cur))
+			screen.WriteString("\nPress any key to return to the prompt.")
+			// Raw mode does not turn a newline into a carriage return
+			os.Stdout.WriteString("\x1b[H\x1b[2J" + strings.ReplaceAll(screen.String(), "\n", "\r\n"))
+			prev, next = cur, next.Add(topInterval)
+		}
+		n, err := readConsole(buf, time.Until(next))
+		if n > 0 || err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestTopRates(t *testing.T) {
+	setTunnelClient("socks-1", "10.0.0.2:2000")
+	defer dropTunnelClient("socks-1")
+	start := time.Now()
+	prev := []server.TrafficSample{
+		{Kind: server.TrafficSession, ID: "10.0.0.1:1000", Sent: 1000, Time: start},
+		{Kind: server.TrafficSession, ID: "10.0.0.2:2000", Time: start},
+		{Kind: server.TrafficSocks, ID: "socks-1", Time: start},
+	}
+	now := start.Add(2 * time.Second)
+	cur := []server.TrafficSample{
+		{Kind: server.TrafficSession, ID: "10.0.0.1:1000", Sent: 1000, Received: 10, Time: now},
+		{Kind: server.TrafficSession, ID: "10.0.0.2:2000", Sent: 300000, Received: 100000, Time: now},
+		{Kind: server.TrafficSocks, ID: "socks-1", Sent: 200000, Received: 60000, Connections: 250, Active: 120, Time: now},
+		{Kind: server.TrafficForward, ID: "fwd-1", Time: now},
+	}
+
+	rows := topRates(prev, cur)
+	var order []string
+	for _, r := range rows {
+		order = append(order, r.ID)
+	}
+	if got := strings.Join(order, " "); got != "10.0.0.2:2000 socks-1 10.0.0.1:1000 fwd-1" {
+		t.Fatalf("expected the busiest first, got %s", got)
+	}
+	if rows[0].SentRate != 150000 || rows[0].RecvRate != 50000 || rows[0].Active != 120 {
+		t.Errorf("unexpected session row %+v", rows[0])
+	}
+	if rows[1].Client != "10.0.0.2:2000" {
+		t.Errorf("expected the tunnel's client, got %q", rows[1].Client)
+	}
+
+	var b strings.Builder
+	renderTop(&b, newRefListener(), rows)
+	out := b.String()
+	for _, want := range []string{"2 sessions, 2 tunnels", "e5f6a7b8@web2", "146.5 KiB/s", "socks-1", "250"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
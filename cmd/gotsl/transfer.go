@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// Transfer defaults; set from the listener config.
+var (
+	// maxDownloadSize makes clients refuse larger downloads unless forced;
+	// zero disables the limit.
+	maxDownloadSize int64 = config.DefaultMaxDownloadSize
+	// uploadOverwrite is the overwrite policy for uploads without a flag.
+	uploadOverwrite = protocol.OverwriteFail
+)
+
+// uploadPolicyFlags maps upload flags to the overwrite policy they select.
+var uploadPolicyFlags = map[string]string{
+	"--force":      protocol.OverwriteAlways,
+	"--rename":     protocol.OverwriteRename,
+	"--no-clobber": protocol.OverwriteFail,
+}
+
+// splitFlags separates the given flags from the other arguments, wherever
+// they appear.
+func splitFlags(args []string, known ...string) (rest, flags []string) {
+	for _, arg := range args {
+		isFlag := false
+		for _, k := range known {
+			if arg == k {
+				isFlag = true
+				break
+			}
+		}
+		if isFlag {
+			flags = append(flags, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return rest, flags
+}
+
+// splitValueFlag removes a flag taking a value, such as "--at 02:00", from
+// args wherever it appears. value is empty when the flag is absent.
+func splitValueFlag(args []string, name string) (rest []string, value string, err error) {
+	for i := 0; i < len(args); i++ {
+		if args[i] != name {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, "", fmt.Errorf("%s needs a value", name)
+		}
+		i++
+		value = args[i]
+	}
+	return rest, value, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+func TestSplitFlags(t *testing.T) {
+	rest, flags := splitFlags([]string{"1", "--force", "/etc/hosts", "--other"}, "--force")
+	if !reflect.DeepEqual(rest, []string{"1", "/etc/hosts", "--other"}) {
+		t.Errorf("unexpected rest %v", rest)
+	}
+	if !reflect.DeepEqual(flags, []string{"--force"}) {
+		t.Errorf("unexpected flags %v", flags)
+	}
+}
+
+func TestHandleUploadGlobalOverwritePolicy(t *testing.T) {
+	ml := &mockListener{
+		clients:   []string{"192.168.1.2:1234"},
+		responses: []string{"OK\n/remote/path-1.txt\n", "OK", "OK\n4\n"},
+	}
+	tmpfile := t.TempDir() + "/test.txt"
+	os.WriteFile(tmpfile, []byte("test"), 0644)
+
+	if !handleUploadGlobal(ml, "192.168.1.2:1234", tmpfile, "/remote/path.txt", "rename", false) {
+		t.Fatal("expected upload to succeed")
+	}
+	if fields := strings.Fields(ml.sentCommands[0]); len(fields) != 5 || fields[2] != "exists=rename" || fields[3] != "/remote/path.txt" {
+		t.Errorf("unexpected START_UPLOAD frame %q", ml.sentCommands[0])
+	}
+}
+
+func TestHandleDownloadGlobalSizeLimit(t *testing.T) {
+	ml := &mockListener{
+		clients:   []string{"192.168.1.2:1234"},
+		responses: []string{"File too large: 2048 bytes exceeds the limit of 1024 bytes\n"},
+	}
+	local := t.TempDir() + "/out.bin"
+
+	if !handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/big.bin", local, 1024, false, false) {
+		t.Fatal("a refused download should not end the session")
+	}
+	if ml.sentCommands[0] != "DOWNLOAD max=1024 /remote/big.bin" {
+		t.Errorf("unexpected DOWNLOAD frame %q", ml.sentCommands[0])
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Error("expected no local file for a refused download")
+	}
+
+	ml = &mockListener{clients: []string{"192.168.1.2:1234"}}
+	handleDownloadGlobal(ml, "192.168.1.2:1234", "/remote/big.bin", local, 0, false, false)
+	if ml.sentCommands[0] != "DOWNLOAD /remote/big.bin" {
+		t.Errorf("forced download should carry no limit, got %q", ml.sentCommands[0])
+	}
+}
+
+func TestTransferNegotiatedCodecAndLimit(t *testing.T) {
+	addr := "192.168.1.2:1234"
+	meta := server.ClientMetadata{Codecs: []string{compression.CodecGzip64, compression.CodecGzip}, MaxTransfer: 8}
+	ml := &mockListener{
+		clients:   []string{addr},
+		metadata:  map[string]server.ClientMetadata{addr: meta},
+		responses: []string{"OK\n/remote/path.txt\n", "OK", "OK\n4\n"},
+	}
+	tmpfile := t.TempDir() + "/test.txt"
+	os.WriteFile(tmpfile, []byte("test"), 0644)
+	if !handleUploadGlobal(ml, addr, tmpfile, "/remote/path.txt", "", false) {
+		t.Fatal("expected upload to succeed")
+	}
+	if fields := strings.Fields(ml.sentCommands[0]); len(fields) != 5 || fields[2] != "codec=gzip64" {
+		t.Errorf("unexpected START_UPLOAD frame %q", ml.sentCommands[0])
+	}
+
+	// Files over the client's limit are refused before anything is sent
+	os.WriteFile(tmpfile, []byte("more than eight bytes"), 0644)
+	ml = &mockListener{clients: []string{addr}, metadata: map[string]server.ClientMetadata{addr: meta}}
+	out := captureStdout(t, func() { handleUploadGlobal(ml, addr, tmpfile, "/remote/path.txt", "", false) })
+	if len(ml.sentCommands) != 0 || !strings.Contains(out, "exceeds the client's limit of 8 bytes") {
+		t.Errorf("expected the upload to be refused up front, sent %q, printed %q", ml.sentCommands, out)
+	}
+
+	encoded, _, _ := compression.EncodeTransfer(compression.CodecGzip64, []byte("data"))
+	ml = &mockListener{
+		clients:   []string{addr},
+		metadata:  map[string]server.ClientMetadata{addr: meta},
+		responses: []string{protocol.DataPrefix + encoded + "\n"},
+	}
+	local := t.TempDir() + "/out.txt"
+	if !handleDownloadGlobal(ml, addr, "/remote/file.txt", local, 1024, false, false) {
+		t.Fatal("expected download to succeed")
+	}
+	if ml.sentCommands[0] != "DOWNLOAD max=1024 codec=gzip64 /remote/file.txt" {
+		t.Errorf("unexpected DOWNLOAD frame %q", ml.sentCommands[0])
+	}
+	if got, _ := os.ReadFile(local); string(got) != "data" {
+		t.Errorf("unexpected download %q", got)
+	}
+}
+
+func TestSplitValueFlag(t *testing.T) {
+	rest, value, err := splitValueFlag([]string{"1", "--at", "02:00", "/etc/hosts"}, "--at")
+	if err != nil || value != "02:00" || !reflect.DeepEqual(rest, []string{"1", "/etc/hosts"}) {
+		t.Errorf("unexpected split %v %q %v", rest, value, err)
+	}
+	if _, _, err := splitValueFlag([]string{"1", "--at"}, "--at"); err == nil {
+		t.Error("expected an error for a flag without value")
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 func flushStdin() error {
 	fd := int(os.Stdin.Fd())
-	arg := 1
-	return unix.IoctlSetInt(fd, unix.TIOCFLUSH, arg)
+	// TIOCFLUSH takes a pointer to the queue selector; FREAD (1) discards
+	// pending input only
+	return unix.IoctlSetPointerInt(fd, unix.TIOCFLUSH, 1)
 }
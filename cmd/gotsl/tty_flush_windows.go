@@ -3,7 +3,14 @@
 
 package main
 
-// flushStdin is a no-op on Windows because the listener runs on Unix.
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// flushStdin discards console input left over from the PTY session, such as
+// replies to terminal queries.
 func flushStdin() error {
-	return nil
+	return windows.FlushConsoleInputBuffer(windows.Handle(os.Stdin.Fd()))
 }
@@ -0,0 +1,899 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+	"golang.org/x/term"
+)
+
+const (
+	tuiPrefix       = 0x02 // Ctrl-B starts a key binding
+	tuiClientWidth  = 30
+	tuiEventRows    = 6
+	tuiMaxEvents    = 200
+	tuiScrollback   = 2000 // Lines kept per session
+	tuiRedrawPeriod = 50 * time.Millisecond
+	tuiPollPeriod   = time.Second
+)
+
+const tuiKeyHelp = "Ctrl-B then: n/p switch  1-9 client  o open  O open despite lock  x close  d detach  q quit"
+
+// Escape sequence parser states of textPane.
+const (
+	escNone      = iota
+	escStart     // After ESC
+	escCSI       // ESC [ up to the final byte
+	escString    // OSC, DCS etc. up to BEL or ST
+	escStringEnd // ESC inside a string
+	escCharset   // ESC ( and friends take one more byte
+)
+
+// textPane holds what a PTY session printed, with terminal control
+// sequences removed. It is not a terminal emulator: shells and line-oriented
+// tools display fine, full-screen programs such as editors do not.
+type textPane struct {
+	lines   []string // Finished lines, oldest first
+	line    []rune   // Line being written
+	col     int
+	state   int
+	params  []rune // Parameters of the CSI sequence being parsed
+	partial []byte // Incomplete UTF-8 sequence from the last write
+}
+
+func (p *textPane) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(p.partial) > 0 {
+		b = append(p.partial, b...)
+		p.partial = nil
+	}
+	for len(b) > 0 {
+		if !utf8.FullRune(b) {
+			p.partial = append([]byte(nil), b...)
+			break
+		}
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		p.put(r)
+	}
+	return n, nil
+}
+
+func (p *textPane) put(r rune) {
+	switch p.state {
+	case escStart:
+		switch r {
+		case '[':
+			p.state = escCSI
+			p.params = p.params[:0]
+		case ']', 'P', '_', '^', 'X':
+			p.state = escString
+		case '(', ')', '*', '+', '#', '%':
+			p.state = escCharset
+		default:
+			p.state = escNone
+		}
+		return
+	case escCSI:
+		if r >= 0x40 && r <= 0x7e {
+			p.state = escNone
+			if r == 'K' {
+				p.eraseLine(string(p.params))
+			}
+		} else {
+			p.params = append(p.params, r)
+		}
+		return
+	case escString:
+		if r == '\a' {
+			p.state = escNone
+		} else if r == 0x1b {
+			p.state = escStringEnd
+		}
+		return
+	case escStringEnd, escCharset:
+		p.state = escNone
+		return
+	}
+
+	switch {
+	case r == 0x1b:
+		p.state = escStart
+	case r == '\n':
+		p.lines = append(p.lines, string(p.line))
+		if len(p.lines) > tuiScrollback {
+			p.lines = p.lines[1:]
+		}
+		p.line = nil
+		p.col = 0
+	case r == '\r':
+		p.col = 0
+	case r == '\b':
+		if p.col > 0 {
+			p.col--
+		}
+	case r == '\t':
+		p.col = (p.col/8 + 1) * 8
+	case r < 0x20 || r == 0x7f || r >= 0x80 && r < 0xa0:
+		// Other control characters move nothing we display
+	default:
+		for len(p.line) < p.col {
+			p.line = append(p.line, ' ')
+		}
+		if p.col < len(p.line) {
+			p.line[p.col] = r
+		} else {
+			p.line = append(p.line, r)
+		}
+		p.col++
+	}
+}
+
+// eraseLine handles CSI K: erase to the end (0), the start (1) or all (2) of
+// the current line.
+func (p *textPane) eraseLine(param string) {
+	switch param {
+	case "", "0":
+		if p.col < len(p.line) {
+			p.line = p.line[:p.col]
+		}
+	case "1":
+		for i := 0; i < p.col && i < len(p.line); i++ {
+			p.line[i] = ' '
+		}
+	case "2":
+		p.line = p.line[:0]
+	}
+}
+
+// rows returns the last height screen rows of the pane wrapped at width, and
+// the cursor position within them.
+func (p *textPane) rows(width, height int) (rows []string, curRow, curCol int) {
+	if width < 1 || height < 1 {
+		return nil, 0, 0
+	}
+	current := wrapRunes(p.line, width)
+	rows = current
+	for i := len(p.lines) - 1; i >= 0 && len(rows) < height; i-- {
+		rows = append(wrapRunes([]rune(p.lines[i]), width), rows...)
+	}
+	if len(rows) > height {
+		rows = rows[len(rows)-height:]
+	}
+	curRow = len(rows) - len(current) + p.col/width
+	curCol = p.col % width
+	if curRow >= len(rows) {
+		curRow, curCol = len(rows)-1, width-1
+	}
+	return rows, curRow, curCol
+}
+
+func wrapRunes(line []rune, width int) []string {
+	if len(line) == 0 {
+		return []string{""}
+	}
+	var rows []string
+	for len(line) > width {
+		rows = append(rows, string(line[:width]))
+		line = line[width:]
+	}
+	return append(rows, string(line))
+}
+
+// tuiSession is a PTY shell shown in the session pane.
+type tuiSession struct {
+	addr   string
+	pane   textPane
+	unread bool // Produced output while not shown
+	closed bool // The remote shell exited
+}
+
+// tui is the multi-pane terminal UI: clients on the left, the active session
+// on the right and the event log below. It only uses the exported listener
+// API, the same one the REPL uses. The listener may log while holding its
+// own lock, so mu is never held while calling into the listener.
+type tui struct {
+	l   server.ListenerInterface
+	out *os.File
+
+	mu       sync.Mutex
+	clients  []string          // In ls order
+	labels   map[string]string // clientLabel of each client
+	selected int               // Index into clients
+	sessions map[string]*tuiSession
+	opening  map[string]bool
+	active   string // Address of the session shown, "" for none
+	events   []string
+	width    int
+	height   int
+	bell     bool
+
+	prefix bool // Ctrl-B was pressed; only touched by the input loop
+	dirty  chan struct{}
+}
+
+func newTUI(l server.ListenerInterface, out *os.File) *tui {
+	return &tui{
+		l:        l,
+		out:      out,
+		labels:   make(map[string]string),
+		sessions: make(map[string]*tuiSession),
+		opening:  make(map[string]bool),
+		dirty:    make(chan struct{}, 1),
+	}
+}
+
+// runTUI runs the terminal UI until the operator quits.
+func runTUI(l *server.Listener) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("--tui needs a terminal")
+	}
+	restoreConsole, err := makeRawConsole()
+	if err != nil {
+		return fmt.Errorf("cannot set raw mode: %w", err)
+	}
+	t := newTUI(l, os.Stdout)
+	t.width, t.height = t.size()
+
+	// Logs, warnings and password prompts go to the event log
+	log.SetOutput(logging.Tee(t))
+	defer log.SetOutput(logging.Tee(os.Stderr))
+	l.SetWarningHandler(func(clientAddr, msg string) {
+		t.eventf("⚠️  [%s] %s", clientAddr, msg)
+	})
+	l.SetPromptHandler(func(clientAddr, prompt string) {
+		t.eventf("🔑 [%s] waiting for a password: %q", clientAddr, prompt)
+	})
+
+	// Alternate screen, so the shell's scrollback survives
+	t.out.WriteString("\x1b[?1049h")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		restoreConsole()
+	}()
+
+	t.pollClients(false)
+	t.eventf("Listener ready. %s", tuiKeyHelp)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t.loop(done)
+	}()
+
+	// A closed terminal ends the open sessions like quitting does
+	hangup, stopHangup := watchHangup()
+	defer stopHangup()
+	t.readInput(hangup)
+	t.closeAll()
+	close(done)
+	<-stopped
+	return nil
+}
+
+// readInput feeds stdin to handleInput until the operator quits or the
+// terminal goes away.
+func (t *tui) readInput(hangup <-chan struct{}) {
+	defer os.Stdin.SetReadDeadline(time.Time{})
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-hangup:
+			return
+		default:
+		}
+		// A timeout keeps a pending read from outliving the UI
+		n, err := readConsole(buf, 100*time.Millisecond)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		if !t.handleInput(buf[:n]) {
+			return
+		}
+	}
+}
+
+func (t *tui) loop(done chan struct{}) {
+	redraw := time.NewTicker(tuiRedrawPeriod)
+	defer redraw.Stop()
+	poll := time.NewTicker(tuiPollPeriod)
+	defer poll.Stop()
+	t.render()
+	for {
+		select {
+		case <-done:
+			return
+		case <-poll.C:
+			t.pollClients(true)
+			t.checkSize()
+		case <-redraw.C:
+			select {
+			case <-t.dirty:
+				t.render()
+			default:
+			}
+		}
+	}
+}
+
+// redraw schedules a render; renders are rate limited by loop.
+func (t *tui) redraw() {
+	select {
+	case t.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// Write adds log output to the event log.
+func (t *tui) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			t.eventf("%s", line)
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tui) eventf(format string, args ...interface{}) {
+	t.mu.Lock()
+	t.addEventLocked(fmt.Sprintf(format, args...))
+	t.mu.Unlock()
+	t.redraw()
+}
+
+func (t *tui) addEventLocked(msg string) {
+	t.events = append(t.events, time.Now().Format("15:04:05 ")+msg)
+	if len(t.events) > tuiMaxEvents {
+		t.events = t.events[1:]
+	}
+}
+
+// pollClients refreshes the client list, logging connects and disconnects
+// when announce is set.
+func (t *tui) pollClients(announce bool) {
+	clients := t.l.GetClients()
+	labels := make(map[string]string, len(clients))
+	for _, addr := range clients {
+		labels[addr] = clientLabel(t.l, addr)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if announce {
+		known := make(map[string]bool, len(t.clients))
+		for _, addr := range t.clients {
+			known[addr] = true
+		}
+		current := make(map[string]bool, len(clients))
+		for i, addr := range clients {
+			current[addr] = true
+			if !known[addr] {
+				t.addEventLocked(fmt.Sprintf("Client #%d connected: %s (%s)", i+1, labels[addr], addr))
+			}
+		}
+		for _, addr := range t.clients {
+			if !current[addr] {
+				t.addEventLocked(fmt.Sprintf("Client disconnected: %s", addr))
+			}
+		}
+	}
+	prev := ""
+	if t.selected < len(t.clients) {
+		prev = t.clients[t.selected]
+	}
+	t.clients = clients
+	t.labels = labels
+	t.selected = 0
+	for i, addr := range clients {
+		if addr == prev {
+			t.selected = i
+		}
+	}
+	t.redraw()
+}
+
+func (t *tui) labelLocked(addr string) string {
+	if label, ok := t.labels[addr]; ok {
+		return label
+	}
+	return addr
+}
+
+func (t *tui) size() (int, int) {
+	w, h, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// checkSize notices terminal resizes and passes them on to the sessions.
+func (t *tui) checkSize() {
+	w, h := t.size()
+	t.mu.Lock()
+	changed := w != t.width || h != t.height
+	t.width, t.height = w, h
+	var addrs []string
+	for addr, s := range t.sessions {
+		if !s.closed {
+			addrs = append(addrs, addr)
+		}
+	}
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+	for _, addr := range addrs {
+		t.resizeSession(addr)
+	}
+	t.redraw()
+}
+
+// tuiLayout returns the widths of the client and session panes and the
+// number of rows they span on a terminal of w by h.
+func tuiLayout(w, h int) (clientWidth, sessionWidth, bodyRows int) {
+	clientWidth = tuiClientWidth
+	if clientWidth > w/3 {
+		clientWidth = w / 3
+	}
+	sessionWidth = w - clientWidth - 1
+	bodyRows = h - tuiEventRows - 3 // Title, separator and status rows
+	return clientWidth, sessionWidth, bodyRows
+}
+
+// resizeSession tells the remote PTY the size of the session pane.
+func (t *tui) resizeSession(addr string) {
+	t.mu.Lock()
+	_, cols, rows := tuiLayout(t.width, t.height)
+	t.mu.Unlock()
+	rows-- // Session header
+	if rows < 1 || cols < 1 {
+		return
+	}
+	_ = t.l.SendCommand(addr, fmt.Sprintf("%s %d %d", protocol.CmdPtyResize, rows, cols))
+}
+
+// handleInput routes keyboard input: Ctrl-B bindings go to the UI, other
+// keys to the active session, or to the client list when there is none.
+// It returns false when the operator quits.
+func (t *tui) handleInput(b []byte) bool {
+	for len(b) > 0 {
+		if t.prefix {
+			t.prefix = false
+			if !t.command(b[0]) {
+				return false
+			}
+			b = b[1:]
+			continue
+		}
+		chunk := b
+		i := bytes.IndexByte(b, tuiPrefix)
+		if i >= 0 {
+			chunk = b[:i]
+		}
+		if len(chunk) > 0 && !t.input(chunk) {
+			return false
+		}
+		if i < 0 {
+			break
+		}
+		t.prefix = true
+		b = b[i+1:]
+	}
+	return true
+}
+
+// command runs the Ctrl-B binding for key.
+func (t *tui) command(key byte) bool {
+	switch {
+	case key == 'q':
+		return false
+	case key == 'n', key == 'p':
+		t.cycle(key == 'n')
+	case key >= '1' && key <= '9':
+		t.mu.Lock()
+		n := int(key - '1')
+		if n < len(t.clients) {
+			t.selected = n
+		}
+		t.mu.Unlock()
+		t.openSelected(false)
+	case key == 'o', key == 'O':
+		t.openSelected(key == 'O')
+	case key == 'x':
+		t.closeActive()
+	case key == 'd':
+		t.mu.Lock()
+		t.active = ""
+		t.mu.Unlock()
+		t.redraw()
+	case key == tuiPrefix:
+		t.input([]byte{tuiPrefix})
+	}
+	return true
+}
+
+// input sends keys to the active session, or navigates the client list.
+func (t *tui) input(b []byte) bool {
+	t.mu.Lock()
+	s := t.sessions[t.active]
+	t.mu.Unlock()
+	if s != nil && !s.closed {
+		t.sendInput(s.addr, b)
+		return true
+	}
+
+	switch string(b) {
+	case "q":
+		return false
+	case "\x1b[A", "\x1bOA", "k":
+		t.moveSelection(-1)
+	case "\x1b[B", "\x1bOB", "j":
+		t.moveSelection(1)
+	case "\r", "\n", "o":
+		t.openSelected(false)
+	case "x":
+		t.closeActive()
+	}
+	return true
+}
+
+func (t *tui) moveSelection(delta int) {
+	t.mu.Lock()
+	if n := t.selected + delta; n >= 0 && n < len(t.clients) {
+		t.selected = n
+	}
+	t.mu.Unlock()
+	t.redraw()
+}
+
+func (t *tui) sendInput(addr string, b []byte) {
+	encoded, err := compressFor(t.l, addr, b)
+	if err == nil {
+		err = t.l.SendCommand(addr, protocol.CmdPtyData+" "+encoded)
+	}
+	if err != nil {
+		t.eventf("Error sending input to %s: %v", addr, err)
+	}
+}
+
+// sessionOrder returns the addresses of open sessions in client list order.
+func (t *tui) sessionOrder() []string {
+	index := make(map[string]int, len(t.clients))
+	for i, addr := range t.clients {
+		index[addr] = i
+	}
+	addrs := make([]string, 0, len(t.sessions))
+	for addr := range t.sessions {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		a, aok := index[addrs[i]]
+		b, bok := index[addrs[j]]
+		if aok != bok {
+			return aok
+		}
+		if a != b {
+			return a < b
+		}
+		return addrs[i] < addrs[j]
+	})
+	return addrs
+}
+
+// cycle shows the next or previous session.
+func (t *tui) cycle(forward bool) {
+	t.mu.Lock()
+	order := t.sessionOrder()
+	if len(order) > 0 {
+		pos := -1
+		for i, addr := range order {
+			if addr == t.active {
+				pos = i
+			}
+		}
+		switch {
+		case pos < 0 && forward:
+			pos = 0
+		case pos < 0:
+			pos = len(order) - 1
+		case forward:
+			pos = (pos + 1) % len(order)
+		default:
+			pos = (pos + len(order) - 1) % len(order)
+		}
+		t.focusLocked(order[pos])
+	}
+	t.mu.Unlock()
+	t.redraw()
+}
+
+// focusLocked shows the session of addr and drops ended sessions that are
+// no longer shown.
+func (t *tui) focusLocked(addr string) {
+	t.active = addr
+	for a, s := range t.sessions {
+		if s.closed && a != addr {
+			delete(t.sessions, a)
+		}
+	}
+	if s := t.sessions[addr]; s != nil {
+		s.unread = false
+	}
+	for i, c := range t.clients {
+		if c == addr {
+			t.selected = i
+		}
+	}
+}
+
+// openSelected shows the session of the selected client, starting one if
+// needed. The PTY handshake runs in the background.
+func (t *tui) openSelected(override bool) {
+	t.mu.Lock()
+	if t.selected >= len(t.clients) {
+		t.mu.Unlock()
+		return
+	}
+	addr := t.clients[t.selected]
+	if s := t.sessions[addr]; s != nil && !s.closed {
+		t.focusLocked(addr)
+		t.mu.Unlock()
+		t.redraw()
+		return
+	}
+	if t.opening[addr] {
+		t.mu.Unlock()
+		return
+	}
+	t.opening[addr] = true
+	t.mu.Unlock()
+	go t.openSession(addr, override)
+}
+
+func (t *tui) openSession(addr string, override bool) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.opening, addr)
+		t.mu.Unlock()
+	}()
+	label := clientLabel(t.l, addr)
+	meta, _ := t.l.GetClientMetadata(addr)
+	if !meta.Supports(protocol.CapPTY) {
+		t.eventf("Error: client %s does not support %s", label, protocol.CapPTY)
+		return
+	}
+	release, err := lockSession(t.l, addr, "pty", override)
+	if err != nil {
+		t.eventf("Error: %v", strings.Replace(err.Error(), overrideFlag, "Ctrl-B O", 1))
+		return
+	}
+	t.eventf("Opening session with %s...", label)
+	replay := scrollbackReplay(t.l, addr)
+	data, err := startPtyMode(t.l, addr)
+	if err != nil {
+		release()
+		t.eventf("%s: %v", label, err)
+		return
+	}
+	s := &tuiSession{addr: addr}
+	t.mu.Lock()
+	s.pane.Write(replay)
+	t.sessions[addr] = s
+	t.focusLocked(addr)
+	t.mu.Unlock()
+	t.resizeSession(addr)
+	t.redraw()
+
+	// The channel closes when the shell exits or the session is closed
+	for chunk := range data {
+		t.output(s, chunk)
+	}
+	release()
+	t.ended(s)
+}
+
+// output adds PTY output to a session and notifies the operator when it
+// arrives for a session in the background.
+func (t *tui) output(s *tuiSession, data []byte) {
+	t.mu.Lock()
+	s.pane.Write(data)
+	if t.active != s.addr && !s.unread {
+		s.unread = true
+		t.bell = true
+		t.addEventLocked(fmt.Sprintf("Output from %s", t.labelLocked(s.addr)))
+	}
+	t.mu.Unlock()
+	t.redraw()
+}
+
+// ended marks a session whose remote shell exited. It stays visible until
+// the operator moves on.
+func (t *tui) ended(s *tuiSession) {
+	t.mu.Lock()
+	if t.sessions[s.addr] == s {
+		s.closed = true
+		t.addEventLocked(fmt.Sprintf("Session with %s ended", s.addr))
+		if t.active != s.addr {
+			delete(t.sessions, s.addr)
+		}
+	}
+	t.mu.Unlock()
+	t.redraw()
+}
+
+// closeActive ends the session shown.
+func (t *tui) closeActive() {
+	t.mu.Lock()
+	s := t.sessions[t.active]
+	if s != nil {
+		delete(t.sessions, s.addr)
+	}
+	t.active = ""
+	t.mu.Unlock()
+	if s != nil && !s.closed {
+		t.closeSession(s.addr)
+	}
+	t.redraw()
+}
+
+func (t *tui) closeSession(addr string) {
+	_ = t.l.SendCommand(addr, protocol.CmdPtyExit)
+	t.l.ExitPtyMode(addr)
+}
+
+// closeAll ends every session when the UI exits.
+func (t *tui) closeAll() {
+	t.mu.Lock()
+	var addrs []string
+	for addr, s := range t.sessions {
+		if !s.closed {
+			addrs = append(addrs, addr)
+		}
+	}
+	t.sessions = make(map[string]*tuiSession)
+	t.mu.Unlock()
+	for _, addr := range addrs {
+		t.closeSession(addr)
+	}
+}
+
+func (t *tui) render() {
+	t.mu.Lock()
+	frame := t.frameLocked()
+	t.mu.Unlock()
+	t.out.WriteString(frame)
+}
+
+// frameLocked draws the whole screen.
+func (t *tui) frameLocked() string {
+	w, h := t.width, t.height
+	var b strings.Builder
+	b.WriteString("\x1b[?25l")
+	if t.bell {
+		b.WriteString("\a")
+		t.bell = false
+	}
+	row := func(y int, s string) {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s", y, s)
+	}
+	clientWidth, sessionWidth, bodyRows := tuiLayout(w, h)
+	if bodyRows < 3 || clientWidth < 10 {
+		b.WriteString("\x1b[2J")
+		row(1, fitWidth("Terminal too small", w))
+		return b.String()
+	}
+
+	title := fmt.Sprintf(" gotsl  clients: %d  sessions: %d", len(t.clients), len(t.sessions))
+	row(1, "\x1b[7m"+fitWidth(title, w)+"\x1b[0m")
+
+	// Client list
+	left := make([]string, bodyRows)
+	left[0] = "\x1b[1m" + fitWidth(" Clients", clientWidth) + "\x1b[0m"
+	for i, addr := range t.clients {
+		if i+1 >= bodyRows {
+			break
+		}
+		mark := " "
+		if s := t.sessions[addr]; s != nil {
+			mark = "•"
+			if s.unread {
+				mark = "*"
+			}
+		}
+		text := fitWidth(fmt.Sprintf("%s%d %s", mark, i+1, t.labelLocked(addr)), clientWidth)
+		if i == t.selected {
+			text = "\x1b[7m" + text + "\x1b[0m"
+		} else if s := t.sessions[addr]; s != nil && s.unread {
+			text = "\x1b[1m" + text + "\x1b[0m"
+		}
+		left[i+1] = text
+	}
+	if len(t.clients) == 0 {
+		left[1] = fitWidth(" (none)", clientWidth)
+	}
+
+	// Active session
+	right := make([]string, bodyRows)
+	curRow, curCol := -1, 0
+	if s := t.sessions[t.active]; s != nil {
+		header := " " + t.labelLocked(s.addr) + " (" + s.addr + ")"
+		if s.closed {
+			header += " [ended]"
+		}
+		right[0] = "\x1b[1m" + fitWidth(header, sessionWidth) + "\x1b[0m"
+		rows, r, c := s.pane.rows(sessionWidth, bodyRows-1)
+		for i, text := range rows {
+			right[i+1] = fitWidth(text, sessionWidth)
+		}
+		if !s.closed {
+			curRow, curCol = r+1, c
+		}
+	} else {
+		right[0] = "\x1b[1m" + fitWidth(" No session", sessionWidth) + "\x1b[0m"
+		right[2] = fitWidth(" Select a client with ↑/↓ and press Enter to open a shell.", sessionWidth)
+		right[3] = fitWidth(" "+tuiKeyHelp, sessionWidth)
+	}
+
+	for i := 0; i < bodyRows; i++ {
+		l, r := left[i], right[i]
+		if l == "" {
+			l = strings.Repeat(" ", clientWidth)
+		}
+		if r == "" {
+			r = strings.Repeat(" ", sessionWidth)
+		}
+		row(i+2, l+"│"+r)
+	}
+
+	// Event log
+	row(bodyRows+2, fitWidth("── Events "+strings.Repeat("─", w), w))
+	events := t.events
+	if len(events) > tuiEventRows {
+		events = events[len(events)-tuiEventRows:]
+	}
+	for i := 0; i < tuiEventRows; i++ {
+		text := ""
+		if i < len(events) {
+			text = events[i]
+		}
+		row(bodyRows+3+i, fitWidth(text, w))
+	}
+
+	// Status line; the last column is left empty so the terminal never scrolls
+	status := " " + tuiKeyHelp
+	row(h, "\x1b[7m"+fitWidth(status, w-1)+"\x1b[0m")
+
+	if curRow >= 0 {
+		fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[?25h", curRow+2, clientWidth+2+curCol)
+	}
+	return b.String()
+}
+
+// fitWidth truncates or pads s to exactly width runes.
+func fitWidth(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestTextPane(t *testing.T) {
+	var p textPane
+	p.Write([]byte("\x1b[1;32muser@web2\x1b[0m:~$ ls\r\n"))
+	p.Write([]byte("a.txt\tb.txt\r\n"))
+	p.Write([]byte("\x1b]0;title\aprogress 10%\rprogress 100%\r\n"))
+	p.Write([]byte("abcdef\rxy\x1b[K\r\n"))
+	p.Write([]byte("caf\xc3")) // é split across writes
+	p.Write([]byte("\xa9 $ "))
+
+	rows, curRow, curCol := p.rows(80, 10)
+	want := []string{"user@web2:~$ ls", "a.txt   b.txt", "progress 100%", "xy", "café $ "}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %q, want %q", rows, want)
+	}
+	if curRow != 4 || curCol != 7 {
+		t.Errorf("cursor at %d,%d, want 4,7", curRow, curCol)
+	}
+
+	// Long lines wrap and only the last rows are returned
+	rows, curRow, curCol = p.rows(5, 2)
+	if !reflect.DeepEqual(rows, []string{"café ", "$ "}) || curRow != 1 || curCol != 2 {
+		t.Errorf("wrapped rows = %q, cursor %d,%d", rows, curRow, curCol)
+	}
+}
+
+func TestTextPaneScrollback(t *testing.T) {
+	var p textPane
+	for i := 0; i < tuiScrollback+10; i++ {
+		p.Write([]byte("line\n"))
+	}
+	if len(p.lines) != tuiScrollback {
+		t.Errorf("expected %d lines kept, got %d", tuiScrollback, len(p.lines))
+	}
+}
+
+func newTestTUI() (*tui, *mockListener) {
+	ml := newRefListener()
+	tu := newTUI(ml, nil)
+	tu.width, tu.height = 100, 30
+	tu.pollClients(false)
+	return tu, ml
+}
+
+func TestTUIClientEvents(t *testing.T) {
+	tu, ml := newTestTUI()
+	if len(tu.events) != 0 {
+		t.Fatalf("expected no events for the initial clients, got %q", tu.events)
+	}
+
+	ml.clients = []string{"10.0.0.2:2000", "10.0.0.3:3000", "10.0.0.4:4000"}
+	tu.pollClients(true)
+	if len(tu.events) != 2 ||
+		!strings.Contains(tu.events[0], "Client #3 connected: 10.0.0.4:4000") ||
+		!strings.Contains(tu.events[1], "Client disconnected: 10.0.0.1:1000") {
+		t.Errorf("unexpected events %q", tu.events)
+	}
+}
+
+func TestTUISelectionFollowsClient(t *testing.T) {
+	tu, ml := newTestTUI()
+	tu.handleInput([]byte("j"))
+	tu.handleInput([]byte("\x1b[B"))
+	if tu.selected != 2 {
+		t.Fatalf("expected the third client selected, got %d", tu.selected)
+	}
+	ml.clients = ml.clients[1:]
+	tu.pollClients(false)
+	if tu.selected != 1 || tu.clients[tu.selected] != "10.0.0.3:3000" {
+		t.Errorf("selection did not follow the client: %d", tu.selected)
+	}
+}
+
+func TestTUIInputRouting(t *testing.T) {
+	tu, ml := newTestTUI()
+	s := &tuiSession{addr: "10.0.0.1:1000"}
+	tu.sessions[s.addr] = s
+	tu.focusLocked(s.addr)
+
+	// Keys go to the session; Ctrl-B Ctrl-B sends a literal Ctrl-B
+	if !tu.handleInput([]byte("ls\r\x02\x02")) {
+		t.Fatal("unexpected quit")
+	}
+	if len(ml.sentCommands) != 2 {
+		t.Fatalf("expected 2 PTY_DATA frames, got %q", ml.sentCommands)
+	}
+	for i, want := range []string{"ls\r", "\x02"} {
+		hex := strings.TrimPrefix(ml.sentCommands[i], protocol.CmdPtyData+" ")
+		data, err := compression.DecompressHex(hex)
+		if err != nil || string(data) != want {
+			t.Errorf("frame %d = %q (%v), want %q", i, data, err, want)
+		}
+	}
+
+	// Ctrl-B d detaches; keys then move the selection instead
+	tu.handleInput([]byte("\x02d"))
+	if tu.active != "" {
+		t.Fatal("expected Ctrl-B d to detach")
+	}
+	tu.handleInput([]byte("j"))
+	if tu.selected != 1 || len(ml.sentCommands) != 2 {
+		t.Errorf("expected j to move the selection, selected=%d sent=%q", tu.selected, ml.sentCommands)
+	}
+
+	// A prefix split across reads still works
+	tu.handleInput([]byte("\x02"))
+	if tu.handleInput([]byte("q")) {
+		t.Error("expected Ctrl-B q to quit")
+	}
+}
+
+func TestTUIBackgroundOutputNotifies(t *testing.T) {
+	tu, _ := newTestTUI()
+	a := &tuiSession{addr: "10.0.0.1:1000"}
+	b := &tuiSession{addr: "10.0.0.2:2000"}
+	tu.sessions[a.addr], tu.sessions[b.addr] = a, b
+	tu.focusLocked(a.addr)
+
+	tu.output(a, []byte("shown\n"))
+	tu.output(b, []byte("hidden\n"))
+	tu.output(b, []byte("more\n"))
+	if a.unread || !b.unread {
+		t.Fatalf("unexpected unread flags: a=%v b=%v", a.unread, b.unread)
+	}
+	if len(tu.events) != 1 || !strings.Contains(tu.events[0], "Output from e5f6a7b8@web2") {
+		t.Errorf("expected one notification, got %q", tu.events)
+	}
+	if frame := tu.frameLocked(); !strings.Contains(frame, "*2 e5f6a7b8@web2") || !strings.Contains(frame, "\a") {
+		t.Error("expected the client list to mark unread output and ring the bell")
+	}
+
+	tu.cycle(true)
+	if tu.active != b.addr || b.unread {
+		t.Errorf("expected Ctrl-B n to show the second session, active=%q", tu.active)
+	}
+	tu.cycle(true)
+	if tu.active != a.addr {
+		t.Errorf("expected the cycle to wrap around, active=%q", tu.active)
+	}
+}
+
+func TestTUIEndedSession(t *testing.T) {
+	tu, _ := newTestTUI()
+	s := &tuiSession{addr: "10.0.0.1:1000"}
+	tu.sessions[s.addr] = s
+	tu.focusLocked(s.addr)
+	tu.output(s, []byte("logout\r\n"))
+	tu.ended(s)
+
+	frame := tu.frameLocked()
+	if !strings.Contains(frame, "[ended]") || !strings.Contains(frame, "logout") {
+		t.Error("expected the ended session to stay visible")
+	}
+	tu.focusLocked("")
+	if len(tu.sessions) != 0 {
+		t.Error("expected the ended session to be dropped once left")
+	}
+}
+
+func TestTUIFrame(t *testing.T) {
+	tu, _ := newTestTUI()
+	tu.eventf("hello")
+	frame := tu.frameLocked()
+	for _, want := range []string{"clients: 3", "1 a1b2c3d4@web1", "3 12345678@db1", "No session", "hello", tuiKeyHelp} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame lacks %q", want)
+		}
+	}
+
+	tu.width, tu.height = 20, 8
+	if !strings.Contains(tu.frameLocked(), "Terminal too small") {
+		t.Error("expected a small terminal to be reported")
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	if got := fitWidth("héllo", 3); got != "hél" {
+		t.Errorf("fitWidth truncated to %q", got)
+	}
+	if got := fitWidth("ab", 4); got != "ab  " {
+		t.Errorf("fitWidth padded to %q", got)
+	}
+}
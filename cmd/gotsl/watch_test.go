@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// watchingListener adds a watch registry to the mock listener.
+type watchingListener struct {
+	*mockListener
+	watches map[string]server.Watch
+}
+
+func (w *watchingListener) AddWatch(clientAddr, path string, content bool) server.Watch {
+	watch := server.Watch{ID: "w1", ClientAddr: clientAddr, Path: path, Content: content}
+	w.watches[watch.ID] = watch
+	return watch
+}
+
+func (w *watchingListener) DropWatch(id string) (server.Watch, bool) {
+	watch, ok := w.watches[id]
+	delete(w.watches, id)
+	return watch, ok
+}
+
+func (w *watchingListener) Watches() []server.Watch {
+	var list []server.Watch
+	for _, watch := range w.watches {
+		list = append(list, watch)
+	}
+	return list
+}
+
+func TestHandleWatch(t *testing.T) {
+	wl := &watchingListener{mockListener: newRefListener(), watches: map[string]server.Watch{}}
+	wl.responses = []string{"OK\n" + protocol.EndOfOutputMarker, "OK\n"}
+	out := captureStdout(t, func() {
+		handleWatch(wl, []string{"--content", "web1", "/etc/passwd"})
+		handleWatch(wl, nil)
+		handleUnwatch(wl, []string{"w1"})
+		handleUnwatch(wl, []string{"w1"})
+	})
+	if len(wl.sentCommands) != 2 || wl.sentCommands[0] != "WATCH w1 content=1 /etc/passwd" || wl.sentCommands[1] != "UNWATCH w1" {
+		t.Errorf("unexpected commands %q", wl.sentCommands)
+	}
+	for _, want := range []string{"Watching /etc/passwd on", "w1   a1b2c3d4", "(with content)", "Stopped watch w1", "Error: no watch w1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q: %q", want, out)
+		}
+	}
+}
+
+func TestHandleWatchRefused(t *testing.T) {
+	wl := &watchingListener{mockListener: newRefListener(), watches: map[string]server.Watch{}}
+	wl.responses = []string{"Error: too many watches (at most 32)\n"}
+	out := captureStdout(t, func() { handleWatch(wl, []string{"web1", "/etc"}) })
+	if !strings.Contains(out, "Error: too many watches") || len(wl.watches) != 0 {
+		t.Errorf("expected the refused watch to be dropped, got %q", out)
+	}
+}
+
+func TestReportWatchEventSavesContent(t *testing.T) {
+	origLoot := lootDir
+	lootDir = t.TempDir()
+	defer func() { lootDir = origLoot }()
+	ml := newRefListener()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	reportWatchEvent(ml)(server.WatchEvent{
+		Watch:   server.Watch{ID: "w1", ClientAddr: "10.0.0.1:1000", Path: "/etc"},
+		Kind:    protocol.WatchModified,
+		Path:    "/etc/passwd",
+		Content: []byte("root:x:0:0\n"),
+	})
+	out := logged.String()
+	if !strings.Contains(out, "Watch w1 on") || !strings.Contains(out, "/etc/passwd modified (content saved to ") {
+		t.Errorf("unexpected notification %q", out)
+	}
+	matches, _ := filepath.Glob(filepath.Join(lootDir, "*", "etc", "passwd"))
+	if len(matches) != 1 {
+		t.Fatalf("expected the content in the loot directory, found %v", matches)
+	}
+	if data, _ := os.ReadFile(matches[0]); string(data) != "root:x:0:0\n" {
+		t.Errorf("unexpected saved content %q", data)
+	}
+}
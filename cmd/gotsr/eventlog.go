@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// eventSource is the Event Log source gotsr logs under as a Windows service.
+const eventSource = "gotsr"
+
+// severity is the Event Log level of a log line.
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityError
+)
+
+// logSeverity maps a log line to an Event Log level. The client logs through
+// the standard logger, so the level is read from the wording it uses:
+// "Error: ..." and "[-] ..." for errors, "Warning: ..." and failed
+// connections or operations for warnings.
+func logSeverity(msg string) severity {
+	msg = strings.TrimSpace(msg)
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.HasPrefix(lower, "error"), strings.HasPrefix(lower, "fatal"), strings.HasPrefix(msg, "[-]"):
+		return severityError
+	case strings.HasPrefix(lower, "warning"), strings.HasPrefix(msg, "[!]"), strings.Contains(lower, "failed"):
+		return severityWarning
+	}
+	return severityInfo
+}
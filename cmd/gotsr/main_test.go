@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -124,6 +126,51 @@ func TestConnectWithRetry_ReconnectAfterHandleCommandsError(t *testing.T) {
 	}
 }
 
+func TestConnectWithRetryStopsWhenTerminated(t *testing.T) {
+	fc := &fakeClient{handleErrs: []error{client.ErrTerminated}}
+	created := 0
+	factory := func(target, secret, fingerprint string) client.ReverseClientInterface {
+		created++
+		return fc
+	}
+
+	done := make(chan struct{})
+	go func() { connectWithRetry("127.0.0.1:8443", 0, "", "", factory, noSleep); close(done) }()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connectWithRetry kept reconnecting after termination")
+	}
+	if created != 1 || fc.closed != 1 {
+		t.Fatalf("expected one client, closed once; got %d created, %d closed", created, fc.closed)
+	}
+}
+
+func TestConnectWithRetryRekeyReconnectsAtOnce(t *testing.T) {
+	fc := &fakeClient{handleErrs: []error{client.ErrRekey, client.ErrRekey, client.ErrTerminated}}
+	created := 0
+	factory := func(target, secret, fingerprint string) client.ReverseClientInterface {
+		created++
+		return fc
+	}
+	slept := false
+	sleep := func(time.Duration) { slept = true }
+
+	// A rekey is no failure, so it neither counts as a retry nor waits
+	done := make(chan struct{})
+	go func() { connectWithRetry("127.0.0.1:8443", 1, "", "", factory, sleep); close(done) }()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("connectWithRetry did not return")
+	}
+	if created != 3 || fc.closed != 3 || slept {
+		t.Fatalf("expected three clients without a pause; got %d created, %d closed, slept %v", created, fc.closed, slept)
+	}
+}
+
 func TestConnectWithRetrySuccessful(t *testing.T) {
 	fc := &fakeClient{} // No errors
 	created := 0
@@ -275,14 +322,14 @@ func TestSecretLengthValidation(t *testing.T) {
 
 // Additional tests for better coverage
 func TestRunClientWithInvalidTarget(t *testing.T) {
-	err := runClient("", 5, "", "")
+	err := runClient("", 5, "", "", client.Options{})
 	if err == nil {
 		t.Error("expected error for empty target")
 	}
 }
 
 func TestRunClientWithInvalidSecret(t *testing.T) {
-	err := runClient("localhost:9001", 5, "short", "")
+	err := runClient("localhost:9001", 5, "short", "", client.Options{})
 	if err == nil {
 		t.Error("expected error for invalid secret")
 	}
@@ -455,3 +502,93 @@ func TestConnectWithRetryWithAuthentication(t *testing.T) {
 		t.Errorf("expected fingerprint 'test-fingerprint', got '%s'", capturedFingerprint)
 	}
 }
+
+func TestApplyClientOptions(t *testing.T) {
+	cfg := config.DefaultClientConfig()
+	cfg.SNI = "env.example.com"
+	applyClientOptions(cfg, client.Options{
+		SNI:           "flag.example.com",
+		Tags:          []string{"lab"},
+		BindInterface: "eth1",
+		SourceIP:      "10.0.0.5",
+		MachineIDSalt: "engagement-42",
+		PingInterval:  10 * time.Second,
+		AdaptivePing:  true,
+		Nice:          10,
+		MemoryLimit:   64 << 20,
+	})
+
+	if cfg.SNI != "env.example.com" {
+		t.Errorf("expected env SNI to win, got %s", cfg.SNI)
+	}
+	if len(cfg.Tags) != 1 || cfg.Tags[0] != "lab" {
+		t.Errorf("expected tags from flags, got %v", cfg.Tags)
+	}
+	if cfg.BindInterface != "eth1" || cfg.SourceIP != "10.0.0.5" {
+		t.Errorf("expected bind options from flags, got %s/%s", cfg.BindInterface, cfg.SourceIP)
+	}
+	if cfg.MachineIDSalt != "engagement-42" {
+		t.Errorf("expected machine ID salt from flags, got %s", cfg.MachineIDSalt)
+	}
+	if cfg.PingInterval != 10*time.Second || !cfg.AdaptivePing {
+		t.Errorf("expected keepalive options from flags, got %s/%v", cfg.PingInterval, cfg.AdaptivePing)
+	}
+	if cfg.Nice != 10 || cfg.MemoryLimit != 64<<20 || cfg.BandwidthLimit != 0 {
+		t.Errorf("expected resource limits from flags, got %d/%d/%d", cfg.Nice, cfg.MemoryLimit, cfg.BandwidthLimit)
+	}
+}
+
+func TestOpenSealedConfig(t *testing.T) {
+	if cfg, err := openSealedConfig(); cfg != nil || err != nil {
+		t.Fatalf("expected no embedded config by default, got %+v, %v", cfg, err)
+	}
+
+	want := config.DefaultClientConfig()
+	want.Target = "listener.example:443"
+	want.SNI = "cdn.example"
+	want.Tags = []string{"lab"}
+	blob, err := config.SealClientConfig(want, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedConfig, sealedKey = blob, "pw"
+	defer func() { sealedConfig, sealedKey = "", "" }()
+
+	got, err := openSealedConfig()
+	if err != nil || got.Target != want.Target {
+		t.Fatalf("expected embedded target, got %+v, %v", got, err)
+	}
+
+	opts := sealedOptions(client.Options{SNI: "override.example"}, got)
+	if opts.SNI != "override.example" {
+		t.Errorf("expected flag to override embedded SNI, got %q", opts.SNI)
+	}
+	if len(opts.Tags) != 1 || opts.Tags[0] != "lab" {
+		t.Errorf("expected embedded tags, got %v", opts.Tags)
+	}
+}
+
+func TestReadSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := readSecretFile(path)
+	if err != nil || secret != "hunter2" {
+		t.Fatalf("readSecretFile = %q, %v", secret, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the secret file to be deleted")
+	}
+	if _, err := readSecretFile(path); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestUnsetSecretEnv(t *testing.T) {
+	t.Setenv("GOTS_SHARED_SECRET", "hunter2")
+	unsetSecretEnv()
+	if _, ok := os.LookupEnv("GOTS_SHARED_SECRET"); ok {
+		t.Error("expected GOTS_SHARED_SECRET to be unset")
+	}
+}
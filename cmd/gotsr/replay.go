@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/frjcomp/gots/pkg/client"
+	"github.com/frjcomp/gots/pkg/replay"
+)
+
+// replaySession feeds what the listener sent in a recorded session to the
+// client's command parser and writes the client's replies to out. The
+// recorded commands really run, as they did in the session.
+func replaySession(path string, out io.Writer) error {
+	frames, err := replay.Load(path)
+	if err != nil {
+		return err
+	}
+	secret := ""
+	if replay.Authenticated(frames) {
+		secret = replay.RedactedSecret
+	}
+	player := replay.NewPlayer(frames, replay.FromListener, func(data []byte) {
+		out.Write(data)
+	})
+	rc := client.NewReverseClient("replay", secret, "")
+	if err := rc.ConnectConn(player); err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	handled := make(chan error, 1)
+	go func() { handled <- rc.HandleCommands() }()
+	select {
+	case <-player.Done():
+		player.Close()
+		<-handled
+		return nil
+	case err := <-handled:
+		// The recording ended with EXIT, a kill or a rekey
+		if errors.Is(err, client.ErrTerminated) || errors.Is(err, client.ErrRekey) {
+			return nil
+		}
+		return err
+	}
+}
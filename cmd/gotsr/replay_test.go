@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/replay"
+)
+
+func TestReplaySessionRunsListenerFrames(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, f := range []replay.Frame{
+		{From: replay.FromClient, Data: []byte("AUTH " + replay.RedactedSecret + "\n")},
+		{From: replay.FromListener, Data: []byte(protocol.CmdAuthOk + "\n")},
+		{From: replay.FromListener, Data: []byte(protocol.CmdPing + "\n")},
+	} {
+		enc.Encode(f)
+	}
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := replaySession(path, &out); err != nil {
+		t.Fatalf("replaySession: %v", err)
+	}
+	if !strings.Contains(out.String(), "PONG") {
+		t.Fatalf("expected the client to answer PING, got %q", out.String())
+	}
+}
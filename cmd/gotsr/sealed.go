@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/frjcomp/gots/pkg/client"
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.sealedConfig=<blob> -X main.sealedKey=<passphrase>" ./cmd/gotsr
+//
+// The blob comes from `gotsl --seal-client-config`. Command-line flags and
+// GOTS_* variables still override the embedded values.
+var (
+	sealedConfig string
+	sealedKey    string
+)
+
+// openSealedConfig returns the embedded client configuration, or nil when
+// the binary was built without one.
+func openSealedConfig() (*config.ClientConfig, error) {
+	if sealedConfig == "" {
+		return nil, nil
+	}
+	return config.OpenClientConfig(sealedConfig, sealedKey)
+}
+
+// sealedOptions fills options left unset on the command line from the
+// embedded configuration.
+func sealedOptions(opts client.Options, sealed *config.ClientConfig) client.Options {
+	if len(opts.Tags) == 0 {
+		opts.Tags = sealed.Tags
+	}
+	opts.DisableSessionResumption = opts.DisableSessionResumption || sealed.DisableSessionResumption
+	if opts.SNI == "" {
+		opts.SNI = sealed.SNI
+	}
+	if len(opts.ALPN) == 0 {
+		opts.ALPN = sealed.ALPN
+	}
+	if opts.BindInterface == "" {
+		opts.BindInterface = sealed.BindInterface
+	}
+	if opts.SourceIP == "" {
+		opts.SourceIP = sealed.SourceIP
+	}
+	if opts.MachineIDSalt == "" {
+		opts.MachineIDSalt = sealed.MachineIDSalt
+	}
+	if opts.PingInterval == 0 {
+		opts.PingInterval = sealed.PingInterval
+	}
+	opts.AdaptivePing = opts.AdaptivePing || sealed.AdaptivePing
+	if opts.Nice == 0 {
+		opts.Nice = sealed.Nice
+	}
+	if opts.MemoryLimit == 0 {
+		opts.MemoryLimit = sealed.MemoryLimit
+	}
+	if opts.BandwidthLimit == 0 {
+		opts.BandwidthLimit = sealed.BandwidthLimit
+	}
+	if opts.MaxTransferSize == 0 {
+		opts.MaxTransferSize = sealed.MaxTransferSize
+	}
+	if opts.SSHJump == "" {
+		opts.SSHJump = sealed.SSHJump
+	}
+	if opts.SSHKey == "" {
+		opts.SSHKey = sealed.SSHKey
+	}
+	if opts.SSHPassword == "" {
+		opts.SSHPassword = sealed.SSHPassword
+	}
+	if opts.SSHHostKey == "" {
+		opts.SSHHostKey = sealed.SSHHostKey
+	}
+	if opts.Proxy == "" {
+		opts.Proxy = sealed.Proxy
+	}
+	opts.ProxyPAC = opts.ProxyPAC || sealed.ProxyPAC
+	if opts.Knock == "" {
+		opts.Knock = sealed.Knock
+	}
+	if opts.SPAKey == "" {
+		opts.SPAKey = sealed.SPAKey
+	}
+	return opts
+}
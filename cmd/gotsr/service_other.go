@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+// initServiceLog reports whether gotsr runs as a Windows service.
+func initServiceLog() bool {
+	return false
+}
+
+// runService is only reached on Windows.
+func runService(run func() error) error {
+	return run()
+}
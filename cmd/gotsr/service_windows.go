@@ -0,0 +1,104 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs of the log lines, one per severity.
+const (
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+)
+
+// eventLogWriter writes each log line to the Event Log at its severity.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\r\n")
+	var err error
+	switch logSeverity(msg) {
+	case severityError:
+		err = w.elog.Error(eventIDError, msg)
+	case severityWarning:
+		err = w.elog.Warning(eventIDWarning, msg)
+	default:
+		err = w.elog.Info(eventIDInfo, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// initServiceLog sends the log to the Event Log when gotsr was started by
+// the service control manager, which gives it no console. The source is
+// registered on first start; services usually run as LocalSystem, which
+// may write the registry key. It reports whether gotsr runs as a service.
+func initServiceLog() bool {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false
+	}
+	err = eventlog.InstallAsEventCreate(eventSource, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil && !strings.Contains(err.Error(), "registry key already exists") {
+		// Unregistered sources still log, with a generic description
+		log.Printf("Warning: failed to register event source %s: %v", eventSource, err)
+	}
+	elog, err := eventlog.Open(eventSource)
+	if err != nil {
+		log.Printf("Warning: failed to open the event log: %v", err)
+		return true
+	}
+	// The Event Log timestamps each entry itself
+	log.SetFlags(0)
+	log.SetOutput(eventLogWriter{elog: elog})
+	return true
+}
+
+// runService runs the client under the service control manager until it
+// gives up or the service is stopped.
+func runService(run func() error) error {
+	return svc.Run(eventSource, &clientService{run: run})
+}
+
+// clientService adapts the client loop to the svc.Handler interface.
+type clientService struct {
+	run func() error
+}
+
+func (s *clientService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() { done <- s.run() }()
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Error: %v", err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Printf("Service stopping")
+				status <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
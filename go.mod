@@ -3,10 +3,14 @@ module github.com/frjcomp/gots
 go 1.25.4
 
 require (
+	filippo.io/age v1.2.1
 	github.com/UserExistsError/conpty v0.1.4
 	github.com/chzyer/readline v1.5.1
 	github.com/creack/pty v1.1.24
+	golang.org/x/crypto v0.36.0
 	golang.org/x/net v0.38.0
 	golang.org/x/sys v0.39.0
 	golang.org/x/term v0.38.0
 )
+
+require golang.org/x/text v0.23.0 // indirect
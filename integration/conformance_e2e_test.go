@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/internal/e2e"
+	"github.com/frjcomp/gots/pkg/certs"
+)
+
+// outputValue returns the rest of the first output line containing prefix.
+func outputValue(t *testing.T, p *e2e.Proc, prefix string) string {
+	t.Helper()
+	p.WaitForContains(t, prefix, 10*time.Second)
+	for _, line := range strings.Split(p.Output(), "\n") {
+		if _, value, ok := strings.Cut(line, prefix); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// TestConformanceOfGotsr checks gotsr with gotsconform, which must find
+// every feature conforming.
+func TestConformanceOfGotsr(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e2e.DefaultTimeout)
+	defer cancel()
+	secret, err := certs.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := e2e.FreePort(t)
+	conform := e2e.Start(ctx, t, e2e.BuildBinary(t, "gotsconform", "./cmd/gotsconform"),
+		"--port", port, "--interface", "127.0.0.1", "-s", secret, "--remote-dir", t.TempDir())
+	fingerprint := outputValue(t, conform, "Certificate fingerprint (SHA256): ")
+	conform.WaitForContains(t, "Waiting up to", 10*time.Second)
+
+	e2e.Start(ctx, t, e2e.BuildBinary(t, "gotsr", "./cmd/gotsr"),
+		"--target", "127.0.0.1:"+port, "--retries", "1", "-s", secret, "--cert-fingerprint", fingerprint)
+	conform.WaitForExit(t, 60*time.Second)
+	out := conform.Output()
+	for _, feature := range []string{"auth", "ident", "exec", "upload", "download", "peek", "list", "pty", "forward", "socks"} {
+		if !strings.Contains(out, "PASS  "+feature+" ") {
+			t.Errorf("expected %s to pass; output:\n%s", feature, out)
+		}
+	}
+}
+
+// TestConformanceOfGotsl checks gotsl with gotsconform, which must find
+// every feature conforming.
+func TestConformanceOfGotsl(t *testing.T) {
+	env := e2e.Spawn(t, e2e.Options{ListenerArgs: []string{"-s"}})
+	secret := outputValue(t, env.Listener, "Secret (hex): ")
+	conform := e2e.Start(context.Background(), t, e2e.BuildBinary(t, "gotsconform", "./cmd/gotsconform"),
+		"--target", env.Addr, "-s", secret)
+	conform.WaitForExit(t, 60*time.Second)
+	out := conform.Output()
+	for _, feature := range []string{"auth-reject", "auth", "ident", "keepalive"} {
+		if !strings.Contains(out, "PASS  "+feature+" ") {
+			t.Errorf("expected %s to pass; output:\n%s", feature, out)
+		}
+	}
+}
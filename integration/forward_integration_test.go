@@ -66,7 +66,7 @@ func TestSocksBasic(t *testing.T) {
 		sendCalls = append(sendCalls, msg)
 	}
 	
-	err := sm.StartSocks("test", "0", sendFunc)
+	err := sm.StartSocks("test", "0", false, sendFunc)
 	if err != nil {
 		t.Fatalf("Failed to start SOCKS: %v", err)
 	}
@@ -139,7 +139,7 @@ func TestSocksConnectionAcceptance(t *testing.T) {
 		// Capture sent messages
 	}
 	
-	err := sm.StartSocks("test", "0", sendFunc)
+	err := sm.StartSocks("test", "0", false, sendFunc)
 	if err != nil {
 		t.Fatalf("Failed to start SOCKS: %v", err)
 	}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/internal/e2e"
+)
+
+// TestMultipleClientsEndToEnd connects three clients and checks that each
+// session identifier reaches the client process that announced it.
+func TestMultipleClientsEndToEnd(t *testing.T) {
+	env := e2e.Spawn(t, e2e.Options{Clients: 3})
+	listener := env.Listener
+
+	listener.Send("ls\n")
+	listener.WaitForContains(t, "Connected Clients:", 5*time.Second)
+	listener.WaitForContains(t, "3.", 5*time.Second)
+
+	for _, client := range env.Clients {
+		listener.Send("sysinfo " + client.SessionID(t) + "\n")
+		listener.WaitForContains(t, fmt.Sprintf("(pid %d,", client.Pid()), 10*time.Second)
+	}
+
+	listener.Send("exit\n")
+	listener.WaitForExit(t, 5*time.Second)
+}
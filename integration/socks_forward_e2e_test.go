@@ -8,38 +8,22 @@ import (
 	"testing"
 	"time"
 
+	"github.com/frjcomp/gots/internal/e2e"
 	"golang.org/x/net/proxy"
 )
 
 // TestSocksProxyEndToEnd spins listener+reverse, starts a SOCKS proxy, and fetches from a local HTTP server through it.
 func TestSocksProxyEndToEnd(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping integration test in short mode")
-	}
-
+	env := e2e.Spawn(t, e2e.Options{Clients: 1})
+	listener := env.Listener
 	httpSrv := newLocalHTTPServer(t, "socks-ok")
-	socksPort := freePort(t)
-	listenPort := freePort(t)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
-	defer cancel()
-
-	listenerBin := buildBinary(t, "gotsl", "./cmd/gotsl")
-	reverseBin := buildBinary(t, "gotsr", "./cmd/gotsr")
-
-	listener := startProcess(ctx, t, listenerBin, "--port", listenPort, "--interface", "127.0.0.1")
-	t.Cleanup(listener.stop)
-	waitForContains(t, listener, "Listener ready. Waiting for connections", 10*time.Second)
-
-	reverse := startProcess(ctx, t, reverseBin, "--target", "127.0.0.1:"+listenPort, "--retries", "1")
-	t.Cleanup(reverse.stop)
-	waitForContains(t, reverse, "Connected to listener successfully", 10*time.Second)
+	socksPort := e2e.FreePort(t)
 
-	send(listener, "ls\n")
-	waitForContains(t, listener, "Connected Clients:", 5*time.Second)
+	listener.Send("ls\n")
+	listener.WaitForContains(t, "Connected Clients:", 5*time.Second)
 
-	send(listener, "socks 1 "+socksPort+"\n")
-	waitForContains(t, listener, "SOCKS5 proxy started", 5*time.Second)
+	listener.Send("socks 1 " + socksPort + "\n")
+	listener.WaitForContains(t, "SOCKS5 proxy started", 5*time.Second)
 
 	// Build SOCKS5 HTTP client
 	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:"+socksPort, nil, proxy.Direct)
@@ -77,30 +61,13 @@ func TestSocksProxyEndToEnd(t *testing.T) {
 
 // TestForwardingEndToEnd starts a port forward through the client and calls a local HTTP server through it.
 func TestForwardingEndToEnd(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping integration test in short mode")
-	}
-
+	env := e2e.Spawn(t, e2e.Options{Clients: 1})
+	listener := env.Listener
 	httpSrv := newLocalHTTPServer(t, "fwd-ok")
-	forwardPort := freePort(t)
-	listenPort := freePort(t)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
-	defer cancel()
-
-	listenerBin := buildBinary(t, "gotsl", "./cmd/gotsl")
-	reverseBin := buildBinary(t, "gotsr", "./cmd/gotsr")
-
-	listener := startProcess(ctx, t, listenerBin, "--port", listenPort, "--interface", "127.0.0.1")
-	t.Cleanup(listener.stop)
-	waitForContains(t, listener, "Listener ready. Waiting for connections", 10*time.Second)
-
-	reverse := startProcess(ctx, t, reverseBin, "--target", "127.0.0.1:"+listenPort, "--retries", "1")
-	t.Cleanup(reverse.stop)
-	waitForContains(t, reverse, "Connected to listener successfully", 10*time.Second)
+	forwardPort := e2e.FreePort(t)
 
-	send(listener, "forward 1 "+forwardPort+" "+httpSrv+"\n")
-	waitForContains(t, listener, "Port forward started", 5*time.Second)
+	listener.Send("forward 1 " + forwardPort + " " + httpSrv + "\n")
+	listener.WaitForContains(t, "Port forward started", 5*time.Second)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	url := "http://127.0.0.1:" + forwardPort
@@ -128,7 +95,7 @@ func TestForwardingEndToEnd(t *testing.T) {
 // newLocalHTTPServer starts a simple HTTP server that returns the provided body on any request.
 func newLocalHTTPServer(t *testing.T, body string) string {
 	t.Helper()
-	port := freePort(t)
+	port := e2e.FreePort(t)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, body)
@@ -0,0 +1,282 @@
+// Package e2e runs the gotsl and gotsr binaries for end-to-end tests: it
+// builds them, starts a listener with any number of clients on the loopback
+// interface and waits for their output, so a test only has to drive the
+// listener's REPL and check what it prints.
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Output the harness waits for.
+const (
+	ListenerReady   = "Listener ready. Waiting for connections"
+	ClientConnected = "Connected to listener successfully"
+	clientAccepted  = "New client connected"
+)
+
+// DefaultTimeout bounds a whole Env when Options.Timeout is zero.
+const DefaultTimeout = 90 * time.Second
+
+// startTimeout bounds how long a process may take to report it is ready.
+const startTimeout = 10 * time.Second
+
+// Options configures Spawn.
+type Options struct {
+	Clients      int           // Clients started and connected before Spawn returns
+	ListenerArgs []string      // Added to gotsl's --port and --interface
+	ClientArgs   []string      // Added to every gotsr's --target and --retries 1
+	Timeout      time.Duration // Kills all processes after this; DefaultTimeout when zero
+}
+
+// Env is a listener and its clients, stopped when the test ends.
+type Env struct {
+	Listener *Proc
+	Clients  []*Proc // In connection order; see Proc.SessionID to name one
+	Addr     string  // Address the listener accepts clients on
+
+	ctx        context.Context
+	gotsr      string
+	clientArgs []string
+}
+
+// Spawn builds gotsl and gotsr, starts the listener on a free loopback port
+// and connects opts.Clients clients to it, one after the other. Integration
+// tests are skipped in short mode, so Spawn skips the test then.
+func Spawn(t *testing.T, opts Options) *Env {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
+
+	port := FreePort(t)
+	gotsl := BuildBinary(t, "gotsl", "./cmd/gotsl")
+	e := &Env{
+		Addr:       "127.0.0.1:" + port,
+		ctx:        ctx,
+		gotsr:      BuildBinary(t, "gotsr", "./cmd/gotsr"),
+		clientArgs: opts.ClientArgs,
+	}
+	args := append([]string{"--port", port, "--interface", "127.0.0.1"}, opts.ListenerArgs...)
+	e.Listener = Start(ctx, t, gotsl, args...)
+	e.Listener.WaitForContains(t, ListenerReady, startTimeout)
+	for range opts.Clients {
+		e.AddClient(t)
+	}
+	return e
+}
+
+// AddClient starts another gotsr with Options.ClientArgs and args and waits
+// until both sides see the connection.
+func (e *Env) AddClient(t *testing.T, args ...string) *Proc {
+	t.Helper()
+	all := append([]string{"--target", e.Addr, "--retries", "1"}, e.clientArgs...)
+	p := Start(e.ctx, t, e.gotsr, append(all, args...)...)
+	p.WaitForContains(t, ClientConnected, startTimeout)
+	e.Clients = append(e.Clients, p)
+	e.Listener.WaitForCount(t, clientAccepted, len(e.Clients), startTimeout)
+	return p
+}
+
+// Send types data into the listener's REPL; end commands with "\n".
+func (e *Env) Send(data string) {
+	e.Listener.Send(data)
+}
+
+// Proc is a running process whose stdout and stderr are captured.
+type Proc struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	output   bytes.Buffer
+	captured chan struct{} // Closed once stdout and stderr are at EOF
+	mu       sync.Mutex
+}
+
+// Start runs bin with args until ctx ends or the test is over.
+func Start(ctx context.Context, t *testing.T, bin string, args ...string) *Proc {
+	t.Helper()
+	cmd := exec.CommandContext(ctx, bin, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("stdout pipe: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatalf("stderr pipe: %v", err)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("stdin pipe: %v", err)
+	}
+
+	p := &Proc{cmd: cmd, stdin: stdin, captured: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.capture(stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		p.capture(stderr)
+	}()
+	go func() {
+		wg.Wait()
+		close(p.captured)
+	}()
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start %s: %v", bin, err)
+	}
+	t.Cleanup(p.Stop)
+	return p
+}
+
+func (p *Proc) capture(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		p.mu.Lock()
+		p.output.WriteString(line)
+		p.output.WriteByte('\n')
+		p.mu.Unlock()
+	}
+}
+
+// Stop closes the process's stdin and kills it if it is still running.
+func (p *Proc) Stop() {
+	_ = p.stdin.Close()
+	if p.cmd.ProcessState == nil || !p.cmd.ProcessState.Exited() {
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+	}
+}
+
+// Send writes data to the process's stdin.
+func (p *Proc) Send(data string) {
+	_, _ = io.WriteString(p.stdin, data)
+}
+
+// Pid returns the process ID.
+func (p *Proc) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// SessionID returns the session identifier a gotsr process announced. It
+// names the client in listener commands, unlike ls numbers, whose order is
+// not fixed while several clients are connected.
+func (p *Proc) SessionID(t *testing.T) string {
+	t.Helper()
+	const prefix = "Session ID: "
+	p.WaitForContains(t, prefix, startTimeout)
+	for _, line := range strings.Split(p.Output(), "\n") {
+		if _, id, ok := strings.Cut(line, prefix); ok {
+			return strings.TrimSpace(id)
+		}
+	}
+	return ""
+}
+
+// Output returns everything the process printed so far.
+func (p *Proc) Output() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output.String()
+}
+
+// WaitForContains waits until the output so far contains substr.
+func (p *Proc) WaitForContains(t *testing.T, substr string, timeout time.Duration) {
+	t.Helper()
+	p.WaitForCount(t, substr, 1, timeout)
+}
+
+// WaitForCount waits until the output so far contains substr at least n
+// times, e.g. to wait for the answer to a repeated command.
+func (p *Proc) WaitForCount(t *testing.T, substr string, n int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if strings.Count(p.Output(), substr) >= n {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			t.Fatalf("timeout waiting for output containing %q %d times; output so far:\n%s", substr, n, p.Output())
+		}
+	}
+}
+
+// WaitForExit waits for the process to exit successfully.
+func (p *Proc) WaitForExit(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		// Wait closes the pipes, so let the output be read to the end first
+		<-p.captured
+		done <- p.cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("process exited with error: %v; output:\n%s", err, p.Output())
+		}
+	case <-time.After(timeout):
+		t.Fatalf("timeout waiting for process exit; output so far:\n%s", p.Output())
+	}
+}
+
+// FreePort returns a TCP port on the loopback interface that was free a
+// moment ago.
+func FreePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return fmt.Sprintf("%d", l.Addr().(*net.TCPAddr).Port)
+}
+
+// BuildBinary builds the main package pkg, given relative to the module
+// root (e.g. "./cmd/gotsl"), into a temporary directory of the test.
+func BuildBinary(t *testing.T, name, pkg string) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), name)
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(out), ".exe") {
+		out += ".exe"
+	}
+	target := pkg
+	if strings.HasPrefix(pkg, "./") {
+		target = "github.com/frjcomp/gots" + strings.TrimPrefix(pkg, ".")
+	}
+	cmd := exec.Command("go", "build", "-o", out, target)
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("build %s failed: %v; output: %s", name, err, buf.String())
+	}
+	return out
+}
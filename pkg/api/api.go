@@ -0,0 +1,731 @@
+// Package api implements the listener's HTTP control API, used by operators
+// and tooling that drive gotsl without the interactive REPL.
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/audit"
+	"github.com/frjcomp/gots/pkg/auth"
+	"github.com/frjcomp/gots/pkg/geoip"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// Server serves the control API for a Listener.
+type Server struct {
+	listener *server.Listener
+	auth     auth.Authenticator
+	mux      *http.ServeMux
+	policies auth.Policies // Per-operator client and capability restrictions
+	audit    *audit.Logger // Records actions and denials; nil disables auditing
+
+	tunnelsMu    sync.Mutex
+	tunnels      map[string]string      // Forward or SOCKS ID -> client address, for tunnels started here
+	tunnelClient func(id string) string // Client of tunnels started elsewhere, e.g. the REPL; may be nil
+}
+
+// ClientInfo describes a connected client in API responses.
+type ClientInfo struct {
+	Address    string      `json:"address"`
+	Identifier string      `json:"identifier,omitempty"`
+	OS         string      `json:"os,omitempty"`
+	Hostname   string      `json:"hostname,omitempty"`
+	IP         string      `json:"ip,omitempty"`
+	ReverseDNS string      `json:"reverse_dns,omitempty"` // Name of the source IP, when lookups are enabled
+	Geo        *geoip.Info `json:"geo,omitempty"`         // Location and network owner of the source IP
+	Tags       []string    `json:"tags,omitempty"`
+	ServerName string      `json:"server_name,omitempty"`
+	Profile    string      `json:"profile,omitempty"`
+	MachineID  string      `json:"machine_id,omitempty"`
+	// PendingPrompt is set while a command waits for a password; answer it
+	// with POST /api/clients/{client}/secret.
+	PendingPrompt string `json:"pending_prompt,omitempty"`
+	// DuplicateOf names the older live session of the same host when this
+	// client is a duplicate, e.g. a second gotsr started on that machine.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Quarantined says why the listener ignores the client's frames, after
+	// it sent too many malformed ones.
+	Quarantined string `json:"quarantined,omitempty"`
+	// PendingApproval is set while the client waits for an operator to
+	// approve it with POST /api/clients/{client}/approve.
+	PendingApproval bool `json:"pending_approval,omitempty"`
+	// SandboxFlags says why the client looks like an analysis sandbox or
+	// honeypot, when sandbox checks are enabled.
+	SandboxFlags []string `json:"sandbox_flags,omitempty"`
+	// Integrity says why the client's executable is not one of the
+	// recorded builds, when client hashes are configured.
+	Integrity string `json:"integrity,omitempty"`
+	// Link approximates the health of the client's connection from
+	// heartbeats and received bytes.
+	Link *server.LinkQuality `json:"link,omitempty"`
+	// Capabilities lists the features the client was built with; absent for
+	// clients that predate capability negotiation.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Locks lists the operators working with the client, e.g. in a PTY
+	// shell or a transfer, oldest first.
+	Locks []server.SessionLock `json:"locks,omitempty"`
+}
+
+// AssetInfo describes a host in GET /api/assets, with its connection history.
+type AssetInfo struct {
+	MachineID string             `json:"machine_id"`
+	Hostname  string             `json:"hostname,omitempty"`
+	OS        string             `json:"os,omitempty"`
+	Tags      []string           `json:"tags,omitempty"`
+	Online    bool               `json:"online"`
+	FirstSeen time.Time          `json:"first_seen"`
+	LastSeen  time.Time          `json:"last_seen"`
+	Sessions  []AssetSessionInfo `json:"sessions"`
+}
+
+// AssetSessionInfo is one connection of an asset.
+type AssetSessionInfo struct {
+	Address      string     `json:"address"`
+	Identifier   string     `json:"identifier,omitempty"`
+	IP           string     `json:"ip,omitempty"`
+	Connected    time.Time  `json:"connected"`
+	Disconnected *time.Time `json:"disconnected,omitempty"`
+}
+
+// ExecRequest is the body of POST /api/clients/{client}/exec. Prompt
+// relays the command's password prompts, to be answered through
+// /api/clients/{client}/secret.
+type ExecRequest struct {
+	Command string `json:"command"`
+	Prompt  bool   `json:"prompt"`
+}
+
+// ExecResponse is returned by POST /api/clients/{client}/exec.
+type ExecResponse struct {
+	Output string `json:"output"`
+}
+
+// SecretRequest is the body of POST /api/clients/{client}/secret. Cancel
+// declines the prompt instead of answering it.
+type SecretRequest struct {
+	Secret string `json:"secret"`
+	Cancel bool   `json:"cancel"`
+}
+
+// ForwardRequest is the body of POST /api/clients/{client}/forward.
+type ForwardRequest struct {
+	LocalPort  string `json:"local_port"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// SocksRequest is the body of POST /api/clients/{client}/socks. Test checks
+// the proxy through the client before responding.
+type SocksRequest struct {
+	LocalPort string `json:"local_port"`
+	Test      bool   `json:"test"`
+}
+
+// LockedResponse is returned with 409 Conflict when another operator holds
+// the client. Repeat the request with ?override=true to proceed anyway.
+type LockedResponse struct {
+	Error string             `json:"error"`
+	Lock  server.SessionLock `json:"lock"`
+}
+
+// StartedResponse returns the ID of a started forward or SOCKS proxy, and
+// the outcome of a SOCKS self-test when one was asked for.
+type StartedResponse struct {
+	ID            string                `json:"id"`
+	SelfTest      *server.SocksSelfTest `json:"self_test,omitempty"`
+	SelfTestError string                `json:"self_test_error,omitempty"`
+}
+
+type ctxKey struct{}
+
+// OperatorFromContext returns the operator authenticated for a request.
+func OperatorFromContext(ctx context.Context) (auth.Operator, bool) {
+	op, ok := ctx.Value(ctxKey{}).(auth.Operator)
+	return op, ok
+}
+
+// HealthStatus is returned by /healthz and /readyz.
+type HealthStatus struct {
+	Status    string            `json:"status"` // "ok" or "unavailable"
+	Accepting bool              `json:"accepting"`
+	Clients   int               `json:"clients"`
+	Checks    map[string]string `json:"checks"` // Component -> "ok" or error
+}
+
+// NewServer creates a control API server. Every /api route requires
+// authentication; mutating routes additionally require the admin role.
+// /healthz and /readyz are unauthenticated so supervisors can probe them.
+func NewServer(l *server.Listener, authenticator auth.Authenticator) *Server {
+	s := &Server{
+		listener: l,
+		auth:     authenticator,
+		mux:      http.NewServeMux(),
+		tunnels:  make(map[string]string),
+	}
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.mux.HandleFunc("GET /api/whoami", s.require(auth.RoleReadOnly, s.handleWhoami))
+	s.mux.HandleFunc("GET /api/clients", s.require(auth.RoleReadOnly, s.handleClients))
+	s.mux.HandleFunc("POST /api/clients/{client}/exec", s.require(auth.RoleAdmin, s.handleExec))
+	s.mux.HandleFunc("POST /api/clients/{client}/secret", s.require(auth.RoleAdmin, s.handleSecret))
+	s.mux.HandleFunc("POST /api/clients/{client}/approve", s.require(auth.RoleAdmin, s.handleApprove))
+	s.mux.HandleFunc("GET /api/assets", s.require(auth.RoleReadOnly, s.handleAssets))
+	s.mux.HandleFunc("GET /api/forwards", s.require(auth.RoleReadOnly, s.handleForwards))
+	s.mux.HandleFunc("GET /api/socks", s.require(auth.RoleReadOnly, s.handleSocks))
+	s.mux.HandleFunc("GET /api/metrics", s.require(auth.RoleReadOnly, s.handleMetrics))
+	s.mux.HandleFunc("POST /api/clients/{client}/forward", s.require(auth.RoleAdmin, s.handleStartForward))
+	s.mux.HandleFunc("POST /api/clients/{client}/socks", s.require(auth.RoleAdmin, s.handleStartSocks))
+	return s
+}
+
+// SetPolicies sets the per-operator policies enforced on client routes.
+func (s *Server) SetPolicies(policies auth.Policies) {
+	s.policies = policies
+}
+
+// SetTunnelClient sets the lookup of the client a forward or SOCKS proxy
+// runs through, for tunnels not started through the API. Operators limited
+// to some clients only see tunnels whose client is in their scope.
+func (s *Server) SetTunnelClient(lookup func(id string) string) {
+	s.tunnelClient = lookup
+}
+
+// SetAuditLogger sets the logger receiving actions and access denials.
+func (s *Server) SetAuditLogger(logger *audit.Logger) {
+	s.audit = logger
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start serves the API over TLS on address ("host:port" or "unix:///path")
+// in a background goroutine and returns the underlying net.Listener so
+// callers can close it.
+func (s *Server) Start(address string, tlsConfig *tls.Config) (net.Listener, error) {
+	ln, err := server.ListenTLS(address, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start control API: %w", err)
+	}
+	srv := &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Control API stopped: %v", err)
+		}
+	}()
+	return ln, nil
+}
+
+// require wraps a handler with authentication and a minimum role check.
+func (s *Server) require(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op, err := s.auth.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gotsl", Bearer`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !op.Role.Allows(role) {
+			log.Printf("[-] Control API: operator %s (%s) denied %s %s", op.Name, op.Role, r.Method, r.URL.Path)
+			s.audit.Record(audit.Event{
+				Operator: op.Name,
+				Action:   r.Method + " " + r.URL.Path,
+				Client:   r.PathValue("client"),
+				Reason:   "role " + string(op.Role),
+			})
+			writeError(w, http.StatusForbidden, fmt.Sprintf("role %s may not perform this action", op.Role))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, op)))
+	}
+}
+
+// health collects component checks. The listener is ready once its accept
+// loop runs and the audit log (if any) is writable.
+func (s *Server) health() HealthStatus {
+	status := HealthStatus{
+		Status:    "ok",
+		Accepting: s.listener.IsAccepting(),
+		Clients:   len(s.listener.GetClients()),
+		Checks:    map[string]string{"listener": "ok"},
+	}
+	if !status.Accepting {
+		status.Checks["listener"] = "not accepting connections"
+		status.Status = "unavailable"
+	}
+	if s.audit != nil {
+		status.Checks["audit_log"] = "ok"
+		if err := s.audit.Err(); err != nil {
+			status.Checks["audit_log"] = err.Error()
+			status.Status = "unavailable"
+		}
+	}
+	return status
+}
+
+// handleHealthz reports liveness: the process is up and serving HTTP.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status := s.health()
+	status.Status = "ok"
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleReadyz reports readiness and fails while any check fails.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := s.health()
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	op, _ := OperatorFromContext(r.Context())
+	writeJSON(w, http.StatusOK, op)
+}
+
+// authorize resolves the {client} path value and checks the operator's
+// policy for capability c, writing the error response and auditing the
+// decision. It returns the client address and whether to proceed.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, c auth.Capability) (string, bool) {
+	op, _ := OperatorFromContext(r.Context())
+	clientAddr, ok := s.lookupClient(r.PathValue("client"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "client not found")
+		return "", false
+	}
+
+	policy := s.policies.For(op.Name)
+	event := audit.Event{Operator: op.Name, Action: string(c), Client: clientAddr}
+	meta, _ := s.listener.GetClientMetadata(clientAddr)
+	switch {
+	case !policy.AllowsClient(meta.Tags):
+		event.Reason = "client not in operator scope"
+	case !policy.Allows(c):
+		event.Reason = "capability denied by policy"
+	case s.listener.EngagementOver():
+		event.Reason = "engagement is over"
+	case s.listener.PendingApproval(clientAddr):
+		event.Reason = "client pending approval"
+	default:
+		event.Allowed = true
+		s.audit.Record(event)
+		return clientAddr, true
+	}
+
+	log.Printf("[-] Control API: operator %s denied %s on %s: %s", op.Name, c, clientAddr, event.Reason)
+	s.audit.Record(event)
+	writeError(w, http.StatusForbidden, event.Reason)
+	return "", false
+}
+
+// lockSession takes the operator's soft lock on a client. If another
+// operator holds it, it answers 409 with the lock unless the request has
+// ?override=true, in which case the override is audited. Handlers that only
+// start something long-lived release the lock right away, which makes this
+// a check.
+func (s *Server) lockSession(w http.ResponseWriter, r *http.Request, clientAddr, reason string) (func(), bool) {
+	op, _ := OperatorFromContext(r.Context())
+	override := r.URL.Query().Get("override") == "true"
+	var overridden []string
+	for _, lock := range s.listener.SessionLocks(clientAddr) {
+		if lock.Operator != op.Name {
+			overridden = append(overridden, lock.Operator+":"+lock.Reason)
+		}
+	}
+
+	release, err := s.listener.LockSession(clientAddr, op.Name, reason, override)
+	var locked *server.LockedError
+	switch {
+	case errors.As(err, &locked):
+		writeJSON(w, http.StatusConflict, LockedResponse{Error: err.Error(), Lock: locked.Lock})
+		return nil, false
+	case err != nil:
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if len(overridden) > 0 {
+		s.audit.Record(audit.Event{
+			Operator: op.Name,
+			Action:   "override-lock",
+			Client:   clientAddr,
+			Allowed:  true,
+			Reason:   "held by " + strings.Join(overridden, ","),
+		})
+	}
+	return release, true
+}
+
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	op, _ := OperatorFromContext(r.Context())
+	policy := s.policies.For(op.Name)
+	clients := make([]ClientInfo, 0)
+	for _, addr := range s.listener.GetClientAddressesSorted() {
+		meta, _ := s.listener.GetClientMetadata(addr)
+		if !policy.AllowsClient(meta.Tags) {
+			continue
+		}
+		prompt, _ := s.listener.PendingPrompt(addr)
+		primary, _ := s.listener.DuplicateOf(addr)
+		quarantined, _ := s.listener.Quarantined(addr)
+		var geo *geoip.Info
+		if info := s.listener.GeoIP(addr); !info.Empty() {
+			geo = &info
+		}
+		var link *server.LinkQuality
+		if q, ok := s.listener.LinkQuality(addr); ok {
+			link = &q
+		}
+		clients = append(clients, ClientInfo{
+			Address:         addr,
+			Identifier:      s.listener.GetClientIdentifier(addr),
+			OS:              meta.OS,
+			Hostname:        meta.Hostname,
+			IP:              meta.IP,
+			ReverseDNS:      s.listener.ReverseDNS(addr),
+			Geo:             geo,
+			Tags:            meta.Tags,
+			ServerName:      meta.ServerName,
+			Profile:         meta.Profile,
+			MachineID:       meta.MachineID,
+			PendingPrompt:   prompt,
+			DuplicateOf:     primary,
+			Quarantined:     quarantined,
+			PendingApproval: s.listener.PendingApproval(addr),
+			SandboxFlags:    s.listener.SandboxFlags(addr),
+			Integrity:       s.listener.IntegrityFlag(addr),
+			Link:            link,
+			Capabilities:    meta.Capabilities,
+			Locks:           s.listener.SessionLocks(addr),
+		})
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request) {
+	op, _ := OperatorFromContext(r.Context())
+	policy := s.policies.For(op.Name)
+	assets := make([]AssetInfo, 0)
+	for _, a := range s.listener.Assets() {
+		if !policy.AllowsClient(a.Tags) {
+			continue
+		}
+		info := AssetInfo{
+			MachineID: a.MachineID,
+			Hostname:  a.Hostname,
+			OS:        a.OS,
+			Tags:      a.Tags,
+			Online:    a.Online(),
+			FirstSeen: a.FirstSeen,
+			LastSeen:  a.LastSeen,
+			Sessions:  make([]AssetSessionInfo, 0, len(a.Sessions)),
+		}
+		for _, sess := range a.Sessions {
+			si := AssetSessionInfo{Address: sess.Address, Identifier: sess.Identifier, IP: sess.IP, Connected: sess.Connected}
+			if !sess.Disconnected.IsZero() {
+				disconnected := sess.Disconnected
+				si.Disconnected = &disconnected
+			}
+			info.Sessions = append(info.Sessions, si)
+		}
+		assets = append(assets, info)
+	}
+	writeJSON(w, http.StatusOK, assets)
+}
+
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	clientAddr, ok := s.authorize(w, r, auth.CapExec)
+	if !ok {
+		return
+	}
+
+	var req ExecRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || strings.TrimSpace(req.Command) == "" {
+		writeError(w, http.StatusBadRequest, "expected JSON body with a non-empty command")
+		return
+	}
+	if s.listener.IsInPtyMode(clientAddr) {
+		writeError(w, http.StatusConflict, "client is in PTY mode")
+		return
+	}
+	command, timeout := req.Command, protocol.CommandTimeout*time.Second
+	if req.Prompt {
+		if meta, _ := s.listener.GetClientMetadata(clientAddr); !meta.Announces(protocol.CapPrompt) {
+			writeError(w, http.StatusConflict, "client does not relay password prompts")
+			return
+		}
+		command = protocol.CmdPrompted + " " + command
+		timeout += protocol.PromptTimeout * time.Second
+	}
+	release, ok := s.lockSession(w, r, clientAddr, "exec")
+	if !ok {
+		return
+	}
+	defer release()
+
+	var resp string
+	status := http.StatusOK
+	err := s.listener.Scheduler().Run(r.Context(), clientAddr, []string{server.ResponseKey}, func() error {
+		if err := s.listener.SendCommand(clientAddr, command); err != nil {
+			status = http.StatusBadGateway
+			return err
+		}
+		var err error
+		resp, err = s.listener.GetResponse(clientAddr, timeout)
+		if err != nil {
+			status = http.StatusGatewayTimeout
+		}
+		return err
+	})
+	if err != nil {
+		if status == http.StatusOK {
+			// Never started: the request was cancelled or the listener is shutting down
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ExecResponse{Output: strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")})
+}
+
+// handleSecret answers a password prompt. The secret is never logged or
+// written to the audit log.
+func (s *Server) handleSecret(w http.ResponseWriter, r *http.Request) {
+	clientAddr, ok := s.authorize(w, r, auth.CapExec)
+	if !ok {
+		return
+	}
+
+	var req SecretRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || req.Secret == "" && !req.Cancel {
+		writeError(w, http.StatusBadRequest, "expected JSON body with a secret or cancel")
+		return
+	}
+	release, ok := s.lockSession(w, r, clientAddr, "secret")
+	if !ok {
+		return
+	}
+	release()
+	var err error
+	if req.Cancel {
+		err = s.listener.CancelPrompt(clientAddr)
+	} else {
+		err = s.listener.SendSecret(clientAddr, req.Secret)
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleApprove lets a client pending approval accept commands, transfers
+// and tunnels.
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	op, _ := OperatorFromContext(r.Context())
+	clientAddr, ok := s.lookupClient(r.PathValue("client"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "client not found")
+		return
+	}
+	event := audit.Event{Operator: op.Name, Action: "approve", Client: clientAddr}
+	meta, _ := s.listener.GetClientMetadata(clientAddr)
+	if !s.policies.For(op.Name).AllowsClient(meta.Tags) {
+		event.Reason = "client not in operator scope"
+		s.audit.Record(event)
+		writeError(w, http.StatusForbidden, event.Reason)
+		return
+	}
+	if err := s.listener.Approve(clientAddr); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	event.Allowed = true
+	s.audit.Record(event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStartForward(w http.ResponseWriter, r *http.Request) {
+	clientAddr, ok := s.authorize(w, r, auth.CapForward)
+	if !ok {
+		return
+	}
+
+	var req ForwardRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || req.LocalPort == "" || req.RemoteAddr == "" {
+		writeError(w, http.StatusBadRequest, "expected JSON body with local_port and remote_addr")
+		return
+	}
+	release, ok := s.lockSession(w, r, clientAddr, "forward")
+	if !ok {
+		return
+	}
+	release()
+
+	fwdID := fmt.Sprintf("fwd-%d", time.Now().UnixNano())
+	sendFunc := func(msg string) {
+		_ = s.listener.SendCommand(clientAddr, msg)
+	}
+	if err := s.listener.GetForwardManager().StartForward(fwdID, req.LocalPort, req.RemoteAddr, sendFunc); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.recordTunnel(fwdID, clientAddr)
+	writeJSON(w, http.StatusCreated, StartedResponse{ID: fwdID})
+}
+
+func (s *Server) handleStartSocks(w http.ResponseWriter, r *http.Request) {
+	clientAddr, ok := s.authorize(w, r, auth.CapSocks)
+	if !ok {
+		return
+	}
+
+	var req SocksRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || req.LocalPort == "" {
+		writeError(w, http.StatusBadRequest, "expected JSON body with local_port")
+		return
+	}
+	release, ok := s.lockSession(w, r, clientAddr, "socks")
+	if !ok {
+		return
+	}
+	release()
+
+	socksID := fmt.Sprintf("socks-%d", time.Now().UnixNano())
+	sendFunc := func(msg string) {
+		_ = s.listener.SendCommand(clientAddr, msg)
+	}
+	meta, _ := s.listener.GetClientMetadata(clientAddr)
+	if err := s.listener.GetSocksManager().StartSocks(socksID, req.LocalPort, meta.Announces(protocol.CapSocksErr), sendFunc); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.recordTunnel(socksID, clientAddr)
+	resp := StartedResponse{ID: socksID}
+	if req.Test {
+		if meta.ListenerIP == "" {
+			resp.SelfTestError = "the client is not connected over TCP"
+		} else if result, err := s.listener.GetSocksManager().SelfTest(socksID, meta.ListenerIP); err != nil {
+			resp.SelfTestError = err.Error()
+		} else {
+			resp.SelfTest = &result
+		}
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// recordTunnel remembers the client a tunnel started through the API runs
+// through.
+func (s *Server) recordTunnel(id, clientAddr string) {
+	s.tunnelsMu.Lock()
+	defer s.tunnelsMu.Unlock()
+	s.tunnels[id] = clientAddr
+}
+
+// tunnelVisible reports whether the operator's policy lets them see a
+// tunnel. Tunnels whose client is unknown or gone are only shown to
+// operators that are not limited to some clients.
+func (s *Server) tunnelVisible(policy auth.Policy, id string) bool {
+	if len(policy.ClientTags) == 0 {
+		return true
+	}
+	s.tunnelsMu.Lock()
+	clientAddr, ok := s.tunnels[id]
+	s.tunnelsMu.Unlock()
+	if !ok && s.tunnelClient != nil {
+		clientAddr = s.tunnelClient(id)
+	}
+	if clientAddr == "" {
+		return false
+	}
+	meta, ok := s.listener.GetClientMetadata(clientAddr)
+	return ok && policy.AllowsClient(meta.Tags)
+}
+
+// handleForwards lists the forwards, leaving out those through clients
+// outside the operator's scope.
+func (s *Server) handleForwards(w http.ResponseWriter, r *http.Request) {
+	type forward struct {
+		ID         string `json:"id"`
+		LocalAddr  string `json:"local_addr"`
+		RemoteAddr string `json:"remote_addr"`
+	}
+	op, _ := OperatorFromContext(r.Context())
+	policy := s.policies.For(op.Name)
+	out := make([]forward, 0)
+	for _, fwd := range s.listener.GetForwardManager().ListForwards() {
+		if !s.tunnelVisible(policy, fwd.ID) {
+			continue
+		}
+		out = append(out, forward{ID: fwd.ID, LocalAddr: fwd.LocalAddr, RemoteAddr: fwd.RemoteAddr})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleSocks lists the SOCKS proxies, leaving out those through clients
+// outside the operator's scope.
+func (s *Server) handleSocks(w http.ResponseWriter, r *http.Request) {
+	type socks struct {
+		ID        string `json:"id"`
+		LocalAddr string `json:"local_addr"`
+	}
+	op, _ := OperatorFromContext(r.Context())
+	policy := s.policies.For(op.Name)
+	out := make([]socks, 0)
+	for _, p := range s.listener.GetSocksManager().ListSocks() {
+		if !s.tunnelVisible(policy, p.ID) {
+			continue
+		}
+		out = append(out, socks{ID: p.ID, LocalAddr: p.LocalAddr})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleMetrics serves session and tunnel traffic in the Prometheus text
+// format. Sessions and tunnels the operator's policy hides are left out.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	op, _ := OperatorFromContext(r.Context())
+	policy := s.policies.For(op.Name)
+	samples := slices.DeleteFunc(s.listener.Traffic(), func(sample server.TrafficSample) bool {
+		if sample.Kind != server.TrafficSession {
+			return !s.tunnelVisible(policy, sample.ID)
+		}
+		meta, _ := s.listener.GetClientMetadata(sample.ID)
+		return !policy.AllowsClient(meta.Tags)
+	})
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	server.WriteMetrics(w, samples)
+}
+
+// lookupClient resolves a client by address or announced identifier.
+func (s *Server) lookupClient(id string) (string, bool) {
+	for _, addr := range s.listener.GetClientAddressesSorted() {
+		if addr == id || s.listener.GetClientIdentifier(addr) == id {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,433 @@
+package api
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/audit"
+	"github.com/frjcomp/gots/pkg/auth"
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+type roleByToken map[string]auth.Role
+
+func (m roleByToken) Authenticate(r *http.Request) (auth.Operator, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	role, ok := m[token]
+	if !ok {
+		return auth.Operator{}, auth.ErrNoCredentials
+	}
+	return auth.Operator{Name: token, Role: role}, nil
+}
+
+func newTestServer() *Server {
+	l := server.NewListener("0", "127.0.0.1", nil, "")
+	return NewServer(l, roleByToken{"admin": auth.RoleAdmin, "viewer": auth.RoleReadOnly})
+}
+
+func doRequest(s *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUnauthenticatedRequestRejected(t *testing.T) {
+	rec := doRequest(newTestServer(), "GET", "/api/clients", "", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestReadOnlyCanListClients(t *testing.T) {
+	rec := doRequest(newTestServer(), "GET", "/api/clients", "viewer", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var clients []ClientInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(clients) != 0 {
+		t.Errorf("expected no clients, got %d", len(clients))
+	}
+}
+
+func TestReadOnlyCannotExec(t *testing.T) {
+	rec := doRequest(newTestServer(), "POST", "/api/clients/abc/exec", "viewer", `{"command":"id"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestAdminExecUnknownClient(t *testing.T) {
+	rec := doRequest(newTestServer(), "POST", "/api/clients/abc/exec", "admin", `{"command":"id"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestWhoami(t *testing.T) {
+	rec := doRequest(newTestServer(), "GET", "/api/whoami", "admin", "")
+	var op auth.Operator
+	if err := json.Unmarshal(rec.Body.Bytes(), &op); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if op.Name != "admin" || op.Role != auth.RoleAdmin {
+		t.Errorf("unexpected operator: %+v", op)
+	}
+}
+
+// startWithClient starts a real listener and connects a raw TLS client that
+// announces itself with the given IDENT line.
+func startWithClient(t *testing.T, ident string) (*server.Listener, string) {
+	t.Helper()
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+	l := server.NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	ln, err := l.Start()
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := conn.Write([]byte(ident + "\n")); err != nil {
+		t.Fatalf("failed to send IDENT: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, addr := range l.GetClientAddressesSorted() {
+			if meta, ok := l.GetClientMetadata(addr); ok && meta.Identifier != "" {
+				return l, addr
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("client did not register")
+	return nil, ""
+}
+
+func TestExecPromptNeedsRelay(t *testing.T) {
+	l, _ := startWithClient(t, "IDENT abcd1234 os=linux caps=exec")
+	s := NewServer(l, roleByToken{"admin": auth.RoleAdmin})
+	rec := doRequest(s, "POST", "/api/clients/abcd1234/exec", "admin", `{"command":"sudo -S id","prompt":true}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "password prompts") {
+		t.Fatalf("expected 409 for a client without the prompt relay, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPolicyRestrictsClientsAndCapabilities(t *testing.T) {
+	l, _ := startWithClient(t, "IDENT abcd1234 os=linux tags=prod")
+	var buf bytes.Buffer
+	s := NewServer(l, roleByToken{"alice": auth.RoleAdmin, "bob": auth.RoleAdmin})
+	s.SetPolicies(auth.Policies{
+		"alice": {ClientTags: []string{"lab"}},
+		"bob":   {Deny: []auth.Capability{auth.CapSocks}},
+	})
+	s.SetAuditLogger(audit.New(&buf))
+
+	rec := doRequest(s, "GET", "/api/clients", "alice", "")
+	var clients []ClientInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(clients) != 0 {
+		t.Errorf("expected out-of-scope client to be hidden, got %+v", clients)
+	}
+
+	rec = doRequest(s, "POST", "/api/clients/abcd1234/exec", "alice", `{"command":"id"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for out-of-scope client, got %d", rec.Code)
+	}
+
+	rec = doRequest(s, "POST", "/api/clients/abcd1234/socks", "bob", `{"local_port":"0"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for denied capability, got %d", rec.Code)
+	}
+
+	rec = doRequest(s, "GET", "/api/clients", "bob", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(clients) != 1 || len(clients[0].Tags) != 1 || clients[0].Tags[0] != "prod" {
+		t.Errorf("expected tagged client to be listed for bob, got %+v", clients)
+	}
+
+	var events []audit.Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e audit.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(events))
+	}
+	if events[0].Operator != "alice" || events[0].Action != "exec" || events[0].Allowed {
+		t.Errorf("unexpected first audit event: %+v", events[0])
+	}
+	if events[1].Operator != "bob" || events[1].Action != "socks" || events[1].Allowed {
+		t.Errorf("unexpected second audit event: %+v", events[1])
+	}
+}
+
+func TestPolicyFiltersTunnels(t *testing.T) {
+	l, _ := startWithClient(t, "IDENT abcd1234 os=linux tags=prod")
+	s := NewServer(l, roleByToken{"alice": auth.RoleAdmin, "bob": auth.RoleAdmin})
+	s.SetPolicies(auth.Policies{"alice": {ClientTags: []string{"lab"}}})
+	t.Cleanup(func() {
+		for _, fwd := range l.GetForwardManager().ListForwards() {
+			l.GetForwardManager().StopForward(fwd.ID)
+		}
+		for _, p := range l.GetSocksManager().ListSocks() {
+			l.GetSocksManager().StopSocks(p.ID)
+		}
+	})
+
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/forward", "bob", `{"local_port":"0","remote_addr":"127.0.0.1:22"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for forward, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/socks", "bob", `{"local_port":"0"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for socks, got %d: %s", rec.Code, rec.Body)
+	}
+	// Started elsewhere, e.g. from the REPL, through an unknown client
+	if err := l.GetSocksManager().StartSocks("socks-repl", "0", false, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(path, token string) int {
+		var items []map[string]any
+		rec := doRequest(s, "GET", path, token, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("invalid JSON from %s: %v", path, err)
+		}
+		return len(items)
+	}
+	if n := count("/api/forwards", "alice"); n != 0 {
+		t.Errorf("expected alice to see no forwards, got %d", n)
+	}
+	if n := count("/api/socks", "alice"); n != 0 {
+		t.Errorf("expected alice to see no SOCKS proxies, got %d", n)
+	}
+	if n := count("/api/forwards", "bob"); n != 1 {
+		t.Errorf("expected bob to see 1 forward, got %d", n)
+	}
+	if n := count("/api/socks", "bob"); n != 2 {
+		t.Errorf("expected bob to see 2 SOCKS proxies, got %d", n)
+	}
+
+	s.SetPolicies(auth.Policies{"alice": {ClientTags: []string{"prod"}}})
+	s.SetTunnelClient(func(id string) string {
+		if id == "socks-repl" {
+			return l.GetClients()[0]
+		}
+		return ""
+	})
+	if n := count("/api/socks", "alice"); n != 2 {
+		t.Errorf("expected alice to see both SOCKS proxies through the prod client, got %d", n)
+	}
+}
+
+func TestSessionLockConflictAndOverride(t *testing.T) {
+	l, addr := startWithClient(t, "IDENT abcd1234 os=linux")
+	var buf bytes.Buffer
+	s := NewServer(l, roleByToken{"alice": auth.RoleAdmin, "bob": auth.RoleAdmin})
+	s.SetAuditLogger(audit.New(&buf))
+
+	release, err := l.LockSession(addr, "alice", "pty", false)
+	if err != nil {
+		t.Fatalf("LockSession failed: %v", err)
+	}
+	defer release()
+
+	rec := doRequest(s, "POST", "/api/clients/abcd1234/exec", "bob", `{"command":"id"}`)
+	var conflict LockedResponse
+	if rec.Code != http.StatusConflict || json.Unmarshal(rec.Body.Bytes(), &conflict) != nil || conflict.Lock.Operator != "alice" {
+		t.Fatalf("expected 409 naming alice, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doRequest(s, "GET", "/api/clients", "bob", "")
+	var clients []ClientInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(clients) != 1 || len(clients[0].Locks) != 1 || clients[0].Locks[0].Reason != "pty" {
+		t.Errorf("expected the lock to be listed, got %+v", clients)
+	}
+
+	buf.Reset()
+	rec = doRequest(s, "POST", "/api/clients/abcd1234/socks?override=true", "bob", `{"local_port":"0"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected override to proceed, got %d: %s", rec.Code, rec.Body)
+	}
+	var started StartedResponse
+	json.Unmarshal(rec.Body.Bytes(), &started)
+	defer l.GetSocksManager().StopSocks(started.ID)
+	if !strings.Contains(buf.String(), `"action":"override-lock"`) || !strings.Contains(buf.String(), "alice:pty") {
+		t.Errorf("expected the override to be audited, got %s", buf.String())
+	}
+	if locks := l.SessionLocks(addr); len(locks) != 1 {
+		t.Errorf("expected bob's check not to keep a lock, got %+v", locks)
+	}
+}
+
+func TestRoleDenialIsAudited(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestServer()
+	s.SetAuditLogger(audit.New(&buf))
+
+	doRequest(s, "POST", "/api/clients/abc/exec", "viewer", `{"command":"id"}`)
+
+	var e audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid audit line %q: %v", buf.String(), err)
+	}
+	if e.Operator != "viewer" || e.Allowed || e.Client != "abc" {
+		t.Errorf("unexpected audit event: %+v", e)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	s := newTestServer()
+
+	rec := doRequest(s, "GET", "/healthz", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected unauthenticated /healthz to return 200, got %d", rec.Code)
+	}
+
+	rec = doRequest(s, "GET", "/readyz", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the listener starts, got %d", rec.Code)
+	}
+
+	l, _ := startWithClient(t, "IDENT abcd1234 os=linux")
+	s = NewServer(l, roleByToken{})
+	rec = doRequest(s, "GET", "/readyz", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 once accepting, got %d: %s", rec.Code, rec.Body)
+	}
+	var status HealthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !status.Accepting || status.Clients != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestAssetsEndpoint(t *testing.T) {
+	l, _ := startWithClient(t, "IDENT abcd1234 os=linux host=web1 mid=0123456789abcdef")
+	s := NewServer(l, roleByToken{"alice": auth.RoleReadOnly})
+
+	rec := doRequest(s, http.MethodGet, "/api/assets", "alice", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var assets []AssetInfo
+	if err := json.NewDecoder(rec.Body).Decode(&assets); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(assets) != 1 || assets[0].MachineID != "0123456789abcdef" || !assets[0].Online || len(assets[0].Sessions) != 1 {
+		t.Errorf("unexpected assets: %+v", assets)
+	}
+}
+
+func TestPendingApproval(t *testing.T) {
+	l, addr := startWithClient(t, "IDENT abcd1234 os=linux mid=0123abcd")
+	l.SetRequireApproval(true)
+	s := NewServer(l, roleByToken{"admin": auth.RoleAdmin, "viewer": auth.RoleReadOnly})
+
+	rec := doRequest(s, "GET", "/api/clients", "viewer", "")
+	var clients []ClientInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &clients); err != nil || len(clients) != 1 || !clients[0].PendingApproval {
+		t.Fatalf("expected a pending client, got %s", rec.Body)
+	}
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/socks", "admin", `{"local_port":"0"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a pending client, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/approve", "viewer", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected read-only operators not to approve, got %d", rec.Code)
+	}
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/approve", "admin", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if l.PendingApproval(addr) {
+		t.Error("expected the client to be approved")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	l, addr := startWithClient(t, "IDENT abcd1234 os=linux host=web1")
+	s := NewServer(l, roleByToken{"alice": auth.RoleReadOnly})
+
+	rec := doRequest(s, http.MethodGet, "/api/metrics", "alice", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if want := `gots_session_received_bytes_total{client="` + addr + `"}`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected %s in:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestMetricsPolicyHidesTunnels(t *testing.T) {
+	l, addr := startWithClient(t, "IDENT abcd1234 os=linux tags=prod")
+	s := NewServer(l, roleByToken{"alice": auth.RoleReadOnly, "bob": auth.RoleAdmin})
+	s.SetPolicies(auth.Policies{"alice": {ClientTags: []string{"lab"}}})
+	t.Cleanup(func() {
+		for _, fwd := range l.GetForwardManager().ListForwards() {
+			l.GetForwardManager().StopForward(fwd.ID)
+		}
+		for _, p := range l.GetSocksManager().ListSocks() {
+			l.GetSocksManager().StopSocks(p.ID)
+		}
+	})
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/forward", "bob", `{"local_port":"0","remote_addr":"127.0.0.1:22"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for forward, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doRequest(s, "POST", "/api/clients/abcd1234/socks", "bob", `{"local_port":"0"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for socks, got %d: %s", rec.Code, rec.Body)
+	}
+
+	metrics := func(token string) string {
+		rec := doRequest(s, http.MethodGet, "/api/metrics", token, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	body := metrics("alice")
+	for _, hidden := range []string{addr, `kind="forward"`, `kind="socks"`} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("expected %s to be hidden from alice:\n%s", hidden, body)
+		}
+	}
+	body = metrics("bob")
+	for _, want := range []string{addr, `kind="forward"`, `kind="socks"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s for bob:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package audit records operator actions and access decisions as JSON lines
+// so they can be reviewed after an engagement.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is a single audit log entry.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	Action   string    `json:"action"`
+	Client   string    `json:"client,omitempty"`
+	Allowed  bool      `json:"allowed"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Logger appends events to a writer. A nil *Logger discards events, so
+// callers do not need to check whether auditing is enabled.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	err    error // Last write error, reported by Err
+	mirror func(Event)
+}
+
+// New creates a Logger writing to w.
+func New(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+// Open creates a Logger appending to the file at path.
+func Open(path string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Logger{w: f, closer: f}, nil
+}
+
+// Mirror passes every event recorded from now on to fn as well, e.g. to
+// forward it to a system logger.
+func (l *Logger) Mirror(fn func(Event)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mirror = fn
+}
+
+// Record writes an event, filling in the timestamp when unset.
+func (l *Logger) Record(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	_, l.err = l.w.Write(append(data, '\n'))
+	mirror := l.mirror
+	l.mu.Unlock()
+	if mirror != nil {
+		mirror(e)
+	}
+}
+
+// Err returns the error from the most recent write, if it failed.
+func (l *Logger) Err() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close closes the underlying file, if any.
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
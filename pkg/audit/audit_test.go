@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+	l.Record(Event{Operator: "alice", Action: "socks", Client: "10.0.0.5:4444", Reason: "capability denied"})
+	l.Record(Event{Operator: "bob", Action: "exec", Allowed: true})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if e.Operator != "alice" || e.Allowed || e.Time.IsZero() {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
+
+func TestNilLoggerIsNoop(t *testing.T) {
+	var l *Logger
+	l.Record(Event{Operator: "x"})
+	if err := l.Close(); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		l, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		l.Record(Event{Operator: "op", Action: "exec", Allowed: true})
+		l.Close()
+	}
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("expected 2 appended lines, got %d", n)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestLoggerErr(t *testing.T) {
+	l := New(failingWriter{})
+	if l.Err() != nil {
+		t.Fatal("expected no error before the first write")
+	}
+	l.Record(Event{Operator: "alice"})
+	if l.Err() == nil {
+		t.Error("expected write error to be reported")
+	}
+
+	var nilLogger *Logger
+	if nilLogger.Err() != nil {
+		t.Error("expected nil logger to report no error")
+	}
+}
+
+func TestMirror(t *testing.T) {
+	l := New(io.Discard)
+	var got []Event
+	l.Mirror(func(e Event) { got = append(got, e) })
+	l.Record(Event{Operator: "alice", Action: "exec", Client: "10.0.0.5:1", Allowed: true})
+	if len(got) != 1 || got[0].Operator != "alice" || got[0].Time.IsZero() {
+		t.Errorf("unexpected mirrored events %+v", got)
+	}
+}
@@ -0,0 +1,99 @@
+// Package auth implements operator authentication backends for the control
+// API: a static bearer token, an htpasswd file and OIDC bearer tokens.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is the access level granted to an authenticated operator.
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"     // Full access, including commands and transfers
+	RoleReadOnly Role = "read-only" // May only list and inspect
+)
+
+// ParseRole converts a config string to a Role.
+func ParseRole(s string) (Role, error) {
+	switch Role(strings.ToLower(strings.TrimSpace(s))) {
+	case RoleAdmin:
+		return RoleAdmin, nil
+	case RoleReadOnly, "readonly", "":
+		return RoleReadOnly, nil
+	default:
+		return "", fmt.Errorf("unknown role %q (expected admin or read-only)", s)
+	}
+}
+
+// Allows reports whether r grants at least the required role.
+func (r Role) Allows(required Role) bool {
+	if r == RoleAdmin {
+		return true
+	}
+	return r == required
+}
+
+// Operator is an authenticated control API user.
+type Operator struct {
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Backend string `json:"backend"`
+}
+
+// ErrNoCredentials is returned by a backend when the request carries no
+// credentials it understands, so the next backend in a Chain can try.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator authenticates an HTTP request to an operator.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Operator, error)
+}
+
+// Chain tries each authenticator in order and returns the first success.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (Operator, error) {
+	lastErr := ErrNoCredentials
+	for _, a := range c {
+		op, err := a.Authenticate(r)
+		if err == nil {
+			return op, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			lastErr = err
+		}
+	}
+	return Operator{}, lastErr
+}
+
+// RoleMap maps operator names to roles with a fallback for unlisted names.
+type RoleMap struct {
+	Roles   map[string]Role
+	Default Role
+}
+
+// RoleFor returns the role configured for name.
+func (m RoleMap) RoleFor(name string) Role {
+	if role, ok := m.Roles[name]; ok {
+		return role
+	}
+	if m.Default == "" {
+		return RoleReadOnly
+	}
+	return m.Default
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[7:])
+	return token, token != ""
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseRole(t *testing.T) {
+	if r, err := ParseRole("admin"); err != nil || r != RoleAdmin {
+		t.Errorf("expected admin, got %q (%v)", r, err)
+	}
+	if r, err := ParseRole("read-only"); err != nil || r != RoleReadOnly {
+		t.Errorf("expected read-only, got %q (%v)", r, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Error("expected error for unknown role")
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	if !RoleAdmin.Allows(RoleReadOnly) || !RoleAdmin.Allows(RoleAdmin) {
+		t.Error("admin should allow everything")
+	}
+	if RoleReadOnly.Allows(RoleAdmin) {
+		t.Error("read-only must not allow admin actions")
+	}
+}
+
+func TestStaticToken(t *testing.T) {
+	a := StaticToken{Token: "s3cret"}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := a.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials without header, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	if _, err := a.Authenticate(req); err == nil || errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected invalid token error, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	op, err := a.Authenticate(req)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if op.Role != RoleAdmin {
+		t.Errorf("expected admin role, got %s", op.Role)
+	}
+}
+
+func TestApr1Crypt(t *testing.T) {
+	// Generated with: openssl passwd -apr1 -salt 8y3yMwr1 secret
+	want := "$apr1$8y3yMwr1$ZwJBpmNRT78mdlk8T9TEy/"
+	if got := apr1Crypt("secret", "8y3yMwr1"); got != want {
+		t.Fatalf("apr1Crypt = %s, want %s", got, want)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# operators\n" +
+		"alice:$apr1$8y3yMwr1$ZwJBpmNRT78mdlk8T9TEy/\n" +
+		"bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHtpasswd(path, RoleMap{Roles: map[string]Role{"alice": RoleAdmin}})
+	if err != nil {
+		t.Fatalf("LoadHtpasswd failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", "secret")
+	op, err := h.Authenticate(req)
+	if err != nil || op.Name != "alice" || op.Role != RoleAdmin {
+		t.Errorf("alice: got %+v, %v", op, err)
+	}
+
+	req.SetBasicAuth("bob", "secret")
+	op, err = h.Authenticate(req)
+	if err != nil || op.Role != RoleReadOnly {
+		t.Errorf("bob: got %+v, %v", op, err)
+	}
+
+	req.SetBasicAuth("bob", "wrong")
+	if _, err := h.Authenticate(req); err == nil {
+		t.Error("expected failure for wrong password")
+	}
+}
+
+func TestHtpasswdBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// htpasswd -B writes the $2y$ prefix.
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("carol:$2y$"+string(hash[4:])+"\n"), 0600)
+	h, err := LoadHtpasswd(path, RoleMap{})
+	if err != nil {
+		t.Fatalf("LoadHtpasswd failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("carol", "secret")
+	if op, err := h.Authenticate(req); err != nil || op.Name != "carol" {
+		t.Errorf("carol: got %+v, %v", op, err)
+	}
+	req.SetBasicAuth("carol", "wrong")
+	if _, err := h.Authenticate(req); err == nil {
+		t.Error("expected failure for wrong password")
+	}
+}
+
+func TestLoadHtpasswdRejectsMalformedHashes(t *testing.T) {
+	for _, line := range []string{"carol:$2y$05$abcdefghijklmnopqrstuu\n", "dave:plaintext\n"} {
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		os.WriteFile(path, []byte(line), 0600)
+		if _, err := LoadHtpasswd(path, RoleMap{}); err == nil {
+			t.Errorf("expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestChainFallsThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0600)
+	h, _ := LoadHtpasswd(path, RoleMap{})
+	chain := Chain{StaticToken{Token: "tok"}, h}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("bob", "secret")
+	op, err := chain.Authenticate(req)
+	if err != nil || op.Backend != "htpasswd" {
+		t.Errorf("expected htpasswd backend, got %+v, %v", op, err)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	if _, err := chain.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig configures validation of OIDC ID/access tokens.
+type OIDCConfig struct {
+	Issuer      string   // Expected "iss"; discovery is fetched from Issuer/.well-known/openid-configuration
+	Audience    string   // Expected "aud" (usually the client ID); required
+	RoleClaim   string   // Claim holding groups/roles, defaults to "groups"
+	AdminValues []string // Values of RoleClaim that grant the admin role
+	Roles       RoleMap  // Per-operator overrides keyed by verified email or sub
+}
+
+// OIDC authenticates bearer JWTs issued by an OpenID Connect provider.
+// Only RS256 and ES256 signatures are accepted.
+type OIDC struct {
+	cfg        OIDCConfig
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// keyRefreshInterval limits JWKS refetches triggered by unknown key IDs.
+const keyRefreshInterval = time.Minute
+
+// NewOIDC creates an OIDC authenticator. Keys are fetched lazily on first use.
+func NewOIDC(cfg OIDCConfig) *OIDC {
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = "groups"
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &OIDC{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+// Authenticate implements Authenticator.
+func (o *OIDC) Authenticate(r *http.Request) (Operator, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return Operator{}, ErrNoCredentials
+	}
+	claims, err := o.verify(token)
+	if err != nil {
+		return Operator{}, fmt.Errorf("invalid OIDC token: %w", err)
+	}
+
+	// Role overrides and policies are keyed by the operator name, so only
+	// claims the user cannot pick freely may set it: a verified email or
+	// the subject. preferred_username is neither unique nor stable.
+	var name string
+	if verified, _ := claims["email_verified"].(bool); verified {
+		name = claimString(claims, "email")
+	}
+	if name == "" {
+		name = claimString(claims, "sub")
+	}
+	if name == "" {
+		return Operator{}, errors.New("invalid OIDC token: no sub claim")
+	}
+
+	role := o.cfg.Roles.RoleFor(name)
+	if _, overridden := o.cfg.Roles.Roles[name]; !overridden {
+		for _, v := range claimStrings(claims, o.cfg.RoleClaim) {
+			if slices.Contains(o.cfg.AdminValues, v) {
+				role = RoleAdmin
+				break
+			}
+		}
+	}
+	return Operator{Name: name, Role: role, Backend: "oidc"}, nil
+}
+
+func (o *OIDC) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("bad header: %w", err)
+	}
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("bad claims: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("bad signature encoding: %w", err)
+	}
+
+	key, err := o.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("signature verification failed")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return nil, errors.New("signature verification failed")
+		}
+		rInt := new(big.Int).SetBytes(sig[:32])
+		sInt := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], rInt, sInt) {
+			return nil, errors.New("signature verification failed")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	if iss := claimString(claims, "iss"); strings.TrimSuffix(iss, "/") != o.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if o.cfg.Audience == "" || !slices.Contains(claimStrings(claims, "aud"), o.cfg.Audience) {
+		return nil, errors.New("token not issued for this audience")
+	}
+	now := o.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+// key returns the signing key for kid, refreshing the JWKS when unknown.
+func (o *OIDC) key(kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if !o.lastRefresh.IsZero() && o.now().Sub(o.lastRefresh) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	o.lastRefresh = o.now()
+	keys, err := o.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	o.keys = keys
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (o *OIDC) fetchKeys() (map[string]crypto.PublicKey, error) {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := o.getJSON(o.cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document has no jwks_uri")
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(url string, v any) error {
+	resp, err := o.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func claimString(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// claimStrings returns a claim that may be a single string or a string array.
+func claimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
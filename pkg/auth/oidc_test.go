@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": ti.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	ti.server = httptest.NewServer(mux)
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+func (ti *testIssuer) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ti.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	ti := newTestIssuer(t)
+	o := NewOIDC(OIDCConfig{
+		Issuer:      ti.server.URL,
+		Audience:    "gotsl",
+		AdminValues: []string{"redteam-leads"},
+		Roles:       RoleMap{Roles: map[string]Role{"boss@example.com": RoleAdmin, "boss": RoleAdmin}},
+	})
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		wantErr  bool
+		wantRole Role
+	}{
+		{"admin group", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": exp, "sub": "lead", "groups": []string{"redteam-leads"}}, false, RoleAdmin},
+		{"read-only", map[string]any{"iss": ti.server.URL, "aud": []string{"other", "gotsl"}, "exp": exp, "sub": "op1"}, false, RoleReadOnly},
+		{"verified email override", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": exp, "email": "boss@example.com", "email_verified": true, "sub": "op2"}, false, RoleAdmin},
+		{"unverified email ignored", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": exp, "email": "boss@example.com", "sub": "op2"}, false, RoleReadOnly},
+		{"preferred_username ignored", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": exp, "preferred_username": "boss", "sub": "op3"}, false, RoleReadOnly},
+		{"no subject", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": exp, "preferred_username": "boss"}, true, ""},
+		{"wrong audience", map[string]any{"iss": ti.server.URL, "aud": "other", "exp": exp, "sub": "op1"}, true, ""},
+		{"wrong issuer", map[string]any{"iss": "https://evil.example", "aud": "gotsl", "exp": exp, "sub": "op1"}, true, ""},
+		{"expired", map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": float64(time.Now().Add(-time.Hour).Unix()), "sub": "op1"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+ti.sign(t, tt.claims))
+			op, err := o.Authenticate(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", op)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if op.Role != tt.wantRole {
+				t.Errorf("expected role %s, got %s", tt.wantRole, op.Role)
+			}
+		})
+	}
+}
+
+func TestOIDCRejectsTamperedToken(t *testing.T) {
+	ti := newTestIssuer(t)
+	o := NewOIDC(OIDCConfig{Issuer: ti.server.URL, Audience: "gotsl"})
+	token := ti.sign(t, map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": float64(time.Now().Add(time.Hour).Unix()), "sub": "op"})
+
+	forged, _ := json.Marshal(map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": float64(time.Now().Add(time.Hour).Unix()), "sub": "admin"})
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tampered)
+	if _, err := o.Authenticate(req); err == nil {
+		t.Fatal("expected tampered token to be rejected")
+	}
+}
+
+func TestOIDCRequiresAudience(t *testing.T) {
+	ti := newTestIssuer(t)
+	o := NewOIDC(OIDCConfig{Issuer: ti.server.URL})
+	token := ti.sign(t, map[string]any{"iss": ti.server.URL, "aud": "gotsl", "exp": float64(time.Now().Add(time.Hour).Unix()), "sub": "op"})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := o.Authenticate(req); err == nil {
+		t.Fatal("expected tokens to be rejected without a configured audience")
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Capability names an operation an operator may perform on a client. Only
+// operations the control API offers are capabilities, so that a policy
+// never denies something it cannot enforce.
+type Capability string
+
+const (
+	CapExec    Capability = "exec"
+	CapForward Capability = "forward"
+	CapSocks   Capability = "socks"
+)
+
+// Capabilities lists every known capability.
+var Capabilities = []Capability{CapExec, CapForward, CapSocks}
+
+// ParseCapability validates a capability name from config.
+func ParseCapability(s string) (Capability, error) {
+	c := Capability(s)
+	if !slices.Contains(Capabilities, c) {
+		return "", fmt.Errorf("unknown capability %q", s)
+	}
+	return c, nil
+}
+
+// Policy restricts what an operator may do beyond their role.
+type Policy struct {
+	ClientTags []string     // Clients must carry at least one of these tags; empty allows all clients
+	Deny       []Capability // Capabilities the operator may not use
+}
+
+// AnyOperator is the Policies key applied to operators without their own entry.
+const AnyOperator = "*"
+
+// Policies maps operator names to policies.
+type Policies map[string]Policy
+
+// For returns the policy for an operator, falling back to the "*" entry.
+// Operators without any matching entry are unrestricted.
+func (p Policies) For(operator string) Policy {
+	if policy, ok := p[operator]; ok {
+		return policy
+	}
+	return p[AnyOperator]
+}
+
+// AllowsClient reports whether a client with the given tags is in scope.
+func (p Policy) AllowsClient(tags []string) bool {
+	if len(p.ClientTags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(p.ClientTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the capability is permitted.
+func (p Policy) Allows(c Capability) bool {
+	return !slices.Contains(p.Deny, c)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import "testing"
+
+func TestPoliciesFor(t *testing.T) {
+	policies := Policies{
+		"alice":     {ClientTags: []string{"lab"}, Deny: []Capability{CapForward, CapSocks}},
+		AnyOperator: {Deny: []Capability{CapExec}},
+	}
+
+	alice := policies.For("alice")
+	if !alice.AllowsClient([]string{"web", "lab"}) {
+		t.Error("alice should reach clients tagged lab")
+	}
+	if alice.AllowsClient([]string{"prod"}) || alice.AllowsClient(nil) {
+		t.Error("alice must not reach untagged or prod clients")
+	}
+	if alice.Allows(CapForward) || alice.Allows(CapSocks) {
+		t.Error("alice must not use forward or socks")
+	}
+	if !alice.Allows(CapExec) {
+		t.Error("alice should be allowed to exec")
+	}
+
+	bob := policies.For("bob")
+	if bob.Allows(CapExec) || !bob.Allows(CapForward) {
+		t.Error("bob should fall back to the wildcard policy")
+	}
+	if !bob.AllowsClient(nil) {
+		t.Error("wildcard policy without tags should allow all clients")
+	}
+
+	if !(Policies{}).For("carol").Allows(CapSocks) {
+		t.Error("operators without policies should be unrestricted")
+	}
+}
+
+func TestParseCapability(t *testing.T) {
+	if c, err := ParseCapability("socks"); err != nil || c != CapSocks {
+		t.Errorf("expected socks, got %q (%v)", c, err)
+	}
+	for _, name := range []string{"nuke", "shell", "upload", "download"} {
+		if _, err := ParseCapability(name); err == nil {
+			t.Errorf("expected error for %q, which the control API cannot enforce", name)
+		}
+	}
+}
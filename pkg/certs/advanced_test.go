@@ -84,3 +84,26 @@ func TestCertificateOrganization(t *testing.T) {
 		t.Fatalf("expected org %s, got %s", expectedOrg, cert.Leaf.Subject.Organization[0])
 	}
 }
+
+func TestGenerateCertSubject(t *testing.T) {
+	subject := Presets["esxi"]
+	subject.SANs = []string{"esx01.example.com", "10.0.0.5"}
+	cert, _, err := GenerateCert(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := cert.Leaf
+	if leaf.Subject.CommonName != "localhost.localdomain" || leaf.Subject.OrganizationalUnit[0] != "VMware ESX Server Default Certificate" {
+		t.Errorf("unexpected subject %s", leaf.Subject)
+	}
+	if len(leaf.Subject.Province) != 1 || len(leaf.Subject.StreetAddress) != 0 {
+		t.Errorf("expected only the set fields in the subject, got %s", leaf.Subject)
+	}
+	if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "esx01.example.com" {
+		t.Errorf("unexpected DNS names %v", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || leaf.IPAddresses[0].String() != "10.0.0.5" {
+		t.Errorf("unexpected IP addresses %v", leaf.IPAddresses)
+	}
+}
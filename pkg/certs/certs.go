@@ -15,9 +15,95 @@ import (
 	"time"
 )
 
+// Subject is the identity a generated certificate claims. SANs lists the
+// subject alternative names; IP addresses among them become IP SANs.
+type Subject struct {
+	CommonName         string
+	Organization       string
+	OrganizationalUnit string
+	Locality           string
+	Province           string
+	Country            string
+	SANs               []string
+}
+
+// DefaultSubject is the subject of certificates generated without one.
+var DefaultSubject = Subject{
+	CommonName:   "localhost",
+	Organization: "Reverse Shell Listener",
+	SANs:         []string{"localhost", "127.0.0.1", "::1"},
+}
+
+// Presets are the subjects of default self-signed certificates of common
+// products, so a generated certificate blends in with what scanners expect
+// to find on such a port.
+var Presets = map[string]Subject{
+	"esxi": {
+		CommonName:         "localhost.localdomain",
+		Organization:       "VMware, Inc",
+		OrganizationalUnit: "VMware ESX Server Default Certificate",
+		Locality:           "Palo Alto",
+		Province:           "California",
+		Country:            "US",
+		SANs:               []string{"localhost.localdomain"},
+	},
+	"fortigate": {
+		CommonName:         "FortiGate",
+		Organization:       "Fortinet",
+		OrganizationalUnit: "FortiGate",
+		Locality:           "Sunnyvale",
+		Province:           "California",
+		Country:            "US",
+		SANs:               []string{"FortiGate"},
+	},
+	"iis": {
+		CommonName: "localhost",
+		SANs:       []string{"localhost"},
+	},
+	"ingress-nginx": {
+		CommonName:   "Kubernetes Ingress Controller Fake Certificate",
+		Organization: "Acme Co",
+		SANs:         []string{"ingress.local"},
+	},
+	"synology": {
+		CommonName:   "synology",
+		Organization: "Synology Inc.",
+		Locality:     "Taipei",
+		Country:      "TW",
+		SANs:         []string{"synology"},
+	},
+}
+
+// pkixName returns the subject fields of s as a pkix.Name.
+func (s Subject) pkixName() pkix.Name {
+	return pkix.Name{
+		CommonName:         s.CommonName,
+		Organization:       nonEmpty(s.Organization),
+		OrganizationalUnit: nonEmpty(s.OrganizationalUnit),
+		Locality:           nonEmpty(s.Locality),
+		Province:           nonEmpty(s.Province),
+		Country:            nonEmpty(s.Country),
+	}
+}
+
+// nonEmpty returns v as a one-element list, or nil if it is empty, so
+// unset fields are left out of the subject.
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
 // GenerateSelfSignedCert creates a self-signed TLS certificate on the fly
 // Returns the certificate and its SHA256 fingerprint
 func GenerateSelfSignedCert() (tls.Certificate, string, error) {
+	return GenerateCert(DefaultSubject)
+}
+
+// GenerateCert creates a self-signed TLS certificate for subject and
+// returns it with its SHA256 fingerprint.
+func GenerateCert(subject Subject) (tls.Certificate, string, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
 	if err != nil {
 		return tls.Certificate{}, "", fmt.Errorf("failed to generate private key: %v", err)
@@ -32,18 +118,20 @@ func GenerateSelfSignedCert() (tls.Certificate, string, error) {
 	}
 
 	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"Reverse Shell Listener"},
-			CommonName:   "localhost",
-		},
+		SerialNumber:          serialNumber,
+		Subject:               subject.pkixName(),
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		DNSNames:              []string{"localhost"},
-		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	for _, san := range subject.SANs {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
 	}
 
 	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
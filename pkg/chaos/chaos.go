@@ -0,0 +1,402 @@
+// Package chaos degrades a connection on purpose, adding latency, lost and
+// reordered frames and disconnects, so tunnels, transfers and reconnects can
+// be exercised under bad network conditions in CI and demos. It is a testing
+// aid and has no place on a real engagement.
+package chaos
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// retransmitDelay is what a lost frame costs: TCP resends it after its
+// initial retransmission timeout (RFC 6298), so the stream stalls rather
+// than loses data.
+const retransmitDelay = time.Second
+
+// maxQueued bounds the bytes held back in each direction. Writers block
+// beyond it, as they would on a full socket buffer.
+const maxQueued = 1 << 20
+
+// closeTimeout bounds how long Close waits for held back writes to go out.
+const closeTimeout = 10 * time.Second
+
+// Config selects the faults injected into a connection. The zero Config
+// injects none.
+type Config struct {
+	Latency    time.Duration // Added to every frame in each direction
+	Jitter     time.Duration // Random extra delay of up to Jitter per frame
+	Loss       float64       // Share of frames delayed by a retransmission
+	Reorder    float64       // Share of frames delivered before the one queued ahead of them
+	Disconnect time.Duration // Drop the connection after 0.5-1.5 times this; zero never
+}
+
+// Parse reads a comma-separated list such as
+// "latency=200ms,jitter=50ms,loss=1%,reorder=5%,disconnect=2m". Shares are
+// percentages or fractions between 0 and 1.
+func Parse(spec string) (Config, error) {
+	var c Config
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid chaos setting %q (want key=value)", field)
+		}
+		var err error
+		switch key {
+		case "latency":
+			c.Latency, err = parseDuration(val)
+		case "jitter":
+			c.Jitter, err = parseDuration(val)
+		case "disconnect":
+			c.Disconnect, err = parseDuration(val)
+		case "loss":
+			c.Loss, err = parseShare(val)
+		case "reorder":
+			c.Reorder, err = parseShare(val)
+		default:
+			return Config{}, fmt.Errorf("unknown chaos setting %q (latency, jitter, loss, reorder or disconnect)", key)
+		}
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid %s %q: %w", key, val, err)
+		}
+	}
+	return c, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	return d, err
+}
+
+func parseShare(s string) (float64, error) {
+	pct, isPct := strings.CutSuffix(s, "%")
+	p, err := strconv.ParseFloat(pct, 64)
+	if err != nil {
+		return 0, err
+	}
+	if isPct {
+		p /= 100
+	}
+	if p < 0 || p > 1 {
+		return 0, fmt.Errorf("must be between 0 and 100%%")
+	}
+	return p, nil
+}
+
+// Enabled reports whether c injects any fault.
+func (c Config) Enabled() bool {
+	return c != Config{}
+}
+
+// String returns c in the form Parse reads, leaving out unset faults.
+func (c Config) String() string {
+	var parts []string
+	for _, d := range []struct {
+		key string
+		val time.Duration
+	}{{"latency", c.Latency}, {"jitter", c.Jitter}} {
+		if d.val > 0 {
+			parts = append(parts, d.key+"="+d.val.String())
+		}
+	}
+	for _, s := range []struct {
+		key string
+		val float64
+	}{{"loss", c.Loss}, {"reorder", c.Reorder}} {
+		if s.val > 0 {
+			parts = append(parts, s.key+"="+strconv.FormatFloat(s.val*100, 'g', -1, 64)+"%")
+		}
+	}
+	if c.Disconnect > 0 {
+		parts = append(parts, "disconnect="+c.Disconnect.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// delay returns how long a frame is held back.
+func (c Config) delay() time.Duration {
+	d := c.Latency
+	if c.Jitter > 0 {
+		d += rand.N(c.Jitter)
+	}
+	if c.Loss > 0 && rand.Float64() < c.Loss {
+		d += retransmitDelay
+	}
+	return d
+}
+
+// Wrap returns conn with the faults of c injected in both directions, or
+// conn itself when c is the zero Config. Frames are what a single Write or
+// Read of the underlying connection carries; only frames of whole lines are
+// reordered, so a protocol line is never torn apart.
+func (c Config) Wrap(conn net.Conn) net.Conn {
+	if !c.Enabled() {
+		return conn
+	}
+	cc := &chaosConn{Conn: conn, cfg: c, in: newQueue(), out: newQueue(), sent: make(chan struct{})}
+	go cc.receive()
+	go cc.send()
+	if c.Disconnect > 0 {
+		cc.timer = time.AfterFunc(c.Disconnect/2+rand.N(c.Disconnect), cc.drop)
+	}
+	return cc
+}
+
+// chaosConn delays the frames of an underlying connection through a queue
+// per direction, drained by a goroutine each.
+type chaosConn struct {
+	net.Conn
+	cfg       Config
+	in, out   *queue
+	sent      chan struct{} // Closed when the send goroutine returns
+	timer     *time.Timer   // Pending disconnect, if any
+	closeOnce sync.Once
+}
+
+func (c *chaosConn) Read(p []byte) (int, error) {
+	return c.in.read(p)
+}
+
+func (c *chaosConn) Write(p []byte) (int, error) {
+	if err := c.out.push(c.cfg, bytes.Clone(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetDeadline sets the read deadline of the delayed stream and the write
+// deadline of the underlying connection.
+func (c *chaosConn) SetDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *chaosConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+// Close sends what is still held back, then closes the connection.
+func (c *chaosConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.out.fail(net.ErrClosed, false)
+		select {
+		case <-c.sent:
+		case <-time.After(closeTimeout):
+		}
+		err = c.Conn.Close()
+		c.in.fail(net.ErrClosed, true)
+	})
+	return err
+}
+
+// drop breaks the connection at once, discarding what is held back, as a
+// network outage would.
+func (c *chaosConn) drop() {
+	c.closeOnce.Do(func() {
+		c.out.fail(net.ErrClosed, true)
+		c.in.fail(net.ErrClosed, true)
+		c.Conn.Close()
+	})
+}
+
+// receive queues what arrives on the underlying connection.
+func (c *chaosConn) receive() {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := c.Conn.Read(buf)
+		if n > 0 {
+			if c.in.push(c.cfg, bytes.Clone(buf[:n])) != nil {
+				return
+			}
+		}
+		if err != nil {
+			c.in.fail(err, false)
+			return
+		}
+	}
+}
+
+// send writes queued frames to the underlying connection once they are due.
+func (c *chaosConn) send() {
+	defer close(c.sent)
+	for {
+		f, err := c.out.next()
+		if err != nil {
+			return
+		}
+		if _, err := c.Conn.Write(f.data); err != nil {
+			c.out.fail(err, true)
+			return
+		}
+	}
+}
+
+// frame is one delayed chunk of the stream.
+type frame struct {
+	data  []byte
+	at    time.Time // When it is delivered
+	whole bool      // Holds whole lines only, so it may change places
+}
+
+// queue holds the frames of one direction in delivery order.
+type queue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	frames   []frame
+	size     int       // Bytes in frames
+	last     time.Time // Delivery time of the newest frame, keeping frames in order
+	midLine  bool      // The newest frame ended inside a line
+	err      error     // Returned once the frames run out
+	deadline time.Time // Read deadline
+}
+
+func newQueue() *queue {
+	q := &queue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds data to the queue, delayed as cfg says. A frame picked for
+// reordering goes before the one queued ahead of it, if that one holds whole
+// lines too and has not been delivered yet.
+func (q *queue) push(cfg Config, data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.size >= maxQueued && q.err == nil {
+		q.cond.Wait()
+	}
+	if q.err != nil {
+		return q.err
+	}
+	endsLine := data[len(data)-1] == '\n'
+	f := frame{data: data, at: time.Now().Add(cfg.delay()), whole: !q.midLine && endsLine}
+	q.midLine = !endsLine
+	if f.at.Before(q.last) {
+		f.at = q.last
+	}
+	q.last = f.at
+	if n := len(q.frames); n > 0 && f.whole && q.frames[n-1].whole && cfg.Reorder > 0 && rand.Float64() < cfg.Reorder {
+		prev := q.frames[n-1]
+		f.at, prev.at = prev.at, f.at
+		q.frames[n-1] = f
+		q.frames = append(q.frames, prev)
+	} else {
+		q.frames = append(q.frames, f)
+	}
+	q.size += len(data)
+	q.cond.Broadcast()
+	return nil
+}
+
+// next waits for the oldest frame to be due and removes it. It returns the
+// queue's error once the frames run out.
+func (q *queue) next() (frame, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if len(q.frames) > 0 {
+			f := q.frames[0]
+			if time.Now().Before(f.at) {
+				q.waitUntil(f.at)
+				continue
+			}
+			q.frames = q.frames[1:]
+			q.size -= len(f.data)
+			q.cond.Broadcast()
+			return f, nil
+		}
+		if q.err != nil {
+			return frame{}, q.err
+		}
+		q.cond.Wait()
+	}
+}
+
+// read copies due frames into p, honouring the read deadline.
+func (q *queue) read(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		now := time.Now()
+		if len(q.frames) > 0 && !now.Before(q.frames[0].at) {
+			f := &q.frames[0]
+			n := copy(p, f.data)
+			if f.data = f.data[n:]; len(f.data) == 0 {
+				q.frames = q.frames[1:]
+			} else {
+				f.whole = false // Partly read, so it must stay in place
+			}
+			q.size -= n
+			q.cond.Broadcast()
+			return n, nil
+		}
+		if len(q.frames) == 0 && q.err != nil {
+			return 0, q.err
+		}
+		if !q.deadline.IsZero() && !now.Before(q.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		wake := q.deadline
+		if len(q.frames) > 0 && (wake.IsZero() || q.frames[0].at.Before(wake)) {
+			wake = q.frames[0].at
+		}
+		q.waitUntil(wake)
+	}
+}
+
+// waitUntil waits for a change to the queue or for t, if set. The caller
+// holds q.mu.
+func (q *queue) waitUntil(t time.Time) {
+	if t.IsZero() {
+		q.cond.Wait()
+		return
+	}
+	timer := time.AfterFunc(time.Until(t), func() {
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	})
+	q.cond.Wait()
+	timer.Stop()
+}
+
+func (q *queue) setDeadline(t time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deadline = t
+	q.cond.Broadcast()
+}
+
+// fail makes err the queue's error, if it has none yet, and with discard
+// drops the frames still queued.
+func (q *queue) fail(err error, discard bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err == nil {
+		q.err = err
+	}
+	if discard {
+		q.frames = nil
+		q.size = 0
+	}
+	q.cond.Broadcast()
+}
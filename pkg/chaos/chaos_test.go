@@ -0,0 +1,142 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse("latency=200ms, jitter=50ms,loss=1%,reorder=0.05,disconnect=2m")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := Config{Latency: 200 * time.Millisecond, Jitter: 50 * time.Millisecond, Loss: 0.01, Reorder: 0.05, Disconnect: 2 * time.Minute}
+	if c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if s := c.String(); s != "latency=200ms,jitter=50ms,loss=1%,reorder=5%,disconnect=2m0s" {
+		t.Errorf("unexpected String %q", s)
+	}
+	if again, _ := Parse(c.String()); again != c {
+		t.Errorf("String does not parse back: %+v", again)
+	}
+
+	if c, err := Parse(""); err != nil || c.Enabled() {
+		t.Errorf("expected an empty spec to disable chaos, got %+v, %v", c, err)
+	}
+	for _, spec := range []string{"latency", "latency=fast", "latency=-1s", "loss=150%", "loss=x%", "bitflip=1%"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestWrapDisabled(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if (Config{}).Wrap(a) != a {
+		t.Error("expected the zero Config to leave the connection alone")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	a, b := net.Pipe()
+	conn := Config{Latency: 50 * time.Millisecond}.Wrap(a)
+	defer conn.Close()
+	defer b.Close()
+
+	start := time.Now()
+	if _, err := conn.Write([]byte("PING\n")); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 20*time.Millisecond {
+		t.Error("expected Write not to wait for the frame to go out")
+	}
+	buf := make([]byte, 5)
+	io.ReadFull(b, buf)
+	if got := time.Since(start); got < 50*time.Millisecond {
+		t.Errorf("frame arrived after %s", got)
+	}
+
+	start = time.Now()
+	go b.Write([]byte("PONG\n"))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PONG\n" {
+		t.Fatalf("unexpected read %q, %v", buf, err)
+	}
+	if got := time.Since(start); got < 50*time.Millisecond {
+		t.Errorf("frame was read after %s", got)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	a, b := net.Pipe()
+	conn := Config{Latency: 50 * time.Millisecond, Reorder: 1}.Wrap(a)
+	defer conn.Close()
+	defer b.Close()
+
+	conn.Write([]byte("first\n"))
+	conn.Write([]byte("second\n"))
+	buf := make([]byte, 13)
+	io.ReadFull(b, buf)
+	if string(buf) != "second\nfirst\n" {
+		t.Errorf("expected swapped frames, got %q", buf)
+	}
+
+	// A frame that ends mid-line is never moved, nor is the one after it
+	conn.Write([]byte("par"))
+	conn.Write([]byte("tial\n"))
+	buf = make([]byte, 8)
+	io.ReadFull(b, buf)
+	if string(buf) != "partial\n" {
+		t.Errorf("expected a split line to stay in order, got %q", buf)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	a, b := net.Pipe()
+	conn := Config{Latency: time.Second}.Wrap(a)
+	defer conn.Close()
+	defer b.Close()
+
+	go b.Write([]byte("late\n"))
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 8)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	a, b := net.Pipe()
+	conn := Config{Disconnect: 20 * time.Millisecond}.Wrap(a)
+	defer conn.Close()
+
+	if _, err := conn.Read(make([]byte, 8)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected the connection to be dropped, got %v", err)
+	}
+	if _, err := b.Read(make([]byte, 8)); err == nil {
+		t.Error("expected the peer to see the connection close")
+	}
+	if _, err := conn.Write([]byte("x\n")); err == nil {
+		t.Error("expected writes to fail after the drop")
+	}
+}
+
+func TestCloseSendsHeldFrames(t *testing.T) {
+	a, b := net.Pipe()
+	conn := Config{Latency: 30 * time.Millisecond}.Wrap(a)
+	conn.Write([]byte("bye\n"))
+	got := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(b)
+		got <- string(data)
+	}()
+	conn.Close()
+	if data := <-got; data != "bye\n" {
+		t.Errorf("expected the held frame before the close, got %q", data)
+	}
+}
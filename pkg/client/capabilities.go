@@ -0,0 +1,22 @@
+package client
+
+import "github.com/frjcomp/gots/pkg/protocol"
+
+// Capabilities returns the features compiled into this client. Builds with
+// -tags minimal leave out PTY, port forwarding and SOCKS.
+func Capabilities() []string {
+	caps := []string{protocol.CapExec, protocol.CapTransfer, protocol.CapPeek, protocol.CapSysinfo, protocol.CapDelta, protocol.CapSync, protocol.CapWatch, protocol.CapProbe, protocol.CapList, protocol.CapScript, protocol.CapRunAs, protocol.CapPatch, protocol.CapRekey, protocol.CapEnvFile, protocol.CapPrompt}
+	if ptySupported {
+		caps = append(caps, protocol.CapPTY)
+	}
+	if forwardSupported {
+		caps = append(caps, protocol.CapForward)
+	}
+	if socksSupported {
+		caps = append(caps, protocol.CapSocks, protocol.CapSocksErr)
+	}
+	if pipeSupported {
+		caps = append(caps, protocol.CapPipe)
+	}
+	return caps
+}
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,8 +11,11 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/delta"
+	"github.com/frjcomp/gots/pkg/logging"
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
@@ -20,79 +25,223 @@ func (rc *ReverseClient) handlePingCommand() error {
 	return rc.writer.Flush()
 }
 
+// splitTransferID separates the optional transfer ID from the arguments of
+// an upload frame. Listeners that predate transfer IDs send none; their
+// uploads share the "" ID and so still run one at a time.
+func splitTransferID(args string) (id, rest string) {
+	if first, after, ok := strings.Cut(args, " "); ok && protocol.IsTransferID(first) {
+		return first, after
+	}
+	return "", args
+}
+
+// cutOption removes a leading "key=value" option from the arguments of a
+// transfer frame. Listeners that predate options send none.
+func cutOption(args, key string) (value, rest string, ok bool) {
+	first, after, found := strings.Cut(args, " ")
+	if v, isOpt := strings.CutPrefix(first, key+"="); isOpt && found {
+		return v, after, true
+	}
+	return "", args, false
+}
+
 // handleStartUploadCommand handles the START_UPLOAD command to prepare for file upload
 func (rc *ReverseClient) handleStartUploadCommand(command string) error {
-	parts := strings.SplitN(command, " ", 3)
-	if len(parts) != 3 {
+	id, args := splitTransferID(strings.TrimPrefix(command, protocol.CmdStartUpload+" "))
+	policy, args, ok := cutOption(args, protocol.OptExists)
+	if !ok {
+		policy = protocol.OverwriteAlways
+	}
+	var blockSize int
+	var err error
+	if v, rest, ok := cutOption(args, protocol.OptDelta); ok {
+		args = rest
+		if blockSize, err = strconv.Atoi(v); err == nil && blockSize <= 0 {
+			err = fmt.Errorf("invalid block size %q", v)
+		}
+	}
+	codec, args, ok := cutOption(args, protocol.OptCodec)
+	if !ok {
+		codec = compression.CodecGzip
+	} else if !compression.IsCodec(codec) {
+		rc.writer.WriteString(fmt.Sprintf("Unsupported codec: %s\n", codec) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("unsupported codec: %s", codec)
+	}
+	i := strings.LastIndex(args, " ")
+	var size int64
+	if i > 0 && err == nil {
+		size, err = strconv.ParseInt(args[i+1:], 10, 64)
+	}
+	if i <= 0 || err != nil || size < 0 || !protocol.IsOverwritePolicy(policy) {
 		rc.writer.WriteString("Invalid start_upload command\n" + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
 		return fmt.Errorf("invalid start_upload command: %s", command)
 	}
-	remotePath := parts[1]
-	rc.currentUploadPath = remotePath
-	rc.uploadChunks = []string{}
-	rc.writer.WriteString("OK\n" + protocol.EndOfOutputMarker + "\n")
+	if old, ok := rc.uploads[id]; ok {
+		old.abort()
+		delete(rc.uploads, id)
+	}
+	// Chunks are streamed to disk, so only refuse when already over the limit
+	if err := rc.checkMemory(0); err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Refused: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return err
+	}
+	if len(rc.uploads) >= maxActiveUploads {
+		rc.writer.WriteString("Too many active uploads\n" + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("too many active uploads")
+	}
+
+	upload, err := startUpload(args[:i], size, policy, blockSize, codec, rc.options.MaxTransferSize)
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Write error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("failed to stage upload: %w", err)
+	}
+	if rc.uploads == nil {
+		rc.uploads = make(map[string]*uploadState)
+	}
+	rc.uploads[id] = upload
+	// Report the destination, which differs from the request after a rename
+	rc.writer.WriteString("OK\n" + upload.path + "\n" + protocol.EndOfOutputMarker + "\n")
 	return rc.writer.Flush()
 }
 
-// handleUploadChunkCommand handles receiving and storing a single file chunk
+// handleUploadChunkCommand handles receiving a single file chunk, which is
+// decompressed straight to the upload's staging file
 func (rc *ReverseClient) handleUploadChunkCommand(command string) error {
-	if rc.currentUploadPath == "" {
+	id, chunk := splitTransferID(strings.TrimPrefix(command, protocol.CmdUploadChunk+" "))
+	upload, ok := rc.uploads[id]
+	if !ok {
 		rc.writer.WriteString("No active upload\n" + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
 		return fmt.Errorf("no active upload session")
 	}
-	chunk := strings.TrimPrefix(command, protocol.CmdUploadChunk+" ")
-	rc.uploadChunks = append(rc.uploadChunks, chunk)
+	if err := upload.write(chunk); err != nil {
+		delete(rc.uploads, id)
+		return rc.writeUploadError(err)
+	}
 	rc.writer.WriteString("OK\n" + protocol.EndOfOutputMarker + "\n")
 	return rc.writer.Flush()
 }
 
-// handleEndUploadCommand handles finalizing a file upload and writing to disk
+// handleEndUploadCommand handles finalizing a file upload and moving it into place
 func (rc *ReverseClient) handleEndUploadCommand(command string) error {
-	parts := strings.SplitN(command, " ", 2)
-	if len(parts) != 2 {
+	args, ok := strings.CutPrefix(command, protocol.CmdEndUpload+" ")
+	if !ok || args == "" {
 		rc.writer.WriteString("Invalid end_upload command\n" + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
 		return fmt.Errorf("invalid end_upload command: %s", command)
 	}
 
-	if rc.currentUploadPath == "" {
+	id, _ := splitTransferID(args)
+	upload, ok := rc.uploads[id]
+	if !ok {
 		rc.writer.WriteString("No active upload\n" + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
 		return fmt.Errorf("no active upload session")
 	}
+	// The upload is finished either way; a failed one is not resumed
+	delete(rc.uploads, id)
 
-	// Concatenate all chunks into single compressed hex string, then decompress
-	var fullCompressed strings.Builder
-	for _, chunk := range rc.uploadChunks {
-		fullCompressed.WriteString(chunk)
+	totalBytes, err := upload.finish()
+	if err != nil {
+		return rc.writeUploadError(err)
 	}
+	rc.writer.WriteString(fmt.Sprintf("OK\n%d\n", totalBytes) + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
 
-	// Decompress the complete compressed data
-	decompressedData, err := compression.DecompressHex(fullCompressed.String())
-	if err != nil {
+// writeUploadError reports a failed upload, telling corrupt data apart from
+// problems writing the file.
+func (rc *ReverseClient) writeUploadError(err error) error {
+	if errors.Is(err, compression.ErrCorrupt) {
 		rc.writer.WriteString(fmt.Sprintf("Decompression error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
 		return fmt.Errorf("decompression failed: %w", err)
 	}
+	rc.writer.WriteString(fmt.Sprintf("Write error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+	rc.writer.Flush()
+	return fmt.Errorf("failed to write file: %w", err)
+}
 
-	// Write to file
-	err = os.WriteFile(rc.currentUploadPath, decompressedData, 0644)
+// maxPeekBytes caps how much of a file PEEK returns.
+const maxPeekBytes = 64 << 10
+
+// handlePeekCommand returns the size and first bytes of a file, so the
+// operator can see what it is before downloading it
+func (rc *ReverseClient) handlePeekCommand(command string) error {
+	parts := strings.SplitN(command, " ", 3)
+	var n int
+	var err error
+	if len(parts) == 3 {
+		n, err = strconv.Atoi(parts[1])
+	}
+	if len(parts) != 3 || err != nil || n < 0 {
+		rc.writer.WriteString("Invalid peek command\n" + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("invalid peek command: %s", command)
+	}
+	n = min(n, maxPeekBytes)
+
+	f, err := os.Open(parts[2])
+	var info os.FileInfo
+	if err == nil {
+		defer f.Close()
+		info, err = f.Stat()
+	}
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", parts[2])
+	}
+	buf := make([]byte, n)
+	if err == nil {
+		n, err = io.ReadFull(f, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+	}
 	if err != nil {
-		rc.writer.WriteString(fmt.Sprintf("Write error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.WriteString(fmt.Sprintf("Error reading file: %v\n", err) + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
-		return fmt.Errorf("failed to write file: %w", err)
+		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	totalBytes := len(decompressedData)
-	rc.writer.WriteString(fmt.Sprintf("OK\n%d\n", totalBytes) + protocol.EndOfOutputMarker + "\n")
-	rc.writer.Flush()
+	rc.writer.WriteString(fmt.Sprintf("OK\n%d\n%s\n", info.Size(), hex.EncodeToString(buf[:n])) + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
 
-	// Cleanup
-	rc.currentUploadPath = ""
-	rc.uploadChunks = []string{}
-	return nil
+// handleSignatureCommand returns the block checksums of a file, from which
+// the listener computes a delta upload
+func (rc *ReverseClient) handleSignatureCommand(command string) error {
+	parts := strings.SplitN(command, " ", 3)
+	var blockSize int
+	var err error
+	if len(parts) == 3 {
+		blockSize, err = strconv.Atoi(parts[1])
+	}
+	if len(parts) != 3 || err != nil {
+		rc.writer.WriteString("Invalid signature command\n" + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("invalid signature command: %s", command)
+	}
+
+	f, err := os.Open(parts[2])
+	var sig *delta.Signature
+	if err == nil {
+		defer f.Close()
+		sig, err = delta.NewSignature(f, blockSize)
+	}
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error reading file: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	wire, _ := sig.MarshalBinary()
+	rc.writer.WriteString("OK\n" + hex.EncodeToString(wire) + "\n" + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
 }
 
 // handleDownloadCommand handles file download requests
@@ -104,7 +253,51 @@ func (rc *ReverseClient) handleDownloadCommand(command string) error {
 		return fmt.Errorf("invalid download command: %s", command)
 	}
 
-	filePath := parts[1]
+	maxSize, filePath, limited := cutOption(parts[1], protocol.OptMaxSize)
+	var limit int64
+	if limited {
+		var err error
+		if limit, err = strconv.ParseInt(maxSize, 10, 64); err != nil || limit < 0 {
+			rc.writer.WriteString("Invalid download command\n" + protocol.EndOfOutputMarker + "\n")
+			rc.writer.Flush()
+			return fmt.Errorf("invalid download command: %s", command)
+		}
+	}
+	codec, filePath, ok := cutOption(filePath, protocol.OptCodec)
+	if !ok {
+		codec = compression.CodecGzip
+	} else if !compression.IsCodec(codec) {
+		rc.writer.WriteString(fmt.Sprintf("Unsupported codec: %s\n", codec) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("unsupported codec: %s", codec)
+	}
+
+	// Check the size before reading anything into memory
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", filePath)
+	}
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error reading file: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if limited && limit > 0 && info.Size() > limit {
+		rc.writer.WriteString(fmt.Sprintf("File too large: %d bytes exceeds the limit of %d bytes\n", info.Size(), limit) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("file too large: %s is %d bytes", filePath, info.Size())
+	}
+	if own := rc.options.MaxTransferSize; own > 0 && info.Size() > own {
+		rc.writer.WriteString(fmt.Sprintf("File too large: %d bytes exceeds the client's transfer limit of %d bytes\n", info.Size(), own) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("%w: %s is %d bytes", ErrTransferLimit, filePath, info.Size())
+	}
+	if err := rc.checkMemory(info.Size() * transferMemoryFactor); err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Refused: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return err
+	}
+
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		rc.writer.WriteString(fmt.Sprintf("Error reading file: %v\n", err) + protocol.EndOfOutputMarker + "\n")
@@ -112,8 +305,11 @@ func (rc *ReverseClient) handleDownloadCommand(command string) error {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Compress data
-	compressed, err := compression.CompressToHex(data)
+	// Compress data, unless it turns out to be compressed already
+	compressed, stored, err := compression.EncodeTransfer(codec, data)
+	if stored {
+		logging.Debugf("Download of %s barely compresses; sending all but the first %d bytes uncompressed", filePath, compression.SampleSize)
+	}
 	if err != nil {
 		rc.writer.WriteString(fmt.Sprintf("Compression error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
 		rc.writer.Flush()
@@ -148,7 +344,12 @@ func (rc *ReverseClient) handlePtyModeCommand() error {
 	cmd := exec.Command(shell)
 	ptmx, err := startPty(cmd)
 	if err != nil {
-		rc.writer.WriteString(fmt.Sprintf("Failed to start PTY: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		reason := protocol.PtyFailed
+		if !ptySupported {
+			reason = protocol.PtyUnsupported
+		}
+		message := strings.Join(strings.Fields(err.Error()), " ")
+		rc.writer.WriteString(fmt.Sprintf("%s %s %s\n", protocol.CmdPtyUnavailable, reason, message) + protocol.EndOfOutputMarker + "\n")
 		return rc.writer.Flush()
 	}
 
@@ -339,14 +540,26 @@ func (rc *ReverseClient) handlePtyExitCommand() error {
 	return nil
 }
 
-// handleShellCommand executes a shell command and returns output
+// handleShellCommand executes a shell command and returns output. The
+// command's stdin is empty.
 func (rc *ReverseClient) handleShellCommand(command string) error {
-	var cmd *exec.Cmd
+	return rc.runShellCommand(command, false)
+}
 
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", command)
-	} else {
-		cmd = exec.Command("bash", "-c", command)
+// handlePromptedCommand runs PROMPTED <command>: a shell command whose
+// password prompts are relayed to the listener while its stdin is open.
+func (rc *ReverseClient) handlePromptedCommand(command string) error {
+	return rc.runShellCommand(strings.TrimPrefix(command, protocol.CmdPrompted+" "), true)
+}
+
+// runShellCommand executes a shell command and returns output. With
+// relayPrompts the command gets a stdin pipe for answers to its password
+// prompts.
+func (rc *ReverseClient) runShellCommand(command string, relayPrompts bool) error {
+	cmd, err := shellCommandWithEnv(command, rc.envFile)
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		return rc.writer.Flush()
 	}
 
 	// Store reference to running command for cancellation
@@ -364,33 +577,80 @@ func (rc *ReverseClient) handleShellCommand(command string) error {
 		return rc.writer.Flush()
 	}
 	cmd.Stderr = cmd.Stdout
+	var stdin io.WriteCloser
+	if relayPrompts {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			rc.writer.WriteString(fmt.Sprintf("Error creating pipe: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+			return rc.writer.Flush()
+		}
+	}
 
 	if err := cmd.Start(); err != nil {
 		rc.writer.WriteString(fmt.Sprintf("Error starting command: %v\n", err) + protocol.EndOfOutputMarker + "\n")
 		return rc.writer.Flush()
 	}
 
-	// Read output up to maxLen
-	buf := make([]byte, 4096)
-	for len(output) < maxLen {
-		n, readErr := pipe.Read(buf)
-		if n > 0 {
-			remaining := maxLen - len(output)
-			if n > remaining {
-				output = append(output, buf[:remaining]...)
-				truncated = true
-				break
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, readErr := pipe.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte(nil), buf[:n]...)
+			}
+			if readErr != nil {
+				return
 			}
-			output = append(output, buf[:n]...)
 		}
-		if readErr != nil {
-			break
+	}()
+
+	// Read output up to maxLen, answering password prompts through the
+	// listener while stdin is open
+	stdinOpen := relayPrompts
+	closeStdin := func() {
+		if stdinOpen {
+			stdin.Close()
+			stdinOpen = false
+		}
+	}
+	defer closeStdin()
+	idle := time.NewTimer(stdinIdleTimeout)
+	defer idle.Stop()
+	if !relayPrompts {
+		idle.Stop()
+	}
+	for done := false; !done; {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				done = true
+				break
+			}
+			if truncated {
+				continue // Drain until the killed process closes the pipe
+			}
+			if remaining := maxLen - len(output); len(chunk) > remaining {
+				output = append(output, chunk[:remaining]...)
+				truncated = true
+				closeStdin()
+				// Kill the process to avoid blocking on cmd.Wait()
+				cmd.Process.Kill()
+				continue
+			}
+			output = append(output, chunk...)
+			if stdinOpen {
+				if prompt, ok := detectPasswordPrompt(output); ok && !rc.relaySecret(stdin, prompt) {
+					closeStdin()
+				}
+				idle.Reset(stdinIdleTimeout)
+			}
+		case <-idle.C:
+			closeStdin()
 		}
 	}
 
-	// If truncated, kill the process to avoid blocking on cmd.Wait()
 	if truncated {
-		cmd.Process.Kill()
 		output = append(output, []byte("\n...output truncated\n")...)
 	}
 
@@ -408,11 +668,18 @@ func (rc *ReverseClient) processCommand(command string) (shouldContinue bool, er
 		return true, rc.handlePingCommand()
 	}
 
+	// A secret arriving after its prompt was abandoned must not be run or logged
+	if command == protocol.CmdSecret || strings.HasPrefix(command, protocol.CmdSecret+" ") {
+		return true, nil
+	}
+
 	// Log command but avoid logging data payloads for upload chunks and streaming data
 	if strings.HasPrefix(command, protocol.CmdUploadChunk+" ") {
 		log.Printf("Received command: %s <data>", protocol.CmdUploadChunk)
 	} else if strings.HasPrefix(command, protocol.CmdSocksData+" ") {
 		// Skip logging SOCKS_DATA for performance (high frequency)
+	} else if strings.HasPrefix(command, protocol.CmdRunAs+" ") {
+		log.Printf("Received command: %s <credentials>", protocol.CmdRunAs)
 	} else {
 		log.Printf("Received command: %s", command)
 	}
@@ -421,6 +688,17 @@ func (rc *ReverseClient) processCommand(command string) (shouldContinue bool, er
 		return false, rc.handleExitCommand()
 	}
 
+	if command == protocol.CmdTerminate {
+		return false, ErrTerminated
+	}
+
+	rc.lastCommand = time.Now()
+	if command == protocol.CmdRekey {
+		// Answered by reconnecting once idle, see rekeyReady
+		rc.rekeyRequested = true
+		return true, nil
+	}
+
 	// Handle PTY mode commands
 	if command == protocol.CmdPtyMode {
 		return true, rc.handlePtyModeCommand()
@@ -455,6 +733,58 @@ func (rc *ReverseClient) processCommand(command string) (shouldContinue bool, er
 		return true, rc.handleDownloadCommand(command)
 	}
 
+	if strings.HasPrefix(command, protocol.CmdPeek+" ") {
+		return true, rc.handlePeekCommand(command)
+	}
+
+	if command == protocol.CmdSysinfo || strings.HasPrefix(command, protocol.CmdSysinfo+" ") {
+		return true, rc.handleSysinfoCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdSignature+" ") {
+		return true, rc.handleSignatureCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdWalk+" ") {
+		return true, rc.handleWalkCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdScript+" ") {
+		return true, rc.handleScriptCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdRunAs+" ") {
+		return true, rc.handleRunAsCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdPatch+" ") {
+		return true, rc.handlePatchCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdEnvFile+" ") {
+		return true, rc.handleEnvFileCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdList+" ") {
+		return true, rc.handleListCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdMkdir+" ") {
+		return true, rc.handleMkdirCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdRemove+" ") {
+		return true, rc.handleRemoveCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdWatch+" ") {
+		return true, rc.handleWatchCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdUnwatch+" ") {
+		return true, rc.handleUnwatchCommand(command)
+	}
+
 	// Handle port forwarding commands
 	if strings.HasPrefix(command, protocol.CmdForwardStart+" ") {
 		return true, rc.handleForwardStartCommand(command)
@@ -468,6 +798,18 @@ func (rc *ReverseClient) processCommand(command string) (shouldContinue bool, er
 		return true, rc.handleForwardStopCommand(command)
 	}
 
+	if strings.HasPrefix(command, protocol.CmdPipeListen+" ") {
+		return true, rc.handlePipeListenCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdPipeReady+" ") {
+		return true, rc.handlePipeReadyCommand(command)
+	}
+
+	if strings.HasPrefix(command, protocol.CmdPipeClose+" ") {
+		return true, rc.handlePipeCloseCommand(command)
+	}
+
 	// Handle SOCKS5 proxy commands
 	if strings.HasPrefix(command, protocol.CmdSocksStart+" ") {
 		return true, rc.handleSocksStartCommand(command)
@@ -485,6 +827,10 @@ func (rc *ReverseClient) processCommand(command string) (shouldContinue bool, er
 		return true, rc.handleSocksCloseCommand(command)
 	}
 
+	if strings.HasPrefix(command, protocol.CmdPrompted+" ") {
+		return true, rc.handlePromptedCommand(command)
+	}
+
 	// Default: execute as shell command
 	return true, rc.handleShellCommand(command)
 }
@@ -528,6 +874,39 @@ func (rc *ReverseClient) handleForwardStopCommand(command string) error {
 	return nil
 }
 
+// handlePipeListenCommand handles PIPE_LISTEN, answering whether the pipe
+// could be created
+func (rc *ReverseClient) handlePipeListenCommand(command string) error {
+	// Format: PIPE_LISTEN <fwd_id> <pipe_name>
+	parts := strings.SplitN(command, " ", 3)
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return rc.writeFileOpResult(fmt.Errorf("invalid PIPE_LISTEN command format"))
+	}
+	return rc.writeFileOpResult(rc.forwardHandler.HandlePipeListen(parts[1], parts[2]))
+}
+
+// handlePipeReadyCommand handles PIPE_READY command
+func (rc *ReverseClient) handlePipeReadyCommand(command string) error {
+	// Format: PIPE_READY <fwd_id> <conn_id>
+	parts := strings.Fields(command)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid PIPE_READY command format")
+	}
+	rc.forwardHandler.HandlePipeReady(parts[1], parts[2])
+	return nil
+}
+
+// handlePipeCloseCommand handles PIPE_CLOSE command
+func (rc *ReverseClient) handlePipeCloseCommand(command string) error {
+	// Format: PIPE_CLOSE <fwd_id>
+	parts := strings.Fields(command)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid PIPE_CLOSE command format")
+	}
+	rc.forwardHandler.HandlePipeClose(parts[1])
+	return nil
+}
+
 // handleSocksStartCommand handles SOCKS_START command
 func (rc *ReverseClient) handleSocksStartCommand(command string) error {
 	// Format: SOCKS_START <socks_id>
@@ -541,15 +920,15 @@ func (rc *ReverseClient) handleSocksStartCommand(command string) error {
 
 // handleSocksConnCommand handles SOCKS_CONN command
 func (rc *ReverseClient) handleSocksConnCommand(command string) error {
-	// Format: SOCKS_CONN <socks_id> <conn_id> <target_addr>
+	// Format: SOCKS_CONN <socks_id> <conn_id> <target_addr> [reason=1]
 	parts := strings.Fields(command)
-	if len(parts) != 4 {
+	if len(parts) != 4 && (len(parts) != 5 || parts[4] != protocol.SocksReasonOpt) {
 		return fmt.Errorf("invalid SOCKS_CONN command format")
 	}
 	socksID := parts[1]
 	connID := parts[2]
 	targetAddr := parts[3]
-	return rc.socksHandler.HandleSocksConn(socksID, connID, targetAddr)
+	return rc.socksHandler.HandleSocksConn(socksID, connID, targetAddr, len(parts) == 5)
 }
 
 // handleSocksDataCommand handles SOCKS_DATA command
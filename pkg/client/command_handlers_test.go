@@ -3,6 +3,9 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -12,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/delta"
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
@@ -49,18 +53,25 @@ func TestHandleStartUploadCommand(t *testing.T) {
 	client, output := createMockClient()
 
 	// Test valid start upload
-	cmd := "START_UPLOAD /tmp/testfile 100"
+	testFilePath := filepath.Join(t.TempDir(), "testfile")
+	cmd := "START_UPLOAD " + testFilePath + " 100"
 	err := client.handleStartUploadCommand(cmd)
 	if err != nil {
 		t.Errorf("Valid START_UPLOAD failed: %v", err)
 	}
+	defer client.abortUploads()
 
-	if client.currentUploadPath != "/tmp/testfile" {
-		t.Errorf("Expected currentUploadPath=/tmp/testfile, got %s", client.currentUploadPath)
+	upload := client.uploads[""]
+	if upload == nil || upload.path != testFilePath {
+		t.Fatalf("Expected upload to %s, got %+v", testFilePath, upload)
 	}
 
-	if len(client.uploadChunks) != 0 {
-		t.Errorf("Expected empty uploadChunks, got %d items", len(client.uploadChunks))
+	// Data is staged next to the destination, which is untouched until END_UPLOAD
+	if filepath.Dir(upload.staging.Name()) != filepath.Dir(testFilePath) {
+		t.Errorf("Expected staging file next to %s, got %s", testFilePath, upload.staging.Name())
+	}
+	if _, err := os.Stat(testFilePath); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to exist before END_UPLOAD", testFilePath)
 	}
 
 	result := output.String()
@@ -75,6 +86,26 @@ func TestHandleStartUploadCommand(t *testing.T) {
 	if err == nil {
 		t.Error("Invalid START_UPLOAD should return error")
 	}
+
+	// Test invalid start upload (non-numeric size)
+	err = client.handleStartUploadCommand("START_UPLOAD " + testFilePath + " big")
+	if err == nil {
+		t.Error("START_UPLOAD with a non-numeric size should return error")
+	}
+}
+
+// stageUpload starts an upload to path without a transfer ID and feeds it
+// chunks, as an older listener would before END_UPLOAD.
+func stageUpload(t *testing.T, client *ReverseClient, path string, chunks ...string) {
+	t.Helper()
+	if err := client.handleStartUploadCommand("START_UPLOAD " + path + " 0"); err != nil {
+		t.Fatalf("START_UPLOAD failed: %v", err)
+	}
+	for _, chunk := range chunks {
+		if err := client.handleUploadChunkCommand(protocol.CmdUploadChunk + " " + chunk); err != nil {
+			t.Fatalf("UPLOAD_CHUNK failed: %v", err)
+		}
+	}
 }
 
 // TestHandleUploadChunkCommand tests chunk receiving
@@ -95,17 +126,33 @@ func TestHandleUploadChunkCommand(t *testing.T) {
 
 	// Setup active upload
 	client, output = createMockClient()
-	client.currentUploadPath = "/tmp/test"
-	client.uploadChunks = []string{}
+	stageUpload(t, client, filepath.Join(t.TempDir(), "test"))
+	defer client.abortUploads()
 
 	// Test valid chunk
-	err = client.handleUploadChunkCommand(cmd)
+	compressed, err := compression.CompressToHex([]byte("somedata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.handleUploadChunkCommand("UPLOAD_CHUNK " + compressed)
 	if err != nil {
 		t.Errorf("Valid upload chunk failed: %v", err)
 	}
+	if client.uploads[""] == nil {
+		t.Fatal("Expected upload to stay active after a valid chunk")
+	}
 
-	if len(client.uploadChunks) != 1 || client.uploadChunks[0] != "somedata" {
-		t.Errorf("Expected uploadChunks=['somedata'], got %v", client.uploadChunks)
+	// Test chunk that is not hex: the upload is aborted
+	output.Reset()
+	err = client.handleUploadChunkCommand(cmd)
+	if err == nil {
+		t.Error("Invalid upload chunk should return error")
+	}
+	if !bytes.Contains(output.Bytes(), []byte("Decompression error")) {
+		t.Errorf("Expected decompression error, got: %s", output.String())
+	}
+	if len(client.uploads) != 0 {
+		t.Error("Expected upload to be aborted after an invalid chunk")
 	}
 }
 
@@ -346,11 +393,6 @@ func TestEndUploadCommandFileCreation(t *testing.T) {
 	os.MkdirAll(tmpDir, 0755)
 	defer os.RemoveAll(tmpDir)
 
-	// Setup an upload with some compressed data
-	testFilePath := filepath.Join(tmpDir, "test_file.txt")
-	client.currentUploadPath = testFilePath
-	client.uploadChunks = []string{}
-
 	// Attempt to end upload
 	cmd := "END_UPLOAD"
 	err := client.handleEndUploadCommand(cmd)
@@ -362,10 +404,6 @@ func TestEndUploadCommandFileCreation(t *testing.T) {
 	if len(result) == 0 {
 		t.Error("Expected output from END_UPLOAD")
 	}
-
-	// Cleanup
-	client.currentUploadPath = ""
-	client.uploadChunks = nil
 }
 
 // TestProcessCommandError tests error handling in dispatcher
@@ -414,7 +452,8 @@ func TestProcessCommandExit(t *testing.T) {
 func TestProcessCommandStartUpload(t *testing.T) {
 	client, output := createMockClient()
 
-	shouldContinue, err := client.processCommand("START_UPLOAD /tmp/test.txt 100")
+	shouldContinue, err := client.processCommand("START_UPLOAD " + filepath.Join(t.TempDir(), "test.txt") + " 100")
+	defer client.abortUploads()
 	if err != nil {
 		t.Errorf("START_UPLOAD failed: %v", err)
 	}
@@ -433,10 +472,12 @@ func TestProcessCommandUploadChunk(t *testing.T) {
 	client, _ := createMockClient()
 
 	// First start an upload
-	client.processCommand("START_UPLOAD /tmp/test.txt 100")
+	client.processCommand("START_UPLOAD " + filepath.Join(t.TempDir(), "test.txt") + " 100")
+	defer client.abortUploads()
 
 	// Now send a chunk
-	shouldContinue, err := client.processCommand("UPLOAD_CHUNK testchunkdata")
+	compressed, _ := compression.CompressToHex([]byte("testchunkdata"))
+	shouldContinue, err := client.processCommand("UPLOAD_CHUNK " + compressed)
 	if err != nil {
 		t.Errorf("UPLOAD_CHUNK failed: %v", err)
 	}
@@ -505,9 +546,6 @@ func TestHandleEndUploadInvalidCommand(t *testing.T) {
 func TestHandleEndUploadNoActiveSession(t *testing.T) {
 	client, output := createMockClient()
 
-	// Clear any active upload
-	client.currentUploadPath = ""
-
 	err := client.handleEndUploadCommand("END_UPLOAD /tmp/test.txt")
 	if err == nil {
 		t.Error("Expected error when no active upload session")
@@ -522,12 +560,16 @@ func TestHandleEndUploadNoActiveSession(t *testing.T) {
 // TestHandleEndUploadDecompressionError tests decompression failure
 func TestHandleEndUploadDecompressionError(t *testing.T) {
 	client, output := createMockClient()
+	testFilePath := filepath.Join(t.TempDir(), "test.txt")
 
-	// Setup with invalid compressed chunk
-	client.currentUploadPath = "/tmp/test.txt"
-	client.uploadChunks = []string{"INVALID_HEX_DATA!@#"}
+	// Setup with a truncated compressed payload
+	compressed, err := compression.CompressToHex([]byte("test content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageUpload(t, client, testFilePath, compressed[:len(compressed)/2])
 
-	err := client.handleEndUploadCommand("END_UPLOAD /tmp/test.txt")
+	err = client.handleEndUploadCommand("END_UPLOAD " + testFilePath)
 	if err == nil {
 		t.Error("Expected error for decompression failure")
 	}
@@ -537,39 +579,30 @@ func TestHandleEndUploadDecompressionError(t *testing.T) {
 		t.Errorf("Expected decompression error, got: %s", result)
 	}
 
-	// Cleanup
-	client.currentUploadPath = ""
-	client.uploadChunks = nil
+	// Neither the destination nor the staging file is left behind
+	if entries, _ := os.ReadDir(filepath.Dir(testFilePath)); len(entries) != 0 {
+		t.Errorf("Expected no files after a failed upload, got %d", len(entries))
+	}
 }
 
-// TestHandleEndUploadWriteError tests file write failure
-func TestHandleEndUploadWriteError(t *testing.T) {
+// TestHandleUploadWriteError tests file write failure, which is reported as
+// soon as the staging file cannot be created
+func TestHandleUploadWriteError(t *testing.T) {
 	client, output := createMockClient()
 
-	// Create valid compressed data
-	testData := []byte("test content")
-	compressed, err := compression.CompressToHex(testData)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Setup with valid chunk but invalid path (directory doesn't exist)
-	client.currentUploadPath = "/nonexistent/dir/test.txt"
-	client.uploadChunks = []string{compressed}
-
-	err = client.handleEndUploadCommand("END_UPLOAD /nonexistent/dir/test.txt")
+	// Invalid path (directory doesn't exist)
+	err := client.handleStartUploadCommand("START_UPLOAD /nonexistent/dir/test.txt 100")
 	if err == nil {
 		t.Error("Expected error for file write failure")
 	}
+	if len(client.uploads) != 0 {
+		t.Error("Expected no upload to be started")
+	}
 
 	result := output.String()
 	if !bytes.Contains([]byte(result), []byte("Write error")) {
 		t.Errorf("Expected write error, got: %s", result)
 	}
-
-	// Cleanup
-	client.currentUploadPath = ""
-	client.uploadChunks = nil
 }
 
 // TestHandleEndUploadSuccess tests successful file upload
@@ -588,8 +621,7 @@ func TestHandleEndUploadSuccess(t *testing.T) {
 	}
 
 	// Setup upload
-	client.currentUploadPath = testFilePath
-	client.uploadChunks = []string{compressed}
+	stageUpload(t, client, testFilePath, compressed)
 
 	err = client.handleEndUploadCommand("END_UPLOAD " + testFilePath)
 	if err != nil {
@@ -613,11 +645,8 @@ func TestHandleEndUploadSuccess(t *testing.T) {
 	}
 
 	// Verify cleanup
-	if client.currentUploadPath != "" {
-		t.Error("Expected currentUploadPath to be cleared")
-	}
-	if len(client.uploadChunks) != 0 {
-		t.Error("Expected uploadChunks to be cleared")
+	if len(client.uploads) != 0 {
+		t.Errorf("Expected upload to be cleared, got %v", client.uploads)
 	}
 }
 
@@ -639,8 +668,7 @@ func TestHandleEndUploadMultipleChunks(t *testing.T) {
 	compressed3, _ := compression.CompressToHex(part3)
 
 	// Setup upload with multiple chunks
-	client.currentUploadPath = testFilePath
-	client.uploadChunks = []string{compressed1, compressed2, compressed3}
+	stageUpload(t, client, testFilePath, compressed1, compressed2, compressed3)
 
 	err := client.handleEndUploadCommand("END_UPLOAD " + testFilePath)
 	if err != nil {
@@ -697,8 +725,7 @@ func TestHandleEndUploadLargeFileSplitChunks(t *testing.T) {
 		len(largeData), len(compressed), len(chunks))
 
 	// Setup upload with split chunks
-	client.currentUploadPath = testFilePath
-	client.uploadChunks = chunks
+	stageUpload(t, client, testFilePath, chunks...)
 
 	err = client.handleEndUploadCommand("END_UPLOAD " + testFilePath)
 	if err != nil {
@@ -722,6 +749,9 @@ func TestHandleEndUploadLargeFileSplitChunks(t *testing.T) {
 // TestPtyModeReentry tests that PTY mode can be entered and exited multiple times
 // without "input/output error" or goroutine leaks
 func TestPtyModeReentry(t *testing.T) {
+	if !ptySupported {
+		t.Skip("PTY not included in this build")
+	}
 	// Test entering and exiting PTY mode 3 times
 	numRetries := 3
 
@@ -1289,6 +1319,9 @@ func TestHandlePtyResizeCommandVariousSizes(t *testing.T) {
 
 // TestHandlePtyModeCommand tests entering PTY mode
 func TestHandlePtyModeCommand(t *testing.T) {
+	if !ptySupported {
+		t.Skip("PTY not included in this build")
+	}
 	if runtime.GOOS == "windows" {
 		// Windows tests need different shells
 		t.Log("✓ PTY mode command test skipped on Windows")
@@ -1348,6 +1381,25 @@ func TestHandlePtyModeCommandAlreadyInMode(t *testing.T) {
 	t.Log("✓ Duplicate PTY mode entry rejected")
 }
 
+// TestHandlePtyModeCommandUnsupported tests the structured answer of a
+// client built without PTY support
+func TestHandlePtyModeCommandUnsupported(t *testing.T) {
+	if ptySupported {
+		t.Skip("PTY included in this build")
+	}
+	client, output := createMockClient()
+	if err := client.handlePtyModeCommand(); err != nil {
+		t.Fatalf("handlePtyModeCommand failed: %v", err)
+	}
+	want := protocol.CmdPtyUnavailable + " " + protocol.PtyUnsupported + " "
+	if !strings.HasPrefix(output.String(), want) {
+		t.Errorf("expected %q, got %q", want, output.String())
+	}
+	if client.inPtyMode {
+		t.Error("client must not be in PTY mode without a PTY")
+	}
+}
+
 // TestHandlePtyModeCommandShellSelection tests shell selection logic
 func TestHandlePtyModeCommandShellSelection(t *testing.T) {
 	if runtime.GOOS == "windows" {
@@ -1393,3 +1445,382 @@ func TestHandlePtyModeCommandOutputFormatting(t *testing.T) {
 
 	t.Log("✓ Output formatting verified")
 }
+
+// TestInterleavedUploadsWithTransferIDs tests that uploads carrying transfer
+// IDs keep their chunks apart when their frames interleave
+func TestInterleavedUploadsWithTransferIDs(t *testing.T) {
+	client, _ := createMockClient()
+	tmpDir := t.TempDir()
+
+	files := map[string][]byte{
+		protocol.NewTransferID(): bytes.Repeat([]byte("first file "), 5000),
+		protocol.NewTransferID(): bytes.Repeat([]byte("second file "), 7000),
+	}
+	chunks := make(map[string][]string)
+	paths := make(map[string]string)
+	for id, data := range files {
+		compressed, err := compression.CompressToHex(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(compressed); i += 64 {
+			chunks[id] = append(chunks[id], compressed[i:min(i+64, len(compressed))])
+		}
+		paths[id] = filepath.Join(tmpDir, id)
+		if _, err := client.processCommand(fmt.Sprintf("START_UPLOAD %s %s %d", id, paths[id], len(compressed))); err != nil {
+			t.Fatalf("START_UPLOAD %s failed: %v", id, err)
+		}
+	}
+
+	for sent := true; sent; {
+		sent = false
+		for id := range files {
+			if len(chunks[id]) == 0 {
+				continue
+			}
+			if _, err := client.processCommand("UPLOAD_CHUNK " + id + " " + chunks[id][0]); err != nil {
+				t.Fatalf("UPLOAD_CHUNK %s failed: %v", id, err)
+			}
+			chunks[id] = chunks[id][1:]
+			sent = true
+		}
+	}
+
+	for id, data := range files {
+		if _, err := client.processCommand("END_UPLOAD " + id + " " + paths[id]); err != nil {
+			t.Fatalf("END_UPLOAD %s failed: %v", id, err)
+		}
+		written, err := os.ReadFile(paths[id])
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", paths[id], err)
+		}
+		if !bytes.Equal(written, data) {
+			t.Errorf("Upload %s corrupted: got %d bytes, expected %d", id, len(written), len(data))
+		}
+	}
+	if len(client.uploads) != 0 {
+		t.Errorf("Expected no uploads left, got %d", len(client.uploads))
+	}
+}
+
+// TestUploadChunkUnknownTransferID tests that a chunk for an unknown
+// transfer is rejected rather than appended to another upload
+func TestUploadChunkUnknownTransferID(t *testing.T) {
+	client, output := createMockClient()
+	testFilePath := filepath.Join(t.TempDir(), "test")
+	stageUpload(t, client, testFilePath)
+
+	other, _ := compression.CompressToHex([]byte("other upload"))
+	err := client.handleUploadChunkCommand("UPLOAD_CHUNK " + protocol.NewTransferID() + " " + other)
+	if err == nil {
+		t.Error("Expected error for unknown transfer ID")
+	}
+	if !bytes.Contains(output.Bytes(), []byte("No active upload")) {
+		t.Errorf("Expected 'No active upload' error, got: %s", output.String())
+	}
+
+	compressed, _ := compression.CompressToHex([]byte("legacy upload"))
+	if err := client.handleUploadChunkCommand("UPLOAD_CHUNK " + compressed); err != nil {
+		t.Fatalf("UPLOAD_CHUNK failed: %v", err)
+	}
+	if err := client.handleEndUploadCommand("END_UPLOAD " + testFilePath); err != nil {
+		t.Fatalf("END_UPLOAD failed: %v", err)
+	}
+	if written, _ := os.ReadFile(testFilePath); string(written) != "legacy upload" {
+		t.Errorf("Chunk for unknown transfer leaked into the legacy upload: %q", written)
+	}
+}
+
+// TestAbortUploadsRemovesStaging tests that uploads cut off by a dropped
+// connection leave no staging files behind
+func TestAbortUploadsRemovesStaging(t *testing.T) {
+	client, _ := createMockClient()
+	tmpDir := t.TempDir()
+	compressed, _ := compression.CompressToHex(bytes.Repeat([]byte("partial "), 10000))
+	stageUpload(t, client, filepath.Join(tmpDir, "partial"), compressed[:len(compressed)/2])
+
+	client.abortUploads()
+	if len(client.uploads) != 0 {
+		t.Errorf("Expected no uploads after abort, got %d", len(client.uploads))
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("Expected staging file to be removed, found %d entries", len(entries))
+	}
+}
+
+// TestUploadDiskSpaceChecks tests the free space checks made when staging and
+// writing an upload
+func TestUploadDiskSpaceChecks(t *testing.T) {
+	dir := t.TempDir()
+	free, ok := diskFree(dir)
+	if !ok {
+		t.Skip("free space not available on this platform")
+	}
+	f, err := os.CreateTemp(dir, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := &spaceCheckedWriter{f: f, dir: dir}
+	if _, err := w.Write([]byte("fits")); err != nil {
+		t.Fatalf("small write failed: %v", err)
+	}
+	w.allowance = 0
+	if _, err := w.Write(make([]byte, 1)); err != nil {
+		t.Fatalf("write after re-check failed: %v", err)
+	}
+	if _, err := startUpload(filepath.Join(dir, "huge"), int64(free)*2+2, protocol.OverwriteFail, 0, compression.CodecGzip, 0); !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("expected ErrInsufficientSpace for an upload larger than the disk, got %v", err)
+	}
+}
+
+// TestUploadOverwritePolicies tests uploads onto an existing file under each
+// overwrite policy
+func TestUploadOverwritePolicies(t *testing.T) {
+	compressed, _ := compression.CompressToHex([]byte("new content"))
+	tests := []struct {
+		name     string
+		option   string
+		wantErr  bool
+		wantPath string // Relative to the temp dir
+	}{
+		{"no option overwrites", "", false, "target.txt"},
+		{"overwrite", "exists=overwrite ", false, "target.txt"},
+		{"rename", "exists=rename ", false, "target-2.txt"},
+		{"fail", "exists=fail ", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, output := createMockClient()
+			dir := t.TempDir()
+			target := filepath.Join(dir, "target.txt")
+			os.WriteFile(target, []byte("old content"), 0644)
+			os.WriteFile(filepath.Join(dir, "target-1.txt"), []byte("taken"), 0644)
+
+			err := client.handleStartUploadCommand("START_UPLOAD " + tt.option + target + " 100")
+			if tt.wantErr {
+				if err == nil || !bytes.Contains(output.Bytes(), []byte("file already exists")) {
+					t.Fatalf("expected file exists error, got %v: %s", err, output.String())
+				}
+				if data, _ := os.ReadFile(target); string(data) != "old content" {
+					t.Errorf("existing file was modified: %q", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("START_UPLOAD failed: %v", err)
+			}
+			want := filepath.Join(dir, tt.wantPath)
+			if !bytes.Contains(output.Bytes(), []byte("OK\n"+want+"\n")) {
+				t.Errorf("expected destination %s in reply, got: %s", want, output.String())
+			}
+			client.handleUploadChunkCommand("UPLOAD_CHUNK " + compressed)
+			if err := client.handleEndUploadCommand("END_UPLOAD " + target); err != nil {
+				t.Fatalf("END_UPLOAD failed: %v", err)
+			}
+			if data, _ := os.ReadFile(want); string(data) != "new content" {
+				t.Errorf("expected new content in %s, got %q", want, data)
+			}
+		})
+	}
+}
+
+// TestUploadDestinationRenameDotfile tests that renaming keeps a dotfile's name
+func TestUploadDestinationRenameDotfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".profile")
+	os.WriteFile(path, nil, 0644)
+
+	got, err := uploadDestination(path, protocol.OverwriteRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, ".profile-1"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := uploadDestination(dir, protocol.OverwriteAlways); err == nil {
+		t.Error("expected an error uploading onto a directory")
+	}
+}
+
+// TestUploadInvalidOverwritePolicy tests that unknown policies are rejected
+func TestUploadInvalidOverwritePolicy(t *testing.T) {
+	client, output := createMockClient()
+	err := client.handleStartUploadCommand("START_UPLOAD exists=maybe " + filepath.Join(t.TempDir(), "x") + " 10")
+	if err == nil || !bytes.Contains(output.Bytes(), []byte("Invalid start_upload command")) {
+		t.Errorf("expected invalid command, got %v: %s", err, output.String())
+	}
+}
+
+// TestHandleDownloadSizeLimit tests that downloads over the listener's limit
+// are refused with the file size
+func TestHandleDownloadSizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.bin")
+	os.WriteFile(path, make([]byte, 2048), 0644)
+
+	client, output := createMockClient()
+	if err := client.handleDownloadCommand("DOWNLOAD max=1024 " + path); err == nil {
+		t.Error("expected download over the limit to fail")
+	}
+	if !bytes.Contains(output.Bytes(), []byte("File too large: 2048 bytes")) {
+		t.Errorf("expected file size in refusal, got: %s", output.String())
+	}
+
+	for _, cmd := range []string{"DOWNLOAD max=4096 " + path, "DOWNLOAD max=0 " + path, "DOWNLOAD " + path} {
+		client, output = createMockClient()
+		if err := client.handleDownloadCommand(cmd); err != nil {
+			t.Errorf("%s: unexpected error %v", cmd, err)
+		}
+		if !bytes.HasPrefix(output.Bytes(), []byte(protocol.DataPrefix)) {
+			t.Errorf("%s: expected data, got: %.60s", cmd, output.String())
+		}
+	}
+
+	client, output = createMockClient()
+	if err := client.handleDownloadCommand("DOWNLOAD " + filepath.Dir(path)); err == nil {
+		t.Error("expected downloading a directory to fail")
+	}
+}
+
+// TestTransferCodecsAndLimit tests that the codec option selects the payload
+// encoding and that the client's own transfer limit is enforced both ways
+func TestTransferCodecsAndLimit(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("negotiated codec "), 4000)
+	path := filepath.Join(dir, "data.txt")
+	os.WriteFile(path, data, 0644)
+
+	client, output := createMockClient()
+	if err := client.handleDownloadCommand("DOWNLOAD max=1000000 codec=gzip64 " + path); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	payload := strings.TrimSuffix(strings.TrimPrefix(output.String(), protocol.DataPrefix), "\n"+protocol.EndOfOutputMarker+"\n")
+	if got, err := compression.Decode(compression.CodecGzip64, payload); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected a gzip64 payload: %v", err)
+	}
+
+	encoded, _, _ := compression.EncodeTransfer(compression.CodecGzip64, data)
+	dest := filepath.Join(dir, "up.txt")
+	client, _ = createMockClient()
+	for _, cmd := range []string{
+		fmt.Sprintf("START_UPLOAD codec=gzip64 %s %d", dest, len(encoded)),
+		"UPLOAD_CHUNK " + encoded,
+		"END_UPLOAD " + dest,
+	} {
+		if _, err := client.processCommand(cmd); err != nil {
+			t.Fatalf("%.30s failed: %v", cmd, err)
+		}
+	}
+	if written, _ := os.ReadFile(dest); !bytes.Equal(written, data) {
+		t.Errorf("gzip64 upload corrupted: got %d bytes", len(written))
+	}
+
+	client, output = createMockClient()
+	if err := client.handleStartUploadCommand("START_UPLOAD codec=zstd " + dest + " 10"); err == nil || !strings.Contains(output.String(), "Unsupported codec") {
+		t.Errorf("expected an unknown codec to be refused, got %q", output.String())
+	}
+
+	client, output = createMockClient()
+	client.options.MaxTransferSize = 1024
+	if err := client.handleDownloadCommand("DOWNLOAD " + path); !errors.Is(err, ErrTransferLimit) {
+		t.Errorf("expected the client's limit to refuse the download, got %v", err)
+	}
+	if !strings.Contains(output.String(), "client's transfer limit of 1024 bytes") {
+		t.Errorf("expected the limit in the refusal, got %q", output.String())
+	}
+
+	// The chunk may be decompressed after it is acknowledged, so the error
+	// can surface as late as END_UPLOAD
+	client, output = createMockClient()
+	client.options.MaxTransferSize = 1024
+	big := filepath.Join(dir, "big.txt")
+	hexed, _ := compression.CompressToHex(data)
+	client.processCommand(fmt.Sprintf("START_UPLOAD %s %d", big, len(hexed)))
+	client.processCommand("UPLOAD_CHUNK " + hexed)
+	client.processCommand("END_UPLOAD " + big)
+	if !strings.Contains(output.String(), ErrTransferLimit.Error()) {
+		t.Errorf("expected the limit in the error, got %q", output.String())
+	}
+	if _, err := os.Stat(big); err == nil {
+		t.Error("expected no file from the refused upload")
+	}
+}
+
+// TestHandlePeekCommand tests that PEEK returns the size and leading bytes
+func TestHandlePeekCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peek.bin")
+	os.WriteFile(path, []byte("\x7fELF and the rest of the file"), 0644)
+
+	client, output := createMockClient()
+	if err := client.handlePeekCommand("PEEK 4 " + path); err != nil {
+		t.Fatalf("PEEK failed: %v", err)
+	}
+	if want := "OK\n29\n7f454c46\n"; !strings.HasPrefix(output.String(), want) {
+		t.Errorf("expected %q, got %q", want, output.String())
+	}
+
+	// Asking for more than the file holds returns the whole file
+	client, output = createMockClient()
+	if _, err := client.processCommand("PEEK 100 " + path); err != nil {
+		t.Fatalf("PEEK via processCommand failed: %v", err)
+	}
+	if !strings.Contains(output.String(), "\n29\n7f454c4620616e64") {
+		t.Errorf("expected whole file, got %q", output.String())
+	}
+
+	for _, cmd := range []string{"PEEK " + path, "PEEK x " + path, "PEEK 4 " + filepath.Dir(path), "PEEK 4 /nonexistent"} {
+		client, output = createMockClient()
+		if err := client.handlePeekCommand(cmd); err == nil {
+			t.Errorf("%s: expected error, got %q", cmd, output.String())
+		}
+	}
+}
+
+// TestDeltaUpload tests that a delta made from SIGNATURE patches the
+// existing file in place
+func TestDeltaUpload(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "app.conf")
+	old := bytes.Repeat([]byte("setting = value\n"), 1000)
+	os.WriteFile(target, old, 0600)
+
+	client, output := createMockClient()
+	if err := client.handleSignatureCommand("SIGNATURE 512 " + target); err != nil {
+		t.Fatalf("SIGNATURE failed: %v", err)
+	}
+	lines := strings.Split(output.String(), "\n")
+	wire, err := hex.DecodeString(lines[1])
+	var sig delta.Signature
+	if lines[0] != "OK" || err != nil || sig.UnmarshalBinary(wire) != nil {
+		t.Fatalf("unexpected SIGNATURE reply %.80q", output.String())
+	}
+
+	updated := append(append([]byte(nil), old...), "new = entry\n"...)
+	d, _ := delta.Diff(&sig, updated)
+	compressed, _ := compression.CompressToHex(d)
+	output.Reset()
+	if err := client.handleStartUploadCommand(fmt.Sprintf("START_UPLOAD exists=overwrite delta=512 %s %d", target, len(compressed))); err != nil {
+		t.Fatalf("START_UPLOAD failed: %v: %s", err, output.String())
+	}
+	client.handleUploadChunkCommand("UPLOAD_CHUNK " + compressed)
+	if err := client.handleEndUploadCommand("END_UPLOAD " + target); err != nil {
+		t.Fatalf("END_UPLOAD failed: %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, updated) {
+		t.Errorf("patched file differs: %d bytes, want %d", len(got), len(updated))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("expected the staging files to be removed, found %d entries", len(entries))
+	}
+
+	// A delta needs a file to patch
+	output.Reset()
+	missing := filepath.Join(filepath.Dir(target), "missing.conf")
+	if err := client.handleStartUploadCommand("START_UPLOAD delta=512 " + missing + " 10"); err == nil || !strings.HasPrefix(output.String(), "Write error") {
+		t.Errorf("expected a delta upload to a missing file to fail, got %v", err)
+	}
+	output.Reset()
+	if err := client.handleSignatureCommand("SIGNATURE 512 " + missing); err == nil || !strings.HasPrefix(output.String(), "Error reading file") {
+		t.Errorf("expected an error for a missing file, got %v", err)
+	}
+}
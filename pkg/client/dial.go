@@ -0,0 +1,65 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/frjcomp/gots/pkg/icmptunnel"
+)
+
+// newDialer builds the dialer used for the listener connection, applying
+// the optional source IP and outbound interface binding.
+func (rc *ReverseClient) newDialer() (*net.Dialer, error) {
+	dialer := &net.Dialer{}
+	if rc.options.SourceIP != "" {
+		ip := net.ParseIP(rc.options.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP: %s", rc.options.SourceIP)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if rc.options.BindInterface != "" {
+		iface, err := net.InterfaceByName(rc.options.BindInterface)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bind interface: %w", err)
+		}
+		if err := bindInterface(dialer, iface); err != nil {
+			return nil, err
+		}
+	}
+	return dialer, nil
+}
+
+// clientTLS runs the TLS handshake over a connection the client set up
+// itself, sending the server name tls.Dial would: the target host, unless
+// it is an IP.
+func clientTLS(conn net.Conn, address string, tlsConfig *tls.Config) (*tls.Conn, error) {
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		if net.ParseIP(host) == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialTLSOverICMP opens the listener connection through an ICMP tunnel to
+// host.
+func dialTLSOverICMP(host string, tlsConfig *tls.Config) (*tls.Conn, error) {
+	log.Printf("⚠️  WARNING: ICMP tunnel transport is a last resort: expect a few KB/s, seconds of latency and dropped connections where pings are filtered or rate-limited")
+	conn, err := icmptunnel.Dial(host)
+	if err != nil {
+		return nil, err
+	}
+	return clientTLS(conn, host, tlsConfig)
+}
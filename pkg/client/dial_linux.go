@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"net"
+	"syscall"
+)
+
+// bindInterface pins the socket to iface with SO_BINDTODEVICE so routing
+// follows that interface regardless of the default route.
+func bindInterface(dialer *net.Dialer, iface *net.Interface) error {
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface.Name)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"fmt"
+	"net"
+)
+
+// bindInterface binds to the interface's address, since SO_BINDTODEVICE is
+// Linux-only. An explicit source IP takes precedence.
+func bindInterface(dialer *net.Dialer, iface *net.Interface) error {
+	if dialer.LocalAddr != nil {
+		return nil
+	}
+	ip, err := firstInterfaceIP(iface)
+	if err != nil {
+		return err
+	}
+	dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	return nil
+}
+
+// firstInterfaceIP returns the first IPv4 address of iface, falling back to
+// the first address of any family.
+func firstInterfaceIP(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses of %s: %w", iface.Name, err)
+	}
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("interface %s has no addresses", iface.Name)
+	}
+	return fallback, nil
+}
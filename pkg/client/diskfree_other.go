@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package client
+
+// diskFree is not implemented on this platform; callers skip the check.
+func diskFree(dir string) (uint64, bool) {
+	return 0, false
+}
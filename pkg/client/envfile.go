@@ -0,0 +1,144 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// handleEnvFileCommand runs ENV_FILE <path>|-: shell commands source path
+// from now on, or no file after -. The file must exist when it is set.
+func (rc *ReverseClient) handleEnvFileCommand(command string) error {
+	path := strings.TrimPrefix(command, protocol.CmdEnvFile+" ")
+	if err := rc.setEnvFile(path); err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		return rc.writer.Flush()
+	}
+	rc.writer.WriteString("OK\n" + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
+
+func (rc *ReverseClient) setEnvFile(path string) error {
+	if path == "-" {
+		rc.envFile = ""
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rc.envFile = abs
+	return nil
+}
+
+// shellCommandWithEnv prepares a shell command line to run, sourcing envFile
+// first when one is set. On Unix the file is sourced by the shell with
+// every assignment exported, so it may use the shell's syntax, e.g.
+// PATH=$PATH:/opt/bin. cmd.exe cannot source a file that is not a batch
+// file, so on Windows its KEY=VALUE lines are read by readEnvFile. If the
+// file cannot be read the command does not run.
+func shellCommandWithEnv(command, envFile string) (*exec.Cmd, error) {
+	if runtime.GOOS == "windows" {
+		cmd := exec.Command("cmd", "/C", command)
+		if envFile != "" {
+			env, err := readEnvFile(envFile, os.Environ())
+			if err != nil {
+				return nil, fmt.Errorf("environment file: %w", err)
+			}
+			cmd.Env = env
+		}
+		return cmd, nil
+	}
+	if envFile != "" {
+		command = "{ set -a && . " + quotePosix(envFile) + " && set +a; } || exit 1\n" + command
+	}
+	return exec.Command("bash", "-c", command), nil
+}
+
+// quotePosix quotes s as a single word for a POSIX shell.
+func quotePosix(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// percentVar matches a cmd.exe variable reference such as %PATH%.
+var percentVar = regexp.MustCompile(`%([^%=\s]+)%`)
+
+// readEnvFile applies the KEY=VALUE lines of an environment file to env,
+// the way cmd.exe would: names are case-insensitive and %NAME% in a value
+// expands to the variable as set so far. "set " and "export " prefixes,
+// quotes around values, blank lines and comments (#, ::, REM) are allowed,
+// so the same file serves Unix and Windows clients.
+func readEnvFile(path string, env []string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env = append([]string(nil), env...)
+	index := make(map[string]int, len(env)) // Upper-case name -> position in env
+	for i, kv := range env {
+		if name, _, ok := strings.Cut(kv, "="); ok {
+			index[strings.ToUpper(name)] = i
+		}
+	}
+	lookup := func(name string) (string, bool) {
+		i, ok := index[strings.ToUpper(name)]
+		if !ok {
+			return "", false
+		}
+		_, value, _ := strings.Cut(env[i], "=")
+		return value, true
+	}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		lower := strings.ToLower(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "::") || lower == "rem" || strings.HasPrefix(lower, "rem ") {
+			continue
+		}
+		for _, prefix := range []string{"set ", "export "} {
+			if strings.HasPrefix(lower, prefix) {
+				line = strings.TrimSpace(line[len(prefix):])
+				break
+			}
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		value = percentVar.ReplaceAllStringFunc(value, func(ref string) string {
+			if v, ok := lookup(ref[1 : len(ref)-1]); ok {
+				return v
+			}
+			return ref
+		})
+		if i, ok := index[strings.ToUpper(name)]; ok {
+			env[i] = name + "=" + value
+		} else {
+			index[strings.ToUpper(name)] = len(env)
+			env = append(env, name+"="+value)
+		}
+	}
+	return env, scanner.Err()
+}
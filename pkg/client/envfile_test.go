@@ -0,0 +1,60 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShellCommandWithEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sources the file with bash")
+	}
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "it's.env")
+	os.WriteFile(envFile, []byte("GOTS_TEST_PROXY=http://proxy:3128\nPATH=/opt/gots-test:$PATH\n"), 0o600)
+
+	cmd, err := shellCommandWithEnv(`echo "$GOTS_TEST_PROXY $PATH"`, envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("command failed: %v: %s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "http://proxy:3128 /opt/gots-test:") {
+		t.Errorf("expected the sourced variables, got %q", out)
+	}
+
+	// A file that went away stops the command instead of running it without
+	os.Remove(envFile)
+	cmd, _ = shellCommandWithEnv("echo ran", envFile)
+	out, err = cmd.CombinedOutput()
+	if err == nil || strings.Contains(string(out), "ran") {
+		t.Errorf("expected the command not to run, got %q (%v)", out, err)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.cmd")
+	os.WriteFile(path, []byte(strings.Join([]string{
+		"REM proxies",
+		":: locale",
+		"# unix style comment",
+		"",
+		`set HTTP_PROXY="http://proxy:3128"`,
+		"export LANG=C.UTF-8",
+		"Path=C:\\tools;%PATH%;%UNSET%",
+	}, "\r\n")), 0o600)
+	env, err := readEnvFile(path, []string{"PATH=C:\\Windows", "LANG=en_US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Path=C:\\tools;C:\\Windows;%UNSET%", "LANG=C.UTF-8", "HTTP_PROXY=http://proxy:3128"}
+	if !slices.Equal(env, want) {
+		t.Errorf("expected %q, got %q", want, env)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !minimal
+
 package client
 
 import (
@@ -12,9 +14,12 @@ import (
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
+const forwardSupported = true
+
 // ForwardHandler manages port forwarding on the client side
 type ForwardHandler struct {
 	connections map[string]map[string]net.Conn // fwdID -> connID -> conn
+	pipes       map[string]io.Closer           // fwdID -> named pipe being served
 	mu          sync.RWMutex
 	sendFunc    func(string)
 }
@@ -23,6 +28,7 @@ type ForwardHandler struct {
 func NewForwardHandler(sendFunc func(string)) *ForwardHandler {
 	return &ForwardHandler{
 		connections: make(map[string]map[string]net.Conn),
+		pipes:       make(map[string]io.Closer),
 		sendFunc:    sendFunc,
 	}
 }
@@ -49,7 +55,7 @@ func (fh *ForwardHandler) HandleForwardStart(fwdID, connID, targetAddr string) e
 	fh.mu.Unlock()
 
 	// Connect to target
-	conn, err := net.Dial("tcp", targetAddr)
+	conn, err := dialTarget(targetAddr)
 	if err != nil {
 		logging.Warnf("[-] Failed to connect to %s: %v", targetAddr, err)
 		fh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdForwardStop, fwdID, connID))
@@ -151,11 +157,27 @@ func (fh *ForwardHandler) closeConnection(fwdID, connID string) {
 	}
 }
 
+// active reports whether any forwarded connection is open.
+func (fh *ForwardHandler) active() bool {
+	fh.mu.RLock()
+	defer fh.mu.RUnlock()
+	for _, conns := range fh.connections {
+		if len(conns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Close closes all connections
 func (fh *ForwardHandler) Close() {
 	fh.mu.Lock()
 	defer fh.mu.Unlock()
 
+	for fwdID, pipe := range fh.pipes {
+		pipe.Close()
+		delete(fh.pipes, fwdID)
+	}
 	for fwdID, conns := range fh.connections {
 		for connID, conn := range conns {
 			conn.Close()
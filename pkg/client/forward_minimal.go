@@ -0,0 +1,56 @@
+//go:build minimal
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	forwardSupported = false
+	pipeSupported    = false
+)
+
+// ForwardHandler refuses port forwards in minimal builds, closing each
+// connection right away so the listener does not wait for it.
+type ForwardHandler struct {
+	sendFunc func(string)
+}
+
+// NewForwardHandler creates a new forward handler
+func NewForwardHandler(sendFunc func(string)) *ForwardHandler {
+	return &ForwardHandler{sendFunc: sendFunc}
+}
+
+// HandleForwardStart rejects the connection.
+func (fh *ForwardHandler) HandleForwardStart(fwdID, connID, targetAddr string) error {
+	fh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdForwardStop, fwdID, connID))
+	return fmt.Errorf("port forwarding not included in this build (minimal)")
+}
+
+// HandleForwardData discards data for the rejected connection.
+func (fh *ForwardHandler) HandleForwardData(fwdID, connID, encodedData string) error {
+	return nil
+}
+
+// HandleForwardStop is a no-op.
+func (fh *ForwardHandler) HandleForwardStop(fwdID, connID string) {}
+
+// HandlePipeListen rejects the pipe.
+func (fh *ForwardHandler) HandlePipeListen(fwdID, name string) error {
+	return fmt.Errorf("named pipes not included in this build (minimal)")
+}
+
+// HandlePipeReady is a no-op.
+func (fh *ForwardHandler) HandlePipeReady(fwdID, connID string) {}
+
+// HandlePipeClose is a no-op.
+func (fh *ForwardHandler) HandlePipeClose(fwdID string) {}
+
+// active reports false, as no connection is ever kept.
+func (fh *ForwardHandler) active() bool { return false }
+
+// Close is a no-op.
+func (fh *ForwardHandler) Close() {}
@@ -3,7 +3,10 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/frjcomp/gots/pkg/protocol"
 )
@@ -44,6 +47,14 @@ func TestHandleCommandsPingExit(t *testing.T) {
 	}
 }
 
+// TestHandleCommandsTerminate ensures TERMINATE stops the loop with ErrTerminated
+func TestHandleCommandsTerminate(t *testing.T) {
+	rc, _ := mockClientLoop([]byte(protocol.CmdTerminate+"\n"+protocol.CmdPing+"\n"), 0)
+	if err := rc.HandleCommands(); !errors.Is(err, ErrTerminated) {
+		t.Fatalf("expected ErrTerminated, got %v", err)
+	}
+}
+
 // TestHandleCommandsEOF ensures EOF leads to a clean exit with no error
 func TestHandleCommandsEOF(t *testing.T) {
 	rc, _ := mockClientLoop(nil, 0)
@@ -67,3 +78,36 @@ func TestHandleCommandsBufferFull(t *testing.T) {
 		t.Fatalf("HandleCommands returned error under buffer-full scenario: %v", err)
 	}
 }
+
+// TestHandleCommandsRekey ensures REKEY ends the loop with ErrRekey once the
+// connection is quiet, and not while an upload is in progress
+func TestHandleCommandsRekey(t *testing.T) {
+	defer func(d time.Duration) { rekeyQuiet = d }(rekeyQuiet)
+	rekeyQuiet = 50 * time.Millisecond
+
+	rc := &ReverseClient{lastCommand: time.Now()}
+	if rc.rekeyReady() {
+		t.Error("expected no rekey before the listener asks for one")
+	}
+	rc.rekeyRequested = true
+	rc.uploads = map[string]*uploadState{"": {}}
+	time.Sleep(rekeyQuiet)
+	if rc.rekeyReady() {
+		t.Error("expected no rekey during an upload")
+	}
+
+	conn, listener := net.Pipe()
+	defer listener.Close()
+	rc = &ReverseClient{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	done := make(chan error, 1)
+	go func() { done <- rc.HandleCommands() }()
+	listener.Write([]byte(protocol.CmdRekey + "\n"))
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrRekey) {
+			t.Fatalf("expected ErrRekey, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not reconnect for new keys")
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+)
+
+// exeHash is the SHA-256 of the client's executable, empty if it could not
+// be read. SYSINFO reports it as "sha256", so the listener can compare it
+// with the builds it recorded.
+var exeHash = sync.OnceValue(func() string {
+	path, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+})
+
+// HashExecutable hashes the client's executable. gotsr calls it at startup,
+// so the hash is of the file that was started, even if it is replaced or
+// cleaned on disk later.
+func HashExecutable() string {
+	return exeHash()
+}
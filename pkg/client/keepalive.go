@@ -0,0 +1,96 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	// keepaliveTimeout is how long the client waits without hearing from
+	// the listener before treating the connection as dead. Listeners ping
+	// at least every protocol.PingInterval, whatever the client asked for.
+	keepaliveTimeout = 3 * protocol.PingInterval * time.Second
+	// idleDropLimit is how many connections in a row must die while idle
+	// before the adaptive keepalive asks for more frequent pings.
+	idleDropLimit = 2
+)
+
+// errKeepaliveTimeout is returned by HandleCommands when the listener went
+// quiet for longer than keepaliveTimeout, e.g. because a NAT on the way
+// dropped the flow without telling either end.
+var errKeepaliveTimeout = errors.New("no data from listener within keepalive timeout")
+
+// adaptiveKeepalive learns a ping interval short enough to keep NAT and
+// firewall flows alive. A connection that dies while it was idle for at
+// least half the requested interval looks like a dropped flow; after
+// idleDropLimit of those in a row the interval is halved, down to
+// protocol.MinPingInterval. It outlives ReverseClient instances since gotsr
+// creates a new one for every reconnect.
+type adaptiveKeepalive struct {
+	mu        sync.Mutex
+	interval  time.Duration // Learned interval, zero until the first drop pattern
+	idleDrops int
+}
+
+var keepalive adaptiveKeepalive
+
+// requested returns the interval to ask for, given the configured one.
+func (k *adaptiveKeepalive) requested(configured time.Duration) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.requestedLocked(configured)
+}
+
+func (k *adaptiveKeepalive) requestedLocked(configured time.Duration) time.Duration {
+	if configured <= 0 || configured > protocol.PingInterval*time.Second {
+		configured = protocol.PingInterval * time.Second
+	}
+	if k.interval > 0 && k.interval < configured {
+		return k.interval
+	}
+	return configured
+}
+
+// connectionLost records how a connection ended: dropped is false for a
+// clean close by the listener, idle is how long nothing had been read.
+func (k *adaptiveKeepalive) connectionLost(configured, idle time.Duration, dropped bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	current := k.requestedLocked(configured)
+	if !dropped || idle < current/2 {
+		k.idleDrops = 0
+		return
+	}
+	k.idleDrops++
+	if k.idleDrops < idleDropLimit {
+		return
+	}
+	k.idleDrops = 0
+	next := max(current/2, protocol.MinPingInterval*time.Second)
+	if next < current {
+		k.interval = next
+		log.Printf("Connection dropped %d times while idle, asking the listener for pings every %s", idleDropLimit, next)
+	}
+}
+
+// pingInterval is the interval this client asks the listener for.
+func (rc *ReverseClient) pingInterval() time.Duration {
+	if rc.options.AdaptivePing {
+		return keepalive.requested(rc.options.PingInterval)
+	}
+	if d := rc.options.PingInterval; d > 0 {
+		return d
+	}
+	return protocol.PingInterval * time.Second
+}
+
+// connectionLost feeds the end of a connection to the adaptive keepalive.
+func (rc *ReverseClient) connectionLost(lastRead time.Time, dropped bool) {
+	if rc.options.AdaptivePing {
+		keepalive.connectionLost(rc.options.PingInterval, time.Since(lastRead), dropped)
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestAdaptiveKeepalive(t *testing.T) {
+	var k adaptiveKeepalive
+	def := protocol.PingInterval * time.Second
+	if got := k.requested(0); got != def {
+		t.Fatalf("expected the default interval, got %s", got)
+	}
+
+	// One idle drop is not a pattern; a busy drop resets the count
+	k.connectionLost(0, 40*time.Second, true)
+	k.connectionLost(0, time.Second, true)
+	k.connectionLost(0, 40*time.Second, true)
+	if got := k.requested(0); got != def {
+		t.Fatalf("expected no change yet, got %s", got)
+	}
+	k.connectionLost(0, 40*time.Second, true)
+	if got := k.requested(0); got != def/2 {
+		t.Fatalf("expected the interval to be halved, got %s", got)
+	}
+
+	// Clean closes do not count, and the interval never drops below the minimum
+	k.connectionLost(0, time.Hour, false)
+	for i := 0; i < 10; i++ {
+		k.connectionLost(0, time.Hour, true)
+	}
+	if got := k.requested(0); got != protocol.MinPingInterval*time.Second {
+		t.Errorf("expected the minimum interval, got %s", got)
+	}
+	if got := k.requested(3 * time.Second); got != 3*time.Second {
+		t.Errorf("expected a shorter configured interval to win, got %s", got)
+	}
+}
+
+func TestIdentPayloadIncludesPingInterval(t *testing.T) {
+	rc := NewReverseClientWithOptions("localhost:0", "", "", Options{PingInterval: 10 * time.Second})
+	if payload := rc.buildIdentPayload("abcd1234"); !strings.Contains(payload, " ping=10") {
+		t.Errorf("expected ping=10 in IDENT payload, got %q", payload)
+	}
+	for _, opts := range []Options{{}, {PingInterval: time.Minute}, {AdaptivePing: true}} {
+		rc := NewReverseClientWithOptions("localhost:0", "", "", opts)
+		if payload := rc.buildIdentPayload("abcd1234"); strings.Contains(payload, "ping=") {
+			t.Errorf("expected no ping request for %+v, got %q", opts, payload)
+		}
+	}
+}
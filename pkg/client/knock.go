@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// knockGap separates the knocks of a sequence, so they arrive in order,
+// and gives the last one time to open the port before connecting. A TCP
+// knock to a filtered port waits no longer than this either.
+const knockGap = 200 * time.Millisecond
+
+// knock sends the configured knock sequence to the listener's host. The
+// knocks come from the same source address as the connection that
+// follows, so they open the port for it.
+func (rc *ReverseClient) knock(dialer *net.Dialer, address string) error {
+	knocks, err := config.ParseKnockSequence(rc.options.Knock)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	d := *dialer
+	d.Timeout = knockGap
+	for _, k := range knocks {
+		target := net.JoinHostPort(host, strconv.Itoa(k.Port))
+		switch k.Proto {
+		case config.KnockTCP:
+			// A knocking daemon only needs to see the SYN; the port is
+			// normally closed or filtered, so failures are expected
+			if conn, err := d.Dial("tcp", target); err == nil {
+				conn.Close()
+			}
+		case config.KnockUDP:
+			if err := sendDatagram(&d, target, nil); err != nil {
+				return fmt.Errorf("knock %s:%d: %w", k.Proto, k.Port, err)
+			}
+		case config.KnockSPA:
+			key, err := config.ParseSPAKey(rc.options.SPAKey)
+			if err != nil {
+				return err
+			}
+			err = sendDatagram(&d, target, func(local netip.Addr) ([]byte, error) {
+				return protocol.NewSPAPacket(key, spaSource(local), time.Now())
+			})
+			if err != nil {
+				return fmt.Errorf("knock %s:%d: %w", k.Proto, k.Port, err)
+			}
+		}
+		time.Sleep(knockGap)
+	}
+	log.Printf("✓ Sent knock sequence to %s", host)
+	return nil
+}
+
+// sendDatagram sends one UDP datagram to target. payload, if not nil,
+// builds it for the local address the datagram is sent from.
+func sendDatagram(dialer *net.Dialer, target string, payload func(local netip.Addr) ([]byte, error)) error {
+	d := *dialer
+	if local, ok := d.LocalAddr.(*net.TCPAddr); ok {
+		d.LocalAddr = &net.UDPAddr{IP: local.IP}
+	}
+	conn, err := d.Dial("udp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var data []byte
+	if payload != nil {
+		local, _ := netip.ParseAddrPort(conn.LocalAddr().String())
+		if data, err = payload(local.Addr()); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+// cgnat is the shared address space carrier-grade NATs use (RFC 6598).
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// spaSource returns the address an SPA packet sent from local should be
+// bound to. A private address is most likely translated on the way, so the
+// packet is left valid from any address instead.
+func spaSource(local netip.Addr) netip.Addr {
+	local = local.Unmap()
+	if !local.IsValid() || local.IsPrivate() || cgnat.Contains(local) {
+		return netip.Addr{}
+	}
+	return local
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestKnockSendsSequence(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+
+	key := strings.Repeat("ab", 32)
+	rc := NewReverseClientWithOptions("127.0.0.1:1", "", "", Options{
+		Knock:  "udp:" + strconv.Itoa(port) + ",spa:" + strconv.Itoa(port),
+		SPAKey: key,
+	})
+	if err := rc.knock(&net.Dialer{}, "127.0.0.1:1"); err != nil {
+		t.Fatalf("knock: %v", err)
+	}
+
+	udp.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 512)
+	n, _, err := udp.ReadFrom(buf)
+	if err != nil || n != 0 {
+		t.Fatalf("expected an empty udp knock, got %d bytes, %v", n, err)
+	}
+	n, _, err = udp.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("expected an SPA packet: %v", err)
+	}
+	key32 := bytes.Repeat([]byte{0xab}, 32)
+	if _, err := protocol.VerifySPAPacket(key32, buf[:n], netip.MustParseAddr("127.0.0.1"), time.Now()); err != nil {
+		t.Errorf("SPA packet does not verify: %v", err)
+	}
+	if _, err := protocol.VerifySPAPacket(key32, buf[:n], netip.MustParseAddr("192.0.2.1"), time.Now()); !errors.Is(err, protocol.ErrSPASource) {
+		t.Errorf("expected the SPA packet to be bound to the loopback address, got %v", err)
+	}
+}
+
+func TestSPASource(t *testing.T) {
+	tests := []struct {
+		local, want string
+	}{
+		{"203.0.113.5", "203.0.113.5"},
+		{"::ffff:203.0.113.5", "203.0.113.5"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"192.168.1.10", ""},
+		{"10.1.2.3", ""},
+		{"100.64.0.9", ""},
+		{"fd00::1", ""},
+	}
+	for _, tt := range tests {
+		got := spaSource(netip.MustParseAddr(tt.local))
+		if (tt.want == "" && got.IsValid()) || (tt.want != "" && got != netip.MustParseAddr(tt.want)) {
+			t.Errorf("spaSource(%s) = %v, want %q", tt.local, got, tt.want)
+		}
+	}
+}
+
+func TestKnockRejectsBadSequence(t *testing.T) {
+	rc := NewReverseClientWithOptions("127.0.0.1:1", "", "", Options{Knock: "icmp:1"})
+	if err := rc.knock(&net.Dialer{}, "127.0.0.1:1"); err == nil {
+		t.Error("expected an invalid knock sequence to fail")
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// transferMemoryFactor is how many times its size a download occupies in
+// memory while it is read, compressed and hex encoded.
+const transferMemoryFactor = 4
+
+// throttleChunk bounds the bytes passed to the connection at once while a
+// bandwidth limit is set, so throttled traffic flows evenly.
+const throttleChunk = 16 << 10
+
+// Traffic counters of this process over all connections, reported in
+// SYSINFO.
+var netSent, netReceived atomic.Int64
+
+// ApplyResourceLimits applies the process-wide limits in opts: it lowers the
+// scheduling priority of gotsr and the commands it starts, and makes the Go
+// runtime collect garbage harder as the heap approaches the memory limit.
+// gotsr calls it once at startup; the bandwidth limit applies per connection.
+func ApplyResourceLimits(opts Options) error {
+	if opts.MemoryLimit > 0 {
+		debug.SetMemoryLimit(opts.MemoryLimit)
+	}
+	if opts.Nice > 0 {
+		if err := setPriority(opts.Nice); err != nil {
+			return fmt.Errorf("failed to lower priority: %w", err)
+		}
+	}
+	return nil
+}
+
+// memoryInUse returns the memory the Go runtime holds for this process.
+func memoryInUse() int64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	metrics.Read(sample)
+	return int64(sample[0].Value.Uint64() - sample[1].Value.Uint64())
+}
+
+// checkMemory returns an error if a transfer needing about need bytes would
+// take the client past its memory limit.
+func (rc *ReverseClient) checkMemory(need int64) error {
+	limit := rc.options.MemoryLimit
+	if limit <= 0 {
+		return nil
+	}
+	if used := memoryInUse(); used+need > limit {
+		return fmt.Errorf("client memory limit: %d bytes in use, %d more needed, limit %d bytes", used, need, limit)
+	}
+	return nil
+}
+
+// rateLimiter spreads traffic to at most rate bytes per second, allowing a
+// burst of one second's worth after an idle period.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time // When the traffic so far has been paid for
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate}
+}
+
+func (r *rateLimiter) wait(n int) {
+	r.mu.Lock()
+	now := time.Now()
+	if earliest := now.Add(-time.Second); r.next.Before(earliest) {
+		r.next = earliest
+	}
+	r.next = r.next.Add(time.Duration(int64(n) * int64(time.Second) / r.rate))
+	delay := r.next.Sub(now)
+	r.mu.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// meteredConn counts the traffic on a connection and, with a limiter,
+// throttles it. Reads and writes share one limit.
+type meteredConn struct {
+	net.Conn
+	limiter *rateLimiter
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	if c.limiter != nil && len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := c.Conn.Read(p)
+	netReceived.Add(int64(n))
+	if c.limiter != nil && n > 0 {
+		c.limiter.wait(n)
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	if c.limiter == nil {
+		n, err := c.Conn.Write(p)
+		netSent.Add(int64(n))
+		return n, err
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunk)]
+		c.limiter.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		netSent.Add(int64(n))
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// meter wraps conn for the protocol reader and writer.
+func (rc *ReverseClient) meter(conn net.Conn) net.Conn {
+	mc := &meteredConn{Conn: conn}
+	if rc.options.BandwidthLimit > 0 {
+		mc.limiter = newRateLimiter(rc.options.BandwidthLimit)
+	}
+	return mc
+}
+
+// maxSysinfoSleep bounds the sleep a listener may ask for with SYSINFO.
+const maxSysinfoSleep = 5 * time.Second
+
+// handleSysinfoCommand reports the client's resource usage and limits as
+// key=value lines, so the operator can check that it stays out of the way
+// of the host's workload, and facts about the host for sandbox checks. With
+// SYSINFO <sleep_ms> it sleeps first, which lets the listener notice
+// sandboxes that skip sleeps.
+func (rc *ReverseClient) handleSysinfoCommand(command string) error {
+	var slept time.Duration
+	if arg := strings.TrimSpace(strings.TrimPrefix(command, protocol.CmdSysinfo)); arg != "" {
+		ms, err := strconv.Atoi(arg)
+		if err != nil || ms < 0 {
+			rc.writer.WriteString("Invalid sysinfo command\n" + protocol.EndOfOutputMarker + "\n")
+			rc.writer.Flush()
+			return fmt.Errorf("invalid sysinfo command: %s", command)
+		}
+		start := time.Now()
+		time.Sleep(min(time.Duration(ms)*time.Millisecond, maxSysinfoSleep))
+		slept = time.Since(start)
+	}
+	info := []string{
+		"OK",
+		fmt.Sprintf("pid=%d", os.Getpid()),
+		fmt.Sprintf("platform=%s/%s", runtime.GOOS, runtime.GOARCH),
+		fmt.Sprintf("goroutines=%d", runtime.NumGoroutine()),
+		fmt.Sprintf("nice=%d", rc.options.Nice),
+		fmt.Sprintf("memory=%d", memoryInUse()),
+		fmt.Sprintf("memory_limit=%d", max(rc.options.MemoryLimit, 0)),
+		fmt.Sprintf("net_sent=%d", netSent.Load()),
+		fmt.Sprintf("net_received=%d", netReceived.Load()),
+		fmt.Sprintf("bandwidth_limit=%d", max(rc.options.BandwidthLimit, 0)),
+		fmt.Sprintf("uploads=%d", len(rc.uploads)),
+	}
+	if user, system, ok := cpuTimes(); ok {
+		info = append(info, fmt.Sprintf("cpu_user=%s", user), fmt.Sprintf("cpu_system=%s", system))
+	}
+	info = append(info, fmt.Sprintf("cpus=%d", runtime.NumCPU()))
+	info = append(info, fmt.Sprintf("scrubbed=%t", argsScrubbed.Load()))
+	if uptime, ok := hostUptime(); ok {
+		info = append(info, fmt.Sprintf("uptime=%d", int64(uptime.Seconds())))
+	}
+	if hash := exeHash(); hash != "" {
+		info = append(info, "sha256="+hash)
+	}
+	if artifacts := sandboxArtifacts(); len(artifacts) > 0 {
+		info = append(info, "artifacts="+strings.Join(artifacts, ","))
+	}
+	if slept > 0 {
+		info = append(info, fmt.Sprintf("slept=%d", slept.Milliseconds()))
+	}
+	if _, err := rc.writer.WriteString(strings.Join(info, "\n") + "\n" + protocol.EndOfOutputMarker + "\n"); err != nil {
+		return err
+	}
+	return rc.writer.Flush()
+}
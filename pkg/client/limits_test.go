@@ -0,0 +1,112 @@
+package client
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := newRateLimiter(100 << 10)
+	start := time.Now()
+	// The first second's worth passes as a burst, the rest is paced
+	r.wait(100 << 10)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected a burst to pass right away, took %s", elapsed)
+	}
+	r.wait(20 << 10)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected traffic beyond the burst to wait, took %s", elapsed)
+	}
+}
+
+func TestMeteredConnCountsAndThrottles(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	go io.Copy(io.Discard, remote)
+
+	rc := &ReverseClient{options: Options{BandwidthLimit: 64 << 10}}
+	conn := rc.meter(local)
+	sentBefore := netSent.Load()
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 96<<10)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected 96 KiB at 64 KiB/s to be throttled, took %s", elapsed)
+	}
+	if sent := netSent.Load() - sentBefore; sent != 96<<10 {
+		t.Errorf("expected 96 KiB counted, got %d", sent)
+	}
+}
+
+func TestHandleSysinfoCommand(t *testing.T) {
+	client, output := createMockClient()
+	client.options = Options{Nice: 10, MemoryLimit: 64 << 20}
+	if _, err := client.processCommand(protocol.CmdSysinfo); err != nil {
+		t.Fatalf("SYSINFO failed: %v", err)
+	}
+	result := output.String()
+	if len(HashExecutable()) != 64 {
+		t.Fatalf("expected a SHA-256 of the test binary, got %q", HashExecutable())
+	}
+	for _, want := range []string{"OK\n", "pid=", "goroutines=", "nice=10\n", "memory_limit=67108864\n", "bandwidth_limit=0\n", "net_sent=", "sha256=" + HashExecutable() + "\n", protocol.EndOfOutputMarker} {
+		if !strings.Contains(result, want) {
+			t.Errorf("SYSINFO response lacks %q: %q", want, result)
+		}
+	}
+}
+
+func TestDownloadRefusedOverMemoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(path, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, output := createMockClient()
+	client.options.MemoryLimit = memoryInUse() + 1<<20
+	if err := client.handleDownloadCommand(protocol.CmdDownload + " " + path); err == nil {
+		t.Error("expected the download to be refused")
+	}
+	if !strings.HasPrefix(output.String(), "Refused: client memory limit") {
+		t.Errorf("unexpected response %q", output.String())
+	}
+
+	client, output = createMockClient()
+	if err := client.handleDownloadCommand(protocol.CmdDownload + " " + path); err != nil {
+		t.Errorf("expected the download to pass without a limit: %v", err)
+	}
+	if !strings.HasPrefix(output.String(), protocol.DataPrefix) {
+		t.Errorf("unexpected response %.40q", output.String())
+	}
+}
+
+func TestHandleSysinfoCommandSleeps(t *testing.T) {
+	client, output := createMockClient()
+	start := time.Now()
+	if _, err := client.processCommand(protocol.CmdSysinfo + " 50"); err != nil {
+		t.Fatalf("SYSINFO failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected SYSINFO to sleep 50ms, took %s", elapsed)
+	}
+	for _, want := range []string{"OK\n", "cpus=", "slept="} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("SYSINFO response lacks %q: %q", want, output.String())
+		}
+	}
+
+	client, output = createMockClient()
+	if _, err := client.processCommand(protocol.CmdSysinfo + " soon"); err == nil {
+		t.Error("expected an error for an invalid sleep")
+	}
+	if !strings.HasPrefix(output.String(), "Invalid sysinfo command") {
+		t.Errorf("unexpected response %q", output.String())
+	}
+}
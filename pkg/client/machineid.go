@@ -0,0 +1,45 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DefaultMachineIDSalt is mixed into the machine identifier when no salt is
+// configured, so the raw OS machine ID is never sent.
+const DefaultMachineIDSalt = "gots"
+
+var (
+	machineIDMu    sync.Mutex
+	machineIDCache = make(map[string]string)
+)
+
+// MachineID returns a stable identifier for this host: a salted hash of the
+// OS machine ID (falling back to the hostname). It survives reinstalls and
+// rebuilt binaries, so the listener can map reconnects to one asset.
+func MachineID(salt string) string {
+	if salt == "" {
+		salt = DefaultMachineIDSalt
+	}
+	machineIDMu.Lock()
+	defer machineIDMu.Unlock()
+	if id, ok := machineIDCache[salt]; ok {
+		return id
+	}
+
+	raw := strings.TrimSpace(readMachineID())
+	if raw == "" {
+		raw, _ = os.Hostname()
+		raw = "host:" + strings.ToLower(raw)
+	}
+	if raw == "host:" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(salt + "\x00" + raw))
+	id := hex.EncodeToString(sum[:8])
+	machineIDCache[salt] = id
+	return id
+}
@@ -0,0 +1,22 @@
+//go:build darwin
+
+package client
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// readMachineID returns the hardware UUID reported by IOKit.
+func readMachineID() string {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if _, val, ok := strings.Cut(line, `"IOPlatformUUID" = `); ok {
+			return strings.Trim(val, `" `)
+		}
+	}
+	return ""
+}
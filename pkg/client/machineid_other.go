@@ -0,0 +1,15 @@
+//go:build !windows && !darwin
+
+package client
+
+import "os"
+
+// readMachineID returns the systemd/dbus machine ID, or the BSD host ID.
+func readMachineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id", "/etc/hostid"} {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return string(data)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMachineIDStableAndSalted(t *testing.T) {
+	id := MachineID("")
+	if len(id) != 16 {
+		t.Fatalf("expected a 16-char machine ID, got %q", id)
+	}
+	if again := MachineID(DefaultMachineIDSalt); again != id {
+		t.Errorf("expected the default salt to give the same ID, got %q and %q", id, again)
+	}
+	if other := MachineID("engagement-42"); other == id {
+		t.Error("expected a different salt to change the machine ID")
+	}
+	if raw := strings.TrimSpace(readMachineID()); raw != "" && strings.Contains(raw, id) {
+		t.Error("machine ID must not expose the raw OS identifier")
+	}
+
+	payload := NewReverseClient("localhost:0", "", "").buildIdentPayload("abcd1234")
+	if !strings.Contains(payload, " mid="+id) {
+		t.Errorf("expected machine ID in IDENT payload, got %q", payload)
+	}
+}
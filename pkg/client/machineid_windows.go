@@ -0,0 +1,19 @@
+//go:build windows
+
+package client
+
+import "golang.org/x/sys/windows/registry"
+
+// readMachineID returns the MachineGuid generated at Windows setup.
+func readMachineID() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	guid, _, err := key.GetStringValue("MachineGuid")
+	if err != nil {
+		return ""
+	}
+	return guid
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// maxPatchBytes bounds a single PATCH; larger edits are uploads.
+const maxPatchBytes = 64 << 10
+
+// handlePatchCommand runs PATCH <offset> <hex_bytes> <hex_expected>|- <path>:
+// the bytes at offset are checked against the expected ones, the file is
+// copied to a backup next to it and the new bytes are written in place. The
+// file keeps its size, mode and owner.
+func (rc *ReverseClient) handlePatchCommand(command string) error {
+	backup, original, err := applyPatch(command)
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		return rc.writer.Flush()
+	}
+	rc.writer.WriteString(fmt.Sprintf("OK\n%s\n%s\n", backup, hex.EncodeToString(original)) + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
+
+func applyPatch(command string) (string, []byte, error) {
+	parts := strings.SplitN(command, " ", 5)
+	errInvalid := errors.New("invalid patch command")
+	if len(parts) != 5 || parts[4] == "" {
+		return "", nil, errInvalid
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || offset < 0 {
+		return "", nil, errInvalid
+	}
+	patch, err := hex.DecodeString(parts[2])
+	if err != nil || len(patch) == 0 || len(patch) > maxPatchBytes {
+		return "", nil, errInvalid
+	}
+	var expected []byte
+	if parts[3] != "-" {
+		if expected, err = hex.DecodeString(parts[3]); err != nil || len(expected) != len(patch) {
+			return "", nil, errInvalid
+		}
+	}
+	path := parts[4]
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if offset+int64(len(patch)) > info.Size() {
+		return "", nil, fmt.Errorf("patch ends beyond the end of %s (%d bytes)", path, info.Size())
+	}
+	original := make([]byte, len(patch))
+	if _, err := f.ReadAt(original, offset); err != nil {
+		return "", nil, err
+	}
+	if expected != nil && !bytes.Equal(original, expected) {
+		return "", nil, fmt.Errorf("expected %s at offset %#x, found %s; nothing changed", hex.EncodeToString(expected), offset, hex.EncodeToString(original))
+	}
+
+	backup, err := backupFile(f, path, info.Mode().Perm())
+	if err != nil {
+		return "", nil, fmt.Errorf("backup: %w", err)
+	}
+	if _, err := f.WriteAt(patch, offset); err != nil {
+		return "", nil, err
+	}
+	return backup, original, f.Sync()
+}
+
+// backupFile copies f to the first of path.bak, path.bak.1, ... that does
+// not exist yet, so earlier backups are never overwritten.
+func backupFile(f *os.File, path string, perm os.FileMode) (string, error) {
+	for i := 0; ; i++ {
+		name := path + ".bak"
+		if i > 0 {
+			name += "." + strconv.Itoa(i)
+		}
+		out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, io.NewSectionReader(f, 0, 1<<62))
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(name)
+			return "", err
+		}
+		return name, nil
+	}
+}
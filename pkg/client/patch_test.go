@@ -0,0 +1,63 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestHandlePatchCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin")
+	os.WriteFile(path, []byte("\x7fELF\x74\x0e\x00\x00"), 0o750)
+
+	client, output := createMockClient()
+	if _, err := client.processCommand(protocol.CmdPatch + " 4 9090 740e " + path); err != nil {
+		t.Fatalf("PATCH failed: %v", err)
+	}
+	want := "OK\n" + path + ".bak\n740e\n" + protocol.EndOfOutputMarker + "\n"
+	if output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "\x7fELF\x90\x90\x00\x00" {
+		t.Errorf("unexpected patched file %q", got)
+	}
+	if got, _ := os.ReadFile(path + ".bak"); string(got) != "\x7fELF\x74\x0e\x00\x00" {
+		t.Errorf("unexpected backup %q", got)
+	}
+	if info, _ := os.Stat(path + ".bak"); info.Mode().Perm() != 0o750 {
+		t.Errorf("expected the backup to keep the mode, got %v", info.Mode())
+	}
+
+	// The bytes no longer match, so nothing is written or backed up
+	output.Reset()
+	client.handlePatchCommand(protocol.CmdPatch + " 4 cc 74 " + path)
+	if !strings.HasPrefix(output.String(), "Error: expected 74 at offset 0x4, found 90") {
+		t.Errorf("unexpected reply %q", output.String())
+	}
+	if _, err := os.Stat(path + ".bak.1"); !os.IsNotExist(err) {
+		t.Error("expected no backup for a refused patch")
+	}
+
+	output.Reset()
+	client.handlePatchCommand(protocol.CmdPatch + " 5 cccc - " + path)
+	if !strings.HasPrefix(output.String(), "OK\n"+path+".bak.1\n9000\n") {
+		t.Errorf("expected a second backup, got %q", output.String())
+	}
+
+	for _, cmd := range []string{
+		protocol.CmdPatch + " 7 9090 - " + path, // Past the end
+		protocol.CmdPatch + " -1 90 - " + path,
+		protocol.CmdPatch + " 0 zz - " + path,
+		protocol.CmdPatch + " 0 90 9090 " + path, // Expected length differs
+		protocol.CmdPatch + " 0 90 - " + filepath.Dir(path),
+	} {
+		output.Reset()
+		client.handlePatchCommand(cmd)
+		if !strings.HasPrefix(output.String(), "Error: ") {
+			t.Errorf("%s: expected an error, got %q", cmd, output.String())
+		}
+	}
+}
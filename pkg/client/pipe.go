@@ -0,0 +1,97 @@
+//go:build !minimal
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// pipeListener serves a named pipe, one connection per program that opens it.
+type pipeListener interface {
+	Accept() (net.Conn, error)
+	io.Closer
+}
+
+// dialTarget connects a forward to its target, a host:port or a named pipe
+// given as protocol.PipePrefix followed by the pipe's name.
+func dialTarget(target string) (net.Conn, error) {
+	if name, ok := strings.CutPrefix(target, protocol.PipePrefix); ok {
+		return dialPipe(name)
+	}
+	return net.Dial("tcp", target)
+}
+
+// HandlePipeListen starts serving a named pipe for a reverse forward. Each
+// program that opens it is announced with PIPE_CONN and relayed once the
+// listener answers with PIPE_READY.
+func (fh *ForwardHandler) HandlePipeListen(fwdID, name string) error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if _, exists := fh.pipes[fwdID]; exists {
+		return fmt.Errorf("forward %s already serves a pipe", fwdID)
+	}
+	ln, err := listenPipe(name)
+	if err != nil {
+		return err
+	}
+	fh.pipes[fwdID] = ln
+	logging.Debugf("[+] Forward %s: serving pipe %s", fwdID, name)
+	go fh.acceptPipe(fwdID, ln)
+	return nil
+}
+
+func (fh *ForwardHandler) acceptPipe(fwdID string, ln pipeListener) {
+	for n := 1; ; n++ {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logging.Warnf("[-] Forward %s pipe error: %v", fwdID, err)
+			}
+			return
+		}
+		connID := fmt.Sprintf("p%d", n)
+		fh.mu.Lock()
+		if _, serving := fh.pipes[fwdID]; !serving {
+			fh.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if _, exists := fh.connections[fwdID]; !exists {
+			fh.connections[fwdID] = make(map[string]net.Conn)
+		}
+		fh.connections[fwdID][connID] = conn
+		fh.mu.Unlock()
+		fh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdPipeConn, fwdID, connID))
+	}
+}
+
+// HandlePipeReady starts relaying a pipe connection once the listener has
+// reached the forward's target.
+func (fh *ForwardHandler) HandlePipeReady(fwdID, connID string) {
+	fh.mu.RLock()
+	conn, ok := fh.connections[fwdID][connID]
+	fh.mu.RUnlock()
+	if ok {
+		go fh.readFromTarget(fwdID, connID, conn)
+	}
+}
+
+// HandlePipeClose stops serving a named pipe and closes its connections.
+func (fh *ForwardHandler) HandlePipeClose(fwdID string) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if ln, ok := fh.pipes[fwdID]; ok {
+		ln.Close()
+		delete(fh.pipes, fwdID)
+	}
+	for connID := range fh.connections[fwdID] {
+		fh.closeConnection(fwdID, connID)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !minimal
+
+package client
+
+import (
+	"errors"
+	"net"
+)
+
+const pipeSupported = false
+
+var errNoPipes = errors.New("named pipes are only available on Windows clients")
+
+func dialPipe(name string) (net.Conn, error) {
+	return nil, errNoPipes
+}
+
+func listenPipe(name string) (pipeListener, error) {
+	return nil, errNoPipes
+}
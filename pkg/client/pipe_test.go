@@ -0,0 +1,107 @@
+//go:build !minimal
+
+package client
+
+import (
+	"encoding/base64"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// fakePipeListener hands out the server ends of in-memory connections.
+type fakePipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+}
+
+func (l *fakePipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *fakePipeListener) Close() error {
+	close(l.closed)
+	return nil
+}
+
+func TestPipeConnectionsAreRelayedWhenReady(t *testing.T) {
+	sent := make(chan string, 10)
+	fh := NewForwardHandler(func(msg string) { sent <- msg })
+	ln := &fakePipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+	fh.pipes["pipe-1"] = ln
+	go fh.acceptPipe("pipe-1", ln)
+
+	program, server := net.Pipe()
+	defer program.Close()
+	ln.conns <- server
+	if msg := <-sent; msg != protocol.CmdPipeConn+" pipe-1 p1\n" {
+		t.Fatalf("expected PIPE_CONN, got %q", msg)
+	}
+
+	// Nothing is read from the pipe until the listener is ready
+	fh.HandlePipeReady("pipe-1", "p1")
+	go program.Write([]byte("hello"))
+	want := protocol.CmdForwardData + " pipe-1 p1 " + base64.StdEncoding.EncodeToString([]byte("hello")) + "\n"
+	select {
+	case msg := <-sent:
+		if msg != want {
+			t.Fatalf("expected %q, got %q", want, msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipe data not relayed")
+	}
+
+	read := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 4)
+		n, _ := program.Read(buf)
+		read <- string(buf[:n])
+	}()
+	if err := fh.HandleForwardData("pipe-1", "p1", base64.StdEncoding.EncodeToString([]byte("back"))); err != nil {
+		t.Fatalf("HandleForwardData: %v", err)
+	}
+	if got := <-read; got != "back" {
+		t.Errorf("program read %q", got)
+	}
+
+	fh.HandlePipeClose("pipe-1")
+	select {
+	case <-ln.closed:
+	default:
+		t.Error("pipe listener not closed")
+	}
+	if _, ok := fh.pipes["pipe-1"]; ok {
+		t.Error("pipe still registered")
+	}
+}
+
+func TestPipeListenRejectedOffWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are available")
+	}
+	rc, output := createMockClient()
+	rc.forwardHandler = NewForwardHandler(func(string) {})
+	if _, err := rc.processCommand(protocol.CmdPipeListen + " pipe-1 spoolss"); err == nil {
+		t.Error("expected error")
+	}
+	if out := output.String(); !contains(out, "Error: named pipes are only available on Windows clients") {
+		t.Errorf("unexpected reply %q", out)
+	}
+
+	sent := []string{}
+	fh := NewForwardHandler(func(msg string) { sent = append(sent, msg) })
+	if err := fh.HandleForwardStart("fwd-1", "1", protocol.PipePrefix+"spoolss"); err == nil {
+		t.Error("expected error dialing a pipe")
+	}
+	if len(sent) != 1 || sent[0] != protocol.CmdForwardStop+" fwd-1 1\n" {
+		t.Errorf("expected FORWARD_STOP, got %q", sent)
+	}
+}
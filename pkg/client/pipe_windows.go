@@ -0,0 +1,175 @@
+//go:build windows && !minimal
+
+package client
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	pipeSupported = true
+	// pipeBusyTimeout is how long dialPipe waits for a busy pipe to offer a
+	// free instance.
+	pipeBusyTimeout = 5 * time.Second
+	pipeBufferSize  = 64 << 10
+)
+
+// pipePath turns a pipe name into a path, leaving full paths such as
+// \\host\pipe\name alone.
+func pipePath(name string) string {
+	if strings.HasPrefix(name, `\\`) {
+		return name
+	}
+	return `\\.\pipe\` + name
+}
+
+// pipeAddr is the address of both ends of a pipe connection.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is an open pipe handle. Handles are opened for overlapped I/O so
+// that os.File can cancel blocked reads on Close.
+type pipeConn struct {
+	*os.File
+	addr pipeAddr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func newPipeConn(h windows.Handle, path string) *pipeConn {
+	return &pipeConn{File: os.NewFile(uintptr(h), path), addr: pipeAddr(path)}
+}
+
+func dialPipe(name string) (net.Conn, error) {
+	path := pipePath(name)
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(pipeBusyTimeout)
+	for {
+		h, err := windows.CreateFile(p, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return newPipeConn(h, path), nil
+		}
+		if err != windows.ERROR_PIPE_BUSY || time.Now().After(deadline) {
+			return nil, &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// winPipeListener creates a pipe instance per Accept. The first is created
+// by listenPipe so that a name already in use is reported right away.
+type winPipeListener struct {
+	path    string
+	mu      sync.Mutex
+	next    windows.Handle // Instance created ahead of Accept, or 0
+	pending windows.Handle // Instance Accept is waiting on, or 0
+	closed  bool
+}
+
+func listenPipe(name string) (pipeListener, error) {
+	l := &winPipeListener{path: pipePath(name)}
+	h, err := l.create(true)
+	if err != nil {
+		return nil, &os.PathError{Op: "listen", Path: l.path, Err: err}
+	}
+	l.next = h
+	return l, nil
+}
+
+// create makes a new instance of the pipe with the default security
+// descriptor, which admits the client's own user and administrators.
+func (l *winPipeListener) create(first bool) (windows.Handle, error) {
+	p, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return 0, err
+	}
+	mode := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		mode |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(p, mode, windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+}
+
+func (l *winPipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	h, err := l.next, error(nil)
+	l.next = 0
+	if h == 0 {
+		h, err = l.create(false)
+	}
+	if err == nil {
+		l.pending = h
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	err = connectNamedPipe(h)
+	l.mu.Lock()
+	l.pending = 0
+	closed := l.closed
+	l.mu.Unlock()
+	if closed || err != nil {
+		windows.CloseHandle(h)
+		if closed {
+			return nil, net.ErrClosed
+		}
+		return nil, err
+	}
+	return newPipeConn(h, l.path), nil
+}
+
+// connectNamedPipe waits for a program to open the pipe instance h. Close
+// cancels the wait.
+func connectNamedPipe(h windows.Handle) error {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(event)
+	ov := windows.Overlapped{HEvent: event}
+	switch err := windows.ConnectNamedPipe(h, &ov); err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+		return nil
+	case windows.ERROR_IO_PENDING:
+		var n uint32
+		return windows.GetOverlappedResult(h, &ov, &n, true)
+	default:
+		return err
+	}
+}
+
+func (l *winPipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	if l.next != 0 {
+		windows.CloseHandle(l.next)
+		l.next = 0
+	}
+	if l.pending != 0 {
+		windows.CancelIoEx(l.pending, nil)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// setPriority is not implemented on this platform.
+func setPriority(nice int) error {
+	return errors.New("not supported on this platform")
+}
+
+// cpuTimes is not implemented on this platform; SYSINFO leaves CPU out.
+func cpuTimes() (user, system time.Duration, ok bool) {
+	return 0, 0, false
+}
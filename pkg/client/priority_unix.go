@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd
+
+package client
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setPriority sets the nice value of this process. On Linux every thread
+// has its own, so each existing thread is changed; threads and commands
+// started later inherit it.
+func setPriority(nice int) error {
+	if runtime.GOOS != "linux" {
+		return unix.Setpriority(unix.PRIO_PROCESS, 0, nice)
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return unix.Setpriority(unix.PRIO_PROCESS, 0, nice)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+// cpuTimes returns the user and system CPU time this process has used.
+func cpuTimes() (user, system time.Duration, ok bool) {
+	var ru unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0, false
+	}
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), true
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package client
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// idleNice is the nice value from which gotsr runs in the idle priority
+// class rather than below normal.
+const idleNice = 15
+
+// setPriority maps a nice value to a Windows priority class.
+func setPriority(nice int) error {
+	class := uint32(windows.BELOW_NORMAL_PRIORITY_CLASS)
+	if nice >= idleNice {
+		class = windows.IDLE_PRIORITY_CLASS
+	}
+	return windows.SetPriorityClass(windows.CurrentProcess(), class)
+}
+
+// cpuTimes returns the user and kernel CPU time this process has used.
+func cpuTimes() (user, system time.Duration, ok bool) {
+	var creation, exit, kernel, usr windows.Filetime
+	if err := windows.GetProcessTimes(windows.CurrentProcess(), &creation, &exit, &kernel, &usr); err != nil {
+		return 0, 0, false
+	}
+	// Filetime counts 100ns intervals
+	ticks := func(ft windows.Filetime) time.Duration {
+		return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+	}
+	return ticks(usr), ticks(kernel), true
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// stdinIdleTimeout is how long a PROMPTED command may stay silent before its
+// stdin is closed. Those commands get a stdin pipe so password prompts can be
+// answered; closing it once output stalls without a prompt gives commands
+// that read stdin the EOF other commands get immediately.
+const stdinIdleTimeout = 1 * time.Second
+
+// passwordPromptPattern matches the last line of output when a command is
+// waiting for a secret, e.g. "[sudo] password for alice: " or
+// "Enter passphrase for key '/root/.ssh/id_rsa': ".
+var passwordPromptPattern = regexp.MustCompile(`(?i)(password|passphrase|passcode)[^\n]{0,128}:\s*$`)
+
+// detectPasswordPrompt returns the prompt if output ends with one.
+func detectPasswordPrompt(output []byte) (string, bool) {
+	last := output
+	if i := bytes.LastIndexByte(output, '\n'); i >= 0 {
+		last = output[i+1:]
+	}
+	if len(last) == 0 || !passwordPromptPattern.Match(last) {
+		return "", false
+	}
+	return strings.TrimSpace(string(last)), true
+}
+
+// relaySecret tells the listener a command is prompting and writes the
+// operator's answer to stdin. The secret is never logged. It returns false
+// when the operator cancels, no answer comes within protocol.PromptTimeout or
+// the connection fails.
+// Other frames arriving meanwhile (PING, forward and SOCKS data) are handled
+// normally.
+func (rc *ReverseClient) relaySecret(stdin io.Writer, prompt string) bool {
+	log.Printf("Command is waiting for a password, asking the listener")
+	frame := fmt.Sprintf("%s %s\n", protocol.CmdPrompt, hex.EncodeToString([]byte(prompt)))
+	if _, err := rc.writer.WriteString(frame); err != nil {
+		return false
+	}
+	if err := rc.writer.Flush(); err != nil {
+		return false
+	}
+
+	deadline := time.Now().Add(protocol.PromptTimeout * time.Second)
+	var lineBuf strings.Builder
+	for time.Now().Before(deadline) {
+		if rc.conn != nil {
+			rc.conn.SetReadDeadline(time.Now().Add(protocol.ReadTimeout * time.Second))
+		}
+		line, err := rc.reader.ReadString('\n')
+		if rc.conn != nil {
+			rc.conn.SetReadDeadline(time.Time{})
+		}
+		lineBuf.WriteString(line)
+		if err != nil {
+			if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+				continue
+			}
+			return false
+		}
+
+		command := strings.TrimSpace(lineBuf.String())
+		lineBuf.Reset()
+		if command == protocol.CmdSecret {
+			log.Printf("Password prompt cancelled by listener")
+			return false
+		}
+		if encoded, ok := strings.CutPrefix(command, protocol.CmdSecret+" "); ok {
+			secret, err := hex.DecodeString(encoded)
+			if err != nil {
+				return false
+			}
+			answer := make([]byte, len(secret)+1)
+			copy(answer, secret)
+			answer[len(secret)] = '\n'
+			_, err = stdin.Write(answer)
+			clear(secret)
+			clear(answer)
+			return err == nil
+		}
+		if command == "" {
+			continue
+		}
+		if _, err := rc.processCommand(command); err != nil {
+			log.Printf("Error processing command: %v", err)
+		}
+	}
+	log.Printf("Timed out waiting for a password")
+	return false
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestDetectPasswordPrompt(t *testing.T) {
+	cases := map[string]bool{
+		"[sudo] password for alice: ":                    true,
+		"some output\nPassword:":                         true,
+		"Enter passphrase for key '/root/.ssh/id_rsa': ": true,
+		"password changed\n":                             false,
+		"no prompt here":                                 false,
+		"":                                               false,
+	}
+	for output, want := range cases {
+		if _, got := detectPasswordPrompt([]byte(output)); got != want {
+			t.Errorf("detectPasswordPrompt(%q) = %v, want %v", output, got, want)
+		}
+	}
+}
+
+func TestHandleShellCommandPasswordPrompt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	output := new(bytes.Buffer)
+	secret := protocol.CmdSecret + " " + hex.EncodeToString([]byte("hunter2")) + "\n"
+	client := &ReverseClient{
+		writer: bufio.NewWriter(output),
+		reader: bufio.NewReader(strings.NewReader(protocol.CmdPing + "\n" + secret)),
+	}
+
+	if _, err := client.processCommand(protocol.CmdPrompted + ` printf 'Password: '; read -r pw; echo "got:$pw"`); err != nil {
+		t.Fatalf("handleShellCommand failed: %v", err)
+	}
+	result := output.String()
+	if !strings.HasPrefix(result, protocol.CmdPrompt+" "+hex.EncodeToString([]byte("Password:"))+"\n") {
+		t.Errorf("expected a PROMPT frame first, got %q", result)
+	}
+	if !strings.Contains(result, protocol.CmdPong) {
+		t.Error("expected PING to be answered while waiting for the secret")
+	}
+	if !strings.Contains(result, "got:hunter2") {
+		t.Errorf("expected the secret on stdin, got %q", result)
+	}
+}
+
+func TestHandleShellCommandPromptCancelled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	output := new(bytes.Buffer)
+	client := &ReverseClient{
+		writer: bufio.NewWriter(output),
+		reader: bufio.NewReader(strings.NewReader(protocol.CmdSecret + "\n")),
+	}
+
+	if err := client.handlePromptedCommand(protocol.CmdPrompted + ` printf 'Password: '; read -r pw || echo cancelled`); err != nil {
+		t.Fatalf("handleShellCommand failed: %v", err)
+	}
+	if !strings.Contains(output.String(), "cancelled") {
+		t.Errorf("expected stdin to be closed on cancel, got %q", output.String())
+	}
+}
+
+func TestHandleShellCommandClosesIdleStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	client, output := createMockClient()
+	start := time.Now()
+	if err := client.handlePromptedCommand(protocol.CmdPrompted + " cat; echo eof"); err != nil {
+		t.Fatalf("handleShellCommand failed: %v", err)
+	}
+	if !strings.Contains(output.String(), "eof") {
+		t.Errorf("expected cat to see EOF, got %q", output.String())
+	}
+	if elapsed := time.Since(start); elapsed > stdinIdleTimeout+2*time.Second {
+		t.Errorf("command took %v", elapsed)
+	}
+}
+
+func TestHandleShellCommandDoesNotRelayPrompts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	client, output := createMockClient()
+	if err := client.handleShellCommand(`printf 'Password: '; read -r pw || echo eof`); err != nil {
+		t.Fatalf("handleShellCommand failed: %v", err)
+	}
+	result := output.String()
+	if strings.Contains(result, protocol.CmdPrompt+" ") {
+		t.Errorf("expected no PROMPT frame without PROMPTED, got %q", result)
+	}
+	if !strings.Contains(result, "eof") {
+		t.Errorf("expected the command to read EOF from stdin, got %q", result)
+	}
+}
@@ -0,0 +1,359 @@
+package client
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	xproxy "golang.org/x/net/proxy"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+const (
+	// proxyTimeout bounds the CONNECT exchange and fetching a PAC file.
+	proxyTimeout = 30 * time.Second
+	// maxPACSize bounds the PAC file read.
+	maxPACSize = 1 << 20
+	// wpadURL is where WPAD looks for the PAC file through DNS.
+	wpadURL = "http://wpad/wpad.dat"
+)
+
+// systemProxy is the proxy configuration of the operating system.
+type systemProxy struct {
+	Source string   // Where it was read from, for the log
+	HTTP   string   // host:port of the proxy for HTTP, or for everything
+	HTTPS  string   // host:port of the proxy for HTTPS
+	SOCKS  string   // host:port of a SOCKS proxy
+	PACURL string   // Proxy auto-config file
+	Bypass []string // Hosts reached directly: patterns, networks or "<local>"
+}
+
+// dialTCP connects to a "host:port" address, through the proxy chosen for
+// it if there is one.
+func (rc *ReverseClient) dialTCP(dialer *net.Dialer, address string) (net.Conn, error) {
+	proxyURL, err := rc.proxyFor(address)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return dialer.Dial("tcp", address)
+	}
+	return dialProxy(dialer, proxyURL, address)
+}
+
+// proxyFor picks the proxy for address, in this order: the proxy option,
+// the HTTPS_PROXY and NO_PROXY variables, then the system settings. It
+// logs the choice; nil means a direct connection.
+func (rc *ReverseClient) proxyFor(address string) (*url.URL, error) {
+	switch rc.options.Proxy {
+	case config.ProxyNone:
+		return nil, nil
+	case "":
+	default:
+		proxyURL, err := config.ParseProxyURL(rc.options.Proxy)
+		if err == nil {
+			log.Printf("Using proxy %s for %s", proxyURL.Redacted(), address)
+		}
+		return proxyURL, err
+	}
+
+	proxyURL, err := httpproxy.FromEnvironment().ProxyFunc()(&url.URL{Scheme: "https", Host: address})
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy in environment: %w", err)
+	}
+	if proxyURL != nil {
+		log.Printf("Using proxy %s for %s (from HTTPS_PROXY)", proxyURL.Redacted(), address)
+		return proxyURL, nil
+	}
+
+	sys := systemProxySettings()
+	if sys == nil {
+		return nil, nil
+	}
+	host, _, _ := net.SplitHostPort(address)
+	if sys.bypassed(host) {
+		log.Printf("Connecting to %s directly, as %s exempt it from the proxy", address, sys.Source)
+		return nil, nil
+	}
+	if sys.PACURL != "" {
+		if rc.options.ProxyPAC {
+			proxyURL, err := pacProxy(sys.PACURL)
+			if err == nil {
+				if proxyURL == nil {
+					log.Printf("Connecting to %s directly, as the PAC file %s says", address, sys.PACURL)
+				} else {
+					log.Printf("Using proxy %s for %s (first proxy in the PAC file %s)", proxyURL.Redacted(), address, sys.PACURL)
+				}
+				return proxyURL, nil
+			}
+			log.Printf("Warning: ignoring the PAC file %s: %v", sys.PACURL, err)
+		} else {
+			log.Printf("%s name the PAC file %s; enable --proxy-pac to use it", sys.Source, sys.PACURL)
+		}
+	}
+	proxyURL = sys.proxyURL()
+	if proxyURL != nil {
+		log.Printf("Using proxy %s for %s (from %s)", proxyURL.Redacted(), address, sys.Source)
+	}
+	return proxyURL, nil
+}
+
+// proxyURL returns the proxy of the settings used for the listener, which
+// speaks TLS like HTTPS.
+func (p *systemProxy) proxyURL() *url.URL {
+	switch {
+	case p.HTTPS != "":
+		return &url.URL{Scheme: "http", Host: p.HTTPS}
+	case p.HTTP != "":
+		return &url.URL{Scheme: "http", Host: p.HTTP}
+	case p.SOCKS != "":
+		return &url.URL{Scheme: "socks5", Host: p.SOCKS}
+	}
+	return nil
+}
+
+// bypassed reports whether host is reached directly. Loopback addresses
+// always are.
+func (p *systemProxy) bypassed(host string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, entry := range p.Bypass {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "<local>":
+			if ip == nil && !strings.Contains(host, ".") {
+				return true
+			}
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(padCIDR(entry)); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+		default:
+			// "*.corp.example.com", "10.*", or a domain with its subdomains
+			if ok, _ := path.Match(entry, host); ok || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// padCIDR completes the short networks macOS lists, e.g. "169.254/16".
+func padCIDR(cidr string) string {
+	addr, bits, _ := strings.Cut(cidr, "/")
+	if !strings.Contains(addr, ":") {
+		for strings.Count(addr, ".") < 3 {
+			addr += ".0"
+		}
+	}
+	return addr + "/" + bits
+}
+
+// parseWindowsProxyServer reads the ProxyServer value of the Windows
+// Internet Settings: "host:port" for all protocols, or a list such as
+// "http=proxy:80;https=proxy:443;socks=proxy:1080".
+func parseWindowsProxyServer(v string) (httpProxy, httpsProxy, socksProxy string) {
+	if !strings.Contains(v, "=") {
+		v = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v), "http://"), "https://")
+		return v, "", ""
+	}
+	for _, part := range strings.Split(v, ";") {
+		proto, hostport, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		hostport = strings.TrimPrefix(strings.TrimPrefix(hostport, "http://"), "https://")
+		switch strings.ToLower(proto) {
+		case "http":
+			httpProxy = hostport
+		case "https":
+			httpsProxy = hostport
+		case "socks":
+			socksProxy = hostport
+		}
+	}
+	return httpProxy, httpsProxy, socksProxy
+}
+
+// parseScutilProxy reads the output of macOS's "scutil --proxy".
+func parseScutilProxy(out string) *systemProxy {
+	values := make(map[string]string)
+	p := &systemProxy{Source: "the macOS network settings"}
+	inExceptions := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		key, val, ok := strings.Cut(line, " : ")
+		switch {
+		case line == "}":
+			inExceptions = false
+		case !ok:
+		case inExceptions:
+			p.Bypass = append(p.Bypass, val)
+		case key == "ExceptionsList":
+			inExceptions = true
+		default:
+			values[key] = val
+		}
+	}
+	hostPort := func(proto string) string {
+		if values[proto+"Enable"] != "1" || values[proto+"Proxy"] == "" {
+			return ""
+		}
+		port := values[proto+"Port"]
+		if port == "" {
+			port = "80"
+		}
+		return net.JoinHostPort(values[proto+"Proxy"], port)
+	}
+	p.HTTP, p.HTTPS, p.SOCKS = hostPort("HTTP"), hostPort("HTTPS"), hostPort("SOCKS")
+	if p.SOCKS != "" && values["SOCKSPort"] == "" {
+		p.SOCKS = net.JoinHostPort(values["SOCKSProxy"], "1080")
+	}
+	if values["ProxyAutoConfigEnable"] == "1" {
+		p.PACURL = values["ProxyAutoConfigURLString"]
+	} else if values["ProxyAutoDiscoveryEnable"] == "1" {
+		p.PACURL = wpadURL
+	}
+	if values["ExcludeSimpleHostnames"] == "1" {
+		p.Bypass = append(p.Bypass, "<local>")
+	}
+	if p.HTTP == "" && p.HTTPS == "" && p.SOCKS == "" && p.PACURL == "" {
+		return nil
+	}
+	return p
+}
+
+// pacEntry matches the proxies a PAC file names, e.g. "PROXY proxy:8080".
+var pacEntry = regexp.MustCompile(`\b(PROXY|SOCKS5?)\s+([A-Za-z0-9._\-\[\]:]+:[0-9]+)`)
+
+// pacProxy returns the first proxy a PAC file names, or nil if it only
+// says DIRECT. The script is not run: the listener is usually outside the
+// network, where PAC files send traffic through their proxy, while DIRECT
+// branches tend to cover internal hosts.
+func pacProxy(pacURL string) (*url.URL, error) {
+	script, err := fetchPAC(pacURL)
+	if err != nil {
+		return nil, err
+	}
+	if m := pacEntry.FindStringSubmatch(script); m != nil {
+		if m[1] == "PROXY" {
+			return &url.URL{Scheme: "http", Host: m[2]}, nil
+		}
+		return &url.URL{Scheme: "socks5", Host: m[2]}, nil
+	}
+	if strings.Contains(script, "DIRECT") {
+		return nil, nil
+	}
+	return nil, errors.New("no proxy found in it")
+}
+
+// fetchPAC reads a PAC file from an http(s):// or file:// URL, without a
+// proxy.
+func fetchPAC(pacURL string) (string, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return "", err
+	}
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "file":
+		if body, err = os.Open(u.Path); err != nil {
+			return "", err
+		}
+	case "http", "https":
+		client := &http.Client{Timeout: proxyTimeout, Transport: &http.Transport{}}
+		resp, err := client.Get(pacURL)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("HTTP %s", resp.Status)
+		}
+		body = resp.Body
+	default:
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxPACSize))
+	return string(data), err
+}
+
+// dialProxy connects to address through an HTTP (CONNECT) or SOCKS5 proxy.
+func dialProxy(dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	if proxyURL.Scheme == "socks5" {
+		d, err := xproxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := d.Dial("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("SOCKS proxy %s: %w", proxyURL.Host, err)
+		}
+		return conn, nil
+	}
+
+	conn, err := dialer.Dial("tcp", proxyURL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(proxyTimeout))
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Host, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxyURL.Host, address, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// The tunnel's first bytes arrived along with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads through a bufio.Reader that may hold data already.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
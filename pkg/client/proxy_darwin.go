@@ -0,0 +1,14 @@
+//go:build darwin
+
+package client
+
+import "os/exec"
+
+// systemProxySettings returns the proxy of the active network service.
+func systemProxySettings() *systemProxy {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return nil
+	}
+	return parseScutilProxy(string(out))
+}
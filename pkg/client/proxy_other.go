@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package client
+
+// systemProxySettings returns nil: other systems have no common proxy
+// settings beyond the environment variables.
+func systemProxySettings() *systemProxy {
+	return nil
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startConnectProxy runs an HTTP CONNECT proxy on localhost that requires
+// user:pass when auth is set and counts the tunnels it opened.
+func startConnectProxy(t *testing.T, auth bool) (string, *int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	tunnels := new(int)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				if auth {
+					if user, pass, ok := (&http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}).BasicAuth(); !ok || user != "user" || pass != "pass" {
+						io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+						return
+					}
+				}
+				out, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer out.Close()
+				*tunnels++
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(out, br)
+				io.Copy(conn, out)
+			}()
+		}
+	}()
+	return ln.Addr().String(), tunnels
+}
+
+func TestConnectThroughHTTPProxy(t *testing.T) {
+	listener := createServerForTest(t)
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+	proxyAddr, tunnels := startConnectProxy(t, true)
+
+	client := NewReverseClientWithOptions(netListener.Addr().String(), "", "", Options{Proxy: "http://user:pass@" + proxyAddr})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect through proxy failed: %v", err)
+	}
+	defer client.Close()
+	if *tunnels != 1 {
+		t.Fatalf("expected the connection to go through the proxy")
+	}
+
+	client = NewReverseClientWithOptions(netListener.Addr().String(), "", "", Options{Proxy: "http://user:wrong@" + proxyAddr})
+	if err := client.Connect(); err == nil || !strings.Contains(err.Error(), "407") {
+		t.Fatalf("expected the proxy to refuse bad credentials, got %v", err)
+	}
+}
+
+func TestParseWindowsProxyServer(t *testing.T) {
+	if h, s, socks := parseWindowsProxyServer("proxy.corp:8080"); h != "proxy.corp:8080" || s != "" || socks != "" {
+		t.Errorf("single proxy parsed as %q %q %q", h, s, socks)
+	}
+	h, s, socks := parseWindowsProxyServer("http=web.corp:80;https=secure.corp:443;socks=socks.corp:1080")
+	if h != "web.corp:80" || s != "secure.corp:443" || socks != "socks.corp:1080" {
+		t.Errorf("per-protocol proxies parsed as %q %q %q", h, s, socks)
+	}
+	p := &systemProxy{HTTP: h, HTTPS: s, SOCKS: socks}
+	if u := p.proxyURL(); u.String() != "http://secure.corp:443" {
+		t.Errorf("expected the HTTPS proxy to be used, got %s", u)
+	}
+}
+
+func TestParseScutilProxy(t *testing.T) {
+	out := `<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254/16
+  }
+  ExcludeSimpleHostnames : 1
+  HTTPEnable : 0
+  HTTPSEnable : 1
+  HTTPSPort : 3128
+  HTTPSProxy : proxy.corp
+  ProxyAutoConfigEnable : 1
+  ProxyAutoConfigURLString : http://pac.corp/proxy.pac
+}`
+	p := parseScutilProxy(out)
+	if p == nil || p.HTTPS != "proxy.corp:3128" || p.HTTP != "" || p.PACURL != "http://pac.corp/proxy.pac" {
+		t.Fatalf("unexpected settings %+v", p)
+	}
+	for host, want := range map[string]bool{
+		"printer.local":        true,
+		"169.254.10.1":         true,
+		"intranet":             true,
+		"127.0.0.1":            true,
+		"listener.example.com": false,
+		"10.0.0.1":             false,
+	} {
+		if got := p.bypassed(host); got != want {
+			t.Errorf("bypassed(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if parseScutilProxy("<dictionary> {\n  HTTPEnable : 0\n}") != nil {
+		t.Error("expected no settings when no proxy is enabled")
+	}
+}
+
+func TestPACProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `function FindProxyForURL(url, host) {
+  if (isPlainHostName(host)) return "DIRECT";
+  return "PROXY proxy.corp:8080; SOCKS5 socks.corp:1080; DIRECT";
+}`)
+	}))
+	defer srv.Close()
+	u, err := pacProxy(srv.URL)
+	if err != nil || u == nil || u.String() != "http://proxy.corp:8080" {
+		t.Fatalf("pacProxy = %v, %v", u, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "direct.pac")
+	os.WriteFile(path, []byte(`function FindProxyForURL(url, host) { return "DIRECT"; }`), 0600)
+	if u, err := pacProxy("file://" + path); err != nil || u != nil {
+		t.Fatalf("expected DIRECT, got %v, %v", u, err)
+	}
+	os.WriteFile(path, []byte(`function FindProxyForURL(url, host) { return x; }`), 0600)
+	if _, err := pacProxy("file://" + path); err == nil {
+		t.Fatal("expected an error for a PAC file naming no proxy")
+	}
+}
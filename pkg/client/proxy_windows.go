@@ -0,0 +1,48 @@
+//go:build windows
+
+package client
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const internetSettings = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// systemProxySettings returns the proxy of the current user's Internet
+// Settings, which browsers and WinINet use.
+func systemProxySettings() *systemProxy {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettings, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+	p := &systemProxy{Source: "the Windows Internet Settings"}
+	if enabled, _, err := key.GetIntegerValue("ProxyEnable"); err == nil && enabled != 0 {
+		server, _, _ := key.GetStringValue("ProxyServer")
+		p.HTTP, p.HTTPS, p.SOCKS = parseWindowsProxyServer(server)
+		override, _, _ := key.GetStringValue("ProxyOverride")
+		p.Bypass = strings.Split(override, ";")
+	}
+	p.PACURL, _, _ = key.GetStringValue("AutoConfigURL")
+	if p.PACURL == "" && wpadEnabled() {
+		p.PACURL = wpadURL
+	}
+	if p.HTTP == "" && p.HTTPS == "" && p.SOCKS == "" && p.PACURL == "" {
+		return nil
+	}
+	return p
+}
+
+// wpadEnabled reports whether "Automatically detect settings" is on. Its
+// flag lives in the binary DefaultConnectionSettings value.
+func wpadEnabled() bool {
+	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettings+`\Connections`, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+	settings, _, err := key.GetBinaryValue("DefaultConnectionSettings")
+	return err == nil && len(settings) > 8 && settings[8]&0x08 != 0
+}
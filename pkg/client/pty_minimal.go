@@ -0,0 +1,30 @@
+//go:build minimal
+
+package client
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+const ptySupported = false
+
+var errPtyUnsupported = errors.New("PTY support not included in this build (minimal)")
+
+func startPty(cmd *exec.Cmd) (*os.File, error) {
+	return nil, errPtyUnsupported
+}
+
+func setPtySize(ptmx *os.File, rows, cols int) error {
+	return errPtyUnsupported
+}
+
+func newPtyReader(ptmx *os.File) io.Reader {
+	return ptmx
+}
+
+func wrapPtyFile(f *os.File) io.ReadWriteCloser {
+	return f
+}
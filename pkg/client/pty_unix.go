@@ -1,5 +1,5 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !minimal
+// +build !windows,!minimal
 
 package client
 
@@ -11,6 +11,8 @@ import (
 	"github.com/creack/pty"
 )
 
+const ptySupported = true
+
 // startPty starts a command in a PTY (Unix implementation)
 func startPty(cmd *exec.Cmd) (*os.File, error) {
 	return pty.Start(cmd)
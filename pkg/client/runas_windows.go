@@ -0,0 +1,71 @@
+//go:build windows
+
+package client
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procLogonUserW = windows.NewLazySystemDLL("advapi32.dll").NewProc("LogonUserW")
+
+const (
+	logon32LogonInteractive = 2
+	logon32ProviderDefault  = 0
+)
+
+// runAs logs the user on with the password and sets cmd up to start with
+// the resulting token, through CreateProcessAsUser. That needs a client
+// running as SYSTEM or with the privilege to replace a process token.
+// name is user, DOMAIN\user or user@domain; a bare user is a local account.
+func runAs(cmd *exec.Cmd, name, password string) (string, func(), error) {
+	if password == "" {
+		return "", nil, errors.New("a password is needed on Windows")
+	}
+	domain, account := ".", name
+	if d, a, ok := strings.Cut(name, `\`); ok {
+		domain, account = d, a
+	} else if strings.Contains(name, "@") {
+		domain = ""
+	}
+	accountPtr, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return "", nil, err
+	}
+	passwordPtr, err := windows.UTF16PtrFromString(password)
+	if err != nil {
+		return "", nil, err
+	}
+	var domainPtr *uint16
+	if domain != "" {
+		if domainPtr, err = windows.UTF16PtrFromString(domain); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var token windows.Token
+	r, _, callErr := procLogonUserW.Call(
+		uintptr(unsafe.Pointer(accountPtr)),
+		uintptr(unsafe.Pointer(domainPtr)),
+		uintptr(unsafe.Pointer(passwordPtr)),
+		logon32LogonInteractive,
+		logon32ProviderDefault,
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if r == 0 {
+		return "", nil, callErr
+	}
+	resolved := name
+	if tu, err := token.GetTokenUser(); err == nil {
+		if a, d, _, err := tu.User.Sid.LookupAccount(""); err == nil {
+			resolved = d + `\` + a
+		}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Token: syscall.Token(token), HideWindow: true}
+	return resolved, func() { token.Close() }, nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sandboxFiles are files that analysis sandboxes and desktop hypervisor
+// guest tools leave behind, by GOOS. Cloud hypervisors are left out on
+// purpose: production servers run on them.
+var sandboxFiles = map[string]map[string]string{
+	"windows": {
+		"vbox-guest":   `C:\Windows\System32\drivers\VBoxGuest.sys`,
+		"vbox-mouse":   `C:\Windows\System32\drivers\VBoxMouse.sys`,
+		"vmware-hgfs":  `C:\Windows\System32\drivers\vmhgfs.sys`,
+		"vmware-mouse": `C:\Windows\System32\drivers\vmmouse.sys`,
+		"cuckoo-agent": `C:\agent\agent.py`,
+		"analysis-dir": `C:\analysis`,
+		"sandbox-dir":  `C:\sandbox`,
+	},
+	"linux": {
+		"vbox-guest":   "/usr/bin/VBoxClient",
+		"vmware-tools": "/usr/bin/vmware-toolbox-cmd",
+		"cuckoo-agent": "/tmp/agent.py",
+	},
+}
+
+// sandboxVendors are DMI product or vendor names of desktop hypervisors.
+var sandboxVendors = []string{"VirtualBox", "VMware Virtual Platform", "Bochs"}
+
+// sandboxArtifacts returns the names of sandbox artifacts found on this
+// host, sorted.
+func sandboxArtifacts() []string {
+	var found []string
+	for name, path := range sandboxFiles[runtime.GOOS] {
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, name)
+		}
+	}
+	for _, file := range []string{"/sys/class/dmi/id/product_name", "/sys/class/dmi/id/sys_vendor"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, vendor := range sandboxVendors {
+			if strings.Contains(string(data), vendor) {
+				found = append(found, "dmi-"+strings.ToLower(strings.Fields(vendor)[0]))
+			}
+		}
+	}
+	sort.Strings(found)
+	return slices.Compact(found)
+}
+
+// hostUptime returns how long the host has been running, where the OS
+// exposes it without extra privileges.
+func hostUptime() (time.Duration, bool) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
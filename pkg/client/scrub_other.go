@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package client
+
+// overwriteArgs cannot hide the arguments: on Windows os.Args is parsed from
+// a copy of the command line, which stays readable in the process block.
+func overwriteArgs(args []string) bool {
+	return false
+}
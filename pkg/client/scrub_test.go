@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package client
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+func TestOverwriteArgs(t *testing.T) {
+	buf := []byte("--shared-secret=hunter2")
+	arg := unsafe.String(&buf[0], len(buf))
+	if !overwriteArgs([]string{arg, ""}) {
+		t.Fatal("expected overwriteArgs to succeed")
+	}
+	if !bytes.Equal(buf, make([]byte, len(buf))) {
+		t.Errorf("argument not zeroed: %q", buf)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package client
+
+import "unsafe"
+
+// overwriteArgs zeroes the arguments in place. The runtime builds os.Args
+// on the original argv memory, which is what ps reads on these systems.
+func overwriteArgs(args []string) bool {
+	for _, arg := range args {
+		if arg != "" {
+			clear(unsafe.Slice(unsafe.StringData(arg), len(arg)))
+		}
+	}
+	return true
+}
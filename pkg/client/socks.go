@@ -1,8 +1,11 @@
+//go:build !minimal
+
 package client
 
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -14,6 +17,8 @@ import (
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
+const socksSupported = true
+
 // SocksHandler manages SOCKS5 connections on the client side
 type SocksHandler struct {
 	connections map[string]map[string]net.Conn      // socksID -> connID -> connection
@@ -52,8 +57,9 @@ func (sh *SocksHandler) HandleSocksStart(socksID string) error {
 	return nil
 }
 
-// HandleSocksConn handles a SOCKS_CONN command - connect to target
-func (sh *SocksHandler) HandleSocksConn(socksID, connID, targetAddr string) error {
+// HandleSocksConn handles a SOCKS_CONN command - connect to target. With
+// reasons, a failure is reported with why the target could not be reached.
+func (sh *SocksHandler) HandleSocksConn(socksID, connID, targetAddr string, reasons bool) error {
 	sh.mu.Lock()
 	defer sh.mu.Unlock()
 
@@ -66,7 +72,11 @@ func (sh *SocksHandler) HandleSocksConn(socksID, connID, targetAddr string) erro
 	conn, dialAddr, err := sh.dialWithIPv4Preference(targetAddr)
 	if err != nil {
 		logging.Warnf("[-] SOCKS %s conn %s: failed to connect to %s: %v", socksID, connID, targetAddr, err)
-		sh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdSocksClose, socksID, connID))
+		if reasons {
+			sh.sendFunc(fmt.Sprintf("%s %s %s %s\n", protocol.CmdSocksClose, socksID, connID, socksFailure(err)))
+		} else {
+			sh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdSocksClose, socksID, connID))
+		}
 		return fmt.Errorf("failed to connect to %s: %w", targetAddr, err)
 	}
 
@@ -93,14 +103,34 @@ func (sh *SocksHandler) dialWithIPv4Preference(targetAddr string) (net.Conn, str
 	}
 	host = strings.Trim(host, "[]")
 
+	var lastErr error
 	for _, addr := range resolveDialAddresses(host, port) {
 		conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
 		if err == nil {
 			return conn, addr, nil
 		}
+		lastErr = err
 	}
 
-	return nil, "", fmt.Errorf("all dial attempts failed for %s", targetAddr)
+	return nil, "", fmt.Errorf("all dial attempts failed for %s: %w", targetAddr, lastErr)
+}
+
+// socksFailure returns the protocol.SocksRefused or similar reason for a
+// failed dial, which the listener turns into a SOCKS5 reply code.
+func socksFailure(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errConnRefused):
+		return protocol.SocksRefused
+	case errors.Is(err, errNetUnreachable):
+		return protocol.SocksNetUnreachable
+	case errors.Is(err, errHostUnreachable), errors.As(err, &dnsErr):
+		return protocol.SocksHostUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return protocol.SocksTimeout
+	}
+	return protocol.SocksFailed
 }
 
 // resolveDialAddresses returns dial addresses with IPv4 candidates first when available.
@@ -278,6 +308,18 @@ func (sh *SocksHandler) closeConnection(socksID, connID string) {
 	}
 }
 
+// active reports whether any SOCKS connection is open.
+func (sh *SocksHandler) active() bool {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	for _, conns := range sh.connections {
+		if len(conns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Close closes all connections
 func (sh *SocksHandler) Close() {
 	sh.mu.Lock()
@@ -0,0 +1,12 @@
+//go:build !windows && !minimal
+
+package client
+
+import "syscall"
+
+// Dial errors that socksFailure tells apart.
+var (
+	errConnRefused     error = syscall.ECONNREFUSED
+	errNetUnreachable  error = syscall.ENETUNREACH
+	errHostUnreachable error = syscall.EHOSTUNREACH
+)
@@ -0,0 +1,13 @@
+//go:build windows && !minimal
+
+package client
+
+import "golang.org/x/sys/windows"
+
+// Dial errors that socksFailure tells apart. Winsock has its own numbers
+// for them.
+var (
+	errConnRefused     error = windows.WSAECONNREFUSED
+	errNetUnreachable  error = windows.WSAENETUNREACH
+	errHostUnreachable error = windows.WSAEHOSTUNREACH
+)
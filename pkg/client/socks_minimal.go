@@ -0,0 +1,47 @@
+//go:build minimal
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const socksSupported = false
+
+// SocksHandler refuses SOCKS connections in minimal builds, closing each one
+// right away so the listener does not wait for it.
+type SocksHandler struct {
+	sendFunc func(string)
+}
+
+// NewSocksHandler creates a new SOCKS handler
+func NewSocksHandler(sendFunc func(string)) *SocksHandler {
+	return &SocksHandler{sendFunc: sendFunc}
+}
+
+// HandleSocksStart is a no-op.
+func (sh *SocksHandler) HandleSocksStart(socksID string) error {
+	return nil
+}
+
+// HandleSocksConn rejects the connection.
+func (sh *SocksHandler) HandleSocksConn(socksID, connID, targetAddr string, reasons bool) error {
+	sh.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdSocksClose, socksID, connID))
+	return fmt.Errorf("SOCKS proxy not included in this build (minimal)")
+}
+
+// HandleSocksData discards data for the rejected connection.
+func (sh *SocksHandler) HandleSocksData(socksID, connID, encodedData string) error {
+	return nil
+}
+
+// HandleSocksClose is a no-op.
+func (sh *SocksHandler) HandleSocksClose(socksID, connID string) {}
+
+// active reports false, as no connection is ever kept.
+func (sh *SocksHandler) active() bool { return false }
+
+// Close is a no-op.
+func (sh *SocksHandler) Close() {}
@@ -1,11 +1,19 @@
+//go:build !minimal
+
 package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
 )
 
 type mockResolver struct {
@@ -276,7 +284,7 @@ func TestSocksHandler_HandleSocksConnThenClose(t *testing.T) {
 	}()
 
 	// Connect to the listener via HandleSocksConn
-	err = sh.HandleSocksConn("test-socks", "conn3", listenerAddr)
+	err = sh.HandleSocksConn("test-socks", "conn3", listenerAddr, false)
 	if err != nil {
 		t.Fatalf("HandleSocksConn failed: %v", err)
 	}
@@ -391,3 +399,42 @@ func TestSocksHandler_MultipleConnectionsClose(t *testing.T) {
 	}
 	sh.mu.RUnlock()
 }
+
+func TestSocksHandler_ConnFailureReason(t *testing.T) {
+	// A port that was free a moment ago refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var sent []string
+	sh := NewSocksHandler(func(msg string) { sent = append(sent, msg) })
+	if err := sh.HandleSocksConn("s1", "c1", addr, true); err == nil {
+		t.Fatal("expected the connection to fail")
+	}
+	if err := sh.HandleSocksConn("s1", "c2", addr, false); err == nil {
+		t.Fatal("expected the connection to fail")
+	}
+	want := []string{
+		protocol.CmdSocksClose + " s1 c1 " + protocol.SocksRefused + "\n",
+		protocol.CmdSocksClose + " s1 c2\n",
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+
+	for err, want := range map[error]string{
+		&net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}: protocol.SocksHostUnreachable,
+		&net.OpError{Op: "dial", Err: errNetUnreachable}:                              protocol.SocksNetUnreachable,
+		&net.OpError{Op: "dial", Err: errHostUnreachable}:                             protocol.SocksHostUnreachable,
+		&net.DNSError{Err: "i/o timeout", IsTimeout: true}:                            protocol.SocksHostUnreachable,
+		os.ErrDeadlineExceeded:                                                        protocol.SocksTimeout,
+		errors.New("something else"):                                                  protocol.SocksFailed,
+	} {
+		if got := socksFailure(fmt.Errorf("all dial attempts failed: %w", err)); got != want {
+			t.Errorf("socksFailure(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+// sshHandshakeTimeout bounds connecting and logging in to the jump host.
+const sshHandshakeTimeout = 30 * time.Second
+
+// dialTLSOverSSH opens the listener connection through the SSH jump host
+// and runs the TLS handshake over it.
+func (rc *ReverseClient) dialTLSOverSSH(dialer *net.Dialer, network, address string, tlsConfig *tls.Config) (*tls.Conn, error) {
+	conn, err := rc.dialSSHJump(dialer, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return clientTLS(conn, address, tlsConfig)
+}
+
+// dialSSHJump logs in to the jump host and asks it to connect to address
+// (direct-tcpip, or direct-streamlocal for a Unix socket).
+func (rc *ReverseClient) dialSSHJump(dialer *net.Dialer, network, address string) (net.Conn, error) {
+	user, jump, err := config.ParseSSHJump(rc.options.SSHJump)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := rc.sshAuthMethods()
+	if err != nil {
+		return nil, err
+	}
+	d := *dialer
+	d.Timeout = sshHandshakeTimeout
+	tcp, err := rc.dialTCP(&d, jump)
+	if err != nil {
+		return nil, fmt.Errorf("SSH jump host %s: %w", jump, err)
+	}
+	tcp.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(tcp, jump, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: sshHostKeyCallback(rc.options.SSHHostKey),
+	})
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("SSH jump host %s: %w", jump, err)
+	}
+	tcp.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+	channel, err := client.Dial(network, address)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("SSH jump host %s cannot reach %s: %w", jump, address, err)
+	}
+	log.Printf("✓ Tunneled through SSH jump host %s@%s", user, jump)
+	return newSSHTunnel(channel, client), nil
+}
+
+// sshAuthMethods returns the configured ways to log in to the jump host.
+func (rc *ReverseClient) sshAuthMethods() ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if rc.options.SSHKey != "" {
+		pem, err := os.ReadFile(rc.options.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && rc.options.SSHPassword != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(rc.options.SSHPassword))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH key %s: %w", rc.options.SSHKey, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if rc.options.SSHPassword != "" {
+		methods = append(methods, ssh.Password(rc.options.SSHPassword))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no way to log in to the SSH jump host: give an SSH key, a password or an ssh-agent")
+	}
+	return methods, nil
+}
+
+// sshHostKeyCallback checks the jump host's key against a pinned SHA256
+// fingerprint. Without one the key is accepted with a warning, as a
+// self-signed listener certificate is.
+func sshHostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	want := strings.TrimPrefix(fingerprint, "SHA256:")
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		got := ssh.FingerprintSHA256(key)
+		if want == "" {
+			log.Printf("⚠️  WARNING: SSH host key of %s not verified; pin it with --ssh-host-key %s", hostname, got)
+			return nil
+		}
+		if strings.TrimPrefix(got, "SHA256:") != want {
+			return fmt.Errorf("SSH host key mismatch for %s!\nExpected: SHA256:%s\nReceived: %s\n⚠️ WARNING: Possible MITM attack!", hostname, want, got)
+		}
+		return nil
+	}
+}
+
+// sshTunnel is the listener connection carried by an SSH channel. SSH
+// channels do not support deadlines, which the client relies on, so the
+// channel is relayed through a net.Pipe that does. Closing it closes the
+// SSH connection as well.
+type sshTunnel struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func newSSHTunnel(channel net.Conn, client *ssh.Client) *sshTunnel {
+	local, remote := net.Pipe()
+	go func() {
+		io.Copy(remote, channel)
+		remote.Close()
+	}()
+	go func() {
+		io.Copy(channel, remote)
+		channel.Close()
+	}()
+	return &sshTunnel{Conn: local, client: client}
+}
+
+func (t *sshTunnel) Close() error {
+	err := t.Conn.Close()
+	t.client.Close()
+	return err
+}
+
+// LocalAddr and RemoteAddr report the SSH connection, since a pipe has no
+// addresses.
+func (t *sshTunnel) LocalAddr() net.Addr  { return t.client.LocalAddr() }
+func (t *sshTunnel) RemoteAddr() net.Addr { return t.client.RemoteAddr() }
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHJump starts an SSH server on localhost that accepts password
+// "secret" and forwards direct-tcpip channels. It returns its address and
+// host key fingerprint.
+func startSSHJump(t *testing.T) (string, string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "jump" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHJump(conn, cfg)
+		}
+	}()
+	return ln.Addr().String(), ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+func serveSSHJump(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			nc.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(nc.ExtraData(), &target); err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		out, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			out.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			io.Copy(ch, out)
+			ch.CloseWrite()
+		}()
+		go func() {
+			io.Copy(out, ch)
+			out.Close()
+		}()
+	}
+}
+
+func TestConnectThroughSSHJump(t *testing.T) {
+	listener := createServerForTest(t)
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+	jump, fingerprint := startSSHJump(t)
+
+	client := NewReverseClientWithOptions(netListener.Addr().String(), "", "", Options{
+		SSHJump:     "jump@" + jump,
+		SSHPassword: "secret",
+		SSHHostKey:  strings.TrimPrefix(fingerprint, "SHA256:"),
+	})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect through jump host failed: %v", err)
+	}
+	defer client.Close()
+	if !client.IsConnected() {
+		t.Fatal("client should be connected")
+	}
+}
+
+func TestSSHJumpHostKeyMismatch(t *testing.T) {
+	jump, _ := startSSHJump(t)
+	client := NewReverseClientWithOptions("127.0.0.1:1", "", "", Options{
+		SSHJump:     "jump@" + jump,
+		SSHPassword: "secret",
+		SSHHostKey:  "SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+	})
+	err := client.Connect()
+	if err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+		t.Fatalf("expected host key mismatch, got %v", err)
+	}
+}
+
+func TestSSHJumpWrongPassword(t *testing.T) {
+	jump, _ := startSSHJump(t)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	client := NewReverseClientWithOptions("127.0.0.1:1", "", "", Options{
+		SSHJump:     "jump@" + jump,
+		SSHPassword: "wrong",
+	})
+	if err := client.Connect(); err == nil {
+		t.Fatal("expected login to the jump host to fail")
+	}
+}
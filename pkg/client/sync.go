@@ -0,0 +1,171 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// maxWalkEntries bounds a WALK reply so it stays well below the listener's
+// response buffer.
+const maxWalkEntries = 50000
+
+// walkTree lists the regular files and directories under dir with paths
+// relative to it, using forward slashes. Symlinks are not followed, and
+// entries that cannot be read are left out.
+func walkTree(dir string) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	var lines []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if path == dir {
+			return err
+		}
+		if err != nil {
+			return nil // Unreadable subdirectory
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || strings.ContainsAny(rel, "\r\n") {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			lines = append(lines, "d "+rel)
+		case d.Type().IsRegular():
+			size, sum, err := hashFile(path)
+			if err != nil {
+				return nil
+			}
+			lines = append(lines, fmt.Sprintf("f %d %s %s", size, sum, rel))
+		default:
+			return nil
+		}
+		if len(lines) > maxWalkEntries {
+			return fmt.Errorf("more than %d entries under %s", maxWalkEntries, dir)
+		}
+		return nil
+	})
+	return lines, err
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleWalkCommand lists a directory tree with file checksums, from which
+// the listener decides what a sync has to transfer
+func (rc *ReverseClient) handleWalkCommand(command string) error {
+	lines, err := walkTree(strings.TrimPrefix(command, protocol.CmdWalk+" "))
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error walking directory: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("failed to walk directory: %w", err)
+	}
+	rc.writer.WriteString("OK\n")
+	for _, line := range lines {
+		rc.writer.WriteString(line + "\n")
+	}
+	rc.writer.WriteString(protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
+
+// maxListEntries bounds a LIST reply like maxWalkEntries bounds WALK.
+const maxListEntries = maxWalkEntries
+
+// listDir lists the entries of dir, sorted by name, for path completion.
+// Unlike the list-dir template it does not depend on the locale or shell
+// of the host. Symlinks are reported as what they point to.
+func listDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > maxListEntries {
+		return nil, fmt.Errorf("more than %d entries in %s", maxListEntries, dir)
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if strings.ContainsAny(e.Name(), "\r\n") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			info, err = e.Info() // Dangling symlink
+			if err != nil {
+				continue
+			}
+		}
+		if info.IsDir() {
+			lines = append(lines, "d "+e.Name())
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("f %d %s", info.Size(), e.Name()))
+	}
+	return lines, nil
+}
+
+// handleListCommand lists one directory for the listener's path completion
+func (rc *ReverseClient) handleListCommand(command string) error {
+	lines, err := listDir(strings.TrimPrefix(command, protocol.CmdList+" "))
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error listing directory: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("failed to list directory: %w", err)
+	}
+	rc.writer.WriteString("OK\n")
+	for _, line := range lines {
+		rc.writer.WriteString(line + "\n")
+	}
+	rc.writer.WriteString(protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
+
+// handleMkdirCommand creates a directory and any missing parents
+func (rc *ReverseClient) handleMkdirCommand(command string) error {
+	err := os.MkdirAll(strings.TrimPrefix(command, protocol.CmdMkdir+" "), 0755)
+	return rc.writeFileOpResult(err)
+}
+
+// handleRemoveCommand deletes a file or an empty directory
+func (rc *ReverseClient) handleRemoveCommand(command string) error {
+	path := strings.TrimPrefix(command, protocol.CmdRemove+" ")
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil // Already gone
+	}
+	return rc.writeFileOpResult(err)
+}
+
+func (rc *ReverseClient) writeFileOpResult(err error) error {
+	if err != nil {
+		rc.writer.WriteString(fmt.Sprintf("Error: %v\n", err) + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return err
+	}
+	rc.writer.WriteString("OK\n" + protocol.EndOfOutputMarker + "\n")
+	return rc.writer.Flush()
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestHandleWalkCommand(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "conf", "empty"), 0755)
+	os.WriteFile(filepath.Join(dir, "conf", "app.ini"), []byte("abc"), 0644)
+	os.Symlink("/etc/passwd", filepath.Join(dir, "link"))
+
+	client, output := createMockClient()
+	if _, err := client.processCommand(protocol.CmdWalk + " " + dir); err != nil {
+		t.Fatalf("WALK failed: %v", err)
+	}
+	want := "OK\nd conf\nf 3 ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad conf/app.ini\nd conf/empty\n" + protocol.EndOfOutputMarker + "\n"
+	if output.String() != want {
+		t.Errorf("unexpected WALK reply %q", output.String())
+	}
+
+	output.Reset()
+	if err := client.handleWalkCommand(protocol.CmdWalk + " " + filepath.Join(dir, "missing")); err == nil || !strings.HasPrefix(output.String(), "Error walking directory") {
+		t.Errorf("expected an error for a missing directory, got %v", err)
+	}
+}
+
+func TestHandleListCommand(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	os.WriteFile(filepath.Join(dir, "my notes.txt"), []byte("abc"), 0644)
+	os.Symlink(filepath.Join(dir, "conf"), filepath.Join(dir, "link"))
+
+	client, output := createMockClient()
+	if _, err := client.processCommand(protocol.CmdList + " " + dir); err != nil {
+		t.Fatalf("LIST failed: %v", err)
+	}
+	want := "OK\nd conf\nd link\nf 3 my notes.txt\n" + protocol.EndOfOutputMarker + "\n"
+	if output.String() != want {
+		t.Errorf("unexpected LIST reply %q", output.String())
+	}
+
+	output.Reset()
+	if err := client.handleListCommand(protocol.CmdList + " " + filepath.Join(dir, "missing")); err == nil || !strings.HasPrefix(output.String(), "Error listing directory") {
+		t.Errorf("expected an error for a missing directory, got %v", err)
+	}
+}
+
+func TestHandleMkdirAndRemoveCommands(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	client, output := createMockClient()
+	if err := client.handleMkdirCommand(protocol.CmdMkdir + " " + dir); err != nil || !strings.HasPrefix(output.String(), "OK\n") {
+		t.Fatalf("MKDIR failed: %v %q", err, output.String())
+	}
+	os.WriteFile(filepath.Join(dir, "f"), nil, 0644)
+
+	output.Reset()
+	if err := client.handleRemoveCommand(protocol.CmdRemove + " " + filepath.Dir(dir)); err == nil || !strings.HasPrefix(output.String(), "Error: ") {
+		t.Errorf("expected a non-empty directory to be kept, got %v", err)
+	}
+	for _, path := range []string{filepath.Join(dir, "f"), dir, filepath.Join(dir, "gone")} {
+		output.Reset()
+		if err := client.handleRemoveCommand(protocol.CmdRemove + " " + path); err != nil {
+			t.Errorf("REMOVE %s failed: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected the directory to be removed")
+	}
+}
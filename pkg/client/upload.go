@@ -0,0 +1,238 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/delta"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	// minFreeDisk is left free on the destination file system; uploads that
+	// would eat into it are aborted.
+	minFreeDisk = 16 << 20
+	// maxActiveUploads bounds how many uploads may be staged at once.
+	maxActiveUploads = 16
+)
+
+// ErrInsufficientSpace is returned when an upload does not fit on disk.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// ErrTransferLimit is returned when a file is larger than
+// Options.MaxTransferSize.
+var ErrTransferLimit = errors.New("file exceeds the transfer limit")
+
+// uploadState is one upload in progress, keyed by its transfer ID. Chunks
+// are decompressed as they arrive into a staging file next to the
+// destination, which replaces the destination only once the upload is
+// complete.
+type uploadState struct {
+	path      string
+	noClobber bool  // Fail rather than replace a file created meanwhile
+	blockSize int   // Non-zero if the staging file holds a delta against path
+	maxSize   int64 // Largest file the upload may write; zero for no limit
+	staging   *os.File
+	decoder   *compression.HexStreamDecoder
+}
+
+// startUpload creates the staging file for path, applying the overwrite
+// policy if path exists. size is the length of the payload in codec, whose
+// gzip bytes are the least the upload will write. A delta upload, with a
+// non-zero blockSize, replaces path, which must exist. Files larger than a
+// non-zero maxSize are refused as they are written.
+func startUpload(path string, size int64, policy string, blockSize int, codec string, maxSize int64) (*uploadState, error) {
+	if blockSize != 0 {
+		if blockSize < delta.MinBlockSize || blockSize > delta.MaxBlockSize {
+			return nil, fmt.Errorf("delta block size %d out of range", blockSize)
+		}
+		if policy != protocol.OverwriteAlways {
+			return nil, errors.New("delta upload must overwrite its destination")
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("delta upload needs an existing file at %s", path)
+		}
+	}
+	path, err := uploadDestination(path, policy)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if free, ok := diskFree(dir); ok && free < uint64(compression.CompressedLen(codec, size))+minFreeDisk {
+		return nil, fmt.Errorf("%w: %d bytes free in %s", ErrInsufficientSpace, free, dir)
+	}
+	staging, err := os.CreateTemp(dir, "."+filepath.Base(path)+".gots-*")
+	if err != nil {
+		return nil, err
+	}
+	w := &spaceCheckedWriter{f: staging, dir: dir}
+	if blockSize == 0 {
+		w.limit = maxSize // A delta is checked once it is applied
+	}
+	decoder, err := compression.NewStreamDecoder(codec, w)
+	if err != nil {
+		staging.Close()
+		os.Remove(staging.Name())
+		return nil, err
+	}
+	return &uploadState{
+		path:      path,
+		noClobber: policy != protocol.OverwriteAlways,
+		blockSize: blockSize,
+		maxSize:   maxSize,
+		staging:   staging,
+		decoder:   decoder,
+	}, nil
+}
+
+// uploadDestination returns where an upload to path should go under the
+// overwrite policy.
+func uploadDestination(path, policy string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", &fs.PathError{Op: "upload", Path: path, Err: errors.New("is a directory")}
+	}
+	switch policy {
+	case protocol.OverwriteAlways:
+		return path, nil
+	case protocol.OverwriteRename:
+		ext := filepath.Ext(path)
+		if ext == filepath.Base(path) {
+			ext = "" // Dotfile such as .profile
+		}
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; i <= 1000; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if _, err := os.Lstat(candidate); errors.Is(err, fs.ErrNotExist) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", &fs.PathError{Op: "upload", Path: path, Err: fs.ErrExist}
+}
+
+// write decompresses one chunk into the staging file. On error the upload
+// is aborted.
+func (u *uploadState) write(chunk string) error {
+	if err := u.decoder.Write(chunk); err != nil {
+		u.abort()
+		return err
+	}
+	return nil
+}
+
+// finish moves the completed staging file into place and returns the size
+// of the file.
+func (u *uploadState) finish() (int64, error) {
+	n, err := u.decoder.Close()
+	if err == nil && u.blockSize != 0 {
+		n, err = u.applyDelta()
+	}
+	if err == nil {
+		err = u.staging.Chmod(0644)
+	}
+	if cerr := u.staging.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && u.noClobber {
+		if _, serr := os.Lstat(u.path); serr == nil {
+			err = &fs.PathError{Op: "upload", Path: u.path, Err: fs.ErrExist}
+		}
+	}
+	if err == nil {
+		err = os.Rename(u.staging.Name(), u.path)
+	}
+	if err != nil {
+		os.Remove(u.staging.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// applyDelta patches the destination with the delta in the staging file,
+// which is then replaced by a new staging file holding the result.
+func (u *uploadState) applyDelta() (int64, error) {
+	basis, err := os.Open(u.path)
+	if err != nil {
+		return 0, err
+	}
+	defer basis.Close()
+	info, err := basis.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := u.staging.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	dir := filepath.Dir(u.path)
+	result, err := os.CreateTemp(dir, "."+filepath.Base(u.path)+".gots-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := delta.Patch(basis, info.Size(), u.blockSize, u.staging, &spaceCheckedWriter{f: result, dir: dir, limit: u.maxSize})
+	u.staging.Close()
+	os.Remove(u.staging.Name())
+	u.staging = result
+	return n, err
+}
+
+// abort discards the upload and its staging file.
+func (u *uploadState) abort() {
+	u.decoder.Abort()
+	u.staging.Close()
+	os.Remove(u.staging.Name())
+}
+
+// abortUploads discards all uploads in progress, e.g. when the connection
+// drops before they finish.
+func (rc *ReverseClient) abortUploads() {
+	for id, upload := range rc.uploads {
+		upload.abort()
+		delete(rc.uploads, id)
+	}
+}
+
+// spaceCheckedWriter writes to a staging file, failing once less than
+// minFreeDisk would remain or the file would grow past a non-zero limit.
+// Free space is queried again only after the previously known headroom is
+// used up.
+type spaceCheckedWriter struct {
+	f         *os.File
+	dir       string
+	allowance uint64
+	limit     int64
+	written   int64
+}
+
+func (w *spaceCheckedWriter) Write(p []byte) (int, error) {
+	if w.limit > 0 && w.written+int64(len(p)) > w.limit {
+		return 0, fmt.Errorf("%w of %d bytes", ErrTransferLimit, w.limit)
+	}
+	if uint64(len(p)) > w.allowance {
+		free, ok := diskFree(w.dir)
+		switch {
+		case !ok:
+			w.allowance = ^uint64(0)
+		case free < minFreeDisk+uint64(len(p)):
+			return 0, fmt.Errorf("%w: %d bytes free in %s", ErrInsufficientSpace, free, w.dir)
+		default:
+			w.allowance = free - minFreeDisk
+		}
+	}
+	n, err := w.f.Write(p)
+	w.allowance -= uint64(n)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	// watchPollInterval is how often watched paths are checked. Polling
+	// works the same on every platform and needs no extra dependency.
+	watchPollInterval = time.Second
+	// maxWatches bounds how many watches may run at once.
+	maxWatches = 32
+)
+
+// fileStamp is what a watch compares between polls.
+type fileStamp struct {
+	size  int64
+	mod   time.Time
+	mode  fs.FileMode
+	isDir bool
+}
+
+// snapshotPath stamps path and, if it is a directory, its entries. A
+// missing path gives an empty snapshot.
+func snapshotPath(path string) map[string]fileStamp {
+	snap := make(map[string]fileStamp)
+	info, err := os.Stat(path)
+	if err != nil {
+		return snap
+	}
+	snap[path] = stampOf(info)
+	if !info.IsDir() {
+		return snap
+	}
+	entries, _ := os.ReadDir(path)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			snap[filepath.Join(path, e.Name())] = stampOf(info)
+		}
+	}
+	return snap
+}
+
+func stampOf(info fs.FileInfo) fileStamp {
+	return fileStamp{size: info.Size(), mod: info.ModTime(), mode: info.Mode(), isDir: info.IsDir()}
+}
+
+// watchChange is one change between two snapshots.
+type watchChange struct {
+	kind, path string
+}
+
+// diffSnapshots lists the changes from old to cur in path order. A
+// directory's own modification time changes with its entries, which are
+// reported instead.
+func diffSnapshots(old, cur map[string]fileStamp) []watchChange {
+	var changes []watchChange
+	for path, stamp := range cur {
+		prev, ok := old[path]
+		switch {
+		case !ok:
+			changes = append(changes, watchChange{protocol.WatchCreated, path})
+		case prev.isDir && stamp.isDir:
+		case prev != stamp:
+			changes = append(changes, watchChange{protocol.WatchModified, path})
+		}
+	}
+	for path := range old {
+		if _, ok := cur[path]; !ok {
+			changes = append(changes, watchChange{protocol.WatchRemoved, path})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	return changes
+}
+
+// watchHandler runs the watches of a connection, each polling its path on
+// its own goroutine and pushing WATCH_EVENT frames.
+type watchHandler struct {
+	mu       sync.Mutex
+	stops    map[string]chan struct{}
+	sendFunc func(string)
+}
+
+func newWatchHandler(sendFunc func(string)) *watchHandler {
+	return &watchHandler{stops: make(map[string]chan struct{}), sendFunc: sendFunc}
+}
+
+// start begins watching path under id, replacing a watch with the same ID.
+func (w *watchHandler) start(id, path string, content bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if stop, ok := w.stops[id]; ok {
+		close(stop)
+		delete(w.stops, id)
+	}
+	if len(w.stops) >= maxWatches {
+		return fmt.Errorf("too many watches (at most %d)", maxWatches)
+	}
+	stop := make(chan struct{})
+	w.stops[id] = stop
+	// Changes count from when WATCH is answered
+	go w.run(id, path, content, snapshotPath(path), stop)
+	return nil
+}
+
+// stop ends a watch and reports whether it existed.
+func (w *watchHandler) stop(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stop, ok := w.stops[id]
+	if ok {
+		close(stop)
+		delete(w.stops, id)
+	}
+	return ok
+}
+
+// active reports whether any watch is running.
+func (w *watchHandler) active() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.stops) > 0
+}
+
+// close ends all watches, e.g. when the connection closes.
+func (w *watchHandler) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, stop := range w.stops {
+		close(stop)
+		delete(w.stops, id)
+	}
+}
+
+func (w *watchHandler) run(id, path string, content bool, snap map[string]fileStamp, stop chan struct{}) {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		cur := snapshotPath(path)
+		for _, c := range diffSnapshots(snap, cur) {
+			logging.Debugf("Watch %s: %s %s", id, c.path, c.kind)
+			w.sendFunc(watchEventFrame(id, c, content && !cur[c.path].isDir))
+		}
+		snap = cur
+	}
+}
+
+// watchEventFrame builds a WATCH_EVENT frame, with the new content of the
+// file if it was asked for and is small enough.
+func watchEventFrame(id string, c watchChange, content bool) string {
+	frame := fmt.Sprintf("%s %s %s %s", protocol.CmdWatchEvent, id, c.kind, hex.EncodeToString([]byte(c.path)))
+	if content && c.kind != protocol.WatchRemoved {
+		if info, err := os.Stat(c.path); err == nil && info.Mode().IsRegular() && info.Size() <= protocol.MaxWatchContent {
+			if data, err := os.ReadFile(c.path); err == nil {
+				if encoded, err := compression.CompressToHex(data); err == nil {
+					frame += " " + encoded
+				}
+			}
+		}
+	}
+	return frame + "\n"
+}
+
+// handleWatchCommand starts watching a file or directory for changes
+func (rc *ReverseClient) handleWatchCommand(command string) error {
+	id, args, _ := strings.Cut(strings.TrimPrefix(command, protocol.CmdWatch+" "), " ")
+	value, path, content := cutOption(args, protocol.OptContent)
+	if id == "" || path == "" || content && value != "1" {
+		rc.writer.WriteString("Invalid watch command\n" + protocol.EndOfOutputMarker + "\n")
+		rc.writer.Flush()
+		return fmt.Errorf("invalid watch command: %s", command)
+	}
+	if rc.watches == nil {
+		rc.watches = newWatchHandler(func(frame string) {
+			if rc.writer != nil {
+				rc.writer.WriteString(frame)
+				rc.writer.Flush()
+			}
+		})
+	}
+	return rc.writeFileOpResult(rc.watches.start(id, path, content))
+}
+
+// handleUnwatchCommand stops a watch
+func (rc *ReverseClient) handleUnwatchCommand(command string) error {
+	id := strings.TrimPrefix(command, protocol.CmdUnwatch+" ")
+	if rc.watches == nil || !rc.watches.stop(id) {
+		return rc.writeFileOpResult(fmt.Errorf("no watch %s", id))
+	}
+	return rc.writeFileOpResult(nil)
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	now := time.Now()
+	old := map[string]fileStamp{
+		"/d":      {isDir: true, mod: now},
+		"/d/kept": {size: 1, mod: now},
+		"/d/gone": {size: 1, mod: now},
+		"/d/edit": {size: 1, mod: now},
+		"/d/sub":  {isDir: true, mod: now},
+	}
+	cur := map[string]fileStamp{
+		"/d":      {isDir: true, mod: now.Add(time.Second)},
+		"/d/kept": {size: 1, mod: now},
+		"/d/edit": {size: 2, mod: now},
+		"/d/new":  {size: 0, mod: now},
+		"/d/sub":  {isDir: true, mod: now.Add(time.Second)},
+	}
+	want := []watchChange{
+		{protocol.WatchModified, "/d/edit"},
+		{protocol.WatchRemoved, "/d/gone"},
+		{protocol.WatchCreated, "/d/new"},
+	}
+	if got := diffSnapshots(old, cur); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWatchHandlerReportsChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	frames := make(chan string, 10)
+	w := newWatchHandler(func(frame string) { frames <- frame })
+	defer w.close()
+	if err := w.start("w1", dir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644)
+	select {
+	case frame := <-frames:
+		fields := strings.Fields(frame)
+		if len(fields) != 5 || fields[1] != "w1" || fields[2] != protocol.WatchCreated {
+			t.Errorf("unexpected frame %q", frame)
+		}
+	case <-time.After(3 * watchPollInterval):
+		t.Fatal("no event for the new file")
+	}
+
+	if !w.stop("w1") || w.stop("w1") {
+		t.Error("expected the watch to stop once")
+	}
+	os.Remove(path)
+	select {
+	case frame := <-frames:
+		t.Errorf("unexpected frame after stop %q", frame)
+	case <-time.After(2 * watchPollInterval):
+	}
+}
+
+func TestHandleWatchCommand(t *testing.T) {
+	client, output := createMockClient()
+	defer func() {
+		if client.watches != nil {
+			client.watches.close()
+		}
+	}()
+	if err := client.handleWatchCommand(protocol.CmdWatch + " w1 content=1 " + t.TempDir()); err != nil || output.String() != "OK\n"+protocol.EndOfOutputMarker+"\n" {
+		t.Fatalf("WATCH failed: %v %q", err, output.String())
+	}
+	output.Reset()
+	if err := client.handleWatchCommand(protocol.CmdWatch + " w2"); err == nil || !strings.HasPrefix(output.String(), "Invalid watch command") {
+		t.Errorf("expected a WATCH without path to fail, got %v", err)
+	}
+	output.Reset()
+	if err := client.handleUnwatchCommand(protocol.CmdUnwatch + " w1"); err != nil {
+		t.Errorf("UNWATCH failed: %v", err)
+	}
+	if err := client.handleUnwatchCommand(protocol.CmdUnwatch + " w1"); err == nil {
+		t.Error("expected a second UNWATCH to fail")
+	}
+}
@@ -0,0 +1,96 @@
+package compression
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+)
+
+// Codecs name how a transfer payload is put on the wire. Both gzip the data
+// like CompressTransfer and differ in the text encoding of the result.
+const (
+	CodecGzip   = "gzip"   // Hex, which every client and listener reads
+	CodecGzip64 = "gzip64" // Standard base64, a third the size of hex
+)
+
+// Codecs lists the codecs this build reads and writes, preferred first.
+var Codecs = []string{CodecGzip64, CodecGzip}
+
+// Negotiate returns the preferred codec among those the peer announced.
+// Peers that announce none predate negotiation and only know CodecGzip.
+func Negotiate(peer []string) string {
+	for _, c := range Codecs {
+		if slices.Contains(peer, c) {
+			return c
+		}
+	}
+	return CodecGzip
+}
+
+// IsCodec reports whether this build knows codec.
+func IsCodec(codec string) bool {
+	return slices.Contains(Codecs, codec)
+}
+
+// textCodec is the text encoding of a codec.
+type textCodec struct {
+	encode func([]byte) string
+	decode func(string) ([]byte, error)
+	group  int // Characters that decode independently of the rest
+	ratio  float64
+}
+
+var textCodecs = map[string]textCodec{
+	CodecGzip:   {hex.EncodeToString, hex.DecodeString, 2, 2},
+	CodecGzip64: {base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString, 4, 4.0 / 3},
+}
+
+func lookup(codec string) (textCodec, error) {
+	tc, ok := textCodecs[codec]
+	if !ok {
+		return textCodec{}, fmt.Errorf("unsupported codec %q", codec)
+	}
+	return tc, nil
+}
+
+// EncodeTransfer compresses data like CompressTransfer and encodes it with
+// codec. It reports whether the data was mostly stored uncompressed.
+func EncodeTransfer(codec string, data []byte) (string, bool, error) {
+	tc, err := lookup(codec)
+	if err != nil {
+		return "", false, err
+	}
+	gz, stored, err := gzipTransfer(data)
+	if err != nil {
+		return "", false, err
+	}
+	return tc.encode(gz), stored, nil
+}
+
+// Decode decodes and decompresses a payload written with codec.
+func Decode(codec, payload string) ([]byte, error) {
+	tc, err := lookup(codec)
+	if err != nil {
+		return nil, err
+	}
+	if codec == CodecGzip {
+		return DecompressHex(payload)
+	}
+	gz, err := tc.decode(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", codec, err)
+	}
+	return gunzip(gz)
+}
+
+// CompressedLen returns how many gzip bytes an encoded payload of n
+// characters holds, give or take base64 padding, e.g. to check a transfer
+// size before decoding it.
+func CompressedLen(codec string, n int64) int64 {
+	tc, err := lookup(codec)
+	if err != nil {
+		return n
+	}
+	return int64(float64(n) / tc.ratio)
+}
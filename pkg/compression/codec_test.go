@@ -0,0 +1,81 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		peer []string
+		want string
+	}{
+		{nil, CodecGzip},
+		{[]string{CodecGzip}, CodecGzip},
+		{[]string{CodecGzip, CodecGzip64}, CodecGzip64},
+		{[]string{"zstd", CodecGzip64}, CodecGzip64},
+		{[]string{"zstd"}, CodecGzip},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.peer); got != tt.want {
+			t.Errorf("Negotiate(%v) = %q, want %q", tt.peer, got, tt.want)
+		}
+	}
+}
+
+func TestCodecRoundtrip(t *testing.T) {
+	input := bytes.Repeat([]byte("transfer payload "), 10000)
+	for _, codec := range Codecs {
+		encoded, _, err := EncodeTransfer(codec, input)
+		if err != nil {
+			t.Fatalf("%s: EncodeTransfer failed: %v", codec, err)
+		}
+		decoded, err := Decode(codec, encoded)
+		if err != nil || !bytes.Equal(decoded, input) {
+			t.Fatalf("%s: roundtrip failed: %v", codec, err)
+		}
+
+		// Pieces of a size that is a multiple of neither group
+		var out bytes.Buffer
+		d, err := NewStreamDecoder(codec, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(encoded); i += 777 {
+			if err := d.Write(encoded[i:min(i+777, len(encoded))]); err != nil {
+				t.Fatalf("%s: Write failed: %v", codec, err)
+			}
+		}
+		if n, err := d.Close(); err != nil || n != int64(len(input)) || !bytes.Equal(out.Bytes(), input) {
+			t.Fatalf("%s: stream roundtrip failed: %d bytes, %v", codec, n, err)
+		}
+	}
+
+	hexed, _, _ := EncodeTransfer(CodecGzip, input)
+	based, _, _ := EncodeTransfer(CodecGzip64, input)
+	if len(based) >= len(hexed) {
+		t.Errorf("expected %s to be smaller than %s: %d >= %d", CodecGzip64, CodecGzip, len(based), len(hexed))
+	}
+	want := CompressedLen(CodecGzip, int64(len(hexed)))
+	if got := CompressedLen(CodecGzip64, int64(len(based))); got < want || got > want+2 {
+		t.Errorf("expected both payloads to hold %d gzip bytes, got %d", want, got)
+	}
+}
+
+func TestCodecUnknown(t *testing.T) {
+	if _, _, err := EncodeTransfer("zstd", []byte("x")); err == nil {
+		t.Error("expected EncodeTransfer to reject an unknown codec")
+	}
+	if _, err := NewStreamDecoder("zstd", new(bytes.Buffer)); err == nil {
+		t.Error("expected NewStreamDecoder to reject an unknown codec")
+	}
+	if IsCodec("zstd") || !IsCodec(CodecGzip64) {
+		t.Error("unexpected IsCodec result")
+	}
+
+	d, _ := NewStreamDecoder(CodecGzip64, new(bytes.Buffer))
+	if err := d.Write("not*base64"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("invalid base64: got %v, want ErrCorrupt", err)
+	}
+}
@@ -24,6 +24,62 @@ func CompressToHex(data []byte) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+const (
+	// SampleSize is how much of a payload CompressTransfer compresses before
+	// deciding whether compressing the rest is worth it.
+	SampleSize = 64 << 10
+	// storeRatio is the compressed-to-raw ratio of the sample above which
+	// the rest is stored: archives and images gain nothing from gzip.
+	storeRatio = 0.95
+)
+
+// CompressTransfer compresses data like CompressToHex, but stops compressing
+// once the data turns out to be compressed already: if the first SampleSize
+// bytes barely shrink, the rest is written uncompressed as a second gzip
+// member, which gzip readers concatenate. It reports whether it did so.
+func CompressTransfer(data []byte) (string, bool, error) {
+	gz, stored, err := gzipTransfer(data)
+	if err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(gz), stored, nil
+}
+
+// gzipTransfer is CompressTransfer before encoding.
+func gzipTransfer(data []byte) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	if len(data) <= SampleSize {
+		err := writeMember(&buf, data, gzip.DefaultCompression)
+		return buf.Bytes(), false, err
+	}
+	if err := writeMember(&buf, data[:SampleSize], gzip.DefaultCompression); err != nil {
+		return nil, false, err
+	}
+	stored := float64(buf.Len()) > storeRatio*SampleSize
+	level := gzip.DefaultCompression
+	if stored {
+		level = gzip.NoCompression
+	}
+	if err := writeMember(&buf, data[SampleSize:], level); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), stored, nil
+}
+
+func writeMember(buf *bytes.Buffer, data []byte, level int) error {
+	gz, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(data); err != nil {
+		return fmt.Errorf("failed to write to gzip: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return nil
+}
+
 // DecompressHex decodes a hex-encoded string and decompresses it using gzip.
 // Returns the original uncompressed data.
 func DecompressHex(payload string) ([]byte, error) {
@@ -32,6 +88,11 @@ func DecompressHex(payload string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to decode hex: %w", err)
 	}
 
+	return gunzip(compressed)
+}
+
+// gunzip decompresses all gzip members in compressed.
+func gunzip(compressed []byte) ([]byte, error) {
 	gz, err := gzip.NewReader(bytes.NewReader(compressed))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
@@ -2,6 +2,7 @@ package compression
 
 import (
 	"bytes"
+	"math/rand"
 	"testing"
 )
 
@@ -91,3 +92,48 @@ func TestLargeDataCompression(t *testing.T) {
 func isHexCharByte(ch byte) bool {
 	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
 }
+
+// TestCompressTransferStoresIncompressibleData tests that random data is
+// stored after the sample and still decodes
+func TestCompressTransferStoresIncompressibleData(t *testing.T) {
+	input := make([]byte, 3*SampleSize)
+	rand.New(rand.NewSource(1)).Read(input)
+
+	encoded, stored, err := CompressTransfer(input)
+	if err != nil {
+		t.Fatalf("CompressTransfer failed: %v", err)
+	}
+	if !stored {
+		t.Error("expected random data to be stored")
+	}
+	decoded, err := DecompressHex(encoded)
+	if err != nil || !bytes.Equal(decoded, input) {
+		t.Fatalf("roundtrip failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	d := NewHexStreamDecoder(&out)
+	if err := d.Write(encoded); err != nil {
+		t.Fatalf("stream write failed: %v", err)
+	}
+	if n, err := d.Close(); err != nil || n != int64(len(input)) || !bytes.Equal(out.Bytes(), input) {
+		t.Fatalf("stream roundtrip failed: %d bytes, %v", n, err)
+	}
+}
+
+// TestCompressTransferCompressesText tests that compressible data stays
+// compressed throughout
+func TestCompressTransferCompressesText(t *testing.T) {
+	input := bytes.Repeat([]byte("log line with some text\n"), 3*SampleSize/24)
+	encoded, stored, err := CompressTransfer(input)
+	if err != nil {
+		t.Fatalf("CompressTransfer failed: %v", err)
+	}
+	if stored || len(encoded)/2 > len(input)/10 {
+		t.Errorf("expected text to compress (stored=%v, %d of %d bytes)", stored, len(encoded)/2, len(input))
+	}
+	decoded, err := DecompressHex(encoded)
+	if err != nil || !bytes.Equal(decoded, input) {
+		t.Fatalf("roundtrip failed: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package compression
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorrupt wraps errors caused by the payload itself, as opposed to errors
+// from the destination writer.
+var ErrCorrupt = errors.New("corrupt compressed data")
+
+var errAborted = errors.New("decompression aborted")
+
+// HexStreamDecoder decompresses a CompressToHex payload, or one written
+// with another codec, that arrives in pieces, writing the result to its
+// destination as it goes rather than holding the whole payload in memory.
+type HexStreamDecoder struct {
+	pw      *io.PipeWriter
+	done    chan struct{}
+	codec   textCodec
+	pending string // Trailing characters of an incomplete group, completed by the next piece
+	n       int64  // Bytes written; valid after done is closed
+	err     error  // Final error; valid after done is closed
+}
+
+// NewHexStreamDecoder starts decompressing into w.
+func NewHexStreamDecoder(w io.Writer) *HexStreamDecoder {
+	d, _ := NewStreamDecoder(CodecGzip, w)
+	return d
+}
+
+// NewStreamDecoder starts decompressing a payload written with codec into w.
+func NewStreamDecoder(codec string, w io.Writer) (*HexStreamDecoder, error) {
+	tc, err := lookup(codec)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	d := &HexStreamDecoder{pw: pw, done: make(chan struct{}), codec: tc}
+	go func() {
+		defer close(d.done)
+		dst := &trackedWriter{w: w}
+		gz, err := gzip.NewReader(pr)
+		if err == nil {
+			d.n, err = io.Copy(dst, gz)
+			gz.Close()
+		}
+		switch {
+		case dst.err != nil:
+			err = dst.err
+		case errors.Is(err, errAborted), errors.Is(err, ErrCorrupt):
+		case err != nil:
+			err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		d.err = err
+		// Unblock a Write still waiting on us
+		pr.CloseWithError(err)
+	}()
+	return d, nil
+}
+
+// Write decodes one piece of the payload. Pieces may split the payload
+// anywhere, even within a byte.
+func (d *HexStreamDecoder) Write(piece string) error {
+	piece = d.pending + piece
+	d.pending = ""
+	if extra := len(piece) % d.codec.group; extra != 0 {
+		d.pending = piece[len(piece)-extra:]
+		piece = piece[:len(piece)-extra]
+	}
+	data, err := d.codec.decode(piece)
+	if err != nil {
+		err = fmt.Errorf("%w: failed to decode payload: %v", ErrCorrupt, err)
+		d.pw.CloseWithError(err)
+		<-d.done
+		return err
+	}
+	if _, err := d.pw.Write(data); err != nil {
+		<-d.done
+		if d.err != nil {
+			return d.err
+		}
+		return err
+	}
+	return nil
+}
+
+// Close waits for the remaining data to be written and returns the number of
+// decompressed bytes. It fails if the payload is truncated or corrupt.
+func (d *HexStreamDecoder) Close() (int64, error) {
+	if d.pending != "" {
+		d.pw.CloseWithError(fmt.Errorf("%w: truncated payload", ErrCorrupt))
+	} else {
+		d.pw.Close()
+	}
+	<-d.done
+	return d.n, d.err
+}
+
+// Abort stops decompression without waiting for the rest of the payload.
+func (d *HexStreamDecoder) Abort() {
+	d.pw.CloseWithError(errAborted)
+	<-d.done
+}
+
+// trackedWriter remembers write errors so they are not reported as corrupt
+// input.
+type trackedWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *trackedWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		t.err = err
+	}
+	return n, err
+}
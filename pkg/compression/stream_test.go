@@ -0,0 +1,78 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestHexStreamDecoderOddPieces(t *testing.T) {
+	input := bytes.Repeat([]byte("streamed upload data "), 20000)
+	encoded, err := CompressToHex(input)
+	if err != nil {
+		t.Fatalf("CompressToHex failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	d := NewHexStreamDecoder(&out)
+	for i := 0; i < len(encoded); i += 777 {
+		if err := d.Write(encoded[i:min(i+777, len(encoded))]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	n, err := d.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if n != int64(len(input)) || !bytes.Equal(out.Bytes(), input) {
+		t.Errorf("got %d bytes, want %d", n, len(input))
+	}
+}
+
+func TestHexStreamDecoderCorrupt(t *testing.T) {
+	encoded, _ := CompressToHex([]byte("hello"))
+
+	d := NewHexStreamDecoder(new(bytes.Buffer))
+	if err := d.Write("zz" + encoded); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("invalid hex: got %v, want ErrCorrupt", err)
+	}
+
+	d = NewHexStreamDecoder(new(bytes.Buffer))
+	if err := d.Write(encoded[:len(encoded)/2]); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := d.Close(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated payload: got %v, want ErrCorrupt", err)
+	}
+
+	d = NewHexStreamDecoder(new(bytes.Buffer))
+	d.Write(encoded[:len(encoded)-1])
+	if _, err := d.Close(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("odd length payload: got %v, want ErrCorrupt", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestHexStreamDecoderWriteError(t *testing.T) {
+	encoded, _ := CompressToHex([]byte("hello"))
+	d := NewHexStreamDecoder(failingWriter{})
+	d.Write(encoded)
+	_, err := d.Close()
+	if err == nil || errors.Is(err, ErrCorrupt) || err.Error() != "disk full" {
+		t.Errorf("got %v, want the writer's error", err)
+	}
+}
+
+func TestHexStreamDecoderAbort(t *testing.T) {
+	encoded, _ := CompressToHex(bytes.Repeat([]byte("x"), 100000))
+	var out bytes.Buffer
+	d := NewHexStreamDecoder(&out)
+	d.Write(encoded[:len(encoded)/2])
+	d.Abort()
+	if _, err := d.Close(); err == nil {
+		t.Error("expected an error after Abort")
+	}
+}
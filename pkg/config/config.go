@@ -3,16 +3,31 @@
 package config
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
 )
 
 // ServerConfig holds configuration for the gotsl listener.
 type ServerConfig struct {
 	Port               string        `yaml:"port" json:"port"`
 	NetworkInterface   string        `yaml:"network_interface" json:"network_interface"`
+	// Listen overrides network_interface:port for the agent protocol, e.g.
+	// "unix:///var/run/gots.sock" when running behind a local TLS frontend,
+	// or "icmp://0.0.0.0" to accept clients tunneling through ICMP echo.
+	Listen string `yaml:"listen" json:"listen"`
 	BufferSize         int           `yaml:"buffer_size" json:"buffer_size"`
 	MaxBufferSize      int           `yaml:"max_buffer_size" json:"max_buffer_size"`
 	ChunkSize          int           `yaml:"chunk_size" json:"chunk_size"`
@@ -22,6 +37,250 @@ type ServerConfig struct {
 	DownloadTimeout    time.Duration `yaml:"download_timeout" json:"download_timeout"`
 	PingInterval       time.Duration `yaml:"ping_interval" json:"ping_interval"`
 	SharedSecretAuth   bool          `yaml:"shared_secret_auth" json:"shared_secret_auth"`
+	// CommandTemplates maps a client OS (as reported in IDENT, e.g. "linux",
+	// "windows") to named command templates. The "default" entry applies to
+	// any OS without its own entry.
+	CommandTemplates map[string]map[string]string `yaml:"command_templates" json:"command_templates"`
+	ControlAPI       ControlAPIConfig              `yaml:"control_api" json:"control_api"`
+	AuditLog         string                        `yaml:"audit_log" json:"audit_log"` // JSON-lines file for operator actions and denials
+	// DisableSessionResumption turns off TLS session tickets so every
+	// reconnect performs a full handshake.
+	DisableSessionResumption bool `yaml:"disable_session_resumption" json:"disable_session_resumption"`
+	// ALPN lists the protocols offered to clients that do not match a profile.
+	ALPN []string `yaml:"alpn" json:"alpn"`
+	// Profiles select a certificate and ALPN list by the SNI name a client
+	// sends, so several profiles can share the listener port.
+	Profiles []ProfileConfig `yaml:"profiles" json:"profiles"`
+	// MaxParallelOps caps how many operations may run against one client at
+	// once. Operations that wait for a command response or touch the same
+	// remote path are always serialized.
+	MaxParallelOps int `yaml:"max_parallel_ops" json:"max_parallel_ops"`
+	// DisableReverseDNS stops the listener from reverse-resolving client
+	// source IPs, e.g. where lookups would reach a monitored DNS server.
+	DisableReverseDNS bool `yaml:"disable_reverse_dns" json:"disable_reverse_dns"`
+	// RetryIdempotent sends read-only built-in commands (LIST, PEEK and
+	// SYSINFO) once more when they time out but the client is still
+	// connected, instead of leaving the operator to re-type them.
+	RetryIdempotent bool `yaml:"retry_idempotent" json:"retry_idempotent"`
+	// GeoIPDatabases lists local MaxMind DB files (e.g. GeoLite2-City and
+	// GeoLite2-ASN) used to show where client source IPs are located.
+	GeoIPDatabases []string `yaml:"geoip_databases" json:"geoip_databases"`
+	// LootDir receives downloads saved without an explicit local path, in a
+	// subdirectory per client. Remote names can never escape it.
+	LootDir string `yaml:"loot_dir" json:"loot_dir"`
+	// MaxDownloadSize makes clients refuse downloads of larger files unless
+	// the operator forces them. Zero disables the limit.
+	MaxDownloadSize int64 `yaml:"max_download_size" json:"max_download_size"`
+	// MaxResponseSize is the largest command response the listener accepts
+	// from a client; larger ones fail. Responses past 10 MiB are buffered on
+	// disk until complete, but are then read back into memory. Zero disables
+	// the limit.
+	MaxResponseSize int64 `yaml:"max_response_size" json:"max_response_size"`
+	// UploadOverwrite is what an upload does when the remote file exists:
+	// fail, overwrite or rename. Operators can override it per upload.
+	UploadOverwrite string `yaml:"upload_overwrite" json:"upload_overwrite"`
+	// PromptTemplate is the REPL prompt. See DefaultPromptTemplate for the
+	// placeholders and optional [segments].
+	PromptTemplate string `yaml:"prompt_template" json:"prompt_template"`
+	// PasteConfirmSize makes a PTY shell ask before sending a paste of at
+	// least this many bytes. Zero sends every paste without asking.
+	PasteConfirmSize int `yaml:"paste_confirm_size" json:"paste_confirm_size"`
+	// PtyScrollback is how many bytes of PTY output the listener keeps per
+	// host, shown when a shell on the host is opened again. Zero keeps none.
+	PtyScrollback int `yaml:"pty_scrollback" json:"pty_scrollback"`
+	// ScrollbackDir keeps the PTY scrollback on disk as well, so it
+	// survives a listener restart. Empty keeps it in memory only.
+	ScrollbackDir string `yaml:"scrollback_dir" json:"scrollback_dir"`
+	// ListingCacheTTL is how long the listener reuses a remote directory
+	// listing for tab completion. Zero disables the cache.
+	ListingCacheTTL time.Duration `yaml:"listing_cache_ttl" json:"listing_cache_ttl"`
+	// TransferWindows are low-usage periods of the day in local time, e.g.
+	// "01:00-05:00", that deferred uploads and downloads wait for.
+	TransferWindows []string `yaml:"transfer_windows" json:"transfer_windows"`
+	// RecordDir receives a recording of every client session, which
+	// gotsl --replay plays back offline to debug protocol problems.
+	RecordDir string `yaml:"record_dir" json:"record_dir"`
+	// TunnelCapture is a pcap file receiving the decrypted traffic of
+	// forwards and SOCKS proxies, to debug protocols that break when
+	// tunneled. It holds that traffic in the clear, so enabling it is
+	// recorded in the audit log.
+	TunnelCapture string `yaml:"tunnel_capture" json:"tunnel_capture"`
+	// RequireApproval holds new clients in a pending state, where only
+	// SYSINFO is sent to them, until an operator approves them.
+	RequireApproval bool `yaml:"require_approval" json:"require_approval"`
+	// SandboxChecks probes new clients for signs of an analysis sandbox or
+	// honeypot and flags them in ls and notifications.
+	SandboxChecks bool `yaml:"sandbox_checks" json:"sandbox_checks"`
+	// SandboxHostnames are the hostname patterns flagged by the sandbox
+	// checks, e.g. "*sandbox*". Empty means the listener's defaults.
+	SandboxHostnames []string `yaml:"sandbox_hostnames" json:"sandbox_hostnames"`
+	// ClientHashesFile lists the SHA-256 hashes of the gotsr builds made
+	// for the engagement, in sha256sum format as make writes it. Clients
+	// whose executable hashes to anything else are flagged on connect.
+	ClientHashesFile string `yaml:"client_hashes_file" json:"client_hashes_file"`
+	// EngagementEnd is when the engagement ends, e.g. "2025-10-31T18:00Z".
+	// From then on clients are told to terminate and the REPL is read-only.
+	EngagementEnd string `yaml:"engagement_end" json:"engagement_end"`
+	// LogSink also sends the log and audit events to a system logger:
+	// "syslog" or "journald". Empty logs to the console only.
+	LogSink string `yaml:"log_sink" json:"log_sink"`
+	// SyslogAddress is the collector for the syslog sink, e.g.
+	// "udp://logs.example.com:514". Empty means the local syslog socket.
+	SyslogAddress string `yaml:"syslog_address" json:"syslog_address"`
+	// OnConnect lists commands run in order on every new client once it
+	// is identified and, with RequireApproval, approved. Built-in frames
+	// such as SYSINFO work as well as shell commands.
+	OnConnect []string `yaml:"on_connect" json:"on_connect"`
+	// SPAListen is a UDP address, e.g. ":62201", for single-packet
+	// authorization. When set, connections to the agent port are closed
+	// before the TLS handshake unless their source address sent an SPA
+	// packet signed with SPAKey (64 hex characters) within the last
+	// SPAWindow. The port itself still accepts TCP connections.
+	SPAListen string        `yaml:"spa_listen" json:"spa_listen"`
+	SPAKey    string        `yaml:"spa_key" json:"spa_key"`
+	SPAWindow time.Duration `yaml:"spa_window" json:"spa_window"`
+	// RekeyInterval makes clients reconnect for new TLS session keys once
+	// they have been connected this long, as soon as nothing is in flight.
+	// Zero keeps the keys of a session for as long as it lasts.
+	RekeyInterval time.Duration `yaml:"rekey_interval" json:"rekey_interval"`
+	// Certificate sets the subject of the generated self-signed
+	// certificate, whose default one is easy to fingerprint.
+	Certificate CertificateConfig `yaml:"certificate" json:"certificate"`
+	// CertFile and KeyFile name a PEM certificate and key to serve instead
+	// of a certificate generated on every start, so clients can pin one
+	// fingerprint for the whole engagement. The key may be encrypted with
+	// an age passphrase.
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+}
+
+// DefaultMaxParallelOps is the default per-client operation limit.
+const DefaultMaxParallelOps = 4
+
+// DefaultLootDir is where downloads without a local path are saved.
+const DefaultLootDir = "loot"
+
+// DefaultMaxDownloadSize is the default download size limit (100 MiB).
+// Downloads are held in memory on both ends.
+const DefaultMaxDownloadSize = 100 << 20
+
+// DefaultMaxResponseSize is the default command response size limit
+// (192 MiB), enough for a base64-encoded download of DefaultMaxDownloadSize.
+// Responses are handed to commands as strings, so the listener briefly
+// needs about twice this much memory per response.
+const DefaultMaxResponseSize = 192 << 20
+
+// DefaultPtyScrollback is how much PTY output is kept per host.
+const DefaultPtyScrollback = 64 << 10
+
+// DefaultListingCacheTTL is how long remote directory listings are reused.
+const DefaultListingCacheTTL = 30 * time.Second
+
+// DefaultSPAWindow is how long an SPA packet admits its source address.
+const DefaultSPAWindow = 30 * time.Second
+
+// DefaultPromptTemplate is the default REPL prompt. Placeholders: {id},
+// {host}, {user}, {userhost}, {priv} (# when elevated, $ otherwise),
+// {tunnels} and {clients}. A [segment] is left out when all placeholders in
+// it are empty.
+const DefaultPromptTemplate = "gotsl[({id} {userhost}{priv})][ tunnels:{tunnels}]> "
+
+// ProfileConfig is a listener profile routed by SNI.
+type ProfileConfig struct {
+	Name        string   `yaml:"name" json:"name"`
+	ServerNames []string `yaml:"server_names" json:"server_names"` // Exact names or "*.example.com"
+	CertFile    string   `yaml:"cert_file" json:"cert_file"`       // PEM certificate; defaults to the listener's
+	KeyFile     string   `yaml:"key_file" json:"key_file"`
+	ALPN        []string `yaml:"alpn" json:"alpn"`
+}
+
+// CertificateConfig sets the subject and subject alternative names of the
+// generated certificate. Mimic starts from the subject of a product's default
+// certificate (see certs.Presets); the other fields override it.
+type CertificateConfig struct {
+	Mimic              string   `yaml:"mimic" json:"mimic"`
+	CommonName         string   `yaml:"common_name" json:"common_name"`
+	Organization       string   `yaml:"organization" json:"organization"`
+	OrganizationalUnit string   `yaml:"organizational_unit" json:"organizational_unit"`
+	Locality           string   `yaml:"locality" json:"locality"`
+	Province           string   `yaml:"province" json:"province"`
+	Country            string   `yaml:"country" json:"country"` // Two-letter code
+	SANs               []string `yaml:"sans" json:"sans"`       // DNS names and IP addresses
+}
+
+// Subject returns the certificate subject c describes. A common name given
+// without SANs is also the only SAN.
+func (c CertificateConfig) Subject() certs.Subject {
+	subject := certs.DefaultSubject
+	if c.Mimic != "" {
+		subject = certs.Presets[c.Mimic]
+	}
+	if c.CommonName != "" {
+		subject.CommonName = c.CommonName
+		subject.SANs = []string{c.CommonName}
+	}
+	override(&subject.Organization, c.Organization)
+	override(&subject.OrganizationalUnit, c.OrganizationalUnit)
+	override(&subject.Locality, c.Locality)
+	override(&subject.Province, c.Province)
+	override(&subject.Country, c.Country)
+	if len(c.SANs) > 0 {
+		subject.SANs = c.SANs
+	}
+	return subject
+}
+
+// override sets *field to v unless v is empty.
+func override(field *string, v string) {
+	if v != "" {
+		*field = v
+	}
+}
+
+// Validate validates the certificate configuration.
+func (c *CertificateConfig) Validate() error {
+	if _, ok := certs.Presets[c.Mimic]; c.Mimic != "" && !ok {
+		names := slices.Sorted(maps.Keys(certs.Presets))
+		return fmt.Errorf("unknown mimic %q: must be one of %s", c.Mimic, strings.Join(names, ", "))
+	}
+	if c.Country != "" && len(c.Country) != 2 {
+		return fmt.Errorf("country must be a two-letter code, got %q", c.Country)
+	}
+	for _, san := range c.SANs {
+		if san == "" || (strings.ContainsAny(san, " \t/:") && net.ParseIP(san) == nil) {
+			return fmt.Errorf("invalid SAN %q: must be a DNS name or IP address", san)
+		}
+	}
+	return nil
+}
+
+// ControlAPIConfig configures the operator control API and its auth backends.
+// The API is disabled when Listen is empty.
+type ControlAPIConfig struct {
+	Listen       string            `yaml:"listen" json:"listen"`               // host:port or unix:///path to serve HTTPS on
+	Token        string            `yaml:"token" json:"token"`                 // Static bearer token (admin role)
+	HtpasswdFile string            `yaml:"htpasswd_file" json:"htpasswd_file"` // Apache htpasswd file for basic auth
+	OIDC         OIDCConfig        `yaml:"oidc" json:"oidc"`
+	Roles        map[string]string `yaml:"roles" json:"roles"`               // Operator name -> admin|read-only
+	DefaultRole  string            `yaml:"default_role" json:"default_role"` // Role for operators not in Roles
+	// Policies restricts individual operators (or "*" for everyone without
+	// an entry) to tagged clients and/or denies capabilities.
+	Policies map[string]PolicyConfig `yaml:"policies" json:"policies"`
+}
+
+// PolicyConfig limits which clients an operator may touch and what they may do.
+type PolicyConfig struct {
+	ClientTags []string `yaml:"client_tags" json:"client_tags"` // Client must announce one of these tags
+	Deny       []string `yaml:"deny" json:"deny"`               // exec, forward, socks
+}
+
+// OIDCConfig configures OIDC bearer token validation for the control API.
+// OIDC is disabled when Issuer is empty.
+type OIDCConfig struct {
+	Issuer      string   `yaml:"issuer" json:"issuer"`
+	Audience    string   `yaml:"audience" json:"audience"`
+	RoleClaim   string   `yaml:"role_claim" json:"role_claim"`     // Defaults to "groups"
+	AdminValues []string `yaml:"admin_values" json:"admin_values"` // RoleClaim values granting admin
 }
 
 // ClientConfig holds configuration for the gotsr client.
@@ -38,6 +297,54 @@ type ClientConfig struct {
 	PingInterval       time.Duration `yaml:"ping_interval" json:"ping_interval"`
 	SharedSecret       string        `yaml:"shared_secret" json:"shared_secret"`
 	CertFingerprint    string        `yaml:"cert_fingerprint" json:"cert_fingerprint"`
+	Tags               []string      `yaml:"tags" json:"tags"` // Announced to the listener for operator policies
+	// DisableSessionResumption stops the client from caching TLS sessions
+	// across reconnects.
+	DisableSessionResumption bool `yaml:"disable_session_resumption" json:"disable_session_resumption"`
+	SNI                      string   `yaml:"sni" json:"sni"`   // TLS server name to send instead of the target host
+	ALPN                     []string `yaml:"alpn" json:"alpn"` // ALPN protocols to offer, e.g. h2,http/1.1
+	BindInterface            string   `yaml:"bind_interface" json:"bind_interface"` // Outbound interface for the callback
+	SourceIP                 string   `yaml:"source_ip" json:"source_ip"`           // Local address to connect from
+	// MachineIDSalt is hashed with the host's machine ID to form the stable
+	// identifier announced in IDENT. Keep it constant across rebuilds so a
+	// reinstalled client maps to the same asset.
+	MachineIDSalt string `yaml:"machine_id_salt" json:"machine_id_salt"`
+	// AdaptivePing shortens the ping interval the client asks for after
+	// connections keep dying while idle, as they do behind NATs with short
+	// flow timeouts.
+	AdaptivePing bool `yaml:"adaptive_ping" json:"adaptive_ping"`
+	// Nice (0-19) lowers the CPU priority of the client and the commands it
+	// runs. MemoryLimit is a soft cap in bytes above which transfers are
+	// refused, BandwidthLimit caps traffic to the listener in bytes per
+	// second, and MaxTransferSize is the largest file uploaded or downloaded,
+	// announced in IDENT. Zero leaves each unlimited.
+	Nice            int   `yaml:"nice" json:"nice"`
+	MemoryLimit     int64 `yaml:"memory_limit" json:"memory_limit"`
+	BandwidthLimit  int64 `yaml:"bandwidth_limit" json:"bandwidth_limit"`
+	MaxTransferSize int64 `yaml:"max_transfer_size" json:"max_transfer_size"`
+	// SSHJump tunnels the listener connection through an SSH server,
+	// "user@host[:port]", for networks that only let SSH out. SSHKey is a
+	// private key file and SSHPassword a password to log in with; an
+	// ssh-agent is used as well when SSH_AUTH_SOCK is set. SSHHostKey pins
+	// the server's SHA256 host key fingerprint, as ssh-keygen -lf shows it.
+	SSHJump     string `yaml:"ssh_jump" json:"ssh_jump"`
+	SSHKey      string `yaml:"ssh_key" json:"ssh_key"`
+	SSHPassword string `yaml:"ssh_password" json:"ssh_password"`
+	SSHHostKey  string `yaml:"ssh_host_key" json:"ssh_host_key"`
+	// Proxy is the proxy to reach the listener through: an http:// (CONNECT)
+	// or socks5:// URL, or "none" to connect directly. When empty, the
+	// HTTPS_PROXY/NO_PROXY variables are honoured, then the system proxy
+	// settings of Windows and macOS. ProxyPAC lets those settings point to
+	// a PAC file (or WPAD), from which the first proxy listed is used.
+	Proxy    string `yaml:"proxy" json:"proxy"`
+	ProxyPAC bool   `yaml:"proxy_pac" json:"proxy_pac"`
+	// Knock is sent to the listener host before every connection attempt:
+	// a comma-separated sequence of "tcp:<port>", "udp:<port>" and
+	// "spa:<port>" knocks. TCP and UDP knocks open ports guarded by a port
+	// knocking daemon; an SPA knock is a single-packet authorization signed
+	// with SPAKey (64 hex characters) for a listener with spa_listen.
+	Knock  string `yaml:"knock" json:"knock"`
+	SPAKey string `yaml:"spa_key" json:"spa_key"`
 }
 
 // DefaultServerConfig returns server configuration with sensible defaults.
@@ -55,6 +362,16 @@ func DefaultServerConfig() *ServerConfig {
 		DownloadTimeout:  5000000000 * time.Nanosecond, // ~5 seconds for large files
 		PingInterval:     30 * time.Second,
 		SharedSecretAuth: false,
+		CommandTemplates: DefaultCommandTemplates(),
+		MaxParallelOps:   DefaultMaxParallelOps,
+		LootDir:          DefaultLootDir,
+		MaxDownloadSize:  DefaultMaxDownloadSize,
+		MaxResponseSize:  DefaultMaxResponseSize,
+		UploadOverwrite:  protocol.OverwriteFail,
+		PromptTemplate:   DefaultPromptTemplate,
+		ListingCacheTTL:  DefaultListingCacheTTL,
+		PtyScrollback:    DefaultPtyScrollback,
+		SPAWindow:        DefaultSPAWindow,
 	}
 }
 
@@ -76,7 +393,19 @@ func DefaultClientConfig() *ClientConfig {
 // LoadServerConfig loads server configuration with environment variable overrides.
 // Priority: env vars > passed values > defaults
 func LoadServerConfig(port, networkInterface string, useSharedSecret bool) (*ServerConfig, error) {
+	return LoadServerConfigFromFile("", port, networkInterface, useSharedSecret)
+}
+
+// LoadServerConfigFromFile loads server configuration from an optional JSON
+// file and applies passed values and environment variable overrides on top.
+// Priority: env vars > passed values > config file > defaults
+func LoadServerConfigFromFile(path, port, networkInterface string, useSharedSecret bool) (*ServerConfig, error) {
 	cfg := DefaultServerConfig()
+	if path != "" {
+		if err := applyServerConfigFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
 
 	// Override with provided arguments
 	if port != "" {
@@ -85,7 +414,9 @@ func LoadServerConfig(port, networkInterface string, useSharedSecret bool) (*Ser
 	if networkInterface != "" {
 		cfg.NetworkInterface = networkInterface
 	}
-	cfg.SharedSecretAuth = useSharedSecret
+	if useSharedSecret {
+		cfg.SharedSecretAuth = true
+	}
 
 	// Apply environment variable overrides
 	if err := applyServerConfigEnv(cfg); err != nil {
@@ -132,6 +463,40 @@ func LoadClientConfig(target string, maxRetries int, sharedSecret, certFingerpri
 	return cfg, nil
 }
 
+// applyServerConfigFile decodes a JSON config file into cfg. Command templates
+// from the file are merged per OS and per name on top of the defaults, so a
+// file only needs to list the templates it wants to change.
+func applyServerConfigFile(cfg *ServerConfig, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	defaults := cfg.CommandTemplates
+	cfg.CommandTemplates = nil
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	merged := make(map[string]map[string]string, len(defaults))
+	for osName, templates := range defaults {
+		merged[osName] = make(map[string]string, len(templates))
+		for name, tpl := range templates {
+			merged[osName][name] = tpl
+		}
+	}
+	for osName, templates := range cfg.CommandTemplates {
+		if merged[osName] == nil {
+			merged[osName] = make(map[string]string, len(templates))
+		}
+		for name, tpl := range templates {
+			merged[osName][name] = tpl
+		}
+	}
+	cfg.CommandTemplates = merged
+	return nil
+}
+
 // applyServerConfigEnv applies environment variable overrides to server config.
 func applyServerConfigEnv(cfg *ServerConfig) error {
 	envMap := map[string]func(string) error{
@@ -217,6 +582,274 @@ func applyServerConfigEnv(cfg *ServerConfig) error {
 			}
 			return nil
 		},
+		"GOTS_LISTEN": func(v string) error {
+			if v != "" {
+				cfg.Listen = v
+			}
+			return nil
+		},
+		"GOTS_API_LISTEN": func(v string) error {
+			if v != "" {
+				cfg.ControlAPI.Listen = v
+			}
+			return nil
+		},
+		"GOTS_API_TOKEN": func(v string) error {
+			if v != "" {
+				cfg.ControlAPI.Token = v
+			}
+			return nil
+		},
+		"GOTS_DISABLE_SESSION_RESUMPTION": func(v string) error {
+			if v != "" {
+				disabled, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_DISABLE_SESSION_RESUMPTION: %w", err)
+				}
+				cfg.DisableSessionResumption = disabled
+			}
+			return nil
+		},
+		"GOTS_DISABLE_REVERSE_DNS": func(v string) error {
+			if v != "" {
+				disabled, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_DISABLE_REVERSE_DNS: %w", err)
+				}
+				cfg.DisableReverseDNS = disabled
+			}
+			return nil
+		},
+		"GOTS_RETRY_IDEMPOTENT": func(v string) error {
+			if v != "" {
+				retry, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_RETRY_IDEMPOTENT: %w", err)
+				}
+				cfg.RetryIdempotent = retry
+			}
+			return nil
+		},
+		"GOTS_REQUIRE_APPROVAL": func(v string) error {
+			if v != "" {
+				require, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_REQUIRE_APPROVAL: %w", err)
+				}
+				cfg.RequireApproval = require
+			}
+			return nil
+		},
+		"GOTS_SANDBOX_CHECKS": func(v string) error {
+			if v != "" {
+				enabled, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_SANDBOX_CHECKS: %w", err)
+				}
+				cfg.SandboxChecks = enabled
+			}
+			return nil
+		},
+		"GOTS_SANDBOX_HOSTNAMES": func(v string) error {
+			if v != "" {
+				cfg.SandboxHostnames = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_CLIENT_HASHES_FILE": func(v string) error {
+			if v != "" {
+				cfg.ClientHashesFile = v
+			}
+			return nil
+		},
+		"GOTS_ENGAGEMENT_END": func(v string) error {
+			if v != "" {
+				cfg.EngagementEnd = v
+			}
+			return nil
+		},
+		"GOTS_LOG_SINK": func(v string) error {
+			if v != "" {
+				cfg.LogSink = v
+			}
+			return nil
+		},
+		"GOTS_SYSLOG_ADDRESS": func(v string) error {
+			if v != "" {
+				cfg.SyslogAddress = v
+			}
+			return nil
+		},
+		"GOTS_LOOT_DIR": func(v string) error {
+			if v != "" {
+				cfg.LootDir = v
+			}
+			return nil
+		},
+		"GOTS_RECORD_DIR": func(v string) error {
+			if v != "" {
+				cfg.RecordDir = v
+			}
+			return nil
+		},
+		"GOTS_SCROLLBACK_DIR": func(v string) error {
+			if v != "" {
+				cfg.ScrollbackDir = v
+			}
+			return nil
+		},
+		"GOTS_TUNNEL_CAPTURE": func(v string) error {
+			if v != "" {
+				cfg.TunnelCapture = v
+			}
+			return nil
+		},
+		"GOTS_GEOIP_DATABASES": func(v string) error {
+			if v != "" {
+				cfg.GeoIPDatabases = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_MAX_DOWNLOAD_SIZE": func(v string) error {
+			if v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_MAX_DOWNLOAD_SIZE: %w", err)
+				}
+				cfg.MaxDownloadSize = n
+			}
+			return nil
+		},
+		"GOTS_MAX_RESPONSE_SIZE": func(v string) error {
+			if v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_MAX_RESPONSE_SIZE: %w", err)
+				}
+				cfg.MaxResponseSize = n
+			}
+			return nil
+		},
+		"GOTS_UPLOAD_OVERWRITE": func(v string) error {
+			if v != "" {
+				cfg.UploadOverwrite = v
+			}
+			return nil
+		},
+		"GOTS_PROMPT_TEMPLATE": func(v string) error {
+			if v != "" {
+				cfg.PromptTemplate = v
+			}
+			return nil
+		},
+		"GOTS_LISTING_CACHE_TTL": func(v string) error {
+			if v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_LISTING_CACHE_TTL: %w", err)
+				}
+				cfg.ListingCacheTTL = d
+			}
+			return nil
+		},
+		"GOTS_SPA_LISTEN": func(v string) error {
+			if v != "" {
+				cfg.SPAListen = v
+			}
+			return nil
+		},
+		"GOTS_SPA_KEY": func(v string) error {
+			if v != "" {
+				cfg.SPAKey = v
+			}
+			return nil
+		},
+		"GOTS_CERT_FILE": func(v string) error {
+			if v != "" {
+				cfg.CertFile = v
+			}
+			return nil
+		},
+		"GOTS_KEY_FILE": func(v string) error {
+			if v != "" {
+				cfg.KeyFile = v
+			}
+			return nil
+		},
+		"GOTS_CERT_MIMIC": func(v string) error {
+			if v != "" {
+				cfg.Certificate.Mimic = v
+			}
+			return nil
+		},
+		"GOTS_CERT_CN": func(v string) error {
+			if v != "" {
+				cfg.Certificate.CommonName = v
+			}
+			return nil
+		},
+		"GOTS_CERT_SANS": func(v string) error {
+			if v != "" {
+				cfg.Certificate.SANs = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_REKEY_INTERVAL": func(v string) error {
+			if v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_REKEY_INTERVAL: %w", err)
+				}
+				cfg.RekeyInterval = d
+			}
+			return nil
+		},
+		"GOTS_SPA_WINDOW": func(v string) error {
+			if v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_SPA_WINDOW: %w", err)
+				}
+				cfg.SPAWindow = d
+			}
+			return nil
+		},
+		"GOTS_TRANSFER_WINDOWS": func(v string) error {
+			if v != "" {
+				cfg.TransferWindows = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_PASTE_CONFIRM_SIZE": func(v string) error {
+			if v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_PASTE_CONFIRM_SIZE: %w", err)
+				}
+				cfg.PasteConfirmSize = n
+			}
+			return nil
+		},
+		"GOTS_PTY_SCROLLBACK": func(v string) error {
+			if v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_PTY_SCROLLBACK: %w", err)
+				}
+				cfg.PtyScrollback = n
+			}
+			return nil
+		},
+		"GOTS_MAX_PARALLEL_OPS": func(v string) error {
+			if v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_MAX_PARALLEL_OPS: %w", err)
+				}
+				cfg.MaxParallelOps = n
+			}
+			return nil
+		},
 	}
 
 	for envVar, apply := range envMap {
@@ -329,6 +962,154 @@ func applyClientConfigEnv(cfg *ClientConfig) error {
 			}
 			return nil
 		},
+		"GOTS_TAGS": func(v string) error {
+			if v != "" {
+				cfg.Tags = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_SNI": func(v string) error {
+			if v != "" {
+				cfg.SNI = v
+			}
+			return nil
+		},
+		"GOTS_ALPN": func(v string) error {
+			if v != "" {
+				cfg.ALPN = SplitList(v)
+			}
+			return nil
+		},
+		"GOTS_BIND_IFACE": func(v string) error {
+			if v != "" {
+				cfg.BindInterface = v
+			}
+			return nil
+		},
+		"GOTS_SOURCE_IP": func(v string) error {
+			if v != "" {
+				cfg.SourceIP = v
+			}
+			return nil
+		},
+		"GOTS_SSH_JUMP": func(v string) error {
+			if v != "" {
+				cfg.SSHJump = v
+			}
+			return nil
+		},
+		"GOTS_SSH_KEY": func(v string) error {
+			if v != "" {
+				cfg.SSHKey = v
+			}
+			return nil
+		},
+		"GOTS_SSH_PASSWORD": func(v string) error {
+			if v != "" {
+				cfg.SSHPassword = v
+			}
+			return nil
+		},
+		"GOTS_SSH_HOST_KEY": func(v string) error {
+			if v != "" {
+				cfg.SSHHostKey = v
+			}
+			return nil
+		},
+		"GOTS_PROXY": func(v string) error {
+			if v != "" {
+				cfg.Proxy = v
+			}
+			return nil
+		},
+		"GOTS_PROXY_PAC": func(v string) error {
+			if v != "" {
+				pac, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_PROXY_PAC: %w", err)
+				}
+				cfg.ProxyPAC = pac
+			}
+			return nil
+		},
+		"GOTS_KNOCK": func(v string) error {
+			if v != "" {
+				cfg.Knock = v
+			}
+			return nil
+		},
+		"GOTS_SPA_KEY": func(v string) error {
+			if v != "" {
+				cfg.SPAKey = v
+			}
+			return nil
+		},
+		"GOTS_MACHINE_ID_SALT": func(v string) error {
+			if v != "" {
+				cfg.MachineIDSalt = v
+			}
+			return nil
+		},
+		"GOTS_ADAPTIVE_PING": func(v string) error {
+			if v != "" {
+				adaptive, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_ADAPTIVE_PING: %w", err)
+				}
+				cfg.AdaptivePing = adaptive
+			}
+			return nil
+		},
+		"GOTS_NICE": func(v string) error {
+			if v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_NICE: %w", err)
+				}
+				cfg.Nice = n
+			}
+			return nil
+		},
+		"GOTS_MEMORY_LIMIT": func(v string) error {
+			if v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_MEMORY_LIMIT: %w", err)
+				}
+				cfg.MemoryLimit = n
+			}
+			return nil
+		},
+		"GOTS_BANDWIDTH_LIMIT": func(v string) error {
+			if v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_BANDWIDTH_LIMIT: %w", err)
+				}
+				cfg.BandwidthLimit = n
+			}
+			return nil
+		},
+		"GOTS_MAX_TRANSFER_SIZE": func(v string) error {
+			if v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_MAX_TRANSFER_SIZE: %w", err)
+				}
+				cfg.MaxTransferSize = n
+			}
+			return nil
+		},
+		"GOTS_DISABLE_SESSION_RESUMPTION": func(v string) error {
+			if v != "" {
+				disabled, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("invalid GOTS_DISABLE_SESSION_RESUMPTION: %w", err)
+				}
+				cfg.DisableSessionResumption = disabled
+			}
+			return nil
+		},
 	}
 
 	for envVar, apply := range envMap {
@@ -387,9 +1168,249 @@ func (c *ServerConfig) Validate() error {
 		return fmt.Errorf("ping_interval must be positive")
 	}
 
+	if c.MaxParallelOps <= 0 {
+		return fmt.Errorf("max_parallel_ops must be positive")
+	}
+
+	if c.MaxDownloadSize < 0 {
+		return fmt.Errorf("max_download_size must not be negative")
+	}
+
+	if c.MaxResponseSize < 0 {
+		return fmt.Errorf("max_response_size must not be negative")
+	}
+
+	if c.PasteConfirmSize < 0 {
+		return fmt.Errorf("paste_confirm_size must not be negative")
+	}
+
+	if c.PtyScrollback < 0 {
+		return fmt.Errorf("pty_scrollback must not be negative")
+	}
+
+	if c.ListingCacheTTL < 0 {
+		return fmt.Errorf("listing_cache_ttl must not be negative")
+	}
+
+	if c.RekeyInterval < 0 {
+		return fmt.Errorf("rekey_interval must not be negative")
+	}
+
+	for _, w := range c.TransferWindows {
+		if _, err := ParseTransferWindow(w); err != nil {
+			return fmt.Errorf("transfer_windows: %w", err)
+		}
+	}
+
+	if c.EngagementEnd != "" {
+		if _, err := ParseEngagementEnd(c.EngagementEnd); err != nil {
+			return err
+		}
+	}
+
+	switch c.LogSink {
+	case "", logging.SinkSyslog, logging.SinkJournald:
+	default:
+		return fmt.Errorf("invalid log_sink %q: must be syslog or journald", c.LogSink)
+	}
+	if c.SyslogAddress != "" && c.LogSink != logging.SinkSyslog {
+		return fmt.Errorf("syslog_address needs log_sink syslog")
+	}
+
+	for i, cmd := range c.OnConnect {
+		if strings.TrimSpace(cmd) == "" || strings.ContainsAny(cmd, "\r\n") {
+			return fmt.Errorf("on_connect entry %d must be a single non-empty line", i+1)
+		}
+	}
+
+	if !protocol.IsOverwritePolicy(c.UploadOverwrite) {
+		return fmt.Errorf("invalid upload_overwrite %q: must be fail, overwrite or rename", c.UploadOverwrite)
+	}
+
+	for osName, templates := range c.CommandTemplates {
+		for name, tpl := range templates {
+			if strings.TrimSpace(tpl) == "" {
+				return fmt.Errorf("command template %s/%s must not be empty", osName, name)
+			}
+		}
+	}
+
+	if host, ok := strings.CutPrefix(c.Listen, "icmp://"); ok {
+		// Only the agent protocol can run over the ICMP tunnel
+		if host != "" && net.ParseIP(host).To4() == nil {
+			return fmt.Errorf("listen: the ICMP tunnel needs an IPv4 address, got %q", host)
+		}
+	} else if err := validateListenAddress(c.Listen); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	if c.SPAListen != "" {
+		if _, _, err := net.SplitHostPort(c.SPAListen); err != nil {
+			return fmt.Errorf("invalid spa_listen: %w", err)
+		}
+		if _, err := ParseSPAKey(c.SPAKey); err != nil {
+			return err
+		}
+		if network, _ := protocol.SplitAddress(c.Listen); network != "tcp" {
+			return fmt.Errorf("spa_listen only guards TCP listeners, not %s", c.Listen)
+		}
+		if c.SPAWindow <= 0 {
+			return fmt.Errorf("spa_window must be positive")
+		}
+	}
+
+	if err := c.ControlAPI.Validate(); err != nil {
+		return fmt.Errorf("control_api: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, p := range c.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profiles[%d]: name is required", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate profile name %q", p.Name)
+		}
+		seen[p.Name] = true
+		if len(p.ServerNames) == 0 {
+			return fmt.Errorf("profile %s: server_names is required", p.Name)
+		}
+		if (p.CertFile == "") != (p.KeyFile == "") {
+			return fmt.Errorf("profile %s: cert_file and key_file must be set together", p.Name)
+		}
+	}
+
+	if err := c.Certificate.Validate(); err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+
 	return nil
 }
 
+// Validate validates the control API configuration.
+func (c *ControlAPIConfig) Validate() error {
+	if c.Listen == "" {
+		return nil
+	}
+	if err := validateListenAddress(c.Listen); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if c.Token == "" && c.HtpasswdFile == "" && c.OIDC.Issuer == "" {
+		return fmt.Errorf("at least one of token, htpasswd_file or oidc.issuer is required")
+	}
+	if c.OIDC.Issuer != "" && c.OIDC.Audience == "" {
+		return fmt.Errorf("oidc.audience is required with oidc.issuer")
+	}
+	for name, role := range c.Roles {
+		if !isValidRole(role) {
+			return fmt.Errorf("invalid role %q for operator %s", role, name)
+		}
+	}
+	if c.DefaultRole != "" && !isValidRole(c.DefaultRole) {
+		return fmt.Errorf("invalid default_role %q", c.DefaultRole)
+	}
+	for name, policy := range c.Policies {
+		for _, capability := range policy.Deny {
+			if !isValidCapability(capability) {
+				return fmt.Errorf("invalid capability %q in policy for operator %s", capability, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateListenAddress checks a "host:port" or "unix:///path" address.
+// Empty addresses are valid and mean "not configured".
+func validateListenAddress(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		if path == "" {
+			return fmt.Errorf("unix socket path is required")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	return nil
+}
+
+func isValidRole(role string) bool {
+	return role == "admin" || role == "read-only"
+}
+
+func isValidCapability(capability string) bool {
+	switch capability {
+	case "exec", "forward", "socks":
+		return true
+	}
+	return false
+}
+
+// SplitList parses a comma-separated list (tags, ALPN protocols), trimming blanks.
+func SplitList(v string) []string {
+	var tags []string
+	for _, tag := range strings.Split(v, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// TransferWindow is a daily period given as offsets from local midnight. A
+// window whose End is before its Start runs past midnight.
+type TransferWindow struct {
+	Start, End time.Duration
+}
+
+// ParseTransferWindow parses a window such as "01:00-05:00" or "22:30-02:00".
+func ParseTransferWindow(v string) (TransferWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(v), "-")
+	if !ok {
+		return TransferWindow{}, fmt.Errorf("invalid window %q: want HH:MM-HH:MM", v)
+	}
+	start, err := ParseClock(from)
+	if err != nil {
+		return TransferWindow{}, fmt.Errorf("invalid window %q: %w", v, err)
+	}
+	end, err := ParseClock(to)
+	if err != nil {
+		return TransferWindow{}, fmt.Errorf("invalid window %q: %w", v, err)
+	}
+	if start == end {
+		return TransferWindow{}, fmt.Errorf("invalid window %q: start and end are equal", v)
+	}
+	return TransferWindow{Start: start, End: end}, nil
+}
+
+// ParseClock parses a time of day such as "02:00" into its offset from
+// midnight.
+func ParseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: want HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseEngagementEnd parses an engagement end in RFC 3339 form, where the
+// seconds may be left out: "2025-10-31T18:00Z" or "2025-10-31T18:00:00+01:00".
+func ParseEngagementEnd(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid engagement_end %q: want a time such as 2025-10-31T18:00Z", v)
+}
+
 // Validate validates the client configuration.
 func (c *ClientConfig) Validate() error {
 	if c.Target == "" {
@@ -437,5 +1458,162 @@ func (c *ClientConfig) Validate() error {
 		return fmt.Errorf("invalid shared_secret length: got %d characters, expected 64 (32 bytes hex-encoded)", len(c.SharedSecret))
 	}
 
+	if c.SourceIP != "" && net.ParseIP(c.SourceIP) == nil {
+		return fmt.Errorf("invalid source_ip: %s", c.SourceIP)
+	}
+
+	for _, tag := range c.Tags {
+		if !isValidTag(tag) {
+			return fmt.Errorf("invalid tag %q: only letters, digits, '_', '.' and '-' are allowed", tag)
+		}
+	}
+
+	if c.Nice < 0 || c.Nice > 19 {
+		return fmt.Errorf("nice must be between 0 and 19")
+	}
+
+	if c.MemoryLimit < 0 {
+		return fmt.Errorf("memory_limit must not be negative")
+	}
+
+	if c.BandwidthLimit < 0 {
+		return fmt.Errorf("bandwidth_limit must not be negative")
+	}
+
+	if c.MaxTransferSize < 0 {
+		return fmt.Errorf("max_transfer_size must not be negative")
+	}
+
+	if c.SSHJump != "" {
+		if _, _, err := ParseSSHJump(c.SSHJump); err != nil {
+			return err
+		}
+		if strings.HasPrefix(c.Target, "icmp://") {
+			return fmt.Errorf("ssh_jump cannot be used with an icmp:// target")
+		}
+	} else if c.SSHKey != "" || c.SSHPassword != "" || c.SSHHostKey != "" {
+		return fmt.Errorf("ssh_key, ssh_password and ssh_host_key need ssh_jump")
+	}
+
+	if c.Proxy != "" && c.Proxy != ProxyNone {
+		if _, err := ParseProxyURL(c.Proxy); err != nil {
+			return err
+		}
+	}
+
+	if c.Knock != "" {
+		knocks, err := ParseKnockSequence(c.Knock)
+		if err != nil {
+			return err
+		}
+		if network, _ := protocol.SplitAddress(c.Target); network != "tcp" || c.SSHJump != "" {
+			return fmt.Errorf("knock needs a direct TCP target: knocks are sent from this host")
+		}
+		for _, k := range knocks {
+			if k.Proto != KnockSPA {
+				continue
+			}
+			if _, err := ParseSPAKey(c.SPAKey); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
 	return nil
 }
+
+// Protocols of a knock sequence entry.
+const (
+	KnockTCP = "tcp" // Connection attempt
+	KnockUDP = "udp" // Empty datagram
+	KnockSPA = "spa" // Single-packet authorization datagram
+)
+
+// Knock is one entry of a knock sequence.
+type Knock struct {
+	Proto string // KnockTCP, KnockUDP or KnockSPA
+	Port  int
+}
+
+// ParseKnockSequence parses a comma-separated knock sequence such as
+// "tcp:7000,udp:8000,spa:62201".
+func ParseKnockSequence(v string) ([]Knock, error) {
+	var knocks []Knock
+	for _, entry := range SplitList(v) {
+		proto, port, _ := strings.Cut(entry, ":")
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid knock %q: want tcp:<port>, udp:<port> or spa:<port>", entry)
+		}
+		switch proto = strings.ToLower(proto); proto {
+		case KnockTCP, KnockUDP, KnockSPA:
+		default:
+			return nil, fmt.Errorf("invalid knock %q: want tcp:<port>, udp:<port> or spa:<port>", entry)
+		}
+		knocks = append(knocks, Knock{Proto: proto, Port: n})
+	}
+	if len(knocks) == 0 {
+		return nil, fmt.Errorf("invalid knock %q: empty sequence", v)
+	}
+	return knocks, nil
+}
+
+// ParseSPAKey decodes an SPA key of 64 hex characters (32 bytes).
+func ParseSPAKey(v string) ([]byte, error) {
+	key, err := hex.DecodeString(v)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid spa_key: expected 64 hex characters (32 bytes)")
+	}
+	return key, nil
+}
+
+// ProxyNone is the proxy setting that disables proxy detection.
+const ProxyNone = "none"
+
+// ParseProxyURL parses a proxy given as "http://host:port",
+// "socks5://host:port" (either with optional user:password@) or plain
+// "host:port", which means an HTTP proxy.
+func ParseProxyURL(v string) (*url.URL, error) {
+	if !strings.Contains(v, "://") {
+		v = "http://" + v
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", v, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("invalid proxy %q: only http:// and socks5:// proxies are supported", v)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("invalid proxy %q: a port is required", v)
+	}
+	return u, nil
+}
+
+// ParseSSHJump splits an SSH jump host "user@host[:port]" into the user and
+// host:port, with port 22 by default.
+func ParseSSHJump(v string) (user, addr string, err error) {
+	// The user may contain @ itself, e.g. a domain account
+	i := strings.LastIndex(v, "@")
+	user, host := v[:max(i, 0)], v[i+1:]
+	if i < 0 || user == "" || host == "" {
+		return "", "", fmt.Errorf("invalid ssh_jump %q: want user@host[:port]", v)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return user, host, nil
+}
+
+func isValidTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
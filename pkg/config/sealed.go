@@ -0,0 +1,87 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Sealed client configurations are AES-256-GCM encrypted JSON with a key
+// derived from a build-time passphrase. Both end up in the gotsr binary, so
+// sealing keeps the listener address and shared secret out of `strings`
+// output but does not stop anyone willing to reverse the binary.
+const (
+	sealSaltSize   = 16
+	sealIterations = 100000
+)
+
+// SealClientConfig encrypts cfg with passphrase and returns a URL-safe
+// base64 blob suitable for -ldflags "-X main.sealedConfig=...".
+func SealClientConfig(cfg *ClientConfig, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errors.New("seal passphrase is required")
+	}
+	plaintext, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := sealCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	blob := append(salt, nonce...)
+	blob = aead.Seal(blob, nonce, plaintext, nil)
+	return base64.RawURLEncoding.EncodeToString(blob), nil
+}
+
+// OpenClientConfig decrypts a blob made by SealClientConfig. Fields missing
+// from the sealed JSON keep their defaults.
+func OpenClientConfig(blob, passphrase string) (*ClientConfig, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(blob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed config: %w", err)
+	}
+	if len(raw) < sealSaltSize+12 {
+		return nil, errors.New("invalid sealed config: too short")
+	}
+	aead, err := sealCipher(passphrase, raw[:sealSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	nonce := raw[sealSaltSize : sealSaltSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, raw[sealSaltSize+aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt sealed config: wrong passphrase or corrupted blob")
+	}
+	cfg := DefaultClientConfig()
+	if err := json.Unmarshal(plaintext, cfg); err != nil {
+		return nil, fmt.Errorf("invalid sealed config: %w", err)
+	}
+	return cfg, nil
+}
+
+func sealCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, sealIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
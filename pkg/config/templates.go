@@ -0,0 +1,47 @@
+package config
+
+// Names of the command templates used by listener-side helpers.
+const (
+	TemplateListDir = "list-dir" // List a directory: {path}
+	TemplateWhoAmI  = "whoami"   // Print the current user and groups
+	TemplateSudo    = "sudo"     // Run the whoami check through sudo without prompting
+)
+
+// DefaultTemplateOS is the CommandTemplates key used when a client's OS has
+// no dedicated entry.
+const DefaultTemplateOS = "default"
+
+// DefaultCommandTemplates returns the built-in per-OS command templates.
+// Placeholders such as {path} are substituted and quoted for the target shell
+// by the listener.
+func DefaultCommandTemplates() map[string]map[string]string {
+	return map[string]map[string]string{
+		DefaultTemplateOS: {
+			TemplateListDir: "ls -la {path}",
+			TemplateWhoAmI:  "id",
+			TemplateSudo:    "sudo -n id",
+		},
+		"windows": {
+			TemplateListDir: "dir {path}",
+			TemplateWhoAmI:  "whoami & whoami /groups",
+		},
+	}
+}
+
+// CommandTemplate returns the named template for osName, falling back to the
+// "default" entry when the OS has no override for that name.
+func (c *ServerConfig) CommandTemplate(osName, name string) (string, bool) {
+	return LookupCommandTemplate(c.CommandTemplates, osName, name)
+}
+
+// LookupCommandTemplate resolves a template from a per-OS template map using
+// the same fallback rules as ServerConfig.CommandTemplate.
+func LookupCommandTemplate(templates map[string]map[string]string, osName, name string) (string, bool) {
+	if tpl, ok := templates[osName][name]; ok && tpl != "" {
+		return tpl, true
+	}
+	if tpl, ok := templates[DefaultTemplateOS][name]; ok && tpl != "" {
+		return tpl, true
+	}
+	return "", false
+}
@@ -0,0 +1,455 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// probeSize is the size of the file uploaded and downloaded again. Half of it
+// is random, which encodes to more than a chunk, so that chunking is
+// exercised too.
+const probeSize = 2 * protocol.ChunkSize
+
+// ClientOptions configures CheckClient.
+type ClientOptions struct {
+	// SharedSecret is the secret the listener required, if any. The client
+	// got past authentication if it is connected at all.
+	SharedSecret string
+	// RemoteDir is a writable directory on the client for the files of the
+	// transfer checks. It defaults to /tmp, or C:\Windows\Temp on Windows.
+	RemoteDir string
+	// EchoIP is where the tunnel checks open their echo endpoint, an
+	// address the client can reach. It defaults to the listener address
+	// the client connected to, or 127.0.0.1.
+	EchoIP string
+	// Timeout bounds each request; zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// clientCheck is the state of one CheckClient run.
+type clientCheck struct {
+	l     *server.Listener
+	addr  string
+	meta  server.ClientMetadata
+	opts  ClientOptions
+	sep   string // Path separator of the client's OS
+	dir   string // Directory the probe file is uploaded to
+	file  string // Path of the probe file
+	probe []byte // Contents of the probe file
+}
+
+// CheckClient checks the client at clientAddr, which must have identified
+// itself to l, against the protocol: authentication, IDENT, shell commands,
+// SYSINFO, uploads and downloads, PEEK, LIST, MKDIR and REMOVE, a PTY
+// shell, a port forward and a SOCKS proxy. Features the client did not
+// announce are skipped. The checks run one after the other and leave
+// nothing behind on the client when they pass.
+func CheckClient(l *server.Listener, clientAddr string, opts ClientOptions) []Result {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+	c := &clientCheck{l: l, addr: clientAddr, meta: meta, opts: opts, sep: "/"}
+	if meta.OS == "windows" {
+		c.sep = `\`
+	}
+	if c.opts.RemoteDir == "" {
+		c.opts.RemoteDir = "/tmp"
+		if meta.OS == "windows" {
+			c.opts.RemoteDir = `C:\Windows\Temp`
+		}
+	}
+	if c.opts.EchoIP == "" {
+		c.opts.EchoIP = meta.ListenerIP
+		if c.opts.EchoIP == "" {
+			c.opts.EchoIP = "127.0.0.1"
+		}
+	}
+
+	results := []Result{c.auth(), c.ident()}
+	results = append(results, c.run(protocol.CapExec, "exec", c.exec))
+	results = append(results, c.run(protocol.CapSysinfo, "sysinfo", c.sysinfo))
+	results = append(results, c.run(protocol.CapSync, "mkdir", c.mkdir))
+
+	upload := c.run(protocol.CapTransfer, "upload", c.upload)
+	results = append(results, upload)
+	needsFile := func(capability, feature string, fn func() (string, error)) Result {
+		if upload.Status != Pass {
+			return skip(feature, "needs upload")
+		}
+		return c.run(capability, feature, fn)
+	}
+	results = append(results, needsFile(protocol.CapTransfer, "download", c.download))
+	results = append(results, needsFile(protocol.CapPeek, "peek", c.peek))
+	results = append(results, needsFile(protocol.CapList, "list", c.list))
+	results = append(results, c.run(protocol.CapSync, "remove", c.remove))
+
+	// A client left in PTY mode ignores everything but PTY frames, so the
+	// PTY check comes after those that wait for a command response
+	results = append(results, c.run(protocol.CapPTY, "pty", c.pty))
+	results = append(results, c.run(protocol.CapForward, "forward", c.forward))
+	results = append(results, c.run(protocol.CapSocks, "socks", c.socks))
+	return results
+}
+
+// run checks feature if the client supports capability.
+func (c *clientCheck) run(capability, feature string, fn func() (string, error)) Result {
+	if !c.meta.Supports(capability) {
+		return skip(feature, "not announced")
+	}
+	if capability == protocol.CapList && !c.meta.Announces(capability) {
+		return skip(feature, "not announced")
+	}
+	return check(feature, fn)
+}
+
+func (c *clientCheck) auth() Result {
+	if c.opts.SharedSecret == "" {
+		return skip("auth", "no shared secret set")
+	}
+	return Result{Feature: "auth", Status: Pass, Detail: "authenticated with the shared secret"}
+}
+
+func (c *clientCheck) ident() Result {
+	return check("ident", func() (string, error) {
+		if c.meta.Identifier == "" {
+			return "", errors.New("no IDENT received")
+		}
+		if c.meta.OS == "" {
+			return "", fmt.Errorf("IDENT %s does not report os=", c.meta.Identifier)
+		}
+		if c.meta.Capabilities == nil {
+			return fmt.Sprintf("id %s, os %s, no caps= (every feature is assumed)", c.meta.Identifier, c.meta.OS), nil
+		}
+		return fmt.Sprintf("id %s, os %s, caps %s", c.meta.Identifier, c.meta.OS, strings.Join(c.meta.Capabilities, ",")), nil
+	})
+}
+
+// query sends cmd and returns the response without its end marker.
+func (c *clientCheck) query(cmd string) (string, error) {
+	if err := c.l.SendCommand(c.addr, cmd); err != nil {
+		return "", err
+	}
+	resp, err := c.l.GetResponse(c.addr, c.opts.Timeout)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), nil
+}
+
+// expectOK sends cmd and fails unless the response starts with "OK". It
+// returns the lines after it.
+func (c *clientCheck) expectOK(cmd string) ([]string, error) {
+	resp, err := c.query(cmd)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(resp, "\n")
+	if strings.TrimSpace(lines[0]) != "OK" {
+		return nil, fmt.Errorf("%s: expected OK, got %q", strings.Fields(cmd)[0], resp)
+	}
+	return lines[1:], nil
+}
+
+func (c *clientCheck) exec() (string, error) {
+	want := marker()
+	resp, err := c.query("echo " + want)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(resp, want) {
+		return "", fmt.Errorf("echo returned %q", resp)
+	}
+	return "", nil
+}
+
+func (c *clientCheck) sysinfo() (string, error) {
+	resp, err := c.query(protocol.CmdSysinfo)
+	if err != nil {
+		return "", err
+	}
+	info, err := server.ParseSysinfo(resp)
+	if err != nil {
+		return "", fmt.Errorf("SYSINFO: expected OK, got %q", err)
+	}
+	return fmt.Sprintf("%d values", len(info)), nil
+}
+
+func (c *clientCheck) mkdir() (string, error) {
+	dir := c.opts.RemoteDir + c.sep + marker()
+	if _, err := c.expectOK(protocol.CmdMkdir + " " + dir); err != nil {
+		return "", err
+	}
+	c.dir = dir
+	return dir, nil
+}
+
+func (c *clientCheck) upload() (string, error) {
+	dir := c.dir
+	if dir == "" {
+		dir = c.opts.RemoteDir
+	}
+	path := dir + c.sep + marker() + ".bin"
+	probe := make([]byte, probeSize)
+	rand.Read(probe[:len(probe)/2]) // Half incompressible, half zeros
+	if err := c.meta.CheckTransfer(int64(len(probe))); err != nil {
+		return "", err
+	}
+
+	codec := c.meta.Codec()
+	var option string
+	if codec != compression.CodecGzip {
+		option = protocol.OptCodec + "=" + codec + " "
+	}
+	encoded, _, err := compression.EncodeTransfer(codec, probe)
+	if err != nil {
+		return "", err
+	}
+	id := protocol.NewTransferID()
+	if _, err := c.expectOK(fmt.Sprintf("%s %s %s%s %d", protocol.CmdStartUpload, id, option, path, len(encoded))); err != nil {
+		return "", err
+	}
+	chunks := 0
+	for i := 0; i < len(encoded); i += protocol.ChunkSize {
+		end := min(i+protocol.ChunkSize, len(encoded))
+		if _, err := c.expectOK(fmt.Sprintf("%s %s %s", protocol.CmdUploadChunk, id, encoded[i:end])); err != nil {
+			return "", err
+		}
+		chunks++
+	}
+	lines, err := c.expectOK(fmt.Sprintf("%s %s %s", protocol.CmdEndUpload, id, path))
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != strconv.Itoa(len(probe)) {
+		return "", fmt.Errorf("END_UPLOAD: expected OK and %d bytes written, got %q", len(probe), lines)
+	}
+	c.file, c.probe = path, probe
+	return fmt.Sprintf("%d bytes in %d chunks, codec %s", len(probe), chunks, codec), nil
+}
+
+func (c *clientCheck) download() (string, error) {
+	codec := c.meta.Codec()
+	args := c.file
+	if codec != compression.CodecGzip {
+		args = protocol.OptCodec + "=" + codec + " " + args
+	}
+	resp, err := c.query(protocol.CmdDownload + " " + args)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resp, protocol.DataPrefix) {
+		return "", fmt.Errorf("DOWNLOAD: expected %s, got %.80q", protocol.DataPrefix, resp)
+	}
+	data, err := compression.Decode(codec, strings.TrimPrefix(resp, protocol.DataPrefix))
+	if err != nil {
+		return "", fmt.Errorf("DOWNLOAD: %w", err)
+	}
+	if !bytes.Equal(data, c.probe) {
+		return "", fmt.Errorf("downloaded %d bytes that differ from the %d uploaded", len(data), len(c.probe))
+	}
+	return fmt.Sprintf("%d bytes", len(data)), nil
+}
+
+func (c *clientCheck) peek() (string, error) {
+	const n = 64
+	lines, err := c.expectOK(fmt.Sprintf("%s %d %s", protocol.CmdPeek, n, c.file))
+	if err != nil {
+		return "", err
+	}
+	if len(lines) < 2 {
+		return "", fmt.Errorf("PEEK: expected the size and the data, got %q", lines)
+	}
+	if size, err := strconv.Atoi(strings.TrimSpace(lines[0])); err != nil || size != len(c.probe) {
+		return "", fmt.Errorf("PEEK: expected size %d, got %q", len(c.probe), lines[0])
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || !bytes.Equal(data, c.probe[:n]) {
+		return "", fmt.Errorf("PEEK: the first %d bytes differ from the file", n)
+	}
+	return "", nil
+}
+
+func (c *clientCheck) list() (string, error) {
+	dir, name := c.file[:strings.LastIndex(c.file, c.sep)], c.file[strings.LastIndex(c.file, c.sep)+1:]
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+	entries, err := c.l.ListDir(ctx, c.addr, dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.Name == name && !e.IsDir {
+			return fmt.Sprintf("%d entries", len(entries)), nil
+		}
+	}
+	return "", fmt.Errorf("LIST %s does not show the uploaded %s", dir, name)
+}
+
+func (c *clientCheck) remove() (string, error) {
+	if c.file != "" {
+		if _, err := c.expectOK(protocol.CmdRemove + " " + c.file); err != nil {
+			return "", err
+		}
+	}
+	if c.dir == "" {
+		return "", nil
+	}
+	if _, err := c.expectOK(protocol.CmdRemove + " " + c.dir); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+func (c *clientCheck) pty() (string, error) {
+	resp, err := c.query(protocol.CmdPtyMode)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(resp, "OK") {
+		return "", fmt.Errorf("PTY_MODE: expected OK, got %q", resp)
+	}
+	output, err := c.l.EnterPtyMode(c.addr)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if c.l.IsInPtyMode(c.addr) {
+			_ = c.l.SendCommand(c.addr, protocol.CmdPtyExit)
+			c.l.ExitPtyMode(c.addr)
+		}
+	}()
+
+	want := marker()
+	if err := c.typeInto("echo " + want + "\n"); err != nil {
+		return "", err
+	}
+	deadline := time.After(c.opts.Timeout)
+	var seen []byte
+	for !bytes.Contains(seen, []byte(want)) {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				return "", errors.New("the shell ended before echoing the input")
+			}
+			seen = append(seen, data...)
+		case <-deadline:
+			return "", fmt.Errorf("no PTY_DATA with the input within %v", c.opts.Timeout)
+		}
+	}
+
+	// A shell that exits on its own is reported with PTY_EXIT, which makes
+	// the listener close the output channel
+	if err := c.typeInto("exit\n"); err != nil {
+		return "", err
+	}
+	for {
+		select {
+		case _, ok := <-output:
+			if !ok {
+				return "", nil
+			}
+		case <-deadline:
+			return "", fmt.Errorf("no PTY_EXIT after the shell exited within %v", c.opts.Timeout)
+		}
+	}
+}
+
+// typeInto sends input to the client's PTY shell.
+func (c *clientCheck) typeInto(input string) error {
+	encoded, _, err := compression.EncodeTransfer(compression.CodecGzip, []byte(input))
+	if err != nil {
+		return err
+	}
+	return c.l.SendCommand(c.addr, protocol.CmdPtyData+" "+encoded)
+}
+
+// echoEndpoint opens a TCP endpoint on the echo address that echoes its
+// first connection.
+func (c *clientCheck) echoEndpoint() (net.Listener, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(c.opts.EchoIP, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open echo endpoint: %w", err)
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	return ln, nil
+}
+
+// send sends a tunnel frame to the client.
+func (c *clientCheck) send(msg string) {
+	_ = c.l.SendCommand(c.addr, msg)
+}
+
+func (c *clientCheck) forward() (string, error) {
+	echo, err := c.echoEndpoint()
+	if err != nil {
+		return "", err
+	}
+	defer echo.Close()
+
+	const id = "conformance-forward"
+	fm := c.l.GetForwardManager()
+	if err := fm.StartForward(id, "0", echo.Addr().String(), c.send); err != nil {
+		return "", err
+	}
+	defer fm.StopForward(id)
+	var local string
+	for _, info := range fm.ListForwards() {
+		if info.ID == id {
+			local = info.LocalAddr
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", local, c.opts.Timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	want := []byte(marker())
+	if _, err := conn.Write(want); err != nil {
+		return "", err
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return "", fmt.Errorf("no echo through the forward: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return "", fmt.Errorf("the forward echoed %q instead of %q", got, want)
+	}
+	return "via " + echo.Addr().String(), nil
+}
+
+func (c *clientCheck) socks() (string, error) {
+	const id = "conformance-socks"
+	sm := c.l.GetSocksManager()
+	if err := sm.StartSocks(id, "0", c.meta.Announces(protocol.CapSocksErr), c.send); err != nil {
+		return "", err
+	}
+	defer sm.StopSocks(id)
+	result, err := sm.SelfTest(id, c.opts.EchoIP)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
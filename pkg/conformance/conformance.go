@@ -0,0 +1,86 @@
+// Package conformance checks another implementation of the gots protocol
+// against the documented behaviour, one feature at a time. CheckClient
+// drives a connected client the way gotsl does; CheckListener plays a client
+// against a listener. Both report a Result per feature, so an implant or
+// listener written in another language can tell which parts of the protocol
+// it gets right.
+package conformance
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of one feature check.
+type Status string
+
+const (
+	Pass Status = "PASS"
+	Fail Status = "FAIL"
+	Skip Status = "SKIP" // Not announced, or depends on a feature that failed
+)
+
+// DefaultTimeout bounds each request of a check.
+const DefaultTimeout = 30 * time.Second
+
+// Result is the outcome of checking one feature.
+type Result struct {
+	Feature string        `json:"feature"`
+	Status  Status        `json:"status"`
+	Detail  string        `json:"detail,omitempty"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// Passed reports whether no check in results failed.
+func Passed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTable writes results as an aligned table with a summary line.
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	counts := make(map[Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Status, r.Feature, r.Elapsed.Round(time.Millisecond), r.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d passed, %d failed, %d skipped\n", counts[Pass], counts[Fail], counts[Skip])
+	return err
+}
+
+// check runs fn as the check of feature and times it. fn returns the
+// detail for the report, and an error if the feature does not conform.
+func check(feature string, fn func() (string, error)) Result {
+	start := time.Now()
+	detail, err := fn()
+	r := Result{Feature: feature, Status: Pass, Detail: detail, Elapsed: time.Since(start)}
+	if err != nil {
+		r.Status, r.Detail = Fail, err.Error()
+	}
+	return r
+}
+
+// skip reports feature as not checked.
+func skip(feature, reason string) Result {
+	return Result{Feature: feature, Status: Skip, Detail: reason}
+}
+
+// marker returns a random token to look for in a reply, so that stale
+// output cannot pass a check by accident.
+func marker() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "gots-conformance-" + hex.EncodeToString(b)
+}
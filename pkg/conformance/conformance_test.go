@@ -0,0 +1,77 @@
+package conformance_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/conformance"
+	"github.com/frjcomp/gots/pkg/gotstest"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// statuses maps each feature to its status.
+func statuses(results []conformance.Result) map[string]conformance.Status {
+	m := make(map[string]conformance.Status, len(results))
+	for _, r := range results {
+		m[r.Feature] = r.Status
+	}
+	return m
+}
+
+func TestCheckClientSkipsAndFails(t *testing.T) {
+	l, ln := gotstest.StartServer(t, "")
+	fc := &gotstest.FakeClient{
+		Metadata: map[string]string{"os": "linux", "caps": protocol.CapExec + "," + protocol.CapSysinfo},
+		Handler: func(command string) string {
+			if strings.HasPrefix(command, "echo ") {
+				return strings.TrimPrefix(command, "echo ")
+			}
+			return "unknown command"
+		},
+	}
+	if err := fc.Connect(ln, ""); err != nil {
+		t.Fatal(err)
+	}
+	gotstest.WaitForClient(t, l, fc.Addr(), 5*time.Second)
+
+	results := conformance.CheckClient(l, fc.Addr(), conformance.ClientOptions{Timeout: 2 * time.Second})
+	got := statuses(results)
+	want := map[string]conformance.Status{
+		"auth":     conformance.Skip,
+		"ident":    conformance.Pass,
+		"exec":     conformance.Pass,
+		"sysinfo":  conformance.Fail,
+		"upload":   conformance.Skip,
+		"download": conformance.Skip,
+		"pty":      conformance.Skip,
+		"socks":    conformance.Skip,
+	}
+	for feature, status := range want {
+		if got[feature] != status {
+			t.Errorf("expected %s to be %s, got %s", feature, status, got[feature])
+		}
+	}
+	if conformance.Passed(results) {
+		t.Error("expected the failed SYSINFO to fail the run")
+	}
+}
+
+func TestCheckListener(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the first keepalive")
+	}
+	_, ln := gotstest.StartServer(t, "s3cret")
+	results := conformance.CheckListener(ln.Dial, conformance.ListenerOptions{SharedSecret: "s3cret", Timeout: 5 * time.Second})
+	for _, r := range results {
+		if r.Status != conformance.Pass {
+			t.Errorf("expected %s to pass, got %s: %s", r.Feature, r.Status, r.Detail)
+		}
+	}
+
+	results = conformance.CheckListener(ln.Dial, conformance.ListenerOptions{SharedSecret: "wrong", Timeout: 5 * time.Second})
+	got := statuses(results)
+	if got["auth"] != conformance.Fail || got["keepalive"] != conformance.Skip {
+		t.Errorf("expected auth with the wrong secret to fail, got %v", got)
+	}
+}
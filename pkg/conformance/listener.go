@@ -0,0 +1,177 @@
+package conformance
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// ListenerOptions configures CheckListener.
+type ListenerOptions struct {
+	// SharedSecret is the listener's secret; without it authentication is
+	// not checked.
+	SharedSecret string
+	// Timeout bounds each step; zero means DefaultTimeout. Waiting for the
+	// first PING may take up to protocol.MinPingInterval on top.
+	Timeout time.Duration
+}
+
+// listenerCheck is the state of one CheckListener run.
+type listenerCheck struct {
+	dial   func() (net.Conn, error)
+	opts   ListenerOptions
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// CheckListener checks the listener that dial connects to against the
+// client's side of the protocol: it refuses a wrong shared secret and
+// accepts the right one, takes an IDENT asking for the shortest keepalive
+// interval, and sends PING, which is answered with PONG. Commands the
+// listener sends meanwhile get empty output. Transfers, PTY shells and
+// tunnels are started by the listener's operator, so they are only
+// checked from the other side, by CheckClient.
+func CheckListener(dial func() (net.Conn, error), opts ListenerOptions) []Result {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	c := &listenerCheck{dial: dial, opts: opts}
+	defer func() {
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}()
+
+	var results []Result
+	if opts.SharedSecret == "" {
+		results = append(results, skip("auth-reject", "no shared secret set"), skip("auth", "no shared secret set"))
+	} else {
+		results = append(results, check("auth-reject", c.authReject))
+	}
+
+	connect := check("connect", c.connect)
+	if connect.Status != Pass {
+		return append(results, connect)
+	}
+	if opts.SharedSecret != "" {
+		auth := check("auth", c.auth)
+		results = append(results, auth)
+		if auth.Status != Pass {
+			return append(results, skip("ident", "needs auth"), skip("keepalive", "needs auth"))
+		}
+	}
+
+	ident := check("ident", c.ident)
+	results = append(results, ident)
+	if ident.Status != Pass {
+		return append(results, skip("keepalive", "needs ident"))
+	}
+	return append(results, check("keepalive", c.keepalive))
+}
+
+// readLine reads one line within the timeout, without its line ending.
+func readLine(conn net.Conn, r *bufio.Reader, timeout time.Duration) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (c *listenerCheck) authReject() (string, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	if _, err := fmt.Fprintf(conn, "%s %s-wrong\n", protocol.CmdAuth, c.opts.SharedSecret); err != nil {
+		return "", err
+	}
+	line, err := readLine(conn, bufio.NewReader(conn), c.opts.Timeout)
+	switch {
+	case line == protocol.CmdAuthFailed:
+		return "", nil
+	case line == protocol.CmdAuthOk:
+		return "", errors.New("a wrong shared secret was accepted")
+	case err != nil && line == "":
+		return "closed without " + protocol.CmdAuthFailed, nil
+	default:
+		return "", fmt.Errorf("expected %s, got %q", protocol.CmdAuthFailed, line)
+	}
+}
+
+func (c *listenerCheck) connect() (string, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return "", err
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	return conn.RemoteAddr().String(), nil
+}
+
+func (c *listenerCheck) auth() (string, error) {
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\n", protocol.CmdAuth, c.opts.SharedSecret); err != nil {
+		return "", err
+	}
+	line, err := readLine(c.conn, c.reader, c.opts.Timeout)
+	if err != nil {
+		return "", fmt.Errorf("no reply to %s: %w", protocol.CmdAuth, err)
+	}
+	if line != protocol.CmdAuthOk {
+		return "", fmt.Errorf("expected %s, got %q", protocol.CmdAuthOk, line)
+	}
+	return "", nil
+}
+
+func (c *listenerCheck) ident() (string, error) {
+	b := make([]byte, 4)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	_, err := fmt.Fprintf(c.conn, "%s %s os=%s host=gots-conformance caps=%s ping=%d\n",
+		protocol.CmdIdent, id, runtime.GOOS, protocol.CapExec, protocol.MinPingInterval)
+	if err != nil {
+		return "", err
+	}
+	return "id " + id, nil
+}
+
+func (c *listenerCheck) keepalive() (string, error) {
+	wait := c.opts.Timeout + protocol.MinPingInterval*time.Second
+	deadline := time.Now().Add(wait)
+	answered := 0
+	for {
+		line, err := readLine(c.conn, c.reader, time.Until(deadline))
+		if err != nil {
+			return "", fmt.Errorf("no %s within %v: %w", protocol.CmdPing, wait, err)
+		}
+		reply := protocol.EndOfOutputMarker
+		switch line {
+		case protocol.CmdPing:
+			reply = protocol.CmdPong + "\n" + protocol.EndOfOutputMarker
+		case protocol.CmdTerminate, protocol.CmdExit:
+			return "", fmt.Errorf("the listener ended the session with %s", line)
+		case "":
+			continue
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+		if _, err := fmt.Fprintf(c.conn, "%s\n", reply); err != nil {
+			return "", fmt.Errorf("failed to answer %q: %w", line, err)
+		}
+		if line == protocol.CmdPing {
+			if answered > 0 {
+				return fmt.Sprintf("answered %d other commands first", answered), nil
+			}
+			return "", nil
+		}
+		answered++
+	}
+}
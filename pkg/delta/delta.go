@@ -0,0 +1,281 @@
+// Package delta implements rsync-style delta transfers: the receiver sends
+// block checksums of the file it already has, and the sender answers with
+// the blocks it can reuse and the bytes that changed.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// MinBlockSize and MaxBlockSize bound the block size of a signature.
+	MinBlockSize = 512
+	MaxBlockSize = 1 << 20
+
+	strongLen = 16 // Truncated SHA-256 per block
+
+	opCopy    = 'C' // uvarint first block, uvarint block count
+	opLiteral = 'L' // uvarint length, bytes
+	opEnd     = 'E' // SHA-256 of the result
+)
+
+// ErrCorrupt is returned by Patch for a malformed delta, or one whose result
+// does not match the checksum the sender computed.
+var ErrCorrupt = errors.New("corrupt delta")
+
+// Block is the checksum pair of one block of the receiver's file.
+type Block struct {
+	Weak   uint32
+	Strong [strongLen]byte
+}
+
+// Signature describes the file a delta will be applied to.
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []Block
+}
+
+// BlockSize picks a block size for a file of size bytes: about its square
+// root, as rsync does, rounded up to a multiple of MinBlockSize.
+func BlockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size)))
+	bs = (bs + MinBlockSize - 1) / MinBlockSize * MinBlockSize
+	return min(max(bs, MinBlockSize), MaxBlockSize)
+}
+
+// NewSignature reads r and returns the checksums of its blocks.
+func NewSignature(r io.Reader, blockSize int) (*Signature, error) {
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return nil, fmt.Errorf("block size %d out of range", blockSize)
+	}
+	sig := &Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sig.Size += int64(n)
+			sig.Blocks = append(sig.Blocks, Block{Weak: weakSum(buf[:n]), Strong: strongSum(buf[:n])})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// MarshalBinary encodes the signature for the wire.
+func (s *Signature) MarshalBinary() ([]byte, error) {
+	out := binary.AppendUvarint(nil, uint64(s.BlockSize))
+	out = binary.AppendUvarint(out, uint64(s.Size))
+	for _, b := range s.Blocks {
+		out = binary.BigEndian.AppendUint32(out, b.Weak)
+		out = append(out, b.Strong[:]...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a signature from MarshalBinary.
+func (s *Signature) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	blockSize, err := binary.ReadUvarint(r)
+	if err != nil || blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return fmt.Errorf("%w: bad signature block size", ErrCorrupt)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil || size > math.MaxInt64 {
+		return fmt.Errorf("%w: bad signature size", ErrCorrupt)
+	}
+	n := (size + blockSize - 1) / blockSize
+	if uint64(r.Len()) != n*(4+strongLen) {
+		return fmt.Errorf("%w: signature has %d bytes of checksums for %d blocks", ErrCorrupt, r.Len(), n)
+	}
+	s.BlockSize, s.Size = int(blockSize), int64(size)
+	s.Blocks = make([]Block, n)
+	rest := data[len(data)-r.Len():]
+	for i := range s.Blocks {
+		s.Blocks[i].Weak = binary.BigEndian.Uint32(rest)
+		copy(s.Blocks[i].Strong[:], rest[4:4+strongLen])
+		rest = rest[4+strongLen:]
+	}
+	return nil
+}
+
+// Diff returns the delta that turns the file described by sig into data.
+// It also reports how many bytes of data are sent as literals.
+func Diff(sig *Signature, data []byte) (delta []byte, literal int) {
+	bs := sig.BlockSize
+	index := make(map[uint32][]int)
+	for i, b := range sig.Blocks {
+		// Only full blocks can match at an arbitrary offset
+		if int64(i+1)*int64(bs) <= sig.Size {
+			index[b.Weak] = append(index[b.Weak], i)
+		}
+	}
+
+	var out []byte
+	runStart, runLen := -1, 0
+	flushCopy := func() {
+		if runLen > 0 {
+			out = append(out, opCopy)
+			out = binary.AppendUvarint(out, uint64(runStart))
+			out = binary.AppendUvarint(out, uint64(runLen))
+		}
+		runStart, runLen = -1, 0
+	}
+	flushLiteral := func(b []byte) {
+		if len(b) > 0 {
+			flushCopy()
+			out = append(out, opLiteral)
+			out = binary.AppendUvarint(out, uint64(len(b)))
+			out = append(out, b...)
+			literal += len(b)
+		}
+	}
+
+	litStart, i := 0, 0
+	var roll rollingSum
+	if len(data) >= bs {
+		roll.init(data[:bs])
+	}
+	for i+bs <= len(data) {
+		match := -1
+		if candidates, ok := index[roll.sum()]; ok {
+			strong := strongSum(data[i : i+bs])
+			for _, c := range candidates {
+				if sig.Blocks[c].Strong == strong {
+					match = c
+					break
+				}
+			}
+		}
+		if match < 0 {
+			if i+bs < len(data) {
+				roll.roll(data[i], data[i+bs], bs)
+			}
+			i++
+			continue
+		}
+		flushLiteral(data[litStart:i])
+		if runLen == 0 || match != runStart+runLen {
+			flushCopy()
+			runStart = match
+		}
+		runLen++
+		i += bs
+		litStart = i
+		if i+bs <= len(data) {
+			roll.init(data[i : i+bs])
+		}
+	}
+	flushLiteral(data[litStart:])
+	flushCopy()
+
+	sum := sha256.Sum256(data)
+	out = append(out, opEnd)
+	out = append(out, sum[:]...)
+	return out, literal
+}
+
+// Patch applies a delta from Diff to basis, the file the signature was made
+// from, writing the result to out. It returns the size of the result.
+func Patch(basis io.ReaderAt, basisSize int64, blockSize int, delta io.Reader, out io.Writer) (int64, error) {
+	r := bufio.NewReader(delta)
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	var written int64
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return written, fmt.Errorf("%w: missing end marker", ErrCorrupt)
+		}
+		switch op {
+		case opCopy:
+			first, err1 := binary.ReadUvarint(r)
+			count, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || count == 0 || first > uint64(basisSize) || count > uint64(basisSize) {
+				return written, fmt.Errorf("%w: bad copy", ErrCorrupt)
+			}
+			off := int64(first) * int64(blockSize)
+			n := min(int64(count)*int64(blockSize), basisSize-off)
+			if off >= basisSize || n <= 0 {
+				return written, fmt.Errorf("%w: copy beyond the end of the file", ErrCorrupt)
+			}
+			copied, err := io.Copy(w, io.NewSectionReader(basis, off, n))
+			written += copied
+			if err != nil {
+				return written, err
+			}
+		case opLiteral:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > math.MaxInt64 {
+				return written, fmt.Errorf("%w: bad literal", ErrCorrupt)
+			}
+			copied, err := io.CopyN(w, r, int64(n))
+			written += copied
+			if err == io.EOF {
+				return written, fmt.Errorf("%w: truncated literal", ErrCorrupt)
+			}
+			if err != nil {
+				return written, err
+			}
+		case opEnd:
+			var want [sha256.Size]byte
+			if _, err := io.ReadFull(r, want[:]); err != nil {
+				return written, fmt.Errorf("%w: truncated checksum", ErrCorrupt)
+			}
+			if !bytes.Equal(h.Sum(nil), want[:]) {
+				return written, fmt.Errorf("%w: checksum mismatch, the file changed since its signature was taken", ErrCorrupt)
+			}
+			return written, nil
+		default:
+			return written, fmt.Errorf("%w: unknown operation %q", ErrCorrupt, op)
+		}
+	}
+}
+
+func strongSum(b []byte) [strongLen]byte {
+	sum := sha256.Sum256(b)
+	var s [strongLen]byte
+	copy(s[:], sum[:])
+	return s
+}
+
+func weakSum(b []byte) uint32 {
+	var r rollingSum
+	r.init(b)
+	return r.sum()
+}
+
+// rollingSum is the rsync weak checksum, which can slide along the data one
+// byte at a time.
+type rollingSum struct {
+	a, b uint32
+}
+
+func (r *rollingSum) init(block []byte) {
+	r.a, r.b = 0, 0
+	n := uint32(len(block))
+	for i, c := range block {
+		r.a += uint32(c)
+		r.b += (n - uint32(i)) * uint32(c)
+	}
+}
+
+func (r *rollingSum) roll(out, in byte, blockSize int) {
+	r.a = r.a - uint32(out) + uint32(in)
+	r.b = r.b - uint32(blockSize)*uint32(out) + r.a
+}
+
+func (r *rollingSum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
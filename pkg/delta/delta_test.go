@@ -0,0 +1,102 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func randomData(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func roundTrip(t *testing.T, basis, target []byte, blockSize int) (literal int) {
+	t.Helper()
+	sig, err := NewSignature(bytes.NewReader(basis), blockSize)
+	if err != nil {
+		t.Fatalf("NewSignature failed: %v", err)
+	}
+	wire, _ := sig.MarshalBinary()
+	var decoded Signature
+	if err := decoded.UnmarshalBinary(wire); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	d, literal := Diff(&decoded, target)
+	var out bytes.Buffer
+	n, err := Patch(bytes.NewReader(basis), int64(len(basis)), blockSize, bytes.NewReader(d), &out)
+	if err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	if n != int64(len(target)) || !bytes.Equal(out.Bytes(), target) {
+		t.Fatalf("patched result differs from the target (%d bytes, want %d)", n, len(target))
+	}
+	return literal
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	basis := randomData(1, 100_000)
+
+	// Unchanged: nothing is sent literally
+	if lit := roundTrip(t, basis, basis, 1024); lit > 1024 {
+		t.Errorf("unchanged file sent %d literal bytes", lit)
+	}
+
+	// A small edit in the middle and an insertion that shifts everything after it
+	edited := append([]byte(nil), basis...)
+	copy(edited[50_000:], "changed")
+	edited = append(edited[:20_000], append([]byte("inserted text"), edited[20_000:]...)...)
+	if lit := roundTrip(t, basis, edited, 1024); lit > 4*1024 {
+		t.Errorf("edited file sent %d literal bytes, expected only the changed blocks", lit)
+	}
+
+	// Truncated, appended, empty and unrelated targets
+	roundTrip(t, basis, basis[:33_333], 1024)
+	roundTrip(t, basis, append(basis, randomData(2, 5000)...), 1024)
+	roundTrip(t, basis, nil, 1024)
+	roundTrip(t, nil, basis[:3000], 512)
+	if lit := roundTrip(t, basis, randomData(3, 10_000), 1024); lit != 10_000 {
+		t.Errorf("unrelated file sent %d literal bytes, want all 10000", lit)
+	}
+}
+
+func TestPatchDetectsChangedBasis(t *testing.T) {
+	basis := randomData(4, 20_000)
+	sig, _ := NewSignature(bytes.NewReader(basis), 512)
+	d, _ := Diff(sig, basis)
+
+	changed := append([]byte(nil), basis...)
+	changed[100] ^= 0xff
+	_, err := Patch(bytes.NewReader(changed), int64(len(changed)), 512, bytes.NewReader(d), new(bytes.Buffer))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+
+	_, err = Patch(bytes.NewReader(basis), int64(len(basis)), 512, bytes.NewReader(d[:len(d)-40]), new(bytes.Buffer))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected a truncated delta to be rejected, got %v", err)
+	}
+}
+
+func TestUnmarshalSignatureRejectsGarbage(t *testing.T) {
+	sig, _ := NewSignature(bytes.NewReader(randomData(5, 5000)), 1024)
+	wire, _ := sig.MarshalBinary()
+	var s Signature
+	if err := s.UnmarshalBinary(wire[:len(wire)-1]); err == nil {
+		t.Error("expected a short signature to be rejected")
+	}
+	if err := s.UnmarshalBinary([]byte{1}); err == nil {
+		t.Error("expected a bad block size to be rejected")
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	for size, want := range map[int64]int{0: MinBlockSize, 100_000: 512, 10 << 20: 3584, 1 << 50: MaxBlockSize} {
+		if got := BlockSize(size); got != want {
+			t.Errorf("BlockSize(%d) = %d, want %d", size, got, want)
+		}
+	}
+}
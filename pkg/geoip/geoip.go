@@ -0,0 +1,125 @@
+// Package geoip enriches IP addresses with location and network owner data
+// from local MaxMind DB (MMDB) files, such as GeoLite2-City and GeoLite2-ASN.
+// Lookups never leave the machine.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Info is what the loaded databases know about an address. Fields are empty
+// when no database covers them.
+type Info struct {
+	CountryCode string `json:"country_code,omitempty"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	Org         string `json:"org,omitempty"` // Autonomous system organization
+}
+
+// Empty reports whether no database had data for the address.
+func (i Info) Empty() bool {
+	return i == Info{}
+}
+
+// String formats the info for display, e.g.
+// "DE, Frankfurt am Main, AS3320 Deutsche Telekom AG".
+func (i Info) String() string {
+	parts := make([]string, 0, 3)
+	if i.CountryCode != "" {
+		parts = append(parts, i.CountryCode)
+	} else if i.Country != "" {
+		parts = append(parts, i.Country)
+	}
+	if i.City != "" {
+		parts = append(parts, i.City)
+	}
+	if i.ASN != 0 {
+		as := fmt.Sprintf("AS%d", i.ASN)
+		if i.Org != "" {
+			as += " " + i.Org
+		}
+		parts = append(parts, as)
+	} else if i.Org != "" {
+		parts = append(parts, i.Org)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Reader looks addresses up in one or more MMDB files and merges the results.
+type Reader struct {
+	dbs []*mmdb
+}
+
+// Open loads the given MMDB files into memory.
+func Open(paths ...string) (*Reader, error) {
+	r := &Reader{}
+	for _, path := range paths {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %w", err)
+		}
+		db, err := parseMMDB(buf)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %s: %w", path, err)
+		}
+		r.dbs = append(r.dbs, db)
+	}
+	return r, nil
+}
+
+// Lookup returns what the databases know about ip. Earlier files win when
+// several provide the same field.
+func (r *Reader) Lookup(ip net.IP) Info {
+	var info Info
+	if r == nil || ip == nil {
+		return info
+	}
+	for _, db := range r.dbs {
+		v, err := db.lookup(ip)
+		if err != nil || v == nil {
+			continue
+		}
+		merge(&info, v)
+	}
+	return info
+}
+
+// merge fills empty fields of info from a City, Country or ASN record.
+func merge(info *Info, record any) {
+	country := field(record, "country")
+	if country == nil {
+		country = field(record, "registered_country")
+	}
+	if info.CountryCode == "" {
+		info.CountryCode, _ = field(country, "iso_code").(string)
+	}
+	if info.Country == "" {
+		info.Country, _ = field(country, "names", "en").(string)
+	}
+	if info.City == "" {
+		info.City, _ = field(record, "city", "names", "en").(string)
+	}
+	if info.ASN == 0 {
+		n, _ := field(record, "autonomous_system_number").(uint64)
+		info.ASN = uint(n)
+	}
+	if info.Org == "" {
+		info.Org, _ = field(record, "autonomous_system_organization").(string)
+	}
+}
+
+// field follows a path of map keys through a decoded record.
+func field(v any, path ...string) any {
+	for _, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
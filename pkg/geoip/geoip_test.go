@@ -0,0 +1,169 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// encode writes v in the MMDB data section format. It covers the types the
+// tests need: maps, strings and unsigned integers, with sizes below 285.
+func encode(v any) []byte {
+	ctrl := func(typ, size int) []byte {
+		var ext []byte
+		if size >= 29 {
+			ext = []byte{byte(size - 29)}
+			size = 29
+		}
+		if typ <= 7 {
+			return append([]byte{byte(typ<<5 | size)}, ext...)
+		}
+		return append([]byte{byte(size), byte(typ - 7)}, ext...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(v)), v...)
+	case uint32:
+		b := binary.BigEndian.AppendUint32(nil, v)
+		return append(ctrl(typeUint32, 4), b...)
+	case uint16:
+		b := binary.BigEndian.AppendUint16(nil, v)
+		return append(ctrl(typeUint16, 2), b...)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := ctrl(typeMap, len(v))
+		for _, k := range keys {
+			out = append(out, encode(k)...)
+			out = append(out, encode(v[k])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
+
+// writeIPv4DB builds a 24-bit IPv4 database mapping one /8 to record.
+func writeIPv4DB(t *testing.T, firstOctet byte, record map[string]any) string {
+	t.Helper()
+	const nodeCount = 8
+	data := encode(record)
+	var tree []byte
+	for i := 0; i < nodeCount; i++ {
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = nodeCount + 16 // Data section offset 0
+		}
+		records := [2]uint32{nodeCount, nodeCount}
+		records[firstOctet>>(7-i)&1] = next
+		for _, r := range records {
+			tree = append(tree, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	buf := append(tree, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, encode(map[string]any{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(4),
+		"database_type": "Test",
+	})...)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLookupMergesDatabases(t *testing.T) {
+	city := writeIPv4DB(t, 10, map[string]any{
+		"country": map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}},
+		"city":    map[string]any{"names": map[string]any{"en": "Frankfurt am Main"}},
+	})
+	asn := writeIPv4DB(t, 10, map[string]any{
+		"autonomous_system_number":       uint32(3320),
+		"autonomous_system_organization": "Deutsche Telekom AG",
+	})
+
+	r, err := Open(city, asn)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	info := r.Lookup(net.ParseIP("10.1.2.3"))
+	want := Info{CountryCode: "DE", Country: "Germany", City: "Frankfurt am Main", ASN: 3320, Org: "Deutsche Telekom AG"}
+	if info != want {
+		t.Fatalf("expected %+v, got %+v", want, info)
+	}
+	if got := info.String(); got != "DE, Frankfurt am Main, AS3320 Deutsche Telekom AG" {
+		t.Errorf("unexpected String(): %q", got)
+	}
+
+	if info := r.Lookup(net.ParseIP("192.168.1.1")); !info.Empty() {
+		t.Errorf("expected no data outside the mapped network, got %+v", info)
+	}
+	if info := r.Lookup(net.ParseIP("2001:db8::1")); !info.Empty() {
+		t.Errorf("expected no data for IPv6 in an IPv4 database, got %+v", info)
+	}
+}
+
+func TestOpenRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bogus.mmdb")
+	if err := os.WriteFile(path, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for a file without metadata")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestDecodePointer(t *testing.T) {
+	// A map whose value is a pointer back to the string at offset 0
+	section := append(encode("shared"), byte(typeMap<<5|1))
+	section = append(section, encode("k")...)
+	section = append(section, byte(typePointer<<5), 0)
+	v, _, err := decode(section, uint(len(encode("shared"))), 0)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if m := v.(map[string]any); m["k"] != "shared" {
+		t.Errorf("expected pointer to resolve, got %v", m)
+	}
+}
+
+func TestDecodeRejectsPointerLoop(t *testing.T) {
+	// A map whose value points back at the map itself
+	section := []byte{byte(typeMap<<5 | 1)}
+	section = append(section, encode("k")...)
+	section = append(section, byte(typePointer<<5), 0)
+	if _, _, err := decode(section, 0, 0); err == nil {
+		t.Fatal("expected a self-referencing map to fail")
+	}
+}
+
+func TestDecodeInt32(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    int64
+	}{
+		{[]byte{0x80}, 128},
+		{[]byte{0xff, 0xff}, 65535},
+		{[]byte{0xff, 0xff, 0xff, 0xff}, -1},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		section := append([]byte{byte(typeExtended<<5 | len(tt.payload)), typeInt32 - 7}, tt.payload...)
+		v, _, err := decode(section, 0, 0)
+		if err != nil || v != tt.want {
+			t.Errorf("decode(%x) = %v, %v; want %d", tt.payload, v, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package gotstest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+var fakeClientSeq atomic.Uint32
+
+// FakeClient speaks the client side of the protocol without running
+// anything: it answers PING, leaves on EXIT and replies to every other
+// command with the output of Handler.
+type FakeClient struct {
+	// Identifier is the session identifier sent in IDENT; a new one is
+	// made up if empty.
+	Identifier string
+	// Metadata holds IDENT fields such as "host", "os" or "caps".
+	Metadata map[string]string
+	// Handler returns the output for a command, without the end of output
+	// marker. A nil Handler replies "OK".
+	Handler func(command string) string
+
+	conn     net.Conn
+	mu       sync.Mutex // Guards writer and commands
+	writer   *bufio.Writer
+	commands []string
+	done     chan struct{}
+}
+
+// Connect dials ln, authenticates with sharedSecret if it is set, sends
+// IDENT and starts answering commands.
+func (c *FakeClient) Connect(ln *PipeListener, sharedSecret string) error {
+	conn, err := ln.Dial()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	c.conn = conn
+	c.writer = bufio.NewWriter(conn)
+	c.done = make(chan struct{})
+
+	if sharedSecret != "" {
+		if err := c.Send(protocol.CmdAuth + " " + sharedSecret + "\n"); err != nil {
+			conn.Close()
+			return err
+		}
+		resp, err := reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to read auth response: %w", err)
+		}
+		if strings.TrimSpace(resp) != protocol.CmdAuthOk {
+			conn.Close()
+			return errors.New("authentication failed")
+		}
+	}
+
+	if c.Identifier == "" {
+		c.Identifier = fmt.Sprintf("%08x", 0xf0000000+fakeClientSeq.Add(1))
+	}
+	if err := c.Send(c.identLine()); err != nil {
+		conn.Close()
+		return err
+	}
+	go c.serve(reader)
+	return nil
+}
+
+func (c *FakeClient) identLine() string {
+	keys := make([]string, 0, len(c.Metadata))
+	for k := range c.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{protocol.CmdIdent, c.Identifier}
+	for _, k := range keys {
+		parts = append(parts, k+"="+c.Metadata[k])
+	}
+	return strings.Join(parts, " ") + "\n"
+}
+
+func (c *FakeClient) serve(reader *bufio.Reader) {
+	defer close(c.done)
+	defer c.conn.Close()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		switch command {
+		case "":
+			continue
+		case protocol.CmdPing:
+			c.Send(protocol.CmdPong + "\n" + protocol.EndOfOutputMarker + "\n")
+			continue
+		case protocol.CmdExit:
+			return
+		}
+
+		c.mu.Lock()
+		c.commands = append(c.commands, command)
+		c.mu.Unlock()
+		output := "OK"
+		if c.Handler != nil {
+			output = c.Handler(command)
+		}
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		if c.Send(output+protocol.EndOfOutputMarker+"\n") != nil {
+			return
+		}
+	}
+}
+
+// Addr returns the client's address as the listener knows it.
+func (c *FakeClient) Addr() string {
+	return c.conn.LocalAddr().String()
+}
+
+// Commands returns the commands received so far, without pings.
+func (c *FakeClient) Commands() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.commands...)
+}
+
+// Send writes raw protocol data, e.g. a PROMPT or WATCH_EVENT frame, which
+// must end with a newline.
+func (c *FakeClient) Send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.writer.WriteString(data); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+// Done is closed when the connection ends.
+func (c *FakeClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close drops the connection, as a client that died would.
+func (c *FakeClient) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,128 @@
+package gotstest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/client"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// FakeListener drives a real client.ReverseClient over an in-memory
+// connection, playing the listener's side of the protocol one command at a
+// time.
+type FakeListener struct {
+	// Ident is the IDENT line the client announced itself with.
+	Ident string
+
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	handled chan error
+}
+
+// ConnectClient connects rc to a new FakeListener and runs its command
+// loop, as gotsr does after dialing. If sharedSecret is set the listener
+// requires it, so it must match the one rc was created with.
+func ConnectClient(rc *client.ReverseClient, sharedSecret string) (*FakeListener, error) {
+	ln := NewPipeListener()
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	clientConn, err := ln.Dial()
+	if err != nil {
+		return nil, err
+	}
+	conn := <-accepted
+	f := &FakeListener{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn), handled: make(chan error, 1)}
+
+	// The handshake needs both ends running
+	connected := make(chan error, 1)
+	go func() { connected <- rc.ConnectConn(clientConn) }()
+	if sharedSecret != "" {
+		line, err := f.ReadLine()
+		if err == nil && line != protocol.CmdAuth+" "+sharedSecret {
+			err = errors.New("client sent the wrong shared secret")
+		}
+		reply := protocol.CmdAuthOk
+		if err != nil {
+			reply = protocol.CmdAuthFailed
+		}
+		f.writer.WriteString(reply + "\n")
+		f.writer.Flush()
+		if err != nil {
+			conn.Close()
+			<-connected
+			return nil, err
+		}
+	}
+	if f.Ident, err = f.ReadLine(); err != nil {
+		conn.Close()
+		<-connected
+		return nil, fmt.Errorf("failed to read IDENT: %w", err)
+	}
+	if err := <-connected; err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go func() { f.handled <- rc.HandleCommands() }()
+	return f, nil
+}
+
+// Send writes a command line to the client without waiting for output.
+func (f *FakeListener) Send(command string) error {
+	if _, err := f.writer.WriteString(command + "\n"); err != nil {
+		return err
+	}
+	return f.writer.Flush()
+}
+
+// ReadLine reads one line from the client without its line ending.
+func (f *FakeListener) ReadLine() (string, error) {
+	line, err := f.reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Exec sends a command and returns the client's output up to the end of
+// output marker, which is left out. Protocol frames the client pushes in the
+// meantime are part of the output.
+func (f *FakeListener) Exec(command string, timeout time.Duration) (string, error) {
+	if err := f.Send(command); err != nil {
+		return "", err
+	}
+	f.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer f.conn.SetReadDeadline(time.Time{})
+	var out strings.Builder
+	for {
+		line, err := f.reader.ReadString('\n')
+		if i := strings.Index(line, protocol.EndOfOutputMarker); i >= 0 {
+			out.WriteString(line[:i])
+			return out.String(), nil
+		}
+		out.WriteString(line)
+		if err != nil {
+			return out.String(), err
+		}
+	}
+}
+
+// Close tells the client to leave, as a listener shutting down would, and
+// returns what the client's command loop returned.
+func (f *FakeListener) Close() error {
+	f.Send(protocol.CmdExit)
+	defer f.conn.Close()
+	select {
+	case err := <-f.handled:
+		return err
+	case <-time.After(5 * time.Second):
+		return errors.New("client did not stop")
+	}
+}
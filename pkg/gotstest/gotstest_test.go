@@ -0,0 +1,111 @@
+package gotstest_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/chaos"
+	"github.com/frjcomp/gots/pkg/client"
+	"github.com/frjcomp/gots/pkg/gotstest"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestServerWithFakeClient(t *testing.T) {
+	l, ln := gotstest.StartServer(t, "s3cret")
+	fc := &gotstest.FakeClient{
+		Metadata: map[string]string{"host": "web1", "os": "linux", "caps": "exec"},
+		Handler: func(command string) string {
+			if command == "whoami" {
+				return "root"
+			}
+			return "unknown command"
+		},
+	}
+	if err := fc.Connect(ln, "s3cret"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	gotstest.WaitForClient(t, l, fc.Addr(), 5*time.Second)
+
+	meta, _ := l.GetClientMetadata(fc.Addr())
+	if meta.Hostname != "web1" || !meta.Supports("exec") || meta.Supports("pty") {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	if err := l.SendCommand(fc.Addr(), "whoami"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := l.GetResponse(fc.Addr(), 5*time.Second)
+	if err != nil || !strings.Contains(resp, "root") {
+		t.Fatalf("GetResponse = %q, %v", resp, err)
+	}
+	if got := fc.Commands(); len(got) != 1 || got[0] != "whoami" {
+		t.Errorf("Commands = %q", got)
+	}
+
+	// A second client gets its own address
+	other := &gotstest.FakeClient{}
+	if err := other.Connect(ln, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	gotstest.WaitForClient(t, l, other.Addr(), 5*time.Second)
+	if other.Addr() == fc.Addr() || len(l.GetClients()) != 2 {
+		t.Errorf("expected two clients, got %v", l.GetClients())
+	}
+
+	fc.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(l.GetClients()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed client still listed: %v", l.GetClients())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFakeClientWrongSecret(t *testing.T) {
+	_, ln := gotstest.StartServer(t, "s3cret")
+	if err := (&gotstest.FakeClient{}).Connect(ln, "wrong"); err == nil {
+		t.Error("expected authentication to fail")
+	}
+}
+
+func TestClientWithFakeListener(t *testing.T) {
+	rc := client.NewReverseClient("unused:0", "s3cret", "")
+	f, err := gotstest.ConnectClient(rc, "s3cret")
+	if err != nil {
+		t.Fatalf("ConnectClient: %v", err)
+	}
+	if !strings.HasPrefix(f.Ident, protocol.CmdIdent+" ") || !strings.Contains(f.Ident, "caps=") {
+		t.Errorf("unexpected IDENT %q", f.Ident)
+	}
+	out, err := f.Exec(protocol.CmdPing, 5*time.Second)
+	if err != nil || strings.TrimSpace(out) != protocol.CmdPong {
+		t.Errorf("PING = %q, %v", out, err)
+	}
+	out, err = f.Exec("echo hello", 10*time.Second)
+	if err != nil || !strings.Contains(out, "hello") {
+		t.Errorf("echo = %q, %v", out, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestClientWithFakeListenerUnderChaos(t *testing.T) {
+	rc := client.NewReverseClientWithOptions("unused:0", "s3cret", "", client.Options{
+		Chaos: chaos.Config{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond},
+	})
+	f, err := gotstest.ConnectClient(rc, "s3cret")
+	if err != nil {
+		t.Fatalf("ConnectClient: %v", err)
+	}
+	defer f.Close()
+	start := time.Now()
+	out, err := f.Exec(protocol.CmdPing, 5*time.Second)
+	if err != nil || strings.TrimSpace(out) != protocol.CmdPong {
+		t.Errorf("PING = %q, %v", out, err)
+	}
+	if rtt := time.Since(start); rtt < 40*time.Millisecond {
+		t.Errorf("expected the latency in both directions, PING took %s", rtt)
+	}
+}
@@ -0,0 +1,87 @@
+// Package gotstest provides in-memory stand-ins for the network, the client
+// and the listener, so that programs embedding pkg/server or pkg/client can
+// test against the real protocol without TLS sockets or gotsr and gotsl
+// binaries.
+package gotstest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pipeAddr is the address of one end of an in-memory connection.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "gotstest" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is one end of a net.Pipe with distinct addresses, since the
+// listener tells clients apart by their remote address.
+type pipeConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+// PipeListener is an in-memory net.Listener: Dial returns one end of a new
+// connection and Accept the other. Each connection gets its own client
+// address, 192.0.2.1 with a distinct port.
+type PipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	seq       atomic.Uint32
+}
+
+// pipeListenerAddr is the address of every PipeListener.
+const pipeListenerAddr = pipeAddr("192.0.2.254:443")
+
+// NewPipeListener returns a listener ready to accept connections.
+func NewPipeListener() *PipeListener {
+	return &PipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// Dial connects to the listener and returns the client's end, blocking
+// until Accept picks the connection up.
+func (l *PipeListener) Dial() (net.Conn, error) {
+	addr := pipeAddr(fmt.Sprintf("192.0.2.1:%d", 40000+l.seq.Add(1)))
+	client, server := net.Pipe()
+	select {
+	case l.conns <- &pipeConn{Conn: server, local: pipeListenerAddr, remote: addr}:
+		return &pipeConn{Conn: client, local: addr, remote: pipeListenerAddr}, nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, net.ErrClosed
+	case <-time.After(5 * time.Second):
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("dial %s: nothing accepted the connection", pipeListenerAddr)
+	}
+}
+
+// Accept waits for the next Dial.
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections. Connections already made stay open.
+func (l *PipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the listener's address.
+func (l *PipeListener) Addr() net.Addr {
+	return pipeListenerAddr
+}
@@ -0,0 +1,39 @@
+package gotstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/server"
+)
+
+// StartServer runs a server.Listener on a new PipeListener, with
+// authentication if sharedSecret is set. Both are shut down when the test
+// ends.
+func StartServer(tb testing.TB, sharedSecret string) (*server.Listener, *PipeListener) {
+	tb.Helper()
+	l := server.NewListener("0", "127.0.0.1", nil, sharedSecret)
+	ln := NewPipeListener()
+	go l.Serve(ln)
+	tb.Cleanup(func() {
+		ln.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		l.Shutdown(ctx)
+	})
+	return l, ln
+}
+
+// WaitForClient waits until the listener has processed the IDENT of the
+// client at clientAddr, failing the test after timeout.
+func WaitForClient(tb testing.TB, l *server.Listener, clientAddr string, timeout time.Duration) {
+	tb.Helper()
+	deadline := time.Now().Add(timeout)
+	for l.GetClientIdentifier(clientAddr) == "" {
+		if time.Now().After(deadline) {
+			tb.Fatalf("client %s did not connect within %v", clientAddr, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,194 @@
+package icmptunnel
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// packetConn is the ICMP socket; tests substitute an in-memory network.
+type packetConn interface {
+	ReadFrom(b []byte) (int, net.Addr, error)
+	WriteTo(b []byte, addr net.Addr) (int, error)
+	SetReadDeadline(t time.Time) error
+	LocalAddr() net.Addr
+	Close() error
+}
+
+var errLost = errors.New("no answer from the listener")
+
+// client runs one session from the client side.
+type client struct {
+	pc      packetConn
+	peer    net.Addr
+	id      int // ICMP echo identifier
+	icmpSeq int // ICMP echo sequence number, new for every packet
+	session uint32
+	seq     uint32 // Tunnel sequence number of the current exchange
+	s       *stream
+	t       timing
+}
+
+// Dial opens a session to a listener accepting the tunnel on host.
+func Dial(host string) (net.Conn, error) {
+	ip, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	var peer net.Addr = ip
+	if err != nil {
+		// Unprivileged ping sockets, where net.ipv4.ping_group_range allows
+		var perr error
+		if pc, perr = icmp.ListenPacket("udp4", "0.0.0.0"); perr != nil {
+			return nil, fmt.Errorf("ICMP tunnel needs raw socket privileges (root or CAP_NET_RAW): %w", err)
+		}
+		peer = &net.UDPAddr{IP: ip.IP}
+	}
+	return dial(pc, peer, defaultTiming)
+}
+
+func dial(pc packetConn, peer net.Addr, t timing) (net.Conn, error) {
+	var r [6]byte
+	if _, err := rand.Read(r[:]); err != nil {
+		pc.Close()
+		return nil, err
+	}
+	c := &client{
+		pc:      pc,
+		peer:    peer,
+		id:      int(binary.BigEndian.Uint16(r[:2])),
+		session: binary.BigEndian.Uint32(r[2:]),
+		s:       newStream(pc.LocalAddr(), peer),
+		t:       t,
+	}
+	if _, err := c.exchange(frame{flags: flagSYN}); err != nil {
+		c.s.abort()
+		pc.Close()
+		return nil, fmt.Errorf("ICMP tunnel to %s: %w", peer, err)
+	}
+	go c.run()
+	return c.s, nil
+}
+
+// run exchanges packets until either side closes or the listener stops
+// answering. Without data to send it polls, less often the longer the
+// session is idle.
+func (c *client) run() {
+	defer c.pc.Close()
+	poll := c.t.minPoll
+	var next []byte
+	var nextClosed, haveNext bool
+	for {
+		b, closed := next, nextClosed
+		if !haveNext {
+			b, closed = c.s.take()
+		}
+		haveNext = false
+		f := frame{payload: b}
+		if closed {
+			f.flags = flagFIN
+		}
+		reply, err := c.exchange(f)
+		if err != nil {
+			log.Printf("⚠️  ICMP tunnel to %s lost: %v", c.peer, err)
+			c.s.abort()
+			return
+		}
+		if len(reply.payload) > 0 {
+			select {
+			case c.s.down <- reply.payload:
+			case <-c.s.done:
+				return
+			}
+		}
+		if closed || reply.flags&flagFIN != 0 {
+			c.s.end()
+			return
+		}
+		if len(b) > 0 || len(reply.payload) > 0 {
+			poll = c.t.minPoll
+			continue
+		}
+		timer := time.NewTimer(poll)
+		select {
+		case b, ok := <-c.s.up:
+			next, nextClosed, haveNext = b, !ok, true
+		case <-timer.C:
+		}
+		timer.Stop()
+		poll = min(2*poll, c.t.maxPoll)
+	}
+}
+
+// exchange sends a request and returns the listener's reply to it,
+// retransmitting with a doubling timeout until it arrives or the session
+// is considered lost.
+func (c *client) exchange(f frame) (frame, error) {
+	f.dir, f.session, f.seq = dirRequest, c.session, c.seq
+	data := f.marshal()
+	buf := make([]byte, 1500)
+	rto := c.t.rto
+	start := time.Now()
+	for {
+		c.icmpSeq = (c.icmpSeq + 1) & 0xffff
+		msg, err := (&icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: c.id, Seq: c.icmpSeq, Data: data}}).Marshal(nil)
+		if err != nil {
+			return frame{}, err
+		}
+		if _, err := c.pc.WriteTo(msg, c.peer); err != nil {
+			return frame{}, err
+		}
+		deadline := time.Now().Add(rto)
+		for {
+			if err := c.pc.SetReadDeadline(deadline); err != nil {
+				return frame{}, err
+			}
+			n, from, err := c.pc.ReadFrom(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return frame{}, err
+			}
+			if reply, ok := c.parseReply(buf[:n], from); ok {
+				c.seq++
+				return reply, nil
+			}
+		}
+		if time.Since(start) >= c.t.dead {
+			return frame{}, errLost
+		}
+		rto = min(2*rto, c.t.maxRTO)
+	}
+}
+
+// parseReply picks the answer to the current exchange out of everything
+// the socket receives: other ICMP traffic, other sessions, and the echo
+// replies the listener's kernel sends on its own, which carry a request.
+func (c *client) parseReply(b []byte, from net.Addr) (frame, bool) {
+	if !addrIP(from).Equal(addrIP(c.peer)) {
+		return frame{}, false
+	}
+	msg, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), b)
+	if err != nil || msg.Type != ipv4.ICMPTypeEchoReply {
+		return frame{}, false
+	}
+	echo, ok := msg.Body.(*icmp.Echo)
+	if !ok {
+		return frame{}, false
+	}
+	f, err := parseFrame(echo.Data)
+	if err != nil || f.dir != dirReply || f.session != c.session || f.seq != c.seq {
+		return frame{}, false
+	}
+	return f, true
+}
@@ -0,0 +1,216 @@
+// Package icmptunnel carries a byte stream in ICMP echo requests and
+// replies, as a last-resort transport for networks that let nothing else
+// out. The client sends echo requests holding its data; the listener
+// answers each with an echo reply holding its own. Exchanges run in lock
+// step, one at a time, and the client retransmits a request until the
+// answer arrives, so the stream is reliable and ordered but slow: expect a
+// few kilobytes per second and latency of a round trip or more per chunk.
+//
+// Both ends need raw socket privileges (root or CAP_NET_RAW); the client
+// falls back to unprivileged ping sockets where the system allows them.
+// Only IPv4 is supported.
+package icmptunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaxPayload is the most stream data one packet carries. With the header
+// and the IP and ICMP headers it stays below the 576 bytes every IPv4 host
+// must accept, so packets are never fragmented.
+const MaxPayload = 512
+
+const (
+	headerSize = 14
+	dirRequest = 1 // Client to listener
+	dirReply   = 2 // Listener to client
+	flagSYN    = 1 // First exchange of a session
+	flagFIN    = 2 // The sender closed its side
+	// queueChunks bounds the chunks buffered in either direction.
+	queueChunks = 64
+)
+
+var magic = [4]byte{'G', 'T', 'I', 'C'}
+
+// timing holds the retransmission and polling intervals.
+type timing struct {
+	rto     time.Duration // Initial retransmission timeout
+	maxRTO  time.Duration // Cap of the doubling retransmission timeout
+	dead    time.Duration // Time without an answer after which a session is lost
+	minPoll time.Duration // Poll interval right after data was exchanged
+	maxPoll time.Duration // Poll interval of an idle session
+}
+
+var defaultTiming = timing{
+	rto:     time.Second,
+	maxRTO:  4 * time.Second,
+	dead:    30 * time.Second,
+	minPoll: 50 * time.Millisecond,
+	maxPoll: time.Second,
+}
+
+// frame is the tunnel packet inside an echo message.
+type frame struct {
+	dir     byte
+	flags   byte
+	session uint32
+	seq     uint32
+	payload []byte
+}
+
+func (f frame) marshal() []byte {
+	b := make([]byte, headerSize+len(f.payload))
+	copy(b, magic[:])
+	b[4], b[5] = f.dir, f.flags
+	binary.BigEndian.PutUint32(b[6:], f.session)
+	binary.BigEndian.PutUint32(b[10:], f.seq)
+	copy(b[headerSize:], f.payload)
+	return b
+}
+
+var errNotTunnel = errors.New("not a tunnel packet")
+
+// parseFrame reads a tunnel packet, rejecting anything else that arrives
+// on the ICMP socket as well as oversized packets.
+func parseFrame(b []byte) (frame, error) {
+	if len(b) < headerSize || len(b) > headerSize+MaxPayload || [4]byte(b[:4]) != magic {
+		return frame{}, errNotTunnel
+	}
+	f := frame{
+		dir:     b[4],
+		flags:   b[5],
+		session: binary.BigEndian.Uint32(b[6:]),
+		seq:     binary.BigEndian.Uint32(b[10:]),
+	}
+	if f.dir != dirRequest && f.dir != dirReply {
+		return frame{}, errNotTunnel
+	}
+	if len(b) > headerSize {
+		f.payload = append([]byte(nil), b[headerSize:]...)
+	}
+	return f, nil
+}
+
+// stream is the net.Conn handed to the caller. It is one end of a
+// net.Pipe, which provides deadlines; goroutines move data between the
+// other end and the tunnel's queues.
+type stream struct {
+	net.Conn
+	inner         net.Conn
+	local, remote net.Addr
+	up            chan []byte // Written by the caller, to be sent; closed once the caller closes
+	down          chan []byte // Received, to be read by the caller
+	downOnce      sync.Once
+	done          chan struct{}
+	doneOnce      sync.Once
+}
+
+func newStream(local, remote net.Addr) *stream {
+	user, inner := net.Pipe()
+	s := &stream{
+		Conn:   user,
+		inner:  inner,
+		local:  local,
+		remote: remote,
+		up:     make(chan []byte, queueChunks),
+		down:   make(chan []byte, queueChunks),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.up)
+		for {
+			buf := make([]byte, MaxPayload)
+			n, err := inner.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case s.up <- buf[:n]:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		defer inner.Close()
+		for b := range s.down {
+			if _, err := inner.Write(b); err != nil {
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// deliver queues received data for the caller unless the queue is full,
+// in which case the packet is treated as lost and sent again later.
+func (s *stream) deliver(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+	select {
+	case s.down <- b:
+		return true
+	default:
+		return false
+	}
+}
+
+// take returns the next chunk to send, if any, and whether the caller has
+// closed the stream with nothing left to send.
+func (s *stream) take() (b []byte, closed bool) {
+	select {
+	case b, ok := <-s.up:
+		return b, !ok
+	default:
+		return nil, false
+	}
+}
+
+// end finishes the session: the caller reads what was received, then
+// EOF, and nothing more is sent.
+func (s *stream) end() {
+	s.downOnce.Do(func() { close(s.down) })
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+// abort ends the session at once, dropping data not yet read, when the
+// tunnel is lost.
+func (s *stream) abort() {
+	s.end()
+	s.inner.Close()
+}
+
+func (s *stream) LocalAddr() net.Addr  { return s.local }
+func (s *stream) RemoteAddr() net.Addr { return s.remote }
+
+// Addr identifies a client session at the listener. Several sessions may
+// come from one IP, so the session number stands in for the port, e.g.
+// "192.0.2.7:3054391421".
+type Addr struct {
+	IP      net.IP
+	Session uint32
+}
+
+func (a *Addr) Network() string { return "icmp" }
+
+func (a *Addr) String() string {
+	return net.JoinHostPort(a.IP.String(), strconv.FormatUint(uint64(a.Session), 10))
+}
+
+// addrIP returns the IP of an address from an ICMP socket, which is an
+// *net.IPAddr for raw sockets and an *net.UDPAddr for ping sockets.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package icmptunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	mrand "math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+var testTiming = timing{
+	rto:     20 * time.Millisecond,
+	maxRTO:  80 * time.Millisecond,
+	dead:    time.Second,
+	minPoll: time.Millisecond,
+	maxPoll: 10 * time.Millisecond,
+}
+
+type packet struct {
+	data []byte
+	from net.Addr
+}
+
+// memNet connects a client and a listener socket, dropping a share of the
+// packets and, like the listener's kernel, answering every echo request
+// with an echo reply of its own.
+type memNet struct {
+	mu     sync.Mutex
+	loss   float64
+	rnd    *mrand.Rand
+	client *memConn
+	server *memConn
+}
+
+type memConn struct {
+	net      *memNet
+	addr     net.Addr
+	inbox    chan packet
+	mu       sync.Mutex
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newMemNet(loss float64) *memNet {
+	n := &memNet{loss: loss, rnd: mrand.New(mrand.NewSource(1))}
+	n.client = &memConn{net: n, addr: &net.IPAddr{IP: net.IPv4(10, 0, 0, 1)}, inbox: make(chan packet, 256), closed: make(chan struct{})}
+	n.server = &memConn{net: n, addr: &net.IPAddr{IP: net.IPv4(10, 0, 0, 2)}, inbox: make(chan packet, 256), closed: make(chan struct{})}
+	return n
+}
+
+func (n *memNet) send(to *memConn, p packet) {
+	n.mu.Lock()
+	lost := n.rnd.Float64() < n.loss
+	n.mu.Unlock()
+	if lost {
+		return
+	}
+	select {
+	case to.inbox <- p:
+	default:
+	}
+}
+
+func (c *memConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p := packet{data: append([]byte(nil), b...), from: c.addr}
+	peer := c.net.server
+	if c == c.net.server {
+		peer = c.net.client
+	}
+	c.net.send(peer, p)
+	if c == c.net.client {
+		// The listener's kernel answers pings too
+		if msg, err := icmp.ParseMessage(1, b); err == nil && msg.Type == ipv4.ICMPTypeEcho {
+			msg.Type = ipv4.ICMPTypeEchoReply
+			if echo, err := msg.Marshal(nil); err == nil {
+				c.net.send(c, packet{data: echo, from: peer.addr})
+			}
+		}
+	}
+	return len(b), nil
+}
+
+func (c *memConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p := <-c.inbox:
+		return copy(b, p.data), p.from, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr { return c.addr }
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// tunnel returns both ends of a session over a network losing loss of the
+// packets.
+func tunnel(t *testing.T, loss float64) (net.Conn, net.Conn, *Listener) {
+	t.Helper()
+	n := newMemNet(loss)
+	l := listen(n.server, testTiming)
+	t.Cleanup(func() { l.Close() })
+	conn, err := dial(n.client, n.server.addr, testTiming)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	return conn, accepted, l
+}
+
+func TestTunnelTransfersBothWaysOverLossyNetwork(t *testing.T) {
+	conn, accepted, _ := tunnel(t, 0.3)
+	up := make([]byte, 20<<10)
+	down := make([]byte, 20<<10)
+	rand.Read(up)
+	rand.Read(down)
+
+	go func() {
+		conn.Write(up)
+	}()
+	go func() {
+		accepted.Write(down)
+	}()
+	gotUp := make([]byte, len(up))
+	if _, err := io.ReadFull(accepted, gotUp); err != nil {
+		t.Fatalf("listener read: %v", err)
+	}
+	gotDown := make([]byte, len(down))
+	if _, err := io.ReadFull(conn, gotDown); err != nil {
+		t.Fatalf("client read: %v", err)
+	}
+	if !bytes.Equal(gotUp, up) || !bytes.Equal(gotDown, down) {
+		t.Fatal("data corrupted or reordered in the tunnel")
+	}
+}
+
+func TestTunnelCloseReachesOtherSide(t *testing.T) {
+	conn, accepted, _ := tunnel(t, 0)
+	conn.Write([]byte("bye"))
+	conn.Close()
+	data, err := io.ReadAll(accepted)
+	if err != nil || string(data) != "bye" {
+		t.Fatalf("listener got %q, %v; want bye and EOF", data, err)
+	}
+
+	conn, accepted, _ = tunnel(t, 0)
+	accepted.Write([]byte("bye"))
+	accepted.Close()
+	data, err = io.ReadAll(conn)
+	if err != nil || string(data) != "bye" {
+		t.Fatalf("client got %q, %v; want bye and EOF", data, err)
+	}
+}
+
+func TestTunnelReadDeadline(t *testing.T) {
+	conn, _, _ := tunnel(t, 0)
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
+
+func TestTunnelLostWhenListenerGoes(t *testing.T) {
+	conn, _, l := tunnel(t, 0)
+	l.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF once the listener stops answering, got %v", err)
+	}
+}
+
+func TestDialWithoutListener(t *testing.T) {
+	n := newMemNet(1)
+	if _, err := dial(n.client, n.server.addr, testTiming); err == nil {
+		t.Fatal("expected dial to fail without answers")
+	}
+}
+
+func TestParseFrame(t *testing.T) {
+	f := frame{dir: dirRequest, flags: flagSYN, session: 7, seq: 9, payload: []byte("hi")}
+	got, err := parseFrame(f.marshal())
+	if err != nil || got.dir != f.dir || got.flags != f.flags || got.session != 7 || got.seq != 9 || string(got.payload) != "hi" {
+		t.Fatalf("round trip gave %+v, %v", got, err)
+	}
+	tooBig := frame{dir: dirRequest, payload: make([]byte, MaxPayload+1)}
+	for name, b := range map[string][]byte{
+		"ping":      []byte("abcdefghijklmnopqrstuvwxyz"),
+		"short":     magic[:],
+		"direction": frame{dir: 9}.marshal(),
+		"oversized": tooBig.marshal(),
+	} {
+		if _, err := parseFrame(b); err == nil {
+			t.Errorf("%s: expected rejection", name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package icmptunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// acceptBacklog bounds the sessions waiting for Accept.
+const acceptBacklog = 16
+
+// Listener accepts tunnel sessions. It implements net.Listener.
+type Listener struct {
+	pc        packetConn
+	t         timing
+	mu        sync.Mutex
+	sessions  map[sessionKey]*session
+	accept    chan *stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type sessionKey struct {
+	ip string
+	id uint32
+}
+
+// session is the listener's side of one client session.
+type session struct {
+	s        *stream
+	next     uint32 // Sequence number of the next new request
+	last     []byte // Reply to the previous request, sent again if it is repeated
+	lastSeen time.Time
+	finished bool // The client closed its side
+}
+
+// Listen accepts tunnel sessions arriving on host, e.g. "0.0.0.0". The
+// system keeps answering pings as well, which clients ignore; set
+// net.ipv4.icmp_echo_ignore_all=1 to halve the ICMP traffic.
+func Listen(host string) (*Listener, error) {
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	pc, err := icmp.ListenPacket("ip4:icmp", host)
+	if err != nil {
+		return nil, fmt.Errorf("ICMP tunnel needs raw socket privileges (root or CAP_NET_RAW): %w", err)
+	}
+	return listen(pc, defaultTiming), nil
+}
+
+func listen(pc packetConn, t timing) *Listener {
+	l := &Listener{
+		pc:       pc,
+		t:        t,
+		sessions: make(map[sessionKey]*session),
+		accept:   make(chan *stream, acceptBacklog),
+		done:     make(chan struct{}),
+	}
+	go l.serve()
+	go l.reap()
+	return l
+}
+
+// Accept waits for the next session.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case s := <-l.accept:
+		return s, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting sessions and ends the open ones, which cannot
+// outlive the socket they run on.
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.pc.Close()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for key, sess := range l.sessions {
+			sess.s.abort()
+			delete(l.sessions, key)
+		}
+	})
+	return err
+}
+
+// Addr returns the address the listener receives on.
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		msg, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), buf[:n])
+		if err != nil || msg.Type != ipv4.ICMPTypeEcho {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok {
+			continue
+		}
+		f, err := parseFrame(echo.Data)
+		if err != nil || f.dir != dirRequest {
+			continue
+		}
+		l.handle(from, echo, f)
+	}
+}
+
+// handle answers a request. A new request hands its data to the session
+// and is answered with the next chunk to send; a repeated one, whose reply
+// was lost, gets the same reply again. Anything else is ignored.
+func (l *Listener) handle(from net.Addr, echo *icmp.Echo, f frame) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := sessionKey{addrIP(from).String(), f.session}
+	sess := l.sessions[key]
+	if sess == nil {
+		if f.flags&flagSYN == 0 || f.seq != 0 {
+			return
+		}
+		sess = &session{s: newStream(l.pc.LocalAddr(), &Addr{IP: addrIP(from), Session: f.session})}
+		select {
+		case l.accept <- sess.s:
+		default:
+			sess.s.abort()
+			return
+		}
+		l.sessions[key] = sess
+	}
+	sess.lastSeen = time.Now()
+
+	switch {
+	case f.seq == sess.next && !sess.finished:
+		if !sess.s.deliver(f.payload) {
+			return // Queue full; the client sends it again
+		}
+		reply := frame{dir: dirReply, session: f.session, seq: f.seq}
+		if f.flags&flagFIN != 0 {
+			sess.finished = true
+			sess.s.end()
+		} else if b, closed := sess.s.take(); closed {
+			reply.flags = flagFIN
+		} else {
+			reply.payload = b
+		}
+		sess.last = reply.marshal()
+		sess.next++
+	case f.seq+1 == sess.next:
+	default:
+		return
+	}
+	// The reply must echo the request's identifier and sequence number,
+	// or NAT devices and the client's kernel drop it.
+	msg, err := (&icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: echo.ID, Seq: echo.Seq, Data: sess.last}}).Marshal(nil)
+	if err == nil {
+		_, _ = l.pc.WriteTo(msg, from)
+	}
+}
+
+// reap ends sessions whose client stopped sending, including finished
+// ones, which are kept a while to answer repeated requests.
+func (l *Listener) reap() {
+	ticker := time.NewTicker(l.t.dead / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, sess := range l.sessions {
+				if now.Sub(sess.lastSeen) > l.t.dead {
+					sess.s.abort()
+					delete(l.sessions, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink kinds accepted by OpenSink.
+const (
+	SinkSyslog   = "syslog"
+	SinkJournald = "journald"
+)
+
+// journaldSocket is where systemd-journald takes native protocol datagrams.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// syslogSockets are the local syslog sockets, in the order they are tried.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSDID names the structured data element of syslog records. 32473 is
+// the private enterprise number reserved for documentation (RFC 5612).
+const syslogSDID = "gots@32473"
+
+// Fields are structured fields attached to a record. Empty ones are left out.
+type Fields struct {
+	Client   string // Client address, e.g. 10.0.0.5:51234
+	Operator string // Operator that acted, for audit events
+}
+
+// Sink sends log records to a system logger.
+type Sink interface {
+	Send(level Level, msg string, fields Fields) error
+	Close() error
+}
+
+// OpenSink connects to a system logger. kind is SinkSyslog or SinkJournald.
+// For syslog, addr is empty for the local socket or "udp://host:port" or
+// "tcp://host:port" for a remote collector. tag names the program.
+func OpenSink(kind, addr, tag string) (Sink, error) {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	switch kind {
+	case SinkSyslog:
+		return openSyslog(addr, tag)
+	case SinkJournald:
+		conn, err := net.Dial("unixgram", journaldSocket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		return &journaldSink{conn: conn, tag: tag}, nil
+	}
+	return nil, fmt.Errorf("unknown log sink %q", kind)
+}
+
+var (
+	sinkMu sync.Mutex
+	sink   Sink
+)
+
+// SetSink makes Tee copy log output to s. nil stops copying.
+func SetSink(s Sink) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	sink = s
+}
+
+// Tee returns w, copying each log line to the sink set with SetSink if
+// there is one. Wrap every log.SetOutput target with it.
+func Tee(w io.Writer) io.Writer {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	if sink == nil {
+		return w
+	}
+	return io.MultiWriter(w, sinkWriter{sink})
+}
+
+// sinkWriter adapts a Sink to the standard logger. Each line gets a level
+// from its wording and the first client address it names as a field.
+type sinkWriter struct {
+	sink Sink
+}
+
+func (w sinkWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		msg := stripLogPrefix(line)
+		// A failing system logger must not break console logging
+		_ = w.sink.Send(LevelOf(msg), msg, Fields{Client: clientAddrPattern.FindString(msg)})
+	}
+	return len(p), nil
+}
+
+// logTimestamp matches the date and time the standard logger prepends.
+var logTimestamp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(\.\d+)? `)
+
+// clientAddrPattern matches an IPv4 or bracketed IPv6 address with a port.
+var clientAddrPattern = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}:\d{1,5}\b|\[[0-9A-Fa-f:.]+\]:\d{1,5}`)
+
+// stripLogPrefix drops the standard logger's timestamp; system loggers
+// stamp records themselves.
+func stripLogPrefix(line string) string {
+	return logTimestamp.ReplaceAllString(line, "")
+}
+
+// LevelOf infers the level of a log line from the markers the listener and
+// client use: "[-]" and "Error" for errors, "[!]" and "Warning" for warnings,
+// "[DEBUG]" for debug output.
+func LevelOf(msg string) Level {
+	lower := strings.ToLower(strings.TrimSpace(msg))
+	switch {
+	case strings.HasPrefix(lower, "[-]"), strings.HasPrefix(lower, "error"):
+		return Error
+	case strings.HasPrefix(lower, "[!]"), strings.HasPrefix(lower, "warning"):
+		return Warn
+	case strings.HasPrefix(lower, "[debug]"):
+		return Debug
+	}
+	return Info
+}
+
+// syslogSink writes RFC 5424 records with the fields as structured data.
+type syslogSink struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	framed   bool // TCP needs octet-counting framing (RFC 6587)
+	hostname string
+	tag      string
+}
+
+func openSyslog(addr, tag string) (*syslogSink, error) {
+	s := &syslogSink{tag: tag}
+	s.hostname, _ = os.Hostname()
+	if addr == "" {
+		var err error
+		for _, path := range syslogSockets {
+			if s.conn, err = net.Dial("unixgram", path); err == nil {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to connect to local syslog: %w", err)
+	}
+	network, hostport, ok := strings.Cut(addr, "://")
+	if !ok || (network != "udp" && network != "tcp") {
+		return nil, fmt.Errorf("invalid syslog address %q: want udp://host:port or tcp://host:port", addr)
+	}
+	conn, err := net.DialTimeout(network, hostport, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog at %s: %w", addr, err)
+	}
+	s.conn, s.framed = conn, network == "tcp"
+	return s, nil
+}
+
+// syslogSeverity maps a level to a syslog severity.
+func syslogSeverity(level Level) int {
+	switch level {
+	case Error:
+		return 3
+	case Warn:
+		return 4
+	case Debug:
+		return 7
+	}
+	return 6
+}
+
+// facilityDaemon is the syslog facility of system daemons.
+const facilityDaemon = 3
+
+func (s *syslogSink) Send(level Level, msg string, fields Fields) error {
+	record := formatSyslog(level, msg, fields, time.Now(), s.hostname, s.tag, os.Getpid())
+	if s.framed {
+		record = fmt.Sprintf("%d %s", len(record), record)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.conn, record)
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// formatSyslog formats an RFC 5424 record.
+func formatSyslog(level Level, msg string, fields Fields, t time.Time, hostname, tag string, pid int) string {
+	if hostname == "" {
+		hostname = "-"
+	}
+	sd := "-"
+	var params []string
+	if fields.Client != "" {
+		params = append(params, fmt.Sprintf(`client="%s"`, escapeSDParam(fields.Client)))
+	}
+	if fields.Operator != "" {
+		params = append(params, fmt.Sprintf(`operator="%s"`, escapeSDParam(fields.Operator)))
+	}
+	if len(params) > 0 {
+		sd = "[" + syslogSDID + " " + strings.Join(params, " ") + "]"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", facilityDaemon*8+syslogSeverity(level),
+		t.UTC().Format(time.RFC3339Nano), hostname, tag, pid, sd, msg)
+}
+
+// escapeSDParam escapes the characters RFC 5424 reserves in parameter values.
+func escapeSDParam(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
+
+// journaldSink writes records in journald's native protocol, which keeps the
+// fields as GOTS_CLIENT and GOTS_OPERATOR.
+type journaldSink struct {
+	conn net.Conn
+	tag  string
+}
+
+func (s *journaldSink) Send(level Level, msg string, fields Fields) error {
+	_, err := s.conn.Write(formatJournald(level, msg, fields, s.tag))
+	return err
+}
+
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+// formatJournald encodes a record as journald native protocol fields.
+func formatJournald(level Level, msg string, fields Fields, tag string) []byte {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", msg)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(syslogSeverity(level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", tag)
+	if fields.Client != "" {
+		writeJournalField(&buf, "GOTS_CLIENT", fields.Client)
+	}
+	if fields.Operator != "" {
+		writeJournalField(&buf, "GOTS_OPERATOR", fields.Operator)
+	}
+	return buf.Bytes()
+}
+
+// writeJournalField writes KEY=value, or the length-prefixed binary form
+// when the value contains a newline.
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+		return
+	}
+	buf.WriteString(key + "\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	levels []Level
+	msgs   []string
+	fields []Fields
+}
+
+func (s *recordingSink) Send(level Level, msg string, fields Fields) error {
+	s.levels = append(s.levels, level)
+	s.msgs = append(s.msgs, msg)
+	s.fields = append(s.fields, fields)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestSinkWriter(t *testing.T) {
+	sink := &recordingSink{}
+	w := sinkWriter{sink}
+	w.Write([]byte("2025/01/02 03:04:05 [-] Client 10.0.0.5:51234 disconnected: EOF\n"))
+	w.Write([]byte("Warning: engagement ended\n"))
+	w.Write([]byte("[+] New client connected: [fe80::1]:4444\n"))
+
+	if len(sink.msgs) != 3 {
+		t.Fatalf("expected 3 records, got %q", sink.msgs)
+	}
+	if sink.msgs[0] != "[-] Client 10.0.0.5:51234 disconnected: EOF" {
+		t.Errorf("timestamp not stripped: %q", sink.msgs[0])
+	}
+	wantLevels := []Level{Error, Warn, Info}
+	wantClients := []string{"10.0.0.5:51234", "", "[fe80::1]:4444"}
+	for i := range sink.msgs {
+		if sink.levels[i] != wantLevels[i] {
+			t.Errorf("record %d: level %d, want %d", i, sink.levels[i], wantLevels[i])
+		}
+		if sink.fields[i].Client != wantClients[i] {
+			t.Errorf("record %d: client %q, want %q", i, sink.fields[i].Client, wantClients[i])
+		}
+	}
+}
+
+func TestFormatSyslog(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	got := formatSyslog(Warn, "[!] lock overridden", Fields{Client: "10.0.0.5:1", Operator: `al"ice`}, ts, "lab", "gotsl", 42)
+	want := `<28>1 2025-01-02T03:04:05Z lab gotsl 42 - [gots@32473 client="10.0.0.5:1" operator="al\"ice"] [!] lock overridden`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if got := formatSyslog(Info, "ready", Fields{}, ts, "", "gotsl", 1); !strings.Contains(got, "<30>1 ") || !strings.Contains(got, " - - ready") {
+		t.Errorf("unexpected record without fields: %s", got)
+	}
+}
+
+func TestFormatJournald(t *testing.T) {
+	got := formatJournald(Error, "line1\nline2", Fields{Operator: "alice"}, "gotsl")
+	var want bytes.Buffer
+	want.WriteString("MESSAGE\n")
+	binary.Write(&want, binary.LittleEndian, uint64(len("line1\nline2")))
+	want.WriteString("line1\nline2\nPRIORITY=3\nSYSLOG_IDENTIFIER=gotsl\nGOTS_OPERATOR=alice\n")
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %q, want %q", got, want.Bytes())
+	}
+}
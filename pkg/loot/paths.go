@@ -0,0 +1,98 @@
+// Package loot decides where files retrieved from clients are stored on the
+// listener host. Remote paths are attacker-influenced (a compromised or hostile
+// client chooses file names), so nothing derived from them may escape the
+// local directory it is meant for.
+package loot
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxNameLen keeps each path component within common file system limits.
+const maxNameLen = 200
+
+// ErrOutsideRoot is returned when a path would resolve outside its root.
+var ErrOutsideRoot = errors.New("path escapes the loot directory")
+
+// SanitizeName returns a safe local file name for the last element of a
+// remote path, which may use / or \ separators. Control characters and
+// characters invalid on Windows are replaced, and names that are empty or
+// only dots become "download".
+func SanitizeName(remotePath string) string {
+	parts := splitRemote(remotePath)
+	if len(parts) == 0 {
+		return "download"
+	}
+	return SafeComponent(parts[len(parts)-1])
+}
+
+// RelPath turns a remote path into a relative local path that keeps its
+// directory structure: "C:\Users\bob\..\x.txt" becomes "C/Users/bob/x.txt"
+// (with the local separator). "." and ".." elements are dropped, so the
+// result can never climb out of the directory it is joined to.
+func RelPath(remotePath string) string {
+	var clean []string
+	for _, p := range splitRemote(remotePath) {
+		clean = append(clean, SafeComponent(p))
+	}
+	if len(clean) == 0 {
+		return "download"
+	}
+	return filepath.Join(clean...)
+}
+
+// Confine joins rel to root and verifies the result stays under root.
+func Confine(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("%w: %s is absolute", ErrOutsideRoot, rel)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	joined := filepath.Join(absRoot, rel)
+	r, err := filepath.Rel(absRoot, joined)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, rel)
+	}
+	return joined, nil
+}
+
+// splitRemote splits on both separators and drops empty, "." and ".."
+// elements. A drive letter such as "C:" becomes "C".
+func splitRemote(remotePath string) []string {
+	fields := strings.FieldsFunc(remotePath, func(r rune) bool { return r == '/' || r == '\\' })
+	parts := fields[:0]
+	for _, f := range fields {
+		f = strings.TrimSuffix(f, ":")
+		if f == "" || strings.Trim(f, ".") == "" {
+			continue
+		}
+		parts = append(parts, f)
+	}
+	return parts
+}
+
+// SafeComponent makes name usable as a single path element. Separators are
+// replaced like other unsafe characters rather than split on.
+func SafeComponent(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	// Windows ignores trailing dots and spaces, which could alias other names
+	name = strings.TrimRight(name, ". ")
+	if len(name) > maxNameLen {
+		name = strings.ToValidUTF8(name[:maxNameLen], "")
+	}
+	if strings.Trim(name, "._ ") == "" {
+		return "download"
+	}
+	return name
+}
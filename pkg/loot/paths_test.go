@@ -0,0 +1,63 @@
+package loot
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	cases := map[string]string{
+		"/etc/passwd":                  "passwd",
+		`C:\Users\bob\secrets.txt`:     "secrets.txt",
+		"../../../../root/.ssh/id_rsa": "id_rsa",
+		"/tmp/..":                      "tmp",
+		"..":                           "download",
+		"":                             "download",
+		"/tmp/evil\x1b[2Jname":         "evil_[2Jname",
+		`/tmp/a<b>c:d|e?f*g"`:          "a_b_c_d_e_f_g_",
+		"/tmp/trailing. . ":            "trailing",
+		"C:":                           "C",
+	}
+	for in, want := range cases {
+		if got := SanitizeName(in); got != want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := SanitizeName("/" + strings.Repeat("a", 300)); len(got) > maxNameLen {
+		t.Errorf("expected name capped at %d bytes, got %d", maxNameLen, len(got))
+	}
+}
+
+func TestRelPathNeverEscapes(t *testing.T) {
+	cases := map[string]string{
+		"/etc/passwd":                        filepath.Join("etc", "passwd"),
+		`C:\Users\bob\..\..\Windows\win.ini`: filepath.Join("C", "Users", "bob", "Windows", "win.ini"),
+		"../../outside":                      "outside",
+		`\\server\share\file`:                filepath.Join("server", "share", "file"),
+		"/":                                  "download",
+	}
+	for in, want := range cases {
+		if got := RelPath(in); got != want {
+			t.Errorf("RelPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConfine(t *testing.T) {
+	root := t.TempDir()
+	path, err := Confine(root, filepath.Join("client", "etc", "passwd"))
+	if err != nil {
+		t.Fatalf("Confine failed: %v", err)
+	}
+	if want := filepath.Join(root, "client", "etc", "passwd"); path != want {
+		t.Errorf("expected %s, got %s", want, path)
+	}
+
+	for _, rel := range []string{"../escape", filepath.Join("a", "..", "..", "escape"), "/etc/passwd"} {
+		if _, err := Confine(root, rel); !errors.Is(err, ErrOutsideRoot) {
+			t.Errorf("Confine(%q): expected ErrOutsideRoot, got %v", rel, err)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package pcap writes relayed TCP streams to a pcap file. Payloads are
+// wrapped in synthetic IPv4 and TCP headers with consistent sequence
+// numbers, so Wireshark and tcpdump reassemble and dissect them as if they
+// had been captured on the wire.
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	linkTypeRaw   = 101 // LINKTYPE_RAW: packets start with the IP header
+	snapLen       = 65535
+	headerLen     = 20 + 20 // IPv4 and TCP headers, without options
+	maxSegment    = snapLen - headerLen
+	tcpFIN        = 0x01
+	tcpSYN        = 0x02
+	tcpPSH        = 0x08
+	tcpACK        = 0x10
+	protocolTCP   = 6
+	defaultTTL    = 64
+	syntheticBase = 198<<24 | 18<<16 // 198.18.0.0/15, reserved for benchmarking
+)
+
+// Writer appends packets to a pcap file. A nil *Writer captures nothing, so
+// callers do not need to check whether capturing is enabled.
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	err    error // First write error; nothing is written after it
+	now    func() time.Time
+}
+
+// NewWriter writes the pcap file header to w and returns a Writer for the
+// packets.
+func NewWriter(w io.Writer) (*Writer, error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, now: time.Now}, nil
+}
+
+// Create creates or truncates the pcap file at path, readable by the owner
+// only since it holds decrypted traffic.
+func Create(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write capture file: %w", err)
+	}
+	w.closer = f
+	return w, nil
+}
+
+// Err returns the first write error, if any.
+func (w *Writer) Err() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close closes the underlying file, if any.
+func (w *Writer) Close() error {
+	if w == nil || w.closer == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closer.Close()
+}
+
+// Stream starts a TCP stream from client to server, both "host:port", and
+// writes its handshake. Hosts that are not IPv4 addresses, such as names,
+// IPv6 addresses or pipe names, get a stable address in 198.18.0.0/15.
+func (w *Writer) Stream(client, server string) *Stream {
+	if w == nil {
+		return nil
+	}
+	s := &Stream{w: w, ends: [2]endpoint{parseEndpoint(client), parseEndpoint(server)}}
+	s.segment(0, tcpSYN, nil)
+	s.seq[0]++
+	s.segment(1, tcpSYN|tcpACK, nil)
+	s.seq[1]++
+	s.segment(0, tcpACK, nil)
+	return s
+}
+
+// Stream is one captured TCP connection. A nil *Stream ignores all calls.
+type Stream struct {
+	w      *Writer
+	ends   [2]endpoint // Client, server
+	seq    [2]uint32   // Next sequence number sent by each end
+	closed bool
+}
+
+// Write records data sent by the client, or by the server when fromClient
+// is false.
+func (s *Stream) Write(fromClient bool, data []byte) {
+	if s == nil {
+		return
+	}
+	from := 1
+	if fromClient {
+		from = 0
+	}
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for len(data) > 0 {
+		n := min(len(data), maxSegment)
+		s.segmentLocked(from, tcpPSH|tcpACK, data[:n])
+		s.seq[from] += uint32(n)
+		data = data[n:]
+	}
+}
+
+// Close records both ends closing the connection. Later calls do nothing.
+func (s *Stream) Close() {
+	if s == nil {
+		return
+	}
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.segmentLocked(0, tcpFIN|tcpACK, nil)
+	s.seq[0]++
+	s.segmentLocked(1, tcpFIN|tcpACK, nil)
+	s.seq[1]++
+	s.segmentLocked(0, tcpACK, nil)
+}
+
+func (s *Stream) segment(from int, flags byte, payload []byte) {
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+	s.segmentLocked(from, flags, payload)
+}
+
+// segmentLocked writes one packet from ends[from] to the other end. The
+// caller holds s.w.mu.
+func (s *Stream) segmentLocked(from int, flags byte, payload []byte) {
+	if s.w.err != nil {
+		return
+	}
+	src, dst := s.ends[from], s.ends[1-from]
+	total := headerLen + len(payload)
+	pkt := make([]byte, 16+total)
+
+	ts := s.w.now()
+	binary.LittleEndian.PutUint32(pkt[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(pkt[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(pkt[8:], uint32(total))
+	binary.LittleEndian.PutUint32(pkt[12:], uint32(total))
+
+	ip := pkt[16 : 16+20]
+	ip[0] = 0x45 // Version 4, 5 words
+	binary.BigEndian.PutUint16(ip[2:], uint16(total))
+	ip[6] = 0x40 // Don't fragment
+	ip[8] = defaultTTL
+	ip[9] = protocolTCP
+	copy(ip[12:16], src.addr[:])
+	copy(ip[16:20], dst.addr[:])
+	binary.BigEndian.PutUint16(ip[10:], checksum(0, ip))
+
+	tcp := pkt[16+20:]
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], s.seq[from])
+	if flags&tcpACK != 0 {
+		binary.BigEndian.PutUint32(tcp[8:], s.seq[1-from])
+	}
+	tcp[12] = 5 << 4 // 5 words, no options
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 65535) // Window
+	copy(tcp[20:], payload)
+
+	// The TCP checksum covers a pseudo header of addresses, protocol and length
+	pseudo := make([]byte, 12)
+	copy(pseudo[0:4], src.addr[:])
+	copy(pseudo[4:8], dst.addr[:])
+	pseudo[9] = protocolTCP
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+	binary.BigEndian.PutUint16(tcp[16:], checksum(sum(0, pseudo), tcp))
+
+	_, s.w.err = s.w.w.Write(pkt)
+}
+
+// endpoint is one side of a captured connection.
+type endpoint struct {
+	addr [4]byte
+	port uint16
+}
+
+// parseEndpoint reads "host:port". Anything but an IPv4 host is mapped into
+// the synthetic range by hashing it, so the same name gets the same address
+// in every stream.
+func parseEndpoint(hostport string) endpoint {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	var e endpoint
+	if port, err := strconv.ParseUint(portStr, 10, 16); err == nil {
+		e.port = uint16(port)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && ip.Unmap().Is4() {
+		e.addr = ip.Unmap().As4()
+		return e
+	}
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	binary.BigEndian.PutUint32(e.addr[:], syntheticBase|h.Sum32()&0x1ffff)
+	return e
+}
+
+// sum adds b to the running ones' complement sum s.
+func sum(s uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	return s
+}
+
+// checksum returns the Internet checksum of b, continuing the sum s.
+func checksum(s uint32, b []byte) uint16 {
+	s = sum(s, b)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
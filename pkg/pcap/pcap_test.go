@@ -0,0 +1,170 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// packet is a decoded record of a test capture.
+type packet struct {
+	src, dst         [4]byte
+	srcPort, dstPort uint16
+	seq, ack         uint32
+	flags            byte
+	payload          []byte
+}
+
+func readPackets(t *testing.T, data []byte) []packet {
+	t.Helper()
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 {
+		t.Fatalf("missing pcap header")
+	}
+	if lt := binary.LittleEndian.Uint32(data[20:]); lt != linkTypeRaw {
+		t.Fatalf("unexpected link type %d", lt)
+	}
+	data = data[24:]
+	var pkts []packet
+	for len(data) > 0 {
+		n := int(binary.LittleEndian.Uint32(data[8:]))
+		raw := data[16 : 16+n]
+		data = data[16+n:]
+		ip, tcp := raw[:20], raw[20:]
+		if checksum(0, ip) != 0 {
+			t.Errorf("bad IPv4 checksum")
+		}
+		if int(binary.BigEndian.Uint16(ip[2:])) != n {
+			t.Errorf("IPv4 length %d, record %d", binary.BigEndian.Uint16(ip[2:]), n)
+		}
+		pseudo := make([]byte, 12)
+		copy(pseudo, ip[12:20])
+		pseudo[9] = protocolTCP
+		binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+		if checksum(sum(0, pseudo), tcp) != 0 {
+			t.Errorf("bad TCP checksum")
+		}
+		var p packet
+		copy(p.src[:], ip[12:16])
+		copy(p.dst[:], ip[16:20])
+		p.srcPort = binary.BigEndian.Uint16(tcp[0:])
+		p.dstPort = binary.BigEndian.Uint16(tcp[2:])
+		p.seq = binary.BigEndian.Uint32(tcp[4:])
+		p.ack = binary.BigEndian.Uint32(tcp[8:])
+		p.flags = tcp[13]
+		p.payload = tcp[20:]
+		pkts = append(pkts, p)
+	}
+	return pkts
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	s := w.Stream("127.0.0.1:50000", "10.0.0.5:80")
+	s.Write(true, []byte("GET / HTTP/1.0\r\n\r\n"))
+	s.Write(false, []byte("HTTP/1.0 200 OK\r\n\r\n"))
+	s.Close()
+	s.Close()
+	s.Write(true, []byte("late"))
+
+	pkts := readPackets(t, buf.Bytes())
+	want := []struct {
+		fromClient bool
+		flags      byte
+		seq, ack   uint32
+		payload    string
+	}{
+		{true, tcpSYN, 0, 0, ""},
+		{false, tcpSYN | tcpACK, 0, 1, ""},
+		{true, tcpACK, 1, 1, ""},
+		{true, tcpPSH | tcpACK, 1, 1, "GET / HTTP/1.0\r\n\r\n"},
+		{false, tcpPSH | tcpACK, 1, 19, "HTTP/1.0 200 OK\r\n\r\n"},
+		{true, tcpFIN | tcpACK, 19, 20, ""},
+		{false, tcpFIN | tcpACK, 20, 20, ""},
+		{true, tcpACK, 20, 21, ""},
+	}
+	if len(pkts) != len(want) {
+		t.Fatalf("expected %d packets, got %d", len(want), len(pkts))
+	}
+	client, server := [4]byte{127, 0, 0, 1}, [4]byte{10, 0, 0, 5}
+	for i, w := range want {
+		p := pkts[i]
+		src, srcPort := server, uint16(80)
+		if w.fromClient {
+			src, srcPort = client, 50000
+		}
+		if p.src != src || p.srcPort != srcPort {
+			t.Errorf("packet %d: unexpected source %v:%d", i, p.src, p.srcPort)
+		}
+		if p.flags != w.flags || p.seq != w.seq || p.ack != w.ack || string(p.payload) != w.payload {
+			t.Errorf("packet %d: got flags %#x seq %d ack %d %q, want flags %#x seq %d ack %d %q",
+				i, p.flags, p.seq, p.ack, p.payload, w.flags, w.seq, w.ack, w.payload)
+		}
+	}
+}
+
+func TestStreamSplitsLargeWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	s := w.Stream("127.0.0.1:1", "10.0.0.1:2")
+	s.Write(true, make([]byte, maxSegment+10))
+
+	pkts := readPackets(t, buf.Bytes())[3:]
+	if len(pkts) != 2 || len(pkts[0].payload) != maxSegment || len(pkts[1].payload) != 10 {
+		t.Fatalf("expected segments of %d and 10 bytes, got %d packets", maxSegment, len(pkts))
+	}
+	if pkts[1].seq != 1+maxSegment {
+		t.Errorf("unexpected sequence number %d", pkts[1].seq)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	e := parseEndpoint("192.168.1.10:443")
+	if e.addr != [4]byte{192, 168, 1, 10} || e.port != 443 {
+		t.Errorf("unexpected endpoint %v", e)
+	}
+	for _, hostport := range []string{"intranet.corp:80", "[fd00::1]:22", "pipe:gots"} {
+		e := parseEndpoint(hostport)
+		if e.addr[0] != 198 || e.addr[1]&0xfe != 18 {
+			t.Errorf("%s: expected a synthetic address, got %v", hostport, e.addr)
+		}
+		if parseEndpoint(hostport) != e {
+			t.Errorf("%s: synthetic address is not stable", hostport)
+		}
+	}
+	if parseEndpoint("intranet.corp:80").addr == parseEndpoint("db.corp:80").addr {
+		t.Error("expected different names to get different addresses")
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	s := w.Stream("127.0.0.1:1", "10.0.0.1:2")
+	s.Write(true, []byte("data"))
+	s.Close()
+	if err := w.Close(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnels.pcap")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Stream("127.0.0.1:1", "10.0.0.1:2").Close()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package protocol
+
+import "strings"
+
+// UnixScheme prefixes listen and target addresses that name a Unix domain
+// socket, e.g. "unix:///var/run/gots.sock".
+const UnixScheme = "unix://"
+
+// ICMPScheme prefixes listen and target addresses that tunnel the
+// connection through ICMP echo packets, e.g. "icmp://0.0.0.0" or
+// "icmp://listener.example.com".
+const ICMPScheme = "icmp://"
+
+// SplitAddress returns the network ("tcp", "unix" or "icmp") and address
+// for a listen or target address.
+func SplitAddress(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, UnixScheme); ok {
+		return "unix", path
+	}
+	if host, ok := strings.CutPrefix(addr, ICMPScheme); ok {
+		return "icmp", host
+	}
+	return "tcp", addr
+}
@@ -22,33 +22,97 @@ const (
 	CmdAuthFailed  = "AUTH_FAILED" // Authentication failed
 	CmdIdent       = "IDENT"       // Client session identifier announcement
 	CmdExit        = "exit"
-	CmdStartUpload = "START_UPLOAD"
-	CmdUploadChunk = "UPLOAD_CHUNK"
-	CmdEndUpload   = "END_UPLOAD"
+	CmdTerminate   = "TERMINATE"    // Disconnect and stop reconnecting
+	CmdRekey       = "REKEY"        // Reconnect once idle, resuming the TLS session, for new session keys
+	CmdStartUpload = "START_UPLOAD" // START_UPLOAD [<transfer_id>] <path> <size>
+	CmdUploadChunk = "UPLOAD_CHUNK" // UPLOAD_CHUNK [<transfer_id>] <hex_chunk>
+	CmdEndUpload   = "END_UPLOAD"   // END_UPLOAD [<transfer_id>] <path>
 	CmdDownload    = "DOWNLOAD"
+	CmdPeek        = "PEEK"        // PEEK <bytes> <path>: size and first bytes of a file
+	CmdPrompt      = "PROMPT"      // Command is waiting for a password: PROMPT <hex_prompt>
+	CmdSecret      = "SECRET"      // Answer to PROMPT: SECRET <hex_secret>, or bare SECRET to cancel
+	CmdPrompted    = "PROMPTED"    // PROMPTED <command>: run a shell command whose password prompts are relayed with PROMPT
+	CmdSysinfo     = "SYSINFO"     // SYSINFO [<sleep_ms>]: client resource usage, limits and host facts as key=value lines, after sleeping sleep_ms
+	CmdSignature   = "SIGNATURE"   // SIGNATURE <block_size> <path>: block checksums for a delta upload
+	CmdWalk        = "WALK"        // WALK <dir>: the tree under dir, one "f <size> <sha256> <path>" or "d <path>" line per entry
+	CmdList        = "LIST"        // LIST <dir>: the entries of dir, one "f <size> <name>" or "d <name>" line per entry
+	CmdMkdir       = "MKDIR"       // MKDIR <path>: create a directory and its parents
+	CmdRemove      = "REMOVE"      // REMOVE <path>: delete a file or an empty directory
+	CmdWatch       = "WATCH"       // WATCH <watch_id> [content=1] <path>: report changes to path
+	CmdUnwatch     = "UNWATCH"     // UNWATCH <watch_id>: stop a watch
+	CmdWatchEvent  = "WATCH_EVENT" // WATCH_EVENT <watch_id> <kind> <hex_path> [<content>]: a watched path changed
+	CmdScript      = "SCRIPT"      // SCRIPT <lang> <hex_script>: run a python or powershell script fed on stdin; "OK <interpreter>" then its output
+	CmdRunAs       = "RUNAS"       // RUNAS <hex_user> <hex_password>|- <hex_command>: run a shell command as another local user; "OK <user>" then its output
+	CmdPatch       = "PATCH"       // PATCH <offset> <hex_bytes> <hex_expected>|- <path>: overwrite bytes in place after a backup; "OK", the backup path and the original bytes in hex
+	CmdEnvFile     = "ENV_FILE"    // ENV_FILE <path>|-: source path before every shell command from now on, or stop with -; "OK" or an error
 
 	// PTY Mode Commands
-	CmdPtyMode   = "PTY_MODE"   // Enter PTY shell mode
-	CmdPtyData   = "PTY_DATA"   // PTY data stream
-	CmdPtyResize = "PTY_RESIZE" // PTY window resize
-	CmdPtyExit   = "PTY_EXIT"   // Exit PTY mode
+	CmdPtyMode        = "PTY_MODE"        // Enter PTY shell mode
+	CmdPtyData        = "PTY_DATA"        // PTY data stream
+	CmdPtyResize      = "PTY_RESIZE"      // PTY window resize
+	CmdPtyExit        = "PTY_EXIT"        // Exit PTY mode
+	CmdPtyUnavailable = "PTY_UNAVAILABLE" // Answer to PTY_MODE when no PTY can be started: PTY_UNAVAILABLE <reason> <message>
+	PtyUnsupported    = "unsupported"     // PTY_UNAVAILABLE reason: the client was built without PTY support
+	PtyFailed         = "failed"          // PTY_UNAVAILABLE reason: starting a PTY failed, e.g. without /dev/ptmx or ConPTY
 
 	// Port Forwarding Commands
 	CmdForwardStart = "FORWARD_START" // Start port forward: FORWARD_START <fwd_id> <conn_id> <target_host>:<target_port>
 	CmdForwardData  = "FORWARD_DATA"  // Forward data: FORWARD_DATA <fwd_id> <conn_id> <base64_data>
 	CmdForwardStop  = "FORWARD_STOP"  // Stop port forward connection: FORWARD_STOP <fwd_id> <conn_id>
 
+	// Named pipe bridges on Windows clients. FORWARD_START may also name a
+	// pipe as PipePrefix+<name>, which the client opens instead of dialing.
+	CmdPipeListen = "PIPE_LISTEN" // Serve a named pipe: PIPE_LISTEN <fwd_id> <pipe_name>
+	CmdPipeConn   = "PIPE_CONN"   // A program connected to the pipe: PIPE_CONN <fwd_id> <conn_id>
+	CmdPipeReady  = "PIPE_READY"  // The listener reached the target: PIPE_READY <fwd_id> <conn_id>
+	CmdPipeClose  = "PIPE_CLOSE"  // Stop serving the pipe: PIPE_CLOSE <fwd_id>
+	PipePrefix    = "pipe:"
+
 	// SOCKS5 Proxy Commands
 	CmdSocksStart = "SOCKS_START" // Start SOCKS5 proxy: SOCKS_START <socks_id>
-	CmdSocksConn  = "SOCKS_CONN"  // SOCKS connection: SOCKS_CONN <socks_id> <conn_id> <target_host>:<target_port>
+	CmdSocksConn  = "SOCKS_CONN"  // SOCKS connection: SOCKS_CONN <socks_id> <conn_id> <target_host>:<target_port> [reason=1]
 	CmdSocksOk    = "SOCKS_OK"    // Connection established: SOCKS_OK <socks_id> <conn_id>
 	CmdSocksData  = "SOCKS_DATA"  // SOCKS data: SOCKS_DATA <socks_id> <conn_id> <base64_data>
-	CmdSocksClose = "SOCKS_CLOSE" // Close SOCKS connection: SOCKS_CLOSE <socks_id> <conn_id>
+	CmdSocksClose = "SOCKS_CLOSE" // Close SOCKS connection: SOCKS_CLOSE <socks_id> <conn_id> [<reason>]
+
+	// Why a client could not reach a SOCKS target, sent as the reason in
+	// SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt
+	SocksReasonOpt       = "reason=1"
+	SocksRefused         = "refused"
+	SocksHostUnreachable = "host-unreachable" // Including names that do not resolve
+	SocksNetUnreachable  = "net-unreachable"
+	SocksTimeout         = "timeout"
+	SocksFailed          = "failed" // Any other error
+
+	// Capabilities announced in IDENT as caps=<comma-separated list>. A client
+	// that announces none predates negotiation and supports all of them.
+	CapExec     = "exec"     // Shell commands
+	CapTransfer = "transfer" // Upload and download
+	CapPeek     = "peek"     // File previews with PEEK
+	CapPTY      = "pty"      // Interactive PTY shell
+	CapForward  = "forward"  // Port forwarding
+	CapSocks    = "socks"    // SOCKS5 proxy
+	CapSysinfo  = "sysinfo"  // Resource usage with SYSINFO
+	CapDelta    = "delta"    // Delta uploads with SIGNATURE and delta=<block_size>
+	CapSync     = "sync"     // Directory sync with WALK, MKDIR and REMOVE
+	CapWatch    = "watch"    // File change notifications with WATCH
+	CapPipe     = "pipe"     // Named pipe bridges (Windows)
+	CapProbe    = "probe"    // Host facts and a timed sleep with SYSINFO <sleep_ms>
+	CapList     = "list"     // Structured directory listings with LIST
+	CapScript   = "script"   // Python and PowerShell snippets with SCRIPT
+	CapRunAs    = "runas"    // Commands as another local user with RUNAS
+	CapPatch    = "patch"    // In-place binary patches with PATCH
+	CapRekey    = "rekey"    // Reconnects for new session keys on REKEY
+	CapSocksErr = "sockserr" // Says why a SOCKS connection failed when SOCKS_CONN asks
+	CapEnvFile  = "envfile"  // Environment file sourced before shell commands with ENV_FILE
+	CapPrompt   = "prompt"   // Password prompts of PROMPTED commands relayed with PROMPT
 
 	// Timeouts
 	ReadTimeout     = 1          // second
 	ResponseTimeout = 5          // seconds
 	CommandTimeout  = 120        // seconds for shell command responses
+	PromptTimeout   = 60         // seconds a client waits for the SECRET answering a PROMPT, on top of CommandTimeout
 	DownloadTimeout = 5000000000 // nanoseconds (very large for big files)
 	PingInterval    = 30         // seconds
+	MinPingInterval = 5          // seconds, the shortest interval a client may ask for with ping= in IDENT
 )
@@ -51,3 +51,15 @@ func TestTimeouts(t *testing.T) {
 		t.Error("PingInterval should be positive")
 	}
 }
+
+func TestSplitAddress(t *testing.T) {
+	if network, addr := SplitAddress("unix:///var/run/gots.sock"); network != "unix" || addr != "/var/run/gots.sock" {
+		t.Errorf("unexpected unix split: %s %s", network, addr)
+	}
+	if network, addr := SplitAddress("icmp://10.0.0.1"); network != "icmp" || addr != "10.0.0.1" {
+		t.Errorf("unexpected icmp split: %s %s", network, addr)
+	}
+	if network, addr := SplitAddress("127.0.0.1:9001"); network != "tcp" || addr != "127.0.0.1:9001" {
+		t.Errorf("unexpected tcp split: %s %s", network, addr)
+	}
+}
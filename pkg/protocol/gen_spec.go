@@ -0,0 +1,121 @@
+//go:build ignore
+
+// gen_spec writes spec_gen.go, the table of protocol constants behind
+// Describe, from the constant declarations of this package and their
+// comments. Run it with go generate after changing the protocol.
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const output = "spec_gen.go"
+
+func main() {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != output && name != "gen_spec.go"
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, ok := pkgs["protocol"]
+	if !ok {
+		log.Fatal("package protocol not found")
+	}
+	var files []*ast.File
+	var names []string
+	for name := range p.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, p.Files[name])
+	}
+
+	// Type checking evaluates constant expressions. Errors, such as the
+	// reference to the table being generated, do not affect constants.
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil), Error: func(error) {}}
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf.Check("protocol", fset, files, info)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen_spec.go; DO NOT EDIT.\n\npackage protocol\n\nvar specEntries = []Entry{\n")
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			section := ""
+			if gd.Lparen.IsValid() {
+				section = text(gd.Doc)
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				comment := text(vs.Comment)
+				switch {
+				case !gd.Lparen.IsValid():
+					comment = text(gd.Doc)
+				case vs.Doc != nil:
+					// A comment above a constant heads the ones that follow
+					section = text(vs.Doc)
+				}
+				for _, id := range vs.Names {
+					if !id.IsExported() {
+						continue
+					}
+					c, ok := info.Defs[id].(*types.Const)
+					if !ok {
+						continue
+					}
+					buf.WriteString("\t{Name: " + strconv.Quote(id.Name) + ", Kind: " + kind(id.Name) +
+						", Value: " + value(c.Val()) + ", Section: " + strconv.Quote(section) +
+						", Comment: " + strconv.Quote(comment) + "},\n")
+				}
+			}
+		}
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func text(cg *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
+
+func kind(name string) string {
+	switch {
+	case strings.HasPrefix(name, "Cmd"):
+		return "KindCommand"
+	case strings.HasPrefix(name, "Cap"):
+		return "KindCapability"
+	}
+	return "KindConstant"
+}
+
+func value(v constant.Value) string {
+	if v.Kind() == constant.String {
+		return strconv.Quote(constant.StringVal(v))
+	}
+	return v.ExactString()
+}
@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// A single-packet authorization (SPA) packet is a UDP datagram a client
+// sends before connecting, so a listener that requires one admits its
+// source address for a while. It holds SPAMagic, the Unix time in seconds
+// (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes,
+// IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its
+// public address) and an HMAC-SHA256 over all of these keyed with the SPA
+// key.
+const (
+	SPAMagic      = "GSPA"
+	SPANonceSize  = 16
+	SPAAddrSize   = 16
+	SPAPacketSize = len(SPAMagic) + 8 + SPANonceSize + SPAAddrSize + sha256.Size
+	SPAMaxSkew    = 60 // seconds a packet's time may differ from the listener's clock
+)
+
+var (
+	ErrSPAMalformed = errors.New("not an SPA packet")
+	ErrSPAInvalid   = errors.New("SPA packet has an invalid signature")
+	ErrSPAExpired   = errors.New("SPA packet is too old or from the future")
+	ErrSPASource    = errors.New("SPA packet was sent from another address")
+)
+
+// NewSPAPacket builds an SPA packet for the time now that is only valid
+// from source, or from any address if source is the zero Addr.
+func NewSPAPacket(key []byte, source netip.Addr, now time.Time) ([]byte, error) {
+	b := make([]byte, SPAPacketSize-sha256.Size, SPAPacketSize)
+	copy(b, SPAMagic)
+	binary.BigEndian.PutUint64(b[len(SPAMagic):], uint64(now.Unix()))
+	if _, err := rand.Read(b[len(SPAMagic)+8 : len(SPAMagic)+8+SPANonceSize]); err != nil {
+		return nil, err
+	}
+	if source.IsValid() {
+		addr := source.As16()
+		copy(b[len(SPAMagic)+8+SPANonceSize:], addr[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(b), nil
+}
+
+// VerifySPAPacket checks an SPA packet's signature, time and, if it names
+// one, that it came from its sender's address. It returns the nonce, which
+// the caller must not accept twice.
+func VerifySPAPacket(key, packet []byte, from netip.Addr, now time.Time) ([SPANonceSize]byte, error) {
+	var nonce [SPANonceSize]byte
+	if len(packet) != SPAPacketSize || string(packet[:len(SPAMagic)]) != SPAMagic {
+		return nonce, ErrSPAMalformed
+	}
+	body, sum := packet[:SPAPacketSize-sha256.Size], packet[SPAPacketSize-sha256.Size:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nonce, ErrSPAInvalid
+	}
+	sent := time.Unix(int64(binary.BigEndian.Uint64(body[len(SPAMagic):])), 0)
+	if skew := now.Sub(sent); skew > SPAMaxSkew*time.Second || skew < -SPAMaxSkew*time.Second {
+		return nonce, ErrSPAExpired
+	}
+	source := netip.AddrFrom16([SPAAddrSize]byte(body[len(SPAMagic)+8+SPANonceSize:]))
+	if !source.IsUnspecified() && source.Unmap() != from.Unmap() {
+		return nonce, ErrSPASource
+	}
+	copy(nonce[:], body[len(SPAMagic)+8:])
+	return nonce, nil
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestSPAPacket(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	now := time.Unix(1700000000, 0)
+	from := netip.MustParseAddr("192.0.2.7")
+	packet, err := NewSPAPacket(key, netip.Addr{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet) != SPAPacketSize {
+		t.Fatalf("packet is %d bytes, want %d", len(packet), SPAPacketSize)
+	}
+	nonce, err := VerifySPAPacket(key, packet, from, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("VerifySPAPacket failed: %v", err)
+	}
+	if other, _ := NewSPAPacket(key, netip.Addr{}, now); bytes.Equal(other, packet) {
+		t.Error("expected a fresh nonce in every packet")
+	}
+	if !bytes.Equal(nonce[:], packet[len(SPAMagic)+8:len(SPAMagic)+8+SPANonceSize]) {
+		t.Error("unexpected nonce")
+	}
+
+	if _, err := VerifySPAPacket(bytes.Repeat([]byte{8}, 32), packet, from, now); !errors.Is(err, ErrSPAInvalid) {
+		t.Errorf("expected ErrSPAInvalid for another key, got %v", err)
+	}
+	tampered := append([]byte(nil), packet...)
+	tampered[5] ^= 1
+	if _, err := VerifySPAPacket(key, tampered, from, now); !errors.Is(err, ErrSPAInvalid) {
+		t.Errorf("expected ErrSPAInvalid for a changed time, got %v", err)
+	}
+	if _, err := VerifySPAPacket(key, packet, from, now.Add(2*time.Minute)); !errors.Is(err, ErrSPAExpired) {
+		t.Errorf("expected ErrSPAExpired for an old packet, got %v", err)
+	}
+	if _, err := VerifySPAPacket(key, packet, from, now.Add(-2*time.Minute)); !errors.Is(err, ErrSPAExpired) {
+		t.Errorf("expected ErrSPAExpired for a packet from the future, got %v", err)
+	}
+	if _, err := VerifySPAPacket(key, packet[:20], from, now); !errors.Is(err, ErrSPAMalformed) {
+		t.Errorf("expected ErrSPAMalformed for a short packet, got %v", err)
+	}
+}
+
+func TestSPAPacketBoundToSource(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	now := time.Unix(1700000000, 0)
+	packet, err := NewSPAPacket(key, netip.MustParseAddr("192.0.2.7"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySPAPacket(key, packet, netip.MustParseAddr("::ffff:192.0.2.7"), now); err != nil {
+		t.Errorf("expected the packet to verify from its own address: %v", err)
+	}
+	if _, err := VerifySPAPacket(key, packet, netip.MustParseAddr("198.51.100.1"), now); !errors.Is(err, ErrSPASource) {
+		t.Errorf("expected ErrSPASource from another address, got %v", err)
+	}
+
+	tampered := append([]byte(nil), packet...)
+	tampered[len(SPAMagic)+8+SPANonceSize+15] ^= 1
+	if _, err := VerifySPAPacket(key, tampered, netip.MustParseAddr("192.0.2.6"), now); !errors.Is(err, ErrSPAInvalid) {
+		t.Errorf("expected ErrSPAInvalid for a changed address, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package protocol
+
+//go:generate go run gen_spec.go
+
+// Kinds of entries in a protocol description.
+const (
+	KindCommand    = "command"    // A frame name, sent by the listener or the client
+	KindCapability = "capability" // A feature a client announces in IDENT
+	KindConstant   = "constant"   // A marker, option, limit or timeout
+)
+
+// Entry describes one protocol constant. Comment is the constant's own
+// comment, which for frames gives their syntax; Section is the comment
+// heading the group it belongs to.
+type Entry struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Value   any    `json:"value"`
+	Section string `json:"section,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Spec is a machine-readable description of the protocol, for external
+// implementations and tools that must follow this package.
+type Spec struct {
+	Version      string  `json:"version,omitempty"` // Release of gots that produced it
+	Commands     []Entry `json:"commands"`
+	Capabilities []Entry `json:"capabilities"`
+	Constants    []Entry `json:"constants"`
+}
+
+// Describe returns the protocol description in declaration order. The
+// table behind it is generated from the constants of this package.
+func Describe() Spec {
+	var s Spec
+	for _, e := range specEntries {
+		switch e.Kind {
+		case KindCommand:
+			s.Commands = append(s.Commands, e)
+		case KindCapability:
+			s.Capabilities = append(s.Capabilities, e)
+		default:
+			s.Constants = append(s.Constants, e)
+		}
+	}
+	return s
+}
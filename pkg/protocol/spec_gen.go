@@ -0,0 +1,120 @@
+// Code generated by gen_spec.go; DO NOT EDIT.
+
+package protocol
+
+var specEntries = []Entry{
+	{Name: "UnixScheme", Kind: KindConstant, Value: "unix://", Section: "", Comment: "UnixScheme prefixes listen and target addresses that name a Unix domain socket, e.g. \"unix:///var/run/gots.sock\"."},
+	{Name: "ICMPScheme", Kind: KindConstant, Value: "icmp://", Section: "", Comment: "ICMPScheme prefixes listen and target addresses that tunnel the connection through ICMP echo packets, e.g. \"icmp://0.0.0.0\" or \"icmp://listener.example.com\"."},
+	{Name: "BufferSize1MB", Kind: KindConstant, Value: 1048576, Section: "Buffer sizes", Comment: "1MB buffer for large file transfers"},
+	{Name: "MaxBufferSize", Kind: KindConstant, Value: 10485760, Section: "Buffer sizes", Comment: "10MB maximum accumulated buffer before reset"},
+	{Name: "ChunkSize", Kind: KindConstant, Value: 65536, Section: "Buffer sizes", Comment: "64KB for file upload chunks"},
+	{Name: "EndOfOutputMarker", Kind: KindConstant, Value: "<<<END_OF_OUTPUT>>>", Section: "Protocol delimiters and markers", Comment: ""},
+	{Name: "DataPrefix", Kind: KindConstant, Value: "DATA ", Section: "Protocol delimiters and markers", Comment: ""},
+	{Name: "CmdPing", Kind: KindCommand, Value: "PING", Section: "Commands", Comment: ""},
+	{Name: "CmdPong", Kind: KindCommand, Value: "PONG", Section: "Commands", Comment: ""},
+	{Name: "CmdAuth", Kind: KindCommand, Value: "AUTH", Section: "Commands", Comment: "Authentication handshake"},
+	{Name: "CmdAuthOk", Kind: KindCommand, Value: "AUTH_OK", Section: "Commands", Comment: "Authentication successful"},
+	{Name: "CmdAuthFailed", Kind: KindCommand, Value: "AUTH_FAILED", Section: "Commands", Comment: "Authentication failed"},
+	{Name: "CmdIdent", Kind: KindCommand, Value: "IDENT", Section: "Commands", Comment: "Client session identifier announcement"},
+	{Name: "CmdExit", Kind: KindCommand, Value: "exit", Section: "Commands", Comment: ""},
+	{Name: "CmdTerminate", Kind: KindCommand, Value: "TERMINATE", Section: "Commands", Comment: "Disconnect and stop reconnecting"},
+	{Name: "CmdRekey", Kind: KindCommand, Value: "REKEY", Section: "Commands", Comment: "Reconnect once idle, resuming the TLS session, for new session keys"},
+	{Name: "CmdStartUpload", Kind: KindCommand, Value: "START_UPLOAD", Section: "Commands", Comment: "START_UPLOAD [<transfer_id>] <path> <size>"},
+	{Name: "CmdUploadChunk", Kind: KindCommand, Value: "UPLOAD_CHUNK", Section: "Commands", Comment: "UPLOAD_CHUNK [<transfer_id>] <hex_chunk>"},
+	{Name: "CmdEndUpload", Kind: KindCommand, Value: "END_UPLOAD", Section: "Commands", Comment: "END_UPLOAD [<transfer_id>] <path>"},
+	{Name: "CmdDownload", Kind: KindCommand, Value: "DOWNLOAD", Section: "Commands", Comment: ""},
+	{Name: "CmdPeek", Kind: KindCommand, Value: "PEEK", Section: "Commands", Comment: "PEEK <bytes> <path>: size and first bytes of a file"},
+	{Name: "CmdPrompt", Kind: KindCommand, Value: "PROMPT", Section: "Commands", Comment: "Command is waiting for a password: PROMPT <hex_prompt>"},
+	{Name: "CmdSecret", Kind: KindCommand, Value: "SECRET", Section: "Commands", Comment: "Answer to PROMPT: SECRET <hex_secret>, or bare SECRET to cancel"},
+	{Name: "CmdPrompted", Kind: KindCommand, Value: "PROMPTED", Section: "Commands", Comment: "PROMPTED <command>: run a shell command whose password prompts are relayed with PROMPT"},
+	{Name: "CmdSysinfo", Kind: KindCommand, Value: "SYSINFO", Section: "Commands", Comment: "SYSINFO [<sleep_ms>]: client resource usage, limits and host facts as key=value lines, after sleeping sleep_ms"},
+	{Name: "CmdSignature", Kind: KindCommand, Value: "SIGNATURE", Section: "Commands", Comment: "SIGNATURE <block_size> <path>: block checksums for a delta upload"},
+	{Name: "CmdWalk", Kind: KindCommand, Value: "WALK", Section: "Commands", Comment: "WALK <dir>: the tree under dir, one \"f <size> <sha256> <path>\" or \"d <path>\" line per entry"},
+	{Name: "CmdList", Kind: KindCommand, Value: "LIST", Section: "Commands", Comment: "LIST <dir>: the entries of dir, one \"f <size> <name>\" or \"d <name>\" line per entry"},
+	{Name: "CmdMkdir", Kind: KindCommand, Value: "MKDIR", Section: "Commands", Comment: "MKDIR <path>: create a directory and its parents"},
+	{Name: "CmdRemove", Kind: KindCommand, Value: "REMOVE", Section: "Commands", Comment: "REMOVE <path>: delete a file or an empty directory"},
+	{Name: "CmdWatch", Kind: KindCommand, Value: "WATCH", Section: "Commands", Comment: "WATCH <watch_id> [content=1] <path>: report changes to path"},
+	{Name: "CmdUnwatch", Kind: KindCommand, Value: "UNWATCH", Section: "Commands", Comment: "UNWATCH <watch_id>: stop a watch"},
+	{Name: "CmdWatchEvent", Kind: KindCommand, Value: "WATCH_EVENT", Section: "Commands", Comment: "WATCH_EVENT <watch_id> <kind> <hex_path> [<content>]: a watched path changed"},
+	{Name: "CmdScript", Kind: KindCommand, Value: "SCRIPT", Section: "Commands", Comment: "SCRIPT <lang> <hex_script>: run a python or powershell script fed on stdin; \"OK <interpreter>\" then its output"},
+	{Name: "CmdRunAs", Kind: KindCommand, Value: "RUNAS", Section: "Commands", Comment: "RUNAS <hex_user> <hex_password>|- <hex_command>: run a shell command as another local user; \"OK <user>\" then its output"},
+	{Name: "CmdPatch", Kind: KindCommand, Value: "PATCH", Section: "Commands", Comment: "PATCH <offset> <hex_bytes> <hex_expected>|- <path>: overwrite bytes in place after a backup; \"OK\", the backup path and the original bytes in hex"},
+	{Name: "CmdEnvFile", Kind: KindCommand, Value: "ENV_FILE", Section: "Commands", Comment: "ENV_FILE <path>|-: source path before every shell command from now on, or stop with -; \"OK\" or an error"},
+	{Name: "CmdPtyMode", Kind: KindCommand, Value: "PTY_MODE", Section: "PTY Mode Commands", Comment: "Enter PTY shell mode"},
+	{Name: "CmdPtyData", Kind: KindCommand, Value: "PTY_DATA", Section: "PTY Mode Commands", Comment: "PTY data stream"},
+	{Name: "CmdPtyResize", Kind: KindCommand, Value: "PTY_RESIZE", Section: "PTY Mode Commands", Comment: "PTY window resize"},
+	{Name: "CmdPtyExit", Kind: KindCommand, Value: "PTY_EXIT", Section: "PTY Mode Commands", Comment: "Exit PTY mode"},
+	{Name: "CmdPtyUnavailable", Kind: KindCommand, Value: "PTY_UNAVAILABLE", Section: "PTY Mode Commands", Comment: "Answer to PTY_MODE when no PTY can be started: PTY_UNAVAILABLE <reason> <message>"},
+	{Name: "PtyUnsupported", Kind: KindConstant, Value: "unsupported", Section: "PTY Mode Commands", Comment: "PTY_UNAVAILABLE reason: the client was built without PTY support"},
+	{Name: "PtyFailed", Kind: KindConstant, Value: "failed", Section: "PTY Mode Commands", Comment: "PTY_UNAVAILABLE reason: starting a PTY failed, e.g. without /dev/ptmx or ConPTY"},
+	{Name: "CmdForwardStart", Kind: KindCommand, Value: "FORWARD_START", Section: "Port Forwarding Commands", Comment: "Start port forward: FORWARD_START <fwd_id> <conn_id> <target_host>:<target_port>"},
+	{Name: "CmdForwardData", Kind: KindCommand, Value: "FORWARD_DATA", Section: "Port Forwarding Commands", Comment: "Forward data: FORWARD_DATA <fwd_id> <conn_id> <base64_data>"},
+	{Name: "CmdForwardStop", Kind: KindCommand, Value: "FORWARD_STOP", Section: "Port Forwarding Commands", Comment: "Stop port forward connection: FORWARD_STOP <fwd_id> <conn_id>"},
+	{Name: "CmdPipeListen", Kind: KindCommand, Value: "PIPE_LISTEN", Section: "Named pipe bridges on Windows clients. FORWARD_START may also name a pipe as PipePrefix+<name>, which the client opens instead of dialing.", Comment: "Serve a named pipe: PIPE_LISTEN <fwd_id> <pipe_name>"},
+	{Name: "CmdPipeConn", Kind: KindCommand, Value: "PIPE_CONN", Section: "Named pipe bridges on Windows clients. FORWARD_START may also name a pipe as PipePrefix+<name>, which the client opens instead of dialing.", Comment: "A program connected to the pipe: PIPE_CONN <fwd_id> <conn_id>"},
+	{Name: "CmdPipeReady", Kind: KindCommand, Value: "PIPE_READY", Section: "Named pipe bridges on Windows clients. FORWARD_START may also name a pipe as PipePrefix+<name>, which the client opens instead of dialing.", Comment: "The listener reached the target: PIPE_READY <fwd_id> <conn_id>"},
+	{Name: "CmdPipeClose", Kind: KindCommand, Value: "PIPE_CLOSE", Section: "Named pipe bridges on Windows clients. FORWARD_START may also name a pipe as PipePrefix+<name>, which the client opens instead of dialing.", Comment: "Stop serving the pipe: PIPE_CLOSE <fwd_id>"},
+	{Name: "PipePrefix", Kind: KindConstant, Value: "pipe:", Section: "Named pipe bridges on Windows clients. FORWARD_START may also name a pipe as PipePrefix+<name>, which the client opens instead of dialing.", Comment: ""},
+	{Name: "CmdSocksStart", Kind: KindCommand, Value: "SOCKS_START", Section: "SOCKS5 Proxy Commands", Comment: "Start SOCKS5 proxy: SOCKS_START <socks_id>"},
+	{Name: "CmdSocksConn", Kind: KindCommand, Value: "SOCKS_CONN", Section: "SOCKS5 Proxy Commands", Comment: "SOCKS connection: SOCKS_CONN <socks_id> <conn_id> <target_host>:<target_port> [reason=1]"},
+	{Name: "CmdSocksOk", Kind: KindCommand, Value: "SOCKS_OK", Section: "SOCKS5 Proxy Commands", Comment: "Connection established: SOCKS_OK <socks_id> <conn_id>"},
+	{Name: "CmdSocksData", Kind: KindCommand, Value: "SOCKS_DATA", Section: "SOCKS5 Proxy Commands", Comment: "SOCKS data: SOCKS_DATA <socks_id> <conn_id> <base64_data>"},
+	{Name: "CmdSocksClose", Kind: KindCommand, Value: "SOCKS_CLOSE", Section: "SOCKS5 Proxy Commands", Comment: "Close SOCKS connection: SOCKS_CLOSE <socks_id> <conn_id> [<reason>]"},
+	{Name: "SocksReasonOpt", Kind: KindConstant, Value: "reason=1", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: ""},
+	{Name: "SocksRefused", Kind: KindConstant, Value: "refused", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: ""},
+	{Name: "SocksHostUnreachable", Kind: KindConstant, Value: "host-unreachable", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: "Including names that do not resolve"},
+	{Name: "SocksNetUnreachable", Kind: KindConstant, Value: "net-unreachable", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: ""},
+	{Name: "SocksTimeout", Kind: KindConstant, Value: "timeout", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: ""},
+	{Name: "SocksFailed", Kind: KindConstant, Value: "failed", Section: "Why a client could not reach a SOCKS target, sent as the reason in SOCKS_CLOSE when the SOCKS_CONN ended with SocksReasonOpt", Comment: "Any other error"},
+	{Name: "CapExec", Kind: KindCapability, Value: "exec", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Shell commands"},
+	{Name: "CapTransfer", Kind: KindCapability, Value: "transfer", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Upload and download"},
+	{Name: "CapPeek", Kind: KindCapability, Value: "peek", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "File previews with PEEK"},
+	{Name: "CapPTY", Kind: KindCapability, Value: "pty", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Interactive PTY shell"},
+	{Name: "CapForward", Kind: KindCapability, Value: "forward", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Port forwarding"},
+	{Name: "CapSocks", Kind: KindCapability, Value: "socks", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "SOCKS5 proxy"},
+	{Name: "CapSysinfo", Kind: KindCapability, Value: "sysinfo", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Resource usage with SYSINFO"},
+	{Name: "CapDelta", Kind: KindCapability, Value: "delta", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Delta uploads with SIGNATURE and delta=<block_size>"},
+	{Name: "CapSync", Kind: KindCapability, Value: "sync", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Directory sync with WALK, MKDIR and REMOVE"},
+	{Name: "CapWatch", Kind: KindCapability, Value: "watch", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "File change notifications with WATCH"},
+	{Name: "CapPipe", Kind: KindCapability, Value: "pipe", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Named pipe bridges (Windows)"},
+	{Name: "CapProbe", Kind: KindCapability, Value: "probe", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Host facts and a timed sleep with SYSINFO <sleep_ms>"},
+	{Name: "CapList", Kind: KindCapability, Value: "list", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Structured directory listings with LIST"},
+	{Name: "CapScript", Kind: KindCapability, Value: "script", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Python and PowerShell snippets with SCRIPT"},
+	{Name: "CapRunAs", Kind: KindCapability, Value: "runas", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Commands as another local user with RUNAS"},
+	{Name: "CapPatch", Kind: KindCapability, Value: "patch", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "In-place binary patches with PATCH"},
+	{Name: "CapRekey", Kind: KindCapability, Value: "rekey", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Reconnects for new session keys on REKEY"},
+	{Name: "CapSocksErr", Kind: KindCapability, Value: "sockserr", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Says why a SOCKS connection failed when SOCKS_CONN asks"},
+	{Name: "CapEnvFile", Kind: KindCapability, Value: "envfile", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Environment file sourced before shell commands with ENV_FILE"},
+	{Name: "CapPrompt", Kind: KindCapability, Value: "prompt", Section: "Capabilities announced in IDENT as caps=<comma-separated list>. A client that announces none predates negotiation and supports all of them.", Comment: "Password prompts of PROMPTED commands relayed with PROMPT"},
+	{Name: "ReadTimeout", Kind: KindConstant, Value: 1, Section: "Timeouts", Comment: "second"},
+	{Name: "ResponseTimeout", Kind: KindConstant, Value: 5, Section: "Timeouts", Comment: "seconds"},
+	{Name: "CommandTimeout", Kind: KindConstant, Value: 120, Section: "Timeouts", Comment: "seconds for shell command responses"},
+	{Name: "PromptTimeout", Kind: KindConstant, Value: 60, Section: "Timeouts", Comment: "seconds a client waits for the SECRET answering a PROMPT, on top of CommandTimeout"},
+	{Name: "DownloadTimeout", Kind: KindConstant, Value: 5000000000, Section: "Timeouts", Comment: "nanoseconds (very large for big files)"},
+	{Name: "PingInterval", Kind: KindConstant, Value: 30, Section: "Timeouts", Comment: "seconds"},
+	{Name: "MinPingInterval", Kind: KindConstant, Value: 5, Section: "Timeouts", Comment: "seconds, the shortest interval a client may ask for with ping= in IDENT"},
+	{Name: "SPAMagic", Kind: KindConstant, Value: "GSPA", Section: "A single-packet authorization (SPA) packet is a UDP datagram a client sends before connecting, so a listener that requires one admits its source address for a while. It holds SPAMagic, the Unix time in seconds (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes, IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its public address) and an HMAC-SHA256 over all of these keyed with the SPA key.", Comment: ""},
+	{Name: "SPANonceSize", Kind: KindConstant, Value: 16, Section: "A single-packet authorization (SPA) packet is a UDP datagram a client sends before connecting, so a listener that requires one admits its source address for a while. It holds SPAMagic, the Unix time in seconds (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes, IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its public address) and an HMAC-SHA256 over all of these keyed with the SPA key.", Comment: ""},
+	{Name: "SPAAddrSize", Kind: KindConstant, Value: 16, Section: "A single-packet authorization (SPA) packet is a UDP datagram a client sends before connecting, so a listener that requires one admits its source address for a while. It holds SPAMagic, the Unix time in seconds (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes, IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its public address) and an HMAC-SHA256 over all of these keyed with the SPA key.", Comment: ""},
+	{Name: "SPAPacketSize", Kind: KindConstant, Value: 76, Section: "A single-packet authorization (SPA) packet is a UDP datagram a client sends before connecting, so a listener that requires one admits its source address for a while. It holds SPAMagic, the Unix time in seconds (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes, IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its public address) and an HMAC-SHA256 over all of these keyed with the SPA key.", Comment: ""},
+	{Name: "SPAMaxSkew", Kind: KindConstant, Value: 60, Section: "A single-packet authorization (SPA) packet is a UDP datagram a client sends before connecting, so a listener that requires one admits its source address for a while. It holds SPAMagic, the Unix time in seconds (8 bytes, big endian), a random nonce, the sender's IP address (16 bytes, IPv4 as IPv4-mapped IPv6, all zero when the sender does not know its public address) and an HMAC-SHA256 over all of these keyed with the SPA key.", Comment: "seconds a packet's time may differ from the listener's clock"},
+	{Name: "KindCommand", Kind: KindConstant, Value: "command", Section: "Kinds of entries in a protocol description.", Comment: "A frame name, sent by the listener or the client"},
+	{Name: "KindCapability", Kind: KindConstant, Value: "capability", Section: "Kinds of entries in a protocol description.", Comment: "A feature a client announces in IDENT"},
+	{Name: "KindConstant", Kind: KindConstant, Value: "constant", Section: "Kinds of entries in a protocol description.", Comment: "A marker, option, limit or timeout"},
+	{Name: "TransferIDLen", Kind: KindConstant, Value: 16, Section: "", Comment: "TransferIDLen is the length of a transfer ID: 8 random bytes, hex encoded."},
+	{Name: "OptMaxSize", Kind: KindConstant, Value: "max", Section: "Transfer frames may carry \"key=value\" options ahead of the path: DOWNLOAD [max=<bytes>] [codec=<name>] <path> START_UPLOAD [<transfer_id>] [exists=<policy>] [delta=<block_size>] [codec=<name>] <path> <size> Clients treat a missing option as no limit, OverwriteAlways and the gzip codec, which is how older listeners behave. With delta the payload is a delta against the file at path, made from the reply to SIGNATURE with that block size. codec names how the DATA reply or the upload chunks are encoded, one of the codecs the client announced.", Comment: ""},
+	{Name: "OptExists", Kind: KindConstant, Value: "exists", Section: "Transfer frames may carry \"key=value\" options ahead of the path: DOWNLOAD [max=<bytes>] [codec=<name>] <path> START_UPLOAD [<transfer_id>] [exists=<policy>] [delta=<block_size>] [codec=<name>] <path> <size> Clients treat a missing option as no limit, OverwriteAlways and the gzip codec, which is how older listeners behave. With delta the payload is a delta against the file at path, made from the reply to SIGNATURE with that block size. codec names how the DATA reply or the upload chunks are encoded, one of the codecs the client announced.", Comment: ""},
+	{Name: "OptDelta", Kind: KindConstant, Value: "delta", Section: "Transfer frames may carry \"key=value\" options ahead of the path: DOWNLOAD [max=<bytes>] [codec=<name>] <path> START_UPLOAD [<transfer_id>] [exists=<policy>] [delta=<block_size>] [codec=<name>] <path> <size> Clients treat a missing option as no limit, OverwriteAlways and the gzip codec, which is how older listeners behave. With delta the payload is a delta against the file at path, made from the reply to SIGNATURE with that block size. codec names how the DATA reply or the upload chunks are encoded, one of the codecs the client announced.", Comment: ""},
+	{Name: "OptCodec", Kind: KindConstant, Value: "codec", Section: "Transfer frames may carry \"key=value\" options ahead of the path: DOWNLOAD [max=<bytes>] [codec=<name>] <path> START_UPLOAD [<transfer_id>] [exists=<policy>] [delta=<block_size>] [codec=<name>] <path> <size> Clients treat a missing option as no limit, OverwriteAlways and the gzip codec, which is how older listeners behave. With delta the payload is a delta against the file at path, made from the reply to SIGNATURE with that block size. codec names how the DATA reply or the upload chunks are encoded, one of the codecs the client announced.", Comment: ""},
+	{Name: "IdentCodecs", Kind: KindConstant, Value: "codecs", Section: "Limits a client announces in IDENT next to caps=, so that the listener refuses up front what the client would reject. A client that announces none predates negotiation: it reads gzip payloads only and sets no limits.", Comment: "Payload codecs the client reads, preferred first"},
+	{Name: "IdentFrame", Kind: KindConstant, Value: "frame", Section: "Limits a client announces in IDENT next to caps=, so that the listener refuses up front what the client would reject. A client that announces none predates negotiation: it reads gzip payloads only and sets no limits.", Comment: "Longest line in bytes the client reads"},
+	{Name: "IdentTransfer", Kind: KindConstant, Value: "xfer", Section: "Limits a client announces in IDENT next to caps=, so that the listener refuses up front what the client would reject. A client that announces none predates negotiation: it reads gzip payloads only and sets no limits.", Comment: "Largest file in bytes the client uploads or downloads"},
+	{Name: "OverwriteFail", Kind: KindConstant, Value: "fail", Section: "Overwrite policies for an upload whose destination already exists.", Comment: "Refuse the upload"},
+	{Name: "OverwriteAlways", Kind: KindConstant, Value: "overwrite", Section: "Overwrite policies for an upload whose destination already exists.", Comment: "Replace the existing file"},
+	{Name: "OverwriteRename", Kind: KindConstant, Value: "rename", Section: "Overwrite policies for an upload whose destination already exists.", Comment: "Upload to a free name next to it instead"},
+	{Name: "OptContent", Kind: KindConstant, Value: "content", Section: "A WATCH may ask for the new content of changed files with content=1. It arrives in WATCH_EVENT compressed like a download, for files of at most MaxWatchContent bytes.", Comment: ""},
+	{Name: "MaxWatchContent", Kind: KindConstant, Value: 65536, Section: "A WATCH may ask for the new content of changed files with content=1. It arrives in WATCH_EVENT compressed like a download, for files of at most MaxWatchContent bytes.", Comment: ""},
+	{Name: "WatchCreated", Kind: KindConstant, Value: "created", Section: "Kinds of change reported in WATCH_EVENT.", Comment: ""},
+	{Name: "WatchModified", Kind: KindConstant, Value: "modified", Section: "Kinds of change reported in WATCH_EVENT.", Comment: ""},
+	{Name: "WatchRemoved", Kind: KindConstant, Value: "removed", Section: "Kinds of change reported in WATCH_EVENT.", Comment: ""},
+}
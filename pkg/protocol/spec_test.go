@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSpecUpToDate fails when a constant was added or removed without
+// running go generate.
+func TestSpecUpToDate(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != "gen_spec.go"
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared := make(map[string]bool)
+	for _, f := range pkgs["protocol"].Files {
+		for _, decl := range f.Decls {
+			if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+				for _, spec := range gd.Specs {
+					for _, id := range spec.(*ast.ValueSpec).Names {
+						if id.IsExported() {
+							declared[id.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	described := make(map[string]bool)
+	for _, e := range specEntries {
+		described[e.Name] = true
+		if !declared[e.Name] {
+			t.Errorf("%s is described but no longer declared; run go generate", e.Name)
+		}
+	}
+	for name := range declared {
+		if !described[name] {
+			t.Errorf("%s is not described; run go generate", name)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	s := Describe()
+	find := func(entries []Entry, name string) *Entry {
+		for i := range entries {
+			if entries[i].Name == name {
+				return &entries[i]
+			}
+		}
+		return nil
+	}
+	if e := find(s.Commands, "CmdPeek"); e == nil || e.Value != CmdPeek || !strings.HasPrefix(e.Comment, "PEEK <bytes>") {
+		t.Errorf("unexpected CmdPeek entry %+v", e)
+	}
+	if e := find(s.Capabilities, "CapWatch"); e == nil || e.Value != CapWatch {
+		t.Errorf("unexpected CapWatch entry %+v", e)
+	}
+	if e := find(s.Constants, "ChunkSize"); e == nil || e.Value != ChunkSize || e.Section != "Buffer sizes" {
+		t.Errorf("unexpected ChunkSize entry %+v", e)
+	}
+}
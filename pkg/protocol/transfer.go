@@ -0,0 +1,70 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// TransferIDLen is the length of a transfer ID: 8 random bytes, hex encoded.
+const TransferIDLen = 16
+
+// NewTransferID returns a random ID for one upload. It is carried in
+// START_UPLOAD, UPLOAD_CHUNK and END_UPLOAD so that concurrent uploads to a
+// client never mix their chunks.
+func NewTransferID() string {
+	b := make([]byte, TransferIDLen/2)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsTransferID reports whether s has the form of a transfer ID. Upload
+// frames from older listeners carry none, and their first field is a path.
+func IsTransferID(s string) bool {
+	if len(s) != TransferIDLen {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Transfer frames may carry "key=value" options ahead of the path:
+//
+//	DOWNLOAD [max=<bytes>] [codec=<name>] <path>
+//	START_UPLOAD [<transfer_id>] [exists=<policy>] [delta=<block_size>] [codec=<name>] <path> <size>
+//
+// Clients treat a missing option as no limit, OverwriteAlways and the gzip
+// codec, which is how older listeners behave. With delta the payload is a
+// delta against the file at path, made from the reply to SIGNATURE with
+// that block size. codec names how the DATA reply or the upload chunks are
+// encoded, one of the codecs the client announced.
+const (
+	OptMaxSize = "max"
+	OptExists  = "exists"
+	OptDelta   = "delta"
+	OptCodec   = "codec"
+)
+
+// Limits a client announces in IDENT next to caps=, so that the listener
+// refuses up front what the client would reject. A client that announces
+// none predates negotiation: it reads gzip payloads only and sets no limits.
+const (
+	IdentCodecs   = "codecs" // Payload codecs the client reads, preferred first
+	IdentFrame    = "frame"  // Longest line in bytes the client reads
+	IdentTransfer = "xfer"   // Largest file in bytes the client uploads or downloads
+)
+
+// Overwrite policies for an upload whose destination already exists.
+const (
+	OverwriteFail   = "fail"      // Refuse the upload
+	OverwriteAlways = "overwrite" // Replace the existing file
+	OverwriteRename = "rename"    // Upload to a free name next to it instead
+)
+
+// IsOverwritePolicy reports whether s is one of the overwrite policies.
+func IsOverwritePolicy(s string) bool {
+	return s == OverwriteFail || s == OverwriteAlways || s == OverwriteRename
+}
@@ -0,0 +1,21 @@
+package protocol
+
+import "testing"
+
+func TestNewTransferID(t *testing.T) {
+	a, b := NewTransferID(), NewTransferID()
+	if !IsTransferID(a) || !IsTransferID(b) {
+		t.Fatalf("generated IDs not recognised: %q %q", a, b)
+	}
+	if a == b {
+		t.Errorf("expected distinct IDs, got %q twice", a)
+	}
+}
+
+func TestIsTransferID(t *testing.T) {
+	for _, s := range []string{"/tmp/file", "0123456789abcdeF", "0123456789abcde", ""} {
+		if IsTransferID(s) {
+			t.Errorf("IsTransferID(%q) = true, want false", s)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package protocol
+
+// A WATCH may ask for the new content of changed files with content=1. It
+// arrives in WATCH_EVENT compressed like a download, for files of at most
+// MaxWatchContent bytes.
+const (
+	OptContent      = "content"
+	MaxWatchContent = 64 << 10
+)
+
+// Kinds of change reported in WATCH_EVENT.
+const (
+	WatchCreated  = "created"
+	WatchModified = "modified"
+	WatchRemoved  = "removed"
+)
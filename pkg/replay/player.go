@@ -0,0 +1,121 @@
+package replay
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// playerAddr is the address of both ends of a replayed connection.
+type playerAddr string
+
+func (a playerAddr) Network() string { return "replay" }
+func (a playerAddr) String() string  { return string(a) }
+
+// Player is a connection that replays what one side of a recorded session
+// sent. Reads return the recorded data in order, regardless of the original
+// timing; writes go to a sink. Once the recording is used up, reads block
+// until Close, so the reading side has finished with all of it by the time
+// Done is closed.
+type Player struct {
+	frames []Frame
+	sink   func([]byte)
+	mu     sync.Mutex
+	rest   []byte // Unread part of the current frame
+	done   chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	doneMu sync.Once
+}
+
+// NewPlayer replays the frames sent by side from, FromClient or
+// FromListener. sink receives whatever is written to the player; it may be
+// nil.
+func NewPlayer(frames []Frame, from string, sink func([]byte)) *Player {
+	p := &Player{sink: sink, done: make(chan struct{}), closed: make(chan struct{})}
+	for _, f := range frames {
+		if f.From == from {
+			p.frames = append(p.frames, f)
+		}
+	}
+	return p
+}
+
+func (p *Player) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	for len(p.rest) == 0 && len(p.frames) > 0 {
+		p.rest = p.frames[0].Data
+		p.frames = p.frames[1:]
+	}
+	if len(p.rest) > 0 {
+		n := copy(b, p.rest)
+		p.rest = p.rest[n:]
+		p.mu.Unlock()
+		return n, nil
+	}
+	p.mu.Unlock()
+	p.doneMu.Do(func() { close(p.done) })
+	<-p.closed
+	return 0, io.EOF
+}
+
+func (p *Player) Write(b []byte) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if p.sink != nil {
+		p.sink(append([]byte(nil), b...))
+	}
+	return len(b), nil
+}
+
+// Done is closed when a read finds the recording used up.
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// Close ends the replay; blocked reads return io.EOF.
+func (p *Player) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *Player) LocalAddr() net.Addr                { return playerAddr("replay:0") }
+func (p *Player) RemoteAddr() net.Addr               { return playerAddr("replay:0") }
+func (p *Player) SetDeadline(t time.Time) error      { return nil }
+func (p *Player) SetReadDeadline(t time.Time) error  { return nil }
+func (p *Player) SetWriteDeadline(t time.Time) error { return nil }
+
+// onceListener hands out a single connection, then behaves as closed.
+type onceListener struct {
+	conn chan net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+// Listen returns a net.Listener whose Accept returns conn once, for
+// replaying a recording through server.Listener.Serve.
+func Listen(conn net.Conn) net.Listener {
+	l := &onceListener{conn: make(chan net.Conn, 1), done: make(chan struct{})}
+	l.conn <- conn
+	return l
+}
+
+func (l *onceListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *onceListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *onceListener) Addr() net.Addr { return playerAddr("replay:0") }
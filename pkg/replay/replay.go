@@ -0,0 +1,204 @@
+// Package replay records the frames of a session to a file and plays them
+// back to the listener or client parsers offline, so that protocol bugs
+// seen in the field can be reproduced and debugged.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// Sides of a session, naming who sent a frame.
+const (
+	FromClient   = "client"
+	FromListener = "listener"
+)
+
+// RedactedSecret replaces the shared secret in recorded AUTH lines.
+const RedactedSecret = "REDACTED"
+
+var authLine = regexp.MustCompile(`(?m)^` + protocol.CmdAuth + ` [^\r\n]*`)
+
+// runAsPassword matches the password of a RUNAS command, which is kept out
+// of recordings like the shared secret. The account it ran as is kept.
+var runAsPassword = regexp.MustCompile(`(?m)^(` + protocol.CmdRunAs + ` \S+ )[0-9a-fA-F]+ `)
+
+// secretLine matches the answer to a password prompt.
+var secretLine = regexp.MustCompile(`(?m)^` + protocol.CmdSecret + ` [^\r\n]*`)
+
+// maxPending bounds how much of an unfinished line is held back before it
+// is recorded anyway.
+const maxPending = protocol.MaxBufferSize
+
+// Frame is the data of one read or write on a recorded connection.
+type Frame struct {
+	Time time.Duration `json:"t"`    // Since the connection was recorded
+	From string        `json:"from"` // FromClient or FromListener
+	Data []byte        `json:"data"`
+}
+
+// recorder is a connection that logs its traffic as JSON lines.
+type recorder struct {
+	net.Conn
+	local string // Side of the recording end, FromClient or FromListener
+	start time.Time
+	mu    sync.Mutex
+	w     io.WriteCloser
+	// pending holds the unfinished last line read or written by each side.
+	// Frames are recorded a line at a time so that a secret split across
+	// two reads is still redacted.
+	pending map[string][]byte
+}
+
+// Record wraps conn so that its traffic is appended to w, one frame per
+// line. side is FromClient or FromListener, depending on which end conn
+// is. Shared secrets and passwords are redacted. Closing the connection closes w.
+func Record(conn net.Conn, side string, w io.WriteCloser) net.Conn {
+	return &recorder{Conn: conn, local: side, start: time.Now(), w: w}
+}
+
+// RecordToDir records conn to a new file in dir, named after the time and
+// the peer's address.
+func RecordToDir(conn net.Conn, side, dir string) (net.Conn, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	peer := strings.Map(func(r rune) rune {
+		if r == ':' || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, conn.RemoteAddr().String())
+	name := fmt.Sprintf("%s_%s.jsonl", time.Now().UTC().Format("20060102T150405.000000000"), peer)
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return Record(conn, side, f), nil
+}
+
+func (r *recorder) remote() string {
+	if r.local == FromClient {
+		return FromListener
+	}
+	return FromClient
+}
+
+// log records data sent by from, up to its last complete line; the rest
+// is kept until the line is finished.
+func (r *recorder) log(from string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[string][]byte)
+	}
+	buf := append(r.pending[from], data...)
+	end := bytes.LastIndexByte(buf, '\n') + 1
+	if end == 0 && len(buf) < maxPending {
+		r.pending[from] = buf
+		return
+	}
+	if end == 0 {
+		end = len(buf)
+	}
+	r.pending[from] = append([]byte(nil), buf[end:]...)
+	r.writeLocked(from, buf[:end])
+}
+
+// writeLocked redacts data and appends it to the recording as one frame.
+func (r *recorder) writeLocked(from string, data []byte) {
+	data = authLine.ReplaceAll(data, []byte(protocol.CmdAuth+" "+RedactedSecret))
+	data = secretLine.ReplaceAll(data, []byte(protocol.CmdSecret+" "+RedactedSecret))
+	data = runAsPassword.ReplaceAll(data, []byte("${1}"+RedactedSecret+" "))
+	line, err := json.Marshal(Frame{Time: time.Since(r.start), From: from, Data: data})
+	if err != nil || r.w == nil {
+		return
+	}
+	r.w.Write(append(line, '\n'))
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if n > 0 {
+		r.log(r.remote(), p[:n])
+	}
+	return n, err
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	n, err := r.Conn.Write(p)
+	if n > 0 {
+		r.log(r.local, p[:n])
+	}
+	return n, err
+}
+
+// NetConn returns the recorded connection, like tls.Conn.NetConn.
+func (r *recorder) NetConn() net.Conn {
+	return r.Conn
+}
+
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	for _, from := range []string{r.local, r.remote()} {
+		if len(r.pending[from]) > 0 {
+			r.writeLocked(from, r.pending[from])
+		}
+	}
+	r.pending = nil
+	if r.w != nil {
+		r.w.Close()
+		r.w = nil
+	}
+	r.mu.Unlock()
+	return r.Conn.Close()
+}
+
+// Load reads a recording.
+func Load(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var frames []Frame
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*protocol.MaxBufferSize)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if frame.From != FromClient && frame.From != FromListener {
+			return nil, fmt.Errorf("%s:%d: unknown side %q", path, n, frame.From)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, scanner.Err()
+}
+
+// Authenticated reports whether the client sent AUTH in a recording, in
+// which case the replaying side must use RedactedSecret as shared secret.
+func Authenticated(frames []Frame) bool {
+	for _, f := range frames {
+		if f.From == FromClient {
+			return strings.HasPrefix(string(f.Data), protocol.CmdAuth+" ")
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordRedactsSecretAndLoads(t *testing.T) {
+	dir := t.TempDir()
+	clientEnd, listenerEnd := net.Pipe()
+	rec, err := RecordToDir(clientEnd, FromClient, dir)
+	if err != nil {
+		t.Fatalf("RecordToDir: %v", err)
+	}
+	go func() {
+		listenerEnd.Read(make([]byte, 64))
+		listenerEnd.Write([]byte("AUTH_OK\n"))
+	}()
+	if _, err := rec.Write([]byte("AUTH hunter2\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 64)
+	if _, err := rec.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	rec.Close()
+	listenerEnd.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected one recording, got %v", files)
+	}
+	raw, _ := os.ReadFile(files[0])
+	if bytes.Contains(raw, []byte("hunter2")) {
+		t.Fatalf("secret leaked into recording: %s", raw)
+	}
+	frames, err := Load(files[0])
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(frames) != 2 || frames[0].From != FromClient || frames[1].From != FromListener {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if string(frames[0].Data) != "AUTH "+RedactedSecret+"\n" {
+		t.Fatalf("unexpected AUTH frame %q", frames[0].Data)
+	}
+	if !Authenticated(frames) {
+		t.Fatal("expected recording to be authenticated")
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestRecordRedactsRunAsPassword(t *testing.T) {
+	var buf bytes.Buffer
+	r := &recorder{local: FromListener, start: time.Now(), w: nopWriteCloser{&buf}}
+	// RUNAS alice hunter2 id
+	r.log(FromListener, []byte("RUNAS 616c696365 68756e74657232 6964\n"))
+	r.log(FromClient, []byte("OK alice uid=1001 gid=1001\n"))
+	if bytes.Contains(buf.Bytes(), []byte("68756e74657232")) {
+		t.Fatalf("runas password leaked into recording: %s", buf.Bytes())
+	}
+	var f Frame
+	line, _, _ := bytes.Cut(buf.Bytes(), []byte("\n"))
+	if err := json.Unmarshal(line, &f); err != nil || string(f.Data) != "RUNAS 616c696365 "+RedactedSecret+" 6964\n" {
+		t.Errorf("unexpected RUNAS frame %q: %v", f.Data, err)
+	}
+}
+
+func TestRecordRedactsSplitLines(t *testing.T) {
+	var buf bytes.Buffer
+	conn, _ := net.Pipe()
+	r := &recorder{Conn: conn, local: FromClient, start: time.Now(), w: nopWriteCloser{&buf}}
+	r.log(FromClient, []byte("AU"))
+	r.log(FromClient, []byte("TH hunter2\nSECRET 68756e"))
+	r.log(FromListener, []byte("OK\n"))
+	r.log(FromClient, []byte("74657232\nwhoami"))
+	r.Close()
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) || bytes.Contains(buf.Bytes(), []byte("68756e")) || bytes.Contains(buf.Bytes(), []byte("74657232")) {
+		t.Fatalf("secret leaked into recording: %s", buf.Bytes())
+	}
+
+	var got []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var f Frame
+		if err := json.Unmarshal(line, &f); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, f.From+": "+string(f.Data))
+	}
+	want := []string{
+		FromClient + ": AUTH " + RedactedSecret + "\n",
+		FromListener + ": OK\n",
+		FromClient + ": SECRET " + RedactedSecret + "\n",
+		FromClient + ": whoami",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected frames %q, got %q", want, got)
+	}
+}
+
+func TestLoadRejectsUnknownSide(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.jsonl")
+	os.WriteFile(path, []byte(`{"t":0,"from":"nobody","data":"eA=="}`+"\n"), 0o600)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unknown side") {
+		t.Fatalf("expected unknown side error, got %v", err)
+	}
+}
+
+func TestPlayerReplaysOneSide(t *testing.T) {
+	frames := []Frame{
+		{From: FromClient, Data: []byte("IDENT abc\n")},
+		{From: FromListener, Data: []byte("ls\n")},
+		{From: FromClient, Data: []byte("out\n")},
+	}
+	var written bytes.Buffer
+	p := NewPlayer(frames, FromClient, func(b []byte) { written.Write(b) })
+	got := make(chan []byte, 1)
+	go func() {
+		var all []byte
+		buf := make([]byte, 16)
+		for {
+			n, err := p.Read(buf)
+			all = append(all, buf[:n]...)
+			if err != nil {
+				got <- all
+				return
+			}
+		}
+	}()
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("player did not finish")
+	}
+	p.Write([]byte("reply\n"))
+	p.Close()
+	if data := <-got; string(data) != "IDENT abc\nout\n" {
+		t.Fatalf("unexpected replay %q", data)
+	}
+	if written.String() != "reply\n" {
+		t.Fatalf("unexpected sink data %q", written.String())
+	}
+	if _, err := p.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF after close, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// ErrPendingApproval is returned for operations on a client an operator
+// has not approved yet.
+var ErrPendingApproval = errors.New("client is pending approval")
+
+// pendingCommands are the commands a pending client may be sent: enough to
+// look at the host and to get rid of it.
+var pendingCommands = map[string]bool{
+	protocol.CmdPing:      true,
+	protocol.CmdSysinfo:   true,
+	protocol.CmdExit:      true,
+	protocol.CmdTerminate: true,
+}
+
+// SetRequireApproval makes new clients wait for an operator to approve
+// them before they accept commands, transfers or tunnels. Until then only
+// SYSINFO is sent to them. Hosts approved before (by machine ID) are
+// approved again when they reconnect.
+func (l *Listener) SetRequireApproval(require bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.requireApproval = require
+}
+
+// Approve lets a pending client be used, and its host whenever it
+// reconnects.
+func (l *Listener) Approve(clientAddr string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.clientConnections[clientAddr]; !ok {
+		return fmt.Errorf("client %s not found", clientAddr)
+	}
+	if l.approved == nil {
+		l.approved = make(map[string]bool)
+	}
+	l.approved[clientAddr] = true
+	if mid := l.clientMetadata[clientAddr].MachineID; mid != "" {
+		if l.approvedHosts == nil {
+			l.approvedHosts = make(map[string]bool)
+		}
+		l.approvedHosts[mid] = true
+	}
+	log.Printf("[+] Client %s approved", clientAddr)
+	go l.runOnConnect(clientAddr)
+	return nil
+}
+
+// PendingApproval reports whether a client waits for an operator to
+// approve it.
+func (l *Listener) PendingApproval(clientAddr string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.pendingLocked(clientAddr)
+}
+
+// CheckApproved returns an error wrapping ErrPendingApproval if a client
+// waits for approval, for operations such as tunnels that are set up
+// before anything is sent to the client.
+func (l *Listener) CheckApproved(clientAddr string) error {
+	if l.PendingApproval(clientAddr) {
+		return fmt.Errorf("%w: %s, use approve first", ErrPendingApproval, clientAddr)
+	}
+	return nil
+}
+
+// pendingLocked is PendingApproval for callers holding the mutex.
+func (l *Listener) pendingLocked(clientAddr string) bool {
+	if !l.requireApproval || l.approved[clientAddr] {
+		return false
+	}
+	mid := l.clientMetadata[clientAddr].MachineID
+	return mid == "" || !l.approvedHosts[mid]
+}
+
+// allowedWhilePending reports whether cmd may be sent to a pending client.
+func allowedWhilePending(cmd string) bool {
+	name, _, _ := strings.Cut(cmd, " ")
+	return pendingCommands[name]
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestApproval(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	clientAddr := "10.0.0.1:1000"
+	cmdChan := make(chan string, 10)
+	l.clientConnections[clientAddr] = cmdChan
+	l.clientMetadata[clientAddr] = ClientMetadata{MachineID: "abcd"}
+
+	if l.PendingApproval(clientAddr) {
+		t.Fatal("clients must not be pending unless approval is required")
+	}
+	l.SetRequireApproval(true)
+	if !l.PendingApproval(clientAddr) {
+		t.Fatal("expected a new client to be pending")
+	}
+
+	if err := l.SendCommand(clientAddr, "whoami"); !errors.Is(err, ErrPendingApproval) {
+		t.Fatalf("expected ErrPendingApproval for a command, got %v", err)
+	}
+	if err := l.SendCommand(clientAddr, protocol.CmdForwardStart+" fwd-1 c1 10.0.0.5:80"); !errors.Is(err, ErrPendingApproval) {
+		t.Fatalf("expected ErrPendingApproval for a tunnel, got %v", err)
+	}
+	if err := l.CheckApproved(clientAddr); !errors.Is(err, ErrPendingApproval) {
+		t.Fatalf("expected CheckApproved to fail, got %v", err)
+	}
+	if err := l.SendCommand(clientAddr, protocol.CmdSysinfo); err != nil {
+		t.Fatalf("SYSINFO must be allowed while pending: %v", err)
+	}
+	if got := <-cmdChan; got != protocol.CmdSysinfo {
+		t.Fatalf("unexpected command %q", got)
+	}
+
+	if err := l.Approve("10.0.0.9:9"); err == nil {
+		t.Error("expected an error approving an unknown client")
+	}
+	if err := l.Approve(clientAddr); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if err := l.SendCommand(clientAddr, "whoami"); err != nil {
+		t.Fatalf("approved client refused a command: %v", err)
+	}
+
+	// A reconnect of the approved host is approved, other hosts are not
+	l.clientMetadata["10.0.0.1:2000"] = ClientMetadata{MachineID: "abcd"}
+	l.clientMetadata["10.0.0.2:1000"] = ClientMetadata{MachineID: "ef01"}
+	if l.PendingApproval("10.0.0.1:2000") {
+		t.Error("expected the reconnected host to be approved")
+	}
+	if !l.PendingApproval("10.0.0.2:1000") {
+		t.Error("expected another host to be pending")
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+// maxAssetSessions bounds the connection history kept per asset.
+const maxAssetSessions = 50
+
+// Asset is one logical host, keyed by the machine ID its clients announce.
+// Reconnects, new session IDs and reinstalled binaries on the same host all
+// map to the same asset.
+type Asset struct {
+	MachineID string
+	Hostname  string
+	OS        string
+	Tags      []string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Sessions  []AssetSession // Oldest first, at most maxAssetSessions
+}
+
+// AssetSession is one connection of an asset.
+type AssetSession struct {
+	Address      string
+	Identifier   string
+	IP           string
+	Connected    time.Time
+	Disconnected time.Time // Zero while connected
+}
+
+// Online reports whether the asset has a live connection.
+func (a Asset) Online() bool {
+	for _, s := range a.Sessions {
+		if s.Disconnected.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAssetConnect adds a session to the client's asset. Caller holds l.mutex.
+func (l *Listener) recordAssetConnect(clientAddr string, meta ClientMetadata) {
+	if meta.MachineID == "" {
+		return
+	}
+	// Duplicate sessions of one host share path keys, so the same transfer
+	// queued through two of them does not run twice at once
+	l.scheduler.SetGroup(clientAddr, meta.MachineID)
+	now := time.Now()
+	asset, ok := l.assets[meta.MachineID]
+	if !ok {
+		asset = &Asset{MachineID: meta.MachineID, FirstSeen: now}
+		l.assets[meta.MachineID] = asset
+	}
+	asset.Hostname = meta.Hostname
+	asset.OS = meta.OS
+	asset.Tags = meta.Tags
+	asset.LastSeen = now
+	asset.Sessions = append(asset.Sessions, AssetSession{
+		Address:    clientAddr,
+		Identifier: meta.Identifier,
+		IP:         meta.IP,
+		Connected:  now,
+	})
+	asset.Sessions = trimSessions(asset.Sessions)
+}
+
+// trimSessions drops the oldest closed sessions beyond maxAssetSessions, so
+// that duplicate detection still sees every live one.
+func trimSessions(sessions []AssetSession) []AssetSession {
+	excess := len(sessions) - maxAssetSessions
+	if excess <= 0 {
+		return sessions
+	}
+	kept := make([]AssetSession, 0, maxAssetSessions)
+	for _, s := range sessions {
+		if excess > 0 && !s.Disconnected.IsZero() {
+			excess--
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if excess > 0 {
+		kept = kept[excess:]
+	}
+	return append([]AssetSession(nil), kept...)
+}
+
+// recordAssetDisconnect closes the client's open session. Caller holds l.mutex.
+func (l *Listener) recordAssetDisconnect(clientAddr string, meta ClientMetadata) {
+	l.scheduler.SetGroup(clientAddr, "")
+	asset, ok := l.assets[meta.MachineID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for i := len(asset.Sessions) - 1; i >= 0; i-- {
+		if asset.Sessions[i].Address == clientAddr && asset.Sessions[i].Disconnected.IsZero() {
+			asset.Sessions[i].Disconnected = now
+			asset.LastSeen = now
+			return
+		}
+	}
+}
+
+// Assets returns all known assets, most recently seen first.
+func (l *Listener) Assets() []Asset {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	assets := make([]Asset, 0, len(l.assets))
+	for _, a := range l.assets {
+		assets = append(assets, a.copy())
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if !assets[i].LastSeen.Equal(assets[j].LastSeen) {
+			return assets[i].LastSeen.After(assets[j].LastSeen)
+		}
+		return assets[i].MachineID < assets[j].MachineID
+	})
+	return assets
+}
+
+// GetAsset returns the asset with the given machine ID.
+func (l *Listener) GetAsset(machineID string) (Asset, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	a, ok := l.assets[machineID]
+	if !ok {
+		return Asset{}, false
+	}
+	return a.copy(), true
+}
+
+// DuplicateSessions returns, per machine ID, the addresses of hosts with more
+// than one live session, oldest first. This usually means a second gotsr was
+// started on the same machine.
+func (l *Listener) DuplicateSessions() map[string][]string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	dups := make(map[string][]string)
+	for id, asset := range l.assets {
+		if live := asset.liveAddrs(); len(live) > 1 {
+			dups[id] = live
+		}
+	}
+	return dups
+}
+
+// DuplicateOf returns the oldest live session of the client's host if the
+// client is a newer session of it.
+func (l *Listener) DuplicateOf(clientAddr string) (string, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	asset, ok := l.assets[l.clientMetadata[clientAddr].MachineID]
+	if !ok {
+		return "", false
+	}
+	live := asset.liveAddrs()
+	if len(live) < 2 || live[0] == clientAddr {
+		return "", false
+	}
+	return live[0], true
+}
+
+func (a *Asset) liveAddrs() []string {
+	var addrs []string
+	for _, s := range a.Sessions {
+		if s.Disconnected.IsZero() {
+			addrs = append(addrs, s.Address)
+		}
+	}
+	return addrs
+}
+
+func (a *Asset) copy() Asset {
+	c := *a
+	c.Tags = append([]string(nil), a.Tags...)
+	c.Sessions = append([]AssetSession(nil), a.Sessions...)
+	return c
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssetsConsolidateReconnects(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	first := ClientMetadata{Identifier: "aaaa1111", Hostname: "web1", OS: "linux", MachineID: "0123456789abcdef"}
+	second := ClientMetadata{Identifier: "bbbb2222", Hostname: "web1", OS: "linux", MachineID: "0123456789abcdef", Tags: []string{"prod"}}
+
+	l.mutex.Lock()
+	l.recordAssetConnect("10.0.0.5:40000", first)
+	l.recordAssetDisconnect("10.0.0.5:40000", first)
+	l.recordAssetConnect("10.0.0.5:40001", second)
+	l.recordAssetConnect("10.0.0.6:1", ClientMetadata{Identifier: "cccc3333"}) // No machine ID: not tracked
+	l.mutex.Unlock()
+
+	assets := l.Assets()
+	if len(assets) != 1 {
+		t.Fatalf("expected 1 asset, got %d", len(assets))
+	}
+	a := assets[0]
+	if len(a.Sessions) != 2 || a.Sessions[0].Identifier != "aaaa1111" || a.Sessions[1].Identifier != "bbbb2222" {
+		t.Fatalf("expected both sessions in order, got %+v", a.Sessions)
+	}
+	if a.Sessions[0].Disconnected.IsZero() || !a.Sessions[1].Disconnected.IsZero() {
+		t.Errorf("unexpected session state: %+v", a.Sessions)
+	}
+	if !a.Online() {
+		t.Error("expected asset to be online")
+	}
+	if len(a.Tags) != 1 || a.Tags[0] != "prod" {
+		t.Errorf("expected tags from the latest session, got %v", a.Tags)
+	}
+
+	l.mutex.Lock()
+	for i := 0; i < maxAssetSessions+5; i++ {
+		l.recordAssetConnect("10.0.0.5:1", first)
+	}
+	l.mutex.Unlock()
+	if a, _ := l.GetAsset(first.MachineID); len(a.Sessions) != maxAssetSessions {
+		t.Errorf("expected history capped at %d, got %d", maxAssetSessions, len(a.Sessions))
+	}
+}
+
+func TestDuplicateSessions(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	meta := ClientMetadata{Identifier: "aaaa1111", Hostname: "web1", MachineID: "0123456789abcdef"}
+	dup := ClientMetadata{Identifier: "bbbb2222", Hostname: "web1", MachineID: "0123456789abcdef"}
+
+	l.mutex.Lock()
+	l.clientMetadata["10.0.0.5:1"] = meta
+	l.recordAssetConnect("10.0.0.5:1", meta)
+	l.clientMetadata["10.0.0.5:2"] = dup
+	l.recordAssetConnect("10.0.0.5:2", dup)
+	l.mutex.Unlock()
+
+	dups := l.DuplicateSessions()
+	if got := dups[meta.MachineID]; len(got) != 2 || got[0] != "10.0.0.5:1" || got[1] != "10.0.0.5:2" {
+		t.Fatalf("expected both sessions oldest first, got %v", dups)
+	}
+	if _, ok := l.DuplicateOf("10.0.0.5:1"); ok {
+		t.Error("oldest session should not be a duplicate")
+	}
+	if primary, ok := l.DuplicateOf("10.0.0.5:2"); !ok || primary != "10.0.0.5:1" {
+		t.Errorf("expected duplicate of 10.0.0.5:1, got %q %v", primary, ok)
+	}
+
+	l.mutex.Lock()
+	l.recordAssetDisconnect("10.0.0.5:1", meta)
+	l.mutex.Unlock()
+	if len(l.DuplicateSessions()) != 0 {
+		t.Error("expected no duplicates after one session left")
+	}
+	if _, ok := l.DuplicateOf("10.0.0.5:2"); ok {
+		t.Error("remaining session should not be a duplicate")
+	}
+}
+
+func TestTrimSessionsKeepsLiveSessions(t *testing.T) {
+	now := time.Now()
+	sessions := []AssetSession{{Address: "live", Connected: now}}
+	for i := 0; i < maxAssetSessions; i++ {
+		sessions = append(sessions, AssetSession{Address: "old", Connected: now, Disconnected: now})
+	}
+	trimmed := trimSessions(sessions)
+	if len(trimmed) != maxAssetSessions || trimmed[0].Address != "live" {
+		t.Fatalf("expected live session kept within cap, got %d sessions starting with %q", len(trimmed), trimmed[0].Address)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"time"
+
+	"github.com/frjcomp/gots/pkg/compression"
+)
+
+// CompressionStats counts what compression achieved on some traffic.
+type CompressionStats struct {
+	Payloads   int64
+	Raw        int64         // Uncompressed bytes
+	Compressed int64         // Gzip bytes, before hex encoding
+	Elapsed    time.Duration // Time the listener spent compressing or decompressing
+}
+
+// Ratio returns compressed bytes per raw byte, or 0 without traffic. Values
+// near 1 mean the data was already compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.Raw == 0 {
+		return 0
+	}
+	return float64(s.Compressed) / float64(s.Raw)
+}
+
+func (s *CompressionStats) add(o CompressionStats) {
+	s.Payloads += o.Payloads
+	s.Raw += o.Raw
+	s.Compressed += o.Compressed
+	s.Elapsed += o.Elapsed
+}
+
+// SessionCompression is the compression on a client's connection: Sent
+// covers uploads and shell input, Received downloads, shell output and
+// watched file content.
+type SessionCompression struct {
+	Sent, Received CompressionStats
+}
+
+// RecordCompression adds a compressed or decompressed payload to a client's
+// statistics.
+func (l *Listener) RecordCompression(clientAddr string, sent bool, s CompressionStats) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.clientConnections[clientAddr]; !ok {
+		return // Disconnected meanwhile
+	}
+	if l.compression == nil {
+		l.compression = make(map[string]*SessionCompression)
+	}
+	session := l.compression[clientAddr]
+	if session == nil {
+		session = &SessionCompression{}
+		l.compression[clientAddr] = session
+	}
+	if sent {
+		session.Sent.add(s)
+	} else {
+		session.Received.add(s)
+	}
+}
+
+// CompressionStats returns the compression statistics of connected clients
+// by address.
+func (l *Listener) CompressionStats() map[string]SessionCompression {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stats := make(map[string]SessionCompression, len(l.compression))
+	for addr, s := range l.compression {
+		stats[addr] = *s
+	}
+	return stats
+}
+
+// ResetCompressionStats clears the statistics of all clients.
+func (l *Listener) ResetCompressionStats() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.compression = nil
+}
+
+// decompressFrom decompresses a payload received from a client and records
+// it in the client's statistics.
+func (l *Listener) decompressFrom(clientAddr, payload string) ([]byte, error) {
+	start := time.Now()
+	data, err := compression.DecompressHex(payload)
+	if err == nil {
+		l.RecordCompression(clientAddr, false, CompressionStats{
+			Payloads: 1, Raw: int64(len(data)), Compressed: int64(len(payload) / 2), Elapsed: time.Since(start),
+		})
+	}
+	return data, err
+}
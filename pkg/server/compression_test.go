@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestCompressionStats(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.mutex.Lock()
+	l.clientConnections["10.0.0.1:1000"] = make(chan string, 1)
+	l.mutex.Unlock()
+
+	// PTY output from the client counts as received
+	data := bytes.Repeat([]byte("output "), 1000)
+	encoded, _ := compression.CompressToHex(data)
+	l.handleControlLine("10.0.0.1:1000", nil, protocol.CmdPtyData+" "+encoded)
+	l.RecordCompression("10.0.0.1:1000", true, CompressionStats{Payloads: 1, Raw: 100, Compressed: 50})
+	// Clients that are gone are not tracked
+	l.RecordCompression("10.0.0.2:2000", true, CompressionStats{Payloads: 1, Raw: 100, Compressed: 50})
+
+	stats := l.CompressionStats()
+	if len(stats) != 1 {
+		t.Fatalf("expected stats for one client, got %v", stats)
+	}
+	s := stats["10.0.0.1:1000"]
+	if s.Received.Payloads != 1 || s.Received.Raw != int64(len(data)) || s.Received.Compressed != int64(len(encoded)/2) {
+		t.Errorf("unexpected received stats %+v", s.Received)
+	}
+	if s.Sent.Ratio() != 0.5 {
+		t.Errorf("expected sent ratio 0.5, got %v", s.Sent.Ratio())
+	}
+
+	l.ResetCompressionStats()
+	if stats := l.CompressionStats(); len(stats) != 0 {
+		t.Errorf("expected no stats after reset, got %v", stats)
+	}
+	if (CompressionStats{}).Ratio() != 0 {
+		t.Error("expected ratio 0 without traffic")
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// ErrEngagementOver is returned for commands sent after the engagement end.
+var ErrEngagementOver = errors.New("engagement is over")
+
+// SetEngagementEnd ends the engagement at end. From then on the listener
+// tells connected clients to terminate, turns new ones away the same way
+// and refuses to send them anything else. The zero time means no end.
+func (l *Listener) SetEngagementEnd(end time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.engagementEnd = end
+	if l.engagementTimer != nil {
+		l.engagementTimer.Stop()
+		l.engagementTimer = nil
+	}
+	if !end.IsZero() {
+		l.engagementTimer = time.AfterFunc(time.Until(end), l.endEngagement)
+	}
+}
+
+// EngagementEnd returns when the engagement ends, or the zero time.
+func (l *Listener) EngagementEnd() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.engagementEnd
+}
+
+// EngagementOver reports whether the engagement end has passed.
+func (l *Listener) EngagementOver() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.engagementOverLocked()
+}
+
+// engagementOverLocked is EngagementOver for callers holding the mutex.
+func (l *Listener) engagementOverLocked() bool {
+	return !l.engagementEnd.IsZero() && !time.Now().Before(l.engagementEnd)
+}
+
+// endEngagement tells every connected client to terminate.
+func (l *Listener) endEngagement() {
+	clients := l.GetClients()
+	log.Printf("[!] Engagement ended at %s; terminating %d clients", l.EngagementEnd().Format(time.RFC3339), len(clients))
+	for _, addr := range clients {
+		if err := l.Terminate(addr); err != nil {
+			log.Printf("[-] Failed to terminate %s: %v", addr, err)
+		}
+	}
+}
+
+// allowedAfterEngagement reports whether cmd may be sent once the
+// engagement is over.
+func allowedAfterEngagement(cmd string) bool {
+	return cmd == protocol.CmdTerminate || cmd == protocol.CmdExit
+}
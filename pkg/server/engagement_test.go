@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestEngagementEndTerminatesClients(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	defer l.SetEngagementEnd(time.Time{})
+	clientAddr := "10.0.0.1:1000"
+	cmdChan := make(chan string, 10)
+	l.clientConnections[clientAddr] = cmdChan
+
+	if err := l.SendCommand(clientAddr, "whoami"); err != nil {
+		t.Fatalf("SendCommand failed before the end: %v", err)
+	}
+	<-cmdChan
+
+	l.SetEngagementEnd(time.Now().Add(50 * time.Millisecond))
+	if l.EngagementOver() {
+		t.Fatal("engagement over too early")
+	}
+	select {
+	case cmd := <-cmdChan:
+		if cmd != protocol.CmdTerminate {
+			t.Fatalf("expected %s, got %q", protocol.CmdTerminate, cmd)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client was not terminated at the engagement end")
+	}
+	if !l.EngagementOver() {
+		t.Error("expected the engagement to be over")
+	}
+	if err := l.SendCommand(clientAddr, "whoami"); !errors.Is(err, ErrEngagementOver) {
+		t.Errorf("expected ErrEngagementOver, got %v", err)
+	}
+}
+
+func TestEngagementOverTerminatesNewClients(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.SetEngagementEnd(time.Now().Add(-time.Hour))
+
+	server, client := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		l.handleClient(server)
+		close(done)
+	}()
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != protocol.CmdTerminate {
+		t.Fatalf("expected %s, got %q, %v", protocol.CmdTerminate, line, err)
+	}
+	<-done
+	if len(l.GetClients()) != 0 {
+		t.Errorf("expected the client not to be registered, got %v", l.GetClients())
+	}
+}
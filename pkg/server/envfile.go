@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// SetEnvFile makes a client source the environment file at path, such as
+// PATH adjustments, proxies or the locale, before every shell command, so
+// commands behave the same on minimal targets. The listener remembers the
+// file for the client's host and sets it again whenever the host
+// reconnects. An empty path stops sourcing.
+func (l *Listener) SetEnvFile(clientAddr, path string) error {
+	meta, ok := l.GetClientMetadata(clientAddr)
+	if !ok {
+		return fmt.Errorf("client %s not found", clientAddr)
+	}
+	if !meta.Announces(protocol.CapEnvFile) {
+		return fmt.Errorf("client %s does not support environment files (update the client)", clientAddr)
+	}
+	if err := l.sendEnvFile(clientAddr, path); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	key := l.hostKeyLocked(clientAddr)
+	if path == "" {
+		delete(l.envFiles, key)
+		return nil
+	}
+	if l.envFiles == nil {
+		l.envFiles = make(map[string]string)
+	}
+	l.envFiles[key] = path
+	return nil
+}
+
+// EnvFile returns the environment file a client's host sources before
+// shell commands, or "" if there is none.
+func (l *Listener) EnvFile(clientAddr string) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.envFiles[l.hostKeyLocked(clientAddr)]
+}
+
+// restoreEnvFile sets the environment file of a client's host on a new
+// session of it, whose client starts without one.
+func (l *Listener) restoreEnvFile(clientAddr string) {
+	path := l.EnvFile(clientAddr)
+	if path == "" {
+		return
+	}
+	if meta, _ := l.GetClientMetadata(clientAddr); !meta.Announces(protocol.CapEnvFile) {
+		l.warn(clientAddr, fmt.Sprintf("environment file %s not set: the client does not support it", path))
+		return
+	}
+	if err := l.sendEnvFile(clientAddr, path); err != nil && !errors.Is(err, ErrSchedulerClosed) && l.connected(clientAddr) {
+		l.warn(clientAddr, fmt.Sprintf("environment file %s not set: %v", path, err))
+	}
+}
+
+// sendEnvFile sends ENV_FILE and checks the client's answer.
+func (l *Listener) sendEnvFile(clientAddr, path string) error {
+	arg := path
+	if arg == "" {
+		arg = "-"
+	}
+	return l.scheduler.Run(context.Background(), clientAddr, []string{ResponseKey}, func() error {
+		if err := l.SendCommand(clientAddr, protocol.CmdEnvFile+" "+arg); err != nil {
+			return err
+		}
+		resp, err := l.GetResponse(clientAddr, protocol.ResponseTimeout*time.Second)
+		if err != nil {
+			return err
+		}
+		if out := strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")); out != "OK" {
+			return errors.New(strings.TrimPrefix(out, "Error: "))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestSetEnvFile(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	addr := "10.0.0.1:1000"
+	l.clientMetadata[addr] = ClientMetadata{MachineID: "abcd", Capabilities: []string{protocol.CapExec}}
+	cmds := fakeClient(l, addr, 0)
+	defer close(l.clientConnections[addr])
+
+	if err := l.SetEnvFile(addr, "/tmp/.env"); err == nil {
+		t.Fatal("expected an error for a client without envfile")
+	}
+
+	l.clientMetadata[addr] = ClientMetadata{MachineID: "abcd", Capabilities: []string{protocol.CapExec, protocol.CapEnvFile}}
+	if err := l.SetEnvFile(addr, "/tmp/.env"); err != nil {
+		t.Fatalf("SetEnvFile failed: %v", err)
+	}
+	if got := <-cmds; got != protocol.CmdEnvFile+" /tmp/.env" {
+		t.Errorf("unexpected command %q", got)
+	}
+
+	// A new session of the host gets it again before its on-connect commands
+	next := "10.0.0.1:2000"
+	l.clientMetadata[next] = l.clientMetadata[addr]
+	if got := l.EnvFile(next); got != "/tmp/.env" {
+		t.Fatalf("expected the host's file for the new session, got %q", got)
+	}
+	l.SetOnConnect([]string{"id"})
+	nextCmds := fakeClient(l, next, 0)
+	defer close(l.clientConnections[next])
+	l.runOnConnect(next)
+	for _, want := range []string{protocol.CmdEnvFile + " /tmp/.env", "id"} {
+		select {
+		case got := <-nextCmds:
+			if got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not sent", want)
+		}
+	}
+
+	if err := l.SetEnvFile(next, ""); err != nil {
+		t.Fatalf("clearing failed: %v", err)
+	}
+	if got := <-nextCmds; got != protocol.CmdEnvFile+" -" {
+		t.Errorf("unexpected command %q", got)
+	}
+	if got := l.EnvFile(addr); got != "" {
+		t.Errorf("expected no file once cleared, got %q", got)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/pcap"
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
@@ -16,16 +18,21 @@ type ForwardInfo struct {
 	ID          string
 	LocalAddr   string
 	RemoteAddr  string
-	Listener    net.Listener
+	Listener    net.Listener // Nil for a reverse forward
 	Active      bool
 	ConnCount   int
-	connections map[string]net.Conn // connID -> local connection (from curl)
+	Reverse     bool                    // The client accepts connections on a named pipe and the listener dials LocalAddr
+	connections map[string]net.Conn     // connID -> local connection (from curl)
+	streams     map[string]*pcap.Stream // connID -> capture, when capturing
+	sendFunc    func(string)            // Set for a reverse forward
+	traffic     tunnelCounters
 	mu          sync.Mutex
 }
 
 // ForwardManager manages port forwarding sessions
 type ForwardManager struct {
 	forwards map[string]*ForwardInfo
+	capture  atomic.Pointer[pcap.Writer] // Nil unless tunnel capture is enabled
 	mu       sync.RWMutex
 }
 
@@ -92,7 +99,9 @@ func (fm *ForwardManager) acceptConnections(info *ForwardInfo, sendFunc func(str
 		// Store the local connection so we can write responses to it
 		info.mu.Lock()
 		info.connections[connID] = conn
+		fm.startCapture(info, connID, conn)
 		info.mu.Unlock()
+		info.traffic.open()
 
 		// Send FORWARD_START to client with connID
 		sendFunc(fmt.Sprintf("%s %s %s %s\n", protocol.CmdForwardStart, info.ID, connID, info.RemoteAddr))
@@ -104,10 +113,16 @@ func (fm *ForwardManager) acceptConnections(info *ForwardInfo, sendFunc func(str
 
 // forwardConnection handles bidirectional forwarding for a single connection
 func (fm *ForwardManager) forwardConnection(info *ForwardInfo, connID string, conn net.Conn, sendFunc func(string)) {
+	info.mu.Lock()
+	stream := info.streams[connID]
+	info.mu.Unlock()
 	defer func() {
+		info.traffic.close()
 		conn.Close()
+		stream.Close()
 		info.mu.Lock()
 		delete(info.connections, connID)
+		delete(info.streams, connID)
 		info.mu.Unlock()
 	}()
 
@@ -127,6 +142,8 @@ func (fm *ForwardManager) forwardConnection(info *ForwardInfo, connID string, co
 		}
 
 		if n > 0 {
+			stream.Write(!info.Reverse, buffer[:n])
+			info.traffic.sent.Add(int64(n))
 			// Encode data and send to client
 			encoded := base64.StdEncoding.EncodeToString(buffer[:n])
 			sendFunc(fmt.Sprintf("%s %s %s %s\n", protocol.CmdForwardData, info.ID, connID, encoded))
@@ -151,16 +168,46 @@ func (fm *ForwardManager) HandleForwardData(fwdID, connID, encodedData string) e
 
 	info.mu.Lock()
 	conn, connExists := info.connections[connID]
+	stream := info.streams[connID]
 	info.mu.Unlock()
 
 	if !connExists {
 		return fmt.Errorf("connection %s not found", connID)
 	}
 
+	stream.Write(info.Reverse, data)
+	info.traffic.received.Add(int64(len(data)))
 	_, err = conn.Write(data)
 	return err
 }
 
+// SetCapture writes the traffic of connections accepted from now on to w,
+// decrypted. A nil w stops capturing new connections.
+func (fm *ForwardManager) SetCapture(w *pcap.Writer) {
+	fm.capture.Store(w)
+}
+
+// startCapture starts capturing a new connection when capture is enabled.
+// The program that opened it is the TCP client in the capture: the local
+// one for a forward, the one on the client's pipe for a reverse forward.
+// The caller holds info.mu.
+func (fm *ForwardManager) startCapture(info *ForwardInfo, connID string, conn net.Conn) {
+	w := fm.capture.Load()
+	if w == nil {
+		return
+	}
+	var stream *pcap.Stream
+	if info.Reverse {
+		stream = w.Stream(info.RemoteAddr, info.LocalAddr)
+	} else {
+		stream = w.Stream(conn.RemoteAddr().String(), info.RemoteAddr)
+	}
+	if info.streams == nil {
+		info.streams = make(map[string]*pcap.Stream)
+	}
+	info.streams[connID] = stream
+}
+
 // HandleForwardStop closes a specific forward connection
 func (fm *ForwardManager) HandleForwardStop(fwdID, connID string) error {
 	fm.mu.RLock()
@@ -189,17 +236,33 @@ func (fm *ForwardManager) StopForward(id string) error {
 		return fmt.Errorf("forward %s not found", id)
 	}
 
-	info.mu.Lock()
-	info.Active = false
-	info.mu.Unlock()
-
-	info.Listener.Close()
+	info.close()
 	delete(fm.forwards, id)
 
 	logging.Infof("[+] Stopped forward %s", id)
 	return nil
 }
 
+// close deactivates a forward. A reverse forward has no listener; the
+// client is told to stop serving its pipe instead.
+func (info *ForwardInfo) close() {
+	info.mu.Lock()
+	info.Active = false
+	info.mu.Unlock()
+	if info.Listener != nil {
+		info.Listener.Close()
+	}
+	if info.Reverse {
+		info.sendFunc(fmt.Sprintf("%s %s\n", protocol.CmdPipeClose, info.ID))
+		info.mu.Lock()
+		for connID, conn := range info.connections {
+			conn.Close()
+			delete(info.connections, connID)
+		}
+		info.mu.Unlock()
+	}
+}
+
 // ListForwards returns a list of active forwards
 func (fm *ForwardManager) ListForwards() []*ForwardInfo {
 	fm.mu.RLock()
@@ -218,10 +281,7 @@ func (fm *ForwardManager) StopAll() {
 	defer fm.mu.Unlock()
 
 	for id, info := range fm.forwards {
-		info.mu.Lock()
-		info.Active = false
-		info.mu.Unlock()
-		info.Listener.Close()
+		info.close()
 		delete(fm.forwards, id)
 	}
 }
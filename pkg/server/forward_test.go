@@ -1,9 +1,17 @@
 package server
 
 import (
+	"bytes"
+	"encoding/base64"
+	"io"
 	"net"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/pcap"
+	"github.com/frjcomp/gots/pkg/protocol"
 )
 
 func TestForwardManager_StartForward(t *testing.T) {
@@ -266,3 +274,75 @@ func TestForwardManager_ConnectionCleanup(t *testing.T) {
 		t.Error("Expected forward to be deleted after StopForward")
 	}
 }
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of a capture.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestForwardManager_Capture(t *testing.T) {
+	var out lockedBuffer
+	capture, err := pcap.NewWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := NewForwardManager()
+	defer fm.StopAll()
+	fm.SetCapture(capture)
+
+	sent := make(chan string, 10)
+	if err := fm.StartForward("fwd-1", "0", "10.0.0.5:80", func(msg string) { sent <- msg }); err != nil {
+		t.Fatalf("StartForward failed: %v", err)
+	}
+	info := fm.ListForwards()[0]
+	conn, err := net.Dial("tcp", info.LocalAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("ping"))
+	for msg := range sent {
+		if strings.HasPrefix(msg, protocol.CmdForwardData) {
+			break
+		}
+	}
+	if err := fm.HandleForwardData("fwd-1", "1", base64.StdEncoding.EncodeToString([]byte("pong"))); err != nil {
+		t.Fatalf("HandleForwardData failed: %v", err)
+	}
+	io.ReadFull(conn, make([]byte, 4))
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info.mu.Lock()
+		open := len(info.streams)
+		info.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("capture stream was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	data := out.Bytes()
+	if !bytes.Contains(data, []byte("ping")) || !bytes.Contains(data, []byte("pong")) {
+		t.Error("expected both directions in the capture")
+	}
+	// The server side is the forward's remote address
+	if !bytes.Contains(data, []byte{10, 0, 0, 5, 127, 0, 0, 1}) {
+		t.Error("expected packets from 10.0.0.5 to 127.0.0.1")
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net"
+
+	"github.com/frjcomp/gots/pkg/geoip"
+)
+
+// SetGeoIP sets the databases used to enrich client source IPs. Nil turns
+// enrichment off.
+func (l *Listener) SetGeoIP(r *geoip.Reader) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.geoip = r
+}
+
+// GeoIP returns location and network owner data for a client's source IP.
+// It is empty when no databases are loaded or none covers the address.
+func (l *Listener) GeoIP(clientAddr string) geoip.Info {
+	l.mutex.Lock()
+	r := l.geoip
+	l.mutex.Unlock()
+	host, _, err := net.SplitHostPort(clientAddr)
+	if r == nil || err != nil {
+		return geoip.Info{}
+	}
+	return r.Lookup(net.ParseIP(host))
+}
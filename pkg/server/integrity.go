@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// SetClientHashes makes the listener check on connect that clients run one
+// of the recorded builds, by the SHA-256 of their executable that SYSINFO
+// reports. Clients running anything else, e.g. a binary an antivirus
+// modified or one that was never built for the engagement, are flagged.
+// No hashes disables the check.
+func (l *Listener) SetClientHashes(hashes []string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.clientHashes = make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		l.clientHashes[strings.ToLower(h)] = true
+	}
+}
+
+// IntegrityFlag returns why a client is not running a recorded build, or
+// "" if it is or the check is disabled.
+func (l *Listener) IntegrityFlag(clientAddr string) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.integrityFlags[clientAddr]
+}
+
+// ReadClientHashes reads the SHA-256 hashes of recorded client builds from
+// a file in sha256sum format, one "<hash>  <name>" per line; the name may
+// be left out. Blank lines and lines starting with # are skipped.
+func ReadClientHashes(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var hashes []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if b, err := hex.DecodeString(fields[0]); err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("%s:%d: not a SHA-256 hash: %q", path, n, fields[0])
+		}
+		hashes = append(hashes, strings.ToLower(fields[0]))
+	}
+	return hashes, scanner.Err()
+}
+
+// checkIntegrity asks a client that just identified itself for the hash of
+// its executable and flags it, and notifies the operator, if it is not a
+// recorded build.
+func (l *Listener) checkIntegrity(clientAddr string, meta ClientMetadata) {
+	l.mutex.Lock()
+	enabled := len(l.clientHashes) > 0
+	l.mutex.Unlock()
+	// Older clients would run SYSINFO as a shell command
+	if !enabled || !meta.Announces(protocol.CapSysinfo) {
+		return
+	}
+
+	var hash string
+	err := l.scheduler.Run(context.Background(), clientAddr, []string{ResponseKey}, func() error {
+		if err := l.SendCommand(clientAddr, protocol.CmdSysinfo); err != nil {
+			return err
+		}
+		resp, err := l.GetResponse(clientAddr, protocol.ResponseTimeout*time.Second)
+		if err != nil {
+			return err
+		}
+		info, err := ParseSysinfo(resp)
+		hash = info["sha256"]
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, ErrSchedulerClosed) && l.connected(clientAddr) {
+			l.warn(clientAddr, fmt.Sprintf("integrity check failed: %v", err))
+		}
+		return
+	}
+
+	var flag string
+	l.mutex.Lock()
+	switch {
+	case hash == "":
+		flag = "binary hash not reported"
+	case !l.clientHashes[hash]:
+		flag = "binary " + hash + " is not a recorded build"
+	}
+	if _, ok := l.clientConnections[clientAddr]; ok && flag != "" {
+		if l.integrityFlags == nil {
+			l.integrityFlags = make(map[string]string)
+		}
+		l.integrityFlags[clientAddr] = flag
+	}
+	l.mutex.Unlock()
+	if flag != "" {
+		l.warn(clientAddr, "unexpected client: "+flag)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const recordedHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestReadClientHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client-hashes.sha256")
+	os.WriteFile(path, []byte("# gotsr builds\n"+strings.ToUpper(recordedHash)+"  bin/gotsr\n\n"+recordedHash+"\n"), 0o600)
+	hashes, err := ReadClientHashes(path)
+	if err != nil {
+		t.Fatalf("ReadClientHashes failed: %v", err)
+	}
+	if len(hashes) != 2 || hashes[0] != recordedHash {
+		t.Errorf("unexpected hashes %q", hashes)
+	}
+
+	os.WriteFile(path, []byte("d41d8cd98f00b204e9800998ecf8427e  gotsr.md5\n"), 0o600)
+	if _, err := ReadClientHashes(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("expected an error naming the line, got %v", err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	var warnings []string
+	l.SetWarningHandler(func(_, msg string) { warnings = append(warnings, msg) })
+	meta := ClientMetadata{Capabilities: []string{protocol.CapSysinfo}}
+
+	tests := []struct {
+		addr    string
+		sysinfo string
+		want    string
+	}{
+		{"10.0.0.1:1000", "OK\nsha256=" + recordedHash, ""},
+		{"10.0.0.2:1000", "OK\nsha256=" + strings.Repeat("0", 64), "is not a recorded build"},
+		{"10.0.0.3:1000", "OK\npid=1", "binary hash not reported"},
+	}
+	for _, tt := range tests {
+		cmdChan, respChan := make(chan string, 1), make(chan string, 1)
+		l.clientConnections[tt.addr] = cmdChan
+		l.clientResponses[tt.addr] = respChan
+		respChan <- tt.sysinfo + "\n" + protocol.EndOfOutputMarker
+
+		l.checkIntegrity(tt.addr, meta)
+		if len(cmdChan) != 0 {
+			t.Fatal("expected no SYSINFO while the check is disabled")
+		}
+		l.SetClientHashes([]string{strings.ToUpper(recordedHash)})
+		l.checkIntegrity(tt.addr, meta)
+		l.SetClientHashes(nil)
+
+		if got := l.IntegrityFlag(tt.addr); tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: IntegrityFlag = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "unexpected client") {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+// Job is an operation deferred to a later time, such as a transfer scheduled
+// for the night.
+type Job struct {
+	ID          int
+	ClientAddr  string
+	Description string
+	At          time.Time
+}
+
+type scheduledJob struct {
+	Job
+	keys  []string
+	fn    func(clientAddr string) error
+	timer *time.Timer
+}
+
+// ScheduleAt queues fn to run against a client at the given time, holding
+// keys like Run. A time in the past runs it right away. fn is passed the
+// client the job runs against then, which differs from clientAddr if the
+// job was reassigned. The job is reported to the handler set with
+// SetJobDone once it has run.
+func (s *Scheduler) ScheduleAt(at time.Time, clientAddr, description string, keys []string, fn func(clientAddr string) error) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, ErrSchedulerClosed
+	}
+	s.nextJobID++
+	job := &scheduledJob{
+		Job:  Job{ID: s.nextJobID, ClientAddr: clientAddr, Description: description, At: at},
+		keys: keys,
+		fn:   fn,
+	}
+	s.jobs[job.ID] = job
+	job.timer = time.AfterFunc(time.Until(at), func() { s.runJob(job.ID) })
+	return job.Job, nil
+}
+
+func (s *Scheduler) runJob(id int) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	delete(s.jobs, id)
+	s.mu.Unlock()
+	if !ok {
+		return // Cancelled
+	}
+
+	err := s.Run(context.Background(), job.ClientAddr, job.keys, func() error { return job.fn(job.ClientAddr) })
+
+	s.mu.Lock()
+	done := s.jobDone
+	s.mu.Unlock()
+	if done != nil {
+		done(job.Job, err)
+	}
+}
+
+// Jobs returns the deferred operations that have not started yet, earliest
+// first.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.Job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].At.Equal(jobs[j].At) {
+			return jobs[i].At.Before(jobs[j].At)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// Cancel drops a deferred operation that has not started yet. It reports
+// whether the job was found.
+func (s *Scheduler) Cancel(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return false
+	}
+	job.timer.Stop()
+	delete(s.jobs, id)
+	return true
+}
+
+// Reassign moves the deferred operations of one client that have not
+// started yet to another, e.g. when a session is migrated, and returns
+// them.
+func (s *Scheduler) Reassign(from, to string) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var moved []Job
+	for _, job := range s.jobs {
+		if job.ClientAddr == from {
+			job.ClientAddr = to
+			moved = append(moved, job.Job)
+		}
+	}
+	sort.Slice(moved, func(i, j int) bool { return moved[i].ID < moved[j].ID })
+	return moved
+}
+
+// SetJobDone sets the handler told about every deferred operation that has
+// run, with the error it returned.
+func (s *Scheduler) SetJobDone(fn func(Job, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobDone = fn
+}
+
+// NextTransferWindow returns when the next of the windows opens: now if one
+// is open, otherwise the earliest start. It returns now when there are no
+// windows.
+func NextTransferWindow(windows []config.TransferWindow, now time.Time) time.Time {
+	if len(windows) == 0 {
+		return now
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	var next time.Time
+	for _, w := range windows {
+		open := offset >= w.Start && offset < w.End
+		if w.End < w.Start {
+			open = offset >= w.Start || offset < w.End
+		}
+		if open {
+			return now
+		}
+		start := midnight.Add(w.Start)
+		if !start.After(now) {
+			start = midnight.AddDate(0, 0, 1).Add(w.Start)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
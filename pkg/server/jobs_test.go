@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+func TestSchedulerJobRunsAndNotifies(t *testing.T) {
+	s := NewScheduler(1)
+	done := make(chan error, 1)
+	var doneJob Job
+	s.SetJobDone(func(job Job, err error) {
+		doneJob = job
+		done <- err
+	})
+
+	failure := errors.New("upload failed")
+	job, err := s.ScheduleAt(time.Now().Add(20*time.Millisecond), "c1", "upload a -> b", []string{ResponseKey}, func(string) error {
+		return failure
+	})
+	if err != nil {
+		t.Fatalf("ScheduleAt failed: %v", err)
+	}
+	if jobs := s.Jobs(); len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Fatalf("expected the job to be queued, got %+v", jobs)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, failure) || doneJob.Description != "upload a -> b" {
+			t.Errorf("unexpected completion %+v: %v", doneJob, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+	if len(s.Jobs()) != 0 {
+		t.Error("expected the job to leave the queue once run")
+	}
+}
+
+func TestSchedulerJobCancel(t *testing.T) {
+	s := NewScheduler(1)
+	ran := make(chan struct{}, 2)
+	late, _ := s.ScheduleAt(time.Now().Add(time.Hour), "c1", "late", nil, func(string) error { return nil })
+	soon, _ := s.ScheduleAt(time.Now().Add(30*time.Millisecond), "c1", "soon", nil, func(string) error {
+		ran <- struct{}{}
+		return nil
+	})
+	if jobs := s.Jobs(); len(jobs) != 2 || jobs[0].ID != soon.ID || jobs[1].ID != late.ID {
+		t.Fatalf("expected jobs in time order, got %+v", jobs)
+	}
+	if !s.Cancel(soon.ID) || s.Cancel(soon.ID) {
+		t.Fatal("expected the job to be cancelled exactly once")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(ran) != 0 {
+		t.Error("cancelled job ran")
+	}
+
+	s.Close()
+	if len(s.Jobs()) != 0 {
+		t.Error("expected Close to drop queued jobs")
+	}
+	if _, err := s.ScheduleAt(time.Now(), "c1", "x", nil, func(string) error { return nil }); !errors.Is(err, ErrSchedulerClosed) {
+		t.Errorf("expected ErrSchedulerClosed, got %v", err)
+	}
+}
+
+func TestNextTransferWindow(t *testing.T) {
+	night, _ := config.ParseTransferWindow("01:00-05:00")
+	late, _ := config.ParseTransferWindow("22:30-00:30")
+	windows := []config.TransferWindow{night, late}
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 10, h, m, 0, 0, time.UTC) }
+
+	tests := []struct {
+		now, want time.Time
+	}{
+		{at(2, 0), at(2, 0)},     // Inside a window
+		{at(12, 0), at(22, 30)},  // Next window today
+		{at(23, 59), at(23, 59)}, // Inside a window past midnight
+		{at(0, 15), at(0, 15)},   // ... on the next day
+		{at(0, 45), at(1, 0)},    // Between windows
+		{at(5, 0), at(22, 30)},   // End is exclusive
+		{at(22, 29), at(22, 30)}, // Just before
+	}
+	for _, tt := range tests {
+		if got := NextTransferWindow(windows, tt.now); !got.Equal(tt.want) {
+			t.Errorf("NextTransferWindow at %s = %s, want %s", tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+
+	if got := NextTransferWindow([]config.TransferWindow{night}, at(6, 0)); !got.Equal(at(1, 0).AddDate(0, 0, 1)) {
+		t.Errorf("expected tomorrow's window, got %s", got)
+	}
+	if now := at(6, 0); !NextTransferWindow(nil, now).Equal(now) {
+		t.Error("expected no windows to mean now")
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/frjcomp/gots/pkg/compression"
+)
+
+// ErrTransferTooLarge is returned for a file larger than the client accepts.
+var ErrTransferTooLarge = errors.New("transfer too large")
+
+// ErrFrameTooLarge is returned for a command longer than the client reads.
+var ErrFrameTooLarge = errors.New("command too long")
+
+// Codec returns the best transfer codec the client and the listener share.
+func (m ClientMetadata) Codec() string {
+	return compression.Negotiate(m.Codecs)
+}
+
+// CheckTransfer returns an error if the client announced that it refuses
+// files of size bytes.
+func (m ClientMetadata) CheckTransfer(size int64) error {
+	if m.MaxTransfer > 0 && size > m.MaxTransfer {
+		return fmt.Errorf("%w: %d bytes exceeds the client's limit of %d bytes", ErrTransferTooLarge, size, m.MaxTransfer)
+	}
+	return nil
+}
+
+// checkFrame returns an error if cmd, with its newline, is longer than the
+// client announced it reads. The client would drop it and run what follows
+// as a command of its own.
+func (m ClientMetadata) checkFrame(cmd string) error {
+	if m.MaxFrame > 0 && len(cmd)+1 > m.MaxFrame {
+		return fmt.Errorf("%w: %d bytes exceeds the client's limit of %d bytes", ErrFrameTooLarge, len(cmd)+1, m.MaxFrame)
+	}
+	return nil
+}
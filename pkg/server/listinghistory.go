@@ -0,0 +1,117 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// maxRecordedListings bounds the directories kept per host.
+	maxRecordedListings = 1000
+	// maxListingArchives bounds the hosts whose listings are kept.
+	maxListingArchives = 100
+)
+
+// RecordedListing is a directory listing as it was when it was collected.
+type RecordedListing struct {
+	Dir     string
+	Entries []DirEntry
+	Listed  time.Time
+	Session string // Identifier of the session that listed it
+}
+
+// ListingArchive holds the directory listings collected from one host. It
+// outlives the host's connections, so they can be browsed offline. Hosts
+// are keyed by machine ID, so listings from several sessions of one host
+// add up; each listing keeps its own time.
+type ListingArchive struct {
+	Key      string // Machine ID, or the client address if none was announced
+	Hostname string
+	Client   string // Address of the session that listed most recently
+	Updated  time.Time
+	Listings []RecordedListing // Sorted by directory
+}
+
+// Listing returns the recorded listing of dir.
+func (a ListingArchive) Listing(dir string) (RecordedListing, bool) {
+	dir = cleanListingDir(dir)
+	for _, rl := range a.Listings {
+		if rl.Dir == dir {
+			return rl, true
+		}
+	}
+	return RecordedListing{}, false
+}
+
+type listingArchive struct {
+	hostname string
+	client   string
+	updated  time.Time
+	listings map[string]RecordedListing
+}
+
+// recordListing adds a listing collected from a client to its host's
+// archive, replacing an older one of the same directory.
+func (l *Listener) recordListing(clientAddr, dir string, entries []DirEntry) {
+	meta, _ := l.GetClientMetadata(clientAddr)
+	session := l.GetClientIdentifier(clientAddr)
+	key := meta.MachineID
+	if key == "" {
+		key = clientAddr
+	}
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.listingArchives == nil {
+		l.listingArchives = make(map[string]*listingArchive)
+	}
+	archive, ok := l.listingArchives[key]
+	if !ok {
+		if len(l.listingArchives) >= maxListingArchives {
+			l.dropOldestArchiveLocked()
+		}
+		archive = &listingArchive{listings: make(map[string]RecordedListing)}
+		l.listingArchives[key] = archive
+	}
+	archive.hostname, archive.client, archive.updated = meta.Hostname, clientAddr, now
+	dir = cleanListingDir(dir)
+	if _, ok := archive.listings[dir]; !ok && len(archive.listings) >= maxRecordedListings {
+		oldest := ""
+		for d, rl := range archive.listings {
+			if oldest == "" || rl.Listed.Before(archive.listings[oldest].Listed) {
+				oldest = d
+			}
+		}
+		delete(archive.listings, oldest)
+	}
+	archive.listings[dir] = RecordedListing{Dir: dir, Entries: entries, Listed: now, Session: session}
+}
+
+func (l *Listener) dropOldestArchiveLocked() {
+	oldest := ""
+	for key, a := range l.listingArchives {
+		if oldest == "" || a.updated.Before(l.listingArchives[oldest].updated) {
+			oldest = key
+		}
+	}
+	delete(l.listingArchives, oldest)
+}
+
+// ListingArchives returns the directory listings collected per host, most
+// recently updated first.
+func (l *Listener) ListingArchives() []ListingArchive {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	archives := make([]ListingArchive, 0, len(l.listingArchives))
+	for key, a := range l.listingArchives {
+		archive := ListingArchive{Key: key, Hostname: a.hostname, Client: a.client, Updated: a.updated}
+		for _, rl := range a.listings {
+			archive.Listings = append(archive.Listings, rl)
+		}
+		sort.Slice(archive.Listings, func(i, j int) bool { return archive.Listings[i].Dir < archive.Listings[j].Dir })
+		archives = append(archives, archive)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Updated.After(archives[j].Updated) })
+	return archives
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestListingArchivesSurviveDisconnect(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	first, second := "10.0.0.1:1000", "10.0.0.1:2000"
+	l.clientMetadata[first] = ClientMetadata{MachineID: "abcd", Hostname: "web1"}
+	l.clientIdentifiers[first] = "11111111"
+	l.CacheListing(first, "/etc", []DirEntry{{Name: "passwd"}})
+	l.CacheListing(first, "/var/", []DirEntry{{Name: "log", IsDir: true}})
+
+	// The host reconnects as a new session and lists /etc again
+	delete(l.clientMetadata, first)
+	delete(l.clientIdentifiers, first)
+	l.clientMetadata[second] = ClientMetadata{MachineID: "abcd", Hostname: "web1"}
+	l.clientIdentifiers[second] = "22222222"
+	l.CacheListing(second, "/etc", []DirEntry{{Name: "passwd"}, {Name: "shadow"}})
+	delete(l.clientMetadata, second)
+	l.listings.invalidate(second, "")
+
+	archives := l.ListingArchives()
+	if len(archives) != 1 {
+		t.Fatalf("expected one archive for the host, got %d", len(archives))
+	}
+	a := archives[0]
+	if a.Key != "abcd" || a.Hostname != "web1" || a.Client != second {
+		t.Errorf("unexpected archive %+v", a)
+	}
+	if len(a.Listings) != 2 || a.Listings[0].Dir != "/etc" || a.Listings[1].Dir != "/var" {
+		t.Fatalf("unexpected listings %+v", a.Listings)
+	}
+	etc, ok := a.Listing("/etc/")
+	if !ok || len(etc.Entries) != 2 || etc.Session != "22222222" {
+		t.Errorf("expected the newer /etc listing, got %+v", etc)
+	}
+	if v, _ := a.Listing("/var"); v.Session != "11111111" || v.Listed.After(etc.Listed) {
+		t.Errorf("expected /var to keep its own session and time, got %+v", v)
+	}
+}
+
+func TestListingArchivesKeyedByAddressWithoutMachineID(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.CacheListing("10.0.0.1:1000", "/tmp", nil)
+	l.CacheListing("10.0.0.2:1000", "/tmp", nil)
+	if got := len(l.ListingArchives()); got != 2 {
+		t.Errorf("expected an archive per address, got %d", got)
+	}
+}
+
+func TestListingArchivesBounded(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	for i := 0; i < maxListingArchives+5; i++ {
+		l.CacheListing(fmt.Sprintf("10.0.0.1:%d", i), "/", nil)
+	}
+	archives := l.ListingArchives()
+	if len(archives) != maxListingArchives {
+		t.Fatalf("expected %d archives, got %d", maxListingArchives, len(archives))
+	}
+
+	addr := "10.0.0.2:1000"
+	for i := 0; i < maxRecordedListings+5; i++ {
+		l.CacheListing(addr, fmt.Sprintf("/d%d", i), nil)
+	}
+	for _, a := range l.ListingArchives() {
+		if a.Key == addr && len(a.Listings) != maxRecordedListings {
+			t.Errorf("expected %d listings, got %d", maxRecordedListings, len(a.Listings))
+		}
+	}
+}
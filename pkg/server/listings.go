@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/config"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// DirEntry is one entry of a remote directory listing.
+type DirEntry struct {
+	Name  string
+	IsDir bool
+}
+
+type listingKey struct {
+	client string
+	dir    string
+}
+
+type listingEntry struct {
+	entries []DirEntry
+	expires time.Time
+}
+
+// listingCache keeps parsed directory listings per client and directory,
+// so tab completion on slow links does not list the same directory on
+// every key press. Uploads drop the listing of their directory; commands
+// that may delete or move files, and PTY sessions, drop all of a client's
+// listings.
+type listingCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[listingKey]listingEntry
+}
+
+func newListingCache() *listingCache {
+	return &listingCache{
+		ttl:     config.DefaultListingCacheTTL,
+		entries: make(map[listingKey]listingEntry),
+	}
+}
+
+func (c *listingCache) get(client, dir string) ([]DirEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := listingKey{client, cleanListingDir(dir)}
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.entries, true
+}
+
+func (c *listingCache) put(client, dir string, entries []DirEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	c.entries[listingKey{client, cleanListingDir(dir)}] = listingEntry{
+		entries: entries,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// invalidate drops the listing of dir, or every listing of the client when
+// dir is empty.
+func (c *listingCache) invalidate(client, dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if dir != "" {
+		delete(c.entries, listingKey{client, cleanListingDir(dir)})
+		return
+	}
+	for key := range c.entries {
+		if key.client == client {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *listingCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	if ttl <= 0 {
+		c.entries = make(map[listingKey]listingEntry)
+	}
+}
+
+// mutatingCommands are command names that can remove or rename files. A
+// shell command containing one drops the client's cached listings.
+var mutatingCommands = map[string]bool{
+	"rm": true, "rmdir": true, "unlink": true, "shred": true, "mv": true,
+	"del": true, "erase": true, "rd": true, "move": true, "ren": true, "rename": true,
+	"remove-item": true, "ri": true, "move-item": true, "mi": true, "rename-item": true, "rni": true,
+}
+
+// observe invalidates listings a command sent to a client may change.
+func (c *listingCache) observe(client, cmd string) {
+	switch {
+	case strings.HasPrefix(cmd, protocol.CmdStartUpload+" "), strings.HasPrefix(cmd, protocol.CmdEndUpload+" "):
+		if path := uploadPath(cmd); path != "" {
+			dir := "."
+			if i := strings.LastIndexAny(path, "/\\"); i >= 0 {
+				dir = path[:i+1]
+			}
+			c.invalidate(client, dir)
+		}
+	case strings.HasPrefix(cmd, protocol.CmdUploadChunk+" "), strings.HasPrefix(cmd, protocol.CmdPtyData+" "):
+		// Bulk data, never a shell command
+	default:
+		for _, word := range strings.FieldsFunc(cmd, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ';' || r == '&' || r == '|' || r == '(' || r == '`'
+		}) {
+			if mutatingCommands[strings.ToLower(word)] {
+				c.invalidate(client, "")
+				return
+			}
+		}
+	}
+}
+
+// uploadPath extracts the remote path from a START_UPLOAD or END_UPLOAD
+// frame, skipping the transfer ID and options.
+func uploadPath(cmd string) string {
+	fields := strings.Fields(cmd)[1:]
+	if len(fields) > 0 && protocol.IsTransferID(fields[0]) {
+		fields = fields[1:]
+	}
+	for len(fields) > 0 && strings.Contains(fields[0], "=") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(cmd, protocol.CmdStartUpload+" ") && len(fields) > 1 {
+		// The size follows the path
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, " ")
+}
+
+// cleanListingDir maps the spellings of a directory to one cache key:
+// "", "." and "./" are the working directory, and trailing separators
+// other than a root's are dropped.
+func cleanListingDir(dir string) string {
+	for len(dir) > 1 && strings.ContainsAny(dir[len(dir)-1:], "/\\") && !strings.HasSuffix(dir, ":\\") {
+		dir = dir[:len(dir)-1]
+	}
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// ListDir returns the entries of dir on a client, from the cache if a fresh
+// listing is known. Clients that announce LIST are asked for a structured
+// listing; older ones run the list-dir template, whose output is scraped.
+// The command waits for the client's response slot until ctx is done.
+func (l *Listener) ListDir(ctx context.Context, clientAddr, dir string) ([]DirEntry, error) {
+	if entries, ok := l.listings.get(clientAddr, dir); ok {
+		return entries, nil
+	}
+	meta, _ := l.GetClientMetadata(clientAddr)
+	cmd := protocol.CmdList + " " + dir
+	if !meta.Announces(protocol.CapList) {
+		var err error
+		if cmd, err = l.RenderCommand(clientAddr, config.TemplateListDir, map[string]string{"path": dir}); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp string
+	err := l.scheduler.Run(ctx, clientAddr, []string{ResponseKey}, func() error {
+		var err error
+		resp, _, err = l.Query(clientAddr, cmd, protocol.ResponseTimeout*time.Second)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []DirEntry
+	if meta.Announces(protocol.CapList) {
+		if entries, err = parseListing(resp); err != nil {
+			return nil, err
+		}
+	} else {
+		entries = parseLegacyListing(resp)
+	}
+	l.listings.put(clientAddr, dir, entries)
+	l.recordListing(clientAddr, dir, entries)
+	return entries, nil
+}
+
+// parseListing parses a LIST response: "OK", then one "d <name>" or
+// "f <size> <name>" line per entry.
+func parseListing(resp string) ([]DirEntry, error) {
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, ""), "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "OK" {
+		return nil, errors.New(strings.TrimSpace(strings.Join(lines, " ")))
+	}
+	var entries []DirEntry
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "d "):
+			entries = append(entries, DirEntry{Name: line[2:], IsDir: true})
+		case strings.HasPrefix(line, "f "):
+			_, name, ok := strings.Cut(line[2:], " ")
+			if !ok {
+				return nil, fmt.Errorf("malformed listing line %q", line)
+			}
+			entries = append(entries, DirEntry{Name: name})
+		case line != "":
+			return nil, fmt.Errorf("malformed listing line %q", line)
+		}
+	}
+	return entries, nil
+}
+
+// CachedListing returns the cached listing of dir on a client, if a fresh
+// one is known.
+func (l *Listener) CachedListing(clientAddr, dir string) ([]DirEntry, bool) {
+	return l.listings.get(clientAddr, dir)
+}
+
+// CacheListing stores the listing of dir on a client for reuse.
+func (l *Listener) CacheListing(clientAddr, dir string, entries []DirEntry) {
+	l.listings.put(clientAddr, dir, entries)
+	l.recordListing(clientAddr, dir, entries)
+}
+
+// InvalidateListings drops the cached listing of dir on a client, or all of
+// the client's listings when dir is empty.
+func (l *Listener) InvalidateListings(clientAddr, dir string) {
+	l.listings.invalidate(clientAddr, dir)
+}
+
+// SetListingCacheTTL sets how long directory listings are reused. Zero or
+// less disables the cache.
+func (l *Listener) SetListingCacheTTL(ttl time.Duration) {
+	l.listings.setTTL(ttl)
+}
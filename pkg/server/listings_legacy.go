@@ -0,0 +1,77 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// parseLegacyListing extracts entries from `ls -la` (POSIX) or `dir`
+// (Windows) output, as produced by the list-dir template. It is only a
+// fallback for clients without LIST: the text depends on the host's locale
+// and shell, so names may be missed. Lines that do not look like listing
+// entries are skipped, as are the "." and ".." entries.
+func parseLegacyListing(output string) []DirEntry {
+	output = strings.ReplaceAll(output, protocol.EndOfOutputMarker, "")
+	output = strings.ReplaceAll(output, "\r", "")
+
+	var entries []DirEntry
+	for _, line := range strings.Split(output, "\n") {
+		entry, ok := parseLsLine(line)
+		if !ok {
+			entry, ok = parseDirLine(line)
+		}
+		if !ok || entry.Name == "" || entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseLsLine parses a line such as
+// "drwxr-xr-x  2 root root 4096 Jan  1 12:00 name".
+func parseLsLine(line string) (DirEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 9 || len(fields[0]) < 10 || !strings.ContainsRune("-dlcbps", rune(fields[0][0])) {
+		return DirEntry{}, false
+	}
+	name := strings.Join(fields[8:], " ")
+	if fields[0][0] == 'l' {
+		if idx := strings.Index(name, " -> "); idx >= 0 {
+			name = name[:idx]
+		}
+	}
+	return DirEntry{Name: name, IsDir: fields[0][0] == 'd'}, true
+}
+
+// parseDirLine parses a line such as
+// "01/02/2024  10:00 AM    <DIR>          name" or
+// "01/02/2024  10:00 AM             1,234 name".
+func parseDirLine(line string) (DirEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !looksLikeDate(fields[0]) {
+		return DirEntry{}, false
+	}
+	idx := 2
+	if fields[idx] == "AM" || fields[idx] == "PM" {
+		idx++
+	}
+	if idx+1 >= len(fields) {
+		return DirEntry{}, false
+	}
+	if fields[idx] == "<DIR>" {
+		return DirEntry{Name: strings.Join(fields[idx+1:], " "), IsDir: true}, true
+	}
+	if strings.Trim(fields[idx], "0123456789,.") != "" {
+		return DirEntry{}, false
+	}
+	return DirEntry{Name: strings.Join(fields[idx+1:], " ")}, true
+}
+
+func looksLikeDate(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	return strings.ContainsAny(s, "/.-") && strings.Trim(s, "0123456789/.-") == ""
+}
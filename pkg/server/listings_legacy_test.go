@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestParseLegacyListingLs(t *testing.T) {
+	output := "total 12\n" +
+		"drwxr-xr-x  3 root root 4096 Jan  1 12:00 .\n" +
+		"drwxr-xr-x 20 root root 4096 Jan  1 12:00 ..\n" +
+		"drwxr-xr-x  2 root root 4096 Jan  1 12:00 etc\n" +
+		"-rw-r--r--  1 root root  120 Jan  1 12:00 my file.txt\n" +
+		"lrwxrwxrwx  1 root root    7 Jan  1 12:00 bin -> usr/bin\n" +
+		protocol.EndOfOutputMarker + "\n"
+
+	entries := parseLegacyListing(output)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(entries), entries)
+	}
+	if entries[0].Name != "etc" || !entries[0].IsDir {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Name != "my file.txt" || entries[1].IsDir {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+	if entries[2].Name != "bin" {
+		t.Errorf("expected symlink target to be stripped, got %+v", entries[2])
+	}
+}
+
+func TestParseLegacyListingDir(t *testing.T) {
+	output := " Volume in drive C has no label.\r\n" +
+		" Directory of C:\\Users\r\n\r\n" +
+		"01/02/2024  10:00 AM    <DIR>          .\r\n" +
+		"01/02/2024  10:00 AM    <DIR>          Public\r\n" +
+		"01/02/2024  10:00 AM             1,234 notes.txt\r\n" +
+		"02.01.2024  10:00    <DIR>          Daten\r\n" +
+		"               1 File(s)          1,234 bytes\r\n"
+
+	entries := parseLegacyListing(output)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d: %+v", len(entries), entries)
+	}
+	if entries[0].Name != "Public" || !entries[0].IsDir {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Name != "notes.txt" || entries[1].IsDir {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+	if entries[2].Name != "Daten" || !entries[2].IsDir {
+		t.Errorf("unexpected third entry: %+v", entries[2])
+	}
+}
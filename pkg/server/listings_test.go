@@ -0,0 +1,120 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestListingCache(t *testing.T) {
+	c := newListingCache()
+	entries := []DirEntry{{Name: "etc", IsDir: true}, {Name: "notes.txt"}}
+	c.put("a", "/tmp/", entries)
+	c.put("a", "", entries)
+	c.put("b", "/tmp", entries)
+
+	for _, dir := range []string{"/tmp", "/tmp/", "/tmp//"} {
+		if got, ok := c.get("a", dir); !ok || !reflect.DeepEqual(got, entries) {
+			t.Errorf("get(%q) = %v, %v", dir, got, ok)
+		}
+	}
+	if _, ok := c.get("a", "./"); !ok {
+		t.Error("expected ./ to share the working directory entry")
+	}
+	if _, ok := c.get("a", "/"); ok {
+		t.Error("expected no listing of /")
+	}
+
+	c.invalidate("a", "")
+	if _, ok := c.get("a", "/tmp"); ok {
+		t.Error("expected the client's listings to be dropped")
+	}
+	if _, ok := c.get("b", "/tmp"); !ok {
+		t.Error("expected other clients' listings to stay")
+	}
+
+	c.setTTL(time.Nanosecond)
+	c.put("a", "/tmp", entries)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.get("a", "/tmp"); ok {
+		t.Error("expected the listing to expire")
+	}
+	c.setTTL(0)
+	c.put("a", "/tmp", entries)
+	if _, ok := c.get("a", "/tmp"); ok {
+		t.Error("expected a zero TTL to disable the cache")
+	}
+}
+
+func TestListingCacheObserve(t *testing.T) {
+	c := newListingCache()
+	for _, dir := range []string{"/tmp", "/var", ".", "C:\\Temp"} {
+		c.put("a", dir, []DirEntry{{Name: "x"}})
+	}
+	id := protocol.NewTransferID()
+
+	c.observe("a", protocol.CmdStartUpload+" "+id+" "+protocol.OptExists+"=fail /tmp/my file.txt 1234")
+	if _, ok := c.get("a", "/tmp"); ok {
+		t.Error("expected an upload to drop its directory")
+	}
+	c.observe("a", protocol.CmdEndUpload+" "+id+" C:\\Temp\\a.exe")
+	if _, ok := c.get("a", "C:\\Temp"); ok {
+		t.Error("expected an upload to drop its Windows directory")
+	}
+	c.observe("a", protocol.CmdEndUpload+" "+id+" relative.txt")
+	if _, ok := c.get("a", "."); ok {
+		t.Error("expected a relative upload to drop the working directory")
+	}
+
+	c.observe("a", "ls -la /var")
+	c.observe("a", protocol.CmdPtyData+" 1f8b")
+	if _, ok := c.get("a", "/var"); !ok {
+		t.Fatal("expected a listing command to keep the cache")
+	}
+	c.observe("a", "cd /var && rm -f old.log")
+	if _, ok := c.get("a", "/var"); ok {
+		t.Error("expected rm to drop the client's listings")
+	}
+}
+
+func TestListenerInvalidatesListings(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	clientAddr := "127.0.0.1:5000"
+	listener.clientConnections[clientAddr] = make(chan string, 10)
+	listener.CacheListing(clientAddr, "/tmp", []DirEntry{{Name: "x"}})
+
+	if err := listener.SendCommand(clientAddr, "Remove-Item C:\\x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listener.CachedListing(clientAddr, "/tmp"); ok {
+		t.Error("expected SendCommand to invalidate listings")
+	}
+
+	listener.CacheListing(clientAddr, "/tmp", []DirEntry{{Name: "x"}})
+	if _, err := listener.EnterPtyMode(clientAddr); err != nil {
+		t.Fatal(err)
+	}
+	listener.ExitPtyMode(clientAddr)
+	if _, ok := listener.CachedListing(clientAddr, "/tmp"); ok {
+		t.Error("expected a PTY session to invalidate listings")
+	}
+}
+
+func TestParseListing(t *testing.T) {
+	entries, err := parseListing("OK\nd my docs\nf 12 notes  v2.txt\n" + protocol.EndOfOutputMarker)
+	if err != nil {
+		t.Fatalf("parseListing failed: %v", err)
+	}
+	want := []DirEntry{{Name: "my docs", IsDir: true}, {Name: "notes  v2.txt"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %v, want %v", entries, want)
+	}
+	if _, err := parseListing("Error: no such directory"); err == nil {
+		t.Error("expected an error for a failed LIST")
+	}
+	if _, err := parseListing("OK\nx weird\n"); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
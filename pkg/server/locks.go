@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// SessionLock is a soft lock an operator holds on a client while working
+// with it, e.g. during a PTY shell or a transfer. Locks are advisory: other
+// operators are turned away but may override them.
+type SessionLock struct {
+	Operator string    `json:"operator"`
+	Reason   string    `json:"reason"` // What the operator is doing: pty, upload, exec...
+	Since    time.Time `json:"since"`
+}
+
+// LockedError is returned by LockSession when another operator holds a
+// lock on the client.
+type LockedError struct {
+	Client string
+	Lock   SessionLock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("client %s is locked by %s (%s since %s)", e.Client, e.Lock.Operator, e.Lock.Reason, e.Lock.Since.Format("15:04:05"))
+}
+
+// LockSession takes a soft lock on a client for operator. It fails with a
+// *LockedError when another operator holds one, unless override is set; an
+// override is logged and both locks are then held. The same operator may
+// hold several locks. The returned function releases this lock.
+func (l *Listener) LockSession(clientAddr, operator, reason string, override bool) (func(), error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.clientConnections[clientAddr]; !ok {
+		return nil, fmt.Errorf("client %s not found", clientAddr)
+	}
+	for _, held := range l.sessionLocks[clientAddr] {
+		if held.Operator == operator {
+			continue
+		}
+		if !override {
+			return nil, &LockedError{Client: clientAddr, Lock: *held}
+		}
+		log.Printf("[!] Operator %s overrode the %s lock of %s on %s", operator, held.Reason, held.Operator, clientAddr)
+		break
+	}
+
+	lock := &SessionLock{Operator: operator, Reason: reason, Since: time.Now()}
+	l.sessionLocks[clientAddr] = append(l.sessionLocks[clientAddr], lock)
+	return func() { l.unlockSession(clientAddr, lock) }, nil
+}
+
+func (l *Listener) unlockSession(clientAddr string, lock *SessionLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	held := l.sessionLocks[clientAddr]
+	for i, h := range held {
+		if h == lock {
+			held = append(held[:i:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(l.sessionLocks, clientAddr)
+		return
+	}
+	l.sessionLocks[clientAddr] = held
+}
+
+// SessionLocks returns the locks held on a client, oldest first.
+func (l *Listener) SessionLocks(clientAddr string) []SessionLock {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	locks := make([]SessionLock, 0, len(l.sessionLocks[clientAddr]))
+	for _, held := range l.sessionLocks[clientAddr] {
+		locks = append(locks, *held)
+	}
+	return locks
+}
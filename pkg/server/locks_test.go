@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSessionLocks(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	clientAddr := "10.0.0.1:1000"
+	if _, err := l.LockSession(clientAddr, "alice", "pty", false); err == nil {
+		t.Fatal("expected an error for an unknown client")
+	}
+	l.clientConnections[clientAddr] = make(chan string)
+
+	releasePty, err := l.LockSession(clientAddr, "alice", "pty", false)
+	if err != nil {
+		t.Fatalf("LockSession failed: %v", err)
+	}
+	// The holder may take further locks
+	releaseUpload, err := l.LockSession(clientAddr, "alice", "upload", false)
+	if err != nil {
+		t.Fatalf("second lock by the same operator failed: %v", err)
+	}
+
+	_, err = l.LockSession(clientAddr, "bob", "exec", false)
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Lock.Operator != "alice" || locked.Lock.Reason != "pty" {
+		t.Fatalf("expected a LockedError naming alice's pty lock, got %v", err)
+	}
+
+	releaseExec, err := l.LockSession(clientAddr, "bob", "exec", true)
+	if err != nil {
+		t.Fatalf("override failed: %v", err)
+	}
+	if locks := l.SessionLocks(clientAddr); len(locks) != 3 || locks[2].Operator != "bob" {
+		t.Fatalf("unexpected locks %+v", locks)
+	}
+
+	releasePty()
+	releasePty() // Releasing twice is harmless
+	releaseUpload()
+	if locks := l.SessionLocks(clientAddr); len(locks) != 1 || locks[0].Reason != "exec" {
+		t.Fatalf("expected only bob's lock left, got %+v", locks)
+	}
+	releaseExec()
+	if locks := l.SessionLocks(clientAddr); len(locks) != 0 {
+		t.Fatalf("expected no locks, got %+v", locks)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrDifferentHost is returned by MigrateSession for sessions that are not
+// on the same host.
+var ErrDifferentHost = errors.New("sessions are not on the same host")
+
+// Migration reports what MigrateSession moved to the new session.
+type Migration struct {
+	Tags []string // Tags the new session gained
+	Jobs []Job    // Deferred operations that now run against it
+}
+
+// MigrateSession moves the listener's state for session from to session
+// to, e.g. a gotsr instance started as another user on the same host: its
+// tags and the deferred operations that have not started yet. Both must be
+// connected. The old session is left alone; the caller retires it once it
+// has moved what it keeps itself, such as tunnels.
+func (l *Listener) MigrateSession(from, to string) (Migration, error) {
+	if from == to {
+		return Migration{}, errors.New("cannot migrate a session to itself")
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	oldMeta, ok := l.clientMetadata[from]
+	if !ok {
+		return Migration{}, fmt.Errorf("client %s is not connected", from)
+	}
+	newMeta, ok := l.clientMetadata[to]
+	if !ok {
+		return Migration{}, fmt.Errorf("client %s is not connected", to)
+	}
+	if !sameHost(oldMeta, newMeta) {
+		return Migration{}, ErrDifferentHost
+	}
+
+	var m Migration
+	tags := slices.Clone(newMeta.Tags)
+	for _, tag := range oldMeta.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+			m.Tags = append(m.Tags, tag)
+		}
+	}
+	newMeta.Tags = tags
+	l.clientMetadata[to] = newMeta
+	if asset, ok := l.assets[newMeta.MachineID]; ok {
+		asset.Tags = tags
+	}
+	m.Jobs = l.scheduler.Reassign(from, to)
+	return m, nil
+}
+
+// sameHost reports whether two sessions run on the same host: by machine ID
+// where both announce one, otherwise by hostname and source address.
+func sameHost(a, b ClientMetadata) bool {
+	if a.MachineID != "" && b.MachineID != "" {
+		return a.MachineID == b.MachineID
+	}
+	return a.Hostname != "" && a.Hostname == b.Hostname && a.IP == b.IP
+}
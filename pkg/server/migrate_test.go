@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMigrateSession(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	old := ClientMetadata{Identifier: "aaaa1111", Hostname: "web1", MachineID: "0123456789abcdef", Tags: []string{"prod", "web"}}
+	cur := ClientMetadata{Identifier: "bbbb2222", Hostname: "web1", MachineID: "0123456789abcdef", Tags: []string{"web"}}
+	other := ClientMetadata{Identifier: "cccc3333", Hostname: "db1", MachineID: "fedcba9876543210"}
+	l.mutex.Lock()
+	l.clientMetadata["10.0.0.5:1"] = old
+	l.clientMetadata["10.0.0.5:2"] = cur
+	l.clientMetadata["10.0.0.6:1"] = other
+	l.recordAssetConnect("10.0.0.5:2", cur)
+	l.mutex.Unlock()
+
+	ran := make(chan string, 1)
+	job, _ := l.Scheduler().ScheduleAt(time.Now().Add(50*time.Millisecond), "10.0.0.5:1", "download /etc/hosts", nil, func(clientAddr string) error {
+		ran <- clientAddr
+		return nil
+	})
+	l.Scheduler().ScheduleAt(time.Now().Add(time.Hour), "10.0.0.6:1", "unrelated", nil, func(string) error { return nil })
+
+	if _, err := l.MigrateSession("10.0.0.5:1", "10.0.0.6:1"); !errors.Is(err, ErrDifferentHost) {
+		t.Fatalf("expected ErrDifferentHost, got %v", err)
+	}
+	if _, err := l.MigrateSession("10.0.0.5:1", "10.0.0.9:1"); err == nil {
+		t.Fatal("expected an error for a client that is not connected")
+	}
+
+	m, err := l.MigrateSession("10.0.0.5:1", "10.0.0.5:2")
+	if err != nil {
+		t.Fatalf("MigrateSession: %v", err)
+	}
+	if !reflect.DeepEqual(m.Tags, []string{"prod"}) || len(m.Jobs) != 1 || m.Jobs[0].ID != job.ID {
+		t.Errorf("unexpected migration %+v", m)
+	}
+	if meta, _ := l.GetClientMetadata("10.0.0.5:2"); !reflect.DeepEqual(meta.Tags, []string{"web", "prod"}) {
+		t.Errorf("expected the tags to be merged, got %v", meta.Tags)
+	}
+	if a, _ := l.GetAsset(cur.MachineID); !reflect.DeepEqual(a.Tags, []string{"web", "prod"}) {
+		t.Errorf("expected the asset's tags to follow, got %v", a.Tags)
+	}
+	select {
+	case addr := <-ran:
+		if addr != "10.0.0.5:2" {
+			t.Errorf("expected the job to run against the new session, got %s", addr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+}
+
+func TestSameHostWithoutMachineID(t *testing.T) {
+	a := ClientMetadata{Hostname: "web1", IP: "10.0.0.5"}
+	if !sameHost(a, ClientMetadata{Hostname: "web1", IP: "10.0.0.5"}) {
+		t.Error("expected matching hostname and address to be the same host")
+	}
+	if sameHost(a, ClientMetadata{Hostname: "web1", IP: "10.0.0.7"}) || sameHost(ClientMetadata{}, ClientMetadata{}) {
+		t.Error("expected different or unknown hosts not to match")
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/icmptunnel"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// ListenTLS listens on a "host:port", "unix:///path" or "icmp://host"
+// address and wraps the listener in TLS. A stale socket file left behind by
+// a crashed process is removed; a socket that still accepts connections is
+// left alone.
+func ListenTLS(addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	network, address := protocol.SplitAddress(addr)
+	switch network {
+	case "unix":
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	case "icmp":
+		ln, err := icmptunnel.Listen(address)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("⚠️  WARNING: ICMP tunnel transport is a last resort: expect a few KB/s, seconds of latency and sessions dropped when pings are filtered or rate-limited")
+		return tls.NewListener(ln, tlsConfig), nil
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, tlsConfig), nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+)
+
+func TestListenerUnixSocket(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "gots.sock")
+
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	listener.SetAddress("unix://" + path)
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := tls.Dial("unix", path, &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"})
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("IDENT abcd123" + string(rune('0'+i)) + "\n")); err != nil {
+			t.Fatalf("Failed to send IDENT: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(listener.GetClients()) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	clients := listener.GetClientAddressesSorted()
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 distinct unix clients, got %v", clients)
+	}
+	for _, addr := range clients {
+		if !strings.HasPrefix(addr, "unix#") {
+			t.Errorf("expected unix# client address, got %s", addr)
+		}
+	}
+}
+
+func TestListenTLSRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stale.sock")
+
+	// Leave a socket file behind without a process serving it
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	tlsLn, err := ListenTLS("unix://"+path, &tls.Config{})
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	defer tlsLn.Close()
+
+	if _, err := ListenTLS("unix://"+path, &tls.Config{}); err == nil {
+		t.Error("expected error for socket in use")
+	}
+
+	regular := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := ListenTLS("unix://"+regular, &tls.Config{}); err == nil {
+		t.Error("expected error for non-socket path")
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// SetOnConnect sets the commands run in order on every new client once it
+// has identified itself and, if approval is required, been approved.
+func (l *Listener) SetOnConnect(cmds []string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.onConnect = append([]string(nil), cmds...)
+}
+
+// runOnConnect sets the host's environment file and runs the on-connect
+// commands on a client unless they ran already or it still waits for
+// approval. Each command and its output are logged, so they show up in the
+// console, the log sink and recordings alike. A failing command stops the
+// rest.
+func (l *Listener) runOnConnect(clientAddr string) {
+	l.mutex.Lock()
+	cmds := l.onConnect
+	_, connected := l.clientConnections[clientAddr]
+	if !connected || l.onConnectRan[clientAddr] || l.pendingLocked(clientAddr) {
+		l.mutex.Unlock()
+		return
+	}
+	if l.onConnectRan == nil {
+		l.onConnectRan = make(map[string]bool)
+	}
+	l.onConnectRan[clientAddr] = true
+	l.mutex.Unlock()
+
+	// First, so the on-connect commands see the environment too
+	l.restoreEnvFile(clientAddr)
+
+	for i, cmd := range cmds {
+		var resp string
+		err := l.scheduler.Run(context.Background(), clientAddr, []string{ResponseKey}, func() error {
+			if err := l.SendCommand(clientAddr, cmd); err != nil {
+				return err
+			}
+			var err error
+			resp, err = l.GetResponse(clientAddr, protocol.ResponseTimeout*time.Second)
+			return err
+		})
+		if err != nil {
+			if !errors.Is(err, ErrSchedulerClosed) && l.connected(clientAddr) {
+				l.warn(clientAddr, fmt.Sprintf("on-connect command %d (%s) failed: %v; skipping the rest", i+1, cmd, err))
+			}
+			return
+		}
+		log.Printf("[+] On-connect %s [%d/%d] %s\n%s", clientAddr, i+1, len(cmds), cmd, indentOutput(resp))
+	}
+}
+
+// indentOutput prepares command output for the log: without the end of
+// output marker and indented below the line naming the command.
+func indentOutput(resp string) string {
+	out := strings.TrimRight(strings.ReplaceAll(strings.ReplaceAll(resp, "\r", ""), protocol.EndOfOutputMarker, ""), "\n ")
+	if out == "" {
+		return "    (no output)"
+	}
+	return "    " + strings.ReplaceAll(out, "\n", "\n    ")
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestRunOnConnect(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.SetRequireApproval(true)
+	l.SetOnConnect([]string{protocol.CmdSysinfo, "id"})
+	addr := "10.0.0.1:1000"
+	l.clientMetadata[addr] = ClientMetadata{MachineID: "abcd"}
+	cmds := fakeClient(l, addr, 0)
+	defer close(l.clientConnections[addr])
+
+	l.runOnConnect(addr)
+	if len(cmds) != 0 {
+		t.Fatal("on-connect commands must wait for approval")
+	}
+
+	l.mutex.Lock()
+	l.approved = map[string]bool{addr: true}
+	l.mutex.Unlock()
+	l.runOnConnect(addr)
+	for _, want := range []string{protocol.CmdSysinfo, "id"} {
+		select {
+		case got := <-cmds:
+			if got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not sent", want)
+		}
+	}
+	if out := buf.String(); !strings.Contains(out, "On-connect "+addr+" [2/2] id\n    OK") {
+		t.Errorf("expected the commands and output in the log, got %q", out)
+	}
+
+	l.runOnConnect(addr)
+	if len(cmds) != 0 {
+		t.Error("on-connect commands must run once per session")
+	}
+}
+
+func TestIndentOutput(t *testing.T) {
+	if got := indentOutput("a\r\nb\n" + protocol.EndOfOutputMarker + "\n"); got != "    a\n    b" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if got := indentOutput(protocol.EndOfOutputMarker); got != "    (no output)" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
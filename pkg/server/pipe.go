@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// pipeDialTimeout bounds how long the listener tries to reach the target of
+// a reverse forward.
+const pipeDialTimeout = 10 * time.Second
+
+// StartReverseForward registers a forward from a named pipe served by a
+// client to targetAddr, which the listener dials for each program that opens
+// the pipe. The client is asked to serve the pipe with PIPE_LISTEN
+// afterwards.
+func (fm *ForwardManager) StartReverseForward(id, pipeName, targetAddr string, sendFunc func(string)) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if _, exists := fm.forwards[id]; exists {
+		return fmt.Errorf("forward %s already exists", id)
+	}
+	fm.forwards[id] = &ForwardInfo{
+		ID:          id,
+		LocalAddr:   targetAddr,
+		RemoteAddr:  protocol.PipePrefix + pipeName,
+		Active:      true,
+		Reverse:     true,
+		connections: make(map[string]net.Conn),
+		sendFunc:    sendFunc,
+	}
+	return nil
+}
+
+// HandlePipeConn connects a program that opened a client's pipe to the
+// target of the reverse forward. The client relays the pipe once it gets
+// PIPE_READY, or closes it on FORWARD_STOP if the target is unreachable.
+func (fm *ForwardManager) HandlePipeConn(fwdID, connID string) error {
+	fm.mu.RLock()
+	info, exists := fm.forwards[fwdID]
+	fm.mu.RUnlock()
+	if !exists || !info.Reverse {
+		return fmt.Errorf("reverse forward %s not found", fwdID)
+	}
+
+	go func() {
+		conn, err := net.DialTimeout("tcp", info.LocalAddr, pipeDialTimeout)
+		if err != nil {
+			logging.Warnf("[-] Forward %s: failed to connect to %s: %v", fwdID, info.LocalAddr, err)
+			info.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdForwardStop, fwdID, connID))
+			return
+		}
+		info.mu.Lock()
+		if !info.Active {
+			info.mu.Unlock()
+			conn.Close()
+			return
+		}
+		info.ConnCount++
+		info.connections[connID] = conn
+		fm.startCapture(info, connID, conn)
+		info.mu.Unlock()
+		info.traffic.open()
+
+		logging.Debugf("[+] Forward %s: pipe connection %s to %s", fwdID, connID, info.LocalAddr)
+		info.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdPipeReady, fwdID, connID))
+		fm.forwardConnection(info, connID, conn, info.sendFunc)
+	}()
+	return nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestReverseForwardRelaysPipeConnection(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	sent := make(chan string, 10)
+	fm := NewForwardManager()
+	defer fm.StopAll()
+	if err := fm.StartReverseForward("pipe-1", "spoolss", target.Addr().String(), func(msg string) { sent <- msg }); err != nil {
+		t.Fatalf("StartReverseForward: %v", err)
+	}
+	if got := fm.ListForwards()[0].RemoteAddr; got != protocol.PipePrefix+"spoolss" {
+		t.Errorf("RemoteAddr = %q", got)
+	}
+
+	if err := fm.HandlePipeConn("pipe-1", "p1"); err != nil {
+		t.Fatalf("HandlePipeConn: %v", err)
+	}
+	conn, err := target.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if msg := <-sent; msg != protocol.CmdPipeReady+" pipe-1 p1\n" {
+		t.Fatalf("expected PIPE_READY, got %q", msg)
+	}
+
+	// Data from the pipe reaches the target and the reply goes back
+	if err := fm.HandleForwardData("pipe-1", "p1", base64.StdEncoding.EncodeToString([]byte("ping"))); err != nil {
+		t.Fatalf("HandleForwardData: %v", err)
+	}
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("target read %q, %v", buf, err)
+	}
+	conn.Write([]byte("pong"))
+	want := protocol.CmdForwardData + " pipe-1 p1 " + base64.StdEncoding.EncodeToString([]byte("pong")) + "\n"
+	if msg := <-sent; msg != want {
+		t.Fatalf("expected %q, got %q", want, msg)
+	}
+
+	if err := fm.StopForward("pipe-1"); err != nil {
+		t.Fatalf("StopForward: %v", err)
+	}
+	if msg := <-sent; msg != protocol.CmdPipeClose+" pipe-1\n" {
+		t.Fatalf("expected PIPE_CLOSE, got %q", msg)
+	}
+}
+
+func TestReverseForwardUnreachableTarget(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sent := make(chan string, 1)
+	fm := NewForwardManager()
+	fm.StartReverseForward("pipe-1", "x", addr, func(msg string) { sent <- msg })
+	fm.HandlePipeConn("pipe-1", "p1")
+	select {
+	case msg := <-sent:
+		if !strings.HasPrefix(msg, protocol.CmdForwardStop+" pipe-1 p1") {
+			t.Errorf("expected FORWARD_STOP, got %q", msg)
+		}
+	case <-time.After(pipeDialTimeout + time.Second):
+		t.Fatal("no FORWARD_STOP sent")
+	}
+
+	if err := fm.HandlePipeConn("missing", "p1"); err == nil {
+		t.Error("expected error for unknown forward")
+	}
+}
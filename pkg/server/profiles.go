@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// Profile is a listener personality selected by the SNI name a client sends,
+// allowing several profiles to share one port behind a TLS frontend.
+type Profile struct {
+	Name        string
+	ServerNames []string         // Exact names or "*.example.com" wildcards
+	Certificate *tls.Certificate // Optional; the listener certificate is used when nil
+	NextProtos  []string         // ALPN protocols offered for this profile
+}
+
+// matches reports whether serverName is covered by the profile.
+func (p Profile) matches(serverName string) bool {
+	serverName = strings.ToLower(serverName)
+	for _, name := range p.ServerNames {
+		name = strings.ToLower(name)
+		if name == serverName {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(name, "*."); ok {
+			if prefix, found := strings.CutSuffix(serverName, "."+suffix); found && prefix != "" && !strings.Contains(prefix, ".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetProfiles installs SNI-routed profiles. Connections whose SNI matches no
+// profile use the listener's base TLS configuration. Must be called before Start.
+func (l *Listener) SetProfiles(profiles []Profile) {
+	l.profiles = profiles
+	if len(profiles) == 0 {
+		return
+	}
+
+	base := l.tlsConfig.Clone()
+	perProfile := make([]*tls.Config, len(profiles))
+	for i, p := range profiles {
+		cfg := base.Clone()
+		if p.Certificate != nil {
+			cfg.Certificates = []tls.Certificate{*p.Certificate}
+		}
+		if len(p.NextProtos) > 0 {
+			cfg.NextProtos = p.NextProtos
+		}
+		perProfile[i] = cfg
+	}
+
+	routed := base.Clone()
+	routed.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if i := l.profileIndex(hello.ServerName); i >= 0 {
+			return perProfile[i], nil
+		}
+		return nil, nil
+	}
+	l.tlsConfig = routed
+}
+
+// profileName returns the name of the profile serving serverName, if any.
+func (l *Listener) profileName(serverName string) string {
+	if i := l.profileIndex(serverName); i >= 0 {
+		return l.profiles[i].Name
+	}
+	return ""
+}
+
+func (l *Listener) profileIndex(serverName string) int {
+	if serverName == "" {
+		return -1
+	}
+	for i, p := range l.profiles {
+		if p.matches(serverName) {
+			return i
+		}
+	}
+	return -1
+}
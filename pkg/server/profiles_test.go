@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+)
+
+func TestProfileMatches(t *testing.T) {
+	p := Profile{ServerNames: []string{"cdn.example.com", "*.assets.example.com"}}
+
+	cases := map[string]bool{
+		"cdn.example.com":        true,
+		"CDN.Example.com":        true,
+		"img.assets.example.com": true,
+		"assets.example.com":     false,
+		"a.b.assets.example.com": false,
+		"other.example.com":      false,
+		"":                       false,
+	}
+	for name, want := range cases {
+		if got := p.matches(name); got != want {
+			t.Errorf("matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestListenerRoutesBySNI(t *testing.T) {
+	defaultCert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	profileCert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	listener := NewListener("0", "127.0.0.1", &tls.Config{
+		Certificates: []tls.Certificate{defaultCert},
+		NextProtos:   []string{"http/1.1"},
+	}, "")
+	listener.SetProfiles([]Profile{{
+		Name:        "cdn",
+		ServerNames: []string{"cdn.example.com"},
+		Certificate: &profileCert,
+		NextProtos:  []string{"h2"},
+	}})
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	dial := func(serverName string) *tls.Conn {
+		conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         serverName,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			t.Fatalf("Dial with SNI %q failed: %v", serverName, err)
+		}
+		return conn
+	}
+
+	conn := dial("cdn.example.com")
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if string(state.PeerCertificates[0].Raw) != string(profileCert.Certificate[0]) {
+		t.Error("expected profile certificate for matching SNI")
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("expected ALPN h2, got %q", state.NegotiatedProtocol)
+	}
+
+	other := dial("unknown.example.com")
+	defer other.Close()
+	state = other.ConnectionState()
+	if string(state.PeerCertificates[0].Raw) != string(defaultCert.Certificate[0]) {
+		t.Error("expected default certificate for unmatched SNI")
+	}
+	if state.NegotiatedProtocol != "http/1.1" {
+		t.Errorf("expected ALPN http/1.1, got %q", state.NegotiatedProtocol)
+	}
+
+	if _, err := conn.Write([]byte("IDENT abcd1234 os=linux\n")); err != nil {
+		t.Fatalf("Failed to send IDENT: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, addr := range listener.GetClients() {
+			if meta, ok := listener.GetClientMetadata(addr); ok && meta.Identifier == "abcd1234" {
+				if meta.ServerName != "cdn.example.com" || meta.Profile != "cdn" {
+					t.Fatalf("unexpected SNI metadata: %+v", meta)
+				}
+				t.Log("✓ SNI routing verified")
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("client did not register")
+}
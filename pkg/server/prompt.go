@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// pendingPrompt is a password prompt a client is waiting on. The client
+// gives up after protocol.PromptTimeout, and so does the listener.
+type pendingPrompt struct {
+	text    string
+	expires time.Time
+}
+
+// SetPromptHandler sets the function notified when a command on a client is
+// waiting for a password outside PTY mode. It runs on its own goroutine and
+// should lead to SendSecret or CancelPrompt. By default prompts are logged.
+func (l *Listener) SetPromptHandler(fn func(clientAddr, prompt string)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.promptFunc = fn
+}
+
+// PendingPrompt returns the password prompt a client is waiting on, if any.
+func (l *Listener) PendingPrompt(clientAddr string) (string, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	prompt, ok := l.livePromptLocked(clientAddr)
+	return prompt.text, ok
+}
+
+// livePromptLocked returns a client's pending prompt unless it expired,
+// dropping an expired one. The caller holds l.mutex.
+func (l *Listener) livePromptLocked(clientAddr string) (pendingPrompt, bool) {
+	prompt, ok := l.pendingPrompts[clientAddr]
+	if ok && time.Now().After(prompt.expires) {
+		delete(l.pendingPrompts, clientAddr)
+		return pendingPrompt{}, false
+	}
+	return prompt, ok
+}
+
+// SendSecret answers a pending prompt. The secret travels in a dedicated
+// frame and is never logged. Prompts expire after protocol.PromptTimeout,
+// when the client stops waiting for the answer.
+func (l *Listener) SendSecret(clientAddr, secret string) error {
+	if !l.takePrompt(clientAddr) {
+		return fmt.Errorf("client %s is not waiting for a password", clientAddr)
+	}
+	return l.SendCommand(clientAddr, protocol.CmdSecret+" "+hex.EncodeToString([]byte(secret)))
+}
+
+// CancelPrompt declines a pending prompt; the client closes the command's
+// stdin so it fails instead of waiting.
+func (l *Listener) CancelPrompt(clientAddr string) error {
+	if !l.takePrompt(clientAddr) {
+		return fmt.Errorf("client %s is not waiting for a password", clientAddr)
+	}
+	return l.SendCommand(clientAddr, protocol.CmdSecret)
+}
+
+func (l *Listener) takePrompt(clientAddr string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, ok := l.livePromptLocked(clientAddr)
+	delete(l.pendingPrompts, clientAddr)
+	return ok
+}
+
+func (l *Listener) clearPrompt(clientAddr string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.pendingPrompts, clientAddr)
+}
+
+// handlePromptFrame records a PROMPT frame and notifies the operator.
+func (l *Listener) handlePromptFrame(clientAddr, line string) {
+	encoded := strings.TrimSpace(strings.TrimPrefix(line, protocol.CmdPrompt+" "))
+	raw, err := hex.DecodeString(encoded)
+	if err != nil {
+		l.protocolError(clientAddr, "malformed password prompt frame")
+		return
+	}
+	prompt := string(raw)
+
+	l.mutex.Lock()
+	l.pendingPrompts[clientAddr] = pendingPrompt{text: prompt, expires: time.Now().Add(protocol.PromptTimeout * time.Second)}
+	fn := l.promptFunc
+	l.mutex.Unlock()
+
+	if fn == nil {
+		log.Printf("Client %s is waiting for a password: %q", clientAddr, prompt)
+		return
+	}
+	go fn(clientAddr, prompt)
+}
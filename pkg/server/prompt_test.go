@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestListenerPasswordPrompt(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	prompts := make(chan string, 1)
+	listener.SetPromptHandler(func(clientAddr, prompt string) { prompts <- prompt })
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(listener.GetClients()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	clients := listener.GetClients()
+	if len(clients) != 1 {
+		t.Fatalf("expected 1 client, got %d", len(clients))
+	}
+	clientAddr := clients[0]
+
+	if err := listener.SendSecret(clientAddr, "x"); err == nil {
+		t.Error("expected SendSecret to fail without a pending prompt")
+	}
+
+	prompt := "[sudo] password for alice: "
+	conn.Write([]byte(protocol.CmdPrompt + " " + hex.EncodeToString([]byte(prompt)) + "\n"))
+	select {
+	case got := <-prompts:
+		if got != prompt {
+			t.Errorf("expected prompt %q, got %q", prompt, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("prompt handler was not called")
+	}
+	if pending, ok := listener.PendingPrompt(clientAddr); !ok || pending != prompt {
+		t.Errorf("expected pending prompt %q, got %q", prompt, pending)
+	}
+
+	if err := listener.SendSecret(clientAddr, "hunter2"); err != nil {
+		t.Fatalf("SendSecret failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read secret frame: %v", err)
+	}
+	if want := protocol.CmdSecret + " " + hex.EncodeToString([]byte("hunter2")); strings.TrimSpace(line) != want {
+		t.Errorf("unexpected secret frame %q", line)
+	}
+	if _, ok := listener.PendingPrompt(clientAddr); ok {
+		t.Error("expected the prompt to be cleared once answered")
+	}
+
+	// A completed response also clears a prompt that was never answered
+	conn.Write([]byte(protocol.CmdPrompt + " " + hex.EncodeToString([]byte("Password:")) + "\n"))
+	<-prompts
+	conn.Write([]byte("done\n" + protocol.EndOfOutputMarker + "\n"))
+	if _, err := listener.GetResponse(clientAddr, 2*time.Second); err != nil {
+		t.Fatalf("GetResponse failed: %v", err)
+	}
+	if _, ok := listener.PendingPrompt(clientAddr); ok {
+		t.Error("expected the prompt to be cleared by the response")
+	}
+}
+
+func TestPendingPromptExpires(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	listener.pendingPrompts["10.0.0.1:1000"] = pendingPrompt{text: "Password:", expires: time.Now().Add(-time.Second)}
+	if _, ok := listener.PendingPrompt("10.0.0.1:1000"); ok {
+		t.Error("expected an expired prompt not to be pending")
+	}
+	listener.pendingPrompts["10.0.0.1:1000"] = pendingPrompt{text: "Password:", expires: time.Now().Add(-time.Second)}
+	if err := listener.SendSecret("10.0.0.1:1000", "hunter2"); err == nil {
+		t.Error("expected SendSecret to refuse an expired prompt")
+	}
+}
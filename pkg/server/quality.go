@@ -0,0 +1,236 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	heartbeatWindow  = 10  // Recent heartbeats the loss rate is computed over
+	minHeartbeats    = 3   // Heartbeats needed before a link is judged
+	degradedLoss     = 0.3 // Loss rate from which a link is degraded
+	throughputWindow = 30  // Seconds received bytes are averaged over
+	// A link is degraded when its latency exceeds degradedLatency and has
+	// risen to latencyRise times its long-term baseline.
+	degradedLatency = 2 * time.Second
+	latencyRise     = 3
+)
+
+// LinkQuality approximates the health of a client's connection from what
+// the listener can observe: unanswered heartbeats, heartbeat round-trip
+// times and received bytes.
+type LinkQuality struct {
+	Heartbeats    int           `json:"heartbeats"`          // Recent heartbeats judged, at most heartbeatWindow
+	HeartbeatLoss float64       `json:"heartbeat_loss"`      // Share of them left unanswered
+	Latency       time.Duration `json:"latency_ns"`          // Smoothed recent round-trip time
+	Baseline      time.Duration `json:"baseline_latency_ns"` // Long-term round-trip time
+	Throughput    float64       `json:"throughput_bps"`      // Bytes per second received lately
+	Degraded      bool          `json:"degraded"`
+	Reasons       []string      `json:"reasons,omitempty"` // Why the link is degraded
+}
+
+// Rising reports whether latency is well above its baseline.
+func (q LinkQuality) Rising() bool {
+	return q.Baseline > 0 && q.Latency > latencyRise*q.Baseline
+}
+
+// String summarizes the link, e.g. "20% heartbeat loss, latency 350ms
+// (rising), 1.2 KB/s".
+func (q LinkQuality) String() string {
+	parts := []string{fmt.Sprintf("%.0f%% heartbeat loss", q.HeartbeatLoss*100)}
+	if q.Latency > 0 {
+		latency := "latency " + q.Latency.Round(time.Millisecond).String()
+		if q.Rising() {
+			latency += " (rising)"
+		}
+		parts = append(parts, latency)
+	}
+	parts = append(parts, formatRate(q.Throughput))
+	return strings.Join(parts, ", ")
+}
+
+// formatRate renders bytes per second in decimal units.
+func formatRate(bps float64) string {
+	switch {
+	case bps >= 1e6:
+		return fmt.Sprintf("%.1f MB/s", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.1f KB/s", bps/1e3)
+	}
+	return fmt.Sprintf("%.0f B/s", bps)
+}
+
+// linkMonitor collects the observations for one client. The connection's
+// goroutines feed it without taking the listener's mutex.
+type linkMonitor struct {
+	mu       sync.Mutex
+	pingSent time.Time // When the unanswered PING went out, zero if none
+	beats    []bool    // Whether recent heartbeats were answered, oldest first
+	latency  time.Duration
+	baseline time.Duration
+	buckets  [throughputWindow]int64 // Bytes received, by second
+	stamps   [throughputWindow]int64 // Unix second each bucket counts
+	sent     int64                   // Bytes sent to the client in total
+	received int64                   // Bytes received from the client in total
+	degraded bool
+}
+
+// ping records a PING being sent. A previous one still unanswered is lost.
+func (m *linkMonitor) ping(now time.Time) (changed bool, q LinkQuality) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lost := !m.pingSent.IsZero()
+	m.pingSent = now
+	if !lost {
+		return false, m.qualityLocked(now)
+	}
+	m.beatLocked(false)
+	return m.judgeLocked(now)
+}
+
+// pong records a PONG, timing the PING it answers.
+func (m *linkMonitor) pong(now time.Time) (changed bool, q LinkQuality) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pingSent.IsZero() {
+		return false, m.qualityLocked(now)
+	}
+	rtt := now.Sub(m.pingSent)
+	m.pingSent = time.Time{}
+	m.beatLocked(true)
+	// Fast and slow moving averages; comparing them shows the trend
+	if m.latency == 0 {
+		m.latency, m.baseline = rtt, rtt
+	} else {
+		m.latency += (rtt - m.latency) * 3 / 10
+		m.baseline += (rtt - m.baseline) / 20
+	}
+	return m.judgeLocked(now)
+}
+
+// read counts bytes received from the client.
+func (m *linkMonitor) read(now time.Time, n int) {
+	sec := now.Unix()
+	i := sec % throughputWindow
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stamps[i] != sec {
+		m.stamps[i], m.buckets[i] = sec, 0
+	}
+	m.buckets[i] += int64(n)
+	m.received += int64(n)
+}
+
+// wrote counts bytes sent to the client.
+func (m *linkMonitor) wrote(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent += int64(n)
+}
+
+func (m *linkMonitor) beatLocked(answered bool) {
+	m.beats = append(m.beats, answered)
+	if len(m.beats) > heartbeatWindow {
+		m.beats = m.beats[1:]
+	}
+}
+
+// judgeLocked updates whether the link is degraded and reports a change.
+func (m *linkMonitor) judgeLocked(now time.Time) (bool, LinkQuality) {
+	q := m.qualityLocked(now)
+	changed := q.Degraded != m.degraded
+	m.degraded = q.Degraded
+	return changed, q
+}
+
+func (m *linkMonitor) qualityLocked(now time.Time) LinkQuality {
+	q := LinkQuality{Heartbeats: len(m.beats), Latency: m.latency, Baseline: m.baseline}
+	lost := 0
+	for _, answered := range m.beats {
+		if !answered {
+			lost++
+		}
+	}
+	if len(m.beats) > 0 {
+		q.HeartbeatLoss = float64(lost) / float64(len(m.beats))
+	}
+	var total int64
+	for i, stamp := range m.stamps {
+		if now.Unix()-stamp < throughputWindow {
+			total += m.buckets[i]
+		}
+	}
+	q.Throughput = float64(total) / throughputWindow
+
+	if len(m.beats) >= minHeartbeats && q.HeartbeatLoss >= degradedLoss {
+		q.Reasons = append(q.Reasons, fmt.Sprintf("%d of the last %d heartbeats unanswered", lost, len(m.beats)))
+	}
+	if q.Latency > degradedLatency && q.Rising() {
+		q.Reasons = append(q.Reasons, fmt.Sprintf("latency rose to %s from %s", q.Latency.Round(time.Millisecond), q.Baseline.Round(time.Millisecond)))
+	}
+	q.Degraded = len(q.Reasons) > 0
+	return q
+}
+
+// isKeepalive reports whether a response is a PING or PONG.
+func isKeepalive(resp string) bool {
+	clean := strings.TrimSpace(strings.ReplaceAll(strings.ReplaceAll(resp, "\r", ""), protocol.EndOfOutputMarker, ""))
+	return clean == protocol.CmdPong || clean == protocol.CmdPing
+}
+
+// SetLinkHandler sets the function notified when a client's link becomes
+// degraded or recovers, in addition to the operator warning. It runs on
+// its own goroutine.
+func (l *Listener) SetLinkHandler(fn func(clientAddr string, q LinkQuality)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.linkFunc = fn
+}
+
+// LinkQuality returns the current link quality of a client.
+func (l *Listener) LinkQuality(clientAddr string) (LinkQuality, bool) {
+	l.mutex.Lock()
+	m, ok := l.links[clientAddr]
+	l.mutex.Unlock()
+	if !ok {
+		return LinkQuality{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.qualityLocked(time.Now()), true
+}
+
+// newLinkMonitor starts monitoring a client's link.
+func (l *Listener) newLinkMonitor(clientAddr string) *linkMonitor {
+	m := &linkMonitor{}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.links == nil {
+		l.links = make(map[string]*linkMonitor)
+	}
+	l.links[clientAddr] = m
+	return m
+}
+
+// linkChanged tells the operator and the link handler that a client's link
+// degraded or recovered.
+func (l *Listener) linkChanged(clientAddr string, changed bool, q LinkQuality) {
+	if !changed {
+		return
+	}
+	if q.Degraded {
+		l.warn(clientAddr, fmt.Sprintf("link degraded (%s): %s; avoid starting large transfers", strings.Join(q.Reasons, "; "), q))
+	} else {
+		l.warn(clientAddr, "link recovered: "+q.String())
+	}
+	l.mutex.Lock()
+	fn := l.linkFunc
+	l.mutex.Unlock()
+	if fn != nil {
+		go fn(clientAddr, q)
+	}
+}
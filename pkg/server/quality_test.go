@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestLinkMonitorHeartbeatLoss(t *testing.T) {
+	m := &linkMonitor{}
+	now := time.Unix(1000, 0)
+	for i := 0; i < 4; i++ {
+		m.ping(now)
+		now = now.Add(100 * time.Millisecond)
+		if changed, q := m.pong(now); changed || q.Degraded {
+			t.Fatalf("answered heartbeat %d degraded the link: %+v", i, q)
+		}
+		now = now.Add(30 * time.Second)
+	}
+
+	// Two unanswered PINGs are only judged when the next one goes out
+	m.ping(now)
+	m.ping(now.Add(30 * time.Second))
+	changed, q := m.ping(now.Add(60 * time.Second))
+	if !changed || !q.Degraded {
+		t.Fatalf("expected 2 of 6 lost heartbeats to degrade the link, got %+v", q)
+	}
+	if !strings.Contains(q.Reasons[0], "2 of the last 6 heartbeats unanswered") {
+		t.Errorf("unexpected reasons %q", q.Reasons)
+	}
+
+	for i := 0; i < heartbeatWindow; i++ {
+		now = now.Add(90 * time.Second)
+		changed, q = m.pong(now)
+		m.ping(now)
+	}
+	if q.Degraded || q.HeartbeatLoss != 0 {
+		t.Errorf("expected the link to recover, got %+v", q)
+	}
+}
+
+func TestLinkMonitorLatencyTrend(t *testing.T) {
+	m := &linkMonitor{}
+	now := time.Unix(1000, 0)
+	beat := func(rtt time.Duration) (bool, LinkQuality) {
+		m.ping(now)
+		changed, q := m.pong(now.Add(rtt))
+		now = now.Add(30 * time.Second)
+		return changed, q
+	}
+	for i := 0; i < 5; i++ {
+		beat(200 * time.Millisecond)
+	}
+	var changed bool
+	var q LinkQuality
+	for i := 0; i < 5 && !changed; i++ {
+		changed, q = beat(8 * time.Second)
+	}
+	if !changed || !q.Degraded || !q.Rising() {
+		t.Fatalf("expected rising latency to degrade the link, got %+v", q)
+	}
+	if !strings.Contains(q.String(), "(rising)") {
+		t.Errorf("expected the summary to show the trend, got %q", q)
+	}
+}
+
+func TestLinkMonitorThroughput(t *testing.T) {
+	m := &linkMonitor{}
+	now := time.Unix(1000, 0)
+	m.read(now, 30000)
+	m.read(now.Add(time.Second), 30000)
+	if q := m.qualityLocked(now.Add(time.Second)); q.Throughput != 2000 {
+		t.Errorf("expected 2000 B/s, got %v", q.Throughput)
+	}
+	if q := m.qualityLocked(now.Add(time.Minute)); q.Throughput != 0 {
+		t.Errorf("expected old reads to age out, got %v", q.Throughput)
+	}
+}
+
+func TestLinkChangedNotifies(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	var warnings []string
+	l.SetWarningHandler(func(_, msg string) { warnings = append(warnings, msg) })
+	events := make(chan LinkQuality, 1)
+	l.SetLinkHandler(func(_ string, q LinkQuality) { events <- q })
+
+	q := LinkQuality{Heartbeats: 3, HeartbeatLoss: 1, Degraded: true, Reasons: []string{"3 of the last 3 heartbeats unanswered"}}
+	l.linkChanged("10.0.0.1:1000", false, q)
+	if len(warnings) != 0 {
+		t.Fatal("expected no warning without a change")
+	}
+	l.linkChanged("10.0.0.1:1000", true, q)
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "link degraded") {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+	select {
+	case got := <-events:
+		if !got.Degraded {
+			t.Errorf("expected a degraded event, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("link handler not called")
+	}
+}
+
+func TestIsKeepalive(t *testing.T) {
+	if !isKeepalive(protocol.CmdPong + "\r\n" + protocol.EndOfOutputMarker + "\n") {
+		t.Error("expected PONG to be a keepalive")
+	}
+	if isKeepalive("PONGS\n" + protocol.EndOfOutputMarker) {
+		t.Error("expected other output not to be a keepalive")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reverseDNSTTL     = 10 * time.Minute // How long a result, including a failure, is cached
+	reverseDNSTimeout = 3 * time.Second
+)
+
+type rdnsEntry struct {
+	name    string
+	expires time.Time
+	pending bool
+}
+
+// reverseResolver looks up client source IPs in the background and caches
+// the names, so listing clients never waits on DNS.
+type reverseResolver struct {
+	mu      sync.Mutex
+	enabled bool
+	cache   map[string]rdnsEntry
+	lookup  func(ctx context.Context, ip string) ([]string, error)
+}
+
+func newReverseResolver() *reverseResolver {
+	return &reverseResolver{
+		cache:  make(map[string]rdnsEntry),
+		lookup: net.DefaultResolver.LookupAddr,
+	}
+}
+
+func (r *reverseResolver) setEnabled(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = enabled
+	if !enabled {
+		r.cache = make(map[string]rdnsEntry)
+	}
+}
+
+// resolve returns the cached name for ip, or "" when none is known yet, and
+// starts a lookup if the entry is missing or stale.
+func (r *reverseResolver) resolve(ip string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.enabled || net.ParseIP(ip) == nil {
+		return ""
+	}
+	entry, ok := r.cache[ip]
+	if ok && (entry.pending || time.Now().Before(entry.expires)) {
+		return entry.name
+	}
+	entry.pending = true
+	r.cache[ip] = entry
+	go r.fetch(ip)
+	return entry.name
+}
+
+func (r *reverseResolver) fetch(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+	var name string
+	if names, err := r.lookup(ctx, ip); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enabled {
+		r.cache[ip] = rdnsEntry{name: name, expires: time.Now().Add(reverseDNSTTL)}
+	}
+}
+
+// SetReverseDNS enables or disables reverse lookups of client source IPs.
+// It is off by default; disabling it also drops cached names.
+func (l *Listener) SetReverseDNS(enabled bool) {
+	l.rdns.setEnabled(enabled)
+}
+
+// ReverseDNS returns the name a client's source IP resolves to, or "" when
+// lookups are disabled, still running or found nothing.
+func (l *Listener) ReverseDNS(clientAddr string) string {
+	host, _, err := net.SplitHostPort(clientAddr)
+	if err != nil {
+		return ""
+	}
+	return l.rdns.resolve(host)
+}
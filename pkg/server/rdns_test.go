@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForName(t *testing.T, l *Listener, clientAddr, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := l.ReverseDNS(clientAddr); got == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected reverse DNS name %q for %s, got %q", want, clientAddr, l.ReverseDNS(clientAddr))
+}
+
+func TestReverseDNSCachesLookups(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	var lookups int32
+	l.rdns.lookup = func(ctx context.Context, ip string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		if ip == "10.0.0.9" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"web1.corp.example."}, nil
+	}
+
+	if got := l.ReverseDNS("10.0.0.5:40000"); got != "" {
+		t.Errorf("expected no name while disabled, got %q", got)
+	}
+	l.SetReverseDNS(true)
+	waitForName(t, l, "10.0.0.5:40000", "web1.corp.example")
+	l.ReverseDNS("10.0.0.5:40001")
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Errorf("expected one lookup per IP, got %d", n)
+	}
+
+	l.ReverseDNS("10.0.0.9:1")
+	time.Sleep(20 * time.Millisecond)
+	if got := l.ReverseDNS("10.0.0.9:1"); got != "" {
+		t.Errorf("expected empty name for failed lookup, got %q", got)
+	}
+	if n := atomic.LoadInt32(&lookups); n != 2 {
+		t.Errorf("expected failed lookup to be cached, got %d lookups", n)
+	}
+
+	if got := l.ReverseDNS("unix:3"); got != "" {
+		t.Errorf("expected no name for a non-IP address, got %q", got)
+	}
+	l.SetReverseDNS(false)
+	if got := l.ReverseDNS("10.0.0.5:40000"); got != "" {
+		t.Errorf("expected no name after disabling, got %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"slices"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// rekeyResumeWindow is how long the listener waits for a client it asked
+// to rekey to come back before it forgets the old session.
+const rekeyResumeWindow = 2 * time.Minute
+
+// rekeyedSession is a client asked to reconnect for new session keys.
+type rekeyedSession struct {
+	meta      ClientMetadata // Set once the old connection is gone
+	approved  bool
+	gone      bool
+	requested time.Time
+}
+
+// SetRekeyInterval makes clients that announce CapRekey reconnect for new
+// TLS session keys once they have been connected this long. The client
+// waits until nothing is in flight and resumes its TLS session, so the
+// handshake is short; the new session takes over the old one's tags, jobs
+// and approval. Zero disables rekeying.
+func (l *Listener) SetRekeyInterval(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rekeyInterval = d
+}
+
+// SetRekeyFunc sets the handler told when a client came back after a
+// rekey, with its old and new address, e.g. to move the tunnels the caller
+// runs through it. It runs on its own goroutine.
+func (l *Listener) SetRekeyFunc(fn func(from, to string)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rekeyFunc = fn
+}
+
+// rekeyDue reports whether a client connected since connected should be
+// asked for new session keys now. Clients in a PTY shell or with file
+// watches are left alone, as a reconnect would end those.
+func (l *Listener) rekeyDue(clientAddr string, connected time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.rekeyInterval <= 0 || time.Since(connected) < l.rekeyInterval {
+		return false
+	}
+	if !l.clientMetadata[clientAddr].Announces(protocol.CapRekey) || l.clientPtyMode[clientAddr] {
+		return false
+	}
+	for _, w := range l.watches {
+		if w.ClientAddr == clientAddr {
+			return false
+		}
+	}
+	if l.rekeying == nil {
+		l.rekeying = make(map[string]*rekeyedSession)
+	}
+	l.rekeying[clientAddr] = &rekeyedSession{requested: time.Now()}
+	return true
+}
+
+// rekeyDisconnectedLocked keeps the state of a client that was asked to
+// rekey when its connection ends, for the session that replaces it.
+func (l *Listener) rekeyDisconnectedLocked(clientAddr string) {
+	if s, ok := l.rekeying[clientAddr]; ok {
+		s.meta = l.clientMetadata[clientAddr]
+		s.approved = l.approved[clientAddr]
+		s.gone = true
+	}
+}
+
+// resumeRekeyedLocked looks for the session a newly identified client
+// replaces after a rekey: same identifier, same host. It moves that
+// session's tags, approval and deferred operations to clientAddr and
+// returns its address, or "" if there is none.
+func (l *Listener) resumeRekeyedLocked(clientAddr string, meta *ClientMetadata) string {
+	for from, s := range l.rekeying {
+		if time.Since(s.requested) > rekeyResumeWindow {
+			delete(l.rekeying, from)
+			continue
+		}
+		old, approved := s.meta, s.approved
+		if !s.gone {
+			// The new connection won the race with the old one's teardown
+			old, approved = l.clientMetadata[from], l.approved[from]
+		}
+		if from == clientAddr || old.Identifier != meta.Identifier || !sameHost(old, *meta) {
+			continue
+		}
+		delete(l.rekeying, from)
+		for _, tag := range old.Tags {
+			if !slices.Contains(meta.Tags, tag) {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+		if approved {
+			if l.approved == nil {
+				l.approved = make(map[string]bool)
+			}
+			l.approved[clientAddr] = true
+		}
+		if l.onConnectRan == nil {
+			l.onConnectRan = make(map[string]bool)
+		}
+		l.onConnectRan[clientAddr] = true
+		l.scheduler.Reassign(from, clientAddr)
+		if fn := l.rekeyFunc; fn != nil {
+			go fn(from, clientAddr)
+		}
+		return from
+	}
+	return ""
+}
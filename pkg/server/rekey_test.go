@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestRekeyDue(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	connected := time.Now().Add(-time.Hour)
+	l.mutex.Lock()
+	l.clientMetadata["a"] = ClientMetadata{Identifier: "aaaa1111", Capabilities: []string{protocol.CapExec, protocol.CapRekey}}
+	l.clientMetadata["old"] = ClientMetadata{Identifier: "bbbb2222"} // Predates negotiation
+	l.clientMetadata["b"] = ClientMetadata{Identifier: "cccc3333", Capabilities: []string{protocol.CapRekey}}
+	l.clientPtyMode["b"] = true
+	l.mutex.Unlock()
+
+	if l.rekeyDue("a", connected) {
+		t.Error("expected no rekey without an interval")
+	}
+	l.SetRekeyInterval(2 * time.Hour)
+	if l.rekeyDue("a", connected) {
+		t.Error("expected no rekey before the interval is up")
+	}
+	l.SetRekeyInterval(time.Minute)
+	if l.rekeyDue("old", connected) || l.rekeyDue("b", connected) {
+		t.Error("expected no rekey for a client without the capability or in a PTY shell")
+	}
+	l.mutex.Lock()
+	l.watches = map[string]Watch{}
+	l.watches["1"] = Watch{ID: "1", ClientAddr: "a", Path: "/etc"}
+	l.mutex.Unlock()
+	if l.rekeyDue("a", connected) {
+		t.Error("expected no rekey for a client with a watch")
+	}
+	l.mutex.Lock()
+	delete(l.watches, "1")
+	l.mutex.Unlock()
+	if !l.rekeyDue("a", connected) {
+		t.Error("expected a rekey once the interval is up")
+	}
+}
+
+func TestHandleClientRekey(t *testing.T) {
+	cert, _, _ := certs.GenerateSelfSignedCert()
+	listener := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	listener.SetRekeyInterval(time.Millisecond)
+	rekeyed := make(chan [2]string, 1)
+	listener.SetRekeyFunc(func(from, to string) { rekeyed <- [2]string{from, to} })
+	netListener, err := listener.Start()
+	if err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	defer netListener.Close()
+
+	const ident = "IDENT abcd1234 host=web1 mid=0123456789abcdef caps=exec,rekey tags=lab ping=1\n"
+	conn, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(ident))
+	from := conn.LocalAddr().String()
+	waitForMetadata(t, listener, from)
+	listener.mutex.Lock()
+	meta := listener.clientMetadata[from]
+	meta.Tags = append(meta.Tags, "migrated")
+	listener.clientMetadata[from] = meta
+	listener.mutex.Unlock()
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(protocol.MinPingInterval*time.Second + 5*time.Second))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected REKEY, got %v", err)
+		}
+		if strings.TrimSpace(line) == protocol.CmdRekey {
+			break
+		}
+	}
+	conn.Close()
+
+	conn2, err := tls.Dial("tcp", netListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer conn2.Close()
+	conn2.Write([]byte(ident))
+	to := conn2.LocalAddr().String()
+
+	select {
+	case got := <-rekeyed:
+		if got != [2]string{from, to} {
+			t.Errorf("expected %s to be resumed as %s, got %v", from, to, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new session was not recognized as a rekey")
+	}
+	if meta, _ := listener.GetClientMetadata(to); !reflect.DeepEqual(meta.Tags, []string{"lab", "migrated"}) {
+		t.Errorf("expected the old session's tags, got %v", meta.Tags)
+	}
+}
+
+func waitForMetadata(t *testing.T, l *Listener, clientAddr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := l.GetClientMetadata(clientAddr); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("client %s did not identify", clientAddr)
+}
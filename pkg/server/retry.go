@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// idempotentCommands are the built-in commands that only read state, so
+// sending one twice does no harm.
+var idempotentCommands = map[string]bool{
+	protocol.CmdList:    true,
+	protocol.CmdPeek:    true,
+	protocol.CmdSysinfo: true,
+}
+
+// IsIdempotent reports whether cmd is a built-in command that is safe to
+// send again.
+func IsIdempotent(cmd string) bool {
+	name, _, _ := strings.Cut(cmd, " ")
+	return idempotentCommands[name]
+}
+
+// SetRetryIdempotent makes Query send idempotent commands a second time
+// when the first attempt times out but the client is still connected.
+func (l *Listener) SetRetryIdempotent(enabled bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.retryIdempotent = enabled
+}
+
+// Query sends cmd and waits for its response. If retries are enabled, cmd
+// is idempotent and the client is still connected after a timeout, it is
+// sent once more; retried reports that. The reply a timed-out attempt
+// still owes is discarded when it arrives, so it cannot be taken for the
+// answer to a later command.
+func (l *Listener) Query(clientAddr, cmd string, timeout time.Duration) (resp string, retried bool, err error) {
+	if err := l.SendCommand(clientAddr, cmd); err != nil {
+		return "", false, err
+	}
+	resp, err = l.GetResponse(clientAddr, timeout)
+	if err == nil {
+		return resp, false, nil
+	}
+	l.expectStaleResponse(clientAddr)
+
+	l.mutex.Lock()
+	retry := l.retryIdempotent
+	l.mutex.Unlock()
+	if !retry || !IsIdempotent(cmd) || !l.connected(clientAddr) {
+		return "", false, err
+	}
+	log.Printf("[!] No response from %s to %s within %s, retrying once", clientAddr, strings.Fields(cmd)[0], timeout)
+	if err := l.SendCommand(clientAddr, cmd); err != nil {
+		return "", true, err
+	}
+	resp, err = l.GetResponse(clientAddr, timeout)
+	if err != nil {
+		l.expectStaleResponse(clientAddr)
+		return "", true, fmt.Errorf("%w (after one retry)", err)
+	}
+	return resp, true, nil
+}
+
+// expectStaleResponse notes that a client owes a reply nobody waits for.
+func (l *Listener) expectStaleResponse(clientAddr string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.clientConnections[clientAddr]; !ok {
+		return
+	}
+	if l.staleResponses == nil {
+		l.staleResponses = make(map[string]int)
+	}
+	l.staleResponses[clientAddr]++
+}
+
+// dropStaleResponse reports whether a response is one a timed-out Query
+// gave up on and uses it up. Keepalive replies are never stale.
+func (l *Listener) dropStaleResponse(clientAddr, resp string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.staleResponses[clientAddr] == 0 {
+		return false
+	}
+	if isKeepalive(resp) {
+		return false
+	}
+	l.staleResponses[clientAddr]--
+	return true
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	for _, cmd := range []string{"LIST /tmp", "PEEK 512 /etc/passwd", protocol.CmdSysinfo} {
+		if !IsIdempotent(cmd) {
+			t.Errorf("expected %q to be idempotent", cmd)
+		}
+	}
+	for _, cmd := range []string{"rm -rf /tmp/x", "DELETE /tmp/x", "LISTEN 80"} {
+		if IsIdempotent(cmd) {
+			t.Errorf("expected %q not to be idempotent", cmd)
+		}
+	}
+}
+
+// fakeClient answers commands sent to addr on l, skipping the first skip.
+func fakeClient(l *Listener, addr string, skip int) (cmds chan string) {
+	cmdChan := make(chan string, 10)
+	respChan := make(chan string, 10)
+	l.clientConnections[addr] = cmdChan
+	l.clientResponses[addr] = respChan
+	cmds = make(chan string, 10)
+	go func() {
+		for cmd := range cmdChan {
+			cmds <- cmd
+			if skip > 0 {
+				skip--
+				continue
+			}
+			respChan <- "OK\n" + protocol.EndOfOutputMarker
+		}
+	}()
+	return cmds
+}
+
+func TestQueryRetriesIdempotent(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	addr := "10.0.0.1:1000"
+	cmds := fakeClient(l, addr, 2)
+
+	if _, _, err := l.Query(addr, protocol.CmdSysinfo, 50*time.Millisecond); err == nil {
+		t.Fatal("expected a timeout with retries off")
+	}
+
+	l.SetRetryIdempotent(true)
+	resp, retried, err := l.Query(addr, protocol.CmdSysinfo, 50*time.Millisecond)
+	if err != nil || !retried || !strings.HasPrefix(resp, "OK") {
+		t.Fatalf("Query = %q, %t, %v; want a retried OK", resp, retried, err)
+	}
+	if n := len(cmds); n != 3 {
+		t.Errorf("expected 3 commands sent, got %d", n)
+	}
+	close(l.clientConnections[addr])
+}
+
+func TestQueryDoesNotRetryOthers(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.SetRetryIdempotent(true)
+	addr := "10.0.0.1:1000"
+	cmds := fakeClient(l, addr, 1)
+	defer close(l.clientConnections[addr])
+
+	if _, retried, err := l.Query(addr, "touch /tmp/x", 50*time.Millisecond); err == nil || retried {
+		t.Fatalf("expected a timeout without retry, got retried=%t err=%v", retried, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := len(cmds); n != 1 {
+		t.Errorf("expected 1 command sent, got %d", n)
+	}
+}
+
+func TestDropStaleResponse(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	addr := "10.0.0.1:1000"
+	if l.dropStaleResponse(addr, "OK") {
+		t.Fatal("nothing is stale before a timeout")
+	}
+	l.expectStaleResponse(addr)
+	if l.dropStaleResponse(addr, "OK") {
+		t.Fatal("a disconnected client owes no replies")
+	}
+
+	l.clientConnections[addr] = make(chan string, 1)
+	l.expectStaleResponse(addr)
+	if l.dropStaleResponse(addr, protocol.CmdPong+"\n"+protocol.EndOfOutputMarker) {
+		t.Error("keepalive replies must not be dropped")
+	}
+	if !l.dropStaleResponse(addr, "late\n"+protocol.EndOfOutputMarker) {
+		t.Error("expected the late reply to be dropped")
+	}
+	if l.dropStaleResponse(addr, "next") {
+		t.Error("only one reply was owed")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// DefaultSandboxHostnames are hostname patterns (path.Match syntax, matched
+// case-insensitively) that analysis sandboxes and honeypots commonly use.
+var DefaultSandboxHostnames = []string{"*sandbox*", "*malware*", "*cuckoo*", "*honeypot*", "*analysis*", "*virus*", "*maltest*"}
+
+const (
+	// sandboxProbeSleep is the sleep asked of a client on connect. A reply
+	// that arrives sooner means the sandbox skipped it.
+	sandboxProbeSleep = time.Second
+	// sandboxMinUptime flags hosts that booted just before the client ran,
+	// as sandboxes do for every sample.
+	sandboxMinUptime = 10 * time.Minute
+)
+
+// SetSandboxChecks enables checks on connect that flag clients which are
+// likely analysis sandboxes or honeypots: hostnames matching one of the
+// patterns (DefaultSandboxHostnames if none), and a SYSINFO probe for
+// skipped sleeps, single CPUs, fresh boots and sandbox artifacts.
+func (l *Listener) SetSandboxChecks(enabled bool, hostnamePatterns []string) {
+	if len(hostnamePatterns) == 0 {
+		hostnamePatterns = DefaultSandboxHostnames
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sandboxChecks = enabled
+	l.sandboxHostnames = hostnamePatterns
+}
+
+// SandboxFlags returns why a client looks like a sandbox or honeypot, or
+// nil if no check flagged it.
+func (l *Listener) SandboxFlags(clientAddr string) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.sandboxFlags[clientAddr]...)
+}
+
+// ParseSysinfo returns the key=value pairs of a SYSINFO response.
+func ParseSysinfo(resp string) (map[string]string, error) {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(resp, protocol.EndOfOutputMarker, "")), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "OK" {
+		return nil, errors.New(strings.Join(lines, " "))
+	}
+	info := make(map[string]string, len(lines)-1)
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			info[key] = value
+		}
+	}
+	return info, nil
+}
+
+// checkSandbox runs the sandbox checks on a client that just identified
+// itself and notifies the operator of anything it flags.
+func (l *Listener) checkSandbox(clientAddr string, meta ClientMetadata) {
+	l.mutex.Lock()
+	enabled, patterns := l.sandboxChecks, l.sandboxHostnames
+	l.mutex.Unlock()
+	if !enabled {
+		return
+	}
+
+	flags := hostnameFlags(meta.Hostname, patterns)
+	// Older clients would run SYSINFO <sleep_ms> as a shell command
+	if meta.Announces(protocol.CapProbe) {
+		err := l.scheduler.Run(context.Background(), clientAddr, []string{ResponseKey}, func() error {
+			probeFlags, err := l.probeSandbox(clientAddr)
+			flags = append(flags, probeFlags...)
+			return err
+		})
+		if err != nil && !errors.Is(err, ErrSchedulerClosed) && l.connected(clientAddr) {
+			l.warn(clientAddr, fmt.Sprintf("sandbox probe failed: %v", err))
+		}
+	}
+	if len(flags) == 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	if _, ok := l.clientConnections[clientAddr]; ok {
+		if l.sandboxFlags == nil {
+			l.sandboxFlags = make(map[string][]string)
+		}
+		l.sandboxFlags[clientAddr] = flags
+	}
+	l.mutex.Unlock()
+	l.warn(clientAddr, "likely sandbox or honeypot: "+strings.Join(flags, "; "))
+}
+
+// connected reports whether a client is still connected.
+func (l *Listener) connected(clientAddr string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, ok := l.clientConnections[clientAddr]
+	return ok
+}
+
+// probeSandbox asks a client for SYSINFO after a sleep and returns what
+// its answer and timing give away.
+func (l *Listener) probeSandbox(clientAddr string) ([]string, error) {
+	start := time.Now()
+	if err := l.SendCommand(clientAddr, fmt.Sprintf("%s %d", protocol.CmdSysinfo, sandboxProbeSleep.Milliseconds())); err != nil {
+		return nil, err
+	}
+	resp, err := l.GetResponse(clientAddr, sandboxProbeSleep+protocol.ResponseTimeout*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+	info, err := ParseSysinfo(resp)
+	if err != nil {
+		return nil, err
+	}
+	return sysinfoFlags(info, elapsed), nil
+}
+
+// hostnameFlags flags a hostname matching one of the patterns.
+func hostnameFlags(hostname string, patterns []string) []string {
+	host := strings.ToLower(hostname)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok && host != "" {
+			return []string{fmt.Sprintf("hostname %s matches %s", hostname, pattern)}
+		}
+	}
+	return nil
+}
+
+// sysinfoFlags flags the signs of a sandbox in a SYSINFO probe answered
+// after elapsed.
+func sysinfoFlags(info map[string]string, elapsed time.Duration) []string {
+	var flags []string
+	if elapsed < sandboxProbeSleep {
+		flags = append(flags, fmt.Sprintf("%s sleep completed after %s", sandboxProbeSleep, elapsed.Round(time.Millisecond)))
+	}
+	if info["cpus"] == "1" {
+		flags = append(flags, "single CPU")
+	}
+	if secs, err := strconv.ParseInt(info["uptime"], 10, 64); err == nil && time.Duration(secs)*time.Second < sandboxMinUptime {
+		flags = append(flags, fmt.Sprintf("booted %s ago", time.Duration(secs)*time.Second))
+	}
+	if info["artifacts"] != "" {
+		flags = append(flags, "artifacts "+info["artifacts"])
+	}
+	return flags
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestHostnameFlags(t *testing.T) {
+	if flags := hostnameFlags("CUCKOO-PC", DefaultSandboxHostnames); len(flags) != 1 || !strings.Contains(flags[0], "*cuckoo*") {
+		t.Errorf("expected the hostname to be flagged, got %q", flags)
+	}
+	for _, host := range []string{"web-1", ""} {
+		if flags := hostnameFlags(host, DefaultSandboxHostnames); flags != nil {
+			t.Errorf("hostname %q flagged: %q", host, flags)
+		}
+	}
+}
+
+func TestSysinfoFlags(t *testing.T) {
+	info, err := ParseSysinfo("OK\ncpus=1\nuptime=120\nartifacts=dmi-virtualbox,vbox-guest\n" + protocol.EndOfOutputMarker)
+	if err != nil {
+		t.Fatalf("ParseSysinfo failed: %v", err)
+	}
+	flags := sysinfoFlags(info, 5*time.Millisecond)
+	want := []string{"sleep completed after 5ms", "single CPU", "booted 2m0s ago", "artifacts dmi-virtualbox,vbox-guest"}
+	if len(flags) != len(want) {
+		t.Fatalf("expected %d flags, got %q", len(want), flags)
+	}
+	for i, w := range want {
+		if !strings.Contains(flags[i], w) {
+			t.Errorf("flag %d = %q, want %q", i, flags[i], w)
+		}
+	}
+
+	info, _ = ParseSysinfo("OK\ncpus=8\nuptime=864000\n")
+	if flags := sysinfoFlags(info, sandboxProbeSleep+time.Millisecond); flags != nil {
+		t.Errorf("expected a real host not to be flagged, got %q", flags)
+	}
+	if _, err := ParseSysinfo("Invalid sysinfo command"); err == nil {
+		t.Error("expected an error for a failed SYSINFO")
+	}
+}
+
+func TestCheckSandboxFlagsHostname(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	var warnings []string
+	l.SetWarningHandler(func(_, msg string) { warnings = append(warnings, msg) })
+	addr := "10.0.0.1:1000"
+	l.clientConnections[addr] = make(chan string, 1)
+
+	meta := ClientMetadata{Hostname: "malware-lab", Capabilities: []string{"exec"}}
+	l.checkSandbox(addr, meta)
+	if len(warnings) != 0 || l.SandboxFlags(addr) != nil {
+		t.Fatal("checks must be off by default")
+	}
+
+	l.SetSandboxChecks(true, []string{"*-lab"})
+	l.checkSandbox(addr, meta)
+	if flags := l.SandboxFlags(addr); len(flags) != 1 || !strings.Contains(flags[0], "matches *-lab") {
+		t.Fatalf("unexpected flags %q", flags)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "likely sandbox or honeypot") {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
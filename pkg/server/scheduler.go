@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ResponseKey is held by every operation that waits for a command response.
+// Responses carry no request ID, so two such operations on one client would
+// steal each other's replies; they must run one at a time.
+const ResponseKey = "response"
+
+// PathKey returns the conflict key for an operation touching a remote path,
+// so that e.g. two uploads to the same file never overlap.
+func PathKey(path string) string {
+	return "path:" + path
+}
+
+// ErrSchedulerClosed is returned by Run after Close.
+var ErrSchedulerClosed = errors.New("scheduler closed")
+
+// Scheduler runs operations against clients, allowing up to a fixed number
+// in parallel per client while serializing operations that share a key.
+// Clients can be grouped (e.g. duplicate sessions from one host) so that keys
+// other than ResponseKey conflict across the whole group.
+type Scheduler struct {
+	mu          sync.Mutex
+	maxParallel int
+	running     map[string]int    // clientAddr -> running operations
+	held        map[string]bool   // Scoped keys of running operations
+	groups      map[string]string // clientAddr -> group
+	changed     chan struct{}     // Closed and replaced whenever capacity is freed
+	closed      bool
+	jobs        map[int]*scheduledJob // Deferred operations by ID, see ScheduleAt
+	nextJobID   int
+	jobDone     func(Job, error)
+}
+
+// NewScheduler creates a scheduler allowing maxParallel concurrent operations
+// per client. Values below 1 are treated as 1.
+func NewScheduler(maxParallel int) *Scheduler {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	return &Scheduler{
+		maxParallel: maxParallel,
+		running:     make(map[string]int),
+		held:        make(map[string]bool),
+		groups:      make(map[string]string),
+		changed:     make(chan struct{}),
+		jobs:        make(map[int]*scheduledJob),
+	}
+}
+
+// SetMaxParallel changes the per-client limit for operations started later.
+func (s *Scheduler) SetMaxParallel(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.mu.Lock()
+	s.maxParallel = n
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+// SetGroup places a client in a group whose members share conflict keys.
+// An empty group removes the client from its group.
+func (s *Scheduler) SetGroup(clientAddr, group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if group == "" {
+		delete(s.groups, clientAddr)
+		return
+	}
+	s.groups[clientAddr] = group
+}
+
+// Run waits until the client has a free slot and none of keys is held, then
+// runs fn. It returns ctx's error if ctx ends while waiting.
+func (s *Scheduler) Run(ctx context.Context, clientAddr string, keys []string, fn func() error) error {
+	scoped, err := s.acquire(ctx, clientAddr, keys)
+	if err != nil {
+		return err
+	}
+	defer s.release(clientAddr, scoped)
+	return fn()
+}
+
+func (s *Scheduler) acquire(ctx context.Context, clientAddr string, keys []string) ([]string, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrSchedulerClosed
+		}
+		scoped := s.scopeKeys(clientAddr, keys)
+		if s.running[clientAddr] < s.maxParallel && !s.holdsAny(scoped) {
+			s.running[clientAddr]++
+			for _, key := range scoped {
+				s.held[key] = true
+			}
+			s.mu.Unlock()
+			return scoped, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) release(clientAddr string, scoped []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[clientAddr]--; s.running[clientAddr] <= 0 {
+		delete(s.running, clientAddr)
+	}
+	for _, key := range scoped {
+		delete(s.held, key)
+	}
+	s.notifyLocked()
+}
+
+// scopeKeys qualifies keys with the client, or with its group for keys other
+// than ResponseKey, which always belongs to one connection.
+func (s *Scheduler) scopeKeys(clientAddr string, keys []string) []string {
+	scope := "client:" + clientAddr
+	if group, ok := s.groups[clientAddr]; ok {
+		scope = "group:" + group
+	}
+	scoped := make([]string, len(keys))
+	for i, key := range keys {
+		if key == ResponseKey {
+			scoped[i] = "client:" + clientAddr + "\x00" + key
+		} else {
+			scoped[i] = scope + "\x00" + key
+		}
+	}
+	return scoped
+}
+
+func (s *Scheduler) holdsAny(scoped []string) bool {
+	for _, key := range scoped {
+		if s.held[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// Close rejects new operations, drops deferred ones and wakes any waiting
+// ones. Running operations are not interrupted.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for id, job := range s.jobs {
+		job.timer.Stop()
+		delete(s.jobs, id)
+	}
+	s.notifyLocked()
+}
+
+func (s *Scheduler) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
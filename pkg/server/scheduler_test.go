@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSerializesConflictingKeys(t *testing.T) {
+	s := NewScheduler(4)
+	var running, maxSeen int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Run(context.Background(), "c1", []string{PathKey("/tmp/a")}, func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxSeen)
+					if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Run failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxSeen != 1 {
+		t.Errorf("expected operations on one path to serialize, saw %d concurrent", maxSeen)
+	}
+}
+
+func TestSchedulerRunsIndependentOpsConcurrently(t *testing.T) {
+	s := NewScheduler(2)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	for _, path := range []string{"/a", "/b"} {
+		go s.Run(context.Background(), "c1", []string{PathKey(path)}, func() error {
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("independent operations did not run concurrently")
+		}
+	}
+
+	// A third operation exceeds the limit and must wait
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Run(ctx, "c1", []string{PathKey("/c")}, func() error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded at the parallel limit, got %v", err)
+	}
+
+	// Other clients have their own limit
+	if err := s.Run(context.Background(), "c2", nil, func() error { return nil }); err != nil {
+		t.Errorf("expected other client to run, got %v", err)
+	}
+	close(release)
+}
+
+func TestSchedulerClose(t *testing.T) {
+	s := NewScheduler(1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.Run(context.Background(), "c1", []string{ResponseKey}, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- s.Run(context.Background(), "c1", []string{ResponseKey}, func() error { return nil })
+	}()
+	s.Close()
+
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, ErrSchedulerClosed) {
+			t.Errorf("expected ErrSchedulerClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting operation was not woken by Close")
+	}
+	close(release)
+}
+
+func TestSchedulerGroupSharesPathKeys(t *testing.T) {
+	s := NewScheduler(4)
+	s.SetGroup("c1", "host")
+	s.SetGroup("c2", "host")
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.Run(context.Background(), "c1", []string{ResponseKey, PathKey("/a")}, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	// ResponseKey stays per connection
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Run(ctx, "c2", []string{ResponseKey}, func() error { return nil }); err != nil {
+		t.Fatalf("expected response key to be per client, got %v", err)
+	}
+
+	// Path keys are shared across the group
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+	if err := s.Run(ctx2, "c2", []string{PathKey("/a")}, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected same path on a duplicate session to wait, got %v", err)
+	}
+
+	s.SetGroup("c2", "")
+	if err := s.Run(context.Background(), "c2", []string{PathKey("/a")}, func() error { return nil }); err != nil {
+		t.Fatalf("expected ungrouped client to run, got %v", err)
+	}
+	close(release)
+}
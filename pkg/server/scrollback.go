@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxScrollbacks bounds the hosts whose PTY output is kept.
+const maxScrollbacks = 100
+
+// scrollbackSaveInterval is how often changed scrollback is written to the
+// scrollback directory.
+const scrollbackSaveInterval = 5 * time.Second
+
+// PtyScrollback is the most recent PTY output of a host, kept so an
+// operator opening a shell again sees where the last one left off.
+type PtyScrollback struct {
+	Data    []byte    // At most the configured size, starting at a line
+	Client  string    // Address of the session that wrote it
+	Updated time.Time // When output last arrived
+}
+
+// SetPtyScrollback sets how many bytes of PTY output are kept per host.
+// Zero stops keeping output and drops what was kept.
+func (l *Listener) SetPtyScrollback(size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.scrollbackSize = size
+	for key, sb := range l.scrollbacks {
+		l.markScrollbackLocked(key)
+		if size > 0 {
+			sb.Data = trimScrollback(sb.Data, size)
+		}
+	}
+	if size <= 0 {
+		l.scrollbacks = nil
+	}
+}
+
+// scrollbackFile is a host's scrollback as saved in the scrollback
+// directory.
+type scrollbackFile struct {
+	Host    string    `json:"host"`
+	Client  string    `json:"client"`
+	Updated time.Time `json:"updated"`
+	Data    []byte    `json:"data"`
+}
+
+// SetScrollbackDir keeps the PTY scrollback in dir as well, so it survives
+// a listener restart: what dir holds is loaded now, and changes are saved
+// every few seconds and on Shutdown. Call it after SetPtyScrollback.
+func (l *Listener) SetScrollbackDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var saved []scrollbackFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		var f scrollbackFile
+		if err := json.Unmarshal(data, &f); err != nil || f.Host == "" {
+			log.Printf("Warning: ignoring invalid scrollback file %s", entry.Name())
+			continue
+		}
+		saved = append(saved, f)
+	}
+	// Oldest first, so the newest hosts remain if there are too many
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Updated.Before(saved[j].Updated) })
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.scrollbackDir = dir
+	for _, f := range saved {
+		if l.scrollbackSize <= 0 {
+			l.markScrollbackLocked(f.Host)
+			continue
+		}
+		if l.scrollbacks == nil {
+			l.scrollbacks = make(map[string]*PtyScrollback)
+		}
+		if _, ok := l.scrollbacks[f.Host]; ok {
+			continue
+		}
+		if len(l.scrollbacks) >= maxScrollbacks {
+			l.dropOldestScrollbackLocked()
+		}
+		l.scrollbacks[f.Host] = &PtyScrollback{Data: trimScrollback(f.Data, l.scrollbackSize), Client: f.Client, Updated: f.Updated}
+	}
+	if l.scrollbackStop == nil && !l.shuttingDown {
+		l.scrollbackStop = make(chan struct{})
+		go l.saveScrollbackPeriodically(l.scrollbackStop)
+	}
+	return nil
+}
+
+func (l *Listener) saveScrollbackPeriodically(stop <-chan struct{}) {
+	ticker := time.NewTicker(scrollbackSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.saveScrollback()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// saveScrollback writes the scrollback of the hosts that changed since the
+// last save to the scrollback directory and removes the files of dropped
+// hosts.
+func (l *Listener) saveScrollback() {
+	l.scrollbackSaveMu.Lock()
+	defer l.scrollbackSaveMu.Unlock()
+
+	l.mutex.Lock()
+	dir := l.scrollbackDir
+	changed := make(map[string]*scrollbackFile, len(l.scrollbackDirty))
+	for key := range l.scrollbackDirty {
+		if sb, ok := l.scrollbacks[key]; ok {
+			changed[key] = &scrollbackFile{Host: key, Client: sb.Client, Updated: sb.Updated, Data: bytes.Clone(sb.Data)}
+		} else {
+			changed[key] = nil
+		}
+	}
+	l.scrollbackDirty = nil
+	l.mutex.Unlock()
+
+	for key, f := range changed {
+		path := scrollbackPath(dir, key)
+		if f == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: failed to remove scrollback of %s: %v", key, err)
+			}
+			continue
+		}
+		if err := writeScrollbackFile(path, f); err != nil {
+			log.Printf("Warning: failed to save scrollback of %s: %v", key, err)
+		}
+	}
+}
+
+// scrollbackPath names a host's file by a hash of its key, which may be a
+// client address.
+func scrollbackPath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// writeScrollbackFile replaces path atomically, so a crash mid-write leaves
+// the previous save.
+func writeScrollbackFile(path string, f *scrollbackFile) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".scrollback-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// markScrollbackLocked notes that a host's scrollback must be saved, or its
+// file removed, on the next save.
+func (l *Listener) markScrollbackLocked(key string) {
+	if l.scrollbackDir == "" {
+		return
+	}
+	if l.scrollbackDirty == nil {
+		l.scrollbackDirty = make(map[string]bool)
+	}
+	l.scrollbackDirty[key] = true
+}
+
+// recordPtyOutput adds PTY output from a client to its host's scrollback.
+// Hosts are keyed by machine ID like listing archives, so the output
+// outlives the session that wrote it.
+func (l *Listener) recordPtyOutput(clientAddr string, data []byte) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.scrollbackSize <= 0 {
+		return
+	}
+	key := l.hostKeyLocked(clientAddr)
+	if l.scrollbacks == nil {
+		l.scrollbacks = make(map[string]*PtyScrollback)
+	}
+	sb, ok := l.scrollbacks[key]
+	if !ok {
+		if len(l.scrollbacks) >= maxScrollbacks {
+			l.dropOldestScrollbackLocked()
+		}
+		sb = &PtyScrollback{}
+		l.scrollbacks[key] = sb
+	}
+	sb.Data = trimScrollback(append(sb.Data, data...), l.scrollbackSize)
+	sb.Client, sb.Updated = clientAddr, time.Now()
+	l.markScrollbackLocked(key)
+}
+
+// PtyScrollback returns a copy of the PTY output kept for a client's host,
+// from this or an earlier session.
+func (l *Listener) PtyScrollback(clientAddr string) (PtyScrollback, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sb, ok := l.scrollbacks[l.hostKeyLocked(clientAddr)]
+	if !ok || len(sb.Data) == 0 {
+		return PtyScrollback{}, false
+	}
+	out := *sb
+	out.Data = bytes.Clone(sb.Data)
+	return out, true
+}
+
+// hostKeyLocked identifies a client's host across sessions: its machine ID,
+// or the client address if none was announced.
+func (l *Listener) hostKeyLocked(clientAddr string) string {
+	if id := l.clientMetadata[clientAddr].MachineID; id != "" {
+		return id
+	}
+	return clientAddr
+}
+
+func (l *Listener) dropOldestScrollbackLocked() {
+	oldest := ""
+	for key, sb := range l.scrollbacks {
+		if oldest == "" || sb.Updated.Before(l.scrollbacks[oldest].Updated) {
+			oldest = key
+		}
+	}
+	delete(l.scrollbacks, oldest)
+	l.markScrollbackLocked(oldest)
+}
+
+// trimScrollback keeps the last size bytes of data, from the start of a
+// line when one begins in them, so replaying it does not open with half a
+// line or escape sequence.
+func trimScrollback(data []byte, size int) []byte {
+	if len(data) <= size {
+		return data
+	}
+	kept := data[len(data)-size:]
+	if i := bytes.IndexByte(kept, '\n'); i >= 0 && i+1 < len(kept) {
+		kept = kept[i+1:]
+	}
+	// Move the kept output to the front, so the buffer is reused rather
+	// than growing with every write
+	return append(data[:0], kept...)
+}
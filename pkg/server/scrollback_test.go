@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestPtyScrollback(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	l.SetPtyScrollback(16)
+	l.clientMetadata["10.0.0.1:1000"] = ClientMetadata{MachineID: "m1"}
+	l.clientMetadata["10.0.0.1:2000"] = ClientMetadata{MachineID: "m1"}
+
+	if _, ok := l.PtyScrollback("10.0.0.1:1000"); ok {
+		t.Fatal("expected no scrollback before any output")
+	}
+	l.recordPtyOutput("10.0.0.1:1000", []byte("$ ls\r\nfoo bar\r\n"))
+	l.recordPtyOutput("10.0.0.1:1000", []byte("$ id\r\nuid=0\r\n"))
+
+	// A later session of the same host sees it, trimmed to a line start
+	sb, ok := l.PtyScrollback("10.0.0.1:2000")
+	if !ok || !bytes.Equal(sb.Data, []byte("$ id\r\nuid=0\r\n")) || sb.Client != "10.0.0.1:1000" {
+		t.Fatalf("unexpected scrollback %q from %s", sb.Data, sb.Client)
+	}
+	sb.Data[0] = 'X'
+	if again, _ := l.PtyScrollback("10.0.0.1:1000"); again.Data[0] != '$' {
+		t.Error("expected a copy of the kept output")
+	}
+
+	// Output without newlines is cut at the size
+	l.recordPtyOutput("10.0.0.9:9000", bytes.Repeat([]byte("x"), 40))
+	if sb, _ := l.PtyScrollback("10.0.0.9:9000"); len(sb.Data) != 16 {
+		t.Errorf("expected 16 bytes, got %d", len(sb.Data))
+	}
+
+	l.SetPtyScrollback(0)
+	l.recordPtyOutput("10.0.0.1:1000", []byte("more\r\n"))
+	if _, ok := l.PtyScrollback("10.0.0.1:1000"); ok {
+		t.Error("expected no scrollback once disabled")
+	}
+}
+
+func TestPtyScrollbackSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	l := NewListener("0", "127.0.0.1", nil, "")
+	if err := l.SetScrollbackDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	l.clientMetadata["10.0.0.1:1000"] = ClientMetadata{MachineID: "m1"}
+	l.recordPtyOutput("10.0.0.1:1000", []byte("$ id\r\nuid=0\r\n"))
+	l.recordPtyOutput("10.0.0.2:1000", []byte("$ hostname\r\n"))
+	if err := l.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewListener("0", "127.0.0.1", nil, "")
+	if err := restarted.SetScrollbackDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Shutdown(context.Background())
+	restarted.clientMetadata["10.0.0.9:5000"] = ClientMetadata{MachineID: "m1"}
+	sb, ok := restarted.PtyScrollback("10.0.0.9:5000")
+	if !ok || string(sb.Data) != "$ id\r\nuid=0\r\n" || sb.Client != "10.0.0.1:1000" {
+		t.Fatalf("expected the saved scrollback after a restart, got %q from %s (ok=%v)", sb.Data, sb.Client, ok)
+	}
+
+	// Dropping the scrollback removes the saved files too
+	restarted.SetPtyScrollback(0)
+	restarted.saveScrollback()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no saved scrollback, found %d files", len(entries))
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/pcap"
 	"github.com/frjcomp/gots/pkg/protocol"
 )
 
@@ -22,12 +24,28 @@ const (
 	socks5Domain  = 0x03
 	socks5IPv6    = 0x04
 	
-	socks5Success          = 0x00
-	socks5GeneralFailure   = 0x01
-	socks5ConnectionDenied = 0x05
-	socks5HostUnreachable  = 0x04
+	socks5Success            = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5NetworkUnreachable = 0x03
+	socks5HostUnreachable    = 0x04
+	socks5ConnectionRefused  = 0x05
+	socks5TTLExpired         = 0x06
 )
 
+// socksConnectTimeout bounds the wait for a client to reach a target. It is
+// longer than the client's own dial timeout, so the client's verdict, with
+// the reason it failed, usually arrives first.
+const socksConnectTimeout = 30 * time.Second
+
+// socksReplies maps the reasons a client gives for a failed connection to
+// SOCKS5 reply codes. Other reasons are general failures.
+var socksReplies = map[string]byte{
+	protocol.SocksRefused:         socks5ConnectionRefused,
+	protocol.SocksHostUnreachable: socks5HostUnreachable,
+	protocol.SocksNetUnreachable:  socks5NetworkUnreachable,
+	protocol.SocksTimeout:         socks5TTLExpired,
+}
+
 // SocksConnection represents a single SOCKS5 connection
 type SocksConnection struct {
 	ID       string
@@ -41,16 +59,20 @@ type SocksProxy struct {
 	LocalAddr   string
 	Listener    net.Listener
 	Active      bool
-	connections map[string]net.Conn // connID -> connection
-	connReady   map[string]chan bool // connID -> ready signal
+	connections map[string]net.Conn     // connID -> connection
+	connReady   map[string]chan byte    // connID -> SOCKS5 reply once the client tried the target
+	streams     map[string]*pcap.Stream // connID -> capture, when capturing
 	connCount   int
+	reasons     bool // The client says why connections fail
 	mu          sync.Mutex
 	sendFunc    func(string)
+	traffic     tunnelCounters
 }
 
 // SocksManager manages SOCKS5 proxies
 type SocksManager struct {
 	proxies map[string]*SocksProxy
+	capture atomic.Pointer[pcap.Writer] // Nil unless tunnel capture is enabled
 	mu      sync.RWMutex
 }
 
@@ -61,8 +83,10 @@ func NewSocksManager() *SocksManager {
 	}
 }
 
-// StartSocks starts a new SOCKS5 proxy
-func (sm *SocksManager) StartSocks(id, localPort string, sendFunc func(string)) error {
+// StartSocks starts a new SOCKS5 proxy. With reasons, for clients that
+// announce protocol.CapSocksErr, the client is asked why a connection
+// failed, so the local tool gets a matching SOCKS5 reply.
+func (sm *SocksManager) StartSocks(id, localPort string, reasons bool, sendFunc func(string)) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -81,7 +105,8 @@ func (sm *SocksManager) StartSocks(id, localPort string, sendFunc func(string))
 		Listener:    listener,
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
+		reasons:     reasons,
 		sendFunc:    sendFunc,
 	}
 
@@ -119,6 +144,7 @@ func (sm *SocksManager) acceptConnections(proxy *SocksProxy) {
 		logging.Debugf("[+] SOCKS %s: new connection %s from %s", proxy.ID, connID, conn.RemoteAddr())
 
 		// Handle SOCKS5 handshake and proxy
+		proxy.traffic.open()
 		go sm.handleSocksConnection(proxy, connID, conn)
 	}
 }
@@ -126,6 +152,7 @@ func (sm *SocksManager) acceptConnections(proxy *SocksProxy) {
 // handleSocksConnection handles a single SOCKS5 connection
 func (sm *SocksManager) handleSocksConnection(proxy *SocksProxy, connID string, conn net.Conn) {
 	defer func() {
+		proxy.traffic.close()
 		conn.Close()
 		// Connection cleanup is now handled in relayData
 		proxy.sendFunc(fmt.Sprintf("%s %s %s\n", protocol.CmdSocksClose, proxy.ID, connID))
@@ -229,27 +256,34 @@ func (sm *SocksManager) handleSocksConnection(proxy *SocksProxy, connID string,
 	logging.Debugf("[+] SOCKS %s conn %s: connecting to %s", proxy.ID, connID, targetAddr)
 
 	// Create a ready signal for this connection
-	readyChan := make(chan bool, 1)
+	readyChan := make(chan byte, 1)
 	proxy.mu.Lock()
 	proxy.connReady[connID] = readyChan
 	proxy.mu.Unlock()
 
 	// Send connection request to client
-	proxy.sendFunc(fmt.Sprintf("%s %s %s %s\n", protocol.CmdSocksConn, proxy.ID, connID, targetAddr))
+	request := fmt.Sprintf("%s %s %s %s", protocol.CmdSocksConn, proxy.ID, connID, targetAddr)
+	if proxy.reasons {
+		request += " " + protocol.SocksReasonOpt
+	}
+	proxy.sendFunc(request + "\n")
 
-	// Wait for client to establish remote connection (with timeout)
+	// Reply only once the client reached the target or gave up on it
+	reply := byte(socks5TTLExpired)
 	select {
-	case <-readyChan:
-		logging.Debugf("[+] SOCKS %s conn %s: remote connection established", proxy.ID, connID)
-	case <-time.After(5 * time.Second):
+	case reply = <-readyChan:
+	case <-time.After(socksConnectTimeout):
 		logging.Warnf("[-] SOCKS %s conn %s: timeout waiting for remote connection", proxy.ID, connID)
-		// Send failure response to SOCKS client before closing
-		_, _ = conn.Write([]byte{socks5Version, socks5HostUnreachable, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	}
+	if reply != socks5Success {
+		logging.Debugf("[-] SOCKS %s conn %s: client could not reach %s (reply %d)", proxy.ID, connID, targetAddr, reply)
+		_, _ = conn.Write([]byte{socks5Version, reply, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
 		proxy.mu.Lock()
 		delete(proxy.connReady, connID)
 		proxy.mu.Unlock()
 		return
 	}
+	logging.Debugf("[+] SOCKS %s conn %s: remote connection established", proxy.ID, connID)
 
 	// Send success response now that remote side is ready
 	// Response: [version, status, reserved, addr_type, addr, port]
@@ -268,6 +302,12 @@ func (sm *SocksManager) handleSocksConnection(proxy *SocksProxy, connID string,
 	// Store the connection so HandleSocksData can write responses to it
 	proxy.mu.Lock()
 	proxy.connections[connID] = conn
+	if w := sm.capture.Load(); w != nil {
+		if proxy.streams == nil {
+			proxy.streams = make(map[string]*pcap.Stream)
+		}
+		proxy.streams[connID] = w.Stream(conn.RemoteAddr().String(), targetAddr)
+	}
 	proxy.mu.Unlock()
 
 	// Now relay data bidirectionally
@@ -276,11 +316,16 @@ func (sm *SocksManager) handleSocksConnection(proxy *SocksProxy, connID string,
 
 // relayData relays data between local connection and remote
 func (sm *SocksManager) relayData(proxy *SocksProxy, connID string, conn net.Conn) {
+	proxy.mu.Lock()
+	stream := proxy.streams[connID]
+	proxy.mu.Unlock()
 	defer func() {
 		// Cleanup connection when relay ends
+		stream.Close()
 		proxy.mu.Lock()
 		delete(proxy.connections, connID)
 		delete(proxy.connReady, connID)
+		delete(proxy.streams, connID)
 		proxy.mu.Unlock()
 		logging.Debugf("[+] SOCKS %s conn %s: relay ended", proxy.ID, connID)
 	}()
@@ -298,6 +343,8 @@ func (sm *SocksManager) relayData(proxy *SocksProxy, connID string, conn net.Con
 		}
 
 		if n > 0 {
+			stream.Write(true, buffer[:n])
+			proxy.traffic.sent.Add(int64(n))
 			// Encode and send to client
 			encoded := base64.StdEncoding.EncodeToString(buffer[:n])
 			proxy.sendFunc(fmt.Sprintf("%s %s %s %s\n", protocol.CmdSocksData, proxy.ID, connID, encoded))
@@ -309,23 +356,31 @@ func (sm *SocksManager) relayData(proxy *SocksProxy, connID string, conn net.Con
 
 // SignalSocksReady signals that a remote connection is established
 func (sm *SocksManager) SignalSocksReady(socksID, connID string) {
+	sm.signalSocks(socksID, connID, socks5Success)
+}
+
+// signalSocks hands the SOCKS5 reply for a connection that waits for the
+// client to reach its target. It reports whether one was waiting.
+func (sm *SocksManager) signalSocks(socksID, connID string, reply byte) bool {
 	sm.mu.RLock()
 	proxy, exists := sm.proxies[socksID]
 	sm.mu.RUnlock()
 
 	if !exists {
-		return
+		return false
 	}
 
 	proxy.mu.Lock()
-	if readyChan, exists := proxy.connReady[connID]; exists {
+	defer proxy.mu.Unlock()
+	readyChan, exists := proxy.connReady[connID]
+	if exists {
 		select {
-		case readyChan <- true:
+		case readyChan <- reply:
 		default:
 		}
 		delete(proxy.connReady, connID)
 	}
-	proxy.mu.Unlock()
+	return exists
 }
 
 // HandleSocksData handles incoming data from the remote side
@@ -340,6 +395,7 @@ func (sm *SocksManager) HandleSocksData(socksID, connID, encodedData string) err
 
 	proxy.mu.Lock()
 	conn, exists := proxy.connections[connID]
+	stream := proxy.streams[connID]
 	proxy.mu.Unlock()
 
 	if !exists {
@@ -350,13 +406,32 @@ func (sm *SocksManager) HandleSocksData(socksID, connID, encodedData string) err
 	if err != nil {
 		return fmt.Errorf("failed to decode data: %w", err)
 	}
+	stream.Write(false, data)
+	proxy.traffic.received.Add(int64(len(data)))
 
 	_, err = conn.Write(data)
 	return err
 }
 
-// HandleSocksClose handles connection close from remote side
-func (sm *SocksManager) HandleSocksClose(socksID, connID string) {
+// SetCapture writes the traffic of SOCKS connections established from now
+// on to w, decrypted. A nil w stops capturing new connections.
+func (sm *SocksManager) SetCapture(w *pcap.Writer) {
+	sm.capture.Store(w)
+}
+
+// HandleSocksClose handles connection close from remote side. A connection
+// still waiting for the client failed to reach its target: it gets the
+// SOCKS5 reply matching reason, a protocol.SocksRefused or the like, or a
+// general failure when the client gave none.
+func (sm *SocksManager) HandleSocksClose(socksID, connID, reason string) {
+	reply, ok := socksReplies[reason]
+	if !ok {
+		reply = socks5GeneralFailure
+	}
+	if sm.signalSocks(socksID, connID, reply) {
+		return
+	}
+
 	sm.mu.RLock()
 	proxy, exists := sm.proxies[socksID]
 	sm.mu.RUnlock()
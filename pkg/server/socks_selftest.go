@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+const (
+	selfTestPings   = 5         // Small round trips the latency is the median of
+	selfTestBytes   = 256 << 10 // Bytes echoed to measure throughput
+	selfTestTimeout = time.Minute
+)
+
+// SocksSelfTest is what a SOCKS proxy self-test measured.
+type SocksSelfTest struct {
+	Target     string        `json:"target"`         // Echo endpoint the client connected to
+	Connect    time.Duration `json:"connect_ns"`     // From CONNECT until the client reached it
+	Latency    time.Duration `json:"latency_ns"`     // Median round trip of a small message
+	Throughput float64       `json:"throughput_bps"` // Bytes per second echoed back
+}
+
+// String summarizes the result, e.g. "connect 80ms, round trip 35ms,
+// 1.2 MB/s".
+func (r SocksSelfTest) String() string {
+	return fmt.Sprintf("connect %s, round trip %s, %s",
+		r.Connect.Round(time.Millisecond), r.Latency.Round(time.Millisecond), formatRate(r.Throughput))
+}
+
+// socksReplyText describes a SOCKS5 reply code.
+var socksReplyText = map[byte]string{
+	socks5GeneralFailure:     "general failure",
+	socks5NetworkUnreachable: "network unreachable",
+	socks5HostUnreachable:    "host unreachable",
+	socks5ConnectionRefused:  "connection refused",
+	socks5TTLExpired:         "timed out",
+}
+
+// SelfTest checks that a running SOCKS proxy works end to end before tools
+// are pointed at it. It opens an echo endpoint on echoIP, the listener
+// address the client connected to, and connects to it through the proxy,
+// so the traffic goes out through the client and back. It measures how
+// long the client took to connect, the round trip of small messages and
+// the throughput of a bulk echo. The endpoint takes a single connection
+// and is closed when the test ends.
+func (sm *SocksManager) SelfTest(id, echoIP string) (SocksSelfTest, error) {
+	sm.mu.RLock()
+	proxy, exists := sm.proxies[id]
+	sm.mu.RUnlock()
+	if !exists {
+		return SocksSelfTest{}, fmt.Errorf("SOCKS proxy %s not found", id)
+	}
+
+	echo, err := net.Listen("tcp", net.JoinHostPort(echoIP, "0"))
+	if err != nil {
+		return SocksSelfTest{}, fmt.Errorf("failed to open echo endpoint: %w", err)
+	}
+	defer echo.Close()
+	go serveEcho(echo)
+
+	return socksSelfTest(proxy.LocalAddr, echo.Addr().(*net.TCPAddr), time.Now().Add(selfTestTimeout))
+}
+
+// serveEcho echoes the first connection to ln and stops listening.
+func serveEcho(ln net.Listener) {
+	conn, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	io.Copy(conn, conn)
+}
+
+// socksSelfTest connects to target through the SOCKS5 proxy at proxyAddr
+// and measures the echo coming back.
+func socksSelfTest(proxyAddr string, target *net.TCPAddr, deadline time.Time) (SocksSelfTest, error) {
+	result := SocksSelfTest{Target: target.String()}
+	conn, err := net.DialTimeout("tcp", proxyAddr, time.Until(deadline))
+	if err != nil {
+		return result, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	reply := make([]byte, 4)
+	if _, err := conn.Write([]byte{socks5Version, 1, socks5NoAuth}); err != nil {
+		return result, fmt.Errorf("handshake failed: %w", err)
+	}
+	if _, err := io.ReadFull(conn, reply[:2]); err != nil {
+		return result, fmt.Errorf("handshake failed: %w", err)
+	}
+	if reply[0] != socks5Version || reply[1] != socks5NoAuth {
+		return result, fmt.Errorf("unexpected handshake reply %x", reply[:2])
+	}
+
+	request := []byte{socks5Version, socks5Connect, 0x00, socks5IPv4}
+	addrLen := net.IPv4len
+	if ip4 := target.IP.To4(); ip4 != nil {
+		request = append(request, ip4...)
+	} else {
+		request[3] = socks5IPv6
+		request = append(request, target.IP.To16()...)
+		addrLen = net.IPv6len
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(target.Port))
+
+	start := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return result, fmt.Errorf("CONNECT failed: %w", err)
+	}
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return result, fmt.Errorf("CONNECT failed: %w", err)
+	}
+	if reply[1] != socks5Success {
+		text, ok := socksReplyText[reply[1]]
+		if !ok {
+			text = fmt.Sprintf("reply %d", reply[1])
+		}
+		return result, fmt.Errorf("the client could not reach %s: %s", target, text)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return result, fmt.Errorf("CONNECT failed: %w", err)
+	}
+	result.Connect = time.Since(start)
+
+	rtts := make([]time.Duration, selfTestPings)
+	ping := []byte("gots-selftest")
+	pong := make([]byte, len(ping))
+	for i := range rtts {
+		start := time.Now()
+		if _, err := conn.Write(ping); err != nil {
+			return result, fmt.Errorf("echo failed: %w", err)
+		}
+		if _, err := io.ReadFull(conn, pong); err != nil {
+			return result, fmt.Errorf("echo failed: %w", err)
+		}
+		rtts[i] = time.Since(start)
+	}
+	slices.Sort(rtts)
+	result.Latency = rtts[len(rtts)/2]
+
+	data := make([]byte, selfTestBytes)
+	rand.Read(data) // Incompressible, like most tunneled traffic
+	start = time.Now()
+	written := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(data)
+		written <- err
+	}()
+	echoed := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		return result, fmt.Errorf("echo failed: %w", err)
+	}
+	if err := <-written; err != nil {
+		return result, fmt.Errorf("echo failed: %w", err)
+	}
+	result.Throughput = float64(len(data)) / time.Since(start).Seconds()
+	if !bytes.Equal(echoed, data) {
+		return result, errors.New("echoed data differs from what was sent")
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// fakeSocksClient plays the client side of a SOCKS proxy: it dials the
+// targets of SOCKS_CONN itself and relays SOCKS_DATA, or refuses every
+// connection.
+type fakeSocksClient struct {
+	sm     *SocksManager
+	refuse bool
+	mu     sync.Mutex
+	conns  map[string]net.Conn
+}
+
+func (c *fakeSocksClient) send(msg string) {
+	fields := strings.Fields(msg)
+	if len(fields) < 3 {
+		return
+	}
+	socksID, connID := fields[1], fields[2]
+	switch fields[0] {
+	case protocol.CmdSocksConn:
+		go c.connect(socksID, connID, fields[3])
+	case protocol.CmdSocksData:
+		data, _ := base64.StdEncoding.DecodeString(fields[3])
+		c.mu.Lock()
+		conn := c.conns[connID]
+		c.mu.Unlock()
+		if conn != nil {
+			conn.Write(data)
+		}
+	case protocol.CmdSocksClose:
+		c.mu.Lock()
+		if conn := c.conns[connID]; conn != nil {
+			conn.Close()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *fakeSocksClient) connect(socksID, connID, target string) {
+	if c.refuse {
+		c.sm.HandleSocksClose(socksID, connID, protocol.SocksRefused)
+		return
+	}
+	conn, err := net.Dial("tcp", target)
+	if err != nil {
+		c.sm.HandleSocksClose(socksID, connID, "")
+		return
+	}
+	c.mu.Lock()
+	c.conns[connID] = conn
+	c.mu.Unlock()
+	c.sm.SignalSocksReady(socksID, connID)
+	buf := make([]byte, 32768)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		c.sm.HandleSocksData(socksID, connID, base64.StdEncoding.EncodeToString(buf[:n]))
+	}
+}
+
+func TestSocksSelfTest(t *testing.T) {
+	sm := NewSocksManager()
+	defer sm.StopAll()
+	client := &fakeSocksClient{sm: sm, conns: make(map[string]net.Conn)}
+	if err := sm.StartSocks("ok", "0", true, client.send); err != nil {
+		t.Fatalf("StartSocks failed: %v", err)
+	}
+
+	result, err := sm.SelfTest("ok", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+	if result.Connect <= 0 || result.Latency <= 0 || result.Throughput <= 0 {
+		t.Errorf("expected measurements, got %+v", result)
+	}
+	if !strings.HasPrefix(result.Target, "127.0.0.1:") {
+		t.Errorf("expected an echo endpoint on 127.0.0.1, got %s", result.Target)
+	}
+
+	if _, err := sm.SelfTest("missing", "127.0.0.1"); err == nil {
+		t.Error("expected an error for an unknown proxy")
+	}
+}
+
+func TestSocksSelfTestRefused(t *testing.T) {
+	sm := NewSocksManager()
+	defer sm.StopAll()
+	client := &fakeSocksClient{sm: sm, refuse: true, conns: make(map[string]net.Conn)}
+	if err := sm.StartSocks("refused", "0", true, client.send); err != nil {
+		t.Fatalf("StartSocks failed: %v", err)
+	}
+
+	_, err := sm.SelfTest("refused", "127.0.0.1")
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the client's reason in the error, got %v", err)
+	}
+}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"encoding/base64"
+	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/frjcomp/gots/pkg/protocol"
 )
 
 // helper to capture sent commands
@@ -29,7 +32,7 @@ func TestRelayDataSendsSocksData(t *testing.T) {
 		LocalAddr:   "",
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
 	}
 	sink := &cmdSink{ch: make(chan string, 1)}
 	proxy.sendFunc = sink.send
@@ -84,7 +87,7 @@ func TestHandleSocksDataWritesToLocalConn(t *testing.T) {
 		LocalAddr:   "",
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
 		sendFunc:    func(string) {},
 	}
 
@@ -134,7 +137,7 @@ func TestSocksManager_StartSocks(t *testing.T) {
 		sendCalls = append(sendCalls, msg)
 	}
 	
-	err := sm.StartSocks("test1", "0", sendFunc)
+	err := sm.StartSocks("test1", "0", false, sendFunc)
 	if err != nil {
 		t.Fatalf("StartSocks failed: %v", err)
 	}
@@ -159,7 +162,7 @@ func TestSocksManager_StopSocks(t *testing.T) {
 	
 	sendFunc := func(msg string) {}
 	
-	err := sm.StartSocks("test1", "0", sendFunc)
+	err := sm.StartSocks("test1", "0", false, sendFunc)
 	if err != nil {
 		t.Fatalf("StartSocks failed: %v", err)
 	}
@@ -180,12 +183,12 @@ func TestSocksManager_DuplicateID(t *testing.T) {
 	
 	sendFunc := func(msg string) {}
 	
-	err := sm.StartSocks("test1", "0", sendFunc)
+	err := sm.StartSocks("test1", "0", false, sendFunc)
 	if err != nil {
 		t.Fatalf("First StartSocks failed: %v", err)
 	}
 	
-	err = sm.StartSocks("test1", "0", sendFunc)
+	err = sm.StartSocks("test1", "0", false, sendFunc)
 	if err == nil {
 		t.Error("Expected error for duplicate SOCKS ID, got nil")
 	}
@@ -196,8 +199,8 @@ func TestSocksManager_StopAll(t *testing.T) {
 	
 	sendFunc := func(msg string) {}
 	
-	_ = sm.StartSocks("test1", "0", sendFunc)
-	_ = sm.StartSocks("test2", "0", sendFunc)
+	_ = sm.StartSocks("test1", "0", false, sendFunc)
+	_ = sm.StartSocks("test2", "0", false, sendFunc)
 	
 	sm.StopAll()
 	
@@ -217,7 +220,7 @@ func TestHandleSocksConnectionIPv4Response(t *testing.T) {
 		LocalAddr:   "127.0.0.1:9050",
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
 		sendFunc:    sink.send,
 	}
 	
@@ -229,12 +232,6 @@ func TestHandleSocksConnectionIPv4Response(t *testing.T) {
 	defer client.Close()
 	defer server.Close()
 	
-	// Signal ready chan immediately to skip client connection wait
-	readyChan := make(chan bool, 1)
-	proxy.mu.Lock()
-	proxy.connReady["conn1"] = readyChan
-	proxy.mu.Unlock()
-	
 	// Handle connection in background
 	go sm.handleSocksConnection(proxy, "conn1", server)
 	
@@ -269,10 +266,7 @@ func TestHandleSocksConnectionIPv4Response(t *testing.T) {
 	// Signal ready to allow connection to proceed
 	go func() {
 		time.Sleep(100 * time.Millisecond)
-		select {
-		case readyChan <- true:
-		default:
-		}
+		sm.SignalSocksReady(proxy.ID, "conn1")
 	}()
 	
 	// Read response and check it contains IPv4 address type
@@ -301,7 +295,7 @@ func TestHandleSocksConnectionIPv6Response(t *testing.T) {
 		LocalAddr:   "127.0.0.1:9050",
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
 		sendFunc:    sink.send,
 	}
 	
@@ -324,7 +318,7 @@ func TestHandleSocksConnectionIPv6Response(t *testing.T) {
 		proxy.mu.Unlock()
 		if exists && readyChan != nil {
 			select {
-			case readyChan <- true:
+			case readyChan <- socks5Success:
 			default:
 			}
 		}
@@ -388,7 +382,7 @@ func TestHandleSocksConnectionDomainResponse(t *testing.T) {
 		LocalAddr:   "127.0.0.1:9050",
 		Active:      true,
 		connections: make(map[string]net.Conn),
-		connReady:   make(map[string]chan bool),
+		connReady:   make(map[string]chan byte),
 		sendFunc:    sink.send,
 	}
 	
@@ -411,7 +405,7 @@ func TestHandleSocksConnectionDomainResponse(t *testing.T) {
 		proxy.mu.Unlock()
 		if exists && readyChan != nil {
 			select {
-			case readyChan <- true:
+			case readyChan <- socks5Success:
 			default:
 			}
 		}
@@ -464,3 +458,51 @@ func TestHandleSocksConnectionDomainResponse(t *testing.T) {
 		t.Errorf("Domain length not correct, expected %d got %d", len(domain), response[4])
 	}
 }
+
+func TestSocksManager_FailureReply(t *testing.T) {
+	for _, tt := range []struct {
+		reasons bool
+		reason  string
+		want    byte
+	}{
+		{true, protocol.SocksRefused, socks5ConnectionRefused},
+		{true, protocol.SocksHostUnreachable, socks5HostUnreachable},
+		{true, protocol.SocksNetUnreachable, socks5NetworkUnreachable},
+		{true, protocol.SocksTimeout, socks5TTLExpired},
+		{true, protocol.SocksFailed, socks5GeneralFailure},
+		{false, "", socks5GeneralFailure}, // A client that gives no reason
+	} {
+		sm := NewSocksManager()
+		requests := make(chan string, 4)
+		if err := sm.StartSocks("s1", "0", tt.reasons, func(msg string) { requests <- msg }); err != nil {
+			t.Fatal(err)
+		}
+		<-requests // SOCKS_START
+
+		conn, err := net.Dial("tcp", sm.ListSocks()[0].LocalAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte{socks5Version, 1, socks5NoAuth})
+		io.ReadFull(conn, make([]byte, 2))
+		conn.Write([]byte{socks5Version, socks5Connect, 0, socks5IPv4, 10, 0, 0, 1, 0, 80})
+
+		request := strings.TrimSpace(<-requests)
+		if got := strings.HasSuffix(request, " "+protocol.SocksReasonOpt); got != tt.reasons {
+			t.Errorf("%q: asked for a reason %v, want %v", request, got, tt.reasons)
+		}
+		fields := strings.Fields(request)
+		sm.HandleSocksClose("s1", fields[2], tt.reason)
+
+		reply := make([]byte, 10)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("%s: no SOCKS reply: %v", tt.reason, err)
+		}
+		if reply[1] != tt.want {
+			t.Errorf("%q: reply code %d, want %d", tt.reason, reply[1], tt.want)
+		}
+		conn.Close()
+		sm.StopAll()
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/logging"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// spaGuard admits connections only from addresses that sent a valid SPA
+// packet within the window. Everyone else is disconnected right after the
+// TCP handshake, before TLS, so scanners see an open port that never
+// answers but learn nothing about what runs on it.
+type spaGuard struct {
+	conn    net.PacketConn
+	key     []byte
+	window  time.Duration
+	mu      sync.Mutex
+	allowed map[netip.Addr]time.Time                  // Admitted addresses, until when
+	nonces  map[[protocol.SPANonceSize]byte]time.Time // Nonces seen, until they expire
+}
+
+// EnableSPA requires connecting clients to send an SPA packet signed with
+// key to the UDP address addr first. A valid packet admits its source
+// address for window. It returns the address the packets are read on.
+func (l *Listener) EnableSPA(addr string, key []byte, window time.Duration) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("SPA listener: %w", err)
+	}
+	g := &spaGuard{
+		conn:    conn,
+		key:     key,
+		window:  window,
+		allowed: make(map[netip.Addr]time.Time),
+		nonces:  make(map[[protocol.SPANonceSize]byte]time.Time),
+	}
+	l.mutex.Lock()
+	l.spa = g
+	l.mutex.Unlock()
+	go g.serve()
+	return conn.LocalAddr(), nil
+}
+
+// spaAdmits reports whether a connection may proceed: always without SPA,
+// otherwise if its source address sent a valid SPA packet recently.
+func (l *Listener) spaAdmits(conn net.Conn) bool {
+	l.mutex.Lock()
+	g := l.spa
+	l.mutex.Unlock()
+	if g == nil {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err == nil && g.admits(ap.Addr(), time.Now()) {
+		return true
+	}
+	logging.Debugf("Closed connection from %s: no valid SPA packet", conn.RemoteAddr())
+	return false
+}
+
+func (g *spaGuard) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := g.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		addr, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if err := g.accept(addr.AddrPort().Addr(), buf[:n], time.Now()); err != nil {
+			logging.Debugf("Ignored SPA packet from %s: %v", from, err)
+			continue
+		}
+		log.Printf("SPA: admitting %s for %s", addr.IP, g.window)
+	}
+}
+
+// accept checks an SPA packet and admits its source address. Replayed
+// packets are refused, so a captured packet cannot open the port again,
+// and packets naming their sender are only accepted from that address.
+func (g *spaGuard) accept(from netip.Addr, packet []byte, now time.Time) error {
+	nonce, err := protocol.VerifySPAPacket(g.key, packet, from, now)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for n, until := range g.nonces {
+		if now.After(until) {
+			delete(g.nonces, n)
+		}
+	}
+	for a, until := range g.allowed {
+		if now.After(until) {
+			delete(g.allowed, a)
+		}
+	}
+	if _, seen := g.nonces[nonce]; seen {
+		return errors.New("replayed SPA packet")
+	}
+	// A packet is accepted up to SPAMaxSkew either side of now
+	g.nonces[nonce] = now.Add(2 * protocol.SPAMaxSkew * time.Second)
+	g.allowed[from.Unmap()] = now.Add(g.window)
+	return nil
+}
+
+func (g *spaGuard) admits(addr netip.Addr, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	until, ok := g.allowed[addr.Unmap()]
+	return ok && now.Before(until)
+}
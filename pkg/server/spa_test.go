@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/certs"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestSPAGuardAccept(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	g := &spaGuard{key: key, window: 30 * time.Second, allowed: make(map[netip.Addr]time.Time), nonces: make(map[[protocol.SPANonceSize]byte]time.Time)}
+	now := time.Now()
+	from := netip.MustParseAddr("192.0.2.7")
+	packet, err := protocol.NewSPAPacket(key, netip.Addr{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.admits(from, now) {
+		t.Fatal("expected an unknown address to be refused")
+	}
+	if err := g.accept(from, packet, now); err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	if !g.admits(from, now.Add(10*time.Second)) || !g.admits(netip.MustParseAddr("::ffff:192.0.2.7"), now) {
+		t.Error("expected the sender to be admitted, also as an IPv4-mapped address")
+	}
+	if g.admits(netip.MustParseAddr("192.0.2.8"), now) {
+		t.Error("expected other addresses to stay refused")
+	}
+	if g.admits(from, now.Add(31*time.Second)) {
+		t.Error("expected the admission to end after the window")
+	}
+	if err := g.accept(netip.MustParseAddr("192.0.2.9"), packet, now.Add(time.Second)); err == nil {
+		t.Error("expected a replayed packet to be refused")
+	}
+
+	// A packet bound to its sender admits nobody when sent from elsewhere
+	bound, err := protocol.NewSPAPacket(key, from, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := netip.MustParseAddr("198.51.100.1")
+	if err := g.accept(observer, bound, now); err == nil || g.admits(observer, now) {
+		t.Error("expected a bound packet from another address to be refused")
+	}
+	if err := g.accept(from, bound, now); err != nil {
+		t.Errorf("expected the bound packet to be accepted from its sender: %v", err)
+	}
+}
+
+func TestListenerRequiresSPA(t *testing.T) {
+	cert, _, err := certs.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener("0", "127.0.0.1", &tls.Config{Certificates: []tls.Certificate{cert}}, "")
+	key := bytes.Repeat([]byte{2}, 32)
+	spaAddr, err := l.EnableSPA("127.0.0.1:0", key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := l.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Shutdown(context.Background())
+
+	handshake := func() error {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	if err := handshake(); err == nil {
+		t.Fatal("expected a connection without SPA packet to be closed")
+	}
+
+	packet, err := protocol.NewSPAPacket(key, netip.MustParseAddr("127.0.0.1"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	udp, err := net.Dial("udp", spaAddr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	if _, err := udp.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for handshake() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the SPA packet to admit the client")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
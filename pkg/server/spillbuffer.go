@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// spillBuffer accumulates a client response in memory up to limit bytes and
+// continues in a temporary file beyond that, so the reader does not hold
+// several growing copies while a large response streams in. Past max
+// bytes, when set, the content is discarded and the response fails
+// instead.
+type spillBuffer struct {
+	limit    int
+	max      int64
+	mem      bytes.Buffer
+	file     *os.File
+	size     int64
+	tooLarge bool
+}
+
+// responseTooLargeError is returned for a response that exceeded the
+// buffer's maximum size.
+type responseTooLargeError struct {
+	size, max int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response of %d bytes exceeds the maximum of %d bytes", e.size, e.max)
+}
+
+// newSpillBuffer creates a buffer spilling to disk past limit bytes and
+// failing past max bytes. A max of zero or less means no maximum.
+func newSpillBuffer(limit int, max int64) *spillBuffer {
+	return &spillBuffer{limit: limit, max: max}
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && b.size+int64(len(p)) > b.max {
+		// Keep counting so the error can tell how large the response was
+		if !b.tooLarge {
+			b.discard()
+			b.tooLarge = true
+		}
+		b.size += int64(len(p))
+		return len(p), nil
+	}
+	if b.file == nil && b.mem.Len()+len(p) > b.limit {
+		f, err := os.CreateTemp("", "gots-response-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create spill file: %w", err)
+		}
+		if _, err := f.Write(b.mem.Bytes()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, fmt.Errorf("failed to write spill file: %w", err)
+		}
+		b.file = f
+		b.mem.Reset()
+	}
+
+	var n int
+	var err error
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.mem.Write(p)
+	}
+	b.size += int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes written, including any past the maximum.
+func (b *spillBuffer) Len() int64 {
+	return b.size
+}
+
+// Spilled reports whether the buffer moved to disk.
+func (b *spillBuffer) Spilled() bool {
+	return b.file != nil
+}
+
+// String returns the full buffered content, reading it back from disk if
+// needed. The whole response ends up in memory, which max bounds.
+func (b *spillBuffer) String() (string, error) {
+	if b.tooLarge {
+		return "", &responseTooLargeError{size: b.size, max: b.max}
+	}
+	if b.file == nil {
+		return b.mem.String(), nil
+	}
+	var out strings.Builder
+	out.Grow(int(b.size))
+	if _, err := io.Copy(&out, io.NewSectionReader(b.file, 0, b.size)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Reset discards the content and removes any spill file.
+func (b *spillBuffer) Reset() {
+	b.discard()
+	b.size = 0
+	b.tooLarge = false
+}
+
+// discard drops the buffered content and removes any spill file.
+func (b *spillBuffer) discard() {
+	if b.file != nil {
+		name := b.file.Name()
+		b.file.Close()
+		os.Remove(name)
+		b.file = nil
+	}
+	b.mem.Reset()
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpillBufferStaysInMemoryBelowLimit(t *testing.T) {
+	b := newSpillBuffer(16, 0)
+	defer b.Reset()
+	b.Write([]byte("hello "))
+	b.Write([]byte("world"))
+
+	if b.Spilled() {
+		t.Fatal("expected small content to stay in memory")
+	}
+	if got, _ := b.String(); got != "hello world" {
+		t.Errorf("unexpected content %q", got)
+	}
+}
+
+func TestSpillBufferSpillsToDisk(t *testing.T) {
+	b := newSpillBuffer(8, 0)
+	b.Write([]byte("0123456"))
+	b.Write([]byte("789abcdef"))
+
+	if !b.Spilled() {
+		t.Fatal("expected buffer to spill past the limit")
+	}
+	if b.Len() != 16 {
+		t.Errorf("expected length 16, got %d", b.Len())
+	}
+	if got, _ := b.String(); got != "0123456789abcdef" {
+		t.Errorf("unexpected content %q", got)
+	}
+
+	name := b.file.Name()
+	b.Reset()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected spill file to be removed, stat err: %v", err)
+	}
+	if b.Len() != 0 || b.Spilled() {
+		t.Error("expected reset buffer to be empty and in memory")
+	}
+
+	b.Write([]byte(strings.Repeat("x", 4)))
+	if b.Spilled() {
+		t.Error("expected reused buffer to start in memory")
+	}
+}
+
+func TestSpillBufferFailsPastMax(t *testing.T) {
+	b := newSpillBuffer(4, 10)
+	b.Write([]byte("0123456"))
+	name := b.file.Name()
+	b.Write([]byte("789abc"))
+	b.Write([]byte("def"))
+
+	var tooLarge *responseTooLargeError
+	if _, err := b.String(); !errors.As(err, &tooLarge) || tooLarge.size != 16 || tooLarge.max != 10 {
+		t.Fatalf("expected a too-large error for 16 bytes, got %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected spill file to be removed once the maximum was exceeded, stat err: %v", err)
+	}
+
+	b.Reset()
+	b.Write([]byte("ok"))
+	if got, err := b.String(); err != nil || got != "ok" {
+		t.Errorf("expected reset buffer to accept content again, got %q (%v)", got, err)
+	}
+}
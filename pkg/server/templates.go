@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+// SetCommandTemplates replaces the per-OS command templates used by
+// listener-side helpers such as remote path completion.
+func (l *Listener) SetCommandTemplates(templates map[string]map[string]string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.commandTemplates = templates
+}
+
+// RenderCommand renders the named command template for the OS the client
+// reported in IDENT. Parameters replace {name} placeholders and are quoted
+// for the client's shell.
+func (l *Listener) RenderCommand(clientAddr, name string, params map[string]string) (string, error) {
+	l.mutex.Lock()
+	meta := l.clientMetadata[clientAddr]
+	tpl, ok := config.LookupCommandTemplate(l.commandTemplates, meta.OS, name)
+	l.mutex.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("no %q command template for os %q", name, meta.OS)
+	}
+	return renderTemplate(tpl, meta.OS, params), nil
+}
+
+// CommandTemplate returns the named template for the OS of a client, or the
+// default one for an unknown client.
+func (l *Listener) CommandTemplate(clientAddr, name string) (string, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return config.LookupCommandTemplate(l.commandTemplates, l.clientMetadata[clientAddr].OS, name)
+}
+
+// DefineCommandTemplate adds or replaces the default template name for the
+// rest of the session. OS-specific templates of that name still win.
+func (l *Listener) DefineCommandTemplate(name, tpl string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// Copy, since the maps may be shared with the configuration
+	templates := make(map[string]map[string]string, len(l.commandTemplates)+1)
+	for osName, byName := range l.commandTemplates {
+		templates[osName] = byName
+	}
+	defaults := make(map[string]string, len(templates[config.DefaultTemplateOS])+1)
+	for n, t := range templates[config.DefaultTemplateOS] {
+		defaults[n] = t
+	}
+	defaults[name] = tpl
+	templates[config.DefaultTemplateOS] = defaults
+	l.commandTemplates = templates
+}
+
+// CommandTemplateNames returns the names of all templates for any OS, sorted.
+func (l *Listener) CommandTemplateNames() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, byName := range l.commandTemplates {
+		for name := range byName {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templateParam matches a {name} placeholder.
+var templateParam = regexp.MustCompile(`\{([A-Za-z0-9_-]+)\}`)
+
+// TemplateParams returns the placeholder names of tpl in order of first use.
+func TemplateParams(tpl string) []string {
+	var params []string
+	seen := make(map[string]bool)
+	for _, m := range templateParam.FindAllStringSubmatch(tpl, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			params = append(params, m[1])
+		}
+	}
+	return params
+}
+
+// renderTemplate substitutes {name} placeholders with shell-quoted values.
+func renderTemplate(tpl, osName string, params map[string]string) string {
+	for key, val := range params {
+		tpl = strings.ReplaceAll(tpl, "{"+key+"}", QuoteShellArg(osName, val))
+	}
+	return tpl
+}
+
+// QuoteShellArg quotes a single argument for cmd.exe on Windows and for a
+// POSIX shell everywhere else.
+func QuoteShellArg(osName, arg string) string {
+	if osName == "windows" {
+		return `"` + strings.ReplaceAll(arg, `"`, "") + `"`
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
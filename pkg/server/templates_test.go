@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/config"
+)
+
+func TestRenderCommandUsesClientOS(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	listener.clientMetadata["linux-client"] = ClientMetadata{OS: "linux"}
+	listener.clientMetadata["win-client"] = ClientMetadata{OS: "windows"}
+
+	cmd, err := listener.RenderCommand("linux-client", config.TemplateListDir, map[string]string{"path": "/tmp/it's"})
+	if err != nil {
+		t.Fatalf("RenderCommand failed: %v", err)
+	}
+	if cmd != `ls -la '/tmp/it'\''s'` {
+		t.Errorf("unexpected linux command: %s", cmd)
+	}
+
+	cmd, err = listener.RenderCommand("win-client", config.TemplateListDir, map[string]string{"path": `C:\Users`})
+	if err != nil {
+		t.Fatalf("RenderCommand failed: %v", err)
+	}
+	if cmd != `dir "C:\Users"` {
+		t.Errorf("unexpected windows command: %s", cmd)
+	}
+}
+
+func TestRenderCommandCustomTemplates(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	listener.clientMetadata["esxi"] = ClientMetadata{OS: "linux"}
+	listener.SetCommandTemplates(map[string]map[string]string{
+		"linux": {config.TemplateListDir: "busybox ls -la {path}"},
+	})
+
+	cmd, err := listener.RenderCommand("esxi", config.TemplateListDir, map[string]string{"path": "/"})
+	if err != nil {
+		t.Fatalf("RenderCommand failed: %v", err)
+	}
+	if cmd != "busybox ls -la '/'" {
+		t.Errorf("unexpected command: %s", cmd)
+	}
+
+	if _, err := listener.RenderCommand("esxi", config.TemplateWhoAmI, nil); err == nil {
+		t.Error("expected error for missing template")
+	}
+}
+
+func TestDefineCommandTemplate(t *testing.T) {
+	listener := NewListener("0", "127.0.0.1", nil, "")
+	listener.clientMetadata["db"] = ClientMetadata{OS: "linux"}
+	listener.DefineCommandTemplate("dumpdb", "pg_dump -U {user} {db} > /tmp/{db}.sql")
+
+	tpl, ok := listener.CommandTemplate("db", "dumpdb")
+	if !ok {
+		t.Fatal("expected the template to be defined")
+	}
+	if params := TemplateParams(tpl); len(params) != 2 || params[0] != "user" || params[1] != "db" {
+		t.Errorf("unexpected params %q", params)
+	}
+	cmd, err := listener.RenderCommand("db", "dumpdb", map[string]string{"user": "postgres", "db": "app"})
+	if err != nil || cmd != "pg_dump -U 'postgres' 'app' > /tmp/'app'.sql" {
+		t.Errorf("RenderCommand = %q, %v", cmd, err)
+	}
+
+	names := listener.CommandTemplateNames()
+	if len(names) != 4 || names[0] != "dumpdb" {
+		t.Errorf("unexpected names %q", names)
+	}
+	if _, ok := config.DefaultCommandTemplates()[config.DefaultTemplateOS]["dumpdb"]; ok {
+		t.Error("defaults must not be modified")
+	}
+}
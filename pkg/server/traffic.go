@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of TrafficSample.
+const (
+	TrafficSession = "session"
+	TrafficForward = "forward"
+	TrafficSocks   = "socks"
+)
+
+// tunnelCounters count what went through a forward or SOCKS proxy. The
+// connection goroutines update them without taking any lock.
+type tunnelCounters struct {
+	sent     atomic.Int64 // Payload bytes relayed to the client
+	received atomic.Int64 // Payload bytes relayed from the client
+	conns    atomic.Int64 // Connections accepted so far
+	active   atomic.Int64 // Connections currently open
+}
+
+// open counts a new connection, which close ends.
+func (c *tunnelCounters) open() {
+	c.conns.Add(1)
+	c.active.Add(1)
+}
+
+func (c *tunnelCounters) close() {
+	c.active.Add(-1)
+}
+
+// TrafficSample is a snapshot of the counters of a session or tunnel. The
+// byte counts only grow, so the rate is the difference between two samples
+// over the time between them.
+type TrafficSample struct {
+	Kind        string    `json:"kind"`                         // TrafficSession, TrafficForward or TrafficSocks
+	ID          string    `json:"id"`                           // Client address, or forward or SOCKS proxy ID
+	Sent        int64     `json:"sent_bytes"`                   // To the client
+	Received    int64     `json:"received_bytes"`               // From the client
+	Connections int64     `json:"connections,omitempty"`        // Tunnel connections accepted so far
+	Active      int64     `json:"active_connections,omitempty"` // Tunnel connections open
+	Time        time.Time `json:"time"`
+}
+
+// Traffic samples the counters of every connected session, then every
+// forward and SOCKS proxy, each ordered by ID. Session bytes are the whole
+// connection, tunnels included; tunnel bytes are the relayed payload.
+func (l *Listener) Traffic() []TrafficSample {
+	now := time.Now()
+	l.mutex.Lock()
+	links := maps.Clone(l.links)
+	l.mutex.Unlock()
+
+	var samples []TrafficSample
+	for _, addr := range slices.Sorted(maps.Keys(links)) {
+		m := links[addr]
+		m.mu.Lock()
+		samples = append(samples, TrafficSample{Kind: TrafficSession, ID: addr, Sent: m.sent, Received: m.received, Time: now})
+		m.mu.Unlock()
+	}
+	var tunnels []TrafficSample
+	for _, fwd := range l.forwardManager.ListForwards() {
+		tunnels = append(tunnels, fwd.traffic.sample(TrafficForward, fwd.ID, now))
+	}
+	for _, proxy := range l.socksManager.ListSocks() {
+		tunnels = append(tunnels, proxy.traffic.sample(TrafficSocks, proxy.ID, now))
+	}
+	slices.SortFunc(tunnels, func(a, b TrafficSample) int {
+		return strings.Compare(a.Kind+" "+a.ID, b.Kind+" "+b.ID)
+	})
+	return append(samples, tunnels...)
+}
+
+func (c *tunnelCounters) sample(kind, id string, now time.Time) TrafficSample {
+	return TrafficSample{
+		Kind:        kind,
+		ID:          id,
+		Sent:        c.sent.Load(),
+		Received:    c.received.Load(),
+		Connections: c.conns.Load(),
+		Active:      c.active.Load(),
+		Time:        now,
+	}
+}
+
+// metric is a series family written by WriteMetrics.
+type metric struct {
+	name, help, kind string
+	session          bool // Has a value for sessions, labeled by client
+	tunnel           bool // Has a value for tunnels, labeled by kind and ID
+	value            func(TrafficSample) int64
+}
+
+var metrics = []metric{
+	{"gots_session_sent_bytes_total", "Bytes sent to a client.", "counter", true, false, func(s TrafficSample) int64 { return s.Sent }},
+	{"gots_session_received_bytes_total", "Bytes received from a client.", "counter", true, false, func(s TrafficSample) int64 { return s.Received }},
+	{"gots_tunnel_sent_bytes_total", "Payload bytes a tunnel relayed to its client.", "counter", false, true, func(s TrafficSample) int64 { return s.Sent }},
+	{"gots_tunnel_received_bytes_total", "Payload bytes a tunnel relayed from its client.", "counter", false, true, func(s TrafficSample) int64 { return s.Received }},
+	{"gots_tunnel_connections_total", "Connections a tunnel accepted.", "counter", false, true, func(s TrafficSample) int64 { return s.Connections }},
+	{"gots_tunnel_active_connections", "Connections open through a tunnel.", "gauge", false, true, func(s TrafficSample) int64 { return s.Active }},
+}
+
+// labelEscaper escapes label values for the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes samples in the Prometheus text exposition format, so
+// the listener's traffic can be scraped and graphed.
+func WriteMetrics(w io.Writer, samples []TrafficSample) error {
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range samples {
+			session := s.Kind == TrafficSession
+			switch {
+			case session && m.session:
+				fmt.Fprintf(&b, "%s{client=\"%s\"} %d\n", m.name, labelEscaper.Replace(s.ID), m.value(s))
+			case !session && m.tunnel:
+				fmt.Fprintf(&b, "%s{kind=\"%s\",id=\"%s\"} %d\n", m.name, s.Kind, labelEscaper.Replace(s.ID), m.value(s))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrafficCountsTunnelsAndSessions(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	defer l.socksManager.StopAll()
+	l.newLinkMonitor("10.0.0.1:1000").read(time.Now(), 100)
+	l.links["10.0.0.1:1000"].wrote(40)
+
+	client := &fakeSocksClient{sm: l.socksManager, conns: make(map[string]net.Conn)}
+	if err := l.socksManager.StartSocks("socks-1", "0", true, client.send); err != nil {
+		t.Fatalf("StartSocks failed: %v", err)
+	}
+	if _, err := l.socksManager.SelfTest("socks-1", "127.0.0.1"); err != nil {
+		t.Fatalf("SelfTest failed: %v", err)
+	}
+
+	samples := l.Traffic()
+	if len(samples) != 2 {
+		t.Fatalf("expected a session and a tunnel, got %+v", samples)
+	}
+	session, tunnel := samples[0], samples[1]
+	if session.Kind != TrafficSession || session.Sent != 40 || session.Received != 100 {
+		t.Errorf("unexpected session sample %+v", session)
+	}
+	if tunnel.Kind != TrafficSocks || tunnel.ID != "socks-1" || tunnel.Connections != 1 {
+		t.Errorf("unexpected tunnel sample %+v", tunnel)
+	}
+	if tunnel.Sent < selfTestBytes || tunnel.Received < selfTestBytes {
+		t.Errorf("expected the echoed bytes to be counted both ways, got %+v", tunnel)
+	}
+
+	var b strings.Builder
+	if err := WriteMetrics(&b, samples); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE gots_session_sent_bytes_total counter\n",
+		`gots_session_received_bytes_total{client="10.0.0.1:1000"} 100` + "\n",
+		`gots_tunnel_connections_total{kind="socks",id="socks-1"} 1` + "\n",
+		"# TYPE gots_tunnel_active_connections gauge\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %q in metrics:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `gots_session_sent_bytes_total{kind=`) {
+		t.Error("tunnels must not be reported as sessions")
+	}
+}
+
+func TestWriteMetricsEscapesLabels(t *testing.T) {
+	var b strings.Builder
+	WriteMetrics(&b, []TrafficSample{{Kind: TrafficForward, ID: "a\"b\\c\nd"}})
+	if !strings.Contains(b.String(), `id="a\"b\\c\nd"`) {
+		t.Errorf("label not escaped:\n%s", b.String())
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+const (
+	// maxIdentFrame bounds an IDENT line, and maxIdentValue each of its
+	// values. Real clients send a few hundred bytes.
+	maxIdentFrame = 4096
+	maxIdentValue = 255
+	// maxPromptFrame bounds a PROMPT line: a hex encoded prompt, which is a
+	// short line of the command's output.
+	maxPromptFrame = 8192
+	// maxFrameID bounds forward, SOCKS, watch and connection IDs.
+	maxFrameID = 64
+
+	// A client that sends more than maxProtocolErrors malformed frames
+	// within protocolErrorWindow is quarantined: its frames are ignored
+	// from then on, and the operator is warned once.
+	maxProtocolErrors   = 20
+	protocolErrorWindow = time.Minute
+)
+
+// errorBudget counts the recent protocol errors of a client.
+type errorBudget struct {
+	times       []time.Time
+	quarantined string // Why the client was quarantined, if it was
+}
+
+// frameLimit returns the longest control frame accepted with the given
+// start. Frames that carry data may be as long as a response.
+func frameLimit(start []byte) int {
+	switch {
+	case hasFramePrefix(start, protocol.CmdIdent+" "):
+		return maxIdentFrame
+	case hasFramePrefix(start, protocol.CmdPrompt+" "):
+		return maxPromptFrame
+	case hasFramePrefix(start, protocol.CmdSocksOk+" "), hasFramePrefix(start, protocol.CmdSocksClose+" "),
+		hasFramePrefix(start, protocol.CmdForwardStop+" "), hasFramePrefix(start, protocol.CmdPipeConn+" "),
+		hasFramePrefix(start, protocol.CmdPtyExit):
+		return 4 * maxFrameID
+	}
+	return protocol.MaxBufferSize
+}
+
+func hasFramePrefix(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == prefix
+}
+
+// validateFrame checks the syntax of a control frame before it is
+// dispatched. Payloads are checked for their alphabet only; decoding them
+// is left to the handlers.
+func validateFrame(line string) error {
+	line = strings.TrimRight(line, "\r\n")
+	name, _, _ := strings.Cut(line, " ")
+	fields := strings.Fields(line)
+	switch name {
+	case protocol.CmdIdent:
+		return validateIdent(fields)
+	case protocol.CmdSocksOk, protocol.CmdForwardStop, protocol.CmdPipeConn:
+		return validateIDs(name, fields, 3, 3)
+	case protocol.CmdSocksClose:
+		if err := validateIDs(name, fields, 3, 4); err != nil {
+			return err
+		}
+		if len(fields) == 4 && !isFrameID(fields[3]) {
+			return fmt.Errorf("%s has a malformed reason", name)
+		}
+	case protocol.CmdSocksData, protocol.CmdForwardData:
+		if err := validateIDs(name, fields, 4, 4); err != nil {
+			return err
+		}
+		if !isBase64(fields[3]) {
+			return fmt.Errorf("%s payload is not base64", name)
+		}
+	case protocol.CmdPtyData, protocol.CmdPrompt:
+		if len(fields) > 2 || len(fields) == 2 && !isHex(fields[1]) {
+			return fmt.Errorf("%s payload is not hex", name)
+		}
+	case protocol.CmdWatchEvent:
+		if err := validateIDs(name, fields, 4, 5); err != nil {
+			return err
+		}
+		if !isHex(fields[3]) || len(fields) == 5 && !isHex(fields[4]) {
+			return fmt.Errorf("%s payload is not hex", name)
+		}
+	}
+	return nil
+}
+
+// validateIdent checks the identifier and key=value fields of IDENT.
+func validateIdent(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("%s without an identifier", protocol.CmdIdent)
+	}
+	if !isFrameID(fields[1]) {
+		return fmt.Errorf("%s identifier is not a short [A-Za-z0-9_.-] string", protocol.CmdIdent)
+	}
+	for _, field := range fields[2:] {
+		key, val, _ := strings.Cut(field, "=")
+		if len(val) > maxIdentValue {
+			return fmt.Errorf("%s value of %s is longer than %d bytes", protocol.CmdIdent, key, maxIdentValue)
+		}
+		if !utf8.ValidString(field) || strings.IndexFunc(field, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			return fmt.Errorf("%s value of %s has non-printable characters", protocol.CmdIdent, key)
+		}
+	}
+	return nil
+}
+
+// validateIDs checks the field count of a frame and its IDs, the fields
+// after the name up to the payload.
+func validateIDs(name string, fields []string, minFields, maxFields int) error {
+	if len(fields) < minFields || len(fields) > maxFields {
+		return fmt.Errorf("%s has %d fields", name, len(fields))
+	}
+	for _, id := range fields[1:min(len(fields), 3)] {
+		if !isFrameID(id) {
+			return fmt.Errorf("%s has a malformed ID", name)
+		}
+	}
+	return nil
+}
+
+func isFrameID(s string) bool {
+	if s == "" || len(s) > maxFrameID {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isBase64(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '/' || r == '=') {
+			return false
+		}
+	}
+	return true
+}
+
+// protocolError reports a malformed frame from a client to the operator and
+// charges it to the client's error budget, quarantining the client once
+// the budget is spent. Errors of a quarantined client are not reported.
+func (l *Listener) protocolError(clientAddr, msg string) {
+	now := time.Now()
+	l.mutex.Lock()
+	if l.errorBudgets == nil {
+		l.errorBudgets = make(map[string]*errorBudget)
+	}
+	b := l.errorBudgets[clientAddr]
+	if b == nil {
+		b = &errorBudget{}
+		l.errorBudgets[clientAddr] = b
+	}
+	if b.quarantined != "" {
+		l.mutex.Unlock()
+		return
+	}
+	recent := b.times[:0]
+	for _, t := range b.times {
+		if now.Sub(t) < protocolErrorWindow {
+			recent = append(recent, t)
+		}
+	}
+	b.times = append(recent, now)
+	quarantine := len(b.times) > maxProtocolErrors
+	if quarantine {
+		b.quarantined = fmt.Sprintf("%d malformed frames within %s", len(b.times), protocolErrorWindow)
+		b.times = nil
+	}
+	l.mutex.Unlock()
+
+	l.warn(clientAddr, msg)
+	if quarantine {
+		l.warn(clientAddr, fmt.Sprintf("quarantined after more than %d malformed frames within %s; its frames are ignored from now on", maxProtocolErrors, protocolErrorWindow))
+	}
+}
+
+// Quarantined reports whether a client's frames are ignored because it sent
+// too many malformed ones, and why.
+func (l *Listener) Quarantined(clientAddr string) (string, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if b := l.errorBudgets[clientAddr]; b != nil && b.quarantined != "" {
+		return b.quarantined, true
+	}
+	return "", false
+}
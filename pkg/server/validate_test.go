@@ -0,0 +1,89 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestValidateFrame(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{"IDENT abcd1234 os=linux host=web-1 ip=10.0.0.5 caps=exec,pty\n", true},
+		{"IDENT abcd1234 host=" + strings.Repeat("a", maxIdentValue+1), false},
+		{"IDENT abcd1234 host=web\x1b[2J", false},
+		{"IDENT ab/cd", false},
+		{"IDENT " + strings.Repeat("a", maxFrameID+1), false},
+		{protocol.CmdSocksOk + " s1 c1", true},
+		{protocol.CmdSocksOk + " s1", false},
+		{protocol.CmdForwardStop + " f1 c1 extra", false},
+		{protocol.CmdSocksClose + " s1 c1 " + protocol.SocksRefused, true},
+		{protocol.CmdSocksClose + " s1 c1 bad;reason", false},
+		{protocol.CmdForwardData + " f1 c1 aGVsbG8=", true},
+		{protocol.CmdForwardData + " f1 c1 not*base64", false},
+		{protocol.CmdSocksData + " s;1 c1 aGVsbG8=", false},
+		{protocol.CmdPtyData + " 1f8b00", true},
+		{protocol.CmdPtyData + " zz", false},
+		{protocol.CmdPrompt + " 50617373776f72643a", true},
+		{protocol.CmdWatchEvent + " w1 created 2f746d70", true},
+		{protocol.CmdWatchEvent + " w1 created /tmp", false},
+		{protocol.CmdPtyExit, true},
+	}
+	for _, tt := range tests {
+		if err := validateFrame(tt.line); (err == nil) != tt.ok {
+			t.Errorf("validateFrame(%q) = %v, want ok=%v", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestFrameLimit(t *testing.T) {
+	if frameLimit([]byte("IDENT abc")) != maxIdentFrame {
+		t.Error("expected IDENT frames to be capped")
+	}
+	if frameLimit([]byte(protocol.CmdPtyData+" 00")) != protocol.MaxBufferSize {
+		t.Error("expected PTY data frames to be as long as a response")
+	}
+}
+
+func TestProtocolErrorsQuarantineClient(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	var warnings []string
+	l.SetWarningHandler(func(_, msg string) { warnings = append(warnings, msg) })
+	addr := "10.0.0.1:1000"
+
+	l.handleControlLine(addr, nil, "IDENT abcd1234 host=web\x07")
+	if meta, _ := l.GetClientMetadata(addr); meta.Identifier != "" {
+		t.Fatalf("malformed IDENT was accepted: %+v", meta)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "non-printable") {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+	if _, q := l.Quarantined(addr); q {
+		t.Fatal("one error should not quarantine a client")
+	}
+
+	for i := 0; i < maxProtocolErrors; i++ {
+		l.handleControlLine(addr, nil, protocol.CmdPtyData+" zz")
+	}
+	reason, q := l.Quarantined(addr)
+	if !q || !strings.Contains(reason, "malformed frames") {
+		t.Fatalf("expected quarantine, got %q %v", reason, q)
+	}
+	if last := warnings[len(warnings)-1]; !strings.Contains(last, "quarantined") {
+		t.Errorf("expected a quarantine warning, got %q", last)
+	}
+
+	// Frames of a quarantined client are ignored, without more warnings
+	n := len(warnings)
+	l.handleControlLine(addr, nil, "IDENT abcd1234 os=linux")
+	l.handleControlLine(addr, nil, protocol.CmdPtyData+" zz")
+	if meta, _ := l.GetClientMetadata(addr); meta.Identifier != "" || len(warnings) != n {
+		t.Errorf("quarantined client was served: %+v, %d new warnings", meta, len(warnings)-n)
+	}
+	if _, q := l.Quarantined("10.0.0.2:2000"); q {
+		t.Error("other clients must not be quarantined")
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+// Watch is a path a client reports changes to.
+type Watch struct {
+	ID         string
+	ClientAddr string
+	Path       string
+	Content    bool // Events carry the new content of changed files
+}
+
+// WatchEvent is a change reported by a client for one of its watches.
+type WatchEvent struct {
+	Watch
+	Kind    string // protocol.WatchCreated, WatchModified or WatchRemoved
+	Path    string // The changed path, an entry of Watch.Path for a directory
+	Content []byte // New content, if the watch asked for it and it was sent
+}
+
+// SetWatchHandler sets the function notified of watch events. It runs on
+// its own goroutine. By default events are logged.
+func (l *Listener) SetWatchHandler(fn func(WatchEvent)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.watchFunc = fn
+}
+
+// AddWatch registers a watch on a client and returns it with a new ID, to
+// be sent in a WATCH command.
+func (l *Listener) AddWatch(clientAddr, path string, content bool) Watch {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.nextWatchID++
+	w := Watch{ID: fmt.Sprintf("w%d", l.nextWatchID), ClientAddr: clientAddr, Path: path, Content: content}
+	if l.watches == nil {
+		l.watches = make(map[string]Watch)
+	}
+	l.watches[w.ID] = w
+	return w
+}
+
+// DropWatch forgets a watch, returning it if it was registered.
+func (l *Listener) DropWatch(id string) (Watch, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	w, ok := l.watches[id]
+	delete(l.watches, id)
+	return w, ok
+}
+
+// Watches returns the registered watches ordered by ID.
+func (l *Listener) Watches() []Watch {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	list := make([]Watch, 0, len(l.watches))
+	for _, w := range l.watches {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return len(list[i].ID) < len(list[j].ID) || len(list[i].ID) == len(list[j].ID) && list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// dropClientWatches forgets the watches of a client that disconnected; the
+// client stops them when its connection closes. Called with l.mutex held.
+func (l *Listener) dropClientWatches(clientAddr string) {
+	for id, w := range l.watches {
+		if w.ClientAddr == clientAddr {
+			delete(l.watches, id)
+		}
+	}
+}
+
+// handleWatchFrame decodes a WATCH_EVENT frame and notifies the operator.
+func (l *Listener) handleWatchFrame(clientAddr, line string) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 && len(fields) != 5 {
+		l.protocolError(clientAddr, "malformed watch event frame")
+		return
+	}
+	path, err := hex.DecodeString(fields[3])
+	if err != nil {
+		l.protocolError(clientAddr, "malformed watch event frame")
+		return
+	}
+	l.mutex.Lock()
+	w, ok := l.watches[fields[1]]
+	fn := l.watchFunc
+	l.mutex.Unlock()
+	if !ok || w.ClientAddr != clientAddr {
+		return // Cancelled meanwhile
+	}
+
+	event := WatchEvent{Watch: w, Kind: fields[2], Path: string(path)}
+	if len(fields) == 5 {
+		if event.Content, err = l.decompressFrom(clientAddr, fields[4]); err != nil || len(event.Content) > protocol.MaxWatchContent {
+			l.protocolError(clientAddr, "dropped malformed content of a watch event")
+			event.Content = nil
+		}
+	}
+	if fn == nil {
+		log.Printf("Client %s: %s %s (watch %s)", clientAddr, event.Path, event.Kind, w.ID)
+		return
+	}
+	go fn(event)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/frjcomp/gots/pkg/compression"
+	"github.com/frjcomp/gots/pkg/protocol"
+)
+
+func TestHandleWatchFrame(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	events := make(chan WatchEvent, 1)
+	l.SetWatchHandler(func(e WatchEvent) { events <- e })
+	w := l.AddWatch("10.0.0.1:1000", "/etc", true)
+
+	content, _ := compression.CompressToHex([]byte("root:x:0:0\n"))
+	l.handleControlLine("10.0.0.1:1000", nil, protocol.CmdWatchEvent+" "+w.ID+" modified "+hex.EncodeToString([]byte("/etc/passwd"))+" "+content)
+	select {
+	case e := <-events:
+		if e.ID != w.ID || e.Kind != protocol.WatchModified || e.Path != "/etc/passwd" || string(e.Content) != "root:x:0:0\n" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event delivered")
+	}
+
+	// Events for unknown watches, or from another client, are dropped
+	l.handleWatchFrame("10.0.0.2:2000", protocol.CmdWatchEvent+" "+w.ID+" removed 2f")
+	l.handleWatchFrame("10.0.0.1:1000", protocol.CmdWatchEvent+" w99 removed 2f")
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchRegistry(t *testing.T) {
+	l := NewListener("0", "127.0.0.1", nil, "")
+	for i := 0; i < 10; i++ {
+		l.AddWatch("10.0.0.1:1000", "/tmp", false)
+	}
+	other := l.AddWatch("10.0.0.2:2000", "/var/log", false)
+	watches := l.Watches()
+	if len(watches) != 11 || watches[1].ID != "w2" || watches[9].ID != "w10" {
+		t.Fatalf("unexpected watches %v", watches)
+	}
+
+	l.mutex.Lock()
+	l.dropClientWatches("10.0.0.1:1000")
+	l.mutex.Unlock()
+	if watches := l.Watches(); len(watches) != 1 || watches[0] != other {
+		t.Errorf("expected only the other client's watch, got %v", watches)
+	}
+	if _, ok := l.DropWatch(other.ID); !ok {
+		t.Error("expected DropWatch to find the watch")
+	}
+	if _, ok := l.DropWatch(other.ID); ok {
+		t.Error("expected the watch to be gone")
+	}
+}